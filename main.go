@@ -4,8 +4,13 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/google/go-jsonnet/formatter"
 	"github.com/grafana/jsonnet-language-server/pkg/server"
@@ -33,14 +38,48 @@ func printVersion(w io.Writer) {
 func printHelp(w io.Writer) {
 	printVersion(w)
 	fmt.Fprintf(w, `
+Usage:
+  %[1]s [options]
+                     Serve the language server on stdio.
+  %[1]s lint [options] [paths...]
+                     Lint the Jsonnet files of the paths, files or directories
+                     (default: the current directory), like the language server,
+                     and exit with 1 if there are errors or warnings.
+  %[1]s fmt [options] [paths...]
+                     Format the Jsonnet files of the paths in place.
+
 Options:
   -h / --help        Print this help message.
   -J / --jpath <dir> Specify an additional library search dir
                      (right-most wins).
   -t / --tanka       Create the jsonnet VM with Tanka (finds jpath automatically).
   -l / --log-level   Set the log level (default: info).
+  --log-json         Write the logs as JSON lines.
   --eval-diags       Try to evaluate files to find errors and warnings.
   --lint             Enable linting.
+  --status-notifications
+                     Send jsonnet/status notifications with the evaluation status.
+  --no-warm-up       Don't read and index the vendored libraries on startup.
+  --shard-index      Index the vendored libraries by top-level directory, when one of
+                     their files is first opened or looked up, instead of on startup.
+  --max-parallel-evaluations <n>
+                     Evaluate the diagnostics of up to n documents at the same time
+                     (default: GOMAXPROCS).
+  --max-file-size <bytes>
+                     Don't analyze the files larger than this (default: 10MiB).
+  --otlp-endpoint <url>
+                     Send the spans of the requests to this OTLP/HTTP traces endpoint
+                     (for example: http://localhost:4318/v1/traces).
+  --trace-file <path>
+                     Append the spans of the requests to this file, as OTLP JSON lines.
+  --debug-addr <addr>
+                     Serve pprof profiles and metrics over HTTP on this address
+                     (for example: localhost:6060).
+  --dap              Serve the Debug Adapter Protocol on stdio, to record which
+                     breakpoints the evaluation of a file reaches, instead of
+                     the language server.
+  --watch            With lint and fmt, check the files again when they change,
+                     until interrupted.
   -v / --version     Print version.
 
 Environment variables:
@@ -53,13 +92,36 @@ Environment variables:
 `, name, filepath.ListSeparator)
 }
 
+// optionsWithValue are the options followed by a value, which isn't a path of the lint and fmt subcommands.
+var optionsWithValue = map[string]bool{
+	"-J": true, "--jpath": true, "-l": true, "--log-level": true, "--max-parallel-evaluations": true,
+	"--max-file-size": true, "--otlp-endpoint": true, "--trace-file": true, "--debug-addr": true,
+}
+
+// watchInterval is how often the lint and fmt subcommands look for changed files with --watch.
+const watchInterval = 500 * time.Millisecond
+
 func main() {
+	debugAddr := ""
+	dap := false
+	subcommand := ""
+	if len(os.Args) > 1 && (os.Args[1] == "lint" || os.Args[1] == "fmt") {
+		subcommand = os.Args[1]
+	}
+	var paths []string
+	watch := false
 	config := server.Configuration{
 		JPaths:                    filepath.SplitList(os.Getenv("JSONNET_PATH")),
 		FormattingOptions:         formatter.DefaultOptions(),
 		ShowDocstringInCompletion: false,
 	}
 	log.SetLevel(log.InfoLevel)
+	if subcommand != "" {
+		// The problems are the output of the subcommands
+		log.SetLevel(log.WarnLevel)
+	}
+	// The log lines of the requests carry their correlation IDs
+	log.AddHook(server.RequestIDHook{})
 
 	for i, arg := range os.Args {
 		switch arg {
@@ -79,15 +141,63 @@ func main() {
 				log.Fatalf("Invalid log level: %s", err)
 			}
 			log.SetLevel(logLevel)
+		case "--log-json":
+			log.SetFormatter(&log.JSONFormatter{})
 		case "--lint":
 			config.EnableLintDiagnostics = true
 		case "--eval-diags":
 			config.EnableEvalDiagnostics = true
 		case "--show-docstrings":
 			config.ShowDocstringInCompletion = true
+		case "--status-notifications":
+			config.EnableStatusNotifications = true
+		case "--no-warm-up":
+			config.SkipWarmUp = true
+		case "--shard-index":
+			config.ShardIndex = true
+		case "--max-parallel-evaluations":
+			maxParallel, err := strconv.Atoi(getArgValue(i))
+			if err != nil || maxParallel < 0 {
+				log.Fatalf("Invalid number of parallel evaluations: %s", getArgValue(i))
+			}
+			config.MaxParallelEvaluations = maxParallel
+		case "--max-file-size":
+			maxFileSize, err := strconv.Atoi(getArgValue(i))
+			if err != nil || maxFileSize < 0 {
+				log.Fatalf("Invalid maximum file size: %s", getArgValue(i))
+			}
+			config.MaxFileSize = maxFileSize
+		case "--otlp-endpoint":
+			config.OTLPEndpoint = getArgValue(i)
+		case "--trace-file":
+			config.TraceFile = getArgValue(i)
+		case "--debug-addr":
+			debugAddr = getArgValue(i)
+		case "--dap":
+			dap = true
+		case "--watch":
+			watch = true
+		default:
+			if subcommand != "" && i > 1 && !strings.HasPrefix(arg, "-") && !optionsWithValue[os.Args[i-1]] {
+				paths = append(paths, arg)
+			}
 		}
 	}
 
+	if subcommand != "" {
+		os.Exit(runHeadless(subcommand, config, paths, watch))
+	}
+
+	if dap {
+		log.Infoln("Starting the debug adapter")
+		s := server.NewServer(name, version, nil, config)
+		if err := server.NewDebugAdapter(s, utils.NewDefaultStdio()).Serve(context.Background()); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	log.Infoln("Starting the language server")
 
 	ctx := context.Background()
@@ -96,15 +206,67 @@ func main() {
 	client := protocol.ClientDispatcher(conn)
 
 	s := server.NewServer(name, version, client, config)
+	s.SetNotifier(conn)
+	s.SetCaller(conn)
+
+	if debugAddr != "" {
+		go func() {
+			log.Infof("Serving debug endpoints on %s", debugAddr)
+			debugServer := &http.Server{Addr: debugAddr, Handler: s.DebugHandler(), ReadHeaderTimeout: 10 * time.Second}
+			if err := debugServer.ListenAndServe(); err != nil {
+				log.Errorf("Unable to serve debug endpoints: %v", err)
+			}
+		}()
+	}
 
 	conn.Go(ctx, protocol.Handlers(
-		protocol.ServerHandler(s, jsonrpc2.MethodNotFound)))
+		s.InstrumentHandler(protocol.ServerHandler(s, jsonrpc2.MethodNotFound))))
 	<-conn.Done()
 	if err := conn.Err(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 	}
 }
 
+// runHeadless runs the lint or fmt subcommand on the paths, and returns the exit code. With watch, the files that
+// change are checked again until the process is interrupted.
+func runHeadless(subcommand string, config server.Configuration, paths []string, watch bool) int {
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	config.EnableLintDiagnostics = true
+	checker := server.NewHeadlessChecker(server.NewServer(name, version, nil, config))
+	check := checker.Lint
+	if subcommand == "fmt" {
+		check = checker.Format
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	for {
+		checked, problems, err := check(ctx, os.Stdout, paths)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			if !watch {
+				return 1
+			}
+		}
+		if !watch {
+			if problems > 0 {
+				return 1
+			}
+			return 0
+		}
+		if checked > 0 {
+			fmt.Fprintf(os.Stderr, "%s: checked %d files, %d problems. Watching for changes...\n", subcommand, checked, problems)
+		}
+		select {
+		case <-ctx.Done():
+			return 0
+		case <-time.After(watchInterval):
+		}
+	}
+}
+
 func getArgValue(i int) string {
 	if i == len(os.Args)-1 {
 		printHelp(os.Stdout)
@@ -12,6 +12,16 @@ import (
 )
 
 func FindRangesFromIndexList(stack *nodestack.NodeStack, indexList []string, vm *jsonnet.VM, partialMatchFields bool) ([]ObjectRange, error) {
+	return findRangesFromIndexList(stack, indexList, vm, partialMatchFields, false)
+}
+
+// FindOverriddenRangesFromIndexList finds every definition of the last index, from the nearest override
+// to the field's original declaration, even when the overrides clobber the previous values.
+func FindOverriddenRangesFromIndexList(stack *nodestack.NodeStack, indexList []string, vm *jsonnet.VM) ([]ObjectRange, error) {
+	return findRangesFromIndexList(stack, indexList, vm, false, true)
+}
+
+func findRangesFromIndexList(stack *nodestack.NodeStack, indexList []string, vm *jsonnet.VM, partialMatchFields, allOverrides bool) ([]ObjectRange, error) {
 	var foundDesugaredObjects []*ast.DesugaredObject
 	// First element will be super, self, or var name
 	start, indexList := indexList[0], indexList[1:]
@@ -73,7 +83,7 @@ func FindRangesFromIndexList(stack *nodestack.NodeStack, indexList []string, vm
 		case *ast.Index, *ast.Apply:
 			tempStack := nodestack.NewNodeStack(bodyNode)
 			indexList = append(tempStack.BuildIndexList(), indexList...)
-			return FindRangesFromIndexList(stack, indexList, vm, partialMatchFields)
+			return findRangesFromIndexList(stack, indexList, vm, partialMatchFields, allOverrides)
 		case *ast.Function:
 			// If the function's body is an object, it means we can look for indexes within the function
 			if funcBody := findChildDesugaredObject(bodyNode.Body); funcBody != nil {
@@ -84,10 +94,10 @@ func FindRangesFromIndexList(stack *nodestack.NodeStack, indexList []string, vm
 		}
 	}
 
-	return extractObjectRangesFromDesugaredObjs(vm, foundDesugaredObjects, indexList, partialMatchFields)
+	return extractObjectRangesFromDesugaredObjs(vm, foundDesugaredObjects, indexList, partialMatchFields, allOverrides)
 }
 
-func extractObjectRangesFromDesugaredObjs(vm *jsonnet.VM, desugaredObjs []*ast.DesugaredObject, indexList []string, partialMatchFields bool) ([]ObjectRange, error) {
+func extractObjectRangesFromDesugaredObjs(vm *jsonnet.VM, desugaredObjs []*ast.DesugaredObject, indexList []string, partialMatchFields, allOverrides bool) ([]ObjectRange, error) {
 	var ranges []ObjectRange
 	for len(indexList) > 0 {
 		index := indexList[0]
@@ -104,7 +114,8 @@ func extractObjectRangesFromDesugaredObjs(vm *jsonnet.VM, desugaredObjs []*ast.D
 
 				// If the field is not PlusSuper (field+: value), we stop there. Other previous values are not relevant
 				// If partialMatchCurrentField is true, we can continue to look for other fields
-				if !found.PlusSuper && !partialMatchCurrentField {
+				// If allOverrides is true, the clobbered values are also wanted
+				if !found.PlusSuper && !partialMatchCurrentField && !allOverrides {
 					break
 				}
 			}
@@ -146,7 +157,7 @@ func extractObjectRangesFromDesugaredObjs(vm *jsonnet.VM, desugaredObjs []*ast.D
 				stack, _ := FindNodeByPosition(rootNode, fieldNode.Target.Loc().Begin)
 				if stack != nil {
 					additionalIndexList := append(nodestack.NewNodeStack(fieldNode).BuildIndexList(), indexList...)
-					result, _ := FindRangesFromIndexList(stack, additionalIndexList, vm, partialMatchFields)
+					result, _ := findRangesFromIndexList(stack, additionalIndexList, vm, partialMatchFields, allOverrides)
 					if len(result) > 0 {
 						return result, err
 					}
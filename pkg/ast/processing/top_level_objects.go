@@ -1,22 +1,60 @@
 package processing
 
 import (
+	"sync"
+	"sync/atomic"
+
 	"github.com/google/go-jsonnet"
 	"github.com/google/go-jsonnet/ast"
 	"github.com/grafana/jsonnet-language-server/pkg/nodestack"
 	log "github.com/sirupsen/logrus"
 )
 
-var fileTopLevelObjectsCache = make(map[string][]*ast.DesugaredObject)
+var (
+	// fileTopLevelObjectsCacheMu guards the cache, which the handlers read and write concurrently
+	fileTopLevelObjectsCacheMu sync.RWMutex
+	fileTopLevelObjectsCache   = make(map[string][]*ast.DesugaredObject)
+
+	topLevelObjectsCacheHits, topLevelObjectsCacheMisses atomic.Uint64
+)
+
+// TopLevelObjectsCacheSize returns the number of files whose top level objects are cached.
+func TopLevelObjectsCacheSize() int {
+	fileTopLevelObjectsCacheMu.RLock()
+	defer fileTopLevelObjectsCacheMu.RUnlock()
+	return len(fileTopLevelObjectsCache)
+}
+
+// ClearTopLevelObjectsCache forgets the top level objects found in all files, so that they are read again from disk.
+func ClearTopLevelObjectsCache() {
+	fileTopLevelObjectsCacheMu.Lock()
+	defer fileTopLevelObjectsCacheMu.Unlock()
+	fileTopLevelObjectsCache = make(map[string][]*ast.DesugaredObject)
+}
+
+// TopLevelObjectsCacheStats returns the number of lookups of the top level objects cache that were hits and misses.
+func TopLevelObjectsCacheStats() (hits, misses uint64) {
+	return topLevelObjectsCacheHits.Load(), topLevelObjectsCacheMisses.Load()
+}
 
 func FindTopLevelObjectsInFile(vm *jsonnet.VM, filename, importedFrom string) []*ast.DesugaredObject {
 	cacheKey := importedFrom + ":" + filename
-	if _, ok := fileTopLevelObjectsCache[cacheKey]; !ok {
-		rootNode, _, _ := vm.ImportAST(importedFrom, filename)
-		fileTopLevelObjectsCache[cacheKey] = FindTopLevelObjects(nodestack.NewNodeStack(rootNode), vm)
+	fileTopLevelObjectsCacheMu.RLock()
+	objects, ok := fileTopLevelObjectsCache[cacheKey]
+	fileTopLevelObjectsCacheMu.RUnlock()
+	if ok {
+		topLevelObjectsCacheHits.Add(1)
+		return objects
 	}
 
-	return fileTopLevelObjectsCache[cacheKey]
+	// The objects are found without the lock, finding them looks up the files that the file imports
+	topLevelObjectsCacheMisses.Add(1)
+	rootNode, _, _ := vm.ImportAST(importedFrom, filename)
+	objects = FindTopLevelObjects(nodestack.NewNodeStack(rootNode), vm)
+	fileTopLevelObjectsCacheMu.Lock()
+	fileTopLevelObjectsCache[cacheKey] = objects
+	fileTopLevelObjectsCacheMu.Unlock()
+	return objects
 }
 
 // Find all ast.DesugaredObject's from NodeStack
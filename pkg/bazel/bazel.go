@@ -0,0 +1,248 @@
+// Package bazel finds the import paths of the jsonnet files of Bazel workspaces, from the rules of
+// rules_jsonnet (https://github.com/bazelbuild/rules_jsonnet) in their BUILD files.
+package bazel
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/jsonnet-language-server/pkg/utils"
+)
+
+var (
+	workspaceFiles = []string{"MODULE.bazel", "WORKSPACE.bazel", "WORKSPACE"}
+	buildFiles     = []string{"BUILD.bazel", "BUILD"}
+)
+
+// FindWorkspace returns the root of the Bazel workspace that the path is in, if it is in one.
+func FindWorkspace(path string) (string, bool) {
+	dir, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		dir = filepath.Dir(dir)
+	}
+	for {
+		for _, name := range workspaceFiles {
+			if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+				return dir, true
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// Resolver reads the rules of BUILD files and caches them until the files change.
+type Resolver struct {
+	mu     sync.Mutex
+	builds map[string]*buildFile
+}
+
+type buildFile struct {
+	modified time.Time
+	size     int64
+	rules    []Rule
+}
+
+func NewResolver() *Resolver {
+	return &Resolver{builds: map[string]*buildFile{}}
+}
+
+// ImportPaths returns the import paths that rules_jsonnet gives jsonnet when it evaluates a file of the workspace:
+// the root of the workspace, and the `imports` of the rules that the file is a source of and of their dependencies,
+// relative to their packages. Each path is also given in `bazel-bin`, for generated files, when it exists. If the
+// file isn't the source of a rule, the rules of its package are used. The paths on the right win.
+//
+// The paths that could be found are returned along with the errors of the BUILD files that couldn't be read.
+func (r *Resolver) ImportPaths(root, filename string) ([]string, error) {
+	resolution := &resolution{resolver: r, root: root, visited: map[string]bool{}}
+
+	pkg, ok := resolution.packageOf(filepath.Dir(filename))
+	if ok {
+		rules := resolution.rules(pkg)
+		source := filepath.ToSlash(strings.TrimPrefix(filename, filepath.Join(root, filepath.FromSlash(pkg))+string(filepath.Separator)))
+		var sourceOf []Rule
+		for _, rule := range rules {
+			if isSourceOf(rule, source) {
+				sourceOf = append(sourceOf, rule)
+			}
+		}
+		if len(sourceOf) == 0 {
+			sourceOf = rules
+		}
+		for _, rule := range sourceOf {
+			resolution.visit(pkg, rule)
+		}
+	}
+
+	bin := filepath.Join(root, "bazel-bin")
+	_, err := os.Stat(bin)
+	hasBin := err == nil
+	paths := []string{root}
+	if hasBin {
+		paths = append(paths, bin)
+	}
+	for _, imp := range resolution.imports {
+		paths = append(paths, filepath.Join(root, filepath.FromSlash(imp)))
+		if hasBin {
+			paths = append(paths, filepath.Join(bin, filepath.FromSlash(imp)))
+		}
+	}
+	return paths, errors.Join(resolution.errs...)
+}
+
+// resolution follows the dependencies of rules to collect their imports.
+type resolution struct {
+	resolver *Resolver
+	root     string
+	// visited holds the labels of the rules that were visited
+	visited map[string]bool
+	imports []string
+	errs    []error
+}
+
+// packageOf returns the package, relative to the root, that a directory of the workspace is in.
+func (res *resolution) packageOf(dir string) (string, bool) {
+	for {
+		rel, err := filepath.Rel(res.root, dir)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return "", false
+		}
+		if buildFilePath(dir) != "" {
+			if rel == "." {
+				rel = ""
+			}
+			return filepath.ToSlash(rel), true
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+func (res *resolution) rules(pkg string) []Rule {
+	path := buildFilePath(filepath.Join(res.root, filepath.FromSlash(pkg)))
+	if path == "" {
+		return nil
+	}
+	rules, err := res.resolver.read(path)
+	if err != nil {
+		res.errs = append(res.errs, err)
+	}
+	return rules
+}
+
+// visit collects the imports of a rule of a package, and of its dependencies.
+func (res *resolution) visit(pkg string, rule Rule) {
+	if res.visited[pkg+":"+rule.Name] {
+		return
+	}
+	res.visited[pkg+":"+rule.Name] = true
+
+	for _, imp := range rule.Imports {
+		imp = path.Join(pkg, imp)
+		if !contains(res.imports, imp) {
+			res.imports = append(res.imports, imp)
+		}
+	}
+	for _, dep := range rule.Deps {
+		depPkg, name, ok := parseLabel(pkg, dep)
+		if !ok {
+			continue
+		}
+		for _, depRule := range res.rules(depPkg) {
+			if depRule.Name == name {
+				res.visit(depPkg, depRule)
+			}
+		}
+	}
+}
+
+// read returns the rules of a BUILD file.
+func (r *Resolver) read(path string) ([]Rule, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if cached, ok := r.builds[path]; ok && cached.modified.Equal(info.ModTime()) && cached.size == info.Size() {
+		return cached.rules, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := parseRules(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	r.builds[path] = &buildFile{modified: info.ModTime(), size: info.Size(), rules: rules}
+	return rules, nil
+}
+
+// buildFilePath returns the path of the BUILD file of a directory, or an empty string if it doesn't have one.
+func buildFilePath(dir string) string {
+	for _, name := range buildFiles {
+		path := filepath.Join(dir, name)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+	}
+	return ""
+}
+
+// parseLabel returns the package and the name of a label of the workspace, relative to the package it is used in.
+// Labels of other repositories are not resolved.
+func parseLabel(pkg, label string) (string, string, bool) {
+	switch {
+	case strings.HasPrefix(label, "@@//"):
+		label = label[2:]
+	case strings.HasPrefix(label, "@//"):
+		label = label[1:]
+	case strings.HasPrefix(label, "@"):
+		return "", "", false
+	}
+
+	if !strings.HasPrefix(label, "//") {
+		return pkg, strings.TrimPrefix(label, ":"), label != ""
+	}
+	label = label[2:]
+	if i := strings.Index(label, ":"); i != -1 {
+		return label[:i], label[i+1:], true
+	}
+	return label, path.Base(label), label != ""
+}
+
+// isSourceOf tells whether the file, relative to the package of the rule, is one of its sources. The sources may
+// be glob patterns.
+func isSourceOf(rule Rule, source string) bool {
+	for _, pattern := range rule.Srcs {
+		if strings.HasPrefix(pattern, ":") || strings.HasPrefix(pattern, "//") || strings.HasPrefix(pattern, "@") {
+			continue
+		}
+		if utils.MatchGlob(pattern, source) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, value string) bool {
+	for _, element := range list {
+		if element == value {
+			return true
+		}
+	}
+	return false
+}
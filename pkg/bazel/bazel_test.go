@@ -0,0 +1,169 @@
+package bazel
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeWorkspace(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	}
+	return root
+}
+
+func TestFindWorkspace(t *testing.T) {
+	root := writeWorkspace(t, map[string]string{
+		"MODULE.bazel":         "",
+		"app/BUILD":            "",
+		"app/main.jsonnet":     "{}",
+		"nested/WORKSPACE":     "",
+		"nested/app/a.jsonnet": "{}",
+	})
+
+	found, ok := FindWorkspace(filepath.Join(root, "app", "main.jsonnet"))
+	assert.True(t, ok)
+	assert.Equal(t, root, found)
+
+	found, ok = FindWorkspace(filepath.Join(root, "nested", "app", "a.jsonnet"))
+	assert.True(t, ok)
+	assert.Equal(t, filepath.Join(root, "nested"), found)
+
+	_, ok = FindWorkspace(t.TempDir())
+	assert.False(t, ok)
+}
+
+func TestImportPaths(t *testing.T) {
+	root := writeWorkspace(t, map[string]string{
+		"WORKSPACE": "",
+		"app/BUILD.bazel": `
+jsonnet_to_json(name = "main", src = "main.jsonnet", deps = [":lib", "//third_party/k8s", "@external//:lib"])
+jsonnet_to_json(name = "other", src = "other.jsonnet", deps = ["//common:lib"])
+jsonnet_library(name = "lib", srcs = glob(["lib/**/*.libsonnet"]), imports = ["lib"], deps = [":lib"])
+`,
+		"app/main.jsonnet":  "{}",
+		"app/other.jsonnet": "{}",
+		"app/sub/x.jsonnet": "{}",
+		"third_party/k8s/BUILD": `
+jsonnet_library(name = "k8s", srcs = ["k8s.libsonnet"], imports = [".", "vendor"])
+`,
+		"common/BUILD": `
+jsonnet_library(name = "lib", srcs = ["common.libsonnet"], imports = ["."])
+`,
+		"broken/BUILD":         `jsonnet_library(name = "lib`,
+		"broken/main.jsonnet":  "{}",
+		"nobuild/main.jsonnet": "{}",
+	})
+	resolver := NewResolver()
+
+	testCases := []struct {
+		name        string
+		file        string
+		expected    []string
+		expectedErr string
+	}{
+		{
+			name: "dependencies",
+			file: "app/main.jsonnet",
+			expected: []string{
+				root,
+				filepath.Join(root, "app", "lib"),
+				filepath.Join(root, "third_party", "k8s"),
+				filepath.Join(root, "third_party", "k8s", "vendor"),
+			},
+		},
+		{
+			name:     "only the rules of the file",
+			file:     "app/other.jsonnet",
+			expected: []string{root, filepath.Join(root, "common")},
+		},
+		{
+			name:     "glob source",
+			file:     "app/lib/a/b.libsonnet",
+			expected: []string{root, filepath.Join(root, "app", "lib")},
+		},
+		{
+			name: "rules of the package",
+			file: "app/sub/x.jsonnet",
+			expected: []string{
+				root,
+				filepath.Join(root, "app", "lib"),
+				filepath.Join(root, "third_party", "k8s"),
+				filepath.Join(root, "third_party", "k8s", "vendor"),
+				filepath.Join(root, "common"),
+			},
+		},
+		{
+			name:     "no package",
+			file:     "nobuild/main.jsonnet",
+			expected: []string{root},
+		},
+		{
+			name:        "broken build file",
+			file:        "broken/main.jsonnet",
+			expected:    []string{root},
+			expectedErr: filepath.Join(root, "broken", "BUILD") + ": line 1: unterminated string",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			paths, err := resolver.ImportPaths(root, filepath.Join(root, filepath.FromSlash(tc.file)))
+			if tc.expectedErr != "" {
+				require.EqualError(t, err, tc.expectedErr)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tc.expected, paths)
+		})
+	}
+}
+
+func TestImportPathsWithBazelBin(t *testing.T) {
+	root := writeWorkspace(t, map[string]string{
+		"WORKSPACE":        "",
+		"app/BUILD":        `jsonnet_to_json(name = "main", src = "main.jsonnet", imports = ["vendor"])`,
+		"app/main.jsonnet": "{}",
+		"bazel-bin/.keep":  "",
+	})
+
+	paths, err := NewResolver().ImportPaths(root, filepath.Join(root, "app", "main.jsonnet"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		root,
+		filepath.Join(root, "bazel-bin"),
+		filepath.Join(root, "app", "vendor"),
+		filepath.Join(root, "bazel-bin", "app", "vendor"),
+	}, paths)
+}
+
+func TestParseLabel(t *testing.T) {
+	testCases := []struct {
+		label, expectedPkg, expectedName string
+		expectedOK                       bool
+	}{
+		{":lib", "app", "lib", true},
+		{"lib", "app", "lib", true},
+		{"//common:lib", "common", "lib", true},
+		{"//third_party/k8s", "third_party/k8s", "k8s", true},
+		{"@//common:lib", "common", "lib", true},
+		{"@@//common:lib", "common", "lib", true},
+		{"@external//:lib", "", "", false},
+		{"//:lib", "", "lib", true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.label, func(t *testing.T) {
+			pkg, name, ok := parseLabel("app", tc.label)
+			assert.Equal(t, tc.expectedOK, ok)
+			assert.Equal(t, tc.expectedPkg, pkg)
+			assert.Equal(t, tc.expectedName, name)
+		})
+	}
+}
@@ -0,0 +1,274 @@
+package bazel
+
+import (
+	"fmt"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdentifier
+	tokenString
+	// tokenOther is a number or a punctuation character, its text tells which
+	tokenOther
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// lex splits the contents of a BUILD file into the tokens that rules are read from. Strings are unquoted.
+func lex(input string) ([]token, error) {
+	var tokens []token
+	line := 1
+	for i := 0; i < len(input); {
+		c := input[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r' || c == '\\':
+			i++
+		case c == '#':
+			for i < len(input) && input[i] != '\n' {
+				i++
+			}
+		case c == '"' || c == '\'' || ((c == 'r' || c == 'R' || c == 'b' || c == 'B') && i+1 < len(input) && (input[i+1] == '"' || input[i+1] == '\'')):
+			start := line
+			end, value, err := lexString(input, i)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", start, err)
+			}
+			line += strings.Count(input[i:end], "\n")
+			tokens = append(tokens, token{kind: tokenString, text: value})
+			i = end
+		case c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+			start := i
+			for i < len(input) && (input[i] == '_' || (input[i] >= 'a' && input[i] <= 'z') || (input[i] >= 'A' && input[i] <= 'Z') || (input[i] >= '0' && input[i] <= '9')) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdentifier, text: input[start:i]})
+		default:
+			tokens = append(tokens, token{kind: tokenOther, text: string(c)})
+			i++
+		}
+	}
+	return append(tokens, token{kind: tokenEOF}), nil
+}
+
+// lexString reads the string that starts at the offset, with its optional prefix, and returns the offset of its end
+// and its value.
+func lexString(input string, start int) (int, string, error) {
+	i := start
+	raw := false
+	if c := input[i]; c != '"' && c != '\'' {
+		raw = c == 'r' || c == 'R'
+		i++
+	}
+	quote := input[i : i+1]
+	if strings.HasPrefix(input[i:], strings.Repeat(quote, 3)) {
+		quote = strings.Repeat(quote, 3)
+	}
+	i += len(quote)
+
+	var value strings.Builder
+	for i < len(input) {
+		switch {
+		case strings.HasPrefix(input[i:], quote):
+			return i + len(quote), value.String(), nil
+		case input[i] == '\n' && len(quote) == 1:
+			return 0, "", fmt.Errorf("unterminated string")
+		case input[i] == '\\' && i+1 < len(input):
+			if raw {
+				value.WriteString(input[i : i+2])
+			} else {
+				switch input[i+1] {
+				case 'n':
+					value.WriteByte('\n')
+				case 't':
+					value.WriteByte('\t')
+				case '\n':
+				default:
+					value.WriteByte(input[i+1])
+				}
+			}
+			i += 2
+		default:
+			value.WriteByte(input[i])
+			i++
+		}
+	}
+	return 0, "", fmt.Errorf("unterminated string")
+}
+
+// Rule is a call to a jsonnet rule, like `jsonnet_library`, of a BUILD file.
+type Rule struct {
+	Kind    string
+	Name    string
+	Srcs    []string
+	Deps    []string
+	Imports []string
+}
+
+// parseRules returns the calls to rules whose names start with `jsonnet_` in the contents of a BUILD file. Only the
+// strings of their attributes are kept: `srcs = ["a.jsonnet"] + glob(["*.libsonnet"])` has the sources `a.jsonnet`
+// and `*.libsonnet`.
+func parseRules(input string) ([]Rule, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+
+	var rules []Rule
+	for p.peek().kind != tokenEOF {
+		t := p.next()
+		if t.kind != tokenIdentifier || !strings.HasPrefix(t.text, "jsonnet_") || p.peek().text != "(" {
+			continue
+		}
+		p.next()
+		rule := Rule{Kind: t.text}
+		for _, arg := range p.arguments() {
+			switch arg.name {
+			case "name":
+				if len(arg.strings) > 0 {
+					rule.Name = arg.strings[0]
+				}
+			case "src", "srcs":
+				rule.Srcs = append(rule.Srcs, arg.strings...)
+			case "deps":
+				rule.Deps = append(rule.Deps, arg.strings...)
+			case "imports":
+				rule.Imports = append(rule.Imports, arg.strings...)
+			}
+		}
+		if rule.Name != "" {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+type argument struct {
+	// name is empty for positional arguments
+	name    string
+	strings []string
+}
+
+// arguments reads the arguments of a call, up to its closing parenthesis.
+func (p *parser) arguments() []argument {
+	var args []argument
+	for {
+		switch p.peek().text {
+		case ")":
+			p.next()
+			return args
+		case ",":
+			p.next()
+			continue
+		}
+		if p.peek().kind == tokenEOF {
+			return args
+		}
+
+		start := p.pos
+		var arg argument
+		if p.peek().kind == tokenIdentifier && p.tokens[p.pos+1].text == "=" && p.tokens[p.pos+2].text != "=" {
+			arg.name = p.next().text
+			p.next()
+		}
+		arg.strings = p.expression()
+		if p.pos == start {
+			// A stray closing bracket
+			p.next()
+			continue
+		}
+		args = append(args, arg)
+	}
+}
+
+// expression reads an expression, up to the comma or closing bracket that ends it, and returns its strings. The
+// strings of calls are their arguments', except for the `exclude` argument of globs, and the strings of dicts are
+// their values', for selects.
+func (p *parser) expression() []string {
+	var values []string
+	for {
+		t := p.peek()
+		switch {
+		case t.kind == tokenEOF, t.text == ",", t.text == ")", t.text == "]", t.text == "}", t.text == ":":
+			return values
+		case t.kind == tokenString:
+			p.next()
+			values = append(values, t.text)
+		case t.text == "[":
+			p.next()
+			values = append(values, p.elements("]")...)
+		case t.text == "{":
+			p.next()
+			values = append(values, p.dict()...)
+		case t.text == "(":
+			p.next()
+			values = append(values, p.elements(")")...)
+		case t.kind == tokenIdentifier && p.tokens[p.pos+1].text == "(":
+			p.next()
+			p.next()
+			for _, arg := range p.arguments() {
+				if arg.name != "exclude" {
+					values = append(values, arg.strings...)
+				}
+			}
+		default:
+			p.next()
+		}
+	}
+}
+
+// elements reads the elements of a list or a tuple, up to the closing bracket.
+func (p *parser) elements(closing string) []string {
+	var values []string
+	for {
+		values = append(values, p.expression()...)
+		if t := p.next(); t.text == closing || t.kind == tokenEOF {
+			return values
+		}
+	}
+}
+
+// dict reads the values of a dict, up to its closing brace.
+func (p *parser) dict() []string {
+	var values []string
+	for {
+		// The key
+		p.expression()
+		if t := p.next(); t.text != ":" {
+			if t.text == "}" || t.kind == tokenEOF {
+				return values
+			}
+			continue
+		}
+		values = append(values, p.expression()...)
+		if t := p.next(); t.text == "}" || t.kind == tokenEOF {
+			return values
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package bazel
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRules(t *testing.T) {
+	testCases := []struct {
+		name        string
+		build       string
+		expected    []Rule
+		expectedErr string
+	}{
+		{
+			name: "library",
+			build: `
+load("@rules_jsonnet//jsonnet:jsonnet.bzl", "jsonnet_library")
+
+jsonnet_library(
+    name = "lib",
+    srcs = ["lib.libsonnet"] + glob(["vendor/**/*.libsonnet"], exclude = ["vendor/test/*"]),
+    imports = ["vendor"],
+    deps = [
+        ":other",  # a comment
+        "//common:k8s",
+    ],
+    visibility = ["//visibility:public"],
+)
+`,
+			expected: []Rule{{
+				Kind:    "jsonnet_library",
+				Name:    "lib",
+				Srcs:    []string{"lib.libsonnet", "vendor/**/*.libsonnet"},
+				Deps:    []string{":other", "//common:k8s"},
+				Imports: []string{"vendor"},
+			}},
+		},
+		{
+			name: "several rules and other calls",
+			build: `
+filegroup(name = "files", srcs = ["a.jsonnet"])
+
+jsonnet_to_json(
+    name = 'main',
+    src = 'main.jsonnet',
+    outs = ["main.json"],
+    deps = select({
+        "//conditions:default": [":lib"],
+    }),
+    ext_strs = {"env": "dev"},
+)
+
+jsonnet_to_json_test(name = """test""", src = r"test\.jsonnet", golden = "test.json")
+`,
+			expected: []Rule{
+				{Kind: "jsonnet_to_json", Name: "main", Srcs: []string{"main.jsonnet"}, Deps: []string{":lib"}},
+				{Kind: "jsonnet_to_json_test", Name: "test", Srcs: []string{`test\.jsonnet`}},
+			},
+		},
+		{
+			name:  "computed name",
+			build: `jsonnet_library(name = NAME, srcs = ["a.libsonnet"])`,
+		},
+		{
+			name:  "stray brackets",
+			build: `jsonnet_library(name = "lib"]], srcs = ["a.libsonnet"])`,
+			expected: []Rule{
+				{Kind: "jsonnet_library", Name: "lib", Srcs: []string{"a.libsonnet"}},
+			},
+		},
+		{
+			name:        "unterminated string",
+			build:       "\njsonnet_library(name = \"lib)\n",
+			expectedErr: "line 2: unterminated string",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rules, err := parseRules(tc.build)
+			if tc.expectedErr != "" {
+				require.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, rules)
+		})
+	}
+}
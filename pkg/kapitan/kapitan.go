@@ -0,0 +1,289 @@
+// Package kapitan reads the inventories of Kapitan (https://kapitan.dev) projects.
+//
+// A Kapitan project is a directory with an `inventory/targets` directory, or a `.kapitan` file. Its targets are
+// the YAML files of `inventory/targets`, and their parameters are merged from the classes of `inventory/classes`
+// that they include, like reclass does. The jsonnet files that a target compiles are listed by its
+// `parameters.kapitan.compile` entries.
+package kapitan
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const dotfile = ".kapitan"
+
+// defaultSearchPaths are the search paths of `kapitan compile`, relative to the project's root.
+var defaultSearchPaths = []string{".", "lib"}
+
+// Project is a Kapitan project and its inventory.
+type Project struct {
+	Root string
+	// SearchPaths are the absolute paths that imports are resolved from
+	SearchPaths []string
+	// InventoryPath is the absolute path of the inventory
+	InventoryPath string
+	Targets       map[string]*Target
+}
+
+// Target is a target of the inventory, with its classes merged.
+type Target struct {
+	Name         string
+	Classes      []string
+	Applications []string
+	Parameters   map[string]interface{}
+}
+
+// Inventory returns the inventory of the target, the way Kapitan's `inventory` native function does.
+func (t *Target) Inventory() map[string]interface{} {
+	classes := make([]interface{}, len(t.Classes))
+	for i, class := range t.Classes {
+		classes[i] = class
+	}
+	applications := make([]interface{}, len(t.Applications))
+	for i, application := range t.Applications {
+		applications[i] = application
+	}
+	return map[string]interface{}{
+		"classes":      classes,
+		"applications": applications,
+		"parameters":   t.Parameters,
+		"environment":  "base",
+		"exports":      map[string]interface{}{},
+	}
+}
+
+// Vars returns the external variables that Kapitan evaluates the target's jsonnet files with:
+// `parameters.kapitan.vars`, with `target` set to the name of the target if they don't set it.
+func (t *Target) Vars() map[string]interface{} {
+	vars := map[string]interface{}{"target": t.Name}
+	kapitan, _ := t.Parameters["kapitan"].(map[string]interface{})
+	if configured, ok := kapitan["vars"].(map[string]interface{}); ok {
+		for name, value := range configured {
+			vars[name] = value
+		}
+	}
+	return vars
+}
+
+// Compiles tells whether the target compiles the jsonnet file.
+func (p *Project) Compiles(target *Target, filename string) bool {
+	kapitan, _ := target.Parameters["kapitan"].(map[string]interface{})
+	compile, _ := kapitan["compile"].([]interface{})
+	for _, item := range compile {
+		entry, ok := item.(map[string]interface{})
+		if !ok || entry["input_type"] != "jsonnet" {
+			continue
+		}
+		inputPaths, _ := entry["input_paths"].([]interface{})
+		for _, inputPath := range inputPaths {
+			inputPath, ok := inputPath.(string)
+			if !ok {
+				continue
+			}
+			// Like Kapitan, the input paths are looked up in the search paths, and they may be globs
+			for _, searchPath := range p.SearchPaths {
+				if matched, _ := filepath.Match(filepath.Join(searchPath, inputPath), filename); matched {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// TargetFor returns the first target, by name, that compiles the jsonnet file, or nil if none do.
+func (p *Project) TargetFor(filename string) *Target {
+	names := make([]string, 0, len(p.Targets))
+	for name := range p.Targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if p.Compiles(p.Targets[name], filename) {
+			return p.Targets[name]
+		}
+	}
+	return nil
+}
+
+// FindRoot returns the root of the Kapitan project that the path is in, if it is in one.
+func FindRoot(path string) (string, bool) {
+	dir, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		dir = filepath.Dir(dir)
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, dotfile)); err == nil {
+			return dir, true
+		}
+		if info, err := os.Stat(filepath.Join(dir, "inventory", "targets")); err == nil && info.IsDir() {
+			return dir, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// Loader reads projects and caches them until their inventory changes.
+type Loader struct {
+	mu       sync.Mutex
+	projects map[string]*cachedProject
+}
+
+type cachedProject struct {
+	project *Project
+	state   inventoryState
+}
+
+// inventoryState changes when a file of the inventory, or the `.kapitan` file, changes.
+type inventoryState struct {
+	files    int
+	modified time.Time
+}
+
+func NewLoader() *Loader {
+	return &Loader{projects: map[string]*cachedProject{}}
+}
+
+// Load returns the project whose root is the directory.
+func (l *Loader) Load(root string) (*Project, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	searchPaths, inventoryPath, err := readDotfile(root)
+	if err != nil {
+		return nil, err
+	}
+	state := readInventoryState(root, inventoryPath)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if cached, ok := l.projects[root]; ok && cached.state == state {
+		return cached.project, nil
+	}
+
+	targets, err := LoadTargets(inventoryPath)
+	if err != nil {
+		return nil, err
+	}
+	project := &Project{
+		Root:          root,
+		SearchPaths:   searchPaths,
+		InventoryPath: inventoryPath,
+		Targets:       targets,
+	}
+	l.projects[root] = &cachedProject{project: project, state: state}
+	return project, nil
+}
+
+// readDotfile returns the search paths and the inventory path of a project, from its `.kapitan` file if it sets them.
+func readDotfile(root string) ([]string, string, error) {
+	var config struct {
+		Compile struct {
+			SearchPaths   []string `yaml:"search-paths"`
+			InventoryPath string   `yaml:"inventory-path"`
+		} `yaml:"compile"`
+	}
+	data, err := os.ReadFile(filepath.Join(root, dotfile))
+	switch {
+	case err == nil:
+		if err := yaml.Unmarshal(data, &config); err != nil {
+			return nil, "", fmt.Errorf("%s: %w", filepath.Join(root, dotfile), err)
+		}
+	case !os.IsNotExist(err):
+		return nil, "", err
+	}
+
+	relativePaths := config.Compile.SearchPaths
+	if len(relativePaths) == 0 {
+		relativePaths = defaultSearchPaths
+	}
+	searchPaths := make([]string, len(relativePaths))
+	for i, path := range relativePaths {
+		searchPaths[i] = absolute(root, path)
+	}
+	inventoryPath := config.Compile.InventoryPath
+	if inventoryPath == "" {
+		inventoryPath = "inventory"
+	}
+	return searchPaths, absolute(root, inventoryPath), nil
+}
+
+func absolute(root, path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(root, path)
+}
+
+func readInventoryState(root, inventoryPath string) inventoryState {
+	var state inventoryState
+	record := func(info fs.FileInfo) {
+		state.files++
+		if info.ModTime().After(state.modified) {
+			state.modified = info.ModTime()
+		}
+	}
+	if info, err := os.Stat(filepath.Join(root, dotfile)); err == nil {
+		record(info)
+	}
+	_ = filepath.WalkDir(inventoryPath, func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info, err := entry.Info(); err == nil {
+			record(info)
+		}
+		return nil
+	})
+	return state
+}
+
+// LoadTargets reads the targets of an inventory. Targets are named after their files.
+func LoadTargets(inventoryPath string) (map[string]*Target, error) {
+	targets := map[string]*Target{}
+	targetsPath := filepath.Join(inventoryPath, "targets")
+	err := filepath.WalkDir(targetsPath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || !isYAML(path) {
+			return nil
+		}
+		name := strings.TrimSuffix(entry.Name(), filepath.Ext(path))
+		if _, ok := targets[name]; ok {
+			return fmt.Errorf("%s: target %s is defined more than once", path, name)
+		}
+		target, err := loadTarget(inventoryPath, name, path)
+		if err != nil {
+			return err
+		}
+		targets[name] = target
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return targets, nil
+}
+
+func isYAML(path string) bool {
+	ext := filepath.Ext(path)
+	return ext == ".yml" || ext == ".yaml"
+}
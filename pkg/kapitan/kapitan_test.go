@@ -0,0 +1,194 @@
+package kapitan
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testdataPath(t *testing.T, elem ...string) string {
+	t.Helper()
+	path, err := filepath.Abs(filepath.Join(append([]string{"testdata"}, elem...)...))
+	require.NoError(t, err)
+	return path
+}
+
+func TestFindRoot(t *testing.T) {
+	testCases := []struct {
+		name         string
+		path         string
+		expectedRoot string
+		expectedOK   bool
+	}{
+		{
+			name:         "inventory targets",
+			path:         testdataPath(t, "project", "components", "app", "main.jsonnet"),
+			expectedRoot: testdataPath(t, "project"),
+			expectedOK:   true,
+		},
+		{
+			name:         "directory",
+			path:         testdataPath(t, "project", "lib"),
+			expectedRoot: testdataPath(t, "project"),
+			expectedOK:   true,
+		},
+		{
+			name:         "dotfile",
+			path:         testdataPath(t, "dotfile", "components", "main.jsonnet"),
+			expectedRoot: testdataPath(t, "dotfile"),
+			expectedOK:   true,
+		},
+		{
+			name: "not a project",
+			path: os.TempDir(),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			root, ok := FindRoot(tc.path)
+			assert.Equal(t, tc.expectedOK, ok)
+			assert.Equal(t, tc.expectedRoot, root)
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	project, err := NewLoader().Load(testdataPath(t, "project"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{testdataPath(t, "project"), testdataPath(t, "project", "lib")}, project.SearchPaths)
+	assert.Equal(t, testdataPath(t, "project", "inventory"), project.InventoryPath)
+	require.Len(t, project.Targets, 2)
+
+	dev := project.Targets["dev"]
+	assert.Equal(t, []string{"common", "component.app.defaults", "component.app"}, dev.Classes)
+	assert.Equal(t, []string{"app"}, dev.Applications)
+	assert.Equal(t, map[string]interface{}{
+		"image":   "app:1.1",
+		"version": "1.1",
+		"port":    float64(8080),
+		"args":    []interface{}{"--verbose", "--debug"},
+		"escaped": "${app:version}",
+	}, dev.Parameters["app"])
+	assert.Equal(t, float64(2), dev.Parameters["replicas"])
+	assert.Equal(t, map[string]interface{}{"team": "platform", "env": "dev"}, dev.Parameters["labels"])
+	assert.Equal(t, map[string]interface{}{"target": "dev"}, dev.Vars())
+
+	prod := project.Targets["prod"]
+	assert.Equal(t, "app:1.0", prod.Parameters["app"].(map[string]interface{})["image"])
+	assert.Equal(t, map[string]interface{}{"env": "prod"}, prod.Parameters["labels"])
+	assert.Equal(t, map[string]interface{}{"target": "prod", "env": "production", "replicas": float64(1)}, prod.Vars())
+	assert.Equal(t, map[string]interface{}{
+		"classes":      []interface{}{"common", "component.app.defaults", "component.app"},
+		"applications": []interface{}{"app"},
+		"parameters":   prod.Parameters,
+		"environment":  "base",
+		"exports":      map[string]interface{}{},
+	}, prod.Inventory())
+}
+
+func TestLoadDotfile(t *testing.T) {
+	project, err := NewLoader().Load(testdataPath(t, "dotfile"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{testdataPath(t, "dotfile", "libs")}, project.SearchPaths)
+	assert.Equal(t, testdataPath(t, "dotfile", "config"), project.InventoryPath)
+	require.Contains(t, project.Targets, "minimal")
+}
+
+func TestTargetFor(t *testing.T) {
+	project, err := NewLoader().Load(testdataPath(t, "project"))
+	require.NoError(t, err)
+
+	target := project.TargetFor(testdataPath(t, "project", "components", "app", "main.jsonnet"))
+	require.NotNil(t, target)
+	assert.Equal(t, "dev", target.Name)
+	assert.True(t, project.Compiles(project.Targets["prod"], testdataPath(t, "project", "components", "app", "main.jsonnet")))
+	assert.Nil(t, project.TargetFor(testdataPath(t, "project", "lib", "utils.libsonnet")))
+}
+
+func TestLoaderReloadsChangedInventories(t *testing.T) {
+	root := t.TempDir()
+	targets := filepath.Join(root, "inventory", "targets")
+	require.NoError(t, os.MkdirAll(targets, 0o755))
+	write := func(content string, modified time.Time) {
+		path := filepath.Join(targets, "test.yml")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		require.NoError(t, os.Chtimes(path, modified, modified))
+	}
+
+	loader := NewLoader()
+	write("parameters:\n  value: 1\n", time.Now().Add(-time.Hour))
+	project, err := loader.Load(root)
+	require.NoError(t, err)
+	assert.Equal(t, float64(1), project.Targets["test"].Parameters["value"])
+
+	cached, err := loader.Load(root)
+	require.NoError(t, err)
+	assert.Same(t, project, cached)
+
+	write("parameters:\n  value: 2\n", time.Now())
+	project, err = loader.Load(root)
+	require.NoError(t, err)
+	assert.Equal(t, float64(2), project.Targets["test"].Parameters["value"])
+}
+
+func TestLoadErrors(t *testing.T) {
+	testCases := []struct {
+		name     string
+		target   string
+		expected string
+	}{
+		{
+			name:     "missing class",
+			target:   "classes:\n  - missing\n",
+			expected: "target test: class missing not found",
+		},
+		{
+			name:     "missing reference",
+			target:   "parameters:\n  a: ${b}\n",
+			expected: "target test: cannot resolve ${b}",
+		},
+		{
+			name:     "circular reference",
+			target:   "parameters:\n  a: ${b}\n  b: ${a}\n",
+			expected: "target test: too many levels of references, they may be circular",
+		},
+		{
+			name:     "object interpolated in a string",
+			target:   "parameters:\n  a: {b: 1}\n  c: x-${a}\n",
+			expected: `target test: ${a} can't be interpolated in "x-${a}", it isn't a scalar`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			inventory := t.TempDir()
+			require.NoError(t, os.MkdirAll(filepath.Join(inventory, "targets"), 0o755))
+			require.NoError(t, os.WriteFile(filepath.Join(inventory, "targets", "test.yml"), []byte(tc.target), 0o600))
+
+			_, err := LoadTargets(inventory)
+			require.Error(t, err)
+			assert.Equal(t, tc.expected, err.Error())
+		})
+	}
+}
+
+func TestClassName(t *testing.T) {
+	testCases := []struct {
+		class, namespace, expected string
+	}{
+		{"common", "a.b", "common"},
+		{".sibling", "a.b", "a.b.sibling"},
+		{"..parent", "a.b", "a.parent"},
+		{"...root", "a.b", "root"},
+		{"....above", "a.b", "above"},
+		{".top", "", "top"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.class, func(t *testing.T) {
+			assert.Equal(t, tc.expected, className(tc.class, tc.namespace))
+		})
+	}
+}
@@ -0,0 +1,289 @@
+package kapitan
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxReferenceDepth bounds the references that are followed to resolve a parameter, to stop on circular references.
+const maxReferenceDepth = 64
+
+// referenceRegexp matches the references to other parameters, `${kapitan:vars:target}` for example, and their escaped
+// form, `\${...}`.
+var referenceRegexp = regexp.MustCompile(`(\\?)\$\{([^${}]+)\}`)
+
+// node is a target or class file of the inventory.
+type node struct {
+	Classes      []string               `yaml:"classes"`
+	Applications []string               `yaml:"applications"`
+	Parameters   map[string]interface{} `yaml:"parameters"`
+}
+
+// loadTarget reads a target and merges the classes that it includes, depth first and in order, before its own
+// parameters. Classes that were already included are skipped.
+func loadTarget(inventoryPath, name, path string) (*Target, error) {
+	targetNode, err := readNode(path)
+	if err != nil {
+		return nil, err
+	}
+	m := &merger{
+		classesPath: filepath.Join(inventoryPath, "classes"),
+		included:    map[string]bool{},
+		parameters:  map[string]interface{}{},
+	}
+	if err := m.include(targetNode, ""); err != nil {
+		return nil, fmt.Errorf("target %s: %w", name, err)
+	}
+
+	m.parameters["_reclass_"] = map[string]interface{}{
+		"environment": "base",
+		"name": map[string]interface{}{
+			"full":  name,
+			"short": name,
+			"path":  name,
+			"parts": []interface{}{name},
+		},
+	}
+	resolved, err := (&resolver{parameters: m.parameters}).resolve(m.parameters, 0)
+	if err != nil {
+		return nil, fmt.Errorf("target %s: %w", name, err)
+	}
+	parameters, err := normalize(resolved)
+	if err != nil {
+		return nil, fmt.Errorf("target %s: %w", name, err)
+	}
+	return &Target{
+		Name:         name,
+		Classes:      m.classes,
+		Applications: m.applications,
+		Parameters:   parameters.(map[string]interface{}),
+	}, nil
+}
+
+func readNode(path string) (node, error) {
+	var n node
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return n, err
+	}
+	if err := yaml.Unmarshal(data, &n); err != nil {
+		return n, fmt.Errorf("%s: %w", path, err)
+	}
+	return n, nil
+}
+
+type merger struct {
+	classesPath  string
+	included     map[string]bool
+	classes      []string
+	applications []string
+	parameters   map[string]interface{}
+}
+
+// include merges a node, after the classes that it includes. The namespace is the one that the node's relative class
+// names, `.sibling` for example, are resolved in.
+func (m *merger) include(n node, namespace string) error {
+	for _, class := range n.Classes {
+		name := className(class, namespace)
+		if m.included[name] {
+			continue
+		}
+		m.included[name] = true
+		classNode, classNamespace, err := m.readClass(name)
+		if err != nil {
+			return err
+		}
+		if err := m.include(classNode, classNamespace); err != nil {
+			return err
+		}
+		m.classes = append(m.classes, name)
+	}
+	for _, application := range n.Applications {
+		if !contains(m.applications, application) {
+			m.applications = append(m.applications, application)
+		}
+	}
+	m.parameters = merge(m.parameters, n.Parameters)
+	return nil
+}
+
+// readClass reads the class with the name, `a.b` is read from `a/b.yml` or `a/b/init.yml`, and returns it with its
+// namespace.
+func (m *merger) readClass(name string) (node, string, error) {
+	path := filepath.Join(append([]string{m.classesPath}, strings.Split(name, ".")...)...)
+	namespace := ""
+	if i := strings.LastIndex(name, "."); i != -1 {
+		namespace = name[:i]
+	}
+	candidates := []struct {
+		path      string
+		namespace string
+	}{
+		{path + ".yml", namespace},
+		{path + ".yaml", namespace},
+		{filepath.Join(path, "init.yml"), name},
+		{filepath.Join(path, "init.yaml"), name},
+	}
+	for _, candidate := range candidates {
+		if _, err := os.Stat(candidate.path); err == nil {
+			n, err := readNode(candidate.path)
+			return n, candidate.namespace, err
+		}
+	}
+	return node{}, "", fmt.Errorf("class %s not found", name)
+}
+
+// className resolves a class name that is relative to a namespace: each leading dot after the first goes up a level.
+func className(class, namespace string) string {
+	if !strings.HasPrefix(class, ".") {
+		return class
+	}
+	name := strings.TrimLeft(class, ".")
+	parts := strings.Split(namespace, ".")
+	if namespace == "" {
+		parts = nil
+	}
+	up := len(class) - len(name) - 1
+	if up > len(parts) {
+		up = len(parts)
+	}
+	return strings.Join(append(parts[:len(parts)-up:len(parts)-up], name), ".")
+}
+
+// merge merges the overlay into the base: objects are merged, lists are appended to, and the other values are
+// replaced. Keys prefixed with `~` replace the value instead of merging into it.
+func merge(base, overlay map[string]interface{}) map[string]interface{} {
+	if base == nil {
+		base = map[string]interface{}{}
+	}
+	for key, value := range overlay {
+		if strings.HasPrefix(key, "~") {
+			key = key[1:]
+			delete(base, key)
+		}
+		switch value := value.(type) {
+		case map[string]interface{}:
+			existing, _ := base[key].(map[string]interface{})
+			base[key] = merge(existing, value)
+		case []interface{}:
+			existing, _ := base[key].([]interface{})
+			base[key] = append(existing[:len(existing):len(existing)], value...)
+		default:
+			base[key] = value
+		}
+	}
+	return base
+}
+
+func contains(list []string, value string) bool {
+	for _, element := range list {
+		if element == value {
+			return true
+		}
+	}
+	return false
+}
+
+// resolver replaces the references of parameters with the values that they refer to.
+type resolver struct {
+	parameters map[string]interface{}
+}
+
+func (r *resolver) resolve(value interface{}, depth int) (interface{}, error) {
+	if depth > maxReferenceDepth {
+		return nil, fmt.Errorf("too many levels of references, they may be circular")
+	}
+	switch value := value.(type) {
+	case map[string]interface{}:
+		resolved := make(map[string]interface{}, len(value))
+		for key, element := range value {
+			var err error
+			if resolved[key], err = r.resolve(element, depth); err != nil {
+				return nil, err
+			}
+		}
+		return resolved, nil
+	case []interface{}:
+		resolved := make([]interface{}, len(value))
+		for i, element := range value {
+			var err error
+			if resolved[i], err = r.resolve(element, depth); err != nil {
+				return nil, err
+			}
+		}
+		return resolved, nil
+	case string:
+		return r.resolveString(value, depth)
+	}
+	return value, nil
+}
+
+// resolveString resolves the references of a string. A string that is a single reference takes the value that it
+// refers to, objects and lists included, the others are interpolated.
+func (r *resolver) resolveString(value string, depth int) (interface{}, error) {
+	matches := referenceRegexp.FindAllStringSubmatchIndex(value, -1)
+	if len(matches) == 0 {
+		return value, nil
+	}
+	if len(matches) == 1 && matches[0][0] == 0 && matches[0][1] == len(value) && matches[0][3] == matches[0][2] {
+		return r.lookup(value[matches[0][4]:matches[0][5]], depth)
+	}
+
+	var resolved strings.Builder
+	last := 0
+	for _, match := range matches {
+		resolved.WriteString(value[last:match[0]])
+		last = match[1]
+		if match[3] != match[2] {
+			// An escaped reference is kept as is, without its backslash
+			resolved.WriteString(value[match[2]+1 : match[1]])
+			continue
+		}
+		reference := value[match[4]:match[5]]
+		referenced, err := r.lookup(reference, depth)
+		if err != nil {
+			return nil, err
+		}
+		switch referenced.(type) {
+		case map[string]interface{}, []interface{}:
+			return nil, fmt.Errorf("${%s} can't be interpolated in %q, it isn't a scalar", reference, value)
+		case nil:
+		default:
+			fmt.Fprint(&resolved, referenced)
+		}
+	}
+	resolved.WriteString(value[last:])
+	return resolved.String(), nil
+}
+
+// lookup returns the resolved value of a reference, a path of parameters separated by colons.
+func (r *resolver) lookup(reference string, depth int) (interface{}, error) {
+	var value interface{} = r.parameters
+	for _, key := range strings.Split(reference, ":") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("cannot resolve ${%s}", reference)
+		}
+		if value, ok = object[key]; !ok {
+			return nil, fmt.Errorf("cannot resolve ${%s}", reference)
+		}
+	}
+	return r.resolve(value, depth+1)
+}
+
+// normalize converts the values read from YAML to the ones of JSON, which are the ones that Jsonnet accepts.
+func normalize(value interface{}) (interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var normalized interface{}
+	err = json.Unmarshal(data, &normalized)
+	return normalized, err
+}
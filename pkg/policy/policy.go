@@ -0,0 +1,197 @@
+// Package policy checks evaluated outputs against policies written in CEL (https://cel.dev).
+//
+// A bundle is a JSON file that lists policies:
+//
+//	{
+//	  "policies": [
+//	    {
+//	      "name": "no-latest-images",
+//	      "match": "has(object.image)",
+//	      "validate": "!object.image.endsWith(':latest')",
+//	      "field": "image",
+//	      "message": "images must be pinned to a version"
+//	    }
+//	  ]
+//	}
+//
+// Each policy is checked against every object of the output, bound to the `object` variable. Match selects the
+// objects the policy applies to, all of them if it is empty, and validate must be true for them. Field is the
+// field of the object that holds the offending value, if there is one.
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+)
+
+// Policy is a rule that the objects of an output must follow.
+type Policy struct {
+	Name     string `json:"name"`
+	Match    string `json:"match"`
+	Validate string `json:"validate"`
+	Field    string `json:"field"`
+	Message  string `json:"message"`
+
+	match    cel.Program
+	validate cel.Program
+}
+
+// Bundle is a set of policies, read from a file.
+type Bundle struct {
+	Policies []*Policy `json:"policies"`
+}
+
+// Violation is an object of an output that doesn't follow a policy.
+type Violation struct {
+	Policy *Policy
+	// Path is the path of the object in the output, made of field names and array indexes
+	Path []interface{}
+	// Object is the object that violates the policy
+	Object map[string]interface{}
+}
+
+// Message describes the violation.
+func (v Violation) Message() string {
+	message := v.Policy.Message
+	if message == "" {
+		message = fmt.Sprintf("%s is false", v.Policy.Validate)
+	}
+	if v.Policy.Name == "" {
+		return message
+	}
+	return fmt.Sprintf("%s: %s", v.Policy.Name, message)
+}
+
+// Loader reads bundles and caches them, compiled.
+type Loader struct {
+	mu      sync.Mutex
+	bundles map[string]*Bundle
+}
+
+func NewLoader() *Loader {
+	return &Loader{bundles: map[string]*Bundle{}}
+}
+
+// Reset drops the cached bundles.
+func (l *Loader) Reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.bundles = map[string]*Bundle{}
+}
+
+// Load returns the bundle of a file, with its policies compiled.
+func (l *Loader) Load(path string) (*Bundle, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if bundle, ok := l.bundles[path]; ok {
+		return bundle, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var bundle Bundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := bundle.compile(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	l.bundles[path] = &bundle
+	return &bundle, nil
+}
+
+func (b *Bundle) compile() error {
+	env, err := cel.NewEnv(cel.Variable("object", cel.MapType(cel.StringType, cel.DynType)))
+	if err != nil {
+		return err
+	}
+	program := func(expression string) (cel.Program, error) {
+		checked, issues := env.Compile(expression)
+		if issues != nil && issues.Err() != nil {
+			return nil, issues.Err()
+		}
+		if checked.OutputType() != cel.BoolType && checked.OutputType() != cel.DynType {
+			return nil, fmt.Errorf("%q must be a boolean, got %s", expression, checked.OutputType())
+		}
+		return env.Program(checked)
+	}
+
+	for i, policy := range b.Policies {
+		if policy.Validate == "" {
+			return fmt.Errorf("policies[%d]: validate is required", i)
+		}
+		if policy.validate, err = program(policy.Validate); err != nil {
+			return fmt.Errorf("policies[%d]: %w", i, err)
+		}
+		if policy.Match != "" {
+			if policy.match, err = program(policy.Match); err != nil {
+				return fmt.Errorf("policies[%d]: %w", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Check returns the objects of the value that violate the policies of the bundle. Policies whose expressions fail
+// to evaluate on an object, because of a missing field for example, are not violated by it.
+func (b *Bundle) Check(value interface{}) []Violation {
+	var violations []Violation
+	var check func(value interface{}, path []interface{})
+	check = func(value interface{}, path []interface{}) {
+		switch value := value.(type) {
+		case map[string]interface{}:
+			for _, policy := range b.Policies {
+				if policy.violatedBy(value) {
+					violations = append(violations, Violation{Policy: policy, Path: path, Object: value})
+				}
+			}
+			names := make([]string, 0, len(value))
+			for name := range value {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				check(value[name], append(path[:len(path):len(path)], name))
+			}
+		case []interface{}:
+			for i, element := range value {
+				check(element, append(path[:len(path):len(path)], i))
+			}
+		}
+	}
+	check(value, nil)
+	return violations
+}
+
+// violatedBy tells whether the object is one that the policy applies to, and doesn't validate.
+func (p *Policy) violatedBy(object map[string]interface{}) bool {
+	if p.match != nil {
+		if matches, ok := eval(p.match, object); !ok || !matches {
+			return false
+		}
+	}
+	valid, ok := eval(p.validate, object)
+	return ok && !valid
+}
+
+func eval(program cel.Program, object map[string]interface{}) (result bool, ok bool) {
+	value, _, err := program.Eval(map[string]interface{}{"object": object})
+	if err != nil {
+		return false, false
+	}
+	result, ok = value.Value().(bool)
+	return result, ok
+}
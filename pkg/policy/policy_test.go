@@ -0,0 +1,77 @@
+package policy
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loadBundle(t *testing.T, content string) (*Bundle, error) {
+	path := filepath.Join(t.TempDir(), "bundle.json")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return NewLoader().Load(path)
+}
+
+func TestCheck(t *testing.T) {
+	bundle, err := loadBundle(t, `{
+		"policies": [
+			{
+				"name": "no-latest-images",
+				"match": "has(object.image)",
+				"validate": "!object.image.endsWith(':latest')",
+				"field": "image",
+				"message": "images must be pinned"
+			},
+			{
+				"match": "has(object.kind) && object.kind == 'Deployment'",
+				"validate": "object.spec.replicas >= 2"
+			}
+		]
+	}`)
+	require.NoError(t, err)
+
+	var output interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"api": {
+			"kind": "Deployment",
+			"spec": {
+				"replicas": 1,
+				"containers": [{"image": "api:1.0"}, {"image": "sidecar:latest"}]
+			}
+		},
+		"worker": {"kind": "Deployment", "spec": {}}
+	}`), &output))
+
+	var messages []string
+	var paths [][]interface{}
+	for _, violation := range bundle.Check(output) {
+		messages = append(messages, violation.Message())
+		paths = append(paths, violation.Path)
+	}
+	// The worker has no replicas, the policy can't be evaluated against it
+	assert.Equal(t, []string{"object.spec.replicas >= 2 is false", "no-latest-images: images must be pinned"}, messages)
+	assert.Equal(t, [][]interface{}{{"api"}, {"api", "spec", "containers", 1}}, paths)
+}
+
+func TestLoadErrors(t *testing.T) {
+	testCases := []struct {
+		name        string
+		content     string
+		expectedErr string
+	}{
+		{name: "invalid JSON", content: `{`, expectedErr: "unexpected end of JSON input"},
+		{name: "missing validate", content: `{"policies": [{"name": "a"}]}`, expectedErr: "policies[0]: validate is required"},
+		{name: "invalid expression", content: `{"policies": [{"validate": "object.("}]}`, expectedErr: "policies[0]: ERROR"},
+		{name: "not a boolean", content: `{"policies": [{"validate": "1 + 1"}]}`, expectedErr: `policies[0]: "1 + 1" must be a boolean, got int`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := loadBundle(t, tc.content)
+			assert.ErrorContains(t, err, tc.expectedErr)
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package promql
+
+// function is the signature of a PromQL function.
+type function struct {
+	args []ValueType
+	// optional is the number of trailing arguments that can be omitted
+	optional int
+	// variadic is true when the last argument can be repeated
+	variadic bool
+	returns  ValueType
+}
+
+var (
+	vectorToVector = function{args: []ValueType{ValueTypeVector}, returns: ValueTypeVector}
+	matrixToVector = function{args: []ValueType{ValueTypeMatrix}, returns: ValueTypeVector}
+	// timeFunction takes an optional vector of timestamps, the evaluation time by default
+	timeFunction = function{args: []ValueType{ValueTypeVector}, optional: 1, returns: ValueTypeVector}
+)
+
+// functions are the functions of PromQL, by name.
+var functions = map[string]function{
+	"abs":                          vectorToVector,
+	"absent":                       vectorToVector,
+	"absent_over_time":             matrixToVector,
+	"acos":                         vectorToVector,
+	"acosh":                        vectorToVector,
+	"asin":                         vectorToVector,
+	"asinh":                        vectorToVector,
+	"atan":                         vectorToVector,
+	"atanh":                        vectorToVector,
+	"avg_over_time":                matrixToVector,
+	"ceil":                         vectorToVector,
+	"changes":                      matrixToVector,
+	"clamp":                        {args: []ValueType{ValueTypeVector, ValueTypeScalar, ValueTypeScalar}, returns: ValueTypeVector},
+	"clamp_max":                    {args: []ValueType{ValueTypeVector, ValueTypeScalar}, returns: ValueTypeVector},
+	"clamp_min":                    {args: []ValueType{ValueTypeVector, ValueTypeScalar}, returns: ValueTypeVector},
+	"cos":                          vectorToVector,
+	"cosh":                         vectorToVector,
+	"count_over_time":              matrixToVector,
+	"day_of_month":                 timeFunction,
+	"day_of_week":                  timeFunction,
+	"day_of_year":                  timeFunction,
+	"days_in_month":                timeFunction,
+	"deg":                          vectorToVector,
+	"delta":                        matrixToVector,
+	"deriv":                        matrixToVector,
+	"double_exponential_smoothing": {args: []ValueType{ValueTypeMatrix, ValueTypeScalar, ValueTypeScalar}, returns: ValueTypeVector},
+	"exp":                          vectorToVector,
+	"floor":                        vectorToVector,
+	"histogram_avg":                vectorToVector,
+	"histogram_count":              vectorToVector,
+	"histogram_fraction":           {args: []ValueType{ValueTypeScalar, ValueTypeScalar, ValueTypeVector}, returns: ValueTypeVector},
+	"histogram_quantile":           {args: []ValueType{ValueTypeScalar, ValueTypeVector}, returns: ValueTypeVector},
+	"histogram_stddev":             vectorToVector,
+	"histogram_stdvar":             vectorToVector,
+	"histogram_sum":                vectorToVector,
+	"holt_winters":                 {args: []ValueType{ValueTypeMatrix, ValueTypeScalar, ValueTypeScalar}, returns: ValueTypeVector},
+	"hour":                         timeFunction,
+	"idelta":                       matrixToVector,
+	"increase":                     matrixToVector,
+	"irate":                        matrixToVector,
+	"label_join":                   {args: []ValueType{ValueTypeVector, ValueTypeString, ValueTypeString, ValueTypeString}, optional: 1, variadic: true, returns: ValueTypeVector},
+	"label_replace":                {args: []ValueType{ValueTypeVector, ValueTypeString, ValueTypeString, ValueTypeString, ValueTypeString}, returns: ValueTypeVector},
+	"last_over_time":               matrixToVector,
+	"ln":                           vectorToVector,
+	"log10":                        vectorToVector,
+	"log2":                         vectorToVector,
+	"mad_over_time":                matrixToVector,
+	"max_over_time":                matrixToVector,
+	"min_over_time":                matrixToVector,
+	"minute":                       timeFunction,
+	"month":                        timeFunction,
+	"pi":                           {returns: ValueTypeScalar},
+	"predict_linear":               {args: []ValueType{ValueTypeMatrix, ValueTypeScalar}, returns: ValueTypeVector},
+	"present_over_time":            matrixToVector,
+	"quantile_over_time":           {args: []ValueType{ValueTypeScalar, ValueTypeMatrix}, returns: ValueTypeVector},
+	"rad":                          vectorToVector,
+	"rate":                         matrixToVector,
+	"resets":                       matrixToVector,
+	"round":                        {args: []ValueType{ValueTypeVector, ValueTypeScalar}, optional: 1, returns: ValueTypeVector},
+	"scalar":                       {args: []ValueType{ValueTypeVector}, returns: ValueTypeScalar},
+	"sgn":                          vectorToVector,
+	"sin":                          vectorToVector,
+	"sinh":                         vectorToVector,
+	"sort":                         vectorToVector,
+	"sort_by_label":                {args: []ValueType{ValueTypeVector, ValueTypeString}, optional: 1, variadic: true, returns: ValueTypeVector},
+	"sort_by_label_desc":           {args: []ValueType{ValueTypeVector, ValueTypeString}, optional: 1, variadic: true, returns: ValueTypeVector},
+	"sort_desc":                    vectorToVector,
+	"sqrt":                         vectorToVector,
+	"stddev_over_time":             matrixToVector,
+	"stdvar_over_time":             matrixToVector,
+	"sum_over_time":                matrixToVector,
+	"tan":                          vectorToVector,
+	"tanh":                         vectorToVector,
+	"time":                         {returns: ValueTypeScalar},
+	"timestamp":                    vectorToVector,
+	"vector":                       {args: []ValueType{ValueTypeScalar}, returns: ValueTypeVector},
+	"year":                         timeFunction,
+}
+
+// aggregations are the aggregation operators, with the type of their parameter, if they have one.
+var aggregations = map[string]ValueType{
+	"avg":          "",
+	"bottomk":      ValueTypeScalar,
+	"count":        "",
+	"count_values": ValueTypeString,
+	"group":        "",
+	"limit_ratio":  ValueTypeScalar,
+	"limitk":       ValueTypeScalar,
+	"max":          "",
+	"min":          "",
+	"quantile":     ValueTypeScalar,
+	"stddev":       "",
+	"stdvar":       "",
+	"sum":          "",
+	"topk":         ValueTypeScalar,
+}
@@ -0,0 +1,167 @@
+package promql
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdentifier
+	tokenNumber
+	tokenDuration
+	tokenString
+	// tokenOperator is an operator or a punctuation character, its text tells which
+	tokenOperator
+)
+
+type token struct {
+	kind   tokenKind
+	text   string
+	offset int
+	// value is the unquoted value of a string
+	value string
+}
+
+// describe names the token in error messages.
+func (t token) describe() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of input"
+	case tokenIdentifier:
+		return "identifier " + strconv.Quote(t.text)
+	case tokenNumber:
+		return "number " + strconv.Quote(t.text)
+	case tokenDuration:
+		return "duration " + strconv.Quote(t.text)
+	case tokenString:
+		return "string " + t.text
+	default:
+		return strconv.Quote(t.text)
+	}
+}
+
+var (
+	durationRegexp = regexp.MustCompile(`^([0-9]+(ms|s|m|h|d|w|y))+`)
+	numberRegexp   = regexp.MustCompile(`^(0[xX][0-9a-fA-F]+|([0-9]+\.?[0-9]*|\.[0-9]+)([eE][+-]?[0-9]+)?)`)
+	// operators are sorted so that the longest ones are tried first
+	operators = []string{"==", "!=", "<=", ">=", "=~", "!~", "+", "-", "*", "/", "%", "^", "<", ">", "=", "(", ")", "{", "}", "[", "]", ",", ":", "@"}
+)
+
+func isIdentifierStart(c byte) bool {
+	return c == '_' || c == ':' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentifierChar(c byte) bool {
+	return isIdentifierStart(c) || (c >= '0' && c <= '9')
+}
+
+// lex splits an expression into tokens. The last token is always tokenEOF.
+func lex(input string) ([]token, error) {
+	var tokens []token
+	// In the brackets of ranges and subqueries, colons separate durations instead of being part of identifiers
+	inBrackets := false
+	for i := 0; i < len(input); {
+		c := input[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '#':
+			// Comments run to the end of the line
+			for i < len(input) && input[i] != '\n' {
+				i++
+			}
+		case isIdentifierStart(c) && !(c == ':' && inBrackets):
+			start := i
+			for i < len(input) && isIdentifierChar(input[i]) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdentifier, text: input[start:i], offset: start})
+		case (c >= '0' && c <= '9') || c == '.':
+			if duration := durationRegexp.FindString(input[i:]); duration != "" {
+				if end := i + len(duration); end == len(input) || (input[end] == ':' && inBrackets) || !isIdentifierChar(input[end]) {
+					tokens = append(tokens, token{kind: tokenDuration, text: duration, offset: i})
+					i = end
+					continue
+				}
+			}
+			number := numberRegexp.FindString(input[i:])
+			if number == "" || (i+len(number) < len(input) && isIdentifierChar(input[i+len(number)])) {
+				return nil, &Error{Offset: i, Message: "bad number or duration syntax"}
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: number, offset: i})
+			i += len(number)
+		case c == '"' || c == '\'' || c == '`':
+			end, value, err := lexString(input, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokenString, text: input[i:end], offset: i, value: value})
+			i = end
+		default:
+			operator := ""
+			for _, candidate := range operators {
+				if strings.HasPrefix(input[i:], candidate) {
+					operator = candidate
+					break
+				}
+			}
+			if operator == "" {
+				r, _ := utf8.DecodeRuneInString(input[i:])
+				return nil, &Error{Offset: i, Message: "unexpected character " + strconv.QuoteRune(r)}
+			}
+			tokens = append(tokens, token{kind: tokenOperator, text: operator, offset: i})
+			i += len(operator)
+			if operator == "[" || operator == "]" {
+				inBrackets = operator == "["
+			}
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, offset: len(input)}), nil
+}
+
+// lexString reads the string that starts at the offset, and returns the offset of its end and its value.
+func lexString(input string, start int) (int, string, error) {
+	quote := input[start]
+	if quote == '`' {
+		end := strings.IndexByte(input[start+1:], '`')
+		if end == -1 {
+			return 0, "", &Error{Offset: start, Message: "unterminated raw string"}
+		}
+		return start + end + 2, input[start+1 : start+end+1], nil
+	}
+
+	// The string is rewritten with double quotes, to be unquoted by strconv
+	var quoted strings.Builder
+	quoted.WriteByte('"')
+	for i := start + 1; i < len(input); i++ {
+		switch c := input[i]; {
+		case c == '\n':
+			return 0, "", &Error{Offset: start, Message: "unterminated quoted string"}
+		case c == quote:
+			quoted.WriteByte('"')
+			value, err := strconv.Unquote(quoted.String())
+			if err != nil {
+				return 0, "", &Error{Offset: start, Message: "invalid escape sequence in quoted string"}
+			}
+			return i + 1, value, nil
+		case c == '\\' && i+1 < len(input):
+			i++
+			if input[i] == '\'' {
+				quoted.WriteByte('\'')
+			} else {
+				quoted.WriteByte('\\')
+				quoted.WriteByte(input[i])
+			}
+		case c == '"':
+			quoted.WriteString(`\"`)
+		default:
+			quoted.WriteByte(c)
+		}
+	}
+	return 0, "", &Error{Offset: start, Message: "unterminated quoted string"}
+}
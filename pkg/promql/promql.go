@@ -0,0 +1,482 @@
+// Package promql checks PromQL expressions: their syntax and the types of their operands, as Prometheus does when
+// it loads rules. The expressions are not evaluated, nor turned into a tree.
+package promql
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ValueType is the type of the value of an expression.
+type ValueType string
+
+const (
+	ValueTypeScalar ValueType = "scalar"
+	ValueTypeVector ValueType = "instant vector"
+	ValueTypeMatrix ValueType = "range vector"
+	ValueTypeString ValueType = "string"
+)
+
+// Error is an error in an expression. Offset is the byte offset, in the expression, of the token that causes it.
+type Error struct {
+	Offset  int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("parse error at char %d: %s", e.Offset+1, e.Message)
+}
+
+// Check parses the expression and returns the type of its value.
+func Check(input string) (ValueType, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return "", err
+	}
+	p := &parser{tokens: tokens}
+	return p.parse()
+}
+
+// exprKind tells which of the postfix modifiers an expression accepts.
+type exprKind int
+
+const (
+	kindOther exprKind = iota
+	kindVectorSelector
+	kindMatrixSelector
+	kindSubquery
+)
+
+type expr struct {
+	typ  ValueType
+	kind exprKind
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// parse checks the whole expression. The errors are panics of *Error, recovered here.
+func (p *parser) parse() (typ ValueType, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			parseErr, ok := r.(*Error)
+			if !ok {
+				panic(r)
+			}
+			err = parseErr
+		}
+	}()
+
+	e := p.parseExpr(1)
+	if t := p.peek(); t.kind != tokenEOF {
+		p.errorf(t, "unexpected %s", t.describe())
+	}
+	return e.typ, nil
+}
+
+func (p *parser) errorf(t token, format string, args ...interface{}) {
+	panic(&Error{Offset: t.offset, Message: fmt.Sprintf(format, args...)})
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+// isOperator tells whether the token is the operator or punctuation character.
+func isOperator(t token, text string) bool {
+	return t.kind == tokenOperator && t.text == text
+}
+
+// isKeyword tells whether the token is the keyword. Keywords are not case sensitive.
+func isKeyword(t token, keyword string) bool {
+	return t.kind == tokenIdentifier && strings.EqualFold(t.text, keyword)
+}
+
+func (p *parser) expect(text string, context string) token {
+	t := p.next()
+	if !isOperator(t, text) {
+		p.errorf(t, "unexpected %s in %s, expected %q", t.describe(), context, text)
+	}
+	return t
+}
+
+var keywords = map[string]bool{
+	"and": true, "or": true, "unless": true, "atan2": true, "bool": true, "by": true, "without": true, "on": true,
+	"ignoring": true, "group_left": true, "group_right": true, "offset": true,
+}
+
+// binaryOperator returns the binary operator of the token, and its precedence. The precedence is 0 if the token
+// isn't a binary operator.
+func binaryOperator(t token) (string, int) {
+	op := t.text
+	if t.kind == tokenIdentifier {
+		op = strings.ToLower(t.text)
+	} else if t.kind != tokenOperator {
+		return "", 0
+	}
+	switch op {
+	case "or":
+		return op, 1
+	case "and", "unless":
+		return op, 2
+	case "==", "!=", "<=", "<", ">=", ">":
+		return op, 3
+	case "+", "-":
+		return op, 4
+	case "*", "/", "%", "atan2":
+		return op, 5
+	case "^":
+		return op, 6
+	}
+	return "", 0
+}
+
+func isComparison(op string) bool {
+	switch op {
+	case "==", "!=", "<=", "<", ">=", ">":
+		return true
+	}
+	return false
+}
+
+func isSetOperator(op string) bool {
+	return op == "and" || op == "or" || op == "unless"
+}
+
+// parseExpr parses the binary expressions whose operators have at least the precedence.
+func (p *parser) parseExpr(minPrecedence int) expr {
+	left := p.parseUnary()
+	for {
+		opToken := p.peek()
+		op, precedence := binaryOperator(opToken)
+		if precedence == 0 || precedence < minPrecedence {
+			return left
+		}
+		p.next()
+
+		returnBool := false
+		if isKeyword(p.peek(), "bool") {
+			if !isComparison(op) {
+				p.errorf(p.peek(), "bool modifier can only be used on comparison operators")
+			}
+			p.next()
+			returnBool = true
+		}
+		matching, grouping := p.parseVectorMatching()
+
+		// ^ is right associative
+		nextPrecedence := precedence + 1
+		if op == "^" {
+			nextPrecedence = precedence
+		}
+		right := p.parseExpr(nextPrecedence)
+		left = p.checkBinary(opToken, op, left, right, returnBool, matching, grouping)
+	}
+}
+
+// parseVectorMatching parses the on/ignoring and group_left/group_right modifiers of a binary operator.
+func (p *parser) parseVectorMatching() (matching, grouping bool) {
+	if isKeyword(p.peek(), "on") || isKeyword(p.peek(), "ignoring") {
+		p.next()
+		p.parseLabels()
+		matching = true
+		if isKeyword(p.peek(), "group_left") || isKeyword(p.peek(), "group_right") {
+			p.next()
+			if isOperator(p.peek(), "(") {
+				p.parseLabels()
+			}
+			grouping = true
+		}
+	}
+	return matching, grouping
+}
+
+func (p *parser) checkBinary(opToken token, op string, left, right expr, returnBool, matching, grouping bool) expr {
+	for _, operand := range []expr{left, right} {
+		if operand.typ != ValueTypeScalar && operand.typ != ValueTypeVector {
+			p.errorf(opToken, "binary expression must contain only scalar and instant vector types")
+		}
+	}
+	bothVectors := left.typ == ValueTypeVector && right.typ == ValueTypeVector
+	if isSetOperator(op) {
+		if !bothVectors {
+			p.errorf(opToken, "set operator %q not allowed in binary scalar expression", op)
+		}
+		if grouping {
+			p.errorf(opToken, "no grouping allowed for %q operation", op)
+		}
+	}
+	if matching && !bothVectors {
+		p.errorf(opToken, "vector matching only allowed between instant vectors")
+	}
+	if left.typ == ValueTypeScalar && right.typ == ValueTypeScalar {
+		if isComparison(op) && !returnBool {
+			p.errorf(opToken, "comparisons between scalars must use BOOL modifier")
+		}
+		return expr{typ: ValueTypeScalar}
+	}
+	return expr{typ: ValueTypeVector}
+}
+
+func (p *parser) parseUnary() expr {
+	t := p.peek()
+	if isOperator(t, "+") || isOperator(t, "-") {
+		p.next()
+		// Unary operators bind less tightly than ^
+		operand := p.parseExpr(6)
+		if operand.typ != ValueTypeScalar && operand.typ != ValueTypeVector {
+			p.errorf(t, "unary expression only allowed on expressions of type scalar or instant vector")
+		}
+		return expr{typ: operand.typ}
+	}
+	return p.parsePostfix(p.parsePrimary())
+}
+
+// parsePostfix parses the range, subquery, offset and @ modifiers that follow an expression.
+func (p *parser) parsePostfix(e expr) expr {
+	for {
+		t := p.peek()
+		switch {
+		case isOperator(t, "["):
+			p.next()
+			p.expectDuration("range")
+			if isOperator(p.peek(), ":") {
+				p.next()
+				if p.peek().kind == tokenDuration {
+					p.next()
+				}
+				p.expect("]", "subquery")
+				if e.typ != ValueTypeVector {
+					p.errorf(t, "subquery is only allowed on instant vector, got %s", e.typ)
+				}
+				e = expr{typ: ValueTypeMatrix, kind: kindSubquery}
+				continue
+			}
+			p.expect("]", "range")
+			if e.kind != kindVectorSelector {
+				p.errorf(t, "ranges only allowed for vector selectors")
+			}
+			e = expr{typ: ValueTypeMatrix, kind: kindMatrixSelector}
+		case isKeyword(t, "offset"):
+			p.next()
+			if isOperator(p.peek(), "-") {
+				p.next()
+			}
+			p.expectDuration("offset")
+			if e.kind == kindOther {
+				p.errorf(t, "offset modifier must be preceded by an instant vector selector or range vector selector or a subquery")
+			}
+		case isOperator(t, "@"):
+			p.next()
+			switch at := p.next(); {
+			case at.kind == tokenNumber:
+			case isKeyword(at, "start") || isKeyword(at, "end"):
+				p.expect("(", "@ modifier")
+				p.expect(")", "@ modifier")
+			default:
+				p.errorf(at, "unexpected %s in @ modifier, expected a timestamp, start() or end()", at.describe())
+			}
+			if e.kind == kindOther {
+				p.errorf(t, "@ modifier must be preceded by an instant vector selector or range vector selector or a subquery")
+			}
+		default:
+			return e
+		}
+	}
+}
+
+func (p *parser) expectDuration(context string) {
+	if t := p.next(); t.kind != tokenDuration {
+		p.errorf(t, "unexpected %s in %s, expected duration", t.describe(), context)
+	}
+}
+
+func (p *parser) parsePrimary() expr {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber:
+		return expr{typ: ValueTypeScalar}
+	case tokenString:
+		return expr{typ: ValueTypeString}
+	case tokenIdentifier:
+		return p.parseIdentifier(t)
+	case tokenOperator:
+		switch t.text {
+		case "(":
+			inner := p.parseExpr(1)
+			p.expect(")", "parenthesized expression")
+			return expr{typ: inner.typ}
+		case "{":
+			if !p.parseMatchers() {
+				p.errorf(t, "vector selector must contain at least one non-empty matcher")
+			}
+			return expr{typ: ValueTypeVector, kind: kindVectorSelector}
+		}
+	}
+	p.errorf(t, "unexpected %s", t.describe())
+	return expr{}
+}
+
+func (p *parser) parseIdentifier(t token) expr {
+	name := strings.ToLower(t.text)
+	if _, ok := aggregations[name]; ok {
+		return p.parseAggregation(t)
+	}
+	if name == "inf" || name == "nan" {
+		return expr{typ: ValueTypeScalar}
+	}
+	if keywords[name] {
+		p.errorf(t, "unexpected %s", t.describe())
+	}
+	if isOperator(p.peek(), "(") {
+		return p.parseCall(t)
+	}
+
+	if isOperator(p.peek(), "{") {
+		p.next()
+		p.parseMatchers()
+	}
+	return expr{typ: ValueTypeVector, kind: kindVectorSelector}
+}
+
+// parseMatchers parses the label matchers of a selector, after its opening brace, and tells whether one of them
+// doesn't match empty labels.
+func (p *parser) parseMatchers() bool {
+	nonEmpty := false
+	for !isOperator(p.peek(), "}") {
+		name := p.next()
+		if name.kind == tokenString && (isOperator(p.peek(), ",") || isOperator(p.peek(), "}")) {
+			// {"metric.name"} selects a metric whose name isn't an identifier
+			nonEmpty = true
+		} else {
+			if name.kind != tokenIdentifier && name.kind != tokenString {
+				p.errorf(name, "unexpected %s in label matching, expected label", name.describe())
+			}
+			op := p.next()
+			if op.kind != tokenOperator || (op.text != "=" && op.text != "!=" && op.text != "=~" && op.text != "!~") {
+				p.errorf(op, "unexpected %s in label matching, expected one of \"=\", \"!=\", \"=~\" or \"!~\"", op.describe())
+			}
+			value := p.next()
+			if value.kind != tokenString {
+				p.errorf(value, "unexpected %s in label matching, expected string", value.describe())
+			}
+			matchesEmpty := false
+			switch op.text {
+			case "=":
+				matchesEmpty = value.value == ""
+			case "!=":
+				matchesEmpty = value.value != ""
+			case "=~", "!~":
+				re, err := regexp.Compile("^(?:" + value.value + ")$")
+				if err != nil {
+					p.errorf(value, "invalid regular expression in label matcher: %v", err)
+				}
+				matchesEmpty = re.MatchString("") == (op.text == "=~")
+			}
+			nonEmpty = nonEmpty || !matchesEmpty
+		}
+
+		if isOperator(p.peek(), ",") {
+			p.next()
+		} else if !isOperator(p.peek(), "}") {
+			p.errorf(p.peek(), "unexpected %s in label matching, expected \",\" or \"}\"", p.peek().describe())
+		}
+	}
+	p.next()
+	return nonEmpty
+}
+
+// parseLabels parses a parenthesized list of label names.
+func (p *parser) parseLabels() {
+	p.expect("(", "grouping")
+	for !isOperator(p.peek(), ")") {
+		if label := p.next(); label.kind != tokenIdentifier && label.kind != tokenString {
+			p.errorf(label, "unexpected %s in grouping, expected label", label.describe())
+		}
+		if isOperator(p.peek(), ",") {
+			p.next()
+		} else if !isOperator(p.peek(), ")") {
+			p.errorf(p.peek(), "unexpected %s in grouping, expected \",\" or \")\"", p.peek().describe())
+		}
+	}
+	p.next()
+}
+
+func (p *parser) parseAggregation(t token) expr {
+	name := strings.ToLower(t.text)
+	grouped := false
+	if isKeyword(p.peek(), "by") || isKeyword(p.peek(), "without") {
+		p.next()
+		p.parseLabels()
+		grouped = true
+	}
+
+	args := p.parseArgs("aggregation")
+	param := aggregations[name]
+	expected := 1
+	if param != "" {
+		expected = 2
+	}
+	if len(args) != expected {
+		p.errorf(t, "wrong number of arguments for aggregate expression provided, expected %d, got %d", expected, len(args))
+	}
+	if param != "" && args[0].typ != param {
+		p.errorf(t, "expected type %s in aggregation parameter, got %s", param, args[0].typ)
+	}
+	if vector := args[len(args)-1]; vector.typ != ValueTypeVector {
+		p.errorf(t, "expected type %s in aggregation expression, got %s", ValueTypeVector, vector.typ)
+	}
+
+	if !grouped && (isKeyword(p.peek(), "by") || isKeyword(p.peek(), "without")) {
+		p.next()
+		p.parseLabels()
+	}
+	return expr{typ: ValueTypeVector}
+}
+
+func (p *parser) parseCall(t token) expr {
+	function, ok := functions[t.text]
+	if !ok {
+		p.errorf(t, "unknown function with name %q", t.text)
+	}
+	args := p.parseArgs("function call")
+
+	minArgs, maxArgs := len(function.args)-function.optional, len(function.args)
+	if len(args) < minArgs || (!function.variadic && len(args) > maxArgs) {
+		p.errorf(t, "wrong number of arguments in call to %q, got %d", t.text, len(args))
+	}
+	for i, arg := range args {
+		expected := function.args[min(i, len(function.args)-1)]
+		if arg.typ != expected {
+			p.errorf(t, "expected type %s in call to function %q, got %s", expected, t.text, arg.typ)
+		}
+	}
+	return expr{typ: function.returns}
+}
+
+// parseArgs parses the parenthesized arguments of a call or an aggregation.
+func (p *parser) parseArgs(context string) []expr {
+	p.expect("(", context)
+	var args []expr
+	for !isOperator(p.peek(), ")") {
+		args = append(args, p.parseExpr(1))
+		if isOperator(p.peek(), ",") {
+			p.next()
+		} else if !isOperator(p.peek(), ")") {
+			p.errorf(p.peek(), "unexpected %s in %s, expected \",\" or \")\"", p.peek().describe(), context)
+		}
+	}
+	p.next()
+	return args
+}
@@ -0,0 +1,64 @@
+package promql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheck(t *testing.T) {
+	testCases := []struct {
+		expr         string
+		expectedType ValueType
+		expectedErr  string
+	}{
+		{expr: `up`, expectedType: ValueTypeVector},
+		{expr: `up{job="api", instance!~'10\\..*',}`, expectedType: ValueTypeVector},
+		{expr: `{__name__=~"node_.+"}`, expectedType: ValueTypeVector},
+		{expr: `{"metric.with.dots", env="prod"}`, expectedType: ValueTypeVector},
+		{expr: `http_requests_total[5m]`, expectedType: ValueTypeMatrix},
+		{expr: `sum by (job) (rate(http_requests_total{code=~"5.."}[5m])) / ignoring(code) group_left sum by (job) (rate(http_requests_total[1h30m])) > 0.05`, expectedType: ValueTypeVector},
+		{expr: `histogram_quantile(0.99, sum without (instance) (rate(latency_bucket[5m] offset -1h)))`, expectedType: ValueTypeVector},
+		{expr: "max_over_time(deriv(rate(x[1m])[5m:1m])[1h:]) # comment", expectedType: ValueTypeVector},
+		{expr: `topk(5, count_values("version", build_info)) and on() vector(1)`, expectedType: ValueTypeVector},
+		{expr: `-2 ^ 3 ^ 2 + time() * Inf`, expectedType: ValueTypeScalar},
+		{expr: `1 > bool 2`, expectedType: ValueTypeScalar},
+		{expr: `label_join(up, "all", ",", "job", "instance", "pod")`, expectedType: ValueTypeVector},
+		{expr: `round(up) + day_of_week() + x @ start()`, expectedType: ValueTypeVector},
+		{expr: "`raw\\string`", expectedType: ValueTypeString},
+
+		{expr: ``, expectedErr: "parse error at char 1: unexpected end of input"},
+		{expr: `rate(up)`, expectedErr: `parse error at char 1: expected type range vector in call to function "rate", got instant vector`},
+		{expr: `sum(rate(x[5m])`, expectedErr: `parse error at char 16: unexpected end of input in aggregation, expected "," or ")"`},
+		{expr: `up{job="api"`, expectedErr: `parse error at char 13: unexpected end of input in label matching, expected "," or "}"`},
+		{expr: `up{job=api}`, expectedErr: `parse error at char 8: unexpected identifier "api" in label matching, expected string`},
+		{expr: `up{job=~"("}`, expectedErr: "parse error at char 9: invalid regular expression in label matcher: error parsing regexp: missing closing ): `^(?:()$`"},
+		{expr: `{job=~".*"}`, expectedErr: "parse error at char 1: vector selector must contain at least one non-empty matcher"},
+		{expr: `rat(x[5m])`, expectedErr: `parse error at char 1: unknown function with name "rat"`},
+		{expr: `sum(x) by`, expectedErr: `parse error at char 10: unexpected end of input in grouping, expected "("`},
+		{expr: `topk(x)`, expectedErr: "parse error at char 1: wrong number of arguments for aggregate expression provided, expected 2, got 1"},
+		{expr: `clamp(x, 1)`, expectedErr: `parse error at char 1: wrong number of arguments in call to "clamp", got 2`},
+		{expr: `sum(x)[5m]`, expectedErr: "parse error at char 7: ranges only allowed for vector selectors"},
+		{expr: `x[5]`, expectedErr: `parse error at char 3: unexpected number "5" in range, expected duration`},
+		{expr: `1 > 2`, expectedErr: "parse error at char 3: comparisons between scalars must use BOOL modifier"},
+		{expr: `1 and x`, expectedErr: `parse error at char 3: set operator "and" not allowed in binary scalar expression`},
+		{expr: `x + bool y`, expectedErr: "parse error at char 5: bool modifier can only be used on comparison operators"},
+		{expr: `x[5m] * 2`, expectedErr: "parse error at char 7: binary expression must contain only scalar and instant vector types"},
+		{expr: `sum(x) offset 5m`, expectedErr: "parse error at char 8: offset modifier must be preceded by an instant vector selector or range vector selector or a subquery"},
+		{expr: `x y`, expectedErr: `parse error at char 3: unexpected identifier "y"`},
+		{expr: `up{job="api}`, expectedErr: "parse error at char 8: unterminated quoted string"},
+		{expr: `x $ y`, expectedErr: "parse error at char 3: unexpected character '$'"},
+		{expr: `5m`, expectedErr: `parse error at char 1: unexpected duration "5m"`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.expr, func(t *testing.T) {
+			typ, err := Check(tc.expr)
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedType, typ)
+		})
+	}
+}
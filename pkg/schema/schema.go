@@ -0,0 +1,267 @@
+// Package schema reads JSON Schemas to find the fields and the values that the objects of a document accept.
+// Only the keywords that describe the shape of objects are supported, the schemas are not used for validation.
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// maxRefDepth limits the number of $ref that are followed in a row, schemas can refer to themselves.
+const maxRefDepth = 32
+
+// Loader reads schema files and caches them.
+type Loader struct {
+	mu    sync.Mutex
+	files map[string]interface{}
+}
+
+func NewLoader() *Loader {
+	return &Loader{files: map[string]interface{}{}}
+}
+
+// Load returns the root schema of a file.
+func (l *Loader) Load(path string) (*Schema, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	root, err := l.file(path)
+	if err != nil {
+		return nil, err
+	}
+	node, ok := root.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: the schema is not an object", path)
+	}
+	return &Schema{node: node, file: path, root: root, loader: l}, nil
+}
+
+// Reset drops the cached files.
+func (l *Loader) Reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.files = map[string]interface{}{}
+}
+
+func (l *Loader) file(path string) (interface{}, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if root, ok := l.files[path]; ok {
+		return root, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var root interface{}
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	l.files[path] = root
+	return root, nil
+}
+
+// Schema is a JSON Schema, or one of its subschemas. The methods of a nil Schema return empty values,
+// so that a schema can be walked without checking each step.
+type Schema struct {
+	node   map[string]interface{}
+	file   string
+	root   interface{}
+	loader *Loader
+}
+
+// resolve follows the $ref of the schema, to the same file or to files relative to it.
+func (s *Schema) resolve() *Schema {
+	for i := 0; s != nil && i < maxRefDepth; i++ {
+		ref, ok := s.node["$ref"].(string)
+		if !ok {
+			return s
+		}
+		s = s.ref(ref)
+	}
+	return s
+}
+
+func (s *Schema) ref(ref string) *Schema {
+	file, pointer, _ := strings.Cut(ref, "#")
+	target := &Schema{file: s.file, root: s.root, loader: s.loader}
+	if file != "" {
+		if strings.Contains(file, "://") {
+			// Remote schemas are not fetched
+			return nil
+		}
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(filepath.Dir(s.file), file)
+		}
+		root, err := s.loader.file(file)
+		if err != nil {
+			return nil
+		}
+		target.file, target.root = file, root
+	}
+
+	node := target.root
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		if token == "" {
+			continue
+		}
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		object, ok := node.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		node = object[token]
+	}
+	target.node, _ = node.(map[string]interface{})
+	if target.node == nil {
+		return nil
+	}
+	return target
+}
+
+// sub returns the subschema at a key of the schema.
+func (s *Schema) sub(value interface{}) *Schema {
+	node, ok := value.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	return (&Schema{node: node, file: s.file, root: s.root, loader: s.loader}).resolve()
+}
+
+// alternatives returns the schema and the schemas it is combined with by allOf, anyOf and oneOf.
+func (s *Schema) alternatives() []*Schema {
+	s = s.resolve()
+	if s == nil {
+		return nil
+	}
+	schemas := []*Schema{s}
+	for _, keyword := range []string{"allOf", "anyOf", "oneOf"} {
+		list, _ := s.node[keyword].([]interface{})
+		for _, item := range list {
+			if sub := s.sub(item); sub != nil {
+				schemas = append(schemas, sub.alternatives()...)
+			}
+		}
+	}
+	return schemas
+}
+
+// Properties returns the properties that the schema describes.
+func (s *Schema) Properties() map[string]*Schema {
+	properties := map[string]*Schema{}
+	for _, alternative := range s.alternatives() {
+		object, _ := alternative.node["properties"].(map[string]interface{})
+		for name, value := range object {
+			if _, ok := properties[name]; ok {
+				continue
+			}
+			if sub := alternative.sub(value); sub != nil {
+				properties[name] = sub
+			}
+		}
+	}
+	return properties
+}
+
+// Property returns the schema of a property, which is described by the properties or the additionalProperties of the schema.
+func (s *Schema) Property(name string) *Schema {
+	if property, ok := s.Properties()[name]; ok {
+		return property
+	}
+	for _, alternative := range s.alternatives() {
+		if additional := alternative.sub(alternative.node["additionalProperties"]); additional != nil {
+			return additional
+		}
+	}
+	return nil
+}
+
+// Items returns the schema of the elements of an array.
+func (s *Schema) Items() *Schema {
+	for _, alternative := range s.alternatives() {
+		switch items := alternative.node["items"].(type) {
+		case map[string]interface{}:
+			return alternative.sub(items)
+		case []interface{}:
+			if len(items) > 0 {
+				return alternative.sub(items[0])
+			}
+		}
+	}
+	return nil
+}
+
+// Required returns the names of the required properties, sorted.
+func (s *Schema) Required() []string {
+	seen := map[string]bool{}
+	var required []string
+	for _, alternative := range s.alternatives() {
+		list, _ := alternative.node["required"].([]interface{})
+		for _, item := range list {
+			if name, ok := item.(string); ok && !seen[name] {
+				seen[name] = true
+				required = append(required, name)
+			}
+		}
+	}
+	sort.Strings(required)
+	return required
+}
+
+// Enum returns the values that the schema accepts, if it only accepts some of them.
+func (s *Schema) Enum() []interface{} {
+	for _, alternative := range s.alternatives() {
+		if values, ok := alternative.node["enum"].([]interface{}); ok {
+			return values
+		}
+		if value, ok := alternative.node["const"]; ok {
+			return []interface{}{value}
+		}
+	}
+	return nil
+}
+
+// Description returns the description of the schema, or its title.
+func (s *Schema) Description() string {
+	for _, alternative := range s.alternatives() {
+		if description, ok := alternative.node["description"].(string); ok {
+			return description
+		}
+		if title, ok := alternative.node["title"].(string); ok {
+			return title
+		}
+	}
+	return ""
+}
+
+// Type returns the types that the schema accepts, separated by `|`, or an empty string if they are not described.
+func (s *Schema) Type() string {
+	var types []string
+	seen := map[string]bool{}
+	add := func(t string) {
+		if !seen[t] {
+			seen[t] = true
+			types = append(types, t)
+		}
+	}
+	for _, alternative := range s.alternatives() {
+		switch t := alternative.node["type"].(type) {
+		case string:
+			add(t)
+		case []interface{}:
+			for _, item := range t {
+				if name, ok := item.(string); ok {
+					add(name)
+				}
+			}
+		}
+	}
+	return strings.Join(types, "|")
+}
@@ -0,0 +1,104 @@
+package schema
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeSchemas(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+	}
+	return dir
+}
+
+func TestSchema(t *testing.T) {
+	dir := writeSchemas(t, map[string]string{
+		"deployment.json": `{
+			"type": "object",
+			"required": ["spec", "metadata"],
+			"properties": {
+				"metadata": {"$ref": "common.json#/definitions/metadata"},
+				"spec": {"$ref": "#/definitions/spec"}
+			},
+			"definitions": {
+				"spec": {
+					"allOf": [
+						{"properties": {"replicas": {"type": "integer", "description": "Number of pods"}}},
+						{"properties": {"containers": {"type": "array", "items": {"$ref": "#/definitions/container"}}}}
+					]
+				},
+				"container": {
+					"properties": {
+						"imagePullPolicy": {"type": "string", "enum": ["Always", "IfNotPresent", "Never"]},
+						"name": {"type": "string", "title": "Container name"}
+					}
+				}
+			}
+		}`,
+		"common.json": `{
+			"definitions": {
+				"metadata": {
+					"type": "object",
+					"properties": {"name": {"type": ["string", "null"]}},
+					"additionalProperties": {"type": "string"}
+				}
+			}
+		}`,
+	})
+
+	loader := NewLoader()
+	root, err := loader.Load(filepath.Join(dir, "deployment.json"))
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"metadata", "spec"}, root.Required())
+	assert.Equal(t, "object", root.Type())
+
+	metadata := root.Property("metadata")
+	assert.Equal(t, "string|null", metadata.Property("name").Type())
+	assert.Equal(t, "string", metadata.Property("labels").Type(), "additionalProperties describe the other properties")
+
+	spec := root.Property("spec")
+	assert.Len(t, spec.Properties(), 2)
+	assert.Equal(t, "Number of pods", spec.Property("replicas").Description())
+
+	container := spec.Property("containers").Items()
+	assert.Equal(t, []interface{}{"Always", "IfNotPresent", "Never"}, container.Property("imagePullPolicy").Enum())
+	assert.Equal(t, "Container name", container.Property("name").Description())
+
+	// Unknown properties have nil schemas, which are empty
+	unknown := spec.Property("unknown").Property("nested")
+	assert.Nil(t, unknown)
+	assert.Empty(t, unknown.Properties())
+	assert.Empty(t, unknown.Required())
+}
+
+func TestSchemaRecursiveRef(t *testing.T) {
+	dir := writeSchemas(t, map[string]string{
+		"loop.json": `{"definitions": {"a": {"$ref": "#/definitions/b"}, "b": {"$ref": "#/definitions/a"}}, "properties": {"x": {"$ref": "#/definitions/a"}}}`,
+	})
+
+	root, err := NewLoader().Load(filepath.Join(dir, "loop.json"))
+	require.NoError(t, err)
+	assert.Empty(t, root.Property("x").Properties())
+}
+
+func TestLoaderErrors(t *testing.T) {
+	dir := writeSchemas(t, map[string]string{
+		"array.json":   `[]`,
+		"invalid.json": `{`,
+	})
+
+	loader := NewLoader()
+	_, err := loader.Load(filepath.Join(dir, "array.json"))
+	assert.ErrorContains(t, err, "the schema is not an object")
+	_, err = loader.Load(filepath.Join(dir, "invalid.json"))
+	assert.Error(t, err)
+	_, err = loader.Load(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+}
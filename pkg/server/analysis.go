@@ -0,0 +1,143 @@
+package server
+
+import (
+	"github.com/google/go-jsonnet/ast"
+	"github.com/google/go-jsonnet/toolutils"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+)
+
+// analyzer statically checks a node of a document. It is called for every node of the document's AST.
+type analyzer func(node ast.Node) []protocol.Diagnostic
+
+// analyzers run along with the linter, they find the bugs that the linter doesn't know about.
+var analyzers = []analyzer{
+	analyzeFormatString,
+	analyzeDeprecatedStd,
+}
+
+// getAnalysisDiags runs the analyzers against the document's AST.
+func getAnalysisDiags(doc *document) []protocol.Diagnostic {
+	// The AST is out of date if the document doesn't parse, the positions would be wrong
+	if doc.ast == nil || len(doc.linesChangedSinceAST) > 0 {
+		return nil
+	}
+
+	var diags []protocol.Diagnostic
+	walk(doc.ast, func(node ast.Node) {
+		for _, analyze := range analyzers {
+			diags = append(diags, analyze(node)...)
+		}
+	})
+	return diags
+}
+
+// walk calls fn for the node and all of its descendants.
+func walk(node ast.Node, fn func(ast.Node)) {
+	if node == nil {
+		return
+	}
+	fn(node)
+	for _, child := range toolutils.Children(node) {
+		walk(child, fn)
+	}
+}
+
+// varScope maps the variables in scope to their value. The value is nil when it can't be known statically.
+type varScope map[ast.Identifier]ast.Node
+
+func (s varScope) with(binds map[ast.Identifier]ast.Node) varScope {
+	scope := make(varScope, len(s)+len(binds))
+	for id, node := range s {
+		scope[id] = node
+	}
+	for id, node := range binds {
+		scope[id] = node
+	}
+	return scope
+}
+
+// walkWithScope calls visit for the node and all of its descendants, along with the variables in scope at each node.
+func walkWithScope(node ast.Node, scope varScope, visit func(ast.Node, varScope)) {
+	if node == nil {
+		return
+	}
+	visit(node, scope)
+
+	switch node := node.(type) {
+	case *ast.Local:
+		binds := map[ast.Identifier]ast.Node{}
+		for _, bind := range node.Binds {
+			binds[bind.Variable] = bind.Body
+		}
+		scope = scope.with(binds)
+		for _, bind := range node.Binds {
+			walkWithScope(bind.Body, scope, visit)
+		}
+		walkWithScope(node.Body, scope, visit)
+	case *ast.Function:
+		params := map[ast.Identifier]ast.Node{}
+		for _, param := range node.Parameters {
+			params[param.Name] = nil
+		}
+		scope = scope.with(params)
+		for _, param := range node.Parameters {
+			walkWithScope(param.DefaultArg, scope, visit)
+		}
+		walkWithScope(node.Body, scope, visit)
+	case *ast.DesugaredObject:
+		// self can't be the name of a variable, it is used to find the object that self refers to
+		binds := map[ast.Identifier]ast.Node{"self": node}
+		for _, bind := range node.Locals {
+			binds[bind.Variable] = bind.Body
+		}
+		scope = scope.with(binds)
+		for _, bind := range node.Locals {
+			walkWithScope(bind.Body, scope, visit)
+		}
+		for _, field := range node.Fields {
+			walkWithScope(field.Name, scope, visit)
+			walkWithScope(field.Body, scope, visit)
+		}
+		for _, assert := range node.Asserts {
+			walkWithScope(assert, scope, visit)
+		}
+	default:
+		for _, child := range toolutils.Children(node) {
+			walkWithScope(child, scope, visit)
+		}
+	}
+}
+
+// stdFunctionCall returns the arguments of a call to the given std function, including the calls that come
+// from desugared operators (for example, `a % b` is desugared to `std.mod(a, b)`).
+func stdFunctionCall(node ast.Node, name string) ([]ast.Node, bool) {
+	if called, args, ok := stdCall(node); ok && called == name {
+		return args, true
+	}
+	return nil, false
+}
+
+// stdCall returns the name of the std function called by the node, and its positional arguments.
+func stdCall(node ast.Node) (string, []ast.Node, bool) {
+	apply, ok := node.(*ast.Apply)
+	if !ok {
+		return "", nil, false
+	}
+	index, ok := apply.Target.(*ast.Index)
+	if !ok {
+		return "", nil, false
+	}
+	if target, ok := index.Target.(*ast.Var); !ok || (target.Id != "std" && target.Id != "$std") {
+		return "", nil, false
+	}
+	name, ok := index.Index.(*ast.LiteralString)
+	if !ok {
+		return "", nil, false
+	}
+
+	args := make([]ast.Node, len(apply.Arguments.Positional))
+	for i, arg := range apply.Arguments.Positional {
+		args[i] = arg.Expr
+	}
+	return name.Value, args, true
+}
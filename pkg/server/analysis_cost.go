@@ -0,0 +1,184 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/google/go-jsonnet"
+	"github.com/google/go-jsonnet/ast"
+	"github.com/google/go-jsonnet/toolutils"
+	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+)
+
+const (
+	expensiveConstructDiagnosticCode = "expensive-construct"
+	// mergePatchChainLength is the number of nested std.mergePatch calls from which a chain is reported
+	mergePatchChainLength = 3
+	// largeImportSize is the size, in bytes, from which the imports in comprehensions are reported
+	largeImportSize = 1 << 20
+)
+
+// costAnalyzer finds the constructs whose evaluation cost explodes with the size of their inputs.
+type costAnalyzer struct {
+	filename string
+	importer jsonnet.Importer
+	diags    []protocol.Diagnostic
+}
+
+// findExpensiveConstructs reports, as information, the constructs that are known to make the evaluation slow: the
+// long chains of std.mergePatch, the std.foldl that concatenate their accumulator over comprehensions, and the imports
+// of large files in comprehensions.
+func (s *Server) findExpensiveConstructs(ctx context.Context, doc *document) []protocol.Diagnostic {
+	if doc.ast == nil || len(doc.linesChangedSinceAST) > 0 {
+		return nil
+	}
+
+	filename := doc.item.URI.SpanURI().Filename()
+	config := s.configurationFor(filename)
+	analyzer := &costAnalyzer{
+		filename: filename,
+		importer: &cancellableImporter{ctx: ctx, importer: s.getImporter(config, filename, s.projectSettings(config, filename))},
+	}
+	analyzer.visit(doc.ast, false)
+	return analyzer.diags
+}
+
+// visit checks a node and its descendants. inComprehension is whether the node is evaluated for each element of a
+// comprehension.
+func (c *costAnalyzer) visit(node ast.Node, inComprehension bool) {
+	if node == nil {
+		return
+	}
+
+	if length := mergePatchChain(node); length >= mergePatchChainLength {
+		c.report(node, fmt.Sprintf("%d nested std.mergePatch calls copy the whole object at each level, merge the patches with + instead, or with a single std.mergePatch", length))
+		// The nested calls are part of the reported chain
+		c.visitMergePatchArguments(node, inComprehension)
+		return
+	}
+
+	if name, args, ok := stdCall(node); ok && (name == "foldl" || name == "foldr") && len(args) == 3 {
+		if comprehensionBody(args[1]) != nil && foldConcatenates(name, args[0]) {
+			c.report(node, fmt.Sprintf("std.%s concatenates its accumulator with + for each element of a comprehension, which copies it each time: the evaluation is quadratic in the number of elements. Build the result with a comprehension instead", name))
+		}
+	}
+
+	switch node := node.(type) {
+	case *ast.Import:
+		c.checkImport(node, node.File, inComprehension)
+	case *ast.ImportStr:
+		c.checkImport(node, node.File, inComprehension)
+	case *ast.ImportBin:
+		c.checkImport(node, node.File, inComprehension)
+	}
+
+	if body := comprehensionBody(node); body != nil {
+		_, args, _ := stdCall(node)
+		c.visit(args[1], inComprehension)
+		c.visit(body, true)
+		return
+	}
+	for _, child := range toolutils.Children(node) {
+		c.visit(child, inComprehension)
+	}
+}
+
+// visitMergePatchArguments visits the arguments of a chain of std.mergePatch calls, but not the calls themselves.
+func (c *costAnalyzer) visitMergePatchArguments(node ast.Node, inComprehension bool) {
+	name, args, ok := stdCall(node)
+	if !ok || name != "mergePatch" {
+		c.visit(node, inComprehension)
+		return
+	}
+	for _, arg := range args {
+		c.visitMergePatchArguments(arg, inComprehension)
+	}
+}
+
+// checkImport reports the imports of large files in comprehensions, which are imported, and often parsed, for each
+// element.
+func (c *costAnalyzer) checkImport(node ast.Node, file *ast.LiteralString, inComprehension bool) {
+	if !inComprehension {
+		return
+	}
+	contents, foundAt, err := c.importer.Import(c.filename, file.Value)
+	if err != nil || len(contents.Data()) < largeImportSize {
+		return
+	}
+	c.report(node, fmt.Sprintf("%s (%s) is imported for each element of a comprehension, import it once in a local outside of the comprehension", filepath.Base(foundAt), formatByteSize(len(contents.Data()))))
+}
+
+func (c *costAnalyzer) report(node ast.Node, message string) {
+	c.diags = append(c.diags, protocol.Diagnostic{
+		Range:    position.RangeASTToProtocol(*node.Loc()),
+		Severity: protocol.SeverityInformation,
+		Code:     expensiveConstructDiagnosticCode,
+		Source:   "lint",
+		Message:  message + ". Profile the evaluation with the jsonnet.profileFile command",
+	})
+}
+
+// mergePatchChain returns the number of std.mergePatch calls nested in each other from the node.
+func mergePatchChain(node ast.Node) int {
+	name, args, ok := stdCall(node)
+	if !ok || name != "mergePatch" {
+		return 0
+	}
+	longest := 0
+	for _, arg := range args {
+		longest = max(longest, mergePatchChain(arg))
+	}
+	return longest + 1
+}
+
+// comprehensionBody returns the expression that an array or object comprehension evaluates for each element. The
+// parser desugars the comprehensions to std.flatMap calls on functions that have no location.
+func comprehensionBody(node ast.Node) ast.Node {
+	name, args, ok := stdCall(node)
+	if !ok || name != "flatMap" || len(args) != 2 {
+		return nil
+	}
+	function, ok := args[0].(*ast.Function)
+	if !ok || function.LocRange.Begin.Line != 0 {
+		return nil
+	}
+	return function.Body
+}
+
+// foldConcatenates returns whether the function of a fold adds something to its accumulator with +, which copies the
+// accumulator.
+func foldConcatenates(name string, node ast.Node) bool {
+	function, ok := node.(*ast.Function)
+	if !ok || len(function.Parameters) != 2 {
+		return false
+	}
+	// std.foldl(function(acc, x) ...), std.foldr(function(x, acc) ...)
+	accumulator := function.Parameters[0].Name
+	if name == "foldr" {
+		accumulator = function.Parameters[1].Name
+	}
+	return concatenates(function.Body, accumulator)
+}
+
+func concatenates(node ast.Node, accumulator ast.Identifier) bool {
+	switch node := node.(type) {
+	case *ast.Local:
+		return concatenates(node.Body, accumulator)
+	case *ast.Conditional:
+		return concatenates(node.BranchTrue, accumulator) || concatenates(node.BranchFalse, accumulator)
+	case *ast.Binary:
+		if node.Op != ast.BopPlus {
+			return false
+		}
+		return isVar(node.Left, accumulator) || isVar(node.Right, accumulator) ||
+			concatenates(node.Left, accumulator) || concatenates(node.Right, accumulator)
+	}
+	return false
+}
+
+func isVar(node ast.Node, id ast.Identifier) bool {
+	v, ok := node.(*ast.Var)
+	return ok && v.Id == id
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindExpensiveConstructs(t *testing.T) {
+	testCases := []struct {
+		name     string
+		document string
+		expected []string
+	}{
+		{
+			name:     "short merge patch chain",
+			document: `std.mergePatch(std.mergePatch({}, { a: 1 }), { b: 2 })`,
+		},
+		{
+			name:     "long merge patch chain",
+			document: "local base = {};\nstd.mergePatch(std.mergePatch(std.mergePatch(base, { a: 1 }), { b: 2 }), std.mergePatch({}, { c: 3 }))",
+			expected: []string{
+				"1:0-1:102 expensive-construct: 3 nested std.mergePatch calls copy the whole object at each level, merge the patches with + instead, or with a single std.mergePatch. Profile the evaluation with the jsonnet.profileFile command",
+			},
+		},
+		{
+			name:     "fold concatenating over a comprehension",
+			document: "{\n  a: std.foldl(function(acc, x) acc + [x * 2], [i for i in std.range(1, 1000)], []),\n  b: std.foldr(function(x, acc) local y = x; { [y]: y } + acc, [std.toString(i) for i in std.range(1, 10)], {}),\n}",
+			expected: []string{
+				"1:5-1:83 expensive-construct: std.foldl concatenates its accumulator with + for each element of a comprehension, which copies it each time: the evaluation is quadratic in the number of elements. Build the result with a comprehension instead. Profile the evaluation with the jsonnet.profileFile command",
+				"2:5-2:111 expensive-construct: std.foldr concatenates its accumulator with + for each element of a comprehension, which copies it each time: the evaluation is quadratic in the number of elements. Build the result with a comprehension instead. Profile the evaluation with the jsonnet.profileFile command",
+			},
+		},
+		{
+			name:     "fold without concatenation",
+			document: `std.foldl(function(acc, x) acc * x, [i for i in std.range(1, 10)], 1)`,
+		},
+		{
+			name:     "fold over an array literal",
+			document: `std.foldl(function(acc, x) acc + [x], [1, 2, 3], [])`,
+		},
+		{
+			name:     "large import in a comprehension",
+			document: "local small = import 'small.json';\n[std.parseJson(importstr 'large.json') + small for i in std.range(1, 10)]\n+ [import 'small.json' for i in std.range(1, 10)]",
+			expected: []string{
+				"1:15-1:37 expensive-construct: large.json (1.0 MiB) is imported for each element of a comprehension, import it once in a local outside of the comprehension. Profile the evaluation with the jsonnet.profileFile command",
+			},
+		},
+		{
+			name:     "large import out of a comprehension",
+			document: "local large = std.parseJson(importstr 'large.json');\n[large for i in std.range(1, 10)]",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "small.json"), []byte("{}"), 0o600))
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "large.json"), []byte(`"`+strings.Repeat("a", largeImportSize-2)+`"`), 0o600))
+			file := filepath.Join(dir, "main.jsonnet")
+			require.NoError(t, os.WriteFile(file, []byte(tc.document), 0o600))
+
+			server := testServer(t, nil)
+			doc, err := server.cache.get(serverOpenTestFile(t, server, file))
+			require.NoError(t, err)
+
+			var found []string
+			for _, diag := range server.findExpensiveConstructs(context.Background(), doc) {
+				assert.Equal(t, protocol.SeverityInformation, diag.Severity)
+				found = append(found, fmt.Sprintf("%d:%d-%d:%d %s: %s", diag.Range.Start.Line, diag.Range.Start.Character, diag.Range.End.Line, diag.Range.End.Character, diag.Code, diag.Message))
+			}
+			assert.Equal(t, tc.expected, found)
+		})
+	}
+}
+
+func TestProfileFile(t *testing.T) {
+	root := writeProjectFiles(t, map[string]string{
+		"main.jsonnet": "{\n  a: std.foldl(function(acc, x) acc + [x], [i for i in std.range(1, 100)], []),\n  b: 1,\n  c:: error 'hidden',\n}",
+	})
+	main := filepath.Join(root, "main.jsonnet")
+	s := renameTestServer(t, root, nil)
+	doc, err := s.cache.get(serverOpenTestFile(t, s, main))
+	require.NoError(t, err)
+
+	// The expensive constructs offer to profile the file
+	diags := s.findExpensiveConstructs(context.Background(), doc)
+	require.Len(t, diags, 1)
+	actions := profileCodeActions(doc, append(diags, protocol.Diagnostic{Code: "other"}))
+	require.Len(t, actions, 1)
+	assert.Equal(t, "Profile the evaluation of main.jsonnet", actions[0].Title)
+	assert.Equal(t, diags, actions[0].Diagnostics)
+	assert.Empty(t, profileCodeActions(doc, nil))
+
+	result, err := s.ExecuteCommand(context.Background(), &protocol.ExecuteCommandParams{
+		Command:   actions[0].Command.Command,
+		Arguments: actions[0].Command.Arguments,
+	})
+	require.NoError(t, err)
+	profile := result.(evaluationProfile)
+	var fields []string
+	for _, field := range profile.Fields {
+		fields = append(fields, field.Field)
+	}
+	assert.ElementsMatch(t, []string{"a", "b"}, fields)
+	assert.Contains(t, profile.Report, "# Evaluation profile of main.jsonnet\n\nThe evaluation takes ")
+	assert.Contains(t, profile.Report, "| `b` | ")
+
+	fileArg, _ := json.Marshal(filepath.Join(root, "missing.jsonnet"))
+	_, err = s.ExecuteCommand(context.Background(), &protocol.ExecuteCommandParams{Command: "jsonnet.profileFile", Arguments: []json.RawMessage{fileArg}})
+	assert.ErrorContains(t, err, "unable to evaluate "+filepath.Join(root, "missing.jsonnet"))
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-jsonnet/ast"
+	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+)
+
+const (
+	duplicateFieldDiagnosticCode = "duplicate-field"
+	mixinOverrideDiagnosticCode  = "mixin-override"
+)
+
+// findDuplicateFields reports the fields of an object whose names, computed but known statically, are the same. With
+// the lint_mixin_overrides setting, it also reports the object fields of a mixin that replace object fields of the
+// left-hand side of `+` instead of merging into them with `+:`.
+func (s *Server) findDuplicateFields(ctx context.Context, doc *document) []protocol.Diagnostic {
+	if doc.ast == nil || len(doc.linesChangedSinceAST) > 0 {
+		return nil
+	}
+
+	filename := doc.item.URI.SpanURI().Filename()
+	config := s.configurationFor(filename)
+	checker := &typeChecker{
+		server:   s,
+		vm:       s.getCancellableVM(ctx, filename),
+		filename: filename,
+		lines:    map[string][]string{},
+	}
+
+	var diags []protocol.Diagnostic
+	walkWithScope(doc.ast, varScope{}, func(node ast.Node, scope varScope) {
+		switch node := node.(type) {
+		case *ast.DesugaredObject:
+			diags = append(diags, duplicateFields(node, scope)...)
+		case *ast.Binary:
+			if config.LintMixinOverrides && node.Op == ast.BopPlus {
+				diags = append(diags, checker.mixinOverrides(node, scope)...)
+			}
+		}
+	})
+	return diags
+}
+
+// duplicateFields reports the fields that have the name of a previous field of the object. The parser already
+// rejects the duplicate literal names, evaluating the computed ones fails.
+func duplicateFields(object *ast.DesugaredObject, scope varScope) []protocol.Diagnostic {
+	var diags []protocol.Diagnostic
+	seen := map[string]ast.DesugaredObjectField{}
+	for _, field := range object.Fields {
+		name, ok := staticString(field.Name, scope, 0)
+		if !ok {
+			continue
+		}
+		previous, ok := seen[name]
+		if !ok {
+			seen[name] = field
+			continue
+		}
+		diags = append(diags, protocol.Diagnostic{
+			Range:    position.RangeASTToProtocol(fieldNameLoc(field, name)),
+			Severity: protocol.SeverityWarning,
+			Code:     duplicateFieldDiagnosticCode,
+			Source:   "lint",
+			Message:  fmt.Sprintf("duplicate field %s, it is already defined on line %d", name, previous.LocRange.Begin.Line),
+		})
+	}
+	return diags
+}
+
+// mixinOverrides reports the object fields of the right-hand side of `+` that replace an object field of the left-hand
+// side, when both sides are known statically.
+func (c *typeChecker) mixinOverrides(node *ast.Binary, scope varScope) []protocol.Diagnostic {
+	right, ok := node.Right.(*ast.DesugaredObject)
+	if !ok {
+		return nil
+	}
+	left := c.mixinFields(node.Left, scope)
+
+	var diags []protocol.Diagnostic
+	for _, field := range right.Fields {
+		name, ok := staticString(field.Name, scope, 0)
+		if !ok || field.PlusSuper {
+			continue
+		}
+		if _, ok := field.Body.(*ast.DesugaredObject); !ok {
+			continue
+		}
+		replaced, ok := left[name]
+		if !ok || c.knownObject(replaced.Body, scope) == nil {
+			continue
+		}
+		diags = append(diags, protocol.Diagnostic{
+			Range:    position.RangeASTToProtocol(fieldNameLoc(field, name)),
+			Severity: protocol.SeverityWarning,
+			Code:     mixinOverrideDiagnosticCode,
+			Source:   "lint",
+			Message:  fmt.Sprintf("field %s replaces the object it overrides, use %s+: to merge into it", name, name),
+		})
+	}
+	return diags
+}
+
+// mixinFields returns the fields of the objects that are added together, by name, the last ones winning. The objects
+// that aren't known statically are skipped.
+func (c *typeChecker) mixinFields(node ast.Node, scope varScope) map[string]ast.DesugaredObjectField {
+	if binary, ok := node.(*ast.Binary); ok && binary.Op == ast.BopPlus {
+		fields := c.mixinFields(binary.Left, scope)
+		for name, field := range c.mixinFields(binary.Right, scope) {
+			fields[name] = field
+		}
+		return fields
+	}
+
+	fields := map[string]ast.DesugaredObjectField{}
+	if object := c.knownObject(node, scope); object != nil {
+		for _, field := range object.Fields {
+			if name, ok := staticString(field.Name, scope, 0); ok {
+				fields[name] = field
+			}
+		}
+	}
+	return fields
+}
+
+// staticString returns the value of a string that is known without evaluating the code: a literal, a concatenation of
+// known strings, or a variable bound to a known string.
+func staticString(node ast.Node, scope varScope, depth int) (string, bool) {
+	if depth > 10 {
+		return "", false
+	}
+	switch node := node.(type) {
+	case *ast.LiteralString:
+		return node.Value, true
+	case *ast.Var:
+		return staticString(scope[node.Id], scope, depth+1)
+	case *ast.Binary:
+		if node.Op != ast.BopPlus {
+			return "", false
+		}
+		left, ok := staticString(node.Left, scope, depth+1)
+		if !ok {
+			return "", false
+		}
+		right, ok := staticString(node.Right, scope, depth+1)
+		return left + right, ok
+	}
+	return "", false
+}
+
+// fieldNameLoc returns the location of the name of a field. The names of the fields that are identifiers have no
+// location, they start the field.
+func fieldNameLoc(field ast.DesugaredObjectField, name string) ast.LocationRange {
+	if loc := field.Name.Loc(); loc != nil && loc.Begin.IsSet() {
+		return *loc
+	}
+	return fieldNameRange(field, name)
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindDuplicateFields(t *testing.T) {
+	testCases := []struct {
+		name           string
+		document       string
+		mixinOverrides bool
+		expected       []string
+	}{
+		{
+			name:     "no duplicates",
+			document: `{ a: 1, ['b']: 2, [std.toString(1)]: 3 }`,
+		},
+		{
+			name:     "computed names",
+			document: "local k = 'a';\n{\n  a: 1,\n  ['a']: 2,\n  [k]: 3,\n  ['b' + 'c']: 4,\n  bc: 5,\n}",
+			expected: []string{
+				"3:3-3:6 duplicate-field: duplicate field a, it is already defined on line 3",
+				"4:3-4:4 duplicate-field: duplicate field a, it is already defined on line 3",
+				"6:2-6:4 duplicate-field: duplicate field bc, it is already defined on line 6",
+			},
+		},
+		{
+			name:     "unknown names are not checked",
+			document: "function(k) { a: 1, [k]: 2 }",
+		},
+		{
+			name:     "mixin overrides are off by default",
+			document: `{ spec: { replicas: 1 } } + { spec: { paused: true } }`,
+		},
+		{
+			name:           "mixin overrides",
+			mixinOverrides: true,
+			document: `local base = { spec: { replicas: 1 }, name: 'a', labels: {} };
+local lib = import 'lib.libsonnet';
+base + { spec: { paused: true }, name: 'b', labels+: {} }
++ lib + { metadata: {} } + { metadata: { name: 'x' } }
++ { other: {} }`,
+			expected: []string{
+				"3:29-3:37 mixin-override: field metadata replaces the object it overrides, use metadata+: to merge into it",
+				"3:10-3:18 mixin-override: field metadata replaces the object it overrides, use metadata+: to merge into it",
+				"2:9-2:13 mixin-override: field spec replaces the object it overrides, use spec+: to merge into it",
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "lib.libsonnet"), []byte("{ metadata: { name: 'lib' } }"), 0o600))
+			file := filepath.Join(dir, "main.jsonnet")
+			require.NoError(t, os.WriteFile(file, []byte(tc.document), 0o600))
+
+			server := testServer(t, nil)
+			require.NoError(t, server.DidChangeConfiguration(context.Background(), &protocol.DidChangeConfigurationParams{
+				Settings: map[string]interface{}{"lint_mixin_overrides": tc.mixinOverrides},
+			}))
+			doc, err := server.cache.get(serverOpenTestFile(t, server, file))
+			require.NoError(t, err)
+
+			var found []string
+			for _, diag := range server.findDuplicateFields(context.Background(), doc) {
+				found = append(found, fmt.Sprintf("%d:%d-%d:%d %s: %s", diag.Range.Start.Line, diag.Range.Start.Character, diag.Range.End.Line, diag.Range.End.Character, diag.Code, diag.Message))
+			}
+			assert.Equal(t, tc.expected, found)
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/google/go-jsonnet"
+	"github.com/google/go-jsonnet/ast"
+	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+const undefinedFieldDiagnosticCode = "undefined-field"
+
+// undefinedField is an access to a field that doesn't exist in an object whose fields are all known.
+type undefinedField struct {
+	diagnostic protocol.Diagnostic
+	field      string
+	object     *ast.DesugaredObject
+}
+
+// findUndefinedFields finds the `x.field` accesses where x is bound to an object literal, or to an import of a file
+// that is an object literal, which doesn't have that field.
+func (s *Server) findUndefinedFields(ctx context.Context, doc *document) []undefinedField {
+	if doc.ast == nil || len(doc.linesChangedSinceAST) > 0 {
+		return nil
+	}
+
+	filename := doc.item.URI.SpanURI().Filename()
+	vm := s.getCancellableVM(ctx, filename)
+
+	var fields []undefinedField
+	walkWithScope(doc.ast, varScope{}, func(node ast.Node, scope varScope) {
+		if index, ok := node.(*ast.Index); ok {
+			if field, ok := undefinedFieldAccess(index, scope, vm, filename); ok {
+				fields = append(fields, field)
+			}
+		}
+	})
+
+	return fields
+}
+
+func undefinedFieldAccess(node *ast.Index, scope varScope, vm *jsonnet.VM, filename string) (undefinedField, bool) {
+	target, ok := node.Target.(*ast.Var)
+	if !ok {
+		return undefinedField{}, false
+	}
+	name, ok := node.Index.(*ast.LiteralString)
+	if !ok {
+		return undefinedField{}, false
+	}
+	object := knownObject(scope[target.Id], vm, filename)
+	if object == nil {
+		return undefinedField{}, false
+	}
+
+	for _, field := range object.Fields {
+		if fieldName, ok := field.Name.(*ast.LiteralString); !ok || fieldName.Value == name.Value {
+			return undefinedField{}, false
+		}
+	}
+
+	return undefinedField{
+		diagnostic: protocol.Diagnostic{
+			Range:    position.RangeASTToProtocol(node.LocRange),
+			Severity: protocol.SeverityWarning,
+			Code:     undefinedFieldDiagnosticCode,
+			Source:   "lint",
+			Message:  fmt.Sprintf("field %s does not exist in %s", name.Value, target.Id),
+		},
+		field:  name.Value,
+		object: object,
+	}, true
+}
+
+// knownObject returns the object literal that the node evaluates to, if it is one or if it is an import of a file that is one.
+func knownObject(node ast.Node, vm *jsonnet.VM, filename string) *ast.DesugaredObject {
+	if imp, ok := node.(*ast.Import); ok {
+		root, _, err := vm.ImportAST(filename, imp.File.Value)
+		if err != nil {
+			return nil
+		}
+		node = root
+		for {
+			local, ok := node.(*ast.Local)
+			if !ok {
+				break
+			}
+			node = local.Body
+		}
+	}
+
+	object, _ := node.(*ast.DesugaredObject)
+	return object
+}
+
+// undefinedFieldCodeActions offers to create the fields reported as undefined.
+func (s *Server) undefinedFieldCodeActions(ctx context.Context, doc *document, diags []protocol.Diagnostic) []protocol.CodeAction {
+	var actions []protocol.CodeAction
+	var fields []undefinedField
+	for _, diag := range diags {
+		if diag.Code != undefinedFieldDiagnosticCode {
+			continue
+		}
+		if fields == nil {
+			fields = s.findUndefinedFields(ctx, doc)
+		}
+		for _, field := range fields {
+			if field.diagnostic.Range != diag.Range || field.diagnostic.Message != diag.Message {
+				continue
+			}
+			action, err := s.createFieldCodeAction(field, diag)
+			if err != nil {
+				log.Errorf("CodeAction: unable to create field %s: %v", field.field, err)
+				continue
+			}
+			actions = append(actions, action)
+		}
+	}
+	return actions
+}
+
+// createFieldCodeAction adds the field, with a null value, at the end of the object.
+func (s *Server) createFieldCodeAction(field undefinedField, diag protocol.Diagnostic) (protocol.CodeAction, error) {
+	edit, err := s.appendFieldsEdit(field.object, []string{field.field + ": null"})
+	if err != nil {
+		return protocol.CodeAction{}, err
+	}
+	return protocol.CodeAction{
+		Title:       fmt.Sprintf("Create field %s", field.field),
+		Kind:        protocol.QuickFix,
+		Diagnostics: []protocol.Diagnostic{diag},
+		Edit:        edit,
+	}, nil
+}
+
+// appendFieldsEdit adds the fields, written as `name: value`, at the end of the object.
+func (s *Server) appendFieldsEdit(object *ast.DesugaredObject, fields []string) (protocol.WorkspaceEdit, error) {
+	uri := protocol.URIFromPath(object.LocRange.FileName)
+	text, err := s.documentText(uri)
+	if err != nil {
+		return protocol.WorkspaceEdit{}, err
+	}
+
+	lines := strings.Split(text, "\n")
+	end := object.LocRange.End
+	if end.Line < 1 || end.Line > len(lines) || end.Column < 2 || end.Column-1 > len(lines[end.Line-1]) {
+		return protocol.WorkspaceEdit{}, fmt.Errorf("object end %v is out of the file", end)
+	}
+	// The object ends with its closing brace, find where its content ends
+	braceLine, braceColumn := end.Line-1, end.Column-2
+	contentLine, content := braceLine, strings.TrimRight(lines[braceLine][:braceColumn], " \t")
+	for content == "" && contentLine > 0 {
+		contentLine--
+		content = strings.TrimRight(lines[contentLine], " \t")
+	}
+
+	newText := ""
+	if !strings.HasSuffix(content, "{") && !strings.HasSuffix(content, ",") {
+		newText = ","
+	}
+	if contentLine == braceLine {
+		newText += " " + strings.Join(fields, ", ")
+		if strings.HasSuffix(content, "{") && braceColumn == len(content) {
+			newText += " "
+		}
+	} else {
+		braceIndent := lines[braceLine][:len(lines[braceLine])-len(strings.TrimLeft(lines[braceLine], " \t"))]
+		indent := s.configurationFor(object.LocRange.FileName).FormattingOptions.Indent
+		if indent <= 0 {
+			indent = 2
+		}
+		for _, field := range fields {
+			newText += "\n" + braceIndent + strings.Repeat(" ", indent) + field + ","
+		}
+	}
+
+	insertAt := protocol.Position{Line: uint32(contentLine), Character: uint32(len(content))}
+	return protocol.WorkspaceEdit{
+		Changes: map[string][]protocol.TextEdit{
+			string(uri): {{Range: protocol.Range{Start: insertAt, End: insertAt}, NewText: newText}},
+		},
+	}, nil
+}
+
+// documentText returns the text of a document, from the cache if it is open, otherwise from the disk.
+func (s *Server) documentText(uri protocol.DocumentURI) (string, error) {
+	if doc, err := s.cache.get(uri); err == nil {
+		return doc.item.Text, nil
+	}
+	bytes, err := os.ReadFile(uri.SpanURI().Filename())
+	return string(bytes), err
+}
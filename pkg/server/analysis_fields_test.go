@@ -0,0 +1,121 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindUndefinedFields(t *testing.T) {
+	testCases := []struct {
+		name     string
+		document string
+		expected []string
+	}{
+		{
+			name:     "existing fields",
+			document: "local obj = { a: 1, b:: 2 };\n[obj.a, obj.b]",
+		},
+		{
+			name:     "undefined field",
+			document: "local obj = { a: 1 };\nobj.b",
+			expected: []string{"field b does not exist in obj"},
+		},
+		{
+			name:     "undefined field of an import",
+			document: "local lib = import 'lib.libsonnet';\n[lib.new, lib.old]",
+			expected: []string{"field old does not exist in lib"},
+		},
+		{
+			name:     "shadowed by a function parameter",
+			document: "local obj = { a: 1 };\nlocal f(obj) = obj.b;\nf({ b: 1 })",
+		},
+		{
+			name:     "shadowed by an inner local",
+			document: "local obj = { a: 1 };\nlocal inner = local obj = { b: 1 }; obj.b;\ninner",
+		},
+		{
+			name:     "computed field names",
+			document: "local name = 'b';\nlocal obj = { [name]: 1 };\nobj.b",
+		},
+		{
+			name:     "objects that aren't literals are unknown",
+			document: "local obj = { a: 1 } + { b: 1 };\nobj.b",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "lib.libsonnet"), []byte("local x = 1;\n{ new: x }"), 0o600))
+			file := filepath.Join(dir, "main.jsonnet")
+			require.NoError(t, os.WriteFile(file, []byte(tc.document), 0o600))
+
+			server := testServer(t, nil)
+			doc, err := server.cache.get(serverOpenTestFile(t, server, file))
+			require.NoError(t, err)
+
+			var messages []string
+			for _, field := range server.findUndefinedFields(context.Background(), doc) {
+				assert.Equal(t, undefinedFieldDiagnosticCode, field.diagnostic.Code)
+				messages = append(messages, field.diagnostic.Message)
+			}
+			assert.Equal(t, tc.expected, messages)
+		})
+	}
+}
+
+func TestCreateFieldCodeAction(t *testing.T) {
+	testCases := []struct {
+		name     string
+		document string
+		expected string
+	}{
+		{
+			name:     "single line",
+			document: "local obj = { a: 1 };\nobj.b",
+			expected: "local obj = { a: 1, b: null };\nobj.b",
+		},
+		{
+			name:     "empty object",
+			document: "local obj = {};\nobj.b",
+			expected: "local obj = { b: null };\nobj.b",
+		},
+		{
+			name:     "multiple lines",
+			document: "local obj = {\n  a: 1,\n};\nobj.b",
+			expected: "local obj = {\n  a: 1,\n  b: null,\n};\nobj.b",
+		},
+		{
+			name:     "multiple lines without trailing comma",
+			document: "local obj = {\n  a: 1\n};\nobj.b",
+			expected: "local obj = {\n  a: 1,\n  b: null,\n};\nobj.b",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server, uri := testServerWithFile(t, nil, tc.document)
+			doc, err := server.cache.get(uri)
+			require.NoError(t, err)
+
+			fields := server.findUndefinedFields(context.Background(), doc)
+			require.Len(t, fields, 1)
+
+			actions, err := server.CodeAction(context.Background(), &protocol.CodeActionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+				Context:      protocol.CodeActionContext{Diagnostics: []protocol.Diagnostic{fields[0].diagnostic}},
+			})
+			require.NoError(t, err)
+			require.NotEmpty(t, actions)
+			assert.Equal(t, "Create field b", actions[0].Title)
+
+			edits := actions[0].Edit.Changes[string(uri)]
+			require.Len(t, edits, 1)
+			assert.Equal(t, tc.expected, applyTextEdits(t, tc.document, edits))
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/go-jsonnet/ast"
+	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+)
+
+const formatDiagnosticCode = "format"
+
+// formatVerb is a conversion of a std.format string: %[(key)][flags][width][.precision][length]conversion
+type formatVerb struct {
+	key                      string
+	hasKey                   bool
+	widthStar, precisionStar bool
+	conversion               byte
+}
+
+// args is the number of values that the verb reads when formatting an array.
+func (v formatVerb) args() int {
+	n := 1
+	if v.widthStar {
+		n++
+	}
+	if v.precisionStar {
+		n++
+	}
+	return n
+}
+
+// parseFormatVerbs parses the verbs of a format string like std.format does. The `%%` escapes are left out.
+func parseFormatVerbs(format string) ([]formatVerb, error) {
+	var verbs []formatVerb
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		i++
+
+		verb := formatVerb{}
+		if i < len(format) && format[i] == '(' {
+			end := strings.IndexByte(format[i:], ')')
+			if end < 0 {
+				return nil, fmt.Errorf("truncated format code")
+			}
+			verb.key, verb.hasKey = format[i+1:i+end], true
+			i += end + 1
+		}
+		for i < len(format) && strings.IndexByte("#0- +", format[i]) >= 0 {
+			i++
+		}
+		if i < len(format) && format[i] == '*' {
+			verb.widthStar = true
+			i++
+		}
+		for i < len(format) && format[i] >= '0' && format[i] <= '9' {
+			i++
+		}
+		if i < len(format) && format[i] == '.' {
+			i++
+			if i < len(format) && format[i] == '*' {
+				verb.precisionStar = true
+				i++
+			}
+			for i < len(format) && format[i] >= '0' && format[i] <= '9' {
+				i++
+			}
+		}
+		for i < len(format) && strings.IndexByte("hlL", format[i]) >= 0 {
+			i++
+		}
+		if i >= len(format) {
+			return nil, fmt.Errorf("truncated format code")
+		}
+
+		verb.conversion = format[i]
+		switch {
+		case verb.conversion == '%':
+			continue
+		case strings.IndexByte("diouxXeEfFgGcrs", verb.conversion) < 0:
+			return nil, fmt.Errorf("unrecognised conversion type: %c", verb.conversion)
+		}
+		verbs = append(verbs, verb)
+	}
+	return verbs, nil
+}
+
+// analyzeFormatString checks that the values given to `'format' % values` and std.format('format', values)
+// match the verbs of the format, when the format is a literal string.
+func analyzeFormatString(node ast.Node) []protocol.Diagnostic {
+	args, ok := stdFunctionCall(node, "mod")
+	if !ok {
+		args, ok = stdFunctionCall(node, "format")
+	}
+	if !ok || len(args) != 2 {
+		return nil
+	}
+	format, ok := args[0].(*ast.LiteralString)
+	if !ok {
+		return nil
+	}
+
+	diag := func(loc ast.LocationRange, message string, a ...interface{}) protocol.Diagnostic {
+		return protocol.Diagnostic{
+			Range:    position.RangeASTToProtocol(loc),
+			Severity: protocol.SeverityWarning,
+			Code:     formatDiagnosticCode,
+			Source:   "lint",
+			Message:  fmt.Sprintf(message, a...),
+		}
+	}
+
+	verbs, err := parseFormatVerbs(format.Value)
+	if err != nil {
+		return []protocol.Diagnostic{diag(format.LocRange, "invalid format string: %v", err)}
+	}
+
+	switch values := args[1].(type) {
+	case *ast.Array:
+		return analyzeFormatArray(node, verbs, values, diag)
+	case *ast.DesugaredObject:
+		return analyzeFormatObject(node, verbs, values, diag)
+	case *ast.LiteralString, *ast.LiteralNumber, *ast.LiteralBoolean, *ast.LiteralNull:
+		// A single value is formatted as if it was in an array
+		return analyzeFormatArray(node, verbs, &ast.Array{
+			NodeBase: ast.NodeBase{LocRange: *values.Loc()},
+			Elements: []ast.CommaSeparatedExpr{{Expr: values}},
+		}, diag)
+	}
+	return nil
+}
+
+type formatDiagnostic func(loc ast.LocationRange, message string, a ...interface{}) protocol.Diagnostic
+
+func analyzeFormatArray(node ast.Node, verbs []formatVerb, values *ast.Array, diag formatDiagnostic) []protocol.Diagnostic {
+	expected := 0
+	for _, verb := range verbs {
+		expected += verb.args()
+	}
+	if expected != len(values.Elements) {
+		return []protocol.Diagnostic{diag(*node.Loc(), "format string reads %d values, but %d are given", expected, len(values.Elements))}
+	}
+
+	var diags []protocol.Diagnostic
+	i := 0
+	for _, verb := range verbs {
+		i += verb.args() - 1 // The * width and precision are read first
+		value := values.Elements[i].Expr
+		if message := checkFormatValue(verb, value); message != "" {
+			diags = append(diags, diag(*value.Loc(), "value #%d: %s", i+1, message))
+		}
+		i++
+	}
+	return diags
+}
+
+func analyzeFormatObject(node ast.Node, verbs []formatVerb, values *ast.DesugaredObject, diag formatDiagnostic) []protocol.Diagnostic {
+	fields := map[string]ast.Node{}
+	for _, field := range values.Fields {
+		name, ok := field.Name.(*ast.LiteralString)
+		if !ok {
+			// The field names can't be known without evaluating the object
+			fields = nil
+			break
+		}
+		fields[name.Value] = field.Body
+	}
+
+	var diags []protocol.Diagnostic
+	for _, verb := range verbs {
+		switch {
+		case !verb.hasKey:
+			return []protocol.Diagnostic{diag(*node.Loc(), "format string is given an object, but its %%%c verb has no mapping key", verb.conversion)}
+		case verb.widthStar || verb.precisionStar:
+			diags = append(diags, diag(*node.Loc(), "format string is given an object, but its %%(%s) verb reads its width or precision from the values", verb.key))
+		case fields == nil:
+			continue
+		}
+
+		value, ok := fields[verb.key]
+		if !ok {
+			diags = append(diags, diag(*node.Loc(), "format string reads field %q, but the object has no such field", verb.key))
+			continue
+		}
+		if message := checkFormatValue(verb, value); message != "" {
+			diags = append(diags, diag(*value.Loc(), "field %q: %s", verb.key, message))
+		}
+	}
+	return diags
+}
+
+// checkFormatValue returns why the value can't be formatted by the verb, if its type is known.
+func checkFormatValue(verb formatVerb, value ast.Node) string {
+	valueType := ""
+	switch value := value.(type) {
+	case *ast.LiteralString:
+		if verb.conversion == 'c' && len([]rune(value.Value)) == 1 {
+			return ""
+		}
+		valueType = "string"
+	case *ast.LiteralBoolean:
+		valueType = "boolean"
+	case *ast.LiteralNull:
+		valueType = "null"
+	case *ast.Array:
+		valueType = "array"
+	case *ast.DesugaredObject:
+		valueType = "object"
+	default:
+		return ""
+	}
+
+	switch {
+	case verb.conversion == 'c':
+		return fmt.Sprintf("%%c expects a number or a single character, got %s", valueType)
+	case strings.IndexByte("diouxXeEfFgG", verb.conversion) >= 0:
+		return fmt.Sprintf("%%%c expects a number, got %s", verb.conversion, valueType)
+	}
+	return ""
+}
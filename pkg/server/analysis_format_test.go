@@ -0,0 +1,104 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/google/go-jsonnet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnalyzeFormatString(t *testing.T) {
+	testCases := []struct {
+		name     string
+		document string
+		expected []string
+	}{
+		{
+			name:     "valid array",
+			document: `"%s is %d years old, 100%%" % ["Bob", 42]`,
+		},
+		{
+			name:     "valid single value",
+			document: `"hello %s" % "world"`,
+		},
+		{
+			name:     "valid object",
+			document: `"%(name)s is %(age)d" % { name: "Bob", age: 42 }`,
+		},
+		{
+			name:     "valid std.format",
+			document: `std.format("%05.2f", [1.5])`,
+		},
+		{
+			name:     "unknown values are not checked",
+			document: `local args = []; "%s %s" % args`,
+		},
+		{
+			name:     "too many values",
+			document: `"x %s" % ["y", "z"]`,
+			expected: []string{"format string reads 1 values, but 2 are given"},
+		},
+		{
+			name:     "not enough values",
+			document: `"x %s %s" % "y"`,
+			expected: []string{"format string reads 2 values, but 1 are given"},
+		},
+		{
+			name:     "star width reads a value",
+			document: `"%*d" % [3, 1]`,
+		},
+		{
+			name:     "wrong type",
+			document: `"x %d" % ["y"]`,
+			expected: []string{"value #1: %d expects a number, got string"},
+		},
+		{
+			name:     "wrong type with std.format",
+			document: `std.format("%s %c", ["a", "bc"])`,
+			expected: []string{"value #2: %c expects a number or a single character, got string"},
+		},
+		{
+			name:     "missing field",
+			document: `"%(a)s %(b)s" % { a: "y" }`,
+			expected: []string{`format string reads field "b", but the object has no such field`},
+		},
+		{
+			name:     "wrong field type",
+			document: `"%(a)x" % { a: true }`,
+			expected: []string{`field "a": %x expects a number, got boolean`},
+		},
+		{
+			name:     "positional verb with object",
+			document: `"%s" % { a: "y" }`,
+			expected: []string{"format string is given an object, but its %s verb has no mapping key"},
+		},
+		{
+			name:     "unrecognised conversion",
+			document: `"%y" % ["a"]`,
+			expected: []string{"invalid format string: unrecognised conversion type: y"},
+		},
+		{
+			name:     "truncated",
+			document: `"%(a" % { a: 1 }`,
+			expected: []string{"invalid format string: truncated format code"},
+		},
+		{
+			name:     "modulo of numbers",
+			document: `10 % 3`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			root, err := jsonnet.SnippetToAST("test.jsonnet", tc.document)
+			require.NoError(t, err)
+
+			var messages []string
+			for _, diag := range getAnalysisDiags(&document{ast: root}) {
+				assert.Equal(t, formatDiagnosticCode, diag.Code)
+				messages = append(messages, diag.Message)
+			}
+			assert.Equal(t, tc.expected, messages)
+		})
+	}
+}
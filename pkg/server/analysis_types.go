@@ -0,0 +1,226 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-jsonnet"
+	"github.com/google/go-jsonnet/ast"
+	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+)
+
+const typeMismatchDiagnosticCode = "type-mismatch"
+
+// typeAnnotationRegexp matches the type annotations in the comments right above a function:
+//
+//	// @param replicas number
+//	// @param labels object|null
+//	// @returns object
+var typeAnnotationRegexp = regexp.MustCompile(`^\s*(?://|#)\s*@(param\s+(\w+)|returns)\s+([\w|]+)`)
+
+// annotationTypes are the types that can be checked. Annotations with other types are ignored.
+var annotationTypes = map[string]bool{
+	"any": true, "array": true, "boolean": true, "function": true, "null": true, "number": true, "object": true, "string": true,
+}
+
+type functionAnnotations struct {
+	params  map[ast.Identifier]string
+	returns string
+}
+
+// parseTypeAnnotations reads the annotations in the comment lines right above the given line (1-based).
+func parseTypeAnnotations(lines []string, line int) *functionAnnotations {
+	var annotations *functionAnnotations
+	for i := line - 2; i >= 0 && i < len(lines); i-- {
+		text := strings.TrimSpace(lines[i])
+		if text == "local" {
+			// The function is the first bind of a multi-line local
+			continue
+		}
+		if !strings.HasPrefix(text, "//") && !strings.HasPrefix(text, "#") {
+			break
+		}
+
+		match := typeAnnotationRegexp.FindStringSubmatch(text)
+		if match == nil {
+			continue
+		}
+		if annotations == nil {
+			annotations = &functionAnnotations{params: map[ast.Identifier]string{}}
+		}
+		if match[2] != "" {
+			annotations.params[ast.Identifier(match[2])] = match[3]
+		} else {
+			annotations.returns = match[3]
+		}
+	}
+	return annotations
+}
+
+// typeMatches returns false if the type can't be one of the annotated types.
+// Unknown types, on either side, always match.
+func typeMatches(annotated, actual string) bool {
+	if actual == "" {
+		return true
+	}
+	for _, t := range strings.Split(annotated, "|") {
+		if t == "any" || t == actual || !annotationTypes[t] {
+			return true
+		}
+	}
+	return false
+}
+
+// typeChecker checks the arguments given to annotated functions.
+type typeChecker struct {
+	server   *Server
+	vm       *jsonnet.VM
+	filename string
+	lines    map[string][]string
+
+	inferenceSteps int
+}
+
+// findTypeMismatches reports the arguments whose type doesn't match the annotation of the function's parameter.
+// Only the arguments whose type is known statically (literals, and calls to functions with a @returns annotation) are checked.
+func (s *Server) findTypeMismatches(ctx context.Context, doc *document) []protocol.Diagnostic {
+	if doc.ast == nil || len(doc.linesChangedSinceAST) > 0 {
+		return nil
+	}
+
+	filename := doc.item.URI.SpanURI().Filename()
+	checker := &typeChecker{
+		server:   s,
+		vm:       s.getCancellableVM(ctx, filename),
+		filename: filename,
+		lines:    map[string][]string{},
+	}
+
+	var diags []protocol.Diagnostic
+	walkWithScope(doc.ast, varScope{}, func(node ast.Node, scope varScope) {
+		if apply, ok := node.(*ast.Apply); ok {
+			diags = append(diags, checker.checkCall(apply, scope)...)
+		}
+	})
+	return diags
+}
+
+func (c *typeChecker) checkCall(apply *ast.Apply, scope varScope) []protocol.Diagnostic {
+	fn, name, annotations := c.annotatedFunction(apply.Target, scope)
+	if annotations == nil {
+		return nil
+	}
+
+	var diags []protocol.Diagnostic
+	check := func(param ast.Identifier, arg ast.Node) {
+		annotated, ok := annotations.params[param]
+		if !ok {
+			return
+		}
+		if actual := c.staticType(arg, scope); !typeMatches(annotated, actual) {
+			diags = append(diags, protocol.Diagnostic{
+				Range:    position.RangeASTToProtocol(*arg.Loc()),
+				Severity: protocol.SeverityWarning,
+				Code:     typeMismatchDiagnosticCode,
+				Source:   "lint",
+				Message:  fmt.Sprintf("argument %s of %s should be %s, got %s", param, name, annotated, actual),
+			})
+		}
+	}
+	for i, arg := range apply.Arguments.Positional {
+		if i < len(fn.Parameters) {
+			check(fn.Parameters[i].Name, arg.Expr)
+		}
+	}
+	for _, arg := range apply.Arguments.Named {
+		check(arg.Name, arg.Arg)
+	}
+	return diags
+}
+
+// annotatedFunction returns the function called by a call, with its annotations, if it can be found statically.
+func (c *typeChecker) annotatedFunction(target ast.Node, scope varScope) (*ast.Function, string, *functionAnnotations) {
+	switch target := target.(type) {
+	case *ast.Var:
+		fn, ok := scope[target.Id].(*ast.Function)
+		if !ok {
+			return nil, "", nil
+		}
+		return fn, string(target.Id), c.annotations(fn.LocRange.FileName, fn.LocRange.Begin.Line)
+	case *ast.Index:
+		name, ok := target.Index.(*ast.LiteralString)
+		if !ok {
+			return nil, "", nil
+		}
+		object := c.knownObject(target.Target, scope)
+		if object == nil {
+			return nil, "", nil
+		}
+		for _, field := range object.Fields {
+			if fieldName, ok := field.Name.(*ast.LiteralString); ok && fieldName.Value == name.Value {
+				fn, ok := field.Body.(*ast.Function)
+				if !ok {
+					return nil, "", nil
+				}
+				return fn, name.Value, c.annotations(field.LocRange.FileName, field.LocRange.Begin.Line)
+			}
+		}
+	}
+	return nil, "", nil
+}
+
+func (c *typeChecker) knownObject(node ast.Node, scope varScope) *ast.DesugaredObject {
+	if v, ok := node.(*ast.Var); ok {
+		node = scope[v.Id]
+	}
+	return knownObject(node, c.vm, c.filename)
+}
+
+func (c *typeChecker) annotations(filename string, line int) *functionAnnotations {
+	if filename == "" {
+		return nil
+	}
+	lines, ok := c.lines[filename]
+	if !ok {
+		if text, err := c.server.documentText(protocol.URIFromPath(filename)); err == nil {
+			lines = strings.Split(text, "\n")
+		}
+		c.lines[filename] = lines
+	}
+	return parseTypeAnnotations(lines, line)
+}
+
+// staticType returns the type of a node if it can be known without evaluating it, otherwise an empty string.
+func (c *typeChecker) staticType(node ast.Node, scope varScope) string {
+	switch node := node.(type) {
+	case *ast.LiteralString:
+		return "string"
+	case *ast.LiteralNumber:
+		return "number"
+	case *ast.LiteralBoolean:
+		return "boolean"
+	case *ast.LiteralNull:
+		return "null"
+	case *ast.Array:
+		return "array"
+	case *ast.DesugaredObject:
+		return "object"
+	case *ast.Function:
+		return "function"
+	case *ast.Var:
+		// The value of the local is in another scope, only its literal type can be known
+		switch bound := scope[node.Id].(type) {
+		case *ast.Var, *ast.Apply:
+		default:
+			return c.staticType(bound, scope)
+		}
+	case *ast.Apply:
+		if _, _, annotations := c.annotatedFunction(node.Target, scope); annotations != nil && annotationTypes[annotations.returns] && annotations.returns != "any" {
+			return annotations.returns
+		}
+	}
+	return ""
+}
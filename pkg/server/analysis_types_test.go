@@ -0,0 +1,118 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindTypeMismatches(t *testing.T) {
+	testCases := []struct {
+		name     string
+		document string
+		expected []string
+	}{
+		{
+			name: "matching types",
+			document: `// @param name string
+// @param replicas number
+local deployment(name, replicas) = { name: name, replicas: replicas };
+deployment('app', 3)`,
+		},
+		{
+			name: "mismatched positional argument",
+			document: `// @param name string
+// @param replicas number
+local deployment(name, replicas) = { name: name, replicas: replicas };
+deployment('app', '3')`,
+			expected: []string{"argument replicas of deployment should be number, got string"},
+		},
+		{
+			name: "mismatched named argument",
+			document: `// @param replicas number
+local deployment(name, replicas=1) = { name: name, replicas: replicas };
+deployment('app', replicas=true)`,
+			expected: []string{"argument replicas of deployment should be number, got boolean"},
+		},
+		{
+			name: "union",
+			document: `// @param labels object|null
+local withLabels(labels) = { labels: labels };
+[withLabels(null), withLabels({}), withLabels([])]`,
+			expected: []string{"argument labels of withLabels should be object|null, got array"},
+		},
+		{
+			name: "unannotated functions are not checked",
+			document: `local deployment(name, replicas) = { name: name, replicas: replicas };
+deployment('app', '3')`,
+		},
+		{
+			name: "unknown annotated types are not checked",
+			document: `// @param container Container
+local withContainer(container) = { container: container };
+withContainer('nginx')`,
+		},
+		{
+			name: "arguments of unknown type are not checked",
+			document: `// @param replicas number
+local deployment(replicas) = { replicas: replicas };
+function(replicas) deployment(replicas)`,
+		},
+		{
+			name: "literal bound to a local",
+			document: `// @param replicas number
+local deployment(replicas) = { replicas: replicas };
+local replicas = 'three';
+deployment(replicas)`,
+			expected: []string{"argument replicas of deployment should be number, got string"},
+		},
+		{
+			name: "returned type",
+			document: `// @returns string
+local name() = 'app';
+// @param replicas number
+local deployment(replicas) = { replicas: replicas };
+deployment(name())`,
+			expected: []string{"argument replicas of deployment should be number, got string"},
+		},
+		{
+			name: "method of an object",
+			document: `local lib = {
+  // @param replicas number
+  new(replicas):: { replicas: replicas },
+};
+lib.new('3')`,
+			expected: []string{"argument replicas of new should be number, got string"},
+		},
+		{
+			name: "method of an imported object",
+			document: `local lib = import 'lib.libsonnet';
+lib.new('3')`,
+			expected: []string{"argument replicas of new should be number, got string"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			lib := "{\n  # @param replicas number\n  new(replicas):: { replicas: replicas },\n}"
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "lib.libsonnet"), []byte(lib), 0o600))
+			file := filepath.Join(dir, "main.jsonnet")
+			require.NoError(t, os.WriteFile(file, []byte(tc.document), 0o600))
+
+			server := testServer(t, nil)
+			doc, err := server.cache.get(serverOpenTestFile(t, server, file))
+			require.NoError(t, err)
+
+			var messages []string
+			for _, diag := range server.findTypeMismatches(context.Background(), doc) {
+				assert.Equal(t, typeMismatchDiagnosticCode, diag.Code)
+				messages = append(messages, diag.Message)
+			}
+			assert.Equal(t, tc.expected, messages)
+		})
+	}
+}
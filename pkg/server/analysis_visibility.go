@@ -0,0 +1,125 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/google/go-jsonnet/ast"
+	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+)
+
+const hiddenFieldDiagnosticCode = "hidden-field"
+
+// manifestingFunctions are the std functions that leave the hidden fields of their object argument out.
+var manifestingFunctions = map[string]bool{
+	"objectFields":         true,
+	"objectValues":         true,
+	"objectKeysValues":     true,
+	"manifestJson":         true,
+	"manifestJsonEx":       true,
+	"manifestJsonMinified": true,
+	"manifestYamlDoc":      true,
+	"manifestTomlEx":       true,
+	"toString":             true,
+}
+
+// fieldVisibility describes the separator of a field: `:` inherits the visibility of the field it overrides, `::`
+// hides the field from the output, and `:::` shows it even if it overrides a hidden field.
+func fieldVisibility(hide ast.ObjectFieldHide) (separator, description string) {
+	switch hide {
+	case ast.ObjectFieldHidden:
+		return "::", "hidden, it is not in the output"
+	case ast.ObjectFieldVisible:
+		return ":::", "forced visible, it is in the output even if it overrides a hidden field"
+	default:
+		return ":", "visible, unless it overrides a hidden field"
+	}
+}
+
+// visibilitySymbolDetail is what the details of the document symbols of fields add for their visibility. Visible
+// fields, the default, add nothing.
+func visibilitySymbolDetail(hide ast.ObjectFieldHide) string {
+	switch hide {
+	case ast.ObjectFieldHidden:
+		return "hidden (::)"
+	case ast.ObjectFieldVisible:
+		return "forced visible (:::)"
+	}
+	return ""
+}
+
+// fieldVisibilityHover is the hover line of the visibility of the field that starts at the position, if there is one.
+func (s *Server) fieldVisibilityHover(uri protocol.DocumentURI, start protocol.Position) string {
+	filename := uri.SpanURI().Filename()
+	var root ast.Node
+	if doc, err := s.cache.get(protocol.URIFromPath(filename)); err == nil {
+		root = doc.ast
+	} else if content, err := os.ReadFile(filename); err == nil {
+		root, _ = snippetToAST(filename, string(content))
+	}
+
+	begin := position.ProtocolToAST(start)
+	hover := ""
+	walk(root, func(node ast.Node) {
+		object, ok := node.(*ast.DesugaredObject)
+		if !ok || hover != "" {
+			return
+		}
+		for _, field := range object.Fields {
+			if field.LocRange.FileName == filename && field.LocRange.Begin == begin {
+				separator, description := fieldVisibility(field.Hide)
+				hover = fmt.Sprintf("Visibility: `%s` %s", separator, description)
+				return
+			}
+		}
+	})
+	return hover
+}
+
+// findHiddenFieldUses reports the objects known statically whose hidden fields are left out by the std function they
+// are given to, such as std.objectFields and std.manifestJson.
+func (s *Server) findHiddenFieldUses(ctx context.Context, doc *document) []protocol.Diagnostic {
+	if doc.ast == nil || len(doc.linesChangedSinceAST) > 0 {
+		return nil
+	}
+
+	filename := doc.item.URI.SpanURI().Filename()
+	checker := &typeChecker{
+		server:   s,
+		vm:       s.getCancellableVM(ctx, filename),
+		filename: filename,
+		lines:    map[string][]string{},
+	}
+
+	var diags []protocol.Diagnostic
+	walkWithScope(doc.ast, varScope{}, func(node ast.Node, scope varScope) {
+		name, args, ok := stdCall(node)
+		if !ok || !manifestingFunctions[name] || len(args) == 0 {
+			return
+		}
+		object := checker.knownObject(args[0], scope)
+		if object == nil {
+			return
+		}
+		var hidden []string
+		for _, field := range object.Fields {
+			if fieldName, ok := staticString(field.Name, scope, 0); ok && field.Hide == ast.ObjectFieldHidden {
+				hidden = append(hidden, fieldName)
+			}
+		}
+		if len(hidden) == 0 {
+			return
+		}
+		diags = append(diags, protocol.Diagnostic{
+			Range:    position.RangeASTToProtocol(*args[0].Loc()),
+			Severity: protocol.SeverityInformation,
+			Code:     hiddenFieldDiagnosticCode,
+			Source:   "lint",
+			Message:  fmt.Sprintf("std.%s leaves out the hidden (::) fields %s", name, strings.Join(hidden, ", ")),
+		})
+	})
+	return diags
+}
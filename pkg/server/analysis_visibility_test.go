@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-jsonnet"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindHiddenFieldUses(t *testing.T) {
+	testCases := []struct {
+		name     string
+		document string
+		expected []string
+	}{
+		{
+			name:     "no hidden fields",
+			document: `std.objectFields({ a: 1, b::: 2 })`,
+		},
+		{
+			name:     "unknown objects are not checked",
+			document: `function(o) std.objectFields(o)`,
+		},
+		{
+			name:     "functions that include the hidden fields",
+			document: `local o = { a:: 1 }; [std.objectFieldsAll(o), std.objectHasAll(o, 'a')]`,
+		},
+		{
+			name: "manifested objects",
+			document: `local config = { name: 'app', secret:: 'x', ['to' + 'ken']:: 'y' };
+local lib = import 'lib.libsonnet';
+[std.manifestJson(config), std.objectFields(lib), std.toString({ a:: 1 })]`,
+			expected: []string{
+				"2:18-2:24 hidden-field: std.manifestJson leaves out the hidden (::) fields secret, token",
+				"2:44-2:47 hidden-field: std.objectFields leaves out the hidden (::) fields helper",
+				"2:63-2:72 hidden-field: std.toString leaves out the hidden (::) fields a",
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "lib.libsonnet"), []byte("{ helper(x):: x, value: 1 }"), 0o600))
+			file := filepath.Join(dir, "main.jsonnet")
+			require.NoError(t, os.WriteFile(file, []byte(tc.document), 0o600))
+
+			server := testServer(t, nil)
+			doc, err := server.cache.get(serverOpenTestFile(t, server, file))
+			require.NoError(t, err)
+
+			var found []string
+			for _, diag := range server.findHiddenFieldUses(context.Background(), doc) {
+				assert.Equal(t, protocol.SeverityInformation, diag.Severity)
+				found = append(found, fmt.Sprintf("%d:%d-%d:%d %s: %s", diag.Range.Start.Line, diag.Range.Start.Character, diag.Range.End.Line, diag.Range.End.Character, diag.Code, diag.Message))
+			}
+			assert.Equal(t, tc.expected, found)
+		})
+	}
+}
+
+func TestFieldVisibility_Hover(t *testing.T) {
+	testCases := []struct {
+		name      string
+		character uint32
+		expected  string
+	}{
+		{name: "visible", character: 3, expected: "Visibility: `:` visible, unless it overrides a hidden field"},
+		{name: "hidden", character: 8, expected: "Visibility: `::` hidden, it is not in the output"},
+		{name: "forced visible", character: 13, expected: "Visibility: `:::` forced visible, it is in the output even if it overrides a hidden field"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s, uri := testServerWithFile(t, nil, "local o = { a: 1, b:: 2, c::: 3 };\n[o.a, o.b, o.c]")
+			hover, err := s.Hover(context.Background(), &protocol.HoverParams{
+				TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+					TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+					Position:     protocol.Position{Line: 1, Character: tc.character},
+				},
+			})
+			require.NoError(t, err)
+			require.NotNil(t, hover)
+			assert.Contains(t, hover.Contents.Value, "\n"+tc.expected+"\n")
+		})
+	}
+}
+
+func TestFieldVisibility_DocumentSymbols(t *testing.T) {
+	root, err := jsonnet.SnippetToAST("test.jsonnet", "{ a: 'x', b:: 'y', c::: {}, d:: self.a }")
+	require.NoError(t, err)
+
+	details := map[string]string{}
+	for _, symbol := range buildDocumentSymbols(root) {
+		details[symbol.Name] = symbol.Detail
+	}
+	assert.Equal(t, map[string]string{
+		"a": "String",
+		"b": "String, hidden (::)",
+		"c": "Object, forced visible (:::)",
+		"d": "hidden (::)",
+	}, details)
+}
@@ -0,0 +1,213 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-jsonnet/ast"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+)
+
+// bundledFile is a file that a bundle inlines: a file that is imported, imported as a string or imported as bytes.
+type bundledFile struct {
+	kind    string
+	foundAt string
+	// value is the text of a file that is imported, or the literal of the string or the bytes of the others
+	value string
+	// imports are the files that a file imports, by the location of the imports that are replaced
+	imports map[ast.LocationRange]*bundledFile
+	// imported is whether another file imports the file, the entrypoint is only a local of the bundle if it is
+	imported bool
+	name     string
+}
+
+// bundle handles the jsonnet.bundle command, whose argument is the file's name. It returns a single file that
+// evaluates like the file, without the files it imports: each of the files it imports, transitively, is a local of
+// the bundle, that the imports are replaced with. The files aren't evaluated.
+func (s *Server) bundle(_ context.Context, params *protocol.ExecuteCommandParams) (interface{}, error) {
+	args := params.Arguments
+	if len(args) != 1 {
+		return nil, fmt.Errorf("expected 1 argument, got %d", len(args))
+	}
+	var fileName string
+	if err := json.Unmarshal(args[0], &fileName); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal file name: %v", err)
+	}
+	return s.bundleFile(fileName)
+}
+
+// bundleFile inlines the files that a file imports, the open documents as they are edited. The imports are resolved
+// with the importer of the file, like the evaluation of the file resolves them.
+func (s *Server) bundleFile(fileName string) (string, error) {
+	config := s.configurationFor(fileName)
+	importer := s.getImporter(config, fileName, s.projectSettings(config, fileName))
+
+	entrypoint := &bundledFile{kind: "import", foundAt: fileName, value: s.readWorkspaceFile(fileName)}
+	files := []*bundledFile{entrypoint}
+	byKey := map[string]*bundledFile{"import " + fileName: entrypoint}
+	for i := 0; i < len(files); i++ {
+		file := files[i]
+		if file.kind != "import" {
+			continue
+		}
+		root, err := snippetToAST(file.foundAt, file.value)
+		if err != nil {
+			return "", fmt.Errorf("unable to bundle %s: %s doesn't parse: %w", fileName, file.foundAt, err)
+		}
+		file.imports = map[ast.LocationRange]*bundledFile{}
+		// The files are inlined in the order they are imported in
+		var imports []ast.Node
+		walk(root, func(node ast.Node) {
+			switch node.(type) {
+			case *ast.Import, *ast.ImportStr, *ast.ImportBin:
+				imports = append(imports, node)
+			}
+		})
+		sort.Slice(imports, func(i, j int) bool {
+			a, b := imports[i].Loc().Begin, imports[j].Loc().Begin
+			return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+		})
+		for _, node := range imports {
+			var kind string
+			var literal *ast.LiteralString
+			switch node := node.(type) {
+			case *ast.Import:
+				kind, literal = "import", node.File
+			case *ast.ImportStr:
+				kind, literal = "importstr", node.File
+			case *ast.ImportBin:
+				kind, literal = "importbin", node.File
+			}
+			contents, foundAt, err := importer.Import(file.foundAt, literal.Value)
+			if err != nil {
+				return "", fmt.Errorf("unable to bundle %s: %s imports %s, which can't be imported: %w", fileName, file.foundAt, literal.Value, err)
+			}
+			if abs, err := filepath.Abs(foundAt); err == nil {
+				foundAt = abs
+			}
+			key := kind + " " + foundAt
+			imported, ok := byKey[key]
+			if !ok {
+				imported = &bundledFile{kind: kind, foundAt: foundAt}
+				switch kind {
+				case "import":
+					imported.value = s.readWorkspaceFile(foundAt)
+				case "importstr":
+					imported.value = jsonnetString(contents.String())
+				case "importbin":
+					imported.value = jsonnetBytes(contents.Data())
+				}
+				byKey[key] = imported
+				files = append(files, imported)
+			}
+			imported.imported = true
+			file.imports[*node.Loc()] = imported
+		}
+	}
+	if len(files) == 1 {
+		return entrypoint.value, nil
+	}
+
+	prefix := bundleLocalPrefix(files)
+	for i, file := range files {
+		file.name = prefix + strconv.Itoa(i)
+	}
+
+	var builder strings.Builder
+	if len(files) == 2 {
+		fmt.Fprintf(&builder, "// %s, bundled with the file it imports\n", filepath.Base(fileName))
+	} else {
+		fmt.Fprintf(&builder, "// %s, bundled with the %d files it imports\n", filepath.Base(fileName), len(files)-1)
+	}
+	builder.WriteString("local")
+	separator := "\n"
+	for _, file := range files {
+		if file == entrypoint && !entrypoint.imported {
+			continue
+		}
+		fmt.Fprintf(&builder, "%s  // %s %s\n", separator, file.kind, bundleFileName(fileName, file.foundAt))
+		separator = ",\n"
+		if file.kind != "import" {
+			fmt.Fprintf(&builder, "  %s = %s", file.name, file.value)
+			continue
+		}
+		// The file's text is on lines of its own, a comment that ends it doesn't hide what follows
+		fmt.Fprintf(&builder, "  %s = (\n%s\n  )", file.name, strings.TrimRight(file.rewrittenText(), "\n"))
+	}
+	builder.WriteString(";\n")
+	if entrypoint.imported {
+		builder.WriteString(entrypoint.name + "\n")
+	} else {
+		builder.WriteString(entrypoint.rewrittenText())
+	}
+	return builder.String(), nil
+}
+
+// rewrittenText returns the text of a file whose imports are replaced with the locals of the files they import.
+func (f *bundledFile) rewrittenText() string {
+	locations := make([]ast.LocationRange, 0, len(f.imports))
+	for location := range f.imports {
+		locations = append(locations, location)
+	}
+	sort.Slice(locations, func(i, j int) bool {
+		a, b := locations[i].Begin, locations[j].Begin
+		return a.Line > b.Line || (a.Line == b.Line && a.Column > b.Column)
+	})
+	text := f.value
+	for _, location := range locations {
+		start, end := locationOffset(text, location.Begin), locationOffset(text, location.End)
+		text = text[:start] + f.imports[location].name + text[end:]
+	}
+	return text
+}
+
+// bundleLocalPrefix returns the prefix of the names of the locals of a bundle, that none of the files has in its
+// text, so that the locals don't hide the variables of the files, nor are hidden by them.
+func bundleLocalPrefix(files []*bundledFile) string {
+	prefix := "bundled_"
+	for {
+		found := false
+		for _, file := range files {
+			if file.kind == "import" && strings.Contains(file.value, prefix) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return prefix
+		}
+		prefix = "_" + prefix
+	}
+}
+
+// bundleFileName returns the name of a bundled file, relative to the entrypoint's directory when it is in it, for the
+// comments of the bundle to not give away the paths of the machine it was bundled on.
+func bundleFileName(entrypoint, path string) string {
+	if rel, err := filepath.Rel(filepath.Dir(entrypoint), path); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(rel)
+	}
+	return filepath.Base(path)
+}
+
+// jsonnetString returns the Jsonnet string literal of a text. The JSON strings are Jsonnet strings.
+func jsonnetString(text string) string {
+	var quoted strings.Builder
+	encoder := json.NewEncoder(&quoted)
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode(text)
+	return strings.TrimSuffix(quoted.String(), "\n")
+}
+
+// jsonnetBytes returns the Jsonnet array of the bytes of a file, like importbin evaluates to.
+func jsonnetBytes(data []byte) string {
+	elements := make([]string, len(data))
+	for i, b := range data {
+		elements[i] = strconv.Itoa(int(b))
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
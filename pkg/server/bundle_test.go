@@ -0,0 +1,116 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-jsonnet"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBundle(t *testing.T) {
+	testCases := []struct {
+		name        string
+		files       map[string]string
+		expected    string
+		expectedErr string
+	}{
+		{
+			name: "no imports",
+			files: map[string]string{
+				"main.jsonnet": "{ a: 1 }",
+			},
+			expected: "{ a: 1 }",
+		},
+		{
+			name: "transitive imports",
+			files: map[string]string{
+				"main.jsonnet":            "local k = import 'lib/k.libsonnet';\nlocal config = import 'config.libsonnet';\n{ k: k, config: config } // end",
+				"lib/k.libsonnet":         "local util = import '../util.libsonnet';\n{ name: util.name, motd: importstr 'motd.txt' }",
+				"util.libsonnet":          "{ name: 'util', bytes: importbin 'lib/motd.txt' }  // no newline",
+				"config.libsonnet":        "(import 'util.libsonnet') + { local bundled_0 = 1, extra: bundled_0 }",
+				"lib/motd.txt":            "hi \"there\"\n",
+				"vendor/unused.libsonnet": "{}",
+			},
+			expected: `// main.jsonnet, bundled with the 5 files it imports
+local
+  // import lib/k.libsonnet
+  _bundled_1 = (
+local util = _bundled_3;
+{ name: util.name, motd: _bundled_4 }
+  ),
+  // import config.libsonnet
+  _bundled_2 = (
+(_bundled_3) + { local bundled_0 = 1, extra: bundled_0 }
+  ),
+  // import util.libsonnet
+  _bundled_3 = (
+{ name: 'util', bytes: _bundled_5 }  // no newline
+  ),
+  // importstr lib/motd.txt
+  _bundled_4 = "hi \"there\"\n",
+  // importbin lib/motd.txt
+  _bundled_5 = [104, 105, 32, 34, 116, 104, 101, 114, 101, 34, 10];
+local k = _bundled_1;
+local config = _bundled_2;
+{ k: k, config: config } // end`,
+		},
+		{
+			name: "imported entrypoint",
+			files: map[string]string{
+				"main.jsonnet": "{ a: 1, b: (import 'b.libsonnet').b }",
+				"b.libsonnet":  "{ b: (import 'main.jsonnet').a + 1 }",
+			},
+			expected: `// main.jsonnet, bundled with the file it imports
+local
+  // import main.jsonnet
+  bundled_0 = (
+{ a: 1, b: (bundled_1).b }
+  ),
+  // import b.libsonnet
+  bundled_1 = (
+{ b: (bundled_0).a + 1 }
+  );
+bundled_0
+`,
+		},
+		{
+			name: "missing import",
+			files: map[string]string{
+				"main.jsonnet": "import 'missing.libsonnet'",
+			},
+			expectedErr: "main.jsonnet imports missing.libsonnet, which can't be imported",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			root := writeProjectFiles(t, tc.files)
+			s := renameTestServer(t, root, nil)
+			main := filepath.Join(root, "main.jsonnet")
+			args, err := json.Marshal(main)
+			require.NoError(t, err)
+			result, err := s.ExecuteCommand(context.Background(), &protocol.ExecuteCommandParams{
+				Command:   "jsonnet.bundle",
+				Arguments: []json.RawMessage{args},
+			})
+			if tc.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, result)
+
+			// The bundle evaluates like the file, without the files it imports
+			expected, err := jsonnet.MakeVM().EvaluateFile(main)
+			require.NoError(t, err)
+			output, err := jsonnet.MakeVM().EvaluateAnonymousSnippet(filepath.Join(t.TempDir(), "bundle.jsonnet"), result.(string))
+			require.NoError(t, err)
+			assert.JSONEq(t, expected, output)
+		})
+	}
+}
@@ -18,6 +18,17 @@ type document struct {
 	// Contains the last successfully parsed AST. If doc.err is not nil, it's out of date.
 	ast                  ast.Node
 	linesChangedSinceAST map[int]bool
+	// astText is the text the AST was parsed from. When the AST is recovered from a document with a syntax error, it
+	// is the text without the lines that changed.
+	astText string
+	// recovered is set when the AST was parsed from the text without the changed lines, its positions are the ones of
+	// the text even though the text doesn't parse
+	recovered bool
+	// astVersion is the version of the document the AST was parsed from
+	astVersion int32
+
+	// skipped is why the document isn't parsed nor evaluated, when it is too large or binary
+	skipped string
 
 	// From diagnostics
 	val         string
@@ -25,6 +36,12 @@ type document struct {
 	diagnostics []protocol.Diagnostic
 }
 
+// stale reports whether the AST is the last known good one, of a previous version of the document that parsed. Its
+// positions are the ones of astText, they are mapped to the current text with a lineMap.
+func (d *document) stale() bool {
+	return d.ast != nil && d.astVersion != d.item.Version
+}
+
 // newCache returns a document cache.
 func newCache() *cache {
 	return &cache{
@@ -41,7 +58,7 @@ type cache struct {
 
 	diagMutex   sync.RWMutex
 	diagQueue   map[protocol.DocumentURI]struct{}
-	diagRunning sync.Map
+	diagRunning sync.Map // context.CancelFunc of the diagnostics being computed, by document
 }
 
 // put adds or replaces a document in the cache.
@@ -73,6 +90,18 @@ func (c *cache) get(uri protocol.DocumentURI) (*document, error) {
 	return doc, nil
 }
 
+// list returns all the documents in the cache.
+func (c *cache) list() []*document {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	docs := make([]*document, 0, len(c.docs))
+	for _, doc := range c.docs {
+		docs = append(docs, doc)
+	}
+	return docs
+}
+
 func (c *cache) getContents(uri protocol.DocumentURI, position protocol.Range) (string, error) {
 	text := ""
 	doc, err := c.get(uri)
@@ -0,0 +1,201 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/google/go-jsonnet/ast"
+	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// functionDefinition is a local or a field whose value is a function.
+type functionDefinition struct {
+	function *ast.Function
+	symbol   protocol.DocumentSymbol
+}
+
+// PrepareCallHierarchy returns the function whose name is under the cursor: a local function, or a method of an
+// object.
+func (s *Server) PrepareCallHierarchy(ctx context.Context, params *protocol.CallHierarchyPrepareParams) ([]protocol.CallHierarchyItem, error) {
+	items, err := onLatestDocument(s, "PrepareCallHierarchy", params.TextDocument.URI, func(doc *document) ([]protocol.CallHierarchyItem, error) {
+		if doc.ast == nil || doc.linesChangedSinceAST[int(params.Position.Line)] {
+			return nil, nil
+		}
+		for _, definition := range functionDefinitions(doc.ast) {
+			// The names of the locals and fields are on a single line
+			name, pos := definition.symbol.SelectionRange, params.Position
+			if pos.Line == name.Start.Line && pos.Character >= name.Start.Character && pos.Character <= name.End.Character {
+				return []protocol.CallHierarchyItem{callHierarchyItem(doc.item.URI, definition)}, nil
+			}
+		}
+		return nil, nil
+	})
+	if errors.Is(err, errContentModified) {
+		return nil, err
+	}
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Errorf("PrepareCallHierarchy: error finding function")
+	}
+	return items, nil
+}
+
+// OutgoingCalls returns the functions that a function calls. The callees are resolved through the chains of locals
+// and of the fields of objects and imports, like `d.new()` after `local d = k.apps.v1.deployment;`. The calls of
+// functions that can't be resolved statically, like parameters, are left out.
+func (s *Server) OutgoingCalls(ctx context.Context, params *protocol.CallHierarchyOutgoingCallsParams) ([]protocol.CallHierarchyOutgoingCall, error) {
+	filename := params.Item.URI.SpanURI().Filename()
+	root := s.workspaceFileAST(filename)
+	if root == nil {
+		return nil, nil
+	}
+
+	var caller *ast.Function
+	for _, definition := range functionDefinitions(root) {
+		if definition.symbol.SelectionRange == params.Item.SelectionRange {
+			caller = definition.function
+		}
+	}
+	if caller == nil {
+		return nil, nil
+	}
+
+	checker := &typeChecker{server: s, vm: s.getCancellableVM(ctx, filename), filename: filename}
+	calls := map[protocol.Location]*protocol.CallHierarchyOutgoingCall{}
+	walkWithScope(root, varScope{}, func(node ast.Node, scope varScope) {
+		if node != caller {
+			return
+		}
+		walkWithScope(caller, scope, func(node ast.Node, scope varScope) {
+			apply, ok := node.(*ast.Apply)
+			if !ok {
+				return
+			}
+			callee, definedIn := checker.calledFunction(apply.Target, scope, 0)
+			if callee == nil {
+				return
+			}
+			to, ok := checker.functionItem(root, callee, definedIn)
+			if !ok {
+				return
+			}
+			key := protocol.Location{URI: to.URI, Range: to.SelectionRange}
+			if calls[key] == nil {
+				calls[key] = &protocol.CallHierarchyOutgoingCall{To: to}
+			}
+			calls[key].FromRanges = append(calls[key].FromRanges, position.RangeASTToProtocol(*apply.Target.Loc()))
+		})
+	})
+
+	result := make([]protocol.CallHierarchyOutgoingCall, 0, len(calls))
+	for _, call := range calls {
+		result = append(result, *call)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i].FromRanges[0].Start, result[j].FromRanges[0].Start
+		return a.Line < b.Line || a.Line == b.Line && a.Character < b.Character
+	})
+	return result, nil
+}
+
+// calledFunction returns the function that the target of a call refers to, through the chains of locals, and of
+// fields of objects and imports, and the file that it is written in.
+func (c *typeChecker) calledFunction(node ast.Node, scope varScope, depth int) (*ast.Function, string) {
+	filename := c.filename
+	for ; node != nil && depth <= maxInferenceDepth; depth++ {
+		switch n := node.(type) {
+		case *ast.Parens:
+			node = n.Inner
+		case *ast.Var:
+			node = scope[n.Id]
+		case *ast.Index:
+			name, ok := n.Index.(*ast.LiteralString)
+			if !ok {
+				return nil, ""
+			}
+			object, objectScope := c.aliasedObject(n.Target, scope, depth+1)
+			if object != nil && object.Loc().FileName != "" {
+				filename = object.Loc().FileName
+			}
+			node, scope = objectField(object, objectScope, name.Value)
+		case *ast.Function:
+			return n, filename
+		default:
+			return nil, ""
+		}
+	}
+	return nil, ""
+}
+
+// functionItem returns the call hierarchy item of the local or field that a function is the value of. The functions
+// of the imported files are found in the ASTs that the VM imported, the methods don't have a location.
+func (c *typeChecker) functionItem(root ast.Node, function *ast.Function, filename string) (protocol.CallHierarchyItem, bool) {
+	if filename != c.filename {
+		var err error
+		if root, _, err = c.vm.ImportAST(c.filename, filename); err != nil {
+			return protocol.CallHierarchyItem{}, false
+		}
+	}
+	for _, definition := range functionDefinitions(root) {
+		if definition.function == function {
+			return callHierarchyItem(protocol.URIFromPath(filename), definition), true
+		}
+	}
+	return protocol.CallHierarchyItem{}, false
+}
+
+// workspaceFileAST returns the AST of a file, the open document's if it is open and parses.
+func (s *Server) workspaceFileAST(filename string) ast.Node {
+	if filename == "" {
+		return nil
+	}
+	if doc, err := s.cache.get(protocol.URIFromPath(filename)); err == nil && doc.ast != nil && len(doc.linesChangedSinceAST) == 0 {
+		return doc.ast
+	}
+	root, _ := parseDocument(filename, s.readWorkspaceFile(filename))
+	return root
+}
+
+// functionDefinitions returns the locals and fields of a file whose values are functions.
+func functionDefinitions(root ast.Node) []functionDefinition {
+	var definitions []functionDefinition
+	walk(root, func(node ast.Node) {
+		switch node := node.(type) {
+		case *ast.Local:
+			for i := range node.Binds {
+				bind := &node.Binds[i]
+				if function, ok := bind.Body.(*ast.Function); ok {
+					symbol := bindSymbol(bind)
+					symbol.Kind = protocol.Function
+					definitions = append(definitions, functionDefinition{function: function, symbol: symbol})
+				}
+			}
+		case *ast.DesugaredObject:
+			for i := range node.Fields {
+				field := &node.Fields[i]
+				if _, ok := field.Name.(*ast.LiteralString); !ok {
+					continue
+				}
+				if function, ok := field.Body.(*ast.Function); ok {
+					symbol := fieldSymbol(field)
+					symbol.Kind = protocol.Method
+					definitions = append(definitions, functionDefinition{function: function, symbol: symbol})
+				}
+			}
+		}
+	})
+	return definitions
+}
+
+func callHierarchyItem(uri protocol.DocumentURI, definition functionDefinition) protocol.CallHierarchyItem {
+	return protocol.CallHierarchyItem{
+		Name:           definition.symbol.Name,
+		Kind:           definition.symbol.Kind,
+		Detail:         definition.symbol.Detail,
+		URI:            uri,
+		Range:          definition.symbol.Range,
+		SelectionRange: definition.symbol.SelectionRange,
+	}
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const callHierarchyLibrary = `{
+  apps: {
+    v1: {
+      deployment: {
+        new(name):: { name: name },
+      },
+    },
+  },
+}
+`
+
+func TestOutgoingCalls(t *testing.T) {
+	type outgoingCall struct {
+		name, file string
+		from       []protocol.Range
+	}
+	testCases := []struct {
+		name     string
+		document string
+		// caller is on the name of the function whose calls are listed
+		caller   protocol.Position
+		expected []outgoingCall
+	}{
+		{
+			name:     "local function",
+			document: "local helper(x) = x;\nlocal f(x) = helper(x) + helper(1);\nf(1)\n",
+			caller:   protocol.Position{Line: 1, Character: 6},
+			expected: []outgoingCall{
+				{name: "helper", file: "main.jsonnet", from: []protocol.Range{makeRange(t, "1:13-1:19"), makeRange(t, "1:25-1:31")}},
+			},
+		},
+		{
+			name:     "through an intermediate local",
+			document: "local k = import 'k.libsonnet';\nlocal d = k.apps.v1.deployment;\nlocal f(x) = d.new(x);\nf(1)\n",
+			caller:   protocol.Position{Line: 2, Character: 6},
+			expected: []outgoingCall{
+				{name: "new", file: "lib/k.libsonnet", from: []protocol.Range{makeRange(t, "2:13-2:18")}},
+			},
+		},
+		{
+			name:     "through an alias of the function",
+			document: "local k = import 'k.libsonnet';\nlocal new = (k.apps.v1).deployment.new;\nlocal f(x) = new(x);\nf(1)\n",
+			caller:   protocol.Position{Line: 2, Character: 6},
+			expected: []outgoingCall{
+				{name: "new", file: "lib/k.libsonnet", from: []protocol.Range{makeRange(t, "2:13-2:16")}},
+			},
+		},
+		{
+			name:     "method of the same object",
+			document: "{\n  g():: 1,\n  f(x):: local h = self.g; h() + self.g(),\n}\n",
+			caller:   protocol.Position{Line: 2, Character: 2},
+			expected: []outgoingCall{
+				{name: "g", file: "main.jsonnet", from: []protocol.Range{makeRange(t, "2:27-2:28"), makeRange(t, "2:33-2:39")}},
+			},
+		},
+		{
+			name:     "parameters aren't resolved",
+			document: "local f(g) = g(1) + std.length([]);\nf(function(x) x)\n",
+			caller:   protocol.Position{Line: 0, Character: 6},
+			expected: nil,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			root := writeProjectFiles(t, map[string]string{
+				"main.jsonnet":    tc.document,
+				"lib/k.libsonnet": callHierarchyLibrary,
+			})
+			s := renameTestServer(t, root, nil)
+			uri := serverOpenTestFile(t, s, filepath.Join(root, "main.jsonnet"))
+
+			items, err := s.PrepareCallHierarchy(context.Background(), &protocol.CallHierarchyPrepareParams{
+				TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+					TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+					Position:     tc.caller,
+				},
+			})
+			require.NoError(t, err)
+			require.Len(t, items, 1)
+
+			calls, err := s.OutgoingCalls(context.Background(), &protocol.CallHierarchyOutgoingCallsParams{Item: items[0]})
+			require.NoError(t, err)
+			var actual []outgoingCall
+			for _, call := range calls {
+				rel, err := filepath.Rel(root, call.To.URI.SpanURI().Filename())
+				require.NoError(t, err)
+				actual = append(actual, outgoingCall{name: call.To.Name, file: filepath.ToSlash(rel), from: call.FromRanges})
+			}
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestPrepareCallHierarchy(t *testing.T) {
+	s, fileURI := testServerWithFile(t, nil, "local f(x) = x;\n{\n  g(y):: f(y),\n  h: 1,\n}\n")
+
+	prepare := func(pos protocol.Position) []protocol.CallHierarchyItem {
+		items, err := s.PrepareCallHierarchy(context.Background(), &protocol.CallHierarchyPrepareParams{
+			TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: fileURI},
+				Position:     pos,
+			},
+		})
+		require.NoError(t, err)
+		return items
+	}
+
+	items := prepare(protocol.Position{Line: 0, Character: 6})
+	require.Len(t, items, 1)
+	assert.Equal(t, "f", items[0].Name)
+	assert.Equal(t, protocol.Function, items[0].Kind)
+	assert.Equal(t, makeRange(t, "0:6-0:7"), items[0].SelectionRange)
+
+	items = prepare(protocol.Position{Line: 2, Character: 2})
+	require.Len(t, items, 1)
+	assert.Equal(t, "g", items[0].Name)
+	assert.Equal(t, protocol.Method, items[0].Kind)
+
+	// Fields that aren't functions aren't in the call hierarchy
+	assert.Empty(t, prepare(protocol.Position{Line: 3, Character: 2}))
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"context"
+	"strings"
+
+	"github.com/grafana/jsonnet-language-server/pkg/utils"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+)
+
+func (s *Server) CodeAction(ctx context.Context, params *protocol.CodeActionParams) ([]protocol.CodeAction, error) {
+	doc, err := s.cache.get(params.TextDocument.URI)
+	if err != nil {
+		return nil, utils.LogErrorf("CodeAction: %s: %w", errorRetrievingDocument, err)
+	}
+
+	var actions []protocol.CodeAction
+	if codeActionKindRequested(params.Context.Only, protocol.QuickFix) {
+		actions = append(actions, s.undefinedFieldCodeActions(ctx, doc, params.Context.Diagnostics)...)
+		actions = append(actions, s.unresolvedImportCodeActions(doc, params.Context.Diagnostics)...)
+		actions = append(actions, s.schemaCodeActions(doc, params.Context.Diagnostics)...)
+		actions = append(actions, s.styleCodeActions(doc, params.Context.Diagnostics)...)
+		actions = append(actions, s.deprecatedStdCodeActions(doc, params.Context.Diagnostics)...)
+		actions = append(actions, s.duplicateImportCodeActions(doc, params.Context.Diagnostics)...)
+		actions = append(actions, s.suppressionCodeActions(doc, params.Context.Diagnostics)...)
+		actions = append(actions, profileCodeActions(doc, params.Context.Diagnostics)...)
+	}
+	if codeActionKindRequested(params.Context.Only, protocol.RefactorRewrite) {
+		actions = append(actions, importAliasRenameCodeActions(doc, params.Range)...)
+	}
+	if codeActionKindRequested(params.Context.Only, protocol.Source) {
+		actions = append(actions, s.fileTemplateCodeActions(doc)...)
+	}
+	if codeActionKindRequested(params.Context.Only, protocol.SourceFixAll) {
+		actions = append(actions, s.fixAllCodeActions(ctx, doc)...)
+	}
+
+	return actions, nil
+}
+
+// codeActionKindRequested returns true if the client asked for code actions of the given kind.
+// An empty `only` list means that all kinds are requested, and a kind also requests its sub-kinds: `source` requests
+// `source.fixAll`.
+func codeActionKindRequested(only []protocol.CodeActionKind, kind protocol.CodeActionKind) bool {
+	if len(only) == 0 {
+		return true
+	}
+	for _, k := range only {
+		if k == kind || strings.HasPrefix(string(kind), string(k)+".") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-jsonnet/ast"
+	"github.com/grafana/jsonnet-language-server/pkg/ast/processing"
+	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// CodeLens shows, when enable_size_code_lenses is set, the size of the output of the fields of the document's top-level
+// object above them, to find which mixin bloats a dashboard or a manifest.
+func (s *Server) CodeLens(ctx context.Context, params *protocol.CodeLensParams) ([]protocol.CodeLens, error) {
+	if !s.config().EnableSizeCodeLenses {
+		return []protocol.CodeLens{}, nil
+	}
+
+	return onLatestDocument(s, "CodeLens", params.TextDocument.URI, func(doc *document) ([]protocol.CodeLens, error) {
+		lenses := []protocol.CodeLens{}
+		filename := doc.item.URI.SpanURI().Filename()
+		if doc.ast == nil || len(doc.linesChangedSinceAST) > 0 || !s.trusted() || s.evaluationBudgets.isDisabled(filename) {
+			// The lenses can't be placed on an out of date AST
+			return lenses, nil
+		}
+		node := doc.ast
+		for {
+			local, ok := node.(*ast.Local)
+			if !ok {
+				break
+			}
+			node = local.Body
+		}
+		object, ok := node.(*ast.DesugaredObject)
+		if !ok {
+			return lenses, nil
+		}
+
+		vm := s.getCancellableVM(ctx, filename)
+		output, err := s.evaluateInTurn(ctx, "codeLens", filename, func() (string, error) {
+			return vm.EvaluateAnonymousSnippet(filename, doc.item.Text)
+		})
+		if err != nil {
+			log.WithContext(ctx).Debugf("CodeLens: unable to evaluate %s: %v", filename, err)
+			return lenses, nil
+		}
+		var value map[string]interface{}
+		decoder := json.NewDecoder(strings.NewReader(output))
+		// The numbers are manifested again as they were output
+		decoder.UseNumber()
+		if err := decoder.Decode(&value); err != nil {
+			return lenses, nil
+		}
+
+		total := manifestedSize(value)
+		for _, field := range object.Fields {
+			name, ok := field.Name.(*ast.LiteralString)
+			if !ok {
+				continue
+			}
+			// Hidden fields are not in the output
+			fieldValue, ok := value[name.Value]
+			if !ok {
+				continue
+			}
+			lenses = append(lenses, protocol.CodeLens{
+				Range:   position.RangeASTToProtocol(processing.FieldToRange(field).FullRange),
+				Command: protocol.Command{Title: sizeCodeLensTitle(manifestedSize(fieldValue), total)},
+			})
+		}
+		return lenses, nil
+	})
+}
+
+// outputSize is the size of a value, manifested like the output of jsonnet.
+type outputSize struct {
+	lines int
+	bytes int
+}
+
+// manifestedSize returns the size of a value, manifested with the indentation of jsonnet.
+func manifestedSize(value interface{}) outputSize {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "   ")
+	if err := encoder.Encode(value); err != nil {
+		return outputSize{}
+	}
+	return outputSize{lines: bytes.Count(buffer.Bytes(), []byte("\n")), bytes: buffer.Len() - 1}
+}
+
+// sizeCodeLensTitle returns `12 lines, 1.5 KiB (40% of the output)`.
+func sizeCodeLensTitle(size, total outputSize) string {
+	lines := "1 line"
+	if size.lines != 1 {
+		lines = fmt.Sprintf("%d lines", size.lines)
+	}
+	title := fmt.Sprintf("%s, %s", lines, formatByteSize(size.bytes))
+	if total.bytes > 0 {
+		title += fmt.Sprintf(" (%d%% of the output)", size.bytes*100/total.bytes)
+	}
+	return title
+}
+
+// formatByteSize returns a size in bytes, KiB or MiB.
+func formatByteSize(size int) string {
+	switch {
+	case size < 1<<10:
+		return fmt.Sprintf("%d B", size)
+	case size < 1<<20:
+		return fmt.Sprintf("%.1f KiB", float64(size)/(1<<10))
+	default:
+		return fmt.Sprintf("%.1f MiB", float64(size)/(1<<20))
+	}
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSizeCodeLenses(t *testing.T) {
+	const document = `local panel(title) = { title: title, type: 'graph' };
+{
+  title: 'dashboard',
+  hidden:: 'hidden',
+  panels: [panel('a'), panel('b')],
+}
+`
+	testCases := []struct {
+		name     string
+		enabled  bool
+		expected []protocol.CodeLens
+	}{
+		{
+			name:     "disabled",
+			expected: []protocol.CodeLens{},
+		},
+		{
+			name:    "enabled",
+			enabled: true,
+			expected: []protocol.CodeLens{
+				{
+					Range:   protocol.Range{Start: protocol.Position{Line: 2, Character: 2}, End: protocol.Position{Line: 2, Character: 20}},
+					Command: protocol.Command{Title: "1 line, 11 B (6% of the output)"},
+				},
+				{
+					Range:   protocol.Range{Start: protocol.Position{Line: 4, Character: 2}, End: protocol.Position{Line: 4, Character: 34}},
+					Command: protocol.Command{Title: "10 lines, 108 B (61% of the output)"},
+				},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server, uri := testServerWithFile(t, nil, document)
+			setConfiguration(server, func(c *Configuration) {
+				c.EnableSizeCodeLenses = tc.enabled
+			})
+
+			lenses, err := server.CodeLens(context.Background(), &protocol.CodeLensParams{TextDocument: protocol.TextDocumentIdentifier{URI: uri}})
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, lenses)
+		})
+	}
+}
+
+func TestSizeCodeLensTitle(t *testing.T) {
+	assert.Equal(t, "1 line, 4 B (100% of the output)", sizeCodeLensTitle(outputSize{lines: 1, bytes: 4}, outputSize{lines: 1, bytes: 4}))
+	assert.Equal(t, "3000 lines, 1.5 KiB (25% of the output)", sizeCodeLensTitle(outputSize{lines: 3000, bytes: 1536}, outputSize{lines: 12000, bytes: 6144}))
+	assert.Equal(t, "2 lines, 2.0 MiB", sizeCodeLensTitle(outputSize{lines: 2, bytes: 2 << 20}, outputSize{}))
+}
@@ -12,42 +12,67 @@ import (
 	"github.com/grafana/jsonnet-language-server/pkg/ast/processing"
 	"github.com/grafana/jsonnet-language-server/pkg/nodestack"
 	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
-	"github.com/grafana/jsonnet-language-server/pkg/utils"
 	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
 	log "github.com/sirupsen/logrus"
 )
 
-func (s *Server) Completion(_ context.Context, params *protocol.CompletionParams) (*protocol.CompletionList, error) {
-	doc, err := s.cache.get(params.TextDocument.URI)
-	if err != nil {
-		return nil, utils.LogErrorf("Completion: %s: %w", errorRetrievingDocument, err)
+func (s *Server) Completion(ctx context.Context, params *protocol.CompletionParams) (*protocol.CompletionList, error) {
+	return onLatestDocument(s, "Completion", params.TextDocument.URI, func(doc *document) (*protocol.CompletionList, error) {
+		return s.completion(ctx, doc, params)
+	})
+}
+
+func (s *Server) completion(ctx context.Context, doc *document, params *protocol.CompletionParams) (*protocol.CompletionList, error) {
+	if isEmptyDocument(doc) {
+		return &protocol.CompletionList{IsIncomplete: false, Items: s.fileTemplateCompletionItems(doc)}, nil
 	}
 
 	line := getCompletionLine(doc.item.Text, params.Position)
+	keywords := completionKeywords(doc.item.Text[:locationOffset(doc.item.Text, position.ProtocolToAST(params.Position))])
 
-	// Short-circuit if it's a stdlib completion
+	// Short-circuit if it's a native function or stdlib completion
+	if items := s.completionNativeFunctions(doc.item.URI.SpanURI().Filename(), line); len(items) > 0 {
+		return &protocol.CompletionList{IsIncomplete: false, Items: items}, nil
+	}
 	if items := s.completionStdLib(line); len(items) > 0 {
 		return &protocol.CompletionList{IsIncomplete: false, Items: items}, nil
 	}
 
 	// Otherwise, parse the AST and search for completions
 	if doc.ast == nil {
-		log.Errorf("Completion: document was never successfully parsed, can't autocomplete")
-		return nil, nil
+		log.WithContext(ctx).Errorf("Completion: document was never successfully parsed, can't autocomplete")
+		return keywordCompletionList(keywords), nil
+	}
+
+	if items := s.completionSchema(doc, line, params.Position); len(items) > 0 {
+		return &protocol.CompletionList{IsIncomplete: false, Items: items}, nil
 	}
 
 	searchStack, err := processing.FindNodeByPosition(doc.ast, position.ProtocolToAST(params.Position))
 	if err != nil {
-		log.Errorf("Completion: error computing node: %v", err)
-		return nil, nil
+		log.WithContext(ctx).Errorf("Completion: error computing node: %v", err)
+		return keywordCompletionList(keywords), nil
 	}
 
-	vm := s.getVM(doc.item.URI.SpanURI().Filename())
+	vm := s.getCancellableVM(ctx, doc.item.URI.SpanURI().Filename())
 
-	items := s.completionFromStack(line, searchStack, vm, params.Position)
+	if items := completionBaseFields(line, searchStack, vm); len(items) > 0 {
+		return &protocol.CompletionList{IsIncomplete: false, Items: items}, nil
+	}
+
+	items := s.completionFromStack(line, searchStack, vm, params.Position, keywords)
 	return &protocol.CompletionList{IsIncomplete: false, Items: items}, nil
 }
 
+// keywordCompletionList is the completion of the documents that can't be searched for completions, only keywords, if
+// there are any.
+func keywordCompletionList(keywords []protocol.CompletionItem) *protocol.CompletionList {
+	if len(keywords) == 0 {
+		return nil
+	}
+	return &protocol.CompletionList{IsIncomplete: false, Items: keywords}
+}
+
 func getCompletionLine(fileContent string, position protocol.Position) string {
 	line := strings.Split(fileContent, "\n")[position.Line]
 	charIndex := int(position.Character)
@@ -58,8 +83,12 @@ func getCompletionLine(fileContent string, position protocol.Position) string {
 	return line
 }
 
-func (s *Server) completionFromStack(line string, stack *nodestack.NodeStack, vm *jsonnet.VM, position protocol.Position) []protocol.CompletionItem {
+// completionFromStack completes the variables and the keywords, or the fields of what is indexed.
+func (s *Server) completionFromStack(line string, stack *nodestack.NodeStack, vm *jsonnet.VM, position protocol.Position, keywords []protocol.CompletionItem) []protocol.CompletionItem {
 	lineWords := splitWords(line)
+	if len(lineWords) == 0 {
+		lineWords = []string{""}
+	}
 	lastWord := lineWords[len(lineWords)-1]
 	lastWord = strings.TrimRight(lastWord, ",;") // Ignore trailing commas and semicolons, they can present when someone is modifying an existing line
 
@@ -77,11 +106,17 @@ func (s *Server) completionFromStack(line string, stack *nodestack.NodeStack, vm
 						continue
 					}
 
-					items = append(items, createCompletionItem(label, "", protocol.VariableCompletion, bind.Body, position))
+					item := createCompletionItem(label, "", protocol.VariableCompletion, bind.Body, position)
+					if declaration := processing.LocalBindToRange(bind); declaration.Filename != "" {
+						if symbol, ok := s.symbolDoc(declaration.Filename, declaration.FullRange.Begin.Line); ok {
+							item.Documentation = symbol.markdown()
+						}
+					}
+					items = append(items, item)
 				}
 			}
 		}
-		return items
+		return append(items, keywords...)
 	}
 
 	ranges, err := processing.FindRangesFromIndexList(stack, indexes, vm, true)
@@ -148,7 +183,7 @@ func (s *Server) createCompletionItemsFromRanges(ranges []processing.ObjectRange
 			continue
 		}
 
-		if !s.configuration.ShowDocstringInCompletion && strings.HasPrefix(label, "#") {
+		if !s.config().ShowDocstringInCompletion && strings.HasPrefix(label, "#") {
 			continue
 		}
 
@@ -157,7 +192,11 @@ func (s *Server) createCompletionItemsFromRanges(ranges []processing.ObjectRange
 			continue
 		}
 
-		items = append(items, createCompletionItem(label, completionPrefix, protocol.FieldCompletion, field.Node, position))
+		item := createCompletionItem(label, completionPrefix, protocol.FieldCompletion, field.Node, position)
+		if symbol, ok := s.symbolDoc(field.Filename, field.FullRange.Begin.Line); ok {
+			item.Documentation = symbol.markdown()
+		}
+		items = append(items, item)
 		labels[label] = true
 	}
 
@@ -170,7 +209,7 @@ func (s *Server) createCompletionItemsFromRanges(ranges []processing.ObjectRange
 
 func formatLabel(str string) string {
 	interStr := "interimPath" + str
-	fmtStr, _ := formatter.Format("", interStr, formatter.DefaultOptions())
+	fmtStr, _ := formatJsonnet("", interStr, formatter.DefaultOptions())
 	ret, _ := strings.CutPrefix(fmtStr, "interimPath")
 	ret, _ = strings.CutPrefix(ret, ".")
 	ret = strings.TrimRight(ret, "\n")
@@ -246,7 +285,7 @@ func typeToString(t ast.Node) string {
 		return "object"
 	case *ast.LiteralString:
 		return "string"
-	case *ast.Import, *ast.ImportStr:
+	case *ast.Import, *ast.ImportStr, *ast.ImportBin:
 		return "import"
 	case *ast.Index:
 		return "object field"
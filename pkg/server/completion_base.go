@@ -0,0 +1,88 @@
+package server
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/google/go-jsonnet"
+	"github.com/google/go-jsonnet/ast"
+	"github.com/grafana/jsonnet-language-server/pkg/ast/processing"
+	"github.com/grafana/jsonnet-language-server/pkg/nodestack"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// completionBaseFields completes the keys of an object that extends another one, `base { }` or `base + { }`, with the
+// fields of the base that it doesn't override yet. The object-valued fields are inserted with `+:`, to be merged.
+func completionBaseFields(line string, stack *nodestack.NodeStack, vm *jsonnet.VM) []protocol.CompletionItem {
+	match := schemaKeyRegexp.FindStringSubmatch(line)
+	if match == nil {
+		return nil
+	}
+	// The position must be between the fields of the object, not in one of them
+	object, ok := stack.Peek().(*ast.DesugaredObject)
+	if !ok {
+		return nil
+	}
+	base := baseOf(stack, object)
+	if base == nil {
+		return nil
+	}
+
+	var ranges []processing.ObjectRange
+	if baseObject, ok := base.(*ast.DesugaredObject); ok {
+		for _, field := range baseObject.Fields {
+			ranges = append(ranges, processing.FieldToRange(field))
+		}
+	} else {
+		indexList := nodestack.NewNodeStack(base).BuildIndexList()
+		if len(indexList) == 0 {
+			return nil
+		}
+		var err error
+		if ranges, err = processing.FindRangesFromIndexList(stack.Clone(), append(indexList, match[1]), vm, true); err != nil {
+			log.Debugf("Completion: unable to find the fields of the base object: %v", err)
+			return nil
+		}
+	}
+
+	existing := map[string]bool{}
+	for _, field := range object.Fields {
+		if name, ok := field.Name.(*ast.LiteralString); ok {
+			existing[name.Value] = true
+		}
+	}
+	var items []protocol.CompletionItem
+	for _, fieldRange := range ranges {
+		name := fieldRange.FieldName
+		if name == "" || existing[name] || !strings.HasPrefix(name, match[1]) {
+			continue
+		}
+		// The base may define a field several times, the nearest definition is found first
+		existing[name] = true
+		insertText := schemaFieldName(name) + ": "
+		if _, isObject := fieldRange.Node.(*ast.DesugaredObject); isObject {
+			insertText = schemaFieldName(name) + "+: "
+		}
+		items = append(items, protocol.CompletionItem{
+			Label:        name,
+			Kind:         protocol.FieldCompletion,
+			LabelDetails: protocol.CompletionItemLabelDetails{Description: typeToString(fieldRange.Node)},
+			InsertText:   insertText,
+		})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Label < items[j].Label
+	})
+	return items
+}
+
+// baseOf returns the left operand of the merge whose right operand is the object, if the object is in one.
+func baseOf(stack *nodestack.NodeStack, object *ast.DesugaredObject) ast.Node {
+	for _, node := range stack.Stack {
+		if binary, ok := node.(*ast.Binary); ok && binary.Op == ast.BopPlus && binary.Right == object {
+			return binary.Left
+		}
+	}
+	return nil
+}
@@ -71,6 +71,13 @@ func TestCompletionStdLib(t *testing.T) {
 		{
 			name: "std: no suggestion 2",
 			line: "no_std2: s",
+			expected: &protocol.CompletionList{
+				Items: []protocol.CompletionItem{
+					{Label: "self", Kind: protocol.KeywordCompletion},
+					{Label: "super", Kind: protocol.KeywordCompletion},
+				},
+				IsIncomplete: false,
+			},
 		},
 		{
 			name: "std: no suggestion 3",
@@ -221,7 +228,7 @@ func TestCompletion(t *testing.T) {
 			replaceByString: "bar: ",
 			expected: protocol.CompletionList{
 				IsIncomplete: false,
-				Items: []protocol.CompletionItem{{
+				Items: append([]protocol.CompletionItem{{
 					Label:      "somevar",
 					Kind:       protocol.VariableCompletion,
 					Detail:     "somevar",
@@ -229,7 +236,7 @@ func TestCompletion(t *testing.T) {
 					LabelDetails: protocol.CompletionItemLabelDetails{
 						Description: "string",
 					},
-				}},
+				}}, keywordCompletionItems(append(expressionKeywords, objectKeywords...)...)...),
 			},
 		},
 		{
@@ -699,7 +706,9 @@ func TestCompletion(t *testing.T) {
 			require.NoError(t, err)
 
 			server, fileURI := testServerWithFile(t, completionTestStdlib, string(content))
-			server.configuration.JPaths = []string{"testdata"}
+			setConfiguration(server, func(c *Configuration) {
+				c.JPaths = []string{"testdata"}
+			})
 
 			replacedContent := strings.ReplaceAll(string(content), tc.replaceString, tc.replaceByString)
 
@@ -737,3 +746,107 @@ func TestCompletion(t *testing.T) {
 		})
 	}
 }
+
+func TestCompletionBaseFields(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+		// typed is the text typed at the cursor, after the document was parsed
+		typed    string
+		expected []protocol.CompletionItem
+	}{
+		{
+			name: "fields of a local",
+			content: `local base = { a: 1, b: { c: 1 }, d:: 'x' };
+base {
+  a: 2,
+  CURSOR
+}`,
+			expected: []protocol.CompletionItem{
+				{Label: "b", Kind: protocol.FieldCompletion, LabelDetails: protocol.CompletionItemLabelDetails{Description: "object"}, InsertText: "b+: "},
+				{Label: "d", Kind: protocol.FieldCompletion, LabelDetails: protocol.CompletionItemLabelDetails{Description: "string"}, InsertText: "d: "},
+			},
+		},
+		{
+			name: "fields of an index",
+			content: `local lib = { deployment: { spec: {}, 'app.kubernetes.io/name': 'x' } };
+lib.deployment + {
+  CURSOR
+}`,
+			expected: []protocol.CompletionItem{
+				{Label: "app.kubernetes.io/name", Kind: protocol.FieldCompletion, LabelDetails: protocol.CompletionItemLabelDetails{Description: "string"}, InsertText: "'app.kubernetes.io/name': "},
+				{Label: "spec", Kind: protocol.FieldCompletion, LabelDetails: protocol.CompletionItemLabelDetails{Description: "object"}, InsertText: "spec+: "},
+			},
+		},
+		{
+			name: "fields of an import",
+			content: `(import 'goto-basic-object.jsonnet') {
+  CURSOR
+}`,
+			expected: []protocol.CompletionItem{
+				{Label: "bar", Kind: protocol.FieldCompletion, LabelDetails: protocol.CompletionItemLabelDetails{Description: "string"}, InsertText: "bar: "},
+				{Label: "foo", Kind: protocol.FieldCompletion, LabelDetails: protocol.CompletionItemLabelDetails{Description: "string"}, InsertText: "foo: "},
+			},
+		},
+		{
+			name: "fields of an object literal",
+			content: `{ a: 1 } + {
+  CURSOR
+}`,
+			expected: []protocol.CompletionItem{
+				{Label: "a", Kind: protocol.FieldCompletion, LabelDetails: protocol.CompletionItemLabelDetails{Description: "number"}, InsertText: "a: "},
+			},
+		},
+		{
+			name: "key being typed",
+			content: `local base = { alpha: 1, beta: 2 };
+base {
+  CURSOR
+}`,
+			typed: "be",
+			expected: []protocol.CompletionItem{
+				{Label: "beta", Kind: protocol.FieldCompletion, LabelDetails: protocol.CompletionItemLabelDetails{Description: "number"}, InsertText: "beta: "},
+			},
+		},
+		{
+			name: "object that isn't merged",
+			content: `{
+  a: 1,
+  CURSOR
+}`,
+			expected: keywordCompletionItems("assert", "local"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var position protocol.Position
+			for i, line := range strings.Split(tc.content, "\n") {
+				if index := strings.Index(line, "CURSOR"); index != -1 {
+					position = protocol.Position{Line: uint32(i), Character: uint32(index + len(tc.typed))}
+				}
+			}
+			server, fileURI := testServerWithFile(t, completionTestStdlib, strings.ReplaceAll(tc.content, "CURSOR", ""))
+			setConfiguration(server, func(c *Configuration) {
+				c.JPaths = []string{"testdata"}
+			})
+			if tc.typed != "" {
+				require.NoError(t, server.DidChange(context.Background(), &protocol.DidChangeTextDocumentParams{
+					ContentChanges: []protocol.TextDocumentContentChangeEvent{{Text: strings.ReplaceAll(tc.content, "CURSOR", tc.typed)}},
+					TextDocument: protocol.VersionedTextDocumentIdentifier{
+						TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: fileURI},
+						Version:                2,
+					},
+				}))
+			}
+
+			result, err := server.Completion(context.Background(), &protocol.CompletionParams{
+				TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+					TextDocument: protocol.TextDocumentIdentifier{URI: fileURI},
+					Position:     position,
+				},
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, result.Items)
+		})
+	}
+}
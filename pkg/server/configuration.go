@@ -2,8 +2,13 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
 	"reflect"
+	"regexp"
+	"sort"
+	"strings"
 
 	"github.com/google/go-jsonnet"
 	"github.com/google/go-jsonnet/formatter"
@@ -13,16 +18,152 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// settingsPrefixes are the keys that clients may nest the settings under.
+var settingsPrefixes = []string{"jsonnet", "jsonnet_ls"}
+
+// errUnsupportedSettingsKey is returned for the settings that the server doesn't know.
+var errUnsupportedSettingsKey = errors.New("unsupported settings key")
+
+// placeholderRegexp matches the placeholders of configuration values, `${env:NAME}` and `${workspaceFolder}`.
+var placeholderRegexp = regexp.MustCompile(`\$\{(?:env:([A-Za-z_][A-Za-z0-9_]*)|workspaceFolder)\}`)
+
 type Configuration struct {
 	ResolvePathsWithTanka bool
-	JPaths                []string
-	ExtVars               map[string]string
-	ExtCode               map[string]string
-	FormattingOptions     formatter.Options
+	// ProjectDetectors are the names of the project detectors to run, in order, the default ones if it is nil
+	ProjectDetectors  []string
+	JPaths            []string
+	ExtVars           map[string]string
+	ExtCode           map[string]string
+	TLAVars           map[string]string
+	TLACode           map[string]string
+	FormattingOptions formatter.Options
+	// FormattingPasses are the options of the formatting setting that go-jsonnet's formatter doesn't have
+	FormattingPasses FormattingPasses
+
+	// ExtVarsFromFiles are the JSON or YAML files whose values are external variables
+	ExtVarsFromFiles []string
+	// ImportAliases rewrite the imports that start with a prefix, the key, to start with its value instead
+	ImportAliases map[string]string
+	// ExtCodeFromCommand are the commands whose outputs are the code of external variables, by variable
+	ExtCodeFromCommand map[string][]string
+
+	// FixAll are the fixes of the source.fixAll code action, in order, the default ones if it is nil
+	FixAll []string
+	// FixAllOnSave applies the FixAll fixes when the documents are saved
+	FixAllOnSave bool
+	// Entrypoints are the globs, relative to the workspace folder, of the files that jsonnet.deadCode starts from,
+	// the .jsonnet files if it is nil
+	Entrypoints []string
+	// ContextEntrypoints are the globs, relative to the workspace folder, of the files whose ext vars, TLAs and jpaths
+	// the files they import are evaluated with
+	ContextEntrypoints []string
+	// GeneratedFiles are the globs, relative to the workspace folder, of the generated files. Like the vendored ones,
+	// they aren't evaluated, and the refactorings leave them out.
+	GeneratedFiles []string
+	// EditReadOnlyFiles lets the refactorings edit the vendored and generated files
+	EditReadOnlyFiles bool
+	// Sandbox restricts the imports to the workspace folder and the jpaths, for the untrusted repositories
+	Sandbox bool
 
 	EnableEvalDiagnostics     bool
 	EnableLintDiagnostics     bool
+	LintMixinOverrides        bool
 	ShowDocstringInCompletion bool
+	EnableStatusNotifications bool
+	EnableTelemetry           bool
+	// EnableEmbeddedJsonnetDiagnostics reports the syntax errors of the text blocks that contain Jsonnet
+	EnableEmbeddedJsonnetDiagnostics bool
+	// SkipWarmUp doesn't read and index the vendored libraries on startup, and when the jpaths change
+	SkipWarmUp bool
+	// ShardIndex indexes the vendored libraries by top-level directory, the first time one of their files is opened or
+	// looked up, instead of on startup
+	ShardIndex bool
+	// MaxParallelEvaluations is the number of documents whose diagnostics are computed at the same time, each on its
+	// own VM. It is GOMAXPROCS if it is 0.
+	MaxParallelEvaluations int
+	// EvaluationBudget is how long, in milliseconds, the automatic evaluations of a file can take before the file is
+	// only parsed and linted. It is 10s if it is 0.
+	EvaluationBudget int
+	// MaxFileSize is the size, in bytes, of the largest file that is parsed, evaluated and indexed. The larger files,
+	// and the binary ones, get an informational diagnostic instead. It is 10MiB if it is 0.
+	MaxFileSize int
+	// OTLPEndpoint is the OTLP/HTTP traces endpoint the spans of the requests are sent to
+	OTLPEndpoint string
+	// TraceFile is the file the spans of the requests are appended to, as lines of OTLP JSON
+	TraceFile string
+	// HoverVerbosity is what the hovers show: the signature of the definitions, their documentation, or also the
+	// evaluated value of the locals and fields. It is docs if it is empty.
+	HoverVerbosity string
+	// HoverMaxLength is the length, in bytes, after which the hovers are cut. They aren't if it is 0.
+	HoverMaxLength int
+	// EnableSizeCodeLenses shows the size of the output of the top-level fields above them
+	EnableSizeCodeLenses bool
+
+	Schemas       []SchemaConfiguration
+	Grafana       GrafanaConfiguration
+	PostRenderers []PostRendererConfiguration
+	// ToolPaths are the paths of the binaries that the commands of the settings run, by binary
+	ToolPaths map[string]string
+	// AllowedCommands are the binaries, by name or path, that the commands of the settings can run. Any can if it is nil
+	AllowedCommands []string
+	// SkipCommandConfirmation runs the commands of the settings without asking the user first
+	SkipCommandConfirmation bool
+	PolicyBundles           []string
+	// FileTemplates are the templates that empty files can be started from, along with the default ones
+	FileTemplates []FileTemplateConfiguration
+
+	// Overrides are the configurations of the files that match globs, in order
+	Overrides []ConfigurationOverride
+}
+
+// redactedValue replaces the values of the configuration that may be secrets, in the logs and the crash bundles.
+const redactedValue = "<redacted>"
+
+// redacted returns the configuration without the values of the external variables, of the top-level arguments, and
+// without the Grafana token, including those of the overrides. The names of the variables are kept.
+func (c Configuration) redacted() Configuration {
+	c.ExtVars = redactValues(c.ExtVars)
+	c.ExtCode = redactValues(c.ExtCode)
+	c.TLAVars = redactValues(c.TLAVars)
+	c.TLACode = redactValues(c.TLACode)
+	if c.Grafana.Token != "" {
+		c.Grafana.Token = redactedValue
+	}
+	if c.Overrides != nil {
+		overrides := make([]ConfigurationOverride, len(c.Overrides))
+		for i, override := range c.Overrides {
+			override.Configuration = override.Configuration.redacted()
+			overrides[i] = override
+		}
+		c.Overrides = overrides
+	}
+	return c
+}
+
+func redactValues(values map[string]string) map[string]string {
+	if values == nil {
+		return nil
+	}
+	redacted := make(map[string]string, len(values))
+	for name := range values {
+		redacted[name] = redactedValue
+	}
+	return redacted
+}
+
+// config returns the configuration. It is replaced, never changed in place, so the copy can be read without locking.
+func (s *Server) config() Configuration {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+	return s.configuration
+}
+
+// extCodeOfCommands returns the code of the ext_code_from_command variables. Like the configuration, it is replaced,
+// never changed in place.
+func (s *Server) extCodeOfCommands() map[string]string {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+	return s.commandExtCode
 }
 
 func (s *Server) DidChangeConfiguration(_ context.Context, params *protocol.DidChangeConfigurationParams) error {
@@ -30,97 +171,507 @@ func (s *Server) DidChangeConfiguration(_ context.Context, params *protocol.DidC
 	if !ok {
 		return fmt.Errorf("%w: unsupported settings payload. expected json object, got: %T", jsonrpc2.ErrInvalidParams, params.Settings)
 	}
+	settingsMap = unnestSettings(settingsMap)
 
-	for sk, sv := range settingsMap {
+	// The settings are applied to a copy, which replaces the configuration only if all of them are valid
+	keys := make([]string, 0, len(settingsMap))
+	for sk := range settingsMap {
+		keys = append(keys, sk)
+	}
+	sort.Strings(keys)
+	config := s.config()
+	var invalid []string
+	for _, sk := range keys {
+		if err := s.applySetting(&config, sk, settingsMap[sk]); errors.Is(err, errUnsupportedSettingsKey) {
+			// Clients may send settings of other versions of the server, or of the extension itself
+			log.Warnf("Ignoring the unsupported settings key %q", sk)
+		} else if err != nil {
+			invalid = append(invalid, strings.TrimPrefix(err.Error(), jsonrpc2.ErrInvalidParams.Error()+": "))
+		}
+	}
+	if len(invalid) > 0 {
+		s.showInvalidSettings(invalid)
+		return fmt.Errorf("%w: %s", jsonrpc2.ErrInvalidParams, strings.Join(invalid, "; "))
+	}
+
+	s.configMu.Lock()
+	previous := s.configuration
+	s.configuration = config
+	s.configMu.Unlock()
+	runCommands := false
+	for _, sk := range keys {
 		switch sk {
 		case "log_level":
-			level, err := log.ParseLevel(sv.(string))
-			if err != nil {
-				return fmt.Errorf("%w: %v", jsonrpc2.ErrInvalidParams, err)
-			}
+			// The level isn't part of the configuration, it was validated with the other settings
+			level, _ := log.ParseLevel(settingsMap[sk].(string))
 			log.SetLevel(level)
-		case "resolve_paths_with_tanka":
-			if boolVal, ok := sv.(bool); ok {
-				s.configuration.ResolvePathsWithTanka = boolVal
-			} else {
-				return fmt.Errorf("%w: unsupported settings value for resolve_paths_with_tanka. expected boolean. got: %T", jsonrpc2.ErrInvalidParams, sv)
+		case "schemas":
+			s.schemaLoader.Reset()
+		case "policy_bundles":
+		case "max_file_size":
+			s.docs.maxFileSize.Store(int64(config.maxFileSize()))
+		case "ext_code_from_command", "tool_paths", "allowed_commands", "confirm_commands":
+			// The commands run once, whichever of their settings changed
+			runCommands = true
+		}
+	}
+	if runCommands {
+		// The open documents are analysed again once the commands ran, if their outputs changed
+		s.refreshCommandExtCode()
+	}
+	log.Infof("configuration updated: %+v", config.redacted())
+
+	// The open documents are evaluated again with the new settings
+	if !reflect.DeepEqual(previous, config) {
+		// The entrypoints, or the paths their imports resolve to, may have changed
+		s.contexts.reset()
+		s.restartAnalysis()
+	}
+
+	return nil
+}
+
+// unnestSettings returns the settings with those nested under a settingsPrefixes key, as VS Code sends them, moved to
+// the top level. The nested settings win.
+func unnestSettings(settingsMap map[string]interface{}) map[string]interface{} {
+	unnested := make(map[string]interface{}, len(settingsMap))
+	for sk, sv := range settingsMap {
+		if _, ok := sv.(map[string]interface{}); !ok || !contains(settingsPrefixes, sk) {
+			unnested[sk] = sv
+		}
+	}
+	for _, prefix := range settingsPrefixes {
+		nested, ok := settingsMap[prefix].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for sk, sv := range nested {
+			unnested[sk] = sv
+		}
+	}
+	return unnested
+}
+
+// showInvalidSettings tells the user which settings are invalid, and that the previous configuration is kept.
+func (s *Server) showInvalidSettings(invalid []string) {
+	message := fmt.Sprintf("Invalid settings, the previous configuration is kept:\n- %s", strings.Join(invalid, "\n- "))
+	log.Error(message)
+	if s.client == nil {
+		return
+	}
+	if err := s.client.ShowMessage(context.Background(), &protocol.ShowMessageParams{Type: protocol.Error, Message: message}); err != nil {
+		log.Errorf("showInvalidSettings: unable to show the message: %v", err)
+	}
+}
+
+// applySetting parses a setting and sets it on the configuration.
+func (s *Server) applySetting(c *Configuration, sk string, sv interface{}) error {
+	switch sk {
+	case "log_level":
+		strVal, ok := sv.(string)
+		if !ok {
+			return fmt.Errorf("%w: unsupported settings value for log_level. expected string. got: %T", jsonrpc2.ErrInvalidParams, sv)
+		}
+		if _, err := log.ParseLevel(strVal); err != nil {
+			return fmt.Errorf("%w: %v", jsonrpc2.ErrInvalidParams, err)
+		}
+	case "resolve_paths_with_tanka":
+		if boolVal, ok := sv.(bool); ok {
+			c.ResolvePathsWithTanka = boolVal
+		} else {
+			return fmt.Errorf("%w: unsupported settings value for resolve_paths_with_tanka. expected boolean. got: %T", jsonrpc2.ErrInvalidParams, sv)
+		}
+	case "jpath":
+		if svList, ok := sv.([]interface{}); ok {
+			c.JPaths = make([]string, len(svList))
+			for i, v := range svList {
+				if strVal, ok := v.(string); ok {
+					c.JPaths[i] = s.expandPlaceholders(strVal)
+				} else {
+					return fmt.Errorf("%w: unsupported settings value for jpath. expected string. got: %T", jsonrpc2.ErrInvalidParams, v)
+				}
 			}
-		case "jpath":
-			if svList, ok := sv.([]interface{}); ok {
-				s.configuration.JPaths = make([]string, len(svList))
-				for i, v := range svList {
-					if strVal, ok := v.(string); ok {
-						s.configuration.JPaths[i] = strVal
-					} else {
-						return fmt.Errorf("%w: unsupported settings value for jpath. expected string. got: %T", jsonrpc2.ErrInvalidParams, v)
-					}
+		} else {
+			return fmt.Errorf("%w: unsupported settings value for jpath. expected array of strings. got: %T", jsonrpc2.ErrInvalidParams, sv)
+		}
+
+	case "entrypoints":
+		if svList, ok := sv.([]interface{}); ok {
+			c.Entrypoints = make([]string, len(svList))
+			for i, v := range svList {
+				if strVal, ok := v.(string); ok {
+					c.Entrypoints[i] = strVal
+				} else {
+					return fmt.Errorf("%w: unsupported settings value for entrypoints. expected string. got: %T", jsonrpc2.ErrInvalidParams, v)
 				}
-			} else {
-				return fmt.Errorf("%w: unsupported settings value for jpath. expected array of strings. got: %T", jsonrpc2.ErrInvalidParams, sv)
 			}
+		} else {
+			return fmt.Errorf("%w: unsupported settings value for entrypoints. expected array of strings. got: %T", jsonrpc2.ErrInvalidParams, sv)
+		}
 
-		case "enable_eval_diagnostics":
-			if boolVal, ok := sv.(bool); ok {
-				s.configuration.EnableEvalDiagnostics = boolVal
-			} else {
-				return fmt.Errorf("%w: unsupported settings value for enable_eval_diagnostics. expected boolean. got: %T", jsonrpc2.ErrInvalidParams, sv)
+	case "context_entrypoints":
+		if svList, ok := sv.([]interface{}); ok {
+			c.ContextEntrypoints = make([]string, len(svList))
+			for i, v := range svList {
+				if strVal, ok := v.(string); ok {
+					c.ContextEntrypoints[i] = strVal
+				} else {
+					return fmt.Errorf("%w: unsupported settings value for context_entrypoints. expected string. got: %T", jsonrpc2.ErrInvalidParams, v)
+				}
+			}
+		} else {
+			return fmt.Errorf("%w: unsupported settings value for context_entrypoints. expected array of strings. got: %T", jsonrpc2.ErrInvalidParams, sv)
+		}
+
+	case "generated_files":
+		if svList, ok := sv.([]interface{}); ok {
+			c.GeneratedFiles = make([]string, len(svList))
+			for i, v := range svList {
+				if strVal, ok := v.(string); ok {
+					c.GeneratedFiles[i] = strVal
+				} else {
+					return fmt.Errorf("%w: unsupported settings value for generated_files. expected string. got: %T", jsonrpc2.ErrInvalidParams, v)
+				}
+			}
+		} else {
+			return fmt.Errorf("%w: unsupported settings value for generated_files. expected array of strings. got: %T", jsonrpc2.ErrInvalidParams, sv)
+		}
+	case "edit_read_only_files":
+		if boolVal, ok := sv.(bool); ok {
+			c.EditReadOnlyFiles = boolVal
+		} else {
+			return fmt.Errorf("%w: unsupported settings value for edit_read_only_files. expected boolean. got: %T", jsonrpc2.ErrInvalidParams, sv)
+		}
+	case "sandbox":
+		if boolVal, ok := sv.(bool); ok {
+			c.Sandbox = boolVal
+		} else {
+			return fmt.Errorf("%w: unsupported settings value for sandbox. expected boolean. got: %T", jsonrpc2.ErrInvalidParams, sv)
+		}
+
+	case "enable_eval_diagnostics":
+		if boolVal, ok := sv.(bool); ok {
+			c.EnableEvalDiagnostics = boolVal
+		} else {
+			return fmt.Errorf("%w: unsupported settings value for enable_eval_diagnostics. expected boolean. got: %T", jsonrpc2.ErrInvalidParams, sv)
+		}
+	case "enable_lint_diagnostics":
+		if boolVal, ok := sv.(bool); ok {
+			c.EnableLintDiagnostics = boolVal
+		} else {
+			return fmt.Errorf("%w: unsupported settings value for enable_lint_diagnostics. expected boolean. got: %T", jsonrpc2.ErrInvalidParams, sv)
+		}
+	case "enable_embedded_jsonnet_diagnostics":
+		if boolVal, ok := sv.(bool); ok {
+			c.EnableEmbeddedJsonnetDiagnostics = boolVal
+		} else {
+			return fmt.Errorf("%w: unsupported settings value for enable_embedded_jsonnet_diagnostics. expected boolean. got: %T", jsonrpc2.ErrInvalidParams, sv)
+		}
+	case "lint_mixin_overrides":
+		if boolVal, ok := sv.(bool); ok {
+			c.LintMixinOverrides = boolVal
+		} else {
+			return fmt.Errorf("%w: unsupported settings value for lint_mixin_overrides. expected boolean. got: %T", jsonrpc2.ErrInvalidParams, sv)
+		}
+	case "show_docstring_in_completion":
+		if boolVal, ok := sv.(bool); ok {
+			c.ShowDocstringInCompletion = boolVal
+		} else {
+			return fmt.Errorf("%w: unsupported settings value for show_docstring_in_completion. expected boolean. got: %T", jsonrpc2.ErrInvalidParams, sv)
+		}
+	case "enable_status_notifications":
+		if boolVal, ok := sv.(bool); ok {
+			c.EnableStatusNotifications = boolVal
+		} else {
+			return fmt.Errorf("%w: unsupported settings value for enable_status_notifications. expected boolean. got: %T", jsonrpc2.ErrInvalidParams, sv)
+		}
+	case "enable_telemetry":
+		if boolVal, ok := sv.(bool); ok {
+			c.EnableTelemetry = boolVal
+		} else {
+			return fmt.Errorf("%w: unsupported settings value for enable_telemetry. expected boolean. got: %T", jsonrpc2.ErrInvalidParams, sv)
+		}
+	case "enable_size_code_lenses":
+		if boolVal, ok := sv.(bool); ok {
+			c.EnableSizeCodeLenses = boolVal
+		} else {
+			return fmt.Errorf("%w: unsupported settings value for enable_size_code_lenses. expected boolean. got: %T", jsonrpc2.ErrInvalidParams, sv)
+		}
+	case "warm_up":
+		if boolVal, ok := sv.(bool); ok {
+			c.SkipWarmUp = !boolVal
+		} else {
+			return fmt.Errorf("%w: unsupported settings value for warm_up. expected boolean. got: %T", jsonrpc2.ErrInvalidParams, sv)
+		}
+	case "shard_index":
+		if boolVal, ok := sv.(bool); ok {
+			c.ShardIndex = boolVal
+		} else {
+			return fmt.Errorf("%w: unsupported settings value for shard_index. expected boolean. got: %T", jsonrpc2.ErrInvalidParams, sv)
+		}
+	case "otlp_endpoint":
+		if strVal, ok := sv.(string); ok {
+			c.OTLPEndpoint = strVal
+		} else {
+			return fmt.Errorf("%w: unsupported settings value for otlp_endpoint. expected string. got: %T", jsonrpc2.ErrInvalidParams, sv)
+		}
+	case "trace_file":
+		if strVal, ok := sv.(string); ok {
+			c.TraceFile = strVal
+		} else {
+			return fmt.Errorf("%w: unsupported settings value for trace_file. expected string. got: %T", jsonrpc2.ErrInvalidParams, sv)
+		}
+	case "hover_verbosity":
+		switch sv {
+		case hoverVerbositySignature, hoverVerbosityDocs, hoverVerbosityValue:
+			c.HoverVerbosity = sv.(string)
+		default:
+			return fmt.Errorf("%w: unsupported settings value for hover_verbosity. expected one of 'signature', 'docs', 'value'. got: %v", jsonrpc2.ErrInvalidParams, sv)
+		}
+	case "hover_max_length":
+		var length int
+		switch v := sv.(type) {
+		case float64:
+			length = int(v)
+			if float64(length) != v {
+				return fmt.Errorf("%w: unsupported settings value for hover_max_length. expected integer. got: %v", jsonrpc2.ErrInvalidParams, v)
 			}
-		case "enable_lint_diagnostics":
-			if boolVal, ok := sv.(bool); ok {
-				s.configuration.EnableLintDiagnostics = boolVal
-			} else {
-				return fmt.Errorf("%w: unsupported settings value for enable_lint_diagnostics. expected boolean. got: %T", jsonrpc2.ErrInvalidParams, sv)
+		case int:
+			length = v
+		default:
+			return fmt.Errorf("%w: unsupported settings value for hover_max_length. expected integer. got: %T", jsonrpc2.ErrInvalidParams, sv)
+		}
+		if length < 0 {
+			return fmt.Errorf("%w: unsupported settings value for hover_max_length. expected a positive number of bytes, or 0 for no limit. got: %d", jsonrpc2.ErrInvalidParams, length)
+		}
+		c.HoverMaxLength = length
+	case "max_file_size":
+		var size int
+		switch v := sv.(type) {
+		case float64:
+			size = int(v)
+			if float64(size) != v {
+				return fmt.Errorf("%w: unsupported settings value for max_file_size. expected integer. got: %v", jsonrpc2.ErrInvalidParams, v)
 			}
-		case "show_docstring_in_completion":
-			if boolVal, ok := sv.(bool); ok {
-				s.configuration.ShowDocstringInCompletion = boolVal
-			} else {
-				return fmt.Errorf("%w: unsupported settings value for show_docstring_in_completion. expected boolean. got: %T", jsonrpc2.ErrInvalidParams, sv)
+		case int:
+			size = v
+		default:
+			return fmt.Errorf("%w: unsupported settings value for max_file_size. expected integer. got: %T", jsonrpc2.ErrInvalidParams, sv)
+		}
+		if size < 0 {
+			return fmt.Errorf("%w: unsupported settings value for max_file_size. expected a positive number of bytes, or 0 for 10MiB. got: %d", jsonrpc2.ErrInvalidParams, size)
+		}
+		c.MaxFileSize = size
+	case "evaluation_budget":
+		var budget int
+		switch v := sv.(type) {
+		case float64:
+			budget = int(v)
+			if float64(budget) != v {
+				return fmt.Errorf("%w: unsupported settings value for evaluation_budget. expected integer. got: %v", jsonrpc2.ErrInvalidParams, v)
 			}
-		case "ext_vars":
-			newVars, err := s.parseExtVars(sv)
-			if err != nil {
-				return fmt.Errorf("%w: ext_vars parsing failed: %v", jsonrpc2.ErrInvalidParams, err)
+		case int:
+			budget = v
+		default:
+			return fmt.Errorf("%w: unsupported settings value for evaluation_budget. expected integer. got: %T", jsonrpc2.ErrInvalidParams, sv)
+		}
+		if budget < 0 {
+			return fmt.Errorf("%w: unsupported settings value for evaluation_budget. expected a positive number of milliseconds, or 0 for 10s. got: %d", jsonrpc2.ErrInvalidParams, budget)
+		}
+		c.EvaluationBudget = budget
+	case "max_parallel_evaluations":
+		var limit int
+		switch v := sv.(type) {
+		case float64:
+			limit = int(v)
+			if float64(limit) != v {
+				return fmt.Errorf("%w: unsupported settings value for max_parallel_evaluations. expected integer. got: %v", jsonrpc2.ErrInvalidParams, v)
 			}
-			s.configuration.ExtVars = newVars
-		case "formatting":
-			newFmtOpts, err := s.parseFormattingOpts(sv)
-			if err != nil {
-				return fmt.Errorf("%w: formatting options parsing failed: %v", jsonrpc2.ErrInvalidParams, err)
+		case int:
+			limit = v
+		default:
+			return fmt.Errorf("%w: unsupported settings value for max_parallel_evaluations. expected integer. got: %T", jsonrpc2.ErrInvalidParams, sv)
+		}
+		if limit < 0 {
+			return fmt.Errorf("%w: unsupported settings value for max_parallel_evaluations. expected a positive integer, or 0 for GOMAXPROCS. got: %d", jsonrpc2.ErrInvalidParams, limit)
+		}
+		c.MaxParallelEvaluations = limit
+	case "schemas":
+		schemas, err := parseSchemas(sv)
+		if err != nil {
+			return fmt.Errorf("%w: schemas parsing failed: %v", jsonrpc2.ErrInvalidParams, err)
+		}
+		c.Schemas = schemas
+	case "post_renderers":
+		renderers, err := parsePostRenderers(sv)
+		if err != nil {
+			return fmt.Errorf("%w: post_renderers parsing failed: %v", jsonrpc2.ErrInvalidParams, err)
+		}
+		c.PostRenderers = renderers
+	case "file_templates":
+		templates, err := parseFileTemplates(sv)
+		if err != nil {
+			return fmt.Errorf("%w: file_templates parsing failed: %v", jsonrpc2.ErrInvalidParams, err)
+		}
+		c.FileTemplates = templates
+	case "policy_bundles":
+		svList, ok := sv.([]interface{})
+		if !ok {
+			return fmt.Errorf("%w: unsupported settings value for policy_bundles. expected array of strings. got: %T", jsonrpc2.ErrInvalidParams, sv)
+		}
+		c.PolicyBundles = make([]string, len(svList))
+		for i, v := range svList {
+			strVal, ok := v.(string)
+			if !ok {
+				return fmt.Errorf("%w: unsupported settings value for policy_bundles. expected string. got: %T", jsonrpc2.ErrInvalidParams, v)
+			}
+			c.PolicyBundles[i] = strVal
+		}
+		s.policyLoader.Reset()
+	case "project_detectors":
+		svList, ok := sv.([]interface{})
+		if !ok {
+			return fmt.Errorf("%w: unsupported settings value for project_detectors. expected array of strings. got: %T", jsonrpc2.ErrInvalidParams, sv)
+		}
+		detectors := make([]string, len(svList))
+		for i, v := range svList {
+			strVal, ok := v.(string)
+			if !ok {
+				return fmt.Errorf("%w: unsupported settings value for project_detectors. expected string. got: %T", jsonrpc2.ErrInvalidParams, v)
 			}
-			s.configuration.FormattingOptions = newFmtOpts
+			if _, ok := s.projectDetectors[strVal]; !ok {
+				return fmt.Errorf("%w: unsupported settings value for project_detectors. unknown project detector: %q", jsonrpc2.ErrInvalidParams, strVal)
+			}
+			detectors[i] = strVal
+		}
+		c.ProjectDetectors = detectors
+	case "fix_all":
+		fixes, err := parseFixAll(sv)
+		if err != nil {
+			return fmt.Errorf("%w: fix_all parsing failed: %v", jsonrpc2.ErrInvalidParams, err)
+		}
+		c.FixAll = fixes
+	case "fix_all_on_save":
+		if boolVal, ok := sv.(bool); ok {
+			c.FixAllOnSave = boolVal
+		} else {
+			return fmt.Errorf("%w: unsupported settings value for fix_all_on_save. expected boolean. got: %T", jsonrpc2.ErrInvalidParams, sv)
+		}
+	case "grafana":
+		grafana, err := parseGrafana(sv)
+		if err != nil {
+			return fmt.Errorf("%w: grafana parsing failed: %v", jsonrpc2.ErrInvalidParams, err)
+		}
+		c.Grafana = grafana
+	case "ext_vars":
+		newVars, err := s.parseVars("ext_vars", sv)
+		if err != nil {
+			return fmt.Errorf("%w: ext_vars parsing failed: %v", jsonrpc2.ErrInvalidParams, err)
+		}
+		c.ExtVars = newVars
+	case "tla_vars":
+		newVars, err := s.parseVars("tla_vars", sv)
+		if err != nil {
+			return fmt.Errorf("%w: tla_vars parsing failed: %v", jsonrpc2.ErrInvalidParams, err)
+		}
+		c.TLAVars = newVars
+	case "formatting":
+		newFmtOpts, err := s.parseFormattingOpts(sv)
+		if err != nil {
+			return fmt.Errorf("%w: formatting options parsing failed: %v", jsonrpc2.ErrInvalidParams, err)
+		}
+		passes, err := parseFormattingPasses(sv)
+		if err != nil {
+			return fmt.Errorf("%w: formatting options parsing failed: %v", jsonrpc2.ErrInvalidParams, err)
+		}
+		c.FormattingOptions = newFmtOpts
+		c.FormattingPasses = passes
 
-		case "ext_code":
-			newCode, err := s.parseExtCode(sv)
-			if err != nil {
-				return fmt.Errorf("%w: ext_code parsing failed: %v", jsonrpc2.ErrInvalidParams, err)
+	case "ext_code":
+		newCode, err := s.parseCode("ext_code", sv)
+		if err != nil {
+			return fmt.Errorf("%w: ext_code parsing failed: %v", jsonrpc2.ErrInvalidParams, err)
+		}
+		c.ExtCode = newCode
+	case "ext_vars_from_files":
+		paths, err := s.parseExtVarsFromFiles(sv)
+		if err != nil {
+			return fmt.Errorf("%w: ext_vars_from_files parsing failed: %v", jsonrpc2.ErrInvalidParams, err)
+		}
+		c.ExtVarsFromFiles = paths
+	case "import_aliases":
+		aliases, err := s.parseImportAliases(sv)
+		if err != nil {
+			return fmt.Errorf("%w: import_aliases parsing failed: %v", jsonrpc2.ErrInvalidParams, err)
+		}
+		c.ImportAliases = aliases
+	case "tool_paths":
+		paths, err := s.parseToolPaths(sv)
+		if err != nil {
+			return fmt.Errorf("%w: tool_paths parsing failed: %v", jsonrpc2.ErrInvalidParams, err)
+		}
+		c.ToolPaths = paths
+	case "allowed_commands":
+		if svList, ok := sv.([]interface{}); ok {
+			c.AllowedCommands = make([]string, len(svList))
+			for i, v := range svList {
+				if strVal, ok := v.(string); ok {
+					c.AllowedCommands[i] = s.expandPlaceholders(strVal)
+				} else {
+					return fmt.Errorf("%w: unsupported settings value for allowed_commands. expected string. got: %T", jsonrpc2.ErrInvalidParams, v)
+				}
 			}
-			s.configuration.ExtCode = newCode
+		} else {
+			return fmt.Errorf("%w: unsupported settings value for allowed_commands. expected array of strings. got: %T", jsonrpc2.ErrInvalidParams, sv)
+		}
+	case "confirm_commands":
+		if boolVal, ok := sv.(bool); ok {
+			c.SkipCommandConfirmation = !boolVal
+		} else {
+			return fmt.Errorf("%w: unsupported settings value for confirm_commands. expected boolean. got: %T", jsonrpc2.ErrInvalidParams, sv)
+		}
+	case "ext_code_from_command":
+		commands, err := s.parseExtCodeFromCommand(sv)
+		if err != nil {
+			return fmt.Errorf("%w: ext_code_from_command parsing failed: %v", jsonrpc2.ErrInvalidParams, err)
+		}
+		c.ExtCodeFromCommand = commands
+	case "tla_code":
+		newCode, err := s.parseCode("tla_code", sv)
+		if err != nil {
+			return fmt.Errorf("%w: tla_code parsing failed: %v", jsonrpc2.ErrInvalidParams, err)
+		}
+		c.TLACode = newCode
 
-		default:
-			return fmt.Errorf("%w: unsupported settings key: %q", jsonrpc2.ErrInvalidParams, sk)
+	case "overrides":
+		overrides, err := s.parseOverrides(sv)
+		if err != nil {
+			return fmt.Errorf("%w: overrides parsing failed: %v", jsonrpc2.ErrInvalidParams, err)
 		}
-	}
-	log.Infof("configuration updated: %+v", s.configuration)
+		c.Overrides = overrides
 
+	default:
+		return fmt.Errorf("%w: %w: %q", jsonrpc2.ErrInvalidParams, errUnsupportedSettingsKey, sk)
+	}
 	return nil
 }
 
-func (s *Server) parseExtVars(unparsed interface{}) (map[string]string, error) {
+// parseVars parses the ext_vars or tla_vars setting.
+func (s *Server) parseVars(setting string, unparsed interface{}) (map[string]string, error) {
 	newVars, ok := unparsed.(map[string]interface{})
 	if !ok {
-		return nil, fmt.Errorf("unsupported settings value for ext_vars. expected json object. got: %T", unparsed)
+		return nil, fmt.Errorf("unsupported settings value for %s. expected json object. got: %T", setting, unparsed)
 	}
 
-	extVars := make(map[string]string, len(newVars))
+	vars := make(map[string]string, len(newVars))
 	for varKey, varValue := range newVars {
 		vv, ok := varValue.(string)
 		if !ok {
-			return nil, fmt.Errorf("unsupported settings value for ext_vars.%s. expected string. got: %T", varKey, varValue)
+			return nil, fmt.Errorf("unsupported settings value for %s.%s. expected string. got: %T", setting, varKey, varValue)
 		}
-		extVars[varKey] = vv
+		vars[varKey] = s.expandPlaceholders(vv)
 	}
-	return extVars, nil
+	return vars, nil
 }
 
 func (s *Server) parseFormattingOpts(unparsed interface{}) (formatter.Options, error) {
@@ -142,31 +693,115 @@ func (s *Server) parseFormattingOpts(unparsed interface{}) (formatter.Options, e
 		return formatter.Options{}, fmt.Errorf("decoder construction failed: %v", err)
 	}
 
-	if err := decoder.Decode(newOpts); err != nil {
+	if err := decoder.Decode(formattingKeys(newOpts)); err != nil {
 		return formatter.Options{}, fmt.Errorf("map decode failed: %v", err)
 	}
 	return opts, nil
 }
 
-func (s *Server) parseExtCode(unparsed interface{}) (map[string]string, error) {
+func parseFormattingPasses(unparsed interface{}) (FormattingPasses, error) {
+	var passes FormattingPasses
+	if err := mapstructure.Decode(formattingKeys(unparsed), &passes); err != nil {
+		return FormattingPasses{}, fmt.Errorf("map decode failed: %v", err)
+	}
+	return passes, nil
+}
+
+// formattingKeys returns the formatting options with snake case keys, `max_blank_lines` for example, renamed to
+// match the fields of the options, which are matched case insensitively.
+func formattingKeys(unparsed interface{}) interface{} {
+	opts, ok := unparsed.(map[string]interface{})
+	if !ok {
+		return unparsed
+	}
+	renamed := make(map[string]interface{}, len(opts))
+	for key, value := range opts {
+		renamed[strings.ReplaceAll(key, "_", "")] = value
+	}
+	return renamed
+}
+
+func parseSchemas(unparsed interface{}) ([]SchemaConfiguration, error) {
+	if _, ok := unparsed.([]interface{}); !ok {
+		return nil, fmt.Errorf("unsupported settings value for schemas. expected array of objects. got: %T", unparsed)
+	}
+
+	var schemas []SchemaConfiguration
+	if err := mapstructure.Decode(unparsed, &schemas); err != nil {
+		return nil, fmt.Errorf("map decode failed: %v", err)
+	}
+	for i, schema := range schemas {
+		if schema.Path == "" {
+			return nil, fmt.Errorf("schemas[%d]: path is required", i)
+		}
+		if schema.APIVersion == "" && schema.Kind == "" && len(schema.FileMatch) == 0 {
+			return nil, fmt.Errorf("schemas[%d]: one of apiVersion, kind or fileMatch is required", i)
+		}
+	}
+	return schemas, nil
+}
+
+func parsePostRenderers(unparsed interface{}) ([]PostRendererConfiguration, error) {
+	if _, ok := unparsed.([]interface{}); !ok {
+		return nil, fmt.Errorf("unsupported settings value for post_renderers. expected array of objects. got: %T", unparsed)
+	}
+
+	var renderers []PostRendererConfiguration
+	if err := mapstructure.Decode(unparsed, &renderers); err != nil {
+		return nil, fmt.Errorf("map decode failed: %v", err)
+	}
+	for i, renderer := range renderers {
+		if len(renderer.Command) == 0 || renderer.Command[0] == "" {
+			return nil, fmt.Errorf("post_renderers[%d]: command is required", i)
+		}
+	}
+	return renderers, nil
+}
+
+func parseGrafana(unparsed interface{}) (GrafanaConfiguration, error) {
+	if _, ok := unparsed.(map[string]interface{}); !ok {
+		return GrafanaConfiguration{}, fmt.Errorf("unsupported settings value for grafana. expected json object. got: %T", unparsed)
+	}
+
+	var grafana GrafanaConfiguration
+	if err := mapstructure.Decode(unparsed, &grafana); err != nil {
+		return GrafanaConfiguration{}, fmt.Errorf("map decode failed: %v", err)
+	}
+	grafana.URL = strings.TrimSuffix(grafana.URL, "/")
+	return grafana, nil
+}
+
+// parseCode parses the ext_code or tla_code setting. The code is evaluated once, when it is set.
+func (s *Server) parseCode(setting string, unparsed interface{}) (map[string]string, error) {
 	newVars, ok := unparsed.(map[string]interface{})
 	if !ok {
-		return nil, fmt.Errorf("unsupported settings value for ext_code. expected json object. got: %T", unparsed)
+		return nil, fmt.Errorf("unsupported settings value for %s. expected json object. got: %T", setting, unparsed)
 	}
 
 	vm := s.getVM(".")
 
-	extCode := make(map[string]string, len(newVars))
+	code := make(map[string]string, len(newVars))
 	for varKey, varValue := range newVars {
 		vv, ok := varValue.(string)
 		if !ok {
-			return nil, fmt.Errorf("unsupported settings value for ext_code.%s. expected string. got: %T", varKey, varValue)
+			return nil, fmt.Errorf("unsupported settings value for %s.%s. expected string. got: %T", setting, varKey, varValue)
 		}
-		jsonResult, _ := vm.EvaluateAnonymousSnippet("ext-code", vv)
-		extCode[varKey] = jsonResult
+		jsonResult, _ := evaluateSnippet(vm, strings.ReplaceAll(setting, "_", "-"), s.expandPlaceholders(vv))
+		code[varKey] = jsonResult
 	}
 
-	return extCode, nil
+	return code, nil
+}
+
+// expandPlaceholders replaces the placeholders of a configuration value: `${env:NAME}` with the value of the
+// environment variable, empty if it isn't set, and `${workspaceFolder}` with the path of the workspace.
+func (s *Server) expandPlaceholders(value string) string {
+	return placeholderRegexp.ReplaceAllStringFunc(value, func(placeholder string) string {
+		if name := placeholderRegexp.FindStringSubmatch(placeholder)[1]; name != "" {
+			return os.Getenv(name)
+		}
+		return s.workspaceFolder
+	})
 }
 
 func resetExtVars(vm *jsonnet.VM, vars map[string]string, code map[string]string) {
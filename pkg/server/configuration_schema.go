@@ -0,0 +1,210 @@
+package server
+
+import (
+	"sort"
+
+	"github.com/google/go-jsonnet/formatter"
+	log "github.com/sirupsen/logrus"
+)
+
+// jsonSchema is the subset of JSON Schema (draft-07) that describes the settings.
+type jsonSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Enum                 []string               `json:"enum,omitempty"`
+	Default              interface{}            `json:"default,omitempty"`
+	Minimum              *int                   `json:"minimum,omitempty"`
+	MinItems             int                    `json:"minItems,omitempty"`
+	Items                *jsonSchema            `json:"items,omitempty"`
+	Properties           map[string]*jsonSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties interface{}            `json:"additionalProperties,omitempty"`
+}
+
+func booleanSetting(description string, defaultValue bool) *jsonSchema {
+	return &jsonSchema{Type: "boolean", Description: description, Default: defaultValue}
+}
+
+func stringSetting(description string) *jsonSchema {
+	return &jsonSchema{Type: "string", Description: description}
+}
+
+func enumSetting(description string, values []string, defaultValue string) *jsonSchema {
+	return &jsonSchema{Type: "string", Description: description, Enum: values, Default: defaultValue}
+}
+
+func sizeSetting(description string) *jsonSchema {
+	minimum := 0
+	return &jsonSchema{Type: "integer", Description: description, Minimum: &minimum, Default: 0}
+}
+
+func stringsSetting(description string) *jsonSchema {
+	return &jsonSchema{Type: "array", Description: description, Items: &jsonSchema{Type: "string"}}
+}
+
+func stringMapSetting(description string, values *jsonSchema) *jsonSchema {
+	return &jsonSchema{Type: "object", Description: description, AdditionalProperties: values}
+}
+
+func objectsSetting(description string, properties map[string]*jsonSchema, required ...string) *jsonSchema {
+	return &jsonSchema{
+		Type:        "array",
+		Description: description,
+		Items:       &jsonSchema{Type: "object", Properties: properties, Required: required},
+	}
+}
+
+// configurationSchema answers jsonnet/configurationSchema, with the JSON Schema of the settings that
+// workspace/didChangeConfiguration accepts. The editor extensions generate their settings UI from it, and validate
+// the configuration of the users with it.
+func (s *Server) configurationSchema() *jsonSchema {
+	logLevels := make([]string, 0, len(log.AllLevels))
+	for _, level := range log.AllLevels {
+		logLevels = append(logLevels, level.String())
+	}
+	detectors := make([]string, 0, len(s.projectDetectors))
+	for name := range s.projectDetectors {
+		detectors = append(detectors, name)
+	}
+	sort.Strings(detectors)
+	fileMatch := stringsSetting("The globs of the files that it applies to, all of them if it is empty")
+
+	settings := map[string]*jsonSchema{
+		"log_level":                enumSetting("The level of the logs", logLevels, log.InfoLevel.String()),
+		"resolve_paths_with_tanka": booleanSetting("Resolve the jpaths of the files with Tanka", false),
+		"project_detectors": {
+			Type:        "array",
+			Description: "The project detectors to run, in order",
+			Items:       &jsonSchema{Type: "string", Enum: detectors},
+		},
+		"jpath":                               stringsSetting("The library search paths"),
+		"entrypoints":                         stringsSetting("The globs of the files that the dead code search starts from, the .jsonnet files if it is unset"),
+		"context_entrypoints":                 stringsSetting("The globs of the files whose external variables, TLAs and jpaths the files they import are evaluated with"),
+		"generated_files":                     stringsSetting("The globs of the generated files, which aren't evaluated nor refactored, like the vendored ones"),
+		"edit_read_only_files":                booleanSetting("Let the refactorings edit the vendored and generated files", false),
+		"sandbox":                             booleanSetting("Only import the files of the workspace folder and of the jpaths, for untrusted repositories", false),
+		"enable_eval_diagnostics":             booleanSetting("Report the evaluation errors of the open documents", false),
+		"enable_lint_diagnostics":             booleanSetting("Report the linter warnings of the open documents", false),
+		"enable_embedded_jsonnet_diagnostics": booleanSetting("Report the syntax errors of the text blocks that contain Jsonnet", false),
+		"lint_mixin_overrides":                booleanSetting("Warn about the mixins that override fields that don't exist", false),
+		"show_docstring_in_completion":        booleanSetting("Show the documentation of the fields in the completion items", false),
+		"enable_status_notifications":         booleanSetting("Send the jsonnet/status notifications", false),
+		"enable_telemetry":                    booleanSetting("Send anonymous usage telemetry", false),
+		"enable_size_code_lenses":             booleanSetting("Show the size of the output of the top-level fields above them", false),
+		"warm_up":                             booleanSetting("Read and index the vendored libraries on startup, and when the jpaths change", true),
+		"shard_index":                         booleanSetting("Index the vendored libraries by top-level directory, the first time one of their files is used", false),
+		"otlp_endpoint":                       stringSetting("The OTLP/HTTP traces endpoint the spans of the requests are sent to"),
+		"trace_file":                          stringSetting("The file the spans of the requests are appended to"),
+		"hover_verbosity": enumSetting("What the hovers show",
+			[]string{hoverVerbositySignature, hoverVerbosityDocs, hoverVerbosityValue}, hoverVerbosityDocs),
+		"hover_max_length":         sizeSetting("The length, in bytes, after which the hovers are cut, 0 for no limit"),
+		"max_file_size":            sizeSetting("The size, in bytes, of the largest file that is analysed, 0 for 10MiB"),
+		"evaluation_budget":        sizeSetting("How long, in milliseconds, the evaluations of a file can take before it is only parsed and linted, 0 for 10s"),
+		"max_parallel_evaluations": sizeSetting("The number of documents that are evaluated at the same time, 0 for GOMAXPROCS"),
+		"schemas": objectsSetting("The JSON Schemas that the objects are completed and validated with", map[string]*jsonSchema{
+			"path":       stringSetting("The path or URL of the schema"),
+			"apiVersion": stringSetting("The apiVersion of the objects"),
+			"kind":       stringSetting("The kind of the objects"),
+			"fileMatch":  fileMatch,
+		}, "path"),
+		"post_renderers": objectsSetting("The commands that the output of the files is piped through", map[string]*jsonSchema{
+			"command":   {Type: "array", Items: &jsonSchema{Type: "string"}, MinItems: 1},
+			"fileMatch": fileMatch,
+		}, "command"),
+		"file_templates": objectsSetting("The templates that empty files can be started from", map[string]*jsonSchema{
+			"name":        stringSetting("The name of the template"),
+			"description": stringSetting("The description of the template"),
+			"body":        stringSetting("The snippet that the file is started with"),
+			"fileMatch":   fileMatch,
+		}, "name", "body"),
+		"policy_bundles": stringsSetting("The Rego policy bundles that the outputs are checked against"),
+		"fix_all": {
+			Type:        "array",
+			Description: "The fixes of the source.fixAll code action, in order",
+			Items:       &jsonSchema{Type: "string", Enum: append([]string(nil), defaultFixAll...)},
+			Default:     defaultFixAll,
+		},
+		"fix_all_on_save": booleanSetting("Apply the fix_all fixes when the documents are saved", false),
+		"grafana": {
+			Type:        "object",
+			Description: "The Grafana instance that the dashboards are previewed on",
+			Properties: map[string]*jsonSchema{
+				"url":        stringSetting("The URL of the instance"),
+				"token":      stringSetting("The service account token"),
+				"folder_uid": stringSetting("The folder that the previews are saved in"),
+			},
+		},
+		"ext_vars":              stringMapSetting("The external variables, by name", &jsonSchema{Type: "string"}),
+		"tla_vars":              stringMapSetting("The top-level arguments, by name", &jsonSchema{Type: "string"}),
+		"ext_code":              stringMapSetting("The code of the external variables, by name", &jsonSchema{Type: "string"}),
+		"tla_code":              stringMapSetting("The code of the top-level arguments, by name", &jsonSchema{Type: "string"}),
+		"import_aliases":        stringMapSetting("The paths that replace the prefixes of the imports, relative to the workspace folder", &jsonSchema{Type: "string"}),
+		"ext_vars_from_files":   stringsSetting("The JSON or YAML files whose values are external variables"),
+		"ext_code_from_command": stringMapSetting("The commands whose outputs are the code of external variables, by name", &jsonSchema{Type: "array", Items: &jsonSchema{Type: "string"}, MinItems: 1}),
+		"tool_paths":            stringMapSetting("The paths of the binaries that the commands of the settings run, by binary", &jsonSchema{Type: "string"}),
+		"allowed_commands":      stringsSetting("The binaries, by name or path, that the commands of the settings can run. Any can if it isn't set"),
+		"confirm_commands":      booleanSetting("Ask before running each command of the settings for the first time", true),
+		"formatting":            formattingSchema(),
+	}
+
+	overridable := make(map[string]*jsonSchema, len(overridableSettings))
+	for name := range overridableSettings {
+		overridable[name] = settings[name]
+	}
+	settings["overrides"] = objectsSetting("The settings of the files that match globs, in order", map[string]*jsonSchema{
+		"glob":     stringSetting("The glob of the files, or of their directories, relative to the workspace folder"),
+		"settings": {Type: "object", Properties: overridable, AdditionalProperties: false},
+	}, "glob", "settings")
+
+	return &jsonSchema{
+		Schema:      "http://json-schema.org/draft-07/schema#",
+		Title:       "Jsonnet Language Server settings",
+		Type:        "object",
+		Properties:  settings,
+		Description: "The settings can also be nested under a jsonnet or jsonnet_ls key",
+	}
+}
+
+// formattingSchema describes the formatting setting: the options of go-jsonnet's formatter, with their defaults, and
+// the passes that the server adds.
+func formattingSchema() *jsonSchema {
+	defaults := formatter.DefaultOptions()
+	minimum := 0
+	stringStyles := map[formatter.StringStyle]string{
+		formatter.StringStyleDouble: "double",
+		formatter.StringStyleSingle: "single",
+		formatter.StringStyleLeave:  "leave",
+	}
+	commentStyles := map[formatter.CommentStyle]string{
+		formatter.CommentStyleHash:  "hash",
+		formatter.CommentStyleSlash: "slash",
+		formatter.CommentStyleLeave: "leave",
+	}
+	return &jsonSchema{
+		Type:        "object",
+		Description: "The options of the formatter",
+		Properties: map[string]*jsonSchema{
+			"indent":          {Type: "integer", Description: "The number of spaces of each level of indentation", Minimum: &minimum, Default: defaults.Indent},
+			"max_blank_lines": {Type: "integer", Description: "The maximum number of consecutive blank lines", Minimum: &minimum, Default: defaults.MaxBlankLines},
+			"string_style": enumSetting("The quotes of the strings",
+				[]string{"double", "single", "leave"}, stringStyles[defaults.StringStyle]),
+			"comment_style": enumSetting("The style of the comments",
+				[]string{"hash", "slash", "leave"}, commentStyles[defaults.CommentStyle]),
+			"pretty_field_names":     booleanSetting("Quote the field names only when needed", defaults.PrettyFieldNames),
+			"pad_arrays":             booleanSetting("Write the arrays like [ this ] instead of [this]", defaults.PadArrays),
+			"pad_objects":            booleanSetting("Write the objects like { this } instead of {this}", defaults.PadObjects),
+			"sort_imports":           booleanSetting("Sort the imports at the top of the files", defaults.SortImports),
+			"use_implicit_plus":      booleanSetting("Remove the plus signs where they aren't required", defaults.UseImplicitPlus),
+			"strip_everything":       booleanSetting("Remove the comments and the blank lines", defaults.StripEverything),
+			"strip_comments":         booleanSetting("Remove the comments", defaults.StripComments),
+			"strip_all_but_comments": booleanSetting("Remove everything but the comments", defaults.StripAllButComments),
+			"max_line_length":        sizeSetting("The length above which the argument lists and arrays are split, one element per line, 0 to disable"),
+			"align_field_values":     booleanSetting("Align the values of the consecutive one-line fields of objects", false),
+			"align_comments":         booleanSetting("Align the trailing comments of consecutive lines", false),
+			"trailing_newline":       booleanSetting("Report the documents that don't end with a newline", false),
+			"trailing_commas":        booleanSetting("Report the multi-line objects and arrays whose elements don't end with commas", false),
+		},
+	}
+}
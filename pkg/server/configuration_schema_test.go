@@ -0,0 +1,77 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/google/go-jsonnet/formatter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigurationSchema(t *testing.T) {
+	s := NewServer("any", "test version", nil, Configuration{})
+	result, err := s.NonstandardRequest(context.Background(), "jsonnet/configurationSchema", nil)
+	require.NoError(t, err)
+
+	// The schema is read as the clients receive it
+	raw, err := json.Marshal(result)
+	require.NoError(t, err)
+	var schema struct {
+		Schema     string `json:"$schema"`
+		Properties map[string]struct {
+			Type       string                     `json:"type"`
+			Default    interface{}                `json:"default"`
+			Enum       []string                   `json:"enum"`
+			Items      map[string]interface{}     `json:"items"`
+			Properties map[string]json.RawMessage `json:"properties"`
+		} `json:"properties"`
+	}
+	require.NoError(t, json.Unmarshal(raw, &schema))
+	assert.Equal(t, "http://json-schema.org/draft-07/schema#", schema.Schema)
+
+	for name, setting := range schema.Properties {
+		config := Configuration{}
+		err := s.applySetting(&config, name, setting.Default)
+		if setting.Default == nil {
+			// Settings without defaults are known, even if null isn't a valid value
+			assert.False(t, errors.Is(err, errUnsupportedSettingsKey), "%s isn't a setting", name)
+		} else {
+			assert.NoError(t, err, "the default of %s is invalid", name)
+		}
+	}
+	for name := range overridableSettings {
+		assert.Contains(t, schema.Properties, name)
+	}
+
+	assert.Equal(t, "string", schema.Properties["hover_verbosity"].Type)
+	assert.Equal(t, []string{"signature", "docs", "value"}, schema.Properties["hover_verbosity"].Enum)
+	assert.Equal(t, "docs", schema.Properties["hover_verbosity"].Default)
+	assert.Equal(t, true, schema.Properties["warm_up"].Default)
+	assert.Equal(t, []interface{}{"bazel", "jb", "kapitan", "qbec", "tanka"}, schema.Properties["project_detectors"].Items["enum"])
+
+	// The defaults of the formatting options are those of the formatter
+	formatting := map[string]interface{}{}
+	for name, raw := range schema.Properties["formatting"].Properties {
+		var option struct {
+			Default interface{} `json:"default"`
+			Enum    []string    `json:"enum"`
+		}
+		require.NoError(t, json.Unmarshal(raw, &option))
+		formatting[name] = option.Default
+		switch name {
+		case "string_style":
+			assert.Equal(t, []string{"double", "single", "leave"}, option.Enum)
+			assert.Equal(t, "single", option.Default)
+		case "comment_style":
+			assert.Equal(t, []string{"hash", "slash", "leave"}, option.Enum)
+			assert.Equal(t, "slash", option.Default)
+		}
+	}
+	config := Configuration{}
+	require.NoError(t, s.applySetting(&config, "formatting", formatting))
+	assert.Equal(t, formatter.DefaultOptions(), config.FormattingOptions)
+	assert.Equal(t, FormattingPasses{}, config.FormattingPasses)
+}
@@ -3,11 +3,17 @@ package server
 import (
 	"context"
 	"errors"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/google/go-jsonnet/formatter"
 	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestConfiguration(t *testing.T) {
@@ -32,8 +38,30 @@ func TestConfiguration(t *testing.T) {
 			settings: map[string]interface{}{
 				"foo_bar": map[string]interface{}{},
 			},
-			fileContent: `[]`,
-			expectedErr: errors.New("JSON RPC invalid params: unsupported settings key: \"foo_bar\""),
+			fileContent:        `[]`,
+			expectedFileOutput: `[]`,
+		},
+		{
+			name: "settings are nested under a prefix",
+			settings: map[string]interface{}{
+				"ext_vars": map[string]interface{}{"hello": "top-level", "top": "level"},
+				"jsonnet": map[string]interface{}{
+					"ext_vars": map[string]interface{}{"hello": "jsonnet"},
+				},
+				"jsonnet_ls": map[string]interface{}{
+					"ext_code": map[string]interface{}{"world": "1 + 1"},
+				},
+			},
+			fileContent:        `[std.extVar('hello'), std.extVar('world')]`,
+			expectedFileOutput: `["jsonnet", 2]`,
+		},
+		{
+			name: "prefix isn't an object",
+			settings: map[string]interface{}{
+				"jsonnet": "enabled",
+			},
+			fileContent:        `[]`,
+			expectedFileOutput: `[]`,
 		},
 		{
 			name: "ext_var config is empty",
@@ -101,6 +129,44 @@ func TestConfiguration(t *testing.T) {
 			fileContent:        `[]`,
 			expectedFileOutput: `[]`,
 		},
+		{
+			name: "schemas config has no match",
+			settings: map[string]interface{}{
+				"schemas": []interface{}{
+					map[string]interface{}{"path": "deployment.json"},
+				},
+			},
+			fileContent: `[]`,
+			expectedErr: errors.New("JSON RPC invalid params: schemas parsing failed: schemas[0]: one of apiVersion, kind or fileMatch is required"),
+		},
+		{
+			name: "post_renderers config has no command",
+			settings: map[string]interface{}{
+				"post_renderers": []interface{}{
+					map[string]interface{}{"fileMatch": []interface{}{"*.jsonnet"}},
+				},
+			},
+			fileContent: `[]`,
+			expectedErr: errors.New("JSON RPC invalid params: post_renderers parsing failed: post_renderers[0]: command is required"),
+		},
+		{
+			name: "file_templates config has no body",
+			settings: map[string]interface{}{
+				"file_templates": []interface{}{
+					map[string]interface{}{"name": "empty"},
+				},
+			},
+			fileContent: `[]`,
+			expectedErr: errors.New("JSON RPC invalid params: file_templates parsing failed: file_templates[0]: body is required"),
+		},
+		{
+			name: "project_detectors config has an unknown detector",
+			settings: map[string]interface{}{
+				"project_detectors": []interface{}{"tanka", "helmfile"},
+			},
+			fileContent: `[]`,
+			expectedErr: errors.New(`JSON RPC invalid params: unsupported settings value for project_detectors. unknown project detector: "helmfile"`),
+		},
 		{
 			name: "ext_code config is valid",
 			settings: map[string]interface{}{
@@ -230,6 +296,51 @@ func TestConfiguration_Formatting(t *testing.T) {
 			},
 			expectedConfiguration: Configuration{FormattingOptions: formatter.DefaultOptions()},
 		},
+		{
+			name: "alignment",
+			settings: map[string]interface{}{
+				"formatting": map[string]interface{}{
+					"Indent":           4,
+					"AlignFieldValues": true,
+					"AlignComments":    true,
+				},
+			},
+			expectedConfiguration: Configuration{
+				FormattingOptions: func() formatter.Options {
+					opts := formatter.DefaultOptions()
+					opts.Indent = 4
+					return opts
+				}(),
+				FormattingPasses: FormattingPasses{AlignFieldValues: true, AlignComments: true},
+			},
+		},
+		{
+			name: "snake case keys",
+			settings: map[string]interface{}{
+				"formatting": map[string]interface{}{
+					"max_blank_lines": 1,
+					"max_line_length": 100,
+					"align_comments":  true,
+				},
+			},
+			expectedConfiguration: Configuration{
+				FormattingOptions: func() formatter.Options {
+					opts := formatter.DefaultOptions()
+					opts.MaxBlankLines = 1
+					return opts
+				}(),
+				FormattingPasses: FormattingPasses{MaxLineLength: 100, AlignComments: true},
+			},
+		},
+		{
+			name: "invalid alignment type",
+			settings: map[string]interface{}{
+				"formatting": map[string]interface{}{
+					"AlignComments": "yes",
+				},
+			},
+			expectedErr: errors.New("JSON RPC invalid params: formatting options parsing failed: map decode failed: 1 error(s) decoding:\n\n* 'AlignComments' expected type 'bool', got unconvertible type 'string', value: 'yes'"),
+		},
 		{
 			name: "invalid jpath type",
 			settings: map[string]interface{}{
@@ -282,10 +393,12 @@ func TestConfiguration_Formatting(t *testing.T) {
 				"ext_code": map[string]interface{}{
 					"hello": "{\"world\": true,}",
 				},
-				"resolve_paths_with_tanka": false,
-				"jpath":                    []interface{}{"blabla", "blabla2"},
-				"enable_eval_diagnostics":  false,
-				"enable_lint_diagnostics":  true,
+				"resolve_paths_with_tanka":            false,
+				"project_detectors":                   []interface{}{"jb", "kapitan"},
+				"jpath":                               []interface{}{"blabla", "blabla2"},
+				"enable_eval_diagnostics":             false,
+				"enable_lint_diagnostics":             true,
+				"enable_embedded_jsonnet_diagnostics": true,
 			},
 			expectedConfiguration: Configuration{
 				FormattingOptions: func() formatter.Options {
@@ -310,10 +423,12 @@ func TestConfiguration_Formatting(t *testing.T) {
 				ExtCode: map[string]string{
 					"hello": "{\n   \"world\": true\n}\n",
 				},
-				ResolvePathsWithTanka: false,
-				JPaths:                []string{"blabla", "blabla2"},
-				EnableEvalDiagnostics: false,
-				EnableLintDiagnostics: true,
+				ResolvePathsWithTanka:            false,
+				ProjectDetectors:                 []string{"jb", "kapitan"},
+				JPaths:                           []string{"blabla", "blabla2"},
+				EnableEvalDiagnostics:            false,
+				EnableLintDiagnostics:            true,
+				EnableEmbeddedJsonnetDiagnostics: true,
 			},
 		},
 	}
@@ -338,3 +453,187 @@ func TestConfiguration_Formatting(t *testing.T) {
 		})
 	}
 }
+
+func TestConfiguration_LoggedRedacted(t *testing.T) {
+	entries := test.NewGlobal()
+	logrus.SetLevel(logrus.InfoLevel)
+	defer func() {
+		logrus.SetLevel(logrus.WarnLevel)
+		logrus.StandardLogger().ReplaceHooks(logrus.LevelHooks{})
+	}()
+	s := NewServer("any", "test version", nil, Configuration{})
+	require.NoError(t, s.DidChangeConfiguration(context.TODO(), &protocol.DidChangeConfigurationParams{
+		Settings: map[string]interface{}{
+			"ext_vars": map[string]interface{}{"token": "hunter2"},
+			"tla_code": map[string]interface{}{"creds": "{ password: 'hunter3' }"},
+			"grafana":  map[string]interface{}{"url": "https://grafana.example.com", "token": "hunter4"},
+			"overrides": []interface{}{
+				map[string]interface{}{
+					"glob":     "environments/*",
+					"settings": map[string]interface{}{"ext_code": map[string]interface{}{"apiKey": "'hunter5'"}},
+				},
+			},
+		},
+	}))
+
+	var logged []string
+	for _, entry := range entries.AllEntries() {
+		if strings.HasPrefix(entry.Message, "configuration updated") {
+			logged = append(logged, entry.Message)
+		}
+	}
+	require.Len(t, logged, 1)
+	// The names of the variables are logged, their values and the token aren't
+	for _, name := range []string{"token", "creds", "apiKey", redactedValue} {
+		assert.Contains(t, logged[0], name)
+	}
+	assert.NotContains(t, logged[0], "hunter")
+	// The server's configuration is left as it is
+	assert.Equal(t, "hunter2", s.configuration.ExtVars["token"])
+	assert.Equal(t, "hunter4", s.configuration.Grafana.Token)
+}
+
+func TestConfiguration_Placeholders(t *testing.T) {
+	t.Setenv("JSONNET_LS_TEST_CLUSTER", "dev-cluster")
+	t.Setenv("JSONNET_LS_TEST_EMPTY", "")
+
+	s := testServer(t, nil)
+	s.workspaceFolder = "/workspace"
+	err := s.DidChangeConfiguration(context.TODO(), &protocol.DidChangeConfigurationParams{
+		Settings: map[string]interface{}{
+			"jpath": []interface{}{"${workspaceFolder}/vendor", "${env:JSONNET_LS_TEST_UNSET}/lib"},
+			"ext_vars": map[string]interface{}{
+				"cluster": "${env:JSONNET_LS_TEST_CLUSTER}",
+				"empty":   "[${env:JSONNET_LS_TEST_EMPTY}]",
+				"other":   "${HOME} ${env:lowercase-not-a-name} $${workspaceFolder}",
+			},
+			"ext_code": map[string]interface{}{
+				"root": "{ path: '${workspaceFolder}' }",
+			},
+			"tla_vars": map[string]interface{}{
+				"cluster": "${env:JSONNET_LS_TEST_CLUSTER}",
+			},
+			"tla_code": map[string]interface{}{
+				"replicas": "1 + 2",
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"/workspace/vendor", "/lib"}, s.configuration.JPaths)
+	assert.Equal(t, map[string]string{
+		"cluster": "dev-cluster",
+		"empty":   "[]",
+		"other":   "${HOME} ${env:lowercase-not-a-name} $/workspace",
+	}, s.configuration.ExtVars)
+	assert.Equal(t, map[string]string{"root": "{\n   \"path\": \"/workspace\"\n}\n"}, s.configuration.ExtCode)
+	assert.Equal(t, map[string]string{"cluster": "dev-cluster"}, s.configuration.TLAVars)
+	assert.Equal(t, map[string]string{"replicas": "3\n"}, s.configuration.TLACode)
+
+	output, err := s.getVM("main.jsonnet").EvaluateAnonymousSnippet("main.jsonnet", `function(cluster, replicas) { cluster: cluster, replicas: replicas, root: std.extVar('root').path }`)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"cluster": "dev-cluster", "replicas": 3, "root": "/workspace"}`, output)
+}
+
+func TestInitialize_WorkspaceFolder(t *testing.T) {
+	testCases := []struct {
+		name     string
+		params   protocol.ParamInitialize
+		expected string
+	}{
+		{
+			name: "workspace folders",
+			params: protocol.ParamInitialize{InitializeParams: protocol.InitializeParams{
+				WorkspaceFolders: []protocol.WorkspaceFolder{{URI: "file:///first"}, {URI: "file:///second"}},
+				RootURI:          "file:///root",
+			}},
+			expected: "/first",
+		},
+		{
+			name:     "root uri",
+			params:   protocol.ParamInitialize{InitializeParams: protocol.InitializeParams{RootURI: "file:///root"}},
+			expected: "/root",
+		},
+		{
+			name:     "root path",
+			params:   protocol.ParamInitialize{InitializeParams: protocol.InitializeParams{RootPath: "/path"}},
+			expected: "/path",
+		},
+		{
+			name: "none",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewServer("any", "test version", nil, Configuration{})
+			_, err := s.Initialize(context.Background(), &tc.params)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, s.workspaceFolder)
+		})
+	}
+}
+
+func TestConfiguration_InvalidSettings(t *testing.T) {
+	client := &recordingClient{}
+	s := NewServer("any", "test version", client, Configuration{
+		JPaths:                []string{"lib"},
+		EnableLintDiagnostics: true,
+	})
+
+	err := s.DidChangeConfiguration(context.TODO(), &protocol.DidChangeConfigurationParams{
+		Settings: map[string]interface{}{
+			"jpath":                   []interface{}{"vendor"},
+			"enable_eval_diagnostics": true,
+			"enable_lint_diagnostics": "no",
+			"ext_vars":                map[string]interface{}{"replicas": 3},
+			"jpath_typo":              []interface{}{"vendor"},
+		},
+	})
+	expectedInvalid := []string{
+		"unsupported settings value for enable_lint_diagnostics. expected boolean. got: string",
+		"ext_vars parsing failed: unsupported settings value for ext_vars.replicas. expected string. got: int",
+	}
+	require.EqualError(t, err, "JSON RPC invalid params: "+strings.Join(expectedInvalid, "; "))
+
+	// None of the settings are applied, the valid ones included
+	assert.Equal(t, Configuration{JPaths: []string{"lib"}, EnableLintDiagnostics: true}, s.configuration)
+	assert.Equal(t, []protocol.ShowMessageParams{{
+		Type:    protocol.Error,
+		Message: "Invalid settings, the previous configuration is kept:\n- " + strings.Join(expectedInvalid, "\n- "),
+	}}, client.getMessages())
+
+	err = s.DidChangeConfiguration(context.TODO(), &protocol.DidChangeConfigurationParams{
+		Settings: map[string]interface{}{"jpath": []interface{}{"vendor"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"vendor"}, s.configuration.JPaths)
+	assert.Len(t, client.getMessages(), 1)
+}
+
+func TestConfiguration_Reanalysis(t *testing.T) {
+	// Without a diagnostics loop, the queue is only read by the test
+	s := NewServer("any", "test version", nil, Configuration{})
+	filename := filepath.Join(t.TempDir(), "main.jsonnet")
+	require.NoError(t, os.WriteFile(filename, []byte("std.extVar('cluster')"), 0o600))
+	uri := serverOpenTestFile(t, s, filename)
+	queued := func() bool {
+		s.cache.diagMutex.Lock()
+		defer s.cache.diagMutex.Unlock()
+		_, ok := s.cache.diagQueue[uri]
+		delete(s.cache.diagQueue, uri)
+		return ok
+	}
+	queued()
+
+	settings := map[string]interface{}{"ext_vars": map[string]interface{}{"cluster": "dev"}}
+	require.NoError(t, s.DidChangeConfiguration(context.TODO(), &protocol.DidChangeConfigurationParams{Settings: settings}))
+	assert.True(t, queued(), "the document should be analysed again when the settings change")
+
+	before, err := s.cache.get(uri)
+	require.NoError(t, err)
+	require.NoError(t, s.DidChangeConfiguration(context.TODO(), &protocol.DidChangeConfigurationParams{Settings: settings}))
+	assert.False(t, queued(), "the document shouldn't be analysed again when the settings don't change")
+	after, err := s.cache.get(uri)
+	require.NoError(t, err)
+	assert.Same(t, before, after)
+}
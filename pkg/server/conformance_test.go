@@ -0,0 +1,202 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-jsonnet/formatter"
+	"github.com/jdbaldry/go-language-server-protocol/jsonrpc2"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var updateSessions = flag.Bool("update-sessions", false, "record the responses of the sessions in testdata/sessions")
+
+// sessionRoot and sessionRootPath are replaced, in the sessions, by the URI and the path of the testdata directory
+const (
+	sessionRoot     = "$ROOT"
+	sessionRootPath = "$ROOT_PATH"
+)
+
+// session is a recorded exchange between a client and the server, replayed by TestConformance.
+type session struct {
+	Description string        `json:"description"`
+	Steps       []sessionStep `json:"steps"`
+}
+
+// sessionStep is a message sent by the client, or a notification the client waits for.
+type sessionStep struct {
+	// Request is the method of a request, whose response is compared to Response, or to Error
+	Request string `json:"request,omitempty"`
+	// Notify is the method of a notification sent to the server
+	Notify string `json:"notify,omitempty"`
+	// Await is the method of a notification sent by the server, the session waits for one whose params are Params
+	Await    string          `json:"await,omitempty"`
+	Params   json.RawMessage `json:"params,omitempty"`
+	Response json.RawMessage `json:"response,omitempty"`
+	Error    string          `json:"error,omitempty"`
+	// SkipResponse doesn't compare the response, for the ones that change with each version, such as initialize's
+	SkipResponse bool `json:"skipResponse,omitempty"`
+}
+
+// sessionClient is the client side of a connection to the server, it records the notifications of the server.
+type sessionClient struct {
+	conn jsonrpc2.Conn
+
+	mu            sync.Mutex
+	notifications []jsonrpc2.Request
+}
+
+// startSessionServer starts a server that talks to the returned client over an in-memory pipe, as it talks to editors
+// over stdio. It has the configuration of a server started without flags.
+func startSessionServer(t *testing.T) *sessionClient {
+	serverPipe, clientPipe := net.Pipe()
+	ctx := context.Background()
+
+	serverConn := jsonrpc2.NewConn(jsonrpc2.NewHeaderStream(serverPipe))
+	s := NewServer("jsonnet-language-server", "test version", protocol.ClientDispatcher(serverConn), Configuration{
+		FormattingOptions: formatter.DefaultOptions(),
+	})
+	s.SetNotifier(serverConn)
+	serverConn.Go(ctx, protocol.Handlers(s.InstrumentHandler(protocol.ServerHandler(s, jsonrpc2.MethodNotFound))))
+
+	client := &sessionClient{conn: jsonrpc2.NewConn(jsonrpc2.NewHeaderStream(clientPipe))}
+	client.conn.Go(ctx, func(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+		if _, isCall := req.(*jsonrpc2.Call); !isCall {
+			client.mu.Lock()
+			client.notifications = append(client.notifications, req)
+			client.mu.Unlock()
+		}
+		return reply(ctx, nil, nil)
+	})
+
+	t.Cleanup(func() {
+		client.conn.Close()
+		serverConn.Close()
+	})
+	return client
+}
+
+// await waits for a notification of the method whose params are the expected ones, the other notifications are kept.
+func (c *sessionClient) await(t *testing.T, method string, expected json.RawMessage) {
+	var last json.RawMessage
+	found := func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for i, notification := range c.notifications {
+			if notification.Method() != method {
+				continue
+			}
+			last = notification.Params()
+			if jsonEqual(expected, last) {
+				c.notifications = append(c.notifications[:i:i], c.notifications[i+1:]...)
+				return true
+			}
+		}
+		return false
+	}
+	if !assert.Eventually(t, found, 5*time.Second, 10*time.Millisecond) {
+		t.Errorf("no %s notification with the params %s, the last one was %s", method, expected, last)
+	}
+}
+
+func jsonEqual(a, b json.RawMessage) bool {
+	var aValue, bValue interface{}
+	if json.Unmarshal(a, &aValue) != nil || json.Unmarshal(b, &bValue) != nil {
+		return false
+	}
+	return assert.ObjectsAreEqual(aValue, bValue)
+}
+
+// requestIDSuffix is the correlation ID that the errors of the requests end with.
+var requestIDSuffix = regexp.MustCompile(` \(request r\d+\)$`)
+
+// replay sends the steps of a session to the server. With -update-sessions, the responses are recorded in the steps
+// instead of being compared.
+func (c *sessionClient) replay(t *testing.T, steps []sessionStep) {
+	ctx := context.Background()
+	for i := range steps {
+		step := &steps[i]
+		switch {
+		case step.Request != "":
+			var response json.RawMessage
+			_, err := c.conn.Call(ctx, step.Request, step.Params, &response)
+			if len(response) == 0 {
+				response = json.RawMessage("null")
+			}
+			if err != nil {
+				// The correlation IDs of the requests change from one run to the next
+				err = errors.New(requestIDSuffix.ReplaceAllString(err.Error(), ""))
+			}
+			if *updateSessions {
+				step.Response, step.Error = nil, ""
+				if err != nil {
+					step.Error = err.Error()
+				} else if !step.SkipResponse && string(response) != "null" {
+					step.Response = response
+				}
+				continue
+			}
+			if step.Error != "" {
+				assert.EqualError(t, err, step.Error, "step %d: %s", i, step.Request)
+				continue
+			}
+			require.NoError(t, err, "step %d: %s", i, step.Request)
+			// The null responses aren't recorded
+			if expected := string(step.Response); !step.SkipResponse && expected == "" {
+				assert.Equal(t, "null", string(response), "step %d: %s", i, step.Request)
+			} else if !step.SkipResponse {
+				assert.JSONEq(t, expected, string(response), "step %d: %s", i, step.Request)
+			}
+		case step.Notify != "":
+			require.NoError(t, c.conn.Notify(ctx, step.Notify, step.Params), "step %d: %s", i, step.Notify)
+		case step.Await != "":
+			c.await(t, step.Await, step.Params)
+		default:
+			t.Fatalf("step %d has no request, notification or awaited notification", i)
+		}
+	}
+}
+
+func TestConformance(t *testing.T) {
+	root, err := filepath.Abs("testdata")
+	require.NoError(t, err)
+	rootURI := string(protocol.URIFromPath(root))
+	files, err := filepath.Glob(filepath.Join("testdata", "sessions", "*.json"))
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+
+	for _, file := range files {
+		t.Run(strings.TrimSuffix(filepath.Base(file), ".json"), func(t *testing.T) {
+			content, err := os.ReadFile(file)
+			require.NoError(t, err)
+			var recorded session
+			replaced := strings.NewReplacer(sessionRootPath, root, sessionRoot, rootURI).Replace(string(content))
+			require.NoError(t, json.Unmarshal([]byte(replaced), &recorded))
+
+			startSessionServer(t).replay(t, recorded.Steps)
+
+			if *updateSessions {
+				var updated bytes.Buffer
+				encoder := json.NewEncoder(&updated)
+				encoder.SetEscapeHTML(false)
+				encoder.SetIndent("", "  ")
+				require.NoError(t, encoder.Encode(recorded))
+				recordedContent := strings.NewReplacer(rootURI, sessionRoot, root, sessionRootPath).Replace(updated.String())
+				require.NoError(t, os.WriteFile(file, []byte(recordedContent), 0o600))
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/go-jsonnet/ast"
+	"github.com/grafana/jsonnet-language-server/pkg/ast/processing"
+	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// crashReport is the summary of a crash bundle. It identifies the document that was being handled without its
+// contents, so that the bundle can be attached to a bug report.
+type crashReport struct {
+	Time      time.Time `json:"time"`
+	Version   string    `json:"version"`
+	Method    string    `json:"method,omitempty"`
+	Panic     string    `json:"panic"`
+	Signature string    `json:"signature"`
+	// URI, TextSHA256 and TextLength describe the document of the request, if it is open
+	URI        protocol.DocumentURI `json:"uri,omitempty"`
+	Position   *protocol.Position   `json:"position,omitempty"`
+	TextSHA256 string               `json:"textSha256,omitempty"`
+	TextLength int                  `json:"textLength,omitempty"`
+	// NodeType is the type of the innermost AST node at the position of the request
+	NodeType string `json:"nodeType,omitempty"`
+}
+
+// crashLocation is what a handler was working on when it panicked.
+type crashLocation struct {
+	method   string
+	uri      protocol.DocumentURI
+	position *protocol.Position
+}
+
+// requestLocation finds the document and the position of the parameters of a request, for the requests that have them.
+func requestLocation(method string, params json.RawMessage) crashLocation {
+	var request struct {
+		TextDocument protocol.TextDocumentIdentifier `json:"textDocument"`
+		Position     *protocol.Position              `json:"position"`
+	}
+	_ = json.Unmarshal(params, &request)
+	return crashLocation{method: method, uri: request.TextDocument.URI, position: request.Position}
+}
+
+// writeCrashBundle writes what is known of a panic to a new temporary directory: a summary of the request and of its
+// document, the stack trace and the configuration, without the values of its variables. The user is told where it is. It must be called from the deferred
+// function that recovered the panic, for the stack trace to be the one of the panic.
+func (s *Server) writeCrashBundle(recovered interface{}, stack []byte, location crashLocation) string {
+	report := crashReport{
+		Time:      time.Now(),
+		Version:   s.version,
+		Method:    location.method,
+		Panic:     fmt.Sprint(recovered),
+		Signature: crashSignature(recovered),
+		URI:       location.uri,
+		Position:  location.position,
+	}
+	if doc, err := s.cache.get(location.uri); err == nil {
+		sum := sha256.Sum256([]byte(doc.item.Text))
+		report.TextSHA256 = hex.EncodeToString(sum[:])
+		report.TextLength = len(doc.item.Text)
+		if location.position != nil && doc.ast != nil {
+			report.NodeType = nodeTypeAt(doc.ast, *location.position)
+		}
+	}
+
+	dir, err := os.MkdirTemp("", "jsonnet-language-server-crash-")
+	if err != nil {
+		log.Errorf("writeCrashBundle: unable to create the directory: %v", err)
+		return ""
+	}
+	summary, _ := json.MarshalIndent(report, "", "  ")
+	configuration := s.config().redacted()
+	config, err := json.MarshalIndent(configuration, "", "  ")
+	if err != nil {
+		config = []byte(fmt.Sprintf("%+v", configuration))
+	}
+	for name, content := range map[string][]byte{"crash.json": summary, "stack.txt": stack, "configuration.json": config} {
+		if err := os.WriteFile(filepath.Join(dir, name), content, 0o600); err != nil {
+			log.Errorf("writeCrashBundle: unable to write %s: %v", name, err)
+		}
+	}
+
+	message := fmt.Sprintf("The Jsonnet language server crashed while handling %s. A crash report was written to %s, please attach it to a bug report.", location.method, dir)
+	log.Error(message)
+	if s.client != nil {
+		if err := s.client.ShowMessage(context.Background(), &protocol.ShowMessageParams{Type: protocol.Error, Message: message}); err != nil {
+			log.Errorf("writeCrashBundle: unable to show the message: %v", err)
+		}
+	}
+	return dir
+}
+
+// nodeTypeAt returns the type of the innermost node at the position, which the crash likely happened on. The lookup
+// itself may panic on the AST that crashed the handler.
+func nodeTypeAt(root ast.Node, pos protocol.Position) (nodeType string) {
+	defer func() {
+		if r := recover(); r != nil {
+			nodeType = ""
+		}
+	}()
+	stack, err := processing.FindNodeByPosition(root, position.ProtocolToAST(pos))
+	if err != nil || stack.IsEmpty() {
+		return ""
+	}
+	return fmt.Sprintf("%T", stack.Peek())
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/jsonrpc2"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteCrashBundle(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	client := &recordingClient{}
+	server := NewServer("jsonnet-language-server", "dev", client, Configuration{
+		JPaths:  []string{"vendor"},
+		ExtVars: map[string]string{"token": "hunter2"},
+		ExtCode: map[string]string{"creds": "{ password: 'hunter2' }"},
+		TLAVars: map[string]string{"apiKey": "hunter2"},
+		TLACode: map[string]string{"cluster": "{ token: 'hunter2' }"},
+		Grafana: GrafanaConfiguration{URL: "https://grafana.example.com", Token: "hunter2"},
+	})
+	uri := protocol.URIFromPath(filepath.Join(t.TempDir(), "main.jsonnet"))
+	require.NoError(t, server.DidOpen(context.Background(), &protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{URI: uri, Text: "local secret = 'x';\n{ a: secret }", Version: 1},
+	}))
+
+	handler := server.InstrumentHandler(func(context.Context, jsonrpc2.Replier, jsonrpc2.Request) error {
+		panic("index out of range")
+	})
+	call, err := jsonrpc2.NewCall(jsonrpc2.NewIntID(1), "textDocument/hover", &protocol.HoverParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     protocol.Position{Line: 1, Character: 6},
+		},
+	})
+	require.NoError(t, err)
+	assert.Panics(t, func() {
+		_ = handler(context.Background(), nil, call)
+	})
+
+	// The user is told where the bundle is
+	messages := client.getMessages()
+	require.Len(t, messages, 1)
+	assert.Equal(t, protocol.Error, messages[0].Type)
+	dirs, err := filepath.Glob(filepath.Join(tmp, "jsonnet-language-server-crash-*"))
+	require.NoError(t, err)
+	require.Len(t, dirs, 1)
+	assert.Contains(t, messages[0].Message, dirs[0])
+
+	// The document is identified by the hash of its text, which is left out
+	summary, err := os.ReadFile(filepath.Join(dirs[0], "crash.json"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(summary), "secret")
+	var report crashReport
+	require.NoError(t, json.Unmarshal(summary, &report))
+	assert.Equal(t, "textDocument/hover", report.Method)
+	assert.Equal(t, "index out of range", report.Panic)
+	assert.Len(t, report.Signature, 16)
+	assert.Equal(t, uri, report.URI)
+	assert.Equal(t, &protocol.Position{Line: 1, Character: 6}, report.Position)
+	assert.Len(t, report.TextSHA256, 64)
+	assert.Equal(t, 33, report.TextLength)
+	assert.Equal(t, "*ast.Var", report.NodeType)
+
+	stack, err := os.ReadFile(filepath.Join(dirs[0], "stack.txt"))
+	require.NoError(t, err)
+	assert.True(t, strings.Contains(string(stack), "TestWriteCrashBundle"), "the stack trace is the one of the panic")
+
+	config, err := os.ReadFile(filepath.Join(dirs[0], "configuration.json"))
+	require.NoError(t, err)
+	assert.Contains(t, string(config), `"vendor"`)
+	// The values of the variables and the token are left out, their names are kept
+	assert.NotContains(t, string(config), "hunter2")
+	var configuration Configuration
+	require.NoError(t, json.Unmarshal(config, &configuration))
+	assert.Equal(t, map[string]string{"token": redactedValue}, configuration.ExtVars)
+	assert.Equal(t, map[string]string{"creds": redactedValue}, configuration.ExtCode)
+	assert.Equal(t, map[string]string{"apiKey": redactedValue}, configuration.TLAVars)
+	assert.Equal(t, map[string]string{"cluster": redactedValue}, configuration.TLACode)
+	assert.Equal(t, GrafanaConfiguration{URL: "https://grafana.example.com", Token: redactedValue}, configuration.Grafana)
+	// The server's configuration is left as it is
+	assert.Equal(t, "hunter2", server.config().ExtVars["token"])
+}
+
+func TestRequestLocation(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		params   string
+		expected crashLocation
+	}{
+		{
+			name:     "document and position",
+			params:   `{"textDocument": {"uri": "file:///a.jsonnet"}, "position": {"line": 1, "character": 2}}`,
+			expected: crashLocation{method: "m", uri: "file:///a.jsonnet", position: &protocol.Position{Line: 1, Character: 2}},
+		},
+		{
+			name:     "document",
+			params:   `{"textDocument": {"uri": "file:///a.jsonnet"}}`,
+			expected: crashLocation{method: "m", uri: "file:///a.jsonnet"},
+		},
+		{
+			name:     "no document",
+			params:   `{"settings": {}}`,
+			expected: crashLocation{method: "m"},
+		},
+		{
+			name:     "no parameters",
+			expected: crashLocation{method: "m"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, requestLocation("m", json.RawMessage(tc.params)))
+		})
+	}
+}
@@ -0,0 +1,258 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// GrafanaConfiguration is the Grafana instance that jsonnet.previewDashboard saves the dashboards to.
+type GrafanaConfiguration struct {
+	URL       string `mapstructure:"url"`
+	Token     string `mapstructure:"token"`
+	FolderUID string `mapstructure:"folder_uid"`
+}
+
+// dashboardPreviewResult is the result of jsonnet.previewDashboard.
+type dashboardPreviewResult struct {
+	URL string `json:"url"`
+}
+
+// previewDashboard evaluates a file whose output is a Grafana dashboard, and shows it. The dashboard is saved to
+// the configured Grafana instance, or served by the server's own preview page when there is none.
+func (s *Server) previewDashboard(ctx context.Context, params *protocol.ExecuteCommandParams) (interface{}, error) {
+	args := params.Arguments
+	if len(args) != 1 {
+		return nil, fmt.Errorf("expected 1 argument, got %d", len(args))
+	}
+
+	var fileName string
+	if err := json.Unmarshal(args[0], &fileName); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal file name: %v", err)
+	}
+
+	output, err := s.evaluateFile(ctx, fileName, "")
+	if err != nil {
+		return nil, err
+	}
+	if output, err = s.postRender(ctx, fileName, output); err != nil {
+		return nil, err
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(output), &value); err != nil {
+		return nil, fmt.Errorf("failed to parse the output: %w", err)
+	}
+	dashboard, ok := findDashboard(value)
+	if !ok {
+		return nil, fmt.Errorf("the output of %s is not a Grafana dashboard", fileName)
+	}
+
+	var url string
+	if grafana := s.config().Grafana; grafana.URL != "" {
+		url, err = saveDashboard(ctx, grafana, dashboard)
+	} else {
+		url, err = s.dashboardPreview.show(fileName, dashboard)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if s.client != nil {
+		go func() {
+			// The command's response must not wait for the client to open the page
+			if _, err := s.client.ShowDocument(context.Background(), &protocol.ShowDocumentParams{URI: protocol.URI(url), External: true}); err != nil {
+				log.Debugf("previewDashboard: the client didn't show %s: %v", url, err)
+			}
+		}()
+	}
+	return dashboardPreviewResult{URL: url}, nil
+}
+
+// findDashboard returns the dashboard JSON model of an output: the output itself, or its `dashboard` field as in
+// the payloads of the Grafana API.
+func findDashboard(value interface{}) (map[string]interface{}, bool) {
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	if wrapped, ok := object["dashboard"].(map[string]interface{}); ok {
+		object = wrapped
+	}
+
+	_, hasPanels := object["panels"].([]interface{})
+	_, hasRows := object["rows"].([]interface{})
+	_, hasTitle := object["title"].(string)
+	_, hasSchemaVersion := object["schemaVersion"]
+	return object, (hasPanels || hasRows) && (hasTitle || hasSchemaVersion)
+}
+
+// saveDashboard saves the dashboard with the Grafana HTTP API and returns its URL.
+func saveDashboard(ctx context.Context, grafana GrafanaConfiguration, dashboard map[string]interface{}) (string, error) {
+	// The id is specific to the instance the dashboard was exported from, the uid identifies it
+	model := make(map[string]interface{}, len(dashboard))
+	for key, value := range dashboard {
+		model[key] = value
+	}
+	delete(model, "id")
+
+	body, err := json.Marshal(map[string]interface{}{
+		"dashboard": model,
+		"folderUid": grafana.FolderUID,
+		"overwrite": true,
+		"message":   "Preview from the Jsonnet language server",
+	})
+	if err != nil {
+		return "", err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, grafana.URL+"/api/dashboards/db", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if grafana.Token != "" {
+		request.Header.Set("Authorization", "Bearer "+grafana.Token)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return "", fmt.Errorf("failed to save the dashboard to Grafana: %w", err)
+	}
+	defer response.Body.Close()
+
+	responseBody, err := io.ReadAll(response.Body)
+	if err != nil {
+		return "", err
+	}
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to save the dashboard to Grafana: %s: %s", response.Status, strings.TrimSpace(string(responseBody)))
+	}
+
+	var saved struct {
+		URL string `json:"url"`
+	}
+	if err := json.Unmarshal(responseBody, &saved); err != nil {
+		return "", fmt.Errorf("failed to parse the Grafana response: %w", err)
+	}
+	return grafana.URL + saved.URL, nil
+}
+
+// dashboardPreview serves the dashboards of the files, on the loopback interface, when there is no Grafana instance to
+// save them to. It is started by the first preview.
+type dashboardPreview struct {
+	mu         sync.Mutex
+	address    string
+	dashboards map[string]map[string]interface{}
+}
+
+func newDashboardPreview() *dashboardPreview {
+	return &dashboardPreview{dashboards: map[string]map[string]interface{}{}}
+}
+
+// show stores the dashboard of a file and returns the URL of its page, which shows the latest dashboard of the file.
+func (p *dashboardPreview) show(fileName string, dashboard map[string]interface{}) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.address == "" {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return "", fmt.Errorf("failed to start the dashboard preview: %w", err)
+		}
+		p.address = listener.Addr().String()
+		go func() {
+			if err := http.Serve(listener, p); err != nil {
+				log.Errorf("dashboardPreview: %v", err)
+			}
+		}()
+	}
+
+	hash := sha256.Sum256([]byte(fileName))
+	id := hex.EncodeToString(hash[:8])
+	p.dashboards[id] = dashboard
+	return fmt.Sprintf("http://%s/dashboards/%s", p.address, id), nil
+}
+
+var dashboardPreviewTemplate = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{ .Title }}</title></head>
+<body>
+<h1>{{ .Title }}</h1>
+<table>
+<tr><th>Panel</th><th>Type</th><th>Position</th></tr>
+{{- range .Panels }}
+<tr><td>{{ .Title }}</td><td>{{ .Type }}</td><td>{{ .GridPos }}</td></tr>
+{{- end }}
+</table>
+<pre>{{ .JSON }}</pre>
+</body>
+</html>
+`))
+
+type dashboardPreviewPanel struct {
+	Title   string
+	Type    string
+	GridPos string
+}
+
+func (p *dashboardPreview) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	dashboard, ok := p.dashboards[strings.TrimPrefix(r.URL.Path, "/dashboards/")]
+	p.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	output, err := json.MarshalIndent(dashboard, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data := struct {
+		Title  string
+		Panels []dashboardPreviewPanel
+		JSON   string
+	}{JSON: string(output)}
+	data.Title, _ = dashboard["title"].(string)
+
+	// The panels of the rows of older dashboards are listed along with the others
+	panels, _ := dashboard["panels"].([]interface{})
+	rows, _ := dashboard["rows"].([]interface{})
+	for _, row := range rows {
+		if row, ok := row.(map[string]interface{}); ok {
+			rowPanels, _ := row["panels"].([]interface{})
+			panels = append(panels, rowPanels...)
+		}
+	}
+	for _, panel := range panels {
+		panel, ok := panel.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		previewPanel := dashboardPreviewPanel{}
+		previewPanel.Title, _ = panel["title"].(string)
+		previewPanel.Type, _ = panel["type"].(string)
+		if gridPos, ok := panel["gridPos"].(map[string]interface{}); ok {
+			previewPanel.GridPos = fmt.Sprintf("x=%v y=%v w=%v h=%v", gridPos["x"], gridPos["y"], gridPos["w"], gridPos["h"])
+		}
+		data.Panels = append(data.Panels, previewPanel)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dashboardPreviewTemplate.Execute(w, data); err != nil {
+		log.Errorf("dashboardPreview: %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testDashboard = `{
+  id: 12,
+  uid: 'preview',
+  title: 'Service overview',
+  schemaVersion: 39,
+  panels: [
+    { title: 'Requests', type: 'timeseries', gridPos: { x: 0, y: 0, w: 12, h: 8 } },
+  ],
+}`
+
+func previewDashboardCommand(t *testing.T, server *Server, content string) (interface{}, error) {
+	t.Helper()
+
+	filename := filepath.Join(t.TempDir(), "dashboard.jsonnet")
+	require.NoError(t, os.WriteFile(filename, []byte(content), 0o600))
+	arg, err := json.Marshal(filename)
+	require.NoError(t, err)
+	return server.ExecuteCommand(context.Background(), &protocol.ExecuteCommandParams{
+		Command:   "jsonnet.previewDashboard",
+		Arguments: []json.RawMessage{arg},
+	})
+}
+
+func TestFindDashboard(t *testing.T) {
+	testCases := []struct {
+		name     string
+		output   string
+		expected bool
+	}{
+		{name: "dashboard", output: `{"title": "a", "panels": []}`, expected: true},
+		{name: "dashboard with rows", output: `{"schemaVersion": 16, "rows": []}`, expected: true},
+		{name: "wrapped dashboard", output: `{"dashboard": {"title": "a", "panels": []}, "folderUid": "b"}`, expected: true},
+		{name: "object without panels", output: `{"title": "a"}`},
+		{name: "array", output: `[{"title": "a", "panels": []}]`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var value interface{}
+			require.NoError(t, json.Unmarshal([]byte(tc.output), &value))
+			_, ok := findDashboard(value)
+			assert.Equal(t, tc.expected, ok)
+		})
+	}
+}
+
+func TestPreviewDashboardGrafana(t *testing.T) {
+	var received map[string]interface{}
+	grafana := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/dashboards/db", r.URL.Path)
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		_, _ = w.Write([]byte(`{"status": "success", "uid": "preview", "url": "/d/preview/service-overview"}`))
+	}))
+	defer grafana.Close()
+
+	server := NewServer("any", "test version", nil, Configuration{
+		Grafana: GrafanaConfiguration{URL: grafana.URL, Token: "secret", FolderUID: "previews"},
+	})
+
+	result, err := previewDashboardCommand(t, server, testDashboard)
+	require.NoError(t, err)
+	assert.Equal(t, dashboardPreviewResult{URL: grafana.URL + "/d/preview/service-overview"}, result)
+
+	assert.Equal(t, "previews", received["folderUid"])
+	assert.Equal(t, true, received["overwrite"])
+	dashboard, ok := received["dashboard"].(map[string]interface{})
+	require.True(t, ok)
+	assert.Equal(t, "Service overview", dashboard["title"])
+	assert.NotContains(t, dashboard, "id")
+}
+
+func TestPreviewDashboardGrafanaError(t *testing.T) {
+	grafana := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, `{"message": "invalid API key"}`, http.StatusUnauthorized)
+	}))
+	defer grafana.Close()
+
+	server := NewServer("any", "test version", nil, Configuration{Grafana: GrafanaConfiguration{URL: grafana.URL}})
+	_, err := previewDashboardCommand(t, server, testDashboard)
+	assert.ErrorContains(t, err, "401 Unauthorized")
+}
+
+func TestPreviewDashboardEmbedded(t *testing.T) {
+	server := NewServer("any", "test version", nil, Configuration{})
+
+	result, err := previewDashboardCommand(t, server, testDashboard)
+	require.NoError(t, err)
+	preview, ok := result.(dashboardPreviewResult)
+	require.True(t, ok)
+
+	response, err := http.Get(preview.URL)
+	require.NoError(t, err)
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Contains(t, string(body), "<h1>Service overview</h1>")
+	assert.Contains(t, string(body), "<td>Requests</td><td>timeseries</td><td>x=0 y=0 w=12 h=8</td>")
+}
+
+func TestPreviewDashboardNotADashboard(t *testing.T) {
+	server := NewServer("any", "test version", nil, Configuration{})
+	_, err := previewDashboardCommand(t, server, `{ hello: 'world' }`)
+	assert.ErrorContains(t, err, "is not a Grafana dashboard")
+}
@@ -0,0 +1,337 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/go-jsonnet/ast"
+	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
+	"github.com/grafana/jsonnet-language-server/pkg/utils"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+const deadCodeDiagnosticSource = "dead-code"
+
+// defaultEntrypoints are the globs of the entrypoints when the entrypoints setting isn't set.
+var defaultEntrypoints = []string{"**/*.jsonnet"}
+
+// deadCodeField is a field of a library that no file reachable from the entrypoints refers to.
+type deadCodeField struct {
+	Name     string            `json:"name"`
+	Location protocol.Location `json:"location"`
+}
+
+// deadCodeReport is the result of jsonnet.deadCode.
+type deadCodeReport struct {
+	Entrypoints int                    `json:"entrypoints"`
+	Files       []protocol.DocumentURI `json:"files"`
+	Fields      []deadCodeField        `json:"fields"`
+	// Report is a Markdown document of the dead code, for the clients to show
+	Report string `json:"report"`
+}
+
+// deadCodeDiagnostics are the diagnostics of the last jsonnet.deadCode command that published them, by file, along
+// with the text they were computed from. They are dropped from the open documents once they are edited.
+type deadCodeDiagnostics struct {
+	mu    sync.Mutex
+	files map[protocol.DocumentURI]deadCodeFileDiagnostics
+}
+
+type deadCodeFileDiagnostics struct {
+	text  string
+	diags []protocol.Diagnostic
+}
+
+func newDeadCodeDiagnostics() *deadCodeDiagnostics {
+	return &deadCodeDiagnostics{files: map[protocol.DocumentURI]deadCodeFileDiagnostics{}}
+}
+
+// get returns the diagnostics of a document, if its text is still the one they were computed from.
+func (d *deadCodeDiagnostics) get(doc *document) []protocol.Diagnostic {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	file, ok := d.files[doc.item.URI]
+	if !ok || file.text != doc.item.Text {
+		return nil
+	}
+	return file.diags
+}
+
+// deadCode reports the library files that aren't imported, and the library fields that aren't referred to, from the
+// entrypoints of the workspace. The optional argument is where the report goes: "report", the default, only returns
+// it, and "diagnostics" also publishes it as diagnostics.
+func (s *Server) deadCode(ctx context.Context, params *protocol.ExecuteCommandParams) (interface{}, error) {
+	args := params.Arguments
+	if len(args) > 1 {
+		return nil, fmt.Errorf("expected at most 1 argument, got %d", len(args))
+	}
+	output := "report"
+	if len(args) == 1 {
+		if err := json.Unmarshal(args[0], &output); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal output: %v", err)
+		}
+	}
+	if output != "report" && output != "diagnostics" {
+		return nil, fmt.Errorf("unknown output %q, expected report or diagnostics", output)
+	}
+	if s.workspaceFolder == "" {
+		return nil, fmt.Errorf("the dead code of a workspace can't be found without a workspace folder")
+	}
+
+	report, err := s.findDeadCode(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if output == "diagnostics" {
+		s.publishDeadCode(report)
+	}
+	return report, nil
+}
+
+// findDeadCode follows the imports from the entrypoints, without evaluating them. The fields are looked up by name:
+// a field of a library is used if one of the reachable files indexes a field with its name, or extends one.
+func (s *Server) findDeadCode(ctx context.Context) (deadCodeReport, error) {
+	entrypoints := s.config().Entrypoints
+	if entrypoints == nil {
+		entrypoints = defaultEntrypoints
+	}
+
+	var files, queue []string
+	err := filepath.WalkDir(s.workspaceFolder, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if entry.IsDir() {
+			// The vendored libraries aren't the workspace's to prune
+			if path != s.workspaceFolder && (strings.HasPrefix(entry.Name(), ".") || entry.Name() == "vendor") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if ext := filepath.Ext(path); ext != ".jsonnet" && ext != ".libsonnet" {
+			return nil
+		}
+		files = append(files, path)
+		rel, err := filepath.Rel(s.workspaceFolder, path)
+		if err != nil {
+			return nil
+		}
+		for _, glob := range entrypoints {
+			if utils.MatchGlob(glob, filepath.ToSlash(rel)) {
+				queue = append(queue, path)
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return deadCodeReport{}, fmt.Errorf("failed to list the files of the workspace: %w", err)
+	}
+	isEntrypoint := map[string]bool{}
+	for _, path := range queue {
+		isEntrypoint[path] = true
+	}
+
+	reachable := map[string]ast.Node{}
+	usedFields := map[string]bool{}
+	for len(queue) > 0 {
+		if ctx.Err() != nil {
+			return deadCodeReport{}, ctx.Err()
+		}
+		path := queue[0]
+		queue = queue[1:]
+		if _, ok := reachable[path]; ok {
+			continue
+		}
+		root, err := snippetToAST(path, s.readWorkspaceFile(path))
+		if err != nil {
+			log.Debugf("deadCode: unable to parse %s: %v", path, err)
+		}
+		reachable[path] = root
+
+		config := s.configurationFor(path)
+		settings := s.projectSettings(config, path)
+		importer := s.getImporter(config, path, settings)
+		walk(root, func(node ast.Node) {
+			var imported string
+			switch node := node.(type) {
+			case *ast.Import:
+				imported = node.File.Value
+			case *ast.ImportStr:
+				imported = node.File.Value
+			case *ast.ImportBin:
+				imported = node.File.Value
+			case *ast.Index:
+				if name, ok := node.Index.(*ast.LiteralString); ok {
+					usedFields[name.Value] = true
+				}
+			case *ast.DesugaredObject:
+				for _, field := range node.Fields {
+					if name, ok := field.Name.(*ast.LiteralString); ok && field.PlusSuper {
+						usedFields[name.Value] = true
+					}
+				}
+			}
+			if imported == "" {
+				return
+			}
+			if _, foundAt, err := importer.Import(path, imported); err == nil {
+				if abs, err := filepath.Abs(foundAt); err == nil {
+					queue = append(queue, abs)
+				}
+			}
+		})
+	}
+
+	report := deadCodeReport{Entrypoints: len(isEntrypoint)}
+	for _, path := range files {
+		root, ok := reachable[path]
+		if !ok {
+			report.Files = append(report.Files, protocol.URIFromPath(path))
+			continue
+		}
+		if isEntrypoint[path] {
+			continue
+		}
+		for _, field := range topLevelFields(root) {
+			name, ok := field.Name.(*ast.LiteralString)
+			if !ok || strings.HasPrefix(name.Value, "#") || usedFields[name.Value] || field.LocRange.FileName != path {
+				continue
+			}
+			report.Fields = append(report.Fields, deadCodeField{
+				Name: name.Value,
+				Location: protocol.Location{
+					URI:   protocol.URIFromPath(path),
+					Range: position.RangeASTToProtocol(fieldNameRange(field, name.Value)),
+				},
+			})
+		}
+	}
+	sort.Slice(report.Fields, func(i, j int) bool {
+		a, b := report.Fields[i].Location, report.Fields[j].Location
+		if a.URI != b.URI {
+			return a.URI < b.URI
+		}
+		return a.Range.Start.Line < b.Range.Start.Line
+	})
+	report.Report = s.deadCodeMarkdown(report)
+	return report, nil
+}
+
+// topLevelFields returns the fields of the object that a file evaluates to, after its locals.
+func topLevelFields(root ast.Node) []ast.DesugaredObjectField {
+	for {
+		switch node := root.(type) {
+		case *ast.Local:
+			root = node.Body
+		case *ast.DesugaredObject:
+			return node.Fields
+		default:
+			return nil
+		}
+	}
+}
+
+func fieldNameRange(field ast.DesugaredObjectField, name string) ast.LocationRange {
+	begin := field.LocRange.Begin
+	return ast.LocationRange{
+		FileName: field.LocRange.FileName,
+		Begin:    begin,
+		End:      ast.Location{Line: begin.Line, Column: begin.Column + len(name)},
+	}
+}
+
+// readWorkspaceFile returns the text of a file, from the cache if it is open.
+func (s *Server) readWorkspaceFile(path string) string {
+	if doc, err := s.cache.get(protocol.URIFromPath(path)); err == nil {
+		return doc.item.Text
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return string(content)
+}
+
+func (s *Server) deadCodeMarkdown(report deadCodeReport) string {
+	relative := func(uri protocol.DocumentURI) string {
+		path := uri.SpanURI().Filename()
+		if rel, err := filepath.Rel(s.workspaceFolder, path); err == nil {
+			return filepath.ToSlash(rel)
+		}
+		return path
+	}
+
+	var b strings.Builder
+	b.WriteString("# Dead code\n\n")
+	fmt.Fprintf(&b, "From %d entrypoints.\n", report.Entrypoints)
+	if len(report.Files) == 0 && len(report.Fields) == 0 {
+		b.WriteString("\nNo dead code was found.\n")
+		return b.String()
+	}
+	if len(report.Files) > 0 {
+		b.WriteString("\n## Files that are never imported\n\n")
+		for _, uri := range report.Files {
+			fmt.Fprintf(&b, "- `%s`\n", relative(uri))
+		}
+	}
+	if len(report.Fields) > 0 {
+		b.WriteString("\n## Fields that are never referred to\n\n")
+		for _, field := range report.Fields {
+			fmt.Fprintf(&b, "- `%s:%d` `%s`\n", relative(field.Location.URI), field.Location.Range.Start.Line+1, field.Name)
+		}
+	}
+	return b.String()
+}
+
+// publishDeadCode publishes the report as diagnostics, and clears the diagnostics of the previous report. The open
+// documents are analysed again, their diagnostics include the report's.
+func (s *Server) publishDeadCode(report deadCodeReport) {
+	diags := map[protocol.DocumentURI][]protocol.Diagnostic{}
+	for _, uri := range report.Files {
+		diags[uri] = append(diags[uri], protocol.Diagnostic{
+			Severity: protocol.SeverityHint,
+			Tags:     []protocol.DiagnosticTag{protocol.Unnecessary},
+			Source:   deadCodeDiagnosticSource,
+			Message:  "the file is never imported from the entrypoints",
+		})
+	}
+	for _, field := range report.Fields {
+		diags[field.Location.URI] = append(diags[field.Location.URI], protocol.Diagnostic{
+			Range:    field.Location.Range,
+			Severity: protocol.SeverityHint,
+			Tags:     []protocol.DiagnosticTag{protocol.Unnecessary},
+			Source:   deadCodeDiagnosticSource,
+			Message:  fmt.Sprintf("the field %s is never referred to from the entrypoints", field.Name),
+		})
+	}
+
+	s.deadCodeDiags.mu.Lock()
+	previous := s.deadCodeDiags.files
+	s.deadCodeDiags.files = map[protocol.DocumentURI]deadCodeFileDiagnostics{}
+	for uri, fileDiags := range diags {
+		s.deadCodeDiags.files[uri] = deadCodeFileDiagnostics{text: s.readWorkspaceFile(uri.SpanURI().Filename()), diags: fileDiags}
+	}
+	s.deadCodeDiags.mu.Unlock()
+
+	for uri := range previous {
+		if _, ok := diags[uri]; !ok {
+			diags[uri] = []protocol.Diagnostic{}
+		}
+	}
+	for uri, fileDiags := range diags {
+		if _, err := s.cache.get(uri); err == nil {
+			s.queueDiagnostics(uri)
+			continue
+		}
+		s.diagPublisher.publish(uri, 0, fileDiags)
+	}
+}
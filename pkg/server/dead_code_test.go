@@ -0,0 +1,133 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-jsonnet/formatter"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func deadCodeTestFiles(t *testing.T) string {
+	t.Helper()
+	return writeProjectFiles(t, map[string]string{
+		"environments/prod/main.jsonnet": `local app = import '../../lib/app.libsonnet';
+local k = import 'k.libsonnet';
+app.new('prod') + { config+: { replicas: 3 } } + k.deployment`,
+		"lib/app.libsonnet": `local helpers = import 'helpers.libsonnet';
+{
+  '#new': 'docs are skipped',
+  new(name): { name: name, image: helpers.image(self.image) },
+  image: 'app',
+  config: {},
+  unused: true,
+  alsoUnused(x): x,
+}`,
+		"lib/helpers.libsonnet": `{ image(name): name, unusedHelper: null }`,
+		"lib/old.libsonnet":     `{ old: true }`,
+		"lib/config.json":       `{}`,
+		"vendor/k.libsonnet":    `{ deployment: {}, service: {} }`,
+	})
+}
+
+func TestDeadCode(t *testing.T) {
+	root := deadCodeTestFiles(t)
+	s := NewServer("jsonnet-language-server", "dev", &recordingClient{}, Configuration{FormattingOptions: formatter.DefaultOptions()})
+	s.workspaceFolder = root
+	require.NoError(t, s.DidChangeConfiguration(context.TODO(), &protocol.DidChangeConfigurationParams{
+		Settings: map[string]interface{}{"jpath": []interface{}{filepath.Join(root, "vendor")}},
+	}))
+
+	result, err := s.ExecuteCommand(context.TODO(), &protocol.ExecuteCommandParams{Command: "jsonnet.deadCode"})
+	require.NoError(t, err)
+	report := result.(deadCodeReport)
+
+	app := protocol.URIFromPath(filepath.Join(root, "lib/app.libsonnet"))
+	helpers := protocol.URIFromPath(filepath.Join(root, "lib/helpers.libsonnet"))
+	assert.Equal(t, 1, report.Entrypoints)
+	assert.Equal(t, []protocol.DocumentURI{protocol.URIFromPath(filepath.Join(root, "lib/old.libsonnet"))}, report.Files)
+	assert.Equal(t, []deadCodeField{
+		{Name: "unused", Location: protocol.Location{URI: app, Range: makeRange(t, "6:2-6:8")}},
+		{Name: "alsoUnused", Location: protocol.Location{URI: app, Range: makeRange(t, "7:2-7:12")}},
+		{Name: "unusedHelper", Location: protocol.Location{URI: helpers, Range: makeRange(t, "0:21-0:33")}},
+	}, report.Fields)
+	assert.Equal(t, `# Dead code
+
+From 1 entrypoints.
+
+## Files that are never imported
+
+- `+"`lib/old.libsonnet`"+`
+
+## Fields that are never referred to
+
+- `+"`lib/app.libsonnet:7` `unused`"+`
+- `+"`lib/app.libsonnet:8` `alsoUnused`"+`
+- `+"`lib/helpers.libsonnet:1` `unusedHelper`"+`
+`, report.Report)
+
+	// The entrypoints are configurable, the libraries can be entrypoints too
+	require.NoError(t, s.DidChangeConfiguration(context.TODO(), &protocol.DidChangeConfigurationParams{
+		Settings: map[string]interface{}{"entrypoints": []interface{}{"environments/**/main.jsonnet", "lib/old.libsonnet"}},
+	}))
+	result, err = s.ExecuteCommand(context.TODO(), &protocol.ExecuteCommandParams{Command: "jsonnet.deadCode"})
+	require.NoError(t, err)
+	report = result.(deadCodeReport)
+	assert.Equal(t, 2, report.Entrypoints)
+	assert.Empty(t, report.Files)
+}
+
+func TestDeadCode_Diagnostics(t *testing.T) {
+	root := deadCodeTestFiles(t)
+	client := &recordingClient{}
+	s := NewServer("jsonnet-language-server", "dev", client, Configuration{FormattingOptions: formatter.DefaultOptions()})
+	s.workspaceFolder = root
+
+	_, err := s.ExecuteCommand(context.TODO(), &protocol.ExecuteCommandParams{
+		Command:   "jsonnet.deadCode",
+		Arguments: []json.RawMessage{json.RawMessage(`"diagnostics"`)},
+	})
+	require.NoError(t, err)
+
+	old := protocol.URIFromPath(filepath.Join(root, "lib/old.libsonnet"))
+	assert.Eventually(t, func() bool {
+		for _, published := range client.getPublished() {
+			if published.URI == old && len(published.Diagnostics) == 1 {
+				return published.Diagnostics[0].Message == "the file is never imported from the entrypoints" &&
+					published.Diagnostics[0].Severity == protocol.SeverityHint
+			}
+		}
+		return false
+	}, time.Second, 10*time.Millisecond)
+
+	// The diagnostics of open documents are kept until they are edited
+	uri := serverOpenTestFile(t, s, filepath.Join(root, "lib/helpers.libsonnet"))
+	doc, err := s.cache.get(uri)
+	require.NoError(t, err)
+	diags := s.deadCodeDiags.get(doc)
+	require.Len(t, diags, 1)
+	assert.Equal(t, "the field unusedHelper is never referred to from the entrypoints", diags[0].Message)
+	assert.Equal(t, []protocol.DiagnosticTag{protocol.Unnecessary}, diags[0].Tags)
+
+	edited := *doc
+	edited.item.Text = "{ image(name): name }"
+	assert.Empty(t, s.deadCodeDiags.get(&edited))
+}
+
+func TestDeadCode_InvalidArguments(t *testing.T) {
+	s := NewServer("jsonnet-language-server", "dev", &recordingClient{}, Configuration{})
+	_, err := s.ExecuteCommand(context.TODO(), &protocol.ExecuteCommandParams{Command: "jsonnet.deadCode"})
+	assert.EqualError(t, err, "the dead code of a workspace can't be found without a workspace folder")
+
+	s.workspaceFolder = t.TempDir()
+	_, err = s.ExecuteCommand(context.TODO(), &protocol.ExecuteCommandParams{
+		Command:   "jsonnet.deadCode",
+		Arguments: []json.RawMessage{json.RawMessage(`"html"`)},
+	})
+	assert.EqualError(t, err, `unknown output "html", expected report or diagnostics`)
+}
@@ -0,0 +1,711 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-jsonnet"
+	"github.com/google/go-jsonnet/ast"
+	"github.com/google/go-jsonnet/toolutils"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// debugThreadID is the only thread of the debug adapter, the evaluation of the program.
+const debugThreadID = 1
+
+// The variable references of the scopes of a stop.
+const (
+	debugLocalsReference = iota + 1
+	debugExtVarsReference
+)
+
+// debugHitMarker starts the std.trace messages that mark the hits of the breakpoints, it is followed by the number of
+// the breakpoint.
+const debugHitMarker = "jsonnet-debug-adapter-hit:"
+
+// debugMaxStops limits the stops of an evaluation: a breakpoint in a function that is called for each element of a
+// large array would stop for each of them.
+const debugMaxStops = 1000
+
+// DebugAdapter serves the Debug Adapter Protocol to record which breakpoints the evaluation of a Jsonnet file reaches,
+// and to inspect them. go-jsonnet has no hooks into the evaluation, so it can't be paused nor stepped through: the
+// expression that starts on the line of each breakpoint is wrapped in a std.trace call, the program is evaluated at
+// once, then the adapter stops at the breakpoints in the order the evaluation reached them. A stop shows the locals in
+// scope on the breakpoint's line, and the external variables that its file reads. The top-level locals of the files
+// are evaluated, the other locals and the function parameters depend on the evaluation, they are shown as their code.
+type DebugAdapter struct {
+	server *Server
+	reader *bufio.Reader
+	writer io.Writer
+	seq    int
+	// events are sent once the response of the request being handled is
+	events []debugEvent
+
+	program     string
+	stopOnEntry bool
+	// breakpoints are the verified breakpoints, by file
+	breakpoints map[string][]debugBreakpoint
+	vm          *jsonnet.VM
+	// hits are the breakpoints by the number of their marker, running is set while the program is evaluated, when
+	// their markers are stops
+	hits    []debugStop
+	running bool
+	// stops are where the adapter stops, in the order the evaluation reached them, stop is the index of the current one
+	stops []debugStop
+	stop  int
+	// err is the error of the evaluation, the exit code is 1 if there is one
+	err error
+}
+
+// debugBreakpoint is a verified breakpoint: an expression starts on its line, and the evaluation records when it
+// reaches it.
+type debugBreakpoint struct {
+	line       int
+	begin, end ast.Location
+}
+
+// debugStop is a position the adapter stops at.
+type debugStop struct {
+	path   string
+	line   int
+	column int
+	reason string
+}
+
+type debugRequest struct {
+	Seq       int             `json:"seq"`
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+type debugResponse struct {
+	Seq        int         `json:"seq"`
+	Type       string      `json:"type"`
+	RequestSeq int         `json:"request_seq"`
+	Command    string      `json:"command"`
+	Success    bool        `json:"success"`
+	Message    string      `json:"message,omitempty"`
+	Body       interface{} `json:"body,omitempty"`
+}
+
+type debugEvent struct {
+	Seq   int         `json:"seq"`
+	Type  string      `json:"type"`
+	Event string      `json:"event"`
+	Body  interface{} `json:"body,omitempty"`
+}
+
+// debugLaunchArguments are the arguments of the launch request. The settings are the language server's, they
+// configure the evaluation like the diagnostics'.
+type debugLaunchArguments struct {
+	Program     string                 `json:"program"`
+	StopOnEntry bool                   `json:"stopOnEntry"`
+	Settings    map[string]interface{} `json:"settings"`
+}
+
+type debugSource struct {
+	Name string `json:"name,omitempty"`
+	Path string `json:"path"`
+}
+
+type debugVariable struct {
+	Name               string `json:"name"`
+	Value              string `json:"value"`
+	Type               string `json:"type,omitempty"`
+	VariablesReference int    `json:"variablesReference"`
+}
+
+// NewDebugAdapter returns a debug adapter that evaluates the programs with the server's configuration.
+func NewDebugAdapter(s *Server, stream io.ReadWriter) *DebugAdapter {
+	return &DebugAdapter{server: s, reader: bufio.NewReader(stream), writer: stream, breakpoints: map[string][]debugBreakpoint{}}
+}
+
+// Serve handles the requests until the client disconnects.
+func (d *DebugAdapter) Serve(ctx context.Context) error {
+	for {
+		request, err := d.read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		body, err := d.handle(ctx, request)
+		response := debugResponse{Type: "response", RequestSeq: request.Seq, Command: request.Command, Success: err == nil, Body: body}
+		if err != nil {
+			response.Message = err.Error()
+		}
+		if err := d.send(&response.Seq, response); err != nil {
+			return err
+		}
+		for _, event := range d.events {
+			if err := d.send(&event.Seq, event); err != nil {
+				return err
+			}
+		}
+		d.events = nil
+		if request.Command == "disconnect" || request.Command == "terminate" {
+			return nil
+		}
+	}
+}
+
+// read reads a request, framed like the messages of the language server protocol.
+func (d *DebugAdapter) read() (debugRequest, error) {
+	var request debugRequest
+	header, err := textproto.NewReader(d.reader).ReadMIMEHeader()
+	if err != nil {
+		return request, err
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return request, fmt.Errorf("invalid Content-Length %q", header.Get("Content-Length"))
+	}
+	content := make([]byte, length)
+	if _, err := io.ReadFull(d.reader, content); err != nil {
+		return request, err
+	}
+	if err := json.Unmarshal(content, &request); err != nil {
+		return request, fmt.Errorf("failed to unmarshal the request: %v", err)
+	}
+	return request, nil
+}
+
+// send numbers a message and writes it.
+func (d *DebugAdapter) send(seq *int, message interface{}) error {
+	d.seq++
+	*seq = d.seq
+	content, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(d.writer, "Content-Length: %d\r\n\r\n%s", len(content), content)
+	return err
+}
+
+// event queues an event, it is sent after the response of the request.
+func (d *DebugAdapter) event(name string, body interface{}) {
+	d.events = append(d.events, debugEvent{Type: "event", Event: name, Body: body})
+}
+
+func (d *DebugAdapter) handle(ctx context.Context, request debugRequest) (interface{}, error) {
+	switch request.Command {
+	case "initialize":
+		d.event("initialized", nil)
+		return map[string]interface{}{"supportsConfigurationDoneRequest": true}, nil
+	case "launch":
+		return nil, d.launch(ctx, request.Arguments)
+	case "setBreakpoints":
+		return d.setBreakpoints(request.Arguments)
+	case "configurationDone":
+		d.run()
+		return nil, nil
+	case "threads":
+		return map[string]interface{}{"threads": []map[string]interface{}{{"id": debugThreadID, "name": "evaluation"}}}, nil
+	case "stackTrace":
+		return d.stackTrace()
+	case "scopes":
+		return d.scopes()
+	case "variables":
+		return d.variables(request.Arguments)
+	case "continue":
+		if d.stop < len(d.stops) {
+			d.stop++
+			d.next()
+		}
+		return map[string]interface{}{"allThreadsContinued": true}, nil
+	case "next", "stepIn", "stepOut", "pause":
+		return nil, fmt.Errorf("%s isn't supported, the evaluation can't be paused nor stepped through, it only stops at the breakpoints it reached", request.Command)
+	case "disconnect", "terminate":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unsupported request %s", request.Command)
+	}
+}
+
+func (d *DebugAdapter) launch(ctx context.Context, rawArgs json.RawMessage) error {
+	var args debugLaunchArguments
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return fmt.Errorf("failed to unmarshal the launch arguments: %v", err)
+	}
+	if args.Program == "" {
+		return errors.New("the program to debug is missing")
+	}
+	if args.Settings != nil {
+		if err := d.server.DidChangeConfiguration(ctx, &protocol.DidChangeConfigurationParams{Settings: args.Settings}); err != nil {
+			return err
+		}
+	}
+	program, err := filepath.Abs(args.Program)
+	if err != nil {
+		return err
+	}
+	if _, _, err := d.parse(program); err != nil {
+		return err
+	}
+	d.program, d.stopOnEntry = program, args.StopOnEntry
+	return nil
+}
+
+// parse parses a file, as it is on disk.
+func (d *DebugAdapter) parse(path string) (string, ast.Node, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", nil, err
+	}
+	root, err := jsonnet.SnippetToAST(path, string(content))
+	if err != nil {
+		return "", nil, fmt.Errorf("unable to parse %s: %v", path, err)
+	}
+	return string(content), root, nil
+}
+
+func (d *DebugAdapter) setBreakpoints(rawArgs json.RawMessage) (interface{}, error) {
+	var args struct {
+		Source      debugSource `json:"source"`
+		Breakpoints []struct {
+			Line int `json:"line"`
+		} `json:"breakpoints"`
+	}
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal the breakpoints: %v", err)
+	}
+	path, err := filepath.Abs(args.Source.Path)
+	if err != nil {
+		return nil, err
+	}
+	text, root, parseErr := d.parse(path)
+	var verified []debugBreakpoint
+	breakpoints := []map[string]interface{}{}
+	for i, breakpoint := range args.Breakpoints {
+		result := map[string]interface{}{"id": i + 1, "line": breakpoint.Line, "verified": false}
+		if parseErr != nil {
+			result["message"] = parseErr.Error()
+		} else if b, ok := breakpointOnLine(path, text, root, breakpoint.Line); ok {
+			result["verified"] = true
+			verified = append(verified, b)
+		} else {
+			result["message"] = "there is no expression that starts on this line"
+		}
+		breakpoints = append(breakpoints, result)
+	}
+	d.breakpoints[path] = verified
+	return map[string]interface{}{"breakpoints": breakpoints}, nil
+}
+
+// breakpointOnLine returns the breakpoint of the outermost expression that starts on a line and can be instrumented.
+// The locals and the functions aren't evaluated where they start, the expressions in them are.
+func breakpointOnLine(path, text string, root ast.Node, line int) (debugBreakpoint, bool) {
+	var candidates []debugBreakpoint
+	walk(root, func(node ast.Node) {
+		switch node.(type) {
+		case *ast.Local, *ast.Function:
+			return
+		}
+		if loc := node.Loc(); loc != nil && loc.Begin.IsSet() && loc.Begin.Line == line {
+			candidates = append(candidates, debugBreakpoint{line: line, begin: loc.Begin, end: loc.End})
+		}
+	})
+	// The locations of the desugared nodes don't always span an expression of the text, such as those of the object
+	// asserts: the instrumented text must parse
+	for _, b := range candidates {
+		if _, err := jsonnet.SnippetToAST(path, instrument(text, []debugBreakpoint{b}, 0)); err == nil {
+			return b, true
+		}
+	}
+	return debugBreakpoint{}, false
+}
+
+// instrument wraps the expressions of the breakpoints of a file in conditions that call std.trace before they are
+// evaluated, with the marker of their number, the first breakpoint's being first. The lines of the text don't change.
+func instrument(text string, breakpoints []debugBreakpoint, first int) string {
+	type insertion struct {
+		offset int
+		text   string
+	}
+	var insertions []insertion
+	for i, b := range breakpoints {
+		insertions = append(insertions,
+			insertion{offset: locationOffset(text, b.begin), text: fmt.Sprintf("(if std.trace(%q, true) then (", debugHitMarker+strconv.Itoa(first+i))},
+			insertion{offset: locationOffset(text, b.end), text: ") else null)"})
+	}
+	// The insertions are made from the end of the text, the offsets of the others stay valid
+	sort.SliceStable(insertions, func(i, j int) bool { return insertions[i].offset > insertions[j].offset })
+	for _, in := range insertions {
+		text = text[:in.offset] + in.text + text[in.offset:]
+	}
+	return text
+}
+
+// locationOffset returns the byte offset of a location in the text.
+func locationOffset(text string, loc ast.Location) int {
+	offset := 0
+	for i, line := range strings.SplitAfter(text, "\n") {
+		if i == loc.Line-1 {
+			return min(offset+loc.Column-1, len(text))
+		}
+		offset += len(line)
+	}
+	return len(text)
+}
+
+// run evaluates the program with its breakpoints and those of the files it imports instrumented, and goes to the
+// first stop.
+func (d *DebugAdapter) run() {
+	if d.program == "" {
+		d.event("terminated", nil)
+		return
+	}
+	text, err := os.ReadFile(d.program)
+	if err != nil {
+		d.event("output", map[string]interface{}{"category": "stderr", "output": err.Error() + "\n"})
+		d.event("terminated", nil)
+		return
+	}
+	d.hits, d.stops, d.stop = nil, nil, 0
+	if d.stopOnEntry {
+		d.stops = append(d.stops, debugStop{path: d.program, line: 1, column: 1, reason: "entry"})
+	}
+	config, settings := d.server.evaluationSettings(d.program)
+	importer := &debugImporter{adapter: d, importer: d.server.getImporter(config, d.program, settings), contents: map[string]jsonnet.Contents{}}
+	d.vm = d.server.makeVM(config, settings, importer)
+	d.vm.SetTraceOut(debugTraceWriter{adapter: d})
+
+	d.running = true
+	output, err := d.vm.EvaluateAnonymousSnippet(d.program, d.instrumented(d.program, string(text)))
+	d.running = false
+	d.err = err
+	if err != nil {
+		d.event("output", map[string]interface{}{"category": "stderr", "output": err.Error() + "\n"})
+	} else {
+		d.event("output", map[string]interface{}{"category": "stdout", "output": output})
+	}
+	if len(d.stops) >= debugMaxStops {
+		d.event("output", map[string]interface{}{"category": "console", "output": fmt.Sprintf("The breakpoints were reached more than %d times, the adapter only stops at the first %[1]d.\n", debugMaxStops)})
+	}
+	d.next()
+}
+
+// instrumented returns the text of a file with its breakpoints instrumented, and numbers them.
+func (d *DebugAdapter) instrumented(path, text string) string {
+	breakpoints := d.breakpoints[path]
+	if len(breakpoints) == 0 {
+		return text
+	}
+	first := len(d.hits)
+	for _, b := range breakpoints {
+		d.hits = append(d.hits, debugStop{path: path, line: b.line, column: b.begin.Column, reason: "breakpoint"})
+	}
+	return instrument(text, breakpoints, first)
+}
+
+// hit records that the evaluation reached the breakpoint of a marker.
+func (d *DebugAdapter) hit(marker string) {
+	n, err := strconv.Atoi(marker)
+	if err != nil || n < 0 || n >= len(d.hits) || !d.running || len(d.stops) >= debugMaxStops {
+		return
+	}
+	d.stops = append(d.stops, d.hits[n])
+}
+
+// next stops at the current stop, or ends the session when there is none left. The exit code is 1 if the evaluation
+// failed.
+func (d *DebugAdapter) next() {
+	if d.stop < len(d.stops) {
+		d.event("stopped", map[string]interface{}{"reason": d.stops[d.stop].reason, "threadId": debugThreadID, "allThreadsStopped": true})
+		return
+	}
+	exitCode := 0
+	if d.err != nil {
+		exitCode = 1
+	}
+	d.event("exited", map[string]interface{}{"exitCode": exitCode})
+	d.event("terminated", nil)
+}
+
+// currentStop returns where the adapter is stopped.
+func (d *DebugAdapter) currentStop() (debugStop, error) {
+	if d.stop >= len(d.stops) {
+		return debugStop{}, errors.New("the evaluation isn't stopped")
+	}
+	return d.stops[d.stop], nil
+}
+
+func (d *DebugAdapter) stackTrace() (interface{}, error) {
+	stop, err := d.currentStop()
+	if err != nil {
+		return nil, err
+	}
+	frame := map[string]interface{}{
+		"id":     1,
+		"name":   fmt.Sprintf("%s:%d", filepath.Base(stop.path), stop.line),
+		"source": debugSource{Name: filepath.Base(stop.path), Path: stop.path},
+		"line":   stop.line,
+		"column": stop.column,
+	}
+	return map[string]interface{}{"stackFrames": []map[string]interface{}{frame}, "totalFrames": 1}, nil
+}
+
+func (d *DebugAdapter) scopes() (interface{}, error) {
+	if _, err := d.currentStop(); err != nil {
+		return nil, err
+	}
+	scopes := []map[string]interface{}{
+		{"name": "Locals", "variablesReference": debugLocalsReference, "expensive": false},
+		{"name": "External variables", "variablesReference": debugExtVarsReference, "expensive": false},
+	}
+	return map[string]interface{}{"scopes": scopes}, nil
+}
+
+func (d *DebugAdapter) variables(rawArgs json.RawMessage) (interface{}, error) {
+	var args struct {
+		VariablesReference int `json:"variablesReference"`
+	}
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal the variables reference: %v", err)
+	}
+	stop, err := d.currentStop()
+	if err != nil {
+		return nil, err
+	}
+
+	variables := []debugVariable{}
+	switch args.VariablesReference {
+	case debugLocalsReference:
+		locals, err := d.locals(stop)
+		if err != nil {
+			return nil, err
+		}
+		variables = append(variables, locals...)
+	case debugExtVarsReference:
+		_, root, err := d.parse(stop.path)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range extVarNames(root) {
+			literal, _ := json.Marshal(name)
+			variables = append(variables, d.evaluated(name, "<ext var>", fmt.Sprintf("std.extVar(%s)", literal)))
+		}
+	default:
+		return nil, fmt.Errorf("unknown variables reference %d", args.VariablesReference)
+	}
+	return map[string]interface{}{"variables": variables}, nil
+}
+
+// locals returns the variables in scope at a stop.
+func (d *DebugAdapter) locals(stop debugStop) ([]debugVariable, error) {
+	text, root, err := d.parse(stop.path)
+	if err != nil {
+		return nil, err
+	}
+	var variables []debugVariable
+	for _, v := range variablesInScope(root, text, stop.line) {
+		switch {
+		case v.bind == nil:
+			variables = append(variables, debugVariable{Name: string(v.name), Value: "<parameter>", Type: "parameter"})
+		case isFunction(v.bind.Body):
+			variables = append(variables, debugVariable{Name: string(v.name), Value: "<function>", Type: "function"})
+		case v.prefix != "":
+			variables = append(variables, d.evaluated(string(v.name), stop.path, v.prefix+"\n"+string(v.name)))
+		default:
+			code := text[locationOffset(text, v.bind.Body.Loc().Begin):locationOffset(text, v.bind.Body.Loc().End)]
+			variables = append(variables, debugVariable{Name: string(v.name), Value: code, Type: "code"})
+		}
+	}
+	return variables, nil
+}
+
+// evaluated returns a variable whose value is the output of a snippet, or the error of its evaluation.
+func (d *DebugAdapter) evaluated(name, filename, snippet string) debugVariable {
+	output, err := d.vm.EvaluateAnonymousSnippet(filename, snippet)
+	if err != nil {
+		return debugVariable{Name: name, Value: strings.SplitN(err.Error(), "\n", 2)[0], Type: "error"}
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(output), &value); err == nil {
+		if compact, err := json.Marshal(value); err == nil {
+			output = string(compact)
+		}
+	}
+	return debugVariable{Name: name, Value: strings.TrimSpace(output), Type: "value"}
+}
+
+// scopedVariable is a variable in scope at a line: a local, or a function parameter whose bind is nil.
+type scopedVariable struct {
+	name ast.Identifier
+	bind *ast.LocalBind
+	// prefix is the text that precedes the body of the top-level locals, with which they are evaluated
+	prefix string
+}
+
+// variablesInScope returns the variables in scope on a line, by name, the innermost binding of a name hiding the
+// others like in findVariables.
+func variablesInScope(root ast.Node, text string, line int) []*scopedVariable {
+	var found map[ast.Identifier]*scopedVariable
+	var visit func(node ast.Node, scope map[ast.Identifier]*scopedVariable, topLevel bool)
+	bindLocals := func(scope map[ast.Identifier]*scopedVariable, binds ast.LocalBinds, prefix string) map[ast.Identifier]*scopedVariable {
+		inner := copyScope(scope)
+		for i := range binds {
+			inner[binds[i].Variable] = &scopedVariable{name: binds[i].Variable, bind: &binds[i], prefix: prefix}
+		}
+		return inner
+	}
+	visit = func(node ast.Node, scope map[ast.Identifier]*scopedVariable, topLevel bool) {
+		if node == nil {
+			return
+		}
+		if loc := node.Loc(); loc != nil && loc.Begin.IsSet() {
+			if line < loc.Begin.Line || line > loc.End.Line {
+				return
+			}
+			found = scope
+		}
+		switch node := node.(type) {
+		case *ast.Local:
+			prefix := ""
+			if topLevel {
+				prefix = text[:locationOffset(text, node.Body.Loc().Begin)]
+			}
+			inner := bindLocals(scope, node.Binds, prefix)
+			for _, b := range node.Binds {
+				visit(b.Body, inner, false)
+			}
+			visit(node.Body, inner, topLevel)
+		case *ast.Function:
+			inner := copyScope(scope)
+			for _, param := range node.Parameters {
+				inner[param.Name] = &scopedVariable{name: param.Name}
+			}
+			for _, param := range node.Parameters {
+				visit(param.DefaultArg, inner, false)
+			}
+			visit(node.Body, inner, false)
+		case *ast.DesugaredObject:
+			inner := bindLocals(scope, node.Locals, "")
+			for _, b := range node.Locals {
+				visit(b.Body, inner, false)
+			}
+			for _, field := range node.Fields {
+				visit(field.Name, scope, false)
+				visit(field.Body, inner, false)
+			}
+			for _, assert := range node.Asserts {
+				visit(assert, inner, false)
+			}
+		default:
+			for _, child := range toolutils.Children(node) {
+				visit(child, scope, false)
+			}
+		}
+	}
+	visit(root, map[ast.Identifier]*scopedVariable{}, true)
+
+	variables := make([]*scopedVariable, 0, len(found))
+	for name, v := range found {
+		// `$` is bound by the desugarer, it isn't a variable of the file
+		if strings.HasPrefix(string(name), "$") {
+			continue
+		}
+		variables = append(variables, v)
+	}
+	sort.Slice(variables, func(i, j int) bool { return variables[i].name < variables[j].name })
+	return variables
+}
+
+func copyScope(scope map[ast.Identifier]*scopedVariable) map[ast.Identifier]*scopedVariable {
+	inner := make(map[ast.Identifier]*scopedVariable, len(scope))
+	for name, v := range scope {
+		inner[name] = v
+	}
+	return inner
+}
+
+func isFunction(node ast.Node) bool {
+	_, ok := node.(*ast.Function)
+	return ok
+}
+
+// extVarNames returns the names of the external variables that a file reads with std.extVar, sorted. Those whose name
+// is computed are left out.
+func extVarNames(root ast.Node) []string {
+	seen := map[string]bool{}
+	var names []string
+	walk(root, func(node ast.Node) {
+		apply, ok := node.(*ast.Apply)
+		if !ok || len(apply.Arguments.Positional) != 1 {
+			return
+		}
+		index, ok := apply.Target.(*ast.Index)
+		if !ok {
+			return
+		}
+		target, ok := index.Target.(*ast.Var)
+		if !ok || target.Id != "std" {
+			return
+		}
+		if function, ok := index.Index.(*ast.LiteralString); !ok || function.Value != "extVar" {
+			return
+		}
+		name, ok := apply.Arguments.Positional[0].Expr.(*ast.LiteralString)
+		if ok && !seen[name.Value] {
+			seen[name.Value] = true
+			names = append(names, name.Value)
+		}
+	})
+	sort.Strings(names)
+	return names
+}
+
+// debugImporter instruments the breakpoints of the imported files.
+type debugImporter struct {
+	adapter  *DebugAdapter
+	importer jsonnet.Importer
+	// contents are the instrumented files, go-jsonnet expects the same contents for each import of a file
+	contents map[string]jsonnet.Contents
+}
+
+func (i *debugImporter) Import(importedFrom, importedPath string) (jsonnet.Contents, string, error) {
+	contents, foundAt, err := i.importer.Import(importedFrom, importedPath)
+	if err != nil {
+		return contents, foundAt, err
+	}
+	path, err := filepath.Abs(foundAt)
+	if err != nil || len(i.adapter.breakpoints[path]) == 0 {
+		return contents, foundAt, nil
+	}
+	if instrumented, ok := i.contents[path]; ok {
+		return instrumented, foundAt, nil
+	}
+	instrumented := jsonnet.MakeContents(i.adapter.instrumented(path, contents.String()))
+	i.contents[path] = instrumented
+	return instrumented, foundAt, nil
+}
+
+// debugTraceWriter records the hits of the breakpoints, and sends the other std.trace messages of the evaluation as
+// output events.
+type debugTraceWriter struct {
+	adapter *DebugAdapter
+}
+
+func (w debugTraceWriter) Write(p []byte) (int, error) {
+	message := strings.TrimSuffix(string(p), "\n")
+	if i := strings.Index(message, " "+debugHitMarker); i >= 0 {
+		// The markers are only stops while the program is evaluated, the evaluation of the variables ignores them
+		w.adapter.hit(message[i+len(debugHitMarker)+1:])
+		return len(p), nil
+	}
+	log.Debug(message)
+	w.adapter.event("output", map[string]interface{}{"category": "console", "output": string(p)})
+	return len(p), nil
+}
@@ -0,0 +1,299 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// debugClient sends the requests of a debugging session to a debug adapter, and reads its messages.
+type debugClient struct {
+	t      *testing.T
+	writer io.Writer
+	reader *bufio.Reader
+	seq    int
+}
+
+// debugMessage is a response or an event of the debug adapter.
+type debugMessage struct {
+	Type    string          `json:"type"`
+	Command string          `json:"command"`
+	Event   string          `json:"event"`
+	Success bool            `json:"success"`
+	Message string          `json:"message"`
+	Body    json.RawMessage `json:"body"`
+}
+
+func newDebugClient(t *testing.T, s *Server) *debugClient {
+	t.Helper()
+	requests, requestsWriter := io.Pipe()
+	messagesReader, messages := io.Pipe()
+	adapter := NewDebugAdapter(s, struct {
+		io.Reader
+		io.Writer
+	}{requests, messages})
+	done := make(chan error, 1)
+	go func() {
+		done <- adapter.Serve(context.Background())
+		messages.Close()
+	}()
+	t.Cleanup(func() {
+		requestsWriter.Close()
+		assert.NoError(t, <-done)
+	})
+	return &debugClient{t: t, writer: requestsWriter, reader: bufio.NewReader(messagesReader)}
+}
+
+// request sends a request, and returns its response. The events that follow it are read with events.
+func (c *debugClient) request(command string, arguments interface{}) debugMessage {
+	c.t.Helper()
+	c.seq++
+	content, err := json.Marshal(map[string]interface{}{"seq": c.seq, "type": "request", "command": command, "arguments": arguments})
+	require.NoError(c.t, err)
+	_, err = fmt.Fprintf(c.writer, "Content-Length: %d\r\n\r\n%s", len(content), content)
+	require.NoError(c.t, err)
+	response := c.read()
+	require.Equal(c.t, "response", response.Type)
+	require.Equal(c.t, command, response.Command)
+	return response
+}
+
+// read reads the next message.
+func (c *debugClient) read() debugMessage {
+	c.t.Helper()
+	header, err := textproto.NewReader(c.reader).ReadMIMEHeader()
+	require.NoError(c.t, err)
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	require.NoError(c.t, err)
+	content := make([]byte, length)
+	_, err = io.ReadFull(c.reader, content)
+	require.NoError(c.t, err)
+	var message debugMessage
+	require.NoError(c.t, json.Unmarshal(content, &message))
+	return message
+}
+
+// events reads the events that follow a response.
+func (c *debugClient) events(names ...string) []debugMessage {
+	c.t.Helper()
+	var events []debugMessage
+	for _, name := range names {
+		event := c.read()
+		require.Equal(c.t, "event", event.Type)
+		require.Equal(c.t, name, event.Event, string(event.Body))
+		events = append(events, event)
+	}
+	return events
+}
+
+// variables returns the values of the variables of a scope, by name.
+func (c *debugClient) variables(reference int) map[string]string {
+	c.t.Helper()
+	response := c.request("variables", map[string]interface{}{"variablesReference": reference})
+	require.True(c.t, response.Success, response.Message)
+	var body struct {
+		Variables []debugVariable `json:"variables"`
+	}
+	require.NoError(c.t, json.Unmarshal(response.Body, &body))
+	values := map[string]string{}
+	for _, v := range body.Variables {
+		values[v.Name] = v.Value
+	}
+	return values
+}
+
+// writeDebugFiles writes the files of a program to debug in a directory, and returns it.
+func writeDebugFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o700))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	}
+	return root
+}
+
+// stopped returns where the adapter stopped.
+func (c *debugClient) stopped() string {
+	c.t.Helper()
+	response := c.request("stackTrace", map[string]interface{}{"threadId": 1})
+	require.True(c.t, response.Success, response.Message)
+	var body struct {
+		StackFrames []struct {
+			Name   string `json:"name"`
+			Column int    `json:"column"`
+		} `json:"stackFrames"`
+	}
+	require.NoError(c.t, json.Unmarshal(response.Body, &body))
+	require.Len(c.t, body.StackFrames, 1)
+	return fmt.Sprintf("%s:%d", body.StackFrames[0].Name, body.StackFrames[0].Column)
+}
+
+func TestDebugAdapter(t *testing.T) {
+	root := writeDebugFiles(t, map[string]string{
+		"lib/util.libsonnet": "local base = { replicas: 2 };\n{\n  scale(n):: base { replicas: n },\n  unused(n):: n * 2,\n}\n",
+		"main.jsonnet": `local util = import 'lib/util.libsonnet';
+local env = std.extVar('env');
+local replicas = std.length(env) + 1;
+local unused = error 'never evaluated';
+{
+  local name = 'app-' + env,
+  app: util.scale(replicas) { name: name },
+  cluster: std.extVar('cluster').name,
+}
+`,
+	})
+	main := filepath.Join(root, "main.jsonnet")
+	s := NewServer("any", "test version", nil, Configuration{})
+	client := newDebugClient(t, s)
+
+	response := client.request("initialize", map[string]interface{}{"adapterID": "jsonnet"})
+	require.True(t, response.Success)
+	client.events("initialized")
+	response = client.request("launch", map[string]interface{}{
+		"program": main,
+		"settings": map[string]interface{}{
+			"ext_vars": map[string]interface{}{"env": "dev"},
+			"ext_code": map[string]interface{}{"cluster": "{ name: 'eu-west' }"},
+		},
+	})
+	require.True(t, response.Success, response.Message)
+
+	// The breakpoints are on the lines that an expression starts on
+	response = client.request("setBreakpoints", map[string]interface{}{
+		"source":      map[string]interface{}{"path": main},
+		"breakpoints": []map[string]interface{}{{"line": 7}, {"line": 3}, {"line": 4}, {"line": 10}},
+	})
+	require.True(t, response.Success, response.Message)
+	assert.JSONEq(t, `{"breakpoints": [
+		{"id": 1, "line": 7, "verified": true},
+		{"id": 2, "line": 3, "verified": true},
+		{"id": 3, "line": 4, "verified": true},
+		{"id": 4, "line": 10, "verified": false, "message": "there is no expression that starts on this line"}
+	]}`, string(response.Body))
+	response = client.request("setBreakpoints", map[string]interface{}{
+		"source":      map[string]interface{}{"path": filepath.Join(root, "lib/util.libsonnet")},
+		"breakpoints": []map[string]interface{}{{"line": 3}, {"line": 4}},
+	})
+	require.True(t, response.Success, response.Message)
+
+	// The program is evaluated, then the adapter stops at the breakpoints in the order the evaluation reached them
+	require.True(t, client.request("configurationDone", nil).Success)
+	events := client.events("output", "stopped")
+	assert.JSONEq(t, `{"category": "stdout", "output": "{\n   \"app\": {\n      \"name\": \"app-dev\",\n      \"replicas\": 4\n   },\n   \"cluster\": \"eu-west\"\n}\n"}`, string(events[0].Body))
+	assert.JSONEq(t, `{"reason": "breakpoint", "threadId": 1, "allThreadsStopped": true}`, string(events[1].Body))
+
+	response = client.request("stackTrace", map[string]interface{}{"threadId": 1})
+	assert.JSONEq(t, fmt.Sprintf(`{"stackFrames": [{"id": 1, "name": "main.jsonnet:7", "source": {"name": "main.jsonnet", "path": %q}, "line": 7, "column": 8}], "totalFrames": 1}`, main), string(response.Body))
+	response = client.request("scopes", map[string]interface{}{"frameId": 1})
+	assert.JSONEq(t, `{"scopes": [
+		{"name": "Locals", "variablesReference": 1, "expensive": false},
+		{"name": "External variables", "variablesReference": 2, "expensive": false}
+	]}`, string(response.Body))
+	// The top-level locals are evaluated, the locals of the objects depend on the evaluation, they are shown as their
+	// code
+	assert.Equal(t, map[string]string{
+		"util":     `{}`,
+		"env":      `"dev"`,
+		"replicas": "4",
+		"unused":   "RUNTIME ERROR: never evaluated",
+		"name":     "'app-' + env",
+	}, client.variables(debugLocalsReference))
+	// The external variables are those that the file reads
+	assert.Equal(t, map[string]string{"env": `"dev"`, "cluster": `{"name":"eu-west"}`}, client.variables(debugExtVarsReference))
+
+	// The evaluation can't be stepped through
+	response = client.request("next", map[string]interface{}{"threadId": 1})
+	assert.False(t, response.Success)
+	assert.Equal(t, "next isn't supported, the evaluation can't be paused nor stepped through, it only stops at the breakpoints it reached", response.Message)
+
+	// The breakpoints of the imported files are reached when the program calls their functions, with their parameters
+	require.True(t, client.request("continue", map[string]interface{}{"threadId": 1}).Success)
+	client.events("stopped")
+	assert.Equal(t, "util.libsonnet:3:14", client.stopped())
+	assert.Equal(t, map[string]string{"base": `{"replicas":2}`, "n": "<parameter>"}, client.variables(debugLocalsReference))
+	assert.Empty(t, client.variables(debugExtVarsReference))
+
+	// The local of the program is reached when the imported function's output is manifested
+	require.True(t, client.request("continue", map[string]interface{}{"threadId": 1}).Success)
+	client.events("stopped")
+	assert.Equal(t, "main.jsonnet:3:18", client.stopped())
+
+	// The unused local and function are never reached
+	require.True(t, client.request("continue", map[string]interface{}{"threadId": 1}).Success)
+	events = client.events("exited", "terminated")
+	assert.JSONEq(t, `{"exitCode": 0}`, string(events[0].Body))
+	response = client.request("stackTrace", map[string]interface{}{"threadId": 1})
+	assert.Equal(t, "the evaluation isn't stopped", response.Message)
+	require.True(t, client.request("disconnect", nil).Success)
+}
+
+func TestDebugAdapter_EvaluationError(t *testing.T) {
+	root := writeDebugFiles(t, map[string]string{"main.jsonnet": "local a = 1, b = error 'no b';\nlocal message = 'failed: ' + a;\nerror message\n"})
+	main := filepath.Join(root, "main.jsonnet")
+	client := newDebugClient(t, NewServer("any", "test version", nil, Configuration{}))
+
+	require.True(t, client.request("initialize", nil).Success)
+	client.events("initialized")
+	require.True(t, client.request("launch", map[string]interface{}{"program": main, "stopOnEntry": true}).Success)
+	require.True(t, client.request("setBreakpoints", map[string]interface{}{
+		"source":      map[string]interface{}{"path": main},
+		"breakpoints": []map[string]interface{}{{"line": 2}},
+	}).Success)
+	require.True(t, client.request("configurationDone", nil).Success)
+	events := client.events("output", "stopped")
+	assert.Contains(t, string(events[0].Body), `"category":"stderr"`)
+	assert.Contains(t, string(events[0].Body), "failed: 1")
+	assert.JSONEq(t, `{"reason": "entry", "threadId": 1, "allThreadsStopped": true}`, string(events[1].Body))
+	// The locals that fail are shown with their error
+	assert.Equal(t, map[string]string{"a": "1", "b": "RUNTIME ERROR: no b"}, client.variables(debugLocalsReference))
+
+	// The breakpoints are reached before their expression is evaluated, even if it fails
+	require.True(t, client.request("continue", map[string]interface{}{"threadId": 1}).Success)
+	client.events("stopped")
+	assert.Equal(t, "main.jsonnet:2:17", client.stopped())
+
+	require.True(t, client.request("continue", map[string]interface{}{"threadId": 1}).Success)
+	events = client.events("exited", "terminated")
+	assert.JSONEq(t, `{"exitCode": 1}`, string(events[0].Body))
+
+	response := client.request("launch", map[string]interface{}{})
+	assert.False(t, response.Success)
+	assert.Equal(t, "the program to debug is missing", response.Message)
+	require.True(t, client.request("disconnect", nil).Success)
+}
+
+func TestDebugAdapter_MaxStops(t *testing.T) {
+	root := writeDebugFiles(t, map[string]string{"main.jsonnet": "std.foldl(function(sum, i)\n  sum + i, std.range(1, 2000), 0)\n"})
+	main := filepath.Join(root, "main.jsonnet")
+	client := newDebugClient(t, NewServer("any", "test version", nil, Configuration{}))
+
+	require.True(t, client.request("initialize", nil).Success)
+	client.events("initialized")
+	require.True(t, client.request("launch", map[string]interface{}{"program": main}).Success)
+	require.True(t, client.request("setBreakpoints", map[string]interface{}{
+		"source":      map[string]interface{}{"path": main},
+		"breakpoints": []map[string]interface{}{{"line": 2}},
+	}).Success)
+	require.True(t, client.request("configurationDone", nil).Success)
+	events := client.events("output", "output", "stopped")
+	assert.JSONEq(t, `{"category": "stdout", "output": "2001000\n"}`, string(events[0].Body))
+	assert.JSONEq(t, `{"category": "console", "output": "The breakpoints were reached more than 1000 times, the adapter only stops at the first 1000.\n"}`, string(events[1].Body))
+	for i := 1; i < debugMaxStops; i++ {
+		require.True(t, client.request("continue", map[string]interface{}{"threadId": 1}).Success)
+		client.events("stopped")
+	}
+	require.True(t, client.request("continue", map[string]interface{}{"threadId": 1}).Success)
+	client.events("exited", "terminated")
+}
@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"path/filepath"
 	"strings"
@@ -16,12 +17,15 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-func (s *Server) Definition(_ context.Context, params *protocol.DefinitionParams) (protocol.Definition, error) {
-	responseDefLinks, err := s.definitionLink(params)
+func (s *Server) Definition(ctx context.Context, params *protocol.DefinitionParams) (protocol.Definition, error) {
+	responseDefLinks, err := s.definitionLink(ctx, params)
+	if errors.Is(err, errContentModified) {
+		return nil, err
+	}
 	if err != nil {
 		// Returning an error too often can lead to the client killing the language server
 		// Logging the errors is sufficient
-		log.WithError(err).Error("Definition: error finding definition")
+		log.WithContext(ctx).WithError(err).Error("Definition: error finding definition")
 		return nil, nil
 	}
 
@@ -38,25 +42,32 @@ func (s *Server) Definition(_ context.Context, params *protocol.DefinitionParams
 	return response, nil
 }
 
-func (s *Server) definitionLink(params *protocol.DefinitionParams) ([]protocol.DefinitionLink, error) {
-	doc, err := s.cache.get(params.TextDocument.URI)
-	if err != nil {
-		return nil, utils.LogErrorf("Definition: %s: %w", errorRetrievingDocument, err)
-	}
+func (s *Server) definitionLink(ctx context.Context, params *protocol.DefinitionParams) ([]protocol.DefinitionLink, error) {
+	return onLatestDocument(s, "Definition", params.TextDocument.URI, func(doc *document) ([]protocol.DefinitionLink, error) {
+		return s.definitionLinkInDocument(ctx, doc, params)
+	})
+}
 
+func (s *Server) definitionLinkInDocument(ctx context.Context, doc *document, params *protocol.DefinitionParams) ([]protocol.DefinitionLink, error) {
 	// Only find definitions, if the the line we're trying to find a definition for hasn't changed since last successful AST parse
 	if doc.ast == nil {
 		return nil, utils.LogErrorf("Definition: document was never successfully parsed, can't find definitions")
 	}
-	if doc.linesChangedSinceAST[int(params.Position.Line)] {
+	// While the document doesn't parse, the definitions are found in the last version that did
+	astPos, lines, ok := doc.astPosition(params.Position)
+	if !ok {
 		return nil, utils.LogErrorf("Definition: document line %d was changed since last successful parse, can't find definitions", params.Position.Line)
 	}
+	astParams := &protocol.DefinitionParams{TextDocumentPositionParams: protocol.TextDocumentPositionParams{TextDocument: params.TextDocument, Position: astPos}}
 
-	vm := s.getVM(doc.item.URI.SpanURI().Filename())
-	responseDefLinks, err := findDefinition(doc.ast, params, vm)
+	vm := s.getCancellableVM(ctx, doc.item.URI.SpanURI().Filename())
+	responseDefLinks, err := findDefinition(doc.ast, astParams, vm)
 	if err != nil {
 		return nil, err
 	}
+	if lines != nil {
+		return lines.linksToText(responseDefLinks, doc.item.URI), nil
+	}
 
 	return responseDefLinks, nil
 }
@@ -72,7 +83,14 @@ func findDefinition(root ast.Node, params *protocol.DefinitionParams, vm *jsonne
 
 		var objectRange processing.ObjectRange
 
-		if bind := processing.FindBindByIDViaStack(searchStack, deepestNode.Id); bind != nil {
+		// The variables are resolved with their scopes first, the comprehensions can bind the names of outer locals
+		if v := variableAt(root, position.ProtocolToAST(params.Position)); v != nil {
+			objectRange = processing.ObjectRange{
+				Filename:       v.selection.FileName,
+				FullRange:      v.definition,
+				SelectionRange: v.selection,
+			}
+		} else if bind := processing.FindBindByIDViaStack(searchStack, deepestNode.Id); bind != nil {
 			objectRange = processing.LocalBindToRange(*bind)
 		} else if param := processing.FindParameterByIDViaStack(searchStack, deepestNode.Id, false); param != nil {
 			objectRange = processing.ObjectRange{
@@ -115,6 +133,11 @@ func findDefinition(root ast.Node, params *protocol.DefinitionParams, vm *jsonne
 		return nil, fmt.Errorf("cannot find definition")
 	}
 
+	return absoluteTargetURIs(response)
+}
+
+// absoluteTargetURIs turns the filenames of the targets into file:// URIs.
+func absoluteTargetURIs(response []protocol.DefinitionLink) ([]protocol.DefinitionLink, error) {
 	for i, item := range response {
 		link := string(item.TargetURI)
 		if !strings.HasPrefix(link, "file://") {
@@ -128,3 +151,77 @@ func findDefinition(root ast.Node, params *protocol.DefinitionParams, vm *jsonne
 
 	return response, nil
 }
+
+// Declaration is the same as Definition, except for the fields that are overridden in merged objects: Definition
+// goes to the nearest override while Declaration goes to the object that declared the field first.
+func (s *Server) Declaration(ctx context.Context, params *protocol.DeclarationParams) (protocol.Declaration, error) {
+	responseDefLinks, err := onLatestDocument(s, "Declaration", params.TextDocument.URI, func(doc *document) ([]protocol.DefinitionLink, error) {
+		return s.declarationLinkInDocument(ctx, doc, params)
+	})
+	if errors.Is(err, errContentModified) {
+		return nil, err
+	}
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Error("Declaration: error finding declaration")
+		return nil, nil
+	}
+
+	var response protocol.Declaration
+	for _, item := range responseDefLinks {
+		response = append(response, protocol.Location{
+			URI:   item.TargetURI,
+			Range: item.TargetRange,
+		})
+	}
+
+	return response, nil
+}
+
+func (s *Server) declarationLinkInDocument(ctx context.Context, doc *document, params *protocol.DeclarationParams) ([]protocol.DefinitionLink, error) {
+	if doc.ast == nil {
+		return nil, utils.LogErrorf("Declaration: document was never successfully parsed, can't find declarations")
+	}
+	astPos, lines, ok := doc.astPosition(params.Position)
+	if !ok {
+		return nil, utils.LogErrorf("Declaration: document line %d was changed since last successful parse, can't find declarations", params.Position.Line)
+	}
+	definitionParams := &protocol.DefinitionParams{TextDocumentPositionParams: protocol.TextDocumentPositionParams{TextDocument: params.TextDocument, Position: astPos}}
+
+	vm := s.getCancellableVM(ctx, doc.item.URI.SpanURI().Filename())
+	links, err := findDeclaration(doc.ast, definitionParams, vm)
+	if err != nil {
+		return nil, err
+	}
+	if lines != nil {
+		return lines.linksToText(links, doc.item.URI), nil
+	}
+	return links, nil
+}
+
+func findDeclaration(root ast.Node, params *protocol.DefinitionParams, vm *jsonnet.VM) ([]protocol.DefinitionLink, error) {
+	searchStack, _ := processing.FindNodeByPosition(root, position.ProtocolToAST(params.Position))
+	deepestNode := searchStack.Pop()
+	switch deepestNode.(type) {
+	case *ast.SuperIndex, *ast.Index:
+	default:
+		// Only fields can be overridden
+		return findDefinition(root, params, vm)
+	}
+
+	indexList := nodestack.NewNodeStack(deepestNode).BuildIndexList()
+	objectRanges, err := processing.FindOverriddenRangesFromIndexList(searchStack, indexList, vm)
+	if err != nil {
+		return nil, err
+	}
+	if len(objectRanges) == 0 {
+		return nil, fmt.Errorf("cannot find declaration")
+	}
+
+	// The ranges go from the nearest override to the first declaration
+	declaration := objectRanges[len(objectRanges)-1]
+	return absoluteTargetURIs([]protocol.DefinitionLink{{
+		TargetURI:            protocol.DocumentURI(declaration.Filename),
+		TargetRange:          position.RangeASTToProtocol(declaration.FullRange),
+		TargetSelectionRange: position.RangeASTToProtocol(declaration.SelectionRange),
+	}})
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	_ "embed"
 	"fmt"
 	"path/filepath"
@@ -991,7 +992,7 @@ func TestDefinition(t *testing.T) {
 				JPaths: []string{"testdata", filepath.Join(filepath.Dir(tc.filename), "vendor")},
 			})
 			serverOpenTestFile(t, server, tc.filename)
-			response, err := server.definitionLink(params)
+			response, err := server.definitionLink(context.Background(), params)
 			require.NoError(t, err)
 
 			var expected []protocol.DefinitionLink
@@ -1034,7 +1035,7 @@ func BenchmarkDefinition(b *testing.B) {
 			for i := 0; i < b.N; i++ {
 				// We don't care about the response for the benchmark
 				// nolint:errcheck
-				server.definitionLink(params)
+				server.definitionLink(context.Background(), params)
 			}
 		})
 	}
@@ -1094,7 +1095,7 @@ func TestDefinitionFail(t *testing.T) {
 				JPaths: []string{"testdata"},
 			})
 			serverOpenTestFile(t, server, tc.filename)
-			got, err := server.definitionLink(params)
+			got, err := server.definitionLink(context.Background(), params)
 
 			require.Error(t, err)
 			assert.Equal(t, tc.expected.Error(), err.Error())
@@ -1102,3 +1103,88 @@ func TestDefinitionFail(t *testing.T) {
 		})
 	}
 }
+
+func TestDeclaration(t *testing.T) {
+	testCases := []struct {
+		name     string
+		filename string
+		position protocol.Position
+		result   definitionResult
+	}{
+		{
+			name:     "declaration of a var is its definition",
+			filename: "./testdata/test_goto_definition.jsonnet",
+			position: protocol.Position{Line: 5, Character: 19},
+			result: definitionResult{targetRange: protocol.Range{
+				Start: protocol.Position{Line: 0, Character: 6},
+				End:   protocol.Position{Line: 0, Character: 15},
+			}},
+		},
+		{
+			name:     "clobbered string",
+			filename: "testdata/goto-overrides.jsonnet",
+			position: protocol.Position{Line: 41, Character: 30},
+			result: definitionResult{targetRange: protocol.Range{
+				Start: protocol.Position{Line: 15, Character: 4},
+				End:   protocol.Position{Line: 15, Character: 20},
+			}},
+		},
+		{
+			name:     "clobbered nested string",
+			filename: "testdata/goto-overrides.jsonnet",
+			position: protocol.Position{Line: 42, Character: 44},
+			result: definitionResult{
+				targetFilename: "testdata/goto-overrides-base.jsonnet",
+				targetRange: protocol.Range{
+					Start: protocol.Position{Line: 4, Character: 6},
+					End:   protocol.Position{Line: 4, Character: 37},
+				},
+			},
+		},
+		{
+			name:     "clobbered map",
+			filename: "testdata/goto-overrides.jsonnet",
+			position: protocol.Position{Line: 43, Character: 28},
+			result: definitionResult{
+				targetFilename: "testdata/goto-overrides-base.jsonnet",
+				targetRange: protocol.Range{
+					Start: protocol.Position{Line: 6, Character: 4},
+					End:   protocol.Position{Line: 6, Character: 15},
+				},
+			},
+		},
+		{
+			name:     "map extended by every override",
+			filename: "testdata/goto-overrides.jsonnet",
+			position: protocol.Position{Line: 32, Character: 22},
+			result: definitionResult{
+				targetFilename: "testdata/goto-overrides-base.jsonnet",
+				targetRange: protocol.Range{
+					Start: protocol.Position{Line: 1, Character: 2},
+					End:   protocol.Position{Line: 7, Character: 3},
+				},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := NewServer("any", "test version", nil, Configuration{
+				JPaths: []string{"testdata"},
+			})
+			serverOpenTestFile(t, server, tc.filename)
+			response, err := server.Declaration(context.Background(), &protocol.DeclarationParams{
+				TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+					TextDocument: protocol.TextDocumentIdentifier{URI: protocol.URIFromPath(tc.filename)},
+					Position:     tc.position,
+				},
+			})
+			require.NoError(t, err)
+
+			targetFilename := tc.result.targetFilename
+			if targetFilename == "" {
+				targetFilename = tc.filename
+			}
+			assert.Equal(t, protocol.Declaration{{URI: absURI(t, targetFilename), Range: tc.result.targetRange}}, response)
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/go-jsonnet/ast"
+	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+)
+
+const deprecatedStdDiagnosticCode = "deprecated-std"
+
+// stdDeprecation is why a std function is deprecated, and what replaces it.
+type stdDeprecation struct {
+	// replacement is the call that replaces a call to the function, with %s for the text of its arguments
+	replacement string
+	reason      string
+}
+
+// deprecatedStdFunctions are the std functions that the Jsonnet documentation marks as deprecated. Keep it in sync
+// with the standard library: an entry is added when a function is deprecated upstream.
+var deprecatedStdFunctions = map[string]stdDeprecation{
+	"base64Decode": {
+		replacement: "std.decodeUTF8(std.base64DecodeBytes(%s))",
+		reason:      "it decodes each byte as a code point, decode the bytes explicitly instead",
+	},
+}
+
+// analyzeDeprecatedStd reports the calls to deprecated std functions.
+func analyzeDeprecatedStd(node ast.Node) []protocol.Diagnostic {
+	name, _, ok := stdCall(node)
+	if !ok {
+		return nil
+	}
+	deprecation, ok := deprecatedStdFunctions[name]
+	if !ok {
+		return nil
+	}
+	return []protocol.Diagnostic{{
+		Range:    position.RangeASTToProtocol(*node.Loc()),
+		Severity: protocol.SeverityHint,
+		Code:     deprecatedStdDiagnosticCode,
+		Source:   "lint",
+		Message:  fmt.Sprintf("std.%s is deprecated, %s: %s", name, deprecation.reason, fmt.Sprintf(deprecation.replacement, "...")),
+		Tags:     []protocol.DiagnosticTag{protocol.Deprecated},
+	}}
+}
+
+// deprecatedStdCodeActions replaces the calls to deprecated std functions by their replacement, with the same
+// arguments.
+func (s *Server) deprecatedStdCodeActions(doc *document, diags []protocol.Diagnostic) []protocol.CodeAction {
+	if doc.ast == nil || len(doc.linesChangedSinceAST) > 0 {
+		return nil
+	}
+
+	var actions []protocol.CodeAction
+	for _, diag := range diags {
+		if diag.Code != deprecatedStdDiagnosticCode {
+			continue
+		}
+		walk(doc.ast, func(node ast.Node) {
+			apply, ok := node.(*ast.Apply)
+			if !ok || position.RangeASTToProtocol(apply.LocRange) != diag.Range {
+				return
+			}
+			name, _, ok := stdCall(apply)
+			if !ok {
+				return
+			}
+			deprecation, ok := deprecatedStdFunctions[name]
+			if !ok {
+				return
+			}
+			call := doc.item.Text[locationOffset(doc.item.Text, apply.LocRange.Begin):locationOffset(doc.item.Text, apply.LocRange.End)]
+			open := strings.Index(call, "(")
+			if open == -1 || !strings.HasSuffix(call, ")") {
+				return
+			}
+			replacement := fmt.Sprintf(deprecation.replacement, call[open+1:len(call)-1])
+			actions = append(actions, protocol.CodeAction{
+				Title:       fmt.Sprintf("Replace std.%s by %s", name, fmt.Sprintf(deprecation.replacement, "...")),
+				Kind:        protocol.QuickFix,
+				Diagnostics: []protocol.Diagnostic{diag},
+				Edit: protocol.WorkspaceEdit{
+					Changes: map[string][]protocol.TextEdit{
+						string(doc.item.URI): {{Range: diag.Range, NewText: replacement}},
+					},
+				},
+			})
+		})
+	}
+	return actions
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeprecatedStdDiagnostics(t *testing.T) {
+	testCases := []struct {
+		name     string
+		content  string
+		expected []string
+		fixed    string
+	}{
+		{
+			name:    "not deprecated",
+			content: "std.base64DecodeBytes('YQ==')",
+		},
+		{
+			name:    "deprecated",
+			content: "local encoded = 'YQ==';\n{\n  a: std.base64Decode(encoded),\n  b: std.base64Decode(std.base64('b')),\n}\n",
+			expected: []string{
+				"2:5-2:30 deprecated-std: std.base64Decode is deprecated, it decodes each byte as a code point, decode the bytes explicitly instead: std.decodeUTF8(std.base64DecodeBytes(...))",
+				"3:5-3:38 deprecated-std: std.base64Decode is deprecated, it decodes each byte as a code point, decode the bytes explicitly instead: std.decodeUTF8(std.base64DecodeBytes(...))",
+			},
+			fixed: "local encoded = 'YQ==';\n{\n  a: std.decodeUTF8(std.base64DecodeBytes(encoded)),\n  b: std.decodeUTF8(std.base64DecodeBytes(std.base64('b'))),\n}\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s, uri := testServerWithFile(t, nil, tc.content)
+			doc, err := s.cache.get(uri)
+			require.NoError(t, err)
+
+			var diags []protocol.Diagnostic
+			var found []string
+			for _, diag := range getAnalysisDiags(doc) {
+				if diag.Code != deprecatedStdDiagnosticCode {
+					continue
+				}
+				assert.Equal(t, protocol.SeverityHint, diag.Severity)
+				assert.Equal(t, []protocol.DiagnosticTag{protocol.Deprecated}, diag.Tags)
+				diags = append(diags, diag)
+				found = append(found, fmt.Sprintf("%d:%d-%d:%d %s: %s", diag.Range.Start.Line, diag.Range.Start.Character, diag.Range.End.Line, diag.Range.End.Character, diag.Code, diag.Message))
+			}
+			assert.Equal(t, tc.expected, found)
+			if len(diags) == 0 {
+				return
+			}
+
+			actions, err := s.CodeAction(context.TODO(), &protocol.CodeActionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+				Context:      protocol.CodeActionContext{Diagnostics: diags, Only: []protocol.CodeActionKind{protocol.QuickFix}},
+			})
+			require.NoError(t, err)
+			var edits []protocol.TextEdit
+			for _, action := range actions {
+				if !strings.HasPrefix(action.Title, "Suppress") {
+					edits = append(edits, action.Edit.Changes[string(uri)]...)
+				}
+			}
+			assert.Equal(t, tc.fixed, applyTextEdits(t, tc.content, edits))
+		})
+	}
+}
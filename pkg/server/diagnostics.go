@@ -5,10 +5,13 @@ import (
 	"context"
 	"fmt"
 	"regexp"
+	"runtime"
+	"runtime/debug"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/google/go-jsonnet"
 	"github.com/google/go-jsonnet/linter"
 	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
 	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
@@ -77,83 +80,200 @@ func (s *Server) queueDiagnostics(uri protocol.DocumentURI) {
 	s.cache.diagMutex.Lock()
 	defer s.cache.diagMutex.Unlock()
 	s.cache.diagQueue[uri] = struct{}{}
+
+	// The running diagnostics are for an outdated version of the document, stop them
+	if running, ok := s.cache.diagRunning.Load(uri); ok {
+		if cancel, ok := running.(context.CancelFunc); ok {
+			cancel()
+		}
+	}
+}
+
+// maxParallelEvaluations returns the number of documents whose diagnostics can be computed at the same time.
+func (c Configuration) maxParallelEvaluations() int {
+	if c.MaxParallelEvaluations > 0 {
+		return c.MaxParallelEvaluations
+	}
+	return runtime.GOMAXPROCS(0)
 }
 
 func (s *Server) diagnosticsLoop() {
 	go func() {
 		for {
-			s.cache.diagMutex.Lock()
-			for uri := range s.cache.diagQueue {
-				if _, ok := s.cache.diagRunning.Load(uri); ok {
-					continue
-				}
+			s.startQueuedDiagnostics()
+			time.Sleep(1 * time.Second)
+		}
+	}()
+}
+
+// startQueuedDiagnostics starts computing the diagnostics of the queued documents, as many as the
+// max_parallel_evaluations setting allows. Each document is evaluated on its own VM.
+func (s *Server) startQueuedDiagnostics() {
+	limit := s.config().maxParallelEvaluations()
+	s.cache.diagMutex.Lock()
+	running := 0
+	s.cache.diagRunning.Range(func(_, _ any) bool {
+		running++
+		return true
+	})
+	for uri := range s.cache.diagQueue {
+		if _, ok := s.cache.diagRunning.Load(uri); ok {
+			continue
+		}
+		// The documents over the limit wait for the next round
+		if running >= limit {
+			break
+		}
+		running++
+
+		ctx, cancel := context.WithCancel(context.Background())
+		s.cache.diagRunning.Store(uri, cancel)
+		go func() {
+			ctx, diagnosticsSpan := s.startSpan(ctx, "diagnostics")
+			diagnosticsSpan.setAttribute("uri", string(uri))
+			defer func() {
+				diagnosticsSpan.end(ctx.Err())
+				cancel()
+				s.cache.diagRunning.Delete(uri)
+			}()
+
+			log.Debug("Publishing diagnostics for ", uri)
+			doc, err := s.cache.get(uri)
+			if err != nil {
+				log.Errorf("publishDiagnostics: %s: %v\n", errorRetrievingDocument, err)
+				return
+			}
 
+			version := doc.item.Version
+			if doc.skipped != "" {
+				s.diagPublisher.publish(uri, version, []protocol.Diagnostic{skippedDiagnostic(doc.skipped)})
+				return
+			}
+			config := s.configurationFor(uri.SpanURI().Filename())
+			diags := []protocol.Diagnostic{}
+			evalChannel := make(chan []protocol.Diagnostic, 1)
+			go func() {
+				evalChannel <- s.getEvalDiags(ctx, doc)
+			}()
+
+			lintChannel := make(chan []protocol.Diagnostic, 1)
+			if config.EnableLintDiagnostics {
 				go func() {
-					s.cache.diagRunning.Store(uri, true)
-
-					log.Debug("Publishing diagnostics for ", uri)
-					doc, err := s.cache.get(uri)
-					if err != nil {
-						log.Errorf("publishDiagnostics: %s: %v\n", errorRetrievingDocument, err)
-						return
-					}
-
-					diags := []protocol.Diagnostic{}
-					evalChannel := make(chan []protocol.Diagnostic, 1)
-					go func() {
-						evalChannel <- s.getEvalDiags(doc)
-					}()
-
-					lintChannel := make(chan []protocol.Diagnostic, 1)
-					if s.configuration.EnableLintDiagnostics {
-						go func() {
-							lintChannel <- s.getLintDiags(doc)
-						}()
-					}
-
-					diags = append(diags, <-evalChannel...)
-
-					if s.configuration.EnableLintDiagnostics {
-						err = s.client.PublishDiagnostics(context.Background(), &protocol.PublishDiagnosticsParams{
-							URI:         uri,
-							Diagnostics: diags,
-						})
-						if err != nil {
-							log.Errorf("publishDiagnostics: unable to publish diagnostics: %v\n", err)
-						}
-
-						diags = append(diags, <-lintChannel...)
-					}
-
-					err = s.client.PublishDiagnostics(context.Background(), &protocol.PublishDiagnosticsParams{
-						URI:         uri,
-						Diagnostics: diags,
-					})
-					if err != nil {
-						log.Errorf("publishDiagnostics: unable to publish diagnostics: %v\n", err)
-					}
-
-					doc.diagnostics = diags
-
-					log.Debug("Done publishing diagnostics for ", uri)
-
-					s.cache.diagRunning.Delete(uri)
+					lintChannel <- s.getLintDiags(ctx, doc)
 				}()
-				delete(s.cache.diagQueue, uri)
 			}
-			s.cache.diagMutex.Unlock()
 
-			time.Sleep(1 * time.Second)
-		}
-	}()
+			diags = append(diags, <-evalChannel...)
+			if ctx.Err() != nil {
+				log.Debug("Diagnostics cancelled for ", uri)
+				return
+			}
+
+			if config.EnableLintDiagnostics {
+				s.diagPublisher.publish(uri, version, filterSuppressedDiagnostics(doc.item.Text, diags))
+
+				diags = append(diags, <-lintChannel...)
+				if ctx.Err() != nil {
+					log.Debug("Diagnostics cancelled for ", uri)
+					return
+				}
+			}
+			diags = append(diags, s.deadCodeDiags.get(doc)...)
+			diags = append(diags, s.findEmbeddedProblems(doc)...)
+			diags = filterSuppressedDiagnostics(doc.item.Text, diags)
+
+			s.diagPublisher.publish(uri, version, diags)
+
+			doc.diagnostics = diags
+
+			log.Debug("Done publishing diagnostics for ", uri)
+		}()
+		delete(s.cache.diagQueue, uri)
+	}
+	s.cache.diagMutex.Unlock()
 }
 
-func (s *Server) getEvalDiags(doc *document) (diags []protocol.Diagnostic) {
-	if doc.err == nil && s.configuration.EnableEvalDiagnostics {
-		vm := s.getVM(doc.item.URI.SpanURI().Filename())
-		doc.val, doc.err = vm.EvaluateAnonymousSnippet(doc.item.URI.SpanURI().Filename(), doc.item.Text)
+func (s *Server) getEvalDiags(ctx context.Context, doc *document) []protocol.Diagnostic {
+	path := doc.item.URI.SpanURI().Filename()
+	config := s.configurationFor(path)
+	if s.readOnlyFile(path) || !s.trusted() {
+		// The vendored and generated files are only evaluated as the imports of the others, and the files of the
+		// untrusted workspaces aren't
+		config.EnableEvalDiagnostics = false
 	}
+	if config.EnableEvalDiagnostics && s.evaluationBudgets.isDisabled(path) {
+		// The file was evaluated over its budget too many times, it is only parsed and linted
+		config.EnableEvalDiagnostics = false
+		return append(s.evalDiags(ctx, doc, config, nil), evaluationDisabledDiagnostic(config.evaluationBudget()))
+	}
+	if doc.err != nil || !config.EnableEvalDiagnostics {
+		return s.evalDiags(ctx, doc, config, nil)
+	}
+
+	// The edits that leave the AST as it was, apart from its locations and comments, don't change the output
+	vmConfig, settings := s.evaluationSettings(path)
+	environment := s.tankaEnvironments.selected(path)
+	if environment != "" {
+		// The snippet of the environment imports the document
+		withDocumentImport(settings, path, doc.item.Text)
+	}
+	importer := &recordingImporter{importer: &cancellableImporter{ctx: ctx, importer: s.getImporter(vmConfig, path, settings)}}
+	vm := s.makeVM(vmConfig, settings, importer)
+	snapshot := evalSnapshot{fingerprint: astFingerprint(doc.ast), inputs: vmInputs(vmConfig, settings) + " " + environment}
+	if diags, ok := s.reuseEvaluation(doc, snapshot.fingerprint, snapshot.inputs); ok {
+		return diags
+	}
+
+	diags := s.evalDiags(ctx, doc, config, vm)
+	if ctx.Err() == nil && !importer.failed {
+		snapshot.imports, snapshot.text, snapshot.val, snapshot.err, snapshot.diags = importer.imports, doc.item.Text, doc.val, doc.err, diags
+		s.evalCache.put(doc.item.URI, snapshot)
+	}
+	return diags
+}
 
+// evalDiags evaluates the document with the VM, if it parsed, and returns the diagnostics of its output or its error.
+func (s *Server) evalDiags(ctx context.Context, doc *document, config Configuration, vm *jsonnet.VM) (diags []protocol.Diagnostic) {
+	if doc.err == nil && config.EnableEvalDiagnostics {
+		evaluationDone := s.startEvaluationStatus(doc.item.URI)
+		_, evaluateSpan := s.startSpan(ctx, "evaluate")
+		path, snippet := doc.item.URI.SpanURI().Filename(), doc.item.Text
+		if environment := s.tankaEnvironments.selected(path); environment != "" {
+			snippet = tankaEnvironmentSnippet(path, environment)
+		}
+		start := time.Now()
+		val, err := s.evaluateInTurn(ctx, "diagnostics", path, func() (string, error) {
+			return vm.EvaluateAnonymousSnippet(path, snippet)
+		})
+		evaluateSpan.end(err)
+		if ctx.Err() != nil {
+			evaluationDone(nil)
+			// An evaluation that is abandoned over the budget is a strike, the evaluations of a file that are always
+			// abandoned for its next edit would keep the server busy without ever disabling it
+			if duration := time.Since(start); duration > s.configurationFor(path).evaluationBudget() {
+				s.recordEvaluationDuration(context.WithoutCancel(ctx), path, duration)
+			}
+			return nil
+		}
+		evaluationDone(err)
+		s.recordEvaluationDuration(ctx, path, time.Since(start))
+		doc.val, doc.err = val, err
+		if err == nil {
+			// The output is validated as it would be deployed, after the post-renderers
+			if doc.val, err = s.postRender(ctx, doc.item.URI.SpanURI().Filename(), val); err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				return []protocol.Diagnostic{postRenderDiagnostic(err)}
+			}
+			diags = append(diags, getPrometheusRuleDiags(doc)...)
+			diags = append(diags, s.getPolicyDiags(ctx, doc)...)
+		}
+	}
+
+	if diag, ok := jsonnetPanicDiagnostic(doc.err); ok {
+		return append(diags, diag)
+	}
 	if doc.err != nil {
 		diag := protocol.Diagnostic{Source: "jsonnet evaluation"}
 		lines := strings.Split(doc.err.Error(), "\n")
@@ -187,8 +307,11 @@ func (s *Server) getEvalDiags(doc *document) (diags []protocol.Diagnostic) {
 	return diags
 }
 
-func (s *Server) getLintDiags(doc *document) (diags []protocol.Diagnostic) {
-	result, err := s.lintWithRecover(doc)
+func (s *Server) getLintDiags(ctx context.Context, doc *document) (diags []protocol.Diagnostic) {
+	ctx, lintSpan := s.startSpan(ctx, "lint")
+	defer lintSpan.end(nil)
+
+	result, err := s.lintWithRecover(ctx, doc)
 	if err != nil {
 		log.Errorf("getLintDiags: %s: %v\n", errorRetrievingDocument, err)
 	} else {
@@ -198,18 +321,35 @@ func (s *Server) getLintDiags(doc *document) (diags []protocol.Diagnostic) {
 			diags = append(diags, diag)
 		}
 	}
+	diags = append(diags, getAnalysisDiags(doc)...)
+	for _, field := range s.findUndefinedFields(ctx, doc) {
+		diags = append(diags, field.diagnostic)
+	}
+	diags = append(diags, s.findTypeMismatches(ctx, doc)...)
+	diags = append(diags, s.findDuplicateFields(ctx, doc)...)
+	diags = append(diags, s.findHiddenFieldUses(ctx, doc)...)
+	diags = append(diags, s.findExpensiveConstructs(ctx, doc)...)
+	diags = append(diags, s.findDuplicateImports(doc)...)
+	missingFields, enumDiags := s.findSchemaProblems(doc)
+	for _, object := range missingFields {
+		diags = append(diags, object.diagnostic)
+	}
+	diags = append(diags, enumDiags...)
+	diags = append(diags, s.findStyleProblems(doc)...)
 
 	return diags
 }
 
-func (s *Server) lintWithRecover(doc *document) (result string, err error) {
+func (s *Server) lintWithRecover(ctx context.Context, doc *document) (result string, err error) {
 	defer func() {
 		if r := recover(); r != nil {
+			s.reportCrash(r)
+			s.writeCrashBundle(r, debug.Stack(), crashLocation{method: "lint", uri: doc.item.URI})
 			err = fmt.Errorf("error linting: %v", r)
 		}
 	}()
 
-	vm := s.getVM(doc.item.URI.SpanURI().Filename())
+	vm := s.getCancellableVM(ctx, doc.item.URI.SpanURI().Filename())
 
 	buf := &bytes.Buffer{}
 	linter.LintSnippet(vm, buf, []linter.Snippet{
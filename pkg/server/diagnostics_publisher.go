@@ -0,0 +1,127 @@
+package server
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+const diagnosticsPublishWindow = 250 * time.Millisecond
+
+// diagnosticsPublisher coalesces the diagnostics published for a document within a short window,
+// so that the client receives a single update when results arrive in quick succession
+// (for example, evaluation results arriving right before linting results).
+type diagnosticsPublisher struct {
+	client protocol.Client
+	window time.Duration
+	// currentVersion returns the latest known version of a document.
+	// Diagnostics computed for an older version are never published.
+	currentVersion func(protocol.DocumentURI) (int32, bool)
+
+	mu      sync.Mutex
+	pending map[protocol.DocumentURI]*protocol.PublishDiagnosticsParams
+	// published are the documents whose last published diagnostics aren't empty, the client shows them until they are
+	// cleared
+	published map[protocol.DocumentURI]bool
+}
+
+func newDiagnosticsPublisher(client protocol.Client, window time.Duration, currentVersion func(protocol.DocumentURI) (int32, bool)) *diagnosticsPublisher {
+	return &diagnosticsPublisher{
+		client:         client,
+		window:         window,
+		currentVersion: currentVersion,
+		pending:        make(map[protocol.DocumentURI]*protocol.PublishDiagnosticsParams),
+		published:      make(map[protocol.DocumentURI]bool),
+	}
+}
+
+// publish queues the diagnostics computed for a version of a document.
+// Diagnostics queued for the same document before the window elapses replace the previous ones,
+// unless they were computed for an older version, in which case they are dropped.
+func (p *diagnosticsPublisher) publish(uri protocol.DocumentURI, version int32, diags []protocol.Diagnostic) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if pending, ok := p.pending[uri]; ok {
+		if pending.Version > version {
+			log.Debugf("publishDiagnostics: dropping diagnostics for %s version %d, version %d is already queued", uri, version, pending.Version)
+			return
+		}
+		pending.Version = version
+		pending.Diagnostics = diags
+		return
+	}
+
+	p.pending[uri] = &protocol.PublishDiagnosticsParams{
+		URI:         uri,
+		Version:     version,
+		Diagnostics: diags,
+	}
+	time.AfterFunc(p.window, func() { p.flush(uri) })
+}
+
+// flush sends the queued diagnostics of a document to the client.
+func (p *diagnosticsPublisher) flush(uri protocol.DocumentURI) {
+	p.mu.Lock()
+	params, ok := p.pending[uri]
+	delete(p.pending, uri)
+	p.mu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	if current, ok := p.currentVersion(uri); ok && current > params.Version {
+		log.Debugf("publishDiagnostics: dropping stale diagnostics for %s version %d, document is at version %d", uri, params.Version, current)
+		return
+	}
+
+	p.send(params)
+}
+
+// send publishes diagnostics to the client, and keeps track of the documents that have some.
+func (p *diagnosticsPublisher) send(params *protocol.PublishDiagnosticsParams) {
+	if err := p.client.PublishDiagnostics(context.Background(), params); err != nil {
+		log.Errorf("publishDiagnostics: unable to publish diagnostics: %v\n", err)
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(params.Diagnostics) == 0 {
+		delete(p.published, params.URI)
+	} else {
+		p.published[params.URI] = true
+	}
+}
+
+// clearStale clears, right away, the diagnostics of the documents that are stale, along with the diagnostics queued
+// for them. It returns the documents that were cleared.
+func (p *diagnosticsPublisher) clearStale(stale func(protocol.DocumentURI) bool) []protocol.DocumentURI {
+	p.mu.Lock()
+	var cleared []protocol.DocumentURI
+	for uri := range p.published {
+		if stale(uri) {
+			cleared = append(cleared, uri)
+		}
+	}
+	for uri := range p.pending {
+		if !p.published[uri] && stale(uri) {
+			// The queued diagnostics are dropped, there is nothing to clear on the client
+			delete(p.pending, uri)
+		}
+	}
+	for _, uri := range cleared {
+		delete(p.pending, uri)
+	}
+	p.mu.Unlock()
+
+	sort.Slice(cleared, func(i, j int) bool { return cleared[i] < cleared[j] })
+	for _, uri := range cleared {
+		p.send(&protocol.PublishDiagnosticsParams{URI: uri, Diagnostics: []protocol.Diagnostic{}})
+	}
+	return cleared
+}
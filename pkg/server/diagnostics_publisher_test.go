@@ -0,0 +1,157 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingClient records the notifications sent to the client.
+type recordingClient struct {
+	protocol.ClientCloser
+
+	mu        sync.Mutex
+	published []protocol.PublishDiagnosticsParams
+	events    []interface{}
+	logs      []protocol.LogMessageParams
+	messages  []protocol.ShowMessageParams
+	progress  []protocol.ProgressParams
+}
+
+func (c *recordingClient) PublishDiagnostics(_ context.Context, params *protocol.PublishDiagnosticsParams) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.published = append(c.published, *params)
+	return nil
+}
+
+func (c *recordingClient) Event(_ context.Context, params *interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.events = append(c.events, *params)
+	return nil
+}
+
+func (c *recordingClient) LogMessage(_ context.Context, params *protocol.LogMessageParams) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.logs = append(c.logs, *params)
+	return nil
+}
+
+func (c *recordingClient) ShowMessage(_ context.Context, params *protocol.ShowMessageParams) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.messages = append(c.messages, *params)
+	return nil
+}
+
+func (c *recordingClient) Progress(_ context.Context, params *protocol.ProgressParams) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.progress = append(c.progress, *params)
+	return nil
+}
+
+func (c *recordingClient) getProgress() []protocol.ProgressParams {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]protocol.ProgressParams(nil), c.progress...)
+}
+
+func (c *recordingClient) getMessages() []protocol.ShowMessageParams {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]protocol.ShowMessageParams{}, c.messages...)
+}
+
+func (c *recordingClient) getLogs() []protocol.LogMessageParams {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]protocol.LogMessageParams{}, c.logs...)
+}
+
+func (c *recordingClient) getEvents() []interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]interface{}(nil), c.events...)
+}
+
+func (c *recordingClient) getPublished() []protocol.PublishDiagnosticsParams {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]protocol.PublishDiagnosticsParams{}, c.published...)
+}
+
+func TestDiagnosticsPublisher(t *testing.T) {
+	evalDiag := protocol.Diagnostic{Source: "jsonnet evaluation", Message: "eval"}
+	lintDiag := protocol.Diagnostic{Source: "lint", Message: "lint"}
+	uri := protocol.DocumentURI("file:///test.jsonnet")
+
+	testCases := []struct {
+		name           string
+		currentVersion int32
+		publish        func(p *diagnosticsPublisher)
+		expected       []protocol.PublishDiagnosticsParams
+	}{
+		{
+			name:           "successive updates are coalesced",
+			currentVersion: 1,
+			publish: func(p *diagnosticsPublisher) {
+				p.publish(uri, 1, []protocol.Diagnostic{evalDiag})
+				p.publish(uri, 1, []protocol.Diagnostic{evalDiag, lintDiag})
+			},
+			expected: []protocol.PublishDiagnosticsParams{
+				{URI: uri, Version: 1, Diagnostics: []protocol.Diagnostic{evalDiag, lintDiag}},
+			},
+		},
+		{
+			name:           "older versions do not replace newer ones",
+			currentVersion: 2,
+			publish: func(p *diagnosticsPublisher) {
+				p.publish(uri, 2, []protocol.Diagnostic{lintDiag})
+				p.publish(uri, 1, []protocol.Diagnostic{evalDiag})
+			},
+			expected: []protocol.PublishDiagnosticsParams{
+				{URI: uri, Version: 2, Diagnostics: []protocol.Diagnostic{lintDiag}},
+			},
+		},
+		{
+			name:           "diagnostics for an outdated document are dropped",
+			currentVersion: 3,
+			publish: func(p *diagnosticsPublisher) {
+				p.publish(uri, 2, []protocol.Diagnostic{evalDiag})
+			},
+			expected: nil,
+		},
+		{
+			name:           "each document is published separately",
+			currentVersion: 1,
+			publish: func(p *diagnosticsPublisher) {
+				p.publish(uri, 1, []protocol.Diagnostic{evalDiag})
+				p.publish("file:///other.jsonnet", 1, []protocol.Diagnostic{lintDiag})
+			},
+			expected: []protocol.PublishDiagnosticsParams{
+				{URI: uri, Version: 1, Diagnostics: []protocol.Diagnostic{evalDiag}},
+				{URI: "file:///other.jsonnet", Version: 1, Diagnostics: []protocol.Diagnostic{lintDiag}},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &recordingClient{}
+			p := newDiagnosticsPublisher(client, 10*time.Millisecond, func(protocol.DocumentURI) (int32, bool) {
+				return tc.currentVersion, true
+			})
+
+			tc.publish(p)
+			time.Sleep(100 * time.Millisecond)
+
+			assert.ElementsMatch(t, tc.expected, client.getPublished())
+		})
+	}
+}
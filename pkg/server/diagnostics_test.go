@@ -1,10 +1,14 @@
 package server
 
 import (
+	"context"
+	"fmt"
+	"runtime"
 	"testing"
 
 	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestGetLintDiags(t *testing.T) {
@@ -62,7 +66,7 @@ local unused = 'test';
 				t.Fatalf("%s: %v", errorRetrievingDocument, err)
 			}
 
-			diags := s.getLintDiags(doc)
+			diags := s.getLintDiags(context.Background(), doc)
 			assert.Equal(t, tc.expected, diags)
 		})
 	}
@@ -150,8 +154,61 @@ func TestGetEvalDiags(t *testing.T) {
 				t.Fatalf("%s: %v", errorRetrievingDocument, err)
 			}
 
-			diags := s.getEvalDiags(doc)
+			diags := s.getEvalDiags(context.Background(), doc)
 			assert.Equal(t, tc.expected, diags)
 		})
 	}
 }
+
+func TestStartQueuedDiagnostics(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		settings      map[string]interface{}
+		expectedErr   string
+		expectedQueue int
+	}{
+		{
+			name:          "limited",
+			settings:      map[string]interface{}{"max_parallel_evaluations": float64(2)},
+			expectedQueue: 2,
+		},
+		{
+			name:          "GOMAXPROCS",
+			settings:      map[string]interface{}{"max_parallel_evaluations": float64(0)},
+			expectedQueue: max(0, 4-runtime.GOMAXPROCS(0)),
+		},
+		{
+			name:        "not an integer",
+			settings:    map[string]interface{}{"max_parallel_evaluations": 1.5},
+			expectedErr: "JSON RPC invalid params: unsupported settings value for max_parallel_evaluations. expected integer. got: 1.5",
+		},
+		{
+			name:        "negative",
+			settings:    map[string]interface{}{"max_parallel_evaluations": float64(-1)},
+			expectedErr: "JSON RPC invalid params: unsupported settings value for max_parallel_evaluations. expected a positive integer, or 0 for GOMAXPROCS. got: -1",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// The server isn't initialized, the diagnostics loop doesn't start the queued documents in the background
+			s := NewServer("any", "test version", &recordingClient{}, Configuration{})
+			err := s.DidChangeConfiguration(context.Background(), &protocol.DidChangeConfigurationParams{Settings: tc.settings})
+			if tc.expectedErr != "" {
+				require.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+
+			for i := 0; i < 4; i++ {
+				require.NoError(t, s.DidOpen(context.Background(), &protocol.DidOpenTextDocumentParams{
+					TextDocument: protocol.TextDocumentItem{URI: protocol.URIFromPath(fmt.Sprintf("/test%d.jsonnet", i)), Text: "{}", Version: 1},
+				}))
+			}
+			s.startQueuedDiagnostics()
+
+			// The documents that didn't start wait in the queue
+			s.cache.diagMutex.RLock()
+			defer s.cache.diagMutex.RUnlock()
+			assert.Len(t, s.cache.diagQueue, tc.expectedQueue)
+		})
+	}
+}
@@ -0,0 +1,471 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/go-jsonnet/ast"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// symbolDoc is the documentation of a field or a local, from its docsonnet field or from the comment above it.
+type symbolDoc struct {
+	// signature is the name of a function and its parameters, empty for other values
+	signature string
+	// typ is the type given to docsonnet values
+	typ  string
+	help string
+}
+
+// markdown renders the documentation for hovers and completion items.
+func (d symbolDoc) markdown() string {
+	var parts []string
+	if d.signature != "" {
+		parts = append(parts, fmt.Sprintf("`%s`", d.signature))
+	}
+	if d.typ != "" {
+		parts = append(parts, fmt.Sprintf("type: `%s`", d.typ))
+	}
+	if d.help != "" {
+		parts = append(parts, d.help)
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// indexedFile is the documentation of the fields and locals of a file, by the line where they start, and the summary
+// of what it exports.
+type indexedFile struct {
+	modTime time.Time
+	docs    map[int]symbolDoc
+	exports *exportedValue
+}
+
+// indexedDocument is the documentation of the fields and locals of an open document, and the summary of what it
+// exports, for its text.
+type indexedDocument struct {
+	text    string
+	docs    map[int]symbolDoc
+	exports *exportedValue
+}
+
+// docsIndex caches the documentation of the fields and locals of libraries, so that hovering and completing their
+// symbols doesn't evaluate them. The vendored libraries are indexed when the server warms up, the other files when
+// they are first looked up, and the files are indexed again when they change. The open documents are indexed from
+// their text.
+type docsIndex struct {
+	mu        sync.Mutex
+	files     map[string]indexedFile
+	documents map[string]indexedDocument
+	// contents are read through the cache of the imported files, the indexed files are the ones that get imported
+	contents *fileCache
+	// maxFileSize is the size of the largest file that is indexed, from the max_file_size setting
+	maxFileSize atomic.Int64
+	// shardRoots are the directories whose top-level directories are indexed lazily, each of them the first time one
+	// of its files is opened or looked up. They are nil when the libraries are indexed on startup.
+	shardRoots []string
+	// loadedShards are the shards that are indexed, or being indexed
+	loadedShards map[string]bool
+}
+
+func newDocsIndex(contents *fileCache) *docsIndex {
+	index := &docsIndex{files: map[string]indexedFile{}, documents: map[string]indexedDocument{}, contents: contents}
+	index.maxFileSize.Store(defaultMaxFileSize)
+	return index
+}
+
+// symbolDoc returns the documentation of the field or local that starts at the line, 1-based, of the file. The
+// documents that are open are read from the cache, they may not be saved.
+func (s *Server) symbolDoc(path string, line int) (symbolDoc, bool) {
+	if doc, err := s.cache.get(protocol.URIFromPath(path)); err == nil {
+		if doc.skipped != "" {
+			return symbolDoc{}, false
+		}
+		return s.docs.lookupDocument(path, doc.item.Text, line)
+	}
+	// The other files of the library are likely to be looked up next
+	go s.docs.loadShard(path)
+	return s.docs.lookup(path, line)
+}
+
+// lookupDocument returns the documentation of the field or local that starts at the line, 1-based, of the text of
+// an open document.
+func (i *docsIndex) lookupDocument(path, text string, line int) (symbolDoc, bool) {
+	doc, ok := i.indexDocument(path, text).docs[line]
+	return doc, ok
+}
+
+// indexDocument returns the index of an open document, indexing it again if its text changed.
+func (i *docsIndex) indexDocument(path, text string) indexedDocument {
+	i.mu.Lock()
+	document, ok := i.documents[path]
+	i.mu.Unlock()
+	if !ok || document.text != text {
+		docs, exports := indexContent(path, text)
+		document = indexedDocument{text: text, docs: docs, exports: exports}
+		i.mu.Lock()
+		i.documents[path] = document
+		i.mu.Unlock()
+	}
+	return document
+}
+
+// reset forgets the indexed files and documents, they are indexed again when they are looked up or built.
+func (i *docsIndex) reset() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.files, i.documents = map[string]indexedFile{}, map[string]indexedDocument{}
+}
+
+// build indexes the Jsonnet files under the directories.
+func (i *docsIndex) build(roots []string) {
+	start, count := time.Now(), 0
+	for _, root := range roots {
+		err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if entry.IsDir() {
+				if path != root && strings.HasPrefix(entry.Name(), ".") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if ext := filepath.Ext(path); ext == ".libsonnet" || ext == ".jsonnet" {
+				if _, ok := i.lookupFile(path); ok {
+					count++
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			log.Warnf("Unable to index the documentation of %s: %v", root, err)
+		}
+	}
+	log.Infof("Indexed the documentation of %d files in %s", count, time.Since(start))
+}
+
+// shard makes the top-level directories of the roots the shards of the index, which are indexed lazily. Without
+// roots, nothing is indexed lazily.
+func (i *docsIndex) shard(roots []string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.shardRoots, i.loadedShards = roots, map[string]bool{}
+}
+
+// loadShard indexes the shard of a file, unless it is already indexed. It returns once the shard is indexed.
+func (i *docsIndex) loadShard(path string) {
+	i.mu.Lock()
+	shard := shardOf(i.shardRoots, path)
+	if shard == "" || i.loadedShards[shard] {
+		i.mu.Unlock()
+		return
+	}
+	i.loadedShards[shard] = true
+	i.mu.Unlock()
+	i.build([]string{shard})
+}
+
+// shardOf returns the top-level directory of the roots that a file is in, empty if it isn't in one of them.
+func shardOf(roots []string, path string) string {
+	for _, root := range roots {
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		first, _, nested := strings.Cut(filepath.ToSlash(rel), "/")
+		if !nested {
+			// The files at the top of a root are in no shard, they are indexed on their own
+			return ""
+		}
+		return filepath.Join(root, first)
+	}
+	return ""
+}
+
+// lookup returns the documentation of the field or local that starts at the line, 1-based, of the file.
+func (i *docsIndex) lookup(path string, line int) (symbolDoc, bool) {
+	file, ok := i.lookupFile(path)
+	if !ok {
+		return symbolDoc{}, false
+	}
+	doc, ok := file.docs[line]
+	return doc, ok
+}
+
+func (i *docsIndex) lookupFile(path string) (indexedFile, bool) {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() || info.Size() > i.maxFileSize.Load() {
+		return indexedFile{}, false
+	}
+	i.mu.Lock()
+	file, ok := i.files[path]
+	i.mu.Unlock()
+	if ok && file.modTime.Equal(info.ModTime()) {
+		return file, true
+	}
+
+	content, err := i.contents.read(path)
+	if err != nil || content == nil || isBinary(content.String()) {
+		return indexedFile{}, false
+	}
+	docs, exports := indexContent(path, content.String())
+	file = indexedFile{modTime: info.ModTime(), docs: docs, exports: exports}
+	i.mu.Lock()
+	i.files[path] = file
+	i.mu.Unlock()
+	return file, true
+}
+
+// warmUp reads, parses and indexes the libraries of the vendor directories in the background, so that the first
+// completions and hovers of a session find them in the caches instead of reading them from disk.
+func (s *Server) warmUp() {
+	s.docs.shard(nil)
+	// The configuration is read before the goroutine starts, it may be replaced while the goroutine indexes
+	config := s.config()
+	if config.SkipWarmUp {
+		return
+	}
+	dirs := s.vendorDirectories()
+	if config.ShardIndex {
+		// Only the shards that the user works on are indexed, as their files are opened or looked up
+		s.docs.shard(dirs)
+		return
+	}
+	_, indexSpan := s.startSpan(context.Background(), "index")
+	go func() {
+		s.docs.build(dirs)
+		indexSpan.end(nil)
+	}()
+}
+
+// vendorDirectories are the directories whose libraries are indexed on startup: the vendor directory of the
+// workspace and the configured library paths.
+func (s *Server) vendorDirectories() []string {
+	var dirs []string
+	if s.workspaceFolder != "" {
+		dirs = append(dirs, filepath.Join(s.workspaceFolder, "vendor"))
+	}
+	for _, jpath := range s.config().JPaths {
+		if !filepath.IsAbs(jpath) && s.workspaceFolder != "" {
+			jpath = filepath.Join(s.workspaceFolder, jpath)
+		}
+		dirs = append(dirs, jpath)
+	}
+
+	var existing []string
+	for _, dir := range dirs {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			existing = append(existing, dir)
+		}
+	}
+	return existing
+}
+
+// extractDocs parses a file, without evaluating it, and returns the documentation of its fields and locals by the
+// line where they start. The docsonnet fields (`'#name': d.fn(...)`) document their siblings, the other fields and the
+// locals are documented by the comment above them.
+func extractDocs(path, content string) map[int]symbolDoc {
+	docs, _ := indexContent(path, content)
+	return docs
+}
+
+// indexContent parses a file once, and returns the documentation of its fields and locals and the summary of what it
+// exports.
+func indexContent(path, content string) (map[int]symbolDoc, *exportedValue) {
+	root, err := snippetToAST(path, content)
+	if err != nil {
+		return nil, nil
+	}
+	docs := rootDocs(root, path, content)
+	return docs, exportSummary(root, path, docs)
+}
+
+// rootDocs returns the documentation of the fields and locals of a parsed file.
+func rootDocs(root ast.Node, path, content string) map[int]symbolDoc {
+	lines := strings.Split(content, "\n")
+	docs := map[int]symbolDoc{}
+	documentBinds := func(binds ast.LocalBinds) {
+		for _, bind := range binds {
+			if bind.Body == nil || bind.Variable == "$" {
+				continue
+			}
+			// The binds of functions have no location, their bodies do
+			loc := bind.LocRange
+			if !loc.Begin.IsSet() {
+				loc = *bind.Body.Loc()
+			}
+			if loc.FileName != path {
+				continue
+			}
+			if _, ok := docs[loc.Begin.Line]; ok {
+				continue
+			}
+			if help := commentAbove(lines, loc.Begin.Line); help != "" {
+				docs[loc.Begin.Line] = symbolDoc{help: help}
+			}
+		}
+	}
+	walk(root, func(node ast.Node) {
+		if local, ok := node.(*ast.Local); ok {
+			documentBinds(local.Binds)
+			return
+		}
+		object, ok := node.(*ast.DesugaredObject)
+		if !ok {
+			return
+		}
+		fieldLines := map[string]int{}
+		for _, field := range object.Fields {
+			if name, ok := field.Name.(*ast.LiteralString); ok && field.LocRange.FileName == path {
+				fieldLines[name.Value] = field.LocRange.Begin.Line
+			}
+		}
+		for _, field := range object.Fields {
+			name, ok := field.Name.(*ast.LiteralString)
+			if !ok || field.LocRange.FileName != path {
+				continue
+			}
+			if documented, ok := strings.CutPrefix(name.Value, "#"); ok && documented != "" {
+				if line, ok := fieldLines[documented]; ok {
+					if doc, ok := docsonnetDoc(documented, field.Body); ok {
+						docs[line] = doc
+					}
+				}
+				continue
+			}
+			line := field.LocRange.Begin.Line
+			if _, ok := docs[line]; ok {
+				continue
+			}
+			if help := commentAbove(lines, line); help != "" {
+				docs[line] = symbolDoc{help: help}
+			}
+		}
+		documentBinds(object.Locals)
+	})
+	return docs
+}
+
+// docsonnetDoc reads the documentation of the `d.fn(help, args)`, `d.obj(help)` and `d.val(type, help)` calls of
+// docsonnet.
+func docsonnetDoc(name string, node ast.Node) (symbolDoc, bool) {
+	apply, ok := node.(*ast.Apply)
+	if !ok {
+		return symbolDoc{}, false
+	}
+	index, ok := apply.Target.(*ast.Index)
+	if !ok {
+		return symbolDoc{}, false
+	}
+	kind, ok := index.Index.(*ast.LiteralString)
+	if !ok {
+		return symbolDoc{}, false
+	}
+
+	var params []string
+	switch kind.Value {
+	case "fn":
+		params = []string{"help", "args"}
+	case "obj":
+		params = []string{"help", "fields"}
+	case "val":
+		params = []string{"type", "help", "default"}
+	default:
+		return symbolDoc{}, false
+	}
+	args := map[string]ast.Node{}
+	for i, arg := range apply.Arguments.Positional {
+		if i < len(params) {
+			args[params[i]] = arg.Expr
+		}
+	}
+	for _, arg := range apply.Arguments.Named {
+		args[string(arg.Name)] = arg.Arg
+	}
+
+	doc := symbolDoc{help: literalString(args["help"]), typ: literalString(args["type"])}
+	if kind.Value == "fn" {
+		var names []string
+		if array, ok := args["args"].(*ast.Array); ok {
+			for _, element := range array.Elements {
+				// d.arg(name, type, default)
+				if arg, ok := element.Expr.(*ast.Apply); ok && len(arg.Arguments.Positional) > 0 {
+					if argName := literalString(arg.Arguments.Positional[0].Expr); argName != "" {
+						names = append(names, argName)
+					}
+				}
+			}
+		}
+		doc.signature = fmt.Sprintf("%s(%s)", name, strings.Join(names, ", "))
+	}
+	return doc, true
+}
+
+// literalString returns the value of a string literal, and of the `d.T.string` type constants.
+func literalString(node ast.Node) string {
+	switch node := node.(type) {
+	case *ast.LiteralString:
+		return node.Value
+	case *ast.Index:
+		if index, ok := node.Index.(*ast.LiteralString); ok {
+			return index.Value
+		}
+	}
+	return ""
+}
+
+// commentAbove returns the text of the contiguous comment block right above the line, 1-based: line comments, or a
+// block comment that has its own lines.
+func commentAbove(lines []string, line int) string {
+	i := line - 2
+	if i < 0 || i >= len(lines) {
+		return ""
+	}
+
+	if last := strings.TrimSpace(lines[i]); strings.HasSuffix(last, "*/") {
+		var block []string
+		for ; i >= 0; i-- {
+			text := strings.TrimSpace(lines[i])
+			// The block comment starts its line, and doesn't end before the last line
+			if start := strings.Index(text, "/*"); start > 0 || (len(block) > 0 && strings.Contains(text, "*/")) {
+				return ""
+			} else if start == 0 {
+				block = append([]string{text}, block...)
+				break
+			}
+			block = append([]string{text}, block...)
+		}
+		if i < 0 {
+			return ""
+		}
+		text := strings.TrimSuffix(strings.TrimLeft(strings.Join(block, "\n"), "/*"), "*/")
+		var cleaned []string
+		for _, l := range strings.Split(text, "\n") {
+			cleaned = append(cleaned, strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(l), "*")))
+		}
+		return strings.TrimSpace(strings.Join(cleaned, "\n"))
+	}
+
+	var comment []string
+	for ; i >= 0; i-- {
+		text := strings.TrimSpace(lines[i])
+		switch {
+		case strings.HasPrefix(text, "//"):
+			text = strings.TrimPrefix(text, "//")
+		case strings.HasPrefix(text, "#"):
+			text = strings.TrimPrefix(text, "#")
+		default:
+			return strings.Join(comment, "\n")
+		}
+		comment = append([]string{strings.TrimSpace(text)}, comment...)
+	}
+	return strings.Join(comment, "\n")
+}
@@ -0,0 +1,275 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const docsonnetLibrary = `local d = import 'doc-util/main.libsonnet';
+{
+  '#new': d.fn('new creates a deployment.', [d.arg('name', d.T.string), d.arg('replicas', d.T.number)]),
+  new(name, replicas=1): { name: name, replicas: replicas },
+
+  '#defaults': d.obj('defaults are the default values.'),
+  defaults: {},
+
+  '#replicas': d.val(d.T.number, help='replicas is the default number of replicas.'),
+  replicas: 1,
+
+  // withName sets the name.
+  // It replaces the previous one.
+  withName(name): { name: name },
+
+  /**
+   * withImage sets the image.
+   */
+  withImage(image): { image: image },
+
+  undocumented: true,
+}
+`
+
+func TestExtractDocs(t *testing.T) {
+	docs := extractDocs("lib.libsonnet", docsonnetLibrary)
+	assert.Equal(t, map[int]symbolDoc{
+		4:  {signature: "new(name, replicas)", help: "new creates a deployment."},
+		7:  {help: "defaults are the default values."},
+		10: {typ: "number", help: "replicas is the default number of replicas."},
+		14: {help: "withName sets the name.\nIt replaces the previous one."},
+		19: {help: "withImage sets the image."},
+	}, docs)
+
+	assert.Nil(t, extractDocs("invalid.libsonnet", "{"))
+}
+
+func TestExtractDocs_Comments(t *testing.T) {
+	docs := extractDocs("lib.libsonnet", `// config is the configuration.
+local config = {};
+
+# helper doubles its argument.
+local helper(x) = x * 2;
+
+local a = 1;  // not above
+local b = 2;
+
+/* block */
+local c = 3;
+
+local d = 4; /* trailing
+comment */
+local e = 5;
+
+{
+  // fields is a field.
+  fields: {
+    // local of an object
+    local hidden = 1,
+
+    /**
+     * value is documented.
+     */
+    value: hidden + config + helper(a) + b + c + d + e,
+  },
+}
+`)
+	assert.Equal(t, map[int]symbolDoc{
+		2:  {help: "config is the configuration."},
+		5:  {help: "helper doubles its argument."},
+		11: {help: "block"},
+		19: {help: "fields is a field."},
+		21: {help: "local of an object"},
+		26: {help: "value is documented."},
+	}, docs)
+}
+
+func TestDocsIndex(t *testing.T) {
+	root := writeProjectFiles(t, map[string]string{
+		"vendor/lib/main.libsonnet":   docsonnetLibrary,
+		"vendor/.git/ignored.jsonnet": "{\n  // ignored\n  a: 1,\n}",
+	})
+
+	index := newDocsIndex(newFileCache())
+	index.build([]string{filepath.Join(root, "vendor")})
+	assert.Len(t, index.files, 1)
+
+	path := filepath.Join(root, "vendor/lib/main.libsonnet")
+	doc, ok := index.lookup(path, 4)
+	require.True(t, ok)
+	assert.Equal(t, "`new(name, replicas)`\n\nnew creates a deployment.", doc.markdown())
+	_, ok = index.lookup(path, 21)
+	assert.False(t, ok)
+
+	// The files are indexed again when they change
+	require.NoError(t, os.WriteFile(path, []byte("{\n  // changed\n  new: 1,\n}"), 0o600))
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(path, later, later))
+	doc, ok = index.lookup(path, 3)
+	require.True(t, ok)
+	assert.Equal(t, "changed", doc.help)
+
+	_, ok = index.lookup(filepath.Join(root, "missing.libsonnet"), 1)
+	assert.False(t, ok)
+}
+
+func TestDocsIndex_HoverAndCompletion(t *testing.T) {
+	root := writeProjectFiles(t, map[string]string{
+		"vendor/lib/main.libsonnet": docsonnetLibrary,
+		"main.jsonnet":              "local lib = import 'lib/main.libsonnet';\nlib.new('app')",
+	})
+	s := testServer(t, nil)
+	require.NoError(t, s.DidChangeConfiguration(context.TODO(), &protocol.DidChangeConfigurationParams{
+		Settings: map[string]interface{}{"jpath": []interface{}{filepath.Join(root, "vendor")}},
+	}))
+	uri := serverOpenTestFile(t, s, filepath.Join(root, "main.jsonnet"))
+
+	hover, err := s.Hover(context.TODO(), &protocol.HoverParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     protocol.Position{Line: 1, Character: 5},
+		},
+	})
+	require.NoError(t, err)
+	require.NotNil(t, hover)
+	assert.Contains(t, hover.Contents.Value, "`new(name, replicas)`\n\nnew creates a deployment.")
+
+	require.NoError(t, s.DidChange(context.TODO(), &protocol.DidChangeTextDocumentParams{
+		ContentChanges: []protocol.TextDocumentContentChangeEvent{{
+			Text: "local lib = import 'lib/main.libsonnet';\nlib.new('app') + lib.",
+		}},
+		TextDocument: protocol.VersionedTextDocumentIdentifier{
+			TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: uri},
+			Version:                2,
+		},
+	}))
+	list, err := s.Completion(context.TODO(), &protocol.CompletionParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     protocol.Position{Line: 1, Character: 21},
+		},
+	})
+	require.NoError(t, err)
+	documentation := map[string]string{}
+	for _, item := range list.Items {
+		documentation[item.Label] = item.Documentation
+	}
+	assert.Equal(t, "withName sets the name.\nIt replaces the previous one.", documentation["withName"])
+	assert.Contains(t, documentation, "undocumented")
+	assert.Empty(t, documentation["undocumented"])
+}
+
+func TestDocsIndex_OpenDocuments(t *testing.T) {
+	s, uri := testServerWithFile(t, nil, "// saved\nlocal a = 1;\na")
+	doc, ok := s.symbolDoc(uri.SpanURI().Filename(), 2)
+	require.True(t, ok)
+	assert.Equal(t, "saved", doc.help)
+
+	// The unsaved changes are documented
+	content := "// not saved\n// yet\nlocal a = 1;\n{ x: a }"
+	require.NoError(t, s.DidChange(context.TODO(), &protocol.DidChangeTextDocumentParams{
+		ContentChanges: []protocol.TextDocumentContentChangeEvent{{Text: content}},
+		TextDocument: protocol.VersionedTextDocumentIdentifier{
+			TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: uri},
+			Version:                2,
+		},
+	}))
+	doc, ok = s.symbolDoc(uri.SpanURI().Filename(), 3)
+	require.True(t, ok)
+	assert.Equal(t, "not saved\nyet", doc.help)
+
+	list, err := s.Completion(context.TODO(), &protocol.CompletionParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     protocol.Position{Line: 3, Character: 6},
+		},
+	})
+	require.NoError(t, err)
+	// The local comes before the keywords that start with the same letter
+	require.NotEmpty(t, list.Items)
+	assert.Equal(t, "a", list.Items[0].Label)
+	assert.Equal(t, "not saved\nyet", list.Items[0].Documentation)
+}
+
+func TestWarmUp(t *testing.T) {
+	root := writeProjectFiles(t, map[string]string{
+		"vendor/lib/main.libsonnet": "{\n  // new creates an app.\n  new(name): { name: name },\n}",
+	})
+	misses := func(s *Server) uint64 {
+		_, misses := s.files.stats()
+		return misses
+	}
+
+	t.Run("enabled", func(t *testing.T) {
+		s := NewServer("any", "test version", nil, Configuration{})
+		s.workspaceFolder = root
+		s.warmUp()
+		require.Eventually(t, func() bool { return misses(s) == 1 }, time.Second, 10*time.Millisecond)
+
+		// The library is read from the cache by the evaluations, and its documentation is indexed
+		vm := s.getVM(filepath.Join(root, "main.jsonnet"))
+		_, err := vm.EvaluateAnonymousSnippet("main.jsonnet", "(import 'vendor/lib/main.libsonnet').new('app')")
+		require.NoError(t, err)
+		hits, misses := s.files.stats()
+		assert.Equal(t, []uint64{1, 1}, []uint64{hits, misses})
+		s.docs.mu.Lock()
+		assert.Len(t, s.docs.files, 1)
+		s.docs.mu.Unlock()
+	})
+
+	t.Run("sharded", func(t *testing.T) {
+		root := writeProjectFiles(t, map[string]string{
+			"vendor/first/main.libsonnet":  "{\n  // new creates an app.\n  new(name): { name: name },\n}",
+			"vendor/first/util.libsonnet":  "{}",
+			"vendor/second/main.libsonnet": "{}",
+		})
+		s := NewServer("any", "test version", nil, Configuration{ShardIndex: true})
+		s.workspaceFolder = root
+		s.warmUp()
+		assert.Never(t, func() bool { return misses(s) > 0 }, 100*time.Millisecond, 10*time.Millisecond)
+
+		// Looking up a file indexes the other files of its top-level directory, and only them
+		doc, ok := s.symbolDoc(filepath.Join(root, "vendor/first/main.libsonnet"), 3)
+		require.True(t, ok)
+		assert.Equal(t, "new creates an app.", doc.help)
+		require.Eventually(t, func() bool { return misses(s) == 2 }, time.Second, 10*time.Millisecond)
+		assert.Never(t, func() bool { return misses(s) > 2 }, 100*time.Millisecond, 10*time.Millisecond)
+		s.docs.mu.Lock()
+		assert.Len(t, s.docs.files, 2)
+		s.docs.mu.Unlock()
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		s := NewServer("any", "test version", nil, Configuration{})
+		s.workspaceFolder = root
+		require.NoError(t, s.DidChangeConfiguration(context.TODO(), &protocol.DidChangeConfigurationParams{
+			Settings: map[string]interface{}{"warm_up": false},
+		}))
+		s.warmUp()
+		assert.Never(t, func() bool { return misses(s) > 0 }, 100*time.Millisecond, 10*time.Millisecond)
+	})
+}
+
+func TestShardOf(t *testing.T) {
+	roots := []string{"/workspace/vendor", "/libs"}
+	testCases := []struct {
+		path     string
+		expected string
+	}{
+		{path: "/workspace/vendor/github.com/grafana/lib.libsonnet", expected: "/workspace/vendor/github.com"},
+		{path: "/libs/k8s/main.libsonnet", expected: "/libs/k8s"},
+		{path: "/libs/main.libsonnet"},
+		{path: "/workspace/main.jsonnet"},
+		{path: "/libraries/k8s/main.libsonnet"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			assert.Equal(t, tc.expected, shardOf(roots, tc.path))
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/grafana/jsonnet-language-server/pkg/utils"
+	"github.com/jdbaldry/go-language-server-protocol/jsonrpc2"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+)
+
+// maxStaleRetries is the number of times a request is recomputed when the document changes while it is being processed.
+const maxStaleRetries = 2
+
+// errContentModified tells the client that the result of a request was computed against an outdated document.
+// https://microsoft.github.io/language-server-protocol/specifications/lsp/3.17/specification/#errorCodes
+var errContentModified = jsonrpc2.NewError(-32801, "JSON RPC content modified")
+
+// onLatestDocument runs fn against the document currently in the cache. If a newer version of the document
+// is received while fn runs, the result would apply to shifted positions, so it is recomputed against the new version.
+// If the document keeps changing, errContentModified is returned and the client is expected to retry.
+func onLatestDocument[T any](s *Server, method string, uri protocol.DocumentURI, fn func(doc *document) (T, error)) (T, error) {
+	var zero T
+	for attempt := 0; attempt <= maxStaleRetries; attempt++ {
+		doc, err := s.cache.get(uri)
+		if err != nil {
+			return zero, utils.LogErrorf("%s: %s: %w", method, errorRetrievingDocument, err)
+		}
+
+		result, err := fn(doc)
+		if current, ok := s.documentVersion(uri); ok && current != doc.item.Version {
+			continue
+		}
+		return result, err
+	}
+	return zero, fmt.Errorf("%s: %w: %s changed while the request was processed", method, errContentModified, uri)
+}
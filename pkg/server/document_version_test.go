@@ -0,0 +1,94 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func changeTestFile(t *testing.T, server *Server, uri protocol.DocumentURI, version int32, text string) {
+	t.Helper()
+
+	err := server.DidChange(context.Background(), &protocol.DidChangeTextDocumentParams{
+		TextDocument: protocol.VersionedTextDocumentIdentifier{
+			TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: uri},
+			Version:                version,
+		},
+		ContentChanges: []protocol.TextDocumentContentChangeEvent{{Text: text}},
+	})
+	require.NoError(t, err)
+}
+
+func TestDidChangeKeepsSnapshots(t *testing.T) {
+	server, fileURI := testServerWithFile(t, nil, "{ a: 1 }")
+
+	before, err := server.cache.get(fileURI)
+	require.NoError(t, err)
+
+	changeTestFile(t, server, fileURI, 2, "{ b: 2 }")
+
+	after, err := server.cache.get(fileURI)
+	require.NoError(t, err)
+
+	assert.Equal(t, int32(1), before.item.Version)
+	assert.Equal(t, "{ a: 1 }", before.item.Text)
+	assert.Equal(t, int32(2), after.item.Version)
+	assert.Equal(t, "{ b: 2 }", after.item.Text)
+}
+
+func TestOnLatestDocument(t *testing.T) {
+	t.Run("document is unchanged", func(t *testing.T) {
+		server, fileURI := testServerWithFile(t, nil, "{ a: 1 }")
+
+		calls := 0
+		result, err := onLatestDocument(server, "Test", fileURI, func(doc *document) (string, error) {
+			calls++
+			return doc.item.Text, nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "{ a: 1 }", result)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("document changes once, the request is recomputed", func(t *testing.T) {
+		server, fileURI := testServerWithFile(t, nil, "{ a: 1 }")
+
+		calls := 0
+		result, err := onLatestDocument(server, "Test", fileURI, func(doc *document) (string, error) {
+			calls++
+			if calls == 1 {
+				changeTestFile(t, server, fileURI, 2, "{ b: 2 }")
+			}
+			return doc.item.Text, nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "{ b: 2 }", result)
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("document keeps changing, the request is rejected", func(t *testing.T) {
+		server, fileURI := testServerWithFile(t, nil, "{ a: 1 }")
+
+		version := int32(1)
+		_, err := onLatestDocument(server, "Test", fileURI, func(doc *document) (string, error) {
+			version++
+			changeTestFile(t, server, fileURI, version, "{}")
+			return doc.item.Text, nil
+		})
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, errContentModified))
+	})
+
+	t.Run("document is not in the cache", func(t *testing.T) {
+		server := testServer(t, nil)
+
+		_, err := onLatestDocument(server, "Test", "file:///missing.jsonnet", func(doc *document) (string, error) {
+			return doc.item.Text, nil
+		})
+		assert.EqualError(t, err, "Test: unable to retrieve document from the cache: document file:///missing.jsonnet not found in cache")
+	})
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-jsonnet/ast"
+	"github.com/grafana/jsonnet-language-server/pkg/ast/processing"
+	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+)
+
+const duplicateImportDiagnosticCode = "duplicate-import"
+
+// importAlias is a local that aliases the import of a file, `local k = import 'k.libsonnet'`.
+type importAlias struct {
+	local     *ast.Local
+	name      ast.Identifier
+	selection ast.LocationRange
+	foundAt   string
+}
+
+// duplicateImport is an alias of a file that an earlier alias, with another name and in scope, already imports.
+type duplicateImport struct {
+	alias, kept *importAlias
+}
+
+// duplicateImports returns the aliases of the document that import a file that an earlier alias already imports.
+func (s *Server) duplicateImports(doc *document) []duplicateImport {
+	if doc.ast == nil || len(doc.linesChangedSinceAST) > 0 {
+		return nil
+	}
+
+	filename := doc.item.URI.SpanURI().Filename()
+	config := s.configurationFor(filename)
+	importer := s.getImporter(config, filename, s.projectSettings(config, filename))
+	var duplicates []duplicateImport
+	first := map[string]*importAlias{}
+	walk(doc.ast, func(node ast.Node) {
+		local, ok := node.(*ast.Local)
+		if !ok {
+			return
+		}
+		for _, bind := range local.Binds {
+			imported, ok := stripParens(bind.Body).(*ast.Import)
+			if !ok {
+				continue
+			}
+			_, foundAt, err := importer.Import(filename, imported.File.Value)
+			if err != nil {
+				continue
+			}
+			abs, err := filepath.Abs(foundAt)
+			if err != nil {
+				continue
+			}
+			objectRange := processing.LocalBindToRange(bind)
+			alias := &importAlias{
+				local:     local,
+				name:      bind.Variable,
+				selection: withFileName(objectRange.SelectionRange, objectRange.Filename),
+				foundAt:   abs,
+			}
+			// The locals are walked in the order of the text
+			kept, ok := first[abs]
+			if !ok {
+				first[abs] = alias
+			} else if kept.name != alias.name && inRange(alias.selection.Begin, *kept.local.Body.Loc()) {
+				duplicates = append(duplicates, duplicateImport{alias: alias, kept: kept})
+			}
+		}
+	})
+	return duplicates
+}
+
+// findDuplicateImports reports the aliases of a file that an earlier alias of the document already imports.
+func (s *Server) findDuplicateImports(doc *document) []protocol.Diagnostic {
+	var diags []protocol.Diagnostic
+	for _, duplicate := range s.duplicateImports(doc) {
+		diags = append(diags, protocol.Diagnostic{
+			Range:    position.RangeASTToProtocol(duplicate.alias.selection),
+			Severity: protocol.SeverityInformation,
+			Code:     duplicateImportDiagnosticCode,
+			Source:   "lint",
+			Message:  fmt.Sprintf("%s is already imported as %s on line %d", filepath.Base(duplicate.alias.foundAt), duplicate.kept.name, duplicate.kept.selection.Begin.Line),
+		})
+	}
+	return diags
+}
+
+// duplicateImportCodeActions consolidates a duplicate import into the earlier alias: its local is removed and its
+// references refer to the earlier alias. They are only offered when the earlier alias is in scope at all of the
+// references, and when the local has its own lines.
+func (s *Server) duplicateImportCodeActions(doc *document, diags []protocol.Diagnostic) []protocol.CodeAction {
+	var actions []protocol.CodeAction
+	var duplicates []duplicateImport
+	for _, diag := range diags {
+		if diag.Code != duplicateImportDiagnosticCode {
+			continue
+		}
+		if duplicates == nil {
+			duplicates = s.duplicateImports(doc)
+		}
+		for _, duplicate := range duplicates {
+			if position.RangeASTToProtocol(duplicate.alias.selection) != diag.Range {
+				continue
+			}
+			edits, ok := consolidateImport(doc, duplicate.alias, duplicate.kept)
+			if !ok {
+				continue
+			}
+			actions = append(actions, protocol.CodeAction{
+				Title:       fmt.Sprintf("Use %s instead of %s", duplicate.kept.name, duplicate.alias.name),
+				Kind:        protocol.QuickFix,
+				Diagnostics: []protocol.Diagnostic{diag},
+				Edit:        protocol.WorkspaceEdit{Changes: map[string][]protocol.TextEdit{string(doc.item.URI): edits}},
+			})
+		}
+	}
+	return actions
+}
+
+// consolidateImport returns the edits that remove the local of a duplicate alias and rename its references to the
+// kept alias, if the references then refer to the kept alias.
+func consolidateImport(doc *document, alias, kept *importAlias) ([]protocol.TextEdit, bool) {
+	var duplicate, keptVariable *variable
+	for _, v := range findVariables(doc.ast) {
+		switch v.selection {
+		case alias.selection:
+			duplicate = v
+		case kept.selection:
+			keptVariable = v
+		}
+	}
+	if duplicate == nil || keptVariable == nil || len(alias.local.Binds) != 1 {
+		return nil, false
+	}
+
+	// The local starts its line and its semicolon ends the line of its value, like for the removal of unused locals
+	lines := strings.Split(doc.astText, "\n")
+	begin, end := alias.local.Loc().Begin, alias.local.Binds[0].Body.Loc().End
+	if begin.Line < 1 || end.Line > len(lines) || alias.local.Body.Loc().Begin.Line <= end.Line {
+		return nil, false
+	}
+	if strings.TrimSpace(lines[begin.Line-1][:begin.Column-1]) != "" {
+		return nil, false
+	}
+	if end.Column-1 > len(lines[end.Line-1]) || strings.TrimSpace(lines[end.Line-1][end.Column-1:]) != ";" {
+		return nil, false
+	}
+
+	// The references of the duplicate must refer to the kept alias once they are renamed
+	renamed := strings.Split(applyRename(doc.astText, duplicate.references, string(kept.name)), "\n")
+	renamed = append(renamed[:begin.Line-1], renamed[end.Line:]...)
+	root, err := parseDocument(doc.item.URI.SpanURI().Filename(), strings.Join(renamed, "\n"))
+	if err != nil {
+		return nil, false
+	}
+	after := variableAt(root, kept.selection.Begin)
+	if after == nil || len(after.references) != len(keptVariable.references)+len(duplicate.references) {
+		return nil, false
+	}
+
+	// The body of the local follows its lines
+	removed := protocol.Range{Start: protocol.Position{Line: uint32(begin.Line - 1)}, End: protocol.Position{Line: uint32(end.Line)}}
+	edits := []protocol.TextEdit{{Range: removed, NewText: ""}}
+	for _, ref := range duplicate.references {
+		edits = append(edits, protocol.TextEdit{Range: position.RangeASTToProtocol(ref), NewText: string(kept.name)})
+	}
+	return edits, true
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDuplicateImports(t *testing.T) {
+	testCases := []struct {
+		name     string
+		document string
+		expected []string
+		// fixed is the document once the first duplicate is consolidated, it isn't if it is empty
+		fixed string
+	}{
+		{
+			name:     "different paths to the same file",
+			document: "local k = import 'k.libsonnet';\nlocal other = import 'other.libsonnet';\nlocal kube = import './k.libsonnet';\n{ a: kube.name, b: k, c: [kube, other] }",
+			expected: []string{"2:6-2:10 duplicate-import: k.libsonnet is already imported as k on line 1"},
+			fixed:    "local k = import 'k.libsonnet';\nlocal other = import 'other.libsonnet';\n{ a: k.name, b: k, c: [k, other] }",
+		},
+		{
+			name:     "library path",
+			document: "local lib = import 'lib/lib.libsonnet';\nlocal vendored = import 'vendor/lib/lib.libsonnet';\n[lib, vendored]",
+			expected: []string{"1:6-1:14 duplicate-import: lib.libsonnet is already imported as lib on line 1"},
+			fixed:    "local lib = import 'lib/lib.libsonnet';\n[lib, lib]",
+		},
+		{
+			name:     "same name",
+			document: "local k = import 'k.libsonnet';\nlocal k = import 'k.libsonnet';\nk",
+		},
+		{
+			name:     "out of scope",
+			document: "local f() =\n  local k = import 'k.libsonnet';\n  k;\nlocal kube = import 'k.libsonnet';\n[f(), kube]",
+		},
+		{
+			name:     "shadowed alias",
+			document: "local k = import 'k.libsonnet';\nlocal f(k) =\n  local kube = import 'k.libsonnet';\n  [k, kube];\nf(1)",
+			expected: []string{"2:8-2:12 duplicate-import: k.libsonnet is already imported as k on line 1"},
+		},
+		{
+			name:     "local on the line of another",
+			document: "local k = import 'k.libsonnet'; local kube = import 'k.libsonnet';\n[k, kube]",
+			expected: []string{"0:38-0:42 duplicate-import: k.libsonnet is already imported as k on line 1"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			root := writeProjectFiles(t, map[string]string{
+				"main.jsonnet":                 tc.document,
+				"k.libsonnet":                  "{ name: 'k' }",
+				"other.libsonnet":              "{}",
+				"vendor/lib/lib.libsonnet":     "{}",
+				"vendor/other/other.libsonnet": "{}",
+				"jsonnetfile.json":             "{}",
+			})
+			s := renameTestServer(t, root, nil)
+			require.NoError(t, s.DidChangeConfiguration(context.Background(), &protocol.DidChangeConfigurationParams{
+				Settings: map[string]interface{}{"jpath": []interface{}{filepath.Join(root, "vendor")}},
+			}))
+			uri := serverOpenTestFile(t, s, filepath.Join(root, "main.jsonnet"))
+			doc, err := s.cache.get(uri)
+			require.NoError(t, err)
+
+			diags := s.findDuplicateImports(doc)
+			var found []string
+			for _, diag := range diags {
+				found = append(found, fmt.Sprintf("%s %s: %s", formatRange(diag.Range), diag.Code, diag.Message))
+			}
+			assert.Equal(t, tc.expected, found)
+
+			actions := s.duplicateImportCodeActions(doc, diags)
+			if tc.fixed == "" {
+				assert.Empty(t, actions)
+				return
+			}
+			require.NotEmpty(t, actions)
+			assert.Equal(t, []protocol.Diagnostic{diags[0]}, actions[0].Diagnostics)
+			assert.Equal(t, tc.fixed, applyTextEdits(t, tc.document, actions[0].Edit.Changes[string(uri)]))
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-jsonnet/ast"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// languageMarkerRegexp matches the comments that give the language of the text block after them, like
+	// `// language=yaml`, and the `/* jsonnet */` comments
+	languageMarkerRegexp = regexp.MustCompile(`(?:/\*|//|#)\s*(?:language\s*=\s*([\w-]+)|(jsonnet)\s*\*/)`)
+	// yamlErrorRegexp matches the errors of the YAML parser that have a line
+	yamlErrorRegexp = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+)
+
+// embeddedBlock is a text block whose content is in another language.
+type embeddedBlock struct {
+	node     *ast.LiteralString
+	language string
+}
+
+// findEmbeddedProblems reports the syntax errors of the text blocks whose content is in a language: YAML or JSON,
+// after a `// language=yaml` or `// language=json` comment, and Jsonnet with the EnableEmbeddedJsonnetDiagnostics
+// setting. Their content is parsed on its own, and the errors are moved to where the content is in the document.
+func (s *Server) findEmbeddedProblems(doc *document) []protocol.Diagnostic {
+	if doc.ast == nil || len(doc.linesChangedSinceAST) > 0 {
+		return nil
+	}
+	filename := doc.item.URI.SpanURI().Filename()
+	config := s.configurationFor(filename)
+
+	var diags []protocol.Diagnostic
+	for _, block := range embeddedBlocks(doc.ast, doc.item.Text) {
+		var diag *protocol.Diagnostic
+		switch block.language {
+		case "jsonnet":
+			if !config.EnableEmbeddedJsonnetDiagnostics {
+				continue
+			}
+			if _, err := parseDocument(filename, block.node.Value); err != nil {
+				message, rng := parseErrRegexpMatch(errRegexp.FindStringSubmatch(err.Error()))
+				if message == "" {
+					message = err.Error()
+				}
+				diag = &protocol.Diagnostic{Range: rng, Message: message}
+			}
+		case "yaml", "yml":
+			diag = yamlSyntaxError(block.node.Value)
+		case "json":
+			diag = jsonSyntaxError(block.node.Value)
+		}
+		if diag != nil {
+			diags = append(diags, embeddedDiagnostic(doc.item.Text, block, *diag))
+		}
+	}
+	return diags
+}
+
+// embeddedBlocks returns the text blocks of the document whose language is known: from the marker comment on their
+// line or on the line before, or the Jsonnet of the values of the fields named after a Jsonnet file, like
+// `'main.jsonnet': |||`.
+func embeddedBlocks(root ast.Node, text string) []embeddedBlock {
+	scanned := scanLines(text)
+	var blocks []embeddedBlock
+	seen := map[*ast.LiteralString]bool{}
+	add := func(node ast.Node, language string) {
+		block, ok := node.(*ast.LiteralString)
+		if !ok || seen[block] || !isTextBlock(text, block) {
+			return
+		}
+		if marked := markedLanguage(scanned, block.LocRange.Begin); marked != "" {
+			language = marked
+		}
+		if language == "" {
+			return
+		}
+		seen[block] = true
+		blocks = append(blocks, embeddedBlock{node: block, language: language})
+	}
+	walk(root, func(node ast.Node) {
+		switch node := node.(type) {
+		case *ast.DesugaredObject:
+			for _, field := range node.Fields {
+				name, ok := field.Name.(*ast.LiteralString)
+				if !ok {
+					continue
+				}
+				if ext := filepath.Ext(name.Value); ext == ".jsonnet" || ext == ".libsonnet" {
+					add(field.Body, "jsonnet")
+				}
+			}
+		case *ast.LiteralString:
+			add(node, "")
+		}
+	})
+	return blocks
+}
+
+// isTextBlock tells whether a string is written as a `|||` text block.
+func isTextBlock(text string, node *ast.LiteralString) bool {
+	if !node.LocRange.Begin.IsSet() {
+		return false
+	}
+	return strings.HasPrefix(text[locationOffset(text, node.LocRange.Begin):], "|||")
+}
+
+// markedLanguage returns the language of the marker comment before the text block at a location: on its line, or
+// ending the line before.
+func markedLanguage(scanned []scannedLine, begin ast.Location) string {
+	if begin.Line > len(scanned) {
+		return ""
+	}
+	line := scanned[begin.Line-1].text
+	candidates := []string{line[:min(begin.Column-1, len(line))]}
+	if begin.Line > 1 {
+		previous := scanned[begin.Line-2]
+		if trimmed := strings.TrimSpace(previous.text); strings.HasPrefix(trimmed, "/*") || strings.HasPrefix(trimmed, "//") || strings.HasPrefix(trimmed, "#") {
+			candidates = append(candidates, trimmed)
+		} else if previous.comment >= 0 {
+			candidates = append(candidates, previous.text[previous.comment:])
+		}
+	}
+	for _, candidate := range candidates {
+		if match := languageMarkerRegexp.FindStringSubmatch(candidate); match != nil {
+			return strings.ToLower(match[1] + match[2])
+		}
+	}
+	return ""
+}
+
+// yamlSyntaxError returns the first syntax error of the YAML documents of the content, on the line of the content
+// that it is on.
+func yamlSyntaxError(content string) *protocol.Diagnostic {
+	decoder := yaml.NewDecoder(strings.NewReader(content))
+	for {
+		var value interface{}
+		err := decoder.Decode(&value)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err == nil {
+			continue
+		}
+		lines := strings.Split(content, "\n")
+		line := 1
+		message := strings.TrimPrefix(err.Error(), "yaml: ")
+		if match := yamlErrorRegexp.FindStringSubmatch(err.Error()); match != nil {
+			line, _ = strconv.Atoi(match[1])
+			message = match[2]
+		}
+		line = min(max(line, 1), len(lines))
+		return &protocol.Diagnostic{
+			Range:   protocol.Range{Start: protocol.Position{Line: uint32(line - 1)}, End: protocol.Position{Line: uint32(line - 1), Character: uint32(len(lines[line-1]))}},
+			Message: message,
+		}
+	}
+}
+
+// jsonSyntaxError returns the syntax error of the JSON content, on the character where it is detected.
+func jsonSyntaxError(content string) *protocol.Diagnostic {
+	var value interface{}
+	err := json.Unmarshal([]byte(content), &value)
+	if err == nil {
+		return nil
+	}
+	// The offset of a syntax error is after the character that is wrong
+	end := len(content)
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		end = min(int(syntaxErr.Offset), len(content))
+	}
+	position := func(offset int) protocol.Position {
+		loc := offsetLocation(content, offset)
+		return protocol.Position{Line: uint32(loc.Line - 1), Character: uint32(loc.Column - 1)}
+	}
+	return &protocol.Diagnostic{
+		Range:   protocol.Range{Start: position(max(end-1, 0)), End: position(end)},
+		Message: strings.TrimPrefix(err.Error(), "json: "),
+	}
+}
+
+// embeddedDiagnostic moves the diagnostic of the content of a text block to where the content is in the document:
+// from the line after the `|||`, after the indentation of the block.
+func embeddedDiagnostic(text string, block embeddedBlock, diag protocol.Diagnostic) protocol.Diagnostic {
+	lines := strings.Split(text, "\n")
+	indent := 0
+	for _, line := range lines[min(block.node.LocRange.Begin.Line, len(lines)):] {
+		if strings.TrimSpace(line) != "" {
+			indent = len(line) - len(strings.TrimLeft(line, " \t"))
+			break
+		}
+	}
+	// The diagnostic's lines are counted in the content, which starts on the line after the `|||`
+	for _, pos := range []*protocol.Position{&diag.Range.Start, &diag.Range.End} {
+		pos.Line += uint32(block.node.LocRange.Begin.Line)
+		pos.Character += uint32(indent)
+	}
+	diag.Severity = protocol.SeverityWarning
+	diag.Source = "embedded " + block.language
+	return diag
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindEmbeddedProblems(t *testing.T) {
+	testCases := []struct {
+		name     string
+		document string
+		// jsonnet enables the diagnostics of the embedded Jsonnet
+		jsonnet  bool
+		expected []protocol.Diagnostic
+	}{
+		{
+			name: "field named after a Jsonnet file",
+			document: `{
+  'main.jsonnet': |||
+    local a = 1;
+    { a: a
+  |||,
+}
+`,
+			jsonnet: true,
+			expected: []protocol.Diagnostic{{
+				Range:    makeRange(t, "4:4-4:4"),
+				Severity: protocol.SeverityWarning,
+				Source:   "embedded jsonnet",
+				Message:  "Expected a comma before next field",
+			}},
+		},
+		{
+			name: "jsonnet marker comment",
+			document: `local template = /* jsonnet */ |||
+  { a: 1 b: 2 }
+|||;
+template
+`,
+			jsonnet: true,
+			expected: []protocol.Diagnostic{{
+				Range:    makeRange(t, "1:9-1:10"),
+				Severity: protocol.SeverityWarning,
+				Source:   "embedded jsonnet",
+				Message:  "Expected a comma before next field",
+			}},
+		},
+		{
+			name: "jsonnet without the setting",
+			document: `{
+  'main.jsonnet': |||
+    { a: a
+  |||,
+}
+`,
+		},
+		{
+			name: "valid Jsonnet",
+			document: `{
+  'lib.libsonnet': |||
+    { a: 1 }
+  |||,
+}
+`,
+			jsonnet: true,
+		},
+		{
+			name: "text blocks that aren't marked",
+			document: `{
+  'README.md': |||
+    # { a:
+  |||,
+  b: |||
+    { a:
+  |||,
+}
+`,
+			jsonnet: true,
+		},
+		{
+			name: "yaml on the line before",
+			document: `{
+  // language=yaml
+  'config.yaml': |||
+    replicas: 1
+    image: nginx: 1.27
+  |||,
+}
+`,
+			expected: []protocol.Diagnostic{{
+				Range:    makeRange(t, "4:4-4:22"),
+				Severity: protocol.SeverityWarning,
+				Source:   "embedded yaml",
+				Message:  "mapping values are not allowed in this context",
+			}},
+		},
+		{
+			name: "yaml documents",
+			document: `{
+  config: /* language=yaml */ |||
+    a: 1
+    ---
+    b: c: d
+  |||,
+}
+`,
+			expected: []protocol.Diagnostic{{
+				Range:    makeRange(t, "4:4-4:11"),
+				Severity: protocol.SeverityWarning,
+				Source:   "embedded yaml",
+				Message:  "mapping values are not allowed in this context",
+			}},
+		},
+		{
+			name: "valid yaml",
+			document: `{
+  # language=yaml
+  config: |||
+    a: 1
+    b: [c, d]
+  |||,
+}
+`,
+		},
+		{
+			name: "json",
+			document: `{
+  dashboard: // language=json
+    |||
+      {
+        "title": "a",
+        "panels": [1, 2,]
+      }
+    |||,
+}
+`,
+			expected: []protocol.Diagnostic{{
+				Range:    makeRange(t, "5:24-5:25"),
+				Severity: protocol.SeverityWarning,
+				Source:   "embedded json",
+				Message:  "invalid character ']' looking for beginning of value",
+			}},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s, uri := testServerWithFile(t, nil, tc.document)
+			setConfiguration(s, func(c *Configuration) {
+				c.EnableEmbeddedJsonnetDiagnostics = tc.jsonnet
+			})
+			doc, err := s.cache.get(uri)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, s.findEmbeddedProblems(doc))
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package server
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"math"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/go-jsonnet"
+	"github.com/google/go-jsonnet/ast"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+)
+
+// evalCache keeps the last evaluation of each document. The edits that don't change what a document evaluates to,
+// such as the edits of comments, blank lines and formatting, reuse it instead of evaluating the document again.
+type evalCache struct {
+	mu        sync.Mutex
+	snapshots map[protocol.DocumentURI]evalSnapshot
+}
+
+type evalSnapshot struct {
+	fingerprint uint64
+	// inputs are the settings of the VM, its jpaths and variables
+	inputs string
+	// imports are the modification times of the imported files, the evaluation is outdated once one of them changes
+	imports map[string]time.Time
+	// text is the text that was evaluated, the diagnostics are moved from its lines to the lines of the next versions
+	text  string
+	val   string
+	err   error
+	diags []protocol.Diagnostic
+}
+
+func newEvalCache() *evalCache {
+	return &evalCache{snapshots: map[protocol.DocumentURI]evalSnapshot{}}
+}
+
+func (c *evalCache) get(uri protocol.DocumentURI) (evalSnapshot, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	snapshot, ok := c.snapshots[uri]
+	return snapshot, ok
+}
+
+func (c *evalCache) put(uri protocol.DocumentURI, snapshot evalSnapshot) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.snapshots[uri] = snapshot
+}
+
+// reset forgets the evaluations of all the documents.
+func (c *evalCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.snapshots = map[protocol.DocumentURI]evalSnapshot{}
+}
+
+// reuseEvaluation sets the output of the last evaluation of the document on it, and returns its diagnostics moved to
+// the current lines, if the document still evaluates to the same thing. When a diagnostic is on a line that changed,
+// the document is evaluated again.
+func (s *Server) reuseEvaluation(doc *document, fingerprint uint64, inputs string) ([]protocol.Diagnostic, bool) {
+	snapshot, ok := s.evalCache.get(doc.item.URI)
+	if !ok || snapshot.fingerprint != fingerprint || snapshot.inputs != inputs || importsChanged(snapshot.imports) {
+		return nil, false
+	}
+
+	lines := newLineMap(snapshot.text, doc.item.Text)
+	diags := make([]protocol.Diagnostic, 0, len(snapshot.diags))
+	for _, diag := range snapshot.diags {
+		rng, ok := lines.rangeToText(diag.Range)
+		if !ok {
+			return nil, false
+		}
+		diag.Range = rng
+		diags = append(diags, diag)
+	}
+	doc.val, doc.err = snapshot.val, snapshot.err
+	return diags, true
+}
+
+// vmInputs describes the settings of a VM made by makeVM, once the variables of the configuration, the projects, the
+// files and the commands are merged.
+func vmInputs(config Configuration, settings *projectSettings) string {
+	natives := make([]string, 0, len(settings.nativeFunctions))
+	for _, nf := range settings.nativeFunctions {
+		natives = append(natives, nf.Name)
+	}
+	imports := make([]string, 0, len(settings.imports))
+	for name := range settings.imports {
+		imports = append(imports, name)
+	}
+	sort.Strings(imports)
+	return fmt.Sprintf("%+v %q %v %v %v %v %q %q", config, settings.jpaths, settings.extVars, settings.extCode,
+		settings.tlaVars, settings.tlaCode, natives, imports)
+}
+
+// recordingImporter records the files an evaluation imports, with their modification times. If an import fails, the
+// evaluation can't be reused: the file may be created later.
+type recordingImporter struct {
+	importer jsonnet.Importer
+
+	mu      sync.Mutex
+	imports map[string]time.Time
+	failed  bool
+}
+
+func (i *recordingImporter) Import(importedFrom, importedPath string) (jsonnet.Contents, string, error) {
+	contents, foundAt, err := i.importer.Import(importedFrom, importedPath)
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if err != nil {
+		i.failed = true
+		return contents, foundAt, err
+	}
+	if i.imports == nil {
+		i.imports = map[string]time.Time{}
+	}
+	i.imports[foundAt] = modTime(foundAt)
+	return contents, foundAt, err
+}
+
+func importsChanged(imports map[string]time.Time) bool {
+	for path, mtime := range imports {
+		if !modTime(path).Equal(mtime) {
+			return true
+		}
+	}
+	return false
+}
+
+// modTime returns the modification time of a file, or the zero time for the imports that aren't files.
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// astFingerprint hashes an AST without its locations and comments. The documents whose ASTs have the same
+// fingerprint evaluate to the same output.
+func astFingerprint(node ast.Node) uint64 {
+	h := fnv.New64a()
+	hashValue(h, reflect.ValueOf(node))
+	return h.Sum64()
+}
+
+var (
+	locationRangeType = reflect.TypeOf(ast.LocationRange{})
+	fodderType        = reflect.TypeOf(ast.Fodder{})
+	contextType       = reflect.TypeOf(ast.Context(nil))
+)
+
+func hashValue(h hash.Hash64, v reflect.Value) {
+	var buf [8]byte
+	writeInt := func(i int64) {
+		binary.LittleEndian.PutUint64(buf[:], uint64(i))
+		h.Write(buf[:])
+	}
+
+	switch v.Kind() {
+	case reflect.Interface, reflect.Pointer:
+		if v.IsNil() {
+			h.Write([]byte{0})
+			return
+		}
+		h.Write([]byte(v.Elem().Type().String()))
+		hashValue(h, v.Elem())
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			switch v.Field(i).Type() {
+			case locationRangeType, fodderType, contextType:
+				continue
+			}
+			hashValue(h, v.Field(i))
+		}
+	case reflect.Slice, reflect.Array:
+		writeInt(int64(v.Len()))
+		for i := 0; i < v.Len(); i++ {
+			hashValue(h, v.Index(i))
+		}
+	case reflect.String:
+		writeInt(int64(v.Len()))
+		h.Write([]byte(v.String()))
+	case reflect.Bool:
+		if v.Bool() {
+			writeInt(1)
+		} else {
+			writeInt(0)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		writeInt(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		writeInt(int64(v.Uint()))
+	case reflect.Float32, reflect.Float64:
+		writeInt(int64(math.Float64bits(v.Float())))
+	default:
+		// The AST has no maps, channels or functions
+		panic(fmt.Sprintf("astFingerprint: unexpected %s", v.Kind()))
+	}
+}
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-jsonnet"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestASTFingerprint(t *testing.T) {
+	const base = `local a = 1;
+{
+  b: a + 2,
+  c:: [a, 'x'],
+}`
+	for _, tc := range []struct {
+		name  string
+		text  string
+		equal bool
+	}{
+		{
+			name:  "comments and blank lines",
+			text:  "// a comment\nlocal a = 1;\n\n{\n  b: a + 2, // two\n  c:: [a, 'x'],\n}",
+			equal: true,
+		},
+		{
+			name:  "formatting",
+			text:  `local a=1; { b: a+2, c:: [ a, "x" ] }`,
+			equal: true,
+		},
+		{
+			name: "number",
+			text: strings.Replace(base, "2", "3", 1),
+		},
+		{
+			name: "field name",
+			text: strings.Replace(base, "b:", "d:", 1),
+		},
+		{
+			name: "visibility",
+			text: strings.Replace(base, "c::", "c:", 1),
+		},
+		{
+			name: "operator",
+			text: strings.Replace(base, "a + 2", "a - 2", 1),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			baseAST, err := jsonnet.SnippetToAST("test.jsonnet", base)
+			require.NoError(t, err)
+			editedAST, err := jsonnet.SnippetToAST("test.jsonnet", tc.text)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.equal, astFingerprint(baseAST) == astFingerprint(editedAST))
+		})
+	}
+}
+
+func TestGetEvalDiags_Reuse(t *testing.T) {
+	dir := t.TempDir()
+	lib := filepath.Join(dir, "lib.libsonnet")
+	require.NoError(t, os.WriteFile(lib, []byte(`{ x: 1 }`), 0o600))
+	mtime := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(lib, mtime, mtime))
+
+	path := filepath.Join(dir, "main.jsonnet")
+	text := "{\n  a: 1,\n  b: error 'x is %d' % (import 'lib.libsonnet').x,\n}"
+	s := testServer(t, nil)
+	setConfiguration(s, func(c *Configuration) {
+		c.EnableEvalDiagnostics = true
+	})
+	uri := protocol.URIFromPath(path)
+	require.NoError(t, s.DidOpen(context.Background(), &protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{URI: uri, Text: text, Version: 1},
+	}))
+	edit := func(version int32, text string) {
+		require.NoError(t, s.DidChange(context.Background(), &protocol.DidChangeTextDocumentParams{
+			TextDocument:   protocol.VersionedTextDocumentIdentifier{Version: version, TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: uri}},
+			ContentChanges: []protocol.TextDocumentContentChangeEvent{{Text: text}},
+		}))
+	}
+	evalDiags := func() []protocol.Diagnostic {
+		doc, err := s.cache.get(uri)
+		require.NoError(t, err)
+		return s.getEvalDiags(context.Background(), doc)
+	}
+
+	diags := evalDiags()
+	require.Len(t, diags, 1)
+	assert.Equal(t, uint32(2), diags[0].Range.Start.Line)
+	assert.Contains(t, diags[0].Message, "x is 1")
+
+	// The import is changed without its modification time, only a new evaluation would see it
+	require.NoError(t, os.WriteFile(lib, []byte(`{ x: 2 }`), 0o600))
+	require.NoError(t, os.Chtimes(lib, mtime, mtime))
+
+	// A comment doesn't change the output, the diagnostic of the last evaluation is moved down
+	edit(2, "// a comment\n"+text)
+	diags = evalDiags()
+	require.Len(t, diags, 1)
+	assert.Equal(t, uint32(3), diags[0].Range.Start.Line)
+	assert.Contains(t, diags[0].Message, "x is 1")
+
+	// Once the import's modification time changes, the document is evaluated again
+	mtime = mtime.Add(time.Minute)
+	require.NoError(t, os.Chtimes(lib, mtime, mtime))
+	edit(3, "// another comment\n"+text)
+	diags = evalDiags()
+	require.Len(t, diags, 1)
+	assert.Equal(t, uint32(3), diags[0].Range.Start.Line)
+	assert.Contains(t, diags[0].Message, "x is 2")
+
+	// So does an edit of the output
+	edit(4, strings.Replace(text, "error 'x is %d' %", "", 1))
+	assert.Empty(t, evalDiags())
+	doc, err := s.cache.get(uri)
+	require.NoError(t, err)
+	assert.Equal(t, "{\n   \"a\": 1,\n   \"b\": 2\n}\n", doc.val)
+}
+
+// largeDocument generates a document of about 5 lines per field.
+func largeDocument(fields int) string {
+	var b strings.Builder
+	b.WriteString("local base = { replicas: 1 };\n{\n")
+	for i := 0; i < fields; i++ {
+		fmt.Fprintf(&b, "  field%d: base {\n    name: 'field%d',\n    values: [%d, %d],\n    enabled:: %t,\n  },\n", i, i, i, i+1, i%2 == 0)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func BenchmarkEvalDiagnostics(b *testing.B) {
+	text := largeDocument(1000)
+	// The edits add and remove a comment in the middle of the document
+	edited := strings.Replace(text, "  field500:", "  // a comment\n  field500:", 1)
+
+	for _, reuse := range []bool{false, true} {
+		b.Run(fmt.Sprintf("reuse=%t", reuse), func(b *testing.B) {
+			s := NewServer("any", "test version", nil, Configuration{EnableEvalDiagnostics: true})
+			uri := protocol.URIFromPath(filepath.Join(b.TempDir(), "large.jsonnet"))
+			docs := make([]*document, 2)
+			for i, t := range []string{text, edited} {
+				ast, err := parseDocument(uri.SpanURI().Filename(), t)
+				require.NoError(b, err)
+				docs[i] = &document{item: protocol.TextDocumentItem{URI: uri, Text: t}, ast: ast, astText: t}
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if !reuse {
+					s.evalCache = newEvalCache()
+				}
+				s.getEvalDiags(context.Background(), docs[i%2])
+			}
+		})
+	}
+}
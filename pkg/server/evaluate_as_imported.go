@@ -0,0 +1,220 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/go-jsonnet"
+	"github.com/google/go-jsonnet/ast"
+	"github.com/grafana/jsonnet-language-server/pkg/utils"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// evalAsImportedResult is the result of jsonnet.evalAsImportedBy.
+type evalAsImportedResult struct {
+	Dependent protocol.DocumentURI `json:"dependent"`
+	Output    string               `json:"output,omitempty"`
+	Error     string               `json:"error,omitempty"`
+	// Diagnostics are the errors of the evaluation, at their location in the library
+	Diagnostics []protocol.Diagnostic `json:"diagnostics,omitempty"`
+}
+
+// evalAsImportedBy evaluates an entrypoint that imports a library, directly or not, so that the library is seen with
+// the values it gets there. The arguments are the library's file name and, optionally, the entrypoint's. Without it,
+// the user picks one of the entrypoints that import the library.
+func (s *Server) evalAsImportedBy(ctx context.Context, params *protocol.ExecuteCommandParams) (interface{}, error) {
+	args := params.Arguments
+	if len(args) != 1 && len(args) != 2 {
+		return nil, fmt.Errorf("expected 1 or 2 arguments, got %d", len(args))
+	}
+
+	var fileName, dependent string
+	if err := json.Unmarshal(args[0], &fileName); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal file name: %v", err)
+	}
+	if len(args) == 2 {
+		if err := json.Unmarshal(args[1], &dependent); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal dependent: %v", err)
+		}
+	} else {
+		if s.workspaceFolder == "" {
+			return nil, fmt.Errorf("the dependents of a file can't be found without a workspace folder")
+		}
+		dependents, err := s.dependents(ctx, fileName)
+		if err != nil {
+			return nil, err
+		}
+		if dependent, err = s.pickDependent(ctx, fileName, dependents); err != nil || dependent == "" {
+			return nil, err
+		}
+	}
+
+	output, err := s.evaluateFile(ctx, dependent, "")
+	result := evalAsImportedResult{Dependent: protocol.URIFromPath(dependent), Output: output}
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		result.Error = err.Error()
+		result.Diagnostics = errorDiagnosticsIn(err, fileName)
+	}
+	return result, nil
+}
+
+// pickDependent asks the user which of the dependents of a file to evaluate, unless there is only one. It returns an
+// empty path if the user dismisses the question.
+func (s *Server) pickDependent(ctx context.Context, fileName string, dependents []string) (string, error) {
+	switch {
+	case len(dependents) == 0:
+		return "", fmt.Errorf("no entrypoint imports %s", fileName)
+	case len(dependents) == 1:
+		return dependents[0], nil
+	case s.client == nil:
+		return "", fmt.Errorf("%d entrypoints import %s, the dependent must be given", len(dependents), fileName)
+	}
+
+	actions := make([]protocol.MessageActionItem, 0, len(dependents))
+	byTitle := map[string]string{}
+	for _, dependent := range dependents {
+		title := dependent
+		if rel, err := filepath.Rel(s.workspaceFolder, dependent); err == nil {
+			title = filepath.ToSlash(rel)
+		}
+		actions = append(actions, protocol.MessageActionItem{Title: title})
+		byTitle[title] = dependent
+	}
+	picked, err := s.client.ShowMessageRequest(ctx, &protocol.ShowMessageRequestParams{
+		Type:    protocol.Info,
+		Message: fmt.Sprintf("Evaluate %s as imported by:", filepath.Base(fileName)),
+		Actions: actions,
+	})
+	if err != nil || picked == nil {
+		return "", err
+	}
+	return byTitle[picked.Title], nil
+}
+
+// errorDiagnosticsIn returns the diagnostic of an evaluation error in a file, at the innermost frame of its stack
+// trace that is in the file. The VM formats the errors, their frames are lines that start with a location.
+func errorDiagnosticsIn(err error, fileName string) []protocol.Diagnostic {
+	lines := strings.Split(err.Error(), "\n")
+	message := strings.TrimPrefix(lines[0], "RUNTIME ERROR: ")
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, fileName+":") {
+			continue
+		}
+		match := errRegexp.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		frameMessage, rang := parseErrRegexpMatch(match)
+		if i == 0 {
+			// A static error is on a single line, its message follows the location
+			message = frameMessage
+		}
+		return []protocol.Diagnostic{{
+			Range:    rang,
+			Severity: protocol.SeverityError,
+			Source:   "jsonnet evaluation",
+			Message:  message,
+		}}
+	}
+	return nil
+}
+
+// dependents returns the entrypoints of the workspace that import a file, directly or not, in the order of their
+// paths. The imports of the workspace's files are followed backwards, without evaluating them.
+func (s *Server) dependents(ctx context.Context, path string) ([]string, error) {
+	entrypoints := s.config().Entrypoints
+	if entrypoints == nil {
+		entrypoints = defaultEntrypoints
+	}
+
+	importedBy := map[string][]string{}
+	isEntrypoint := map[string]bool{}
+	err := filepath.WalkDir(s.workspaceFolder, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if entry.IsDir() {
+			if file != s.workspaceFolder && (strings.HasPrefix(entry.Name(), ".") || entry.Name() == "vendor") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if ext := filepath.Ext(file); ext != ".jsonnet" && ext != ".libsonnet" {
+			return nil
+		}
+		if rel, err := filepath.Rel(s.workspaceFolder, file); err == nil {
+			for _, glob := range entrypoints {
+				if utils.MatchGlob(glob, filepath.ToSlash(rel)) {
+					isEntrypoint[file] = true
+					break
+				}
+			}
+		}
+		config := s.configurationFor(file)
+		importer := s.getImporter(config, file, s.projectSettings(config, file))
+		for _, imported := range s.importsOf(file, importer) {
+			importedBy[imported] = append(importedBy[imported], file)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the files of the workspace: %w", err)
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	var dependents []string
+	visited := map[string]bool{abs: true}
+	for queue := importedBy[abs]; len(queue) > 0; {
+		file := queue[0]
+		queue = queue[1:]
+		if visited[file] {
+			continue
+		}
+		visited[file] = true
+		if isEntrypoint[file] {
+			dependents = append(dependents, file)
+		}
+		queue = append(queue, importedBy[file]...)
+	}
+	sort.Strings(dependents)
+	return dependents, nil
+}
+
+// importsOf returns the absolute paths of the Jsonnet files that a file imports, resolved with an importer.
+func (s *Server) importsOf(path string, importer jsonnet.Importer) []string {
+	root, err := snippetToAST(path, s.readWorkspaceFile(path))
+	if err != nil {
+		log.Debugf("importsOf: unable to parse %s: %v", path, err)
+	}
+	var imports []string
+	walk(root, func(node ast.Node) {
+		imported, ok := node.(*ast.Import)
+		if !ok {
+			return
+		}
+		_, foundAt, err := importer.Import(path, imported.File.Value)
+		if err != nil {
+			return
+		}
+		if abs, err := filepath.Abs(foundAt); err == nil {
+			imports = append(imports, abs)
+		}
+	})
+	return imports
+}
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pickingClient answers the message requests with the action that has a title, and records the titles offered.
+type pickingClient struct {
+	protocol.ClientCloser
+
+	pick    string
+	offered []string
+}
+
+func (c *pickingClient) ShowMessageRequest(_ context.Context, params *protocol.ShowMessageRequestParams) (*protocol.MessageActionItem, error) {
+	for _, action := range params.Actions {
+		c.offered = append(c.offered, action.Title)
+	}
+	if c.pick == "" {
+		return nil, nil
+	}
+	return &protocol.MessageActionItem{Title: c.pick}, nil
+}
+
+func TestEvalAsImportedBy(t *testing.T) {
+	root := writeProjectFiles(t, map[string]string{
+		"environments/dev/main.jsonnet":  `import '../../lib/wrapper.libsonnet'`,
+		"environments/prod/main.jsonnet": `import '../../lib/app.libsonnet'`,
+		"lib/wrapper.libsonnet":          `import 'app.libsonnet'`,
+		"lib/app.libsonnet":              "local check(env) =\n  if env == 'prod'\n  then error 'prod is not allowed'\n  else env;\n{ env: check(std.extVar('env')) }",
+		"lib/standalone.libsonnet":       `{}`,
+	})
+
+	testCases := []struct {
+		name            string
+		file            string
+		dependent       string
+		pick            string
+		expectedOffered []string
+		expected        *evalAsImportedResult
+		expectedErr     string
+	}{
+		{
+			name:      "given dependent",
+			file:      "lib/app.libsonnet",
+			dependent: "environments/prod/main.jsonnet",
+			expected: &evalAsImportedResult{
+				Dependent: protocol.URIFromPath(filepath.Join(root, "environments/prod/main.jsonnet")),
+				Error:     "RUNTIME ERROR: prod is not allowed",
+				Diagnostics: []protocol.Diagnostic{{
+					Range:    protocol.Range{Start: protocol.Position{Line: 2, Character: 7}, End: protocol.Position{Line: 2, Character: 34}},
+					Severity: protocol.SeverityError,
+					Source:   "jsonnet evaluation",
+					Message:  "prod is not allowed",
+				}},
+			},
+		},
+		{
+			name:            "picked dependent",
+			file:            "lib/app.libsonnet",
+			pick:            "environments/dev/main.jsonnet",
+			expectedOffered: []string{"environments/dev/main.jsonnet", "environments/prod/main.jsonnet"},
+			expected: &evalAsImportedResult{
+				Dependent: protocol.URIFromPath(filepath.Join(root, "environments/dev/main.jsonnet")),
+				Output:    "{\n   \"env\": \"dev\"\n}\n",
+			},
+		},
+		{
+			name:            "dismissed",
+			file:            "lib/app.libsonnet",
+			expectedOffered: []string{"environments/dev/main.jsonnet", "environments/prod/main.jsonnet"},
+		},
+		{
+			name:     "only dependent",
+			file:     "lib/wrapper.libsonnet",
+			expected: &evalAsImportedResult{Dependent: protocol.URIFromPath(filepath.Join(root, "environments/dev/main.jsonnet")), Output: "{\n   \"env\": \"dev\"\n}\n"},
+		},
+		{
+			name:        "no dependent",
+			file:        "lib/standalone.libsonnet",
+			expectedErr: "no entrypoint imports " + filepath.Join(root, "lib/standalone.libsonnet"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &pickingClient{pick: tc.pick}
+			s := NewServer("any", "test version", client, Configuration{})
+			s.workspaceFolder = root
+			err := s.DidChangeConfiguration(context.Background(), &protocol.DidChangeConfigurationParams{
+				Settings: map[string]interface{}{
+					"ext_vars": map[string]interface{}{"env": "dev"},
+					"overrides": []interface{}{
+						map[string]interface{}{"glob": "environments/prod", "settings": map[string]interface{}{"ext_vars": map[string]interface{}{"env": "prod"}}},
+					},
+				},
+			})
+			require.NoError(t, err)
+
+			args := []json.RawMessage{}
+			for _, arg := range []string{tc.file, tc.dependent} {
+				if arg == "" {
+					continue
+				}
+				raw, err := json.Marshal(filepath.Join(root, filepath.FromSlash(arg)))
+				require.NoError(t, err)
+				args = append(args, raw)
+			}
+			result, err := s.ExecuteCommand(context.Background(), &protocol.ExecuteCommandParams{
+				Command:   "jsonnet.evalAsImportedBy",
+				Arguments: args,
+			})
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedOffered, client.offered)
+			if tc.expected == nil {
+				assert.Nil(t, result)
+				return
+			}
+			actual, ok := result.(evalAsImportedResult)
+			require.True(t, ok)
+			// The error goes on with the stack trace
+			assert.True(t, strings.HasPrefix(actual.Error, tc.expected.Error), actual.Error)
+			actual.Error = tc.expected.Error
+			assert.Equal(t, *tc.expected, actual)
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultEvaluationBudget is how long the evaluation of a file can take when evaluation_budget isn't set.
+	defaultEvaluationBudget = 10 * time.Second
+	// evaluationBudgetStrikes is the number of evaluations in a row over the budget after which a file isn't evaluated
+	// anymore.
+	evaluationBudgetStrikes = 3
+)
+
+// evaluationBudget returns how long the automatic evaluations of a file can take.
+func (c Configuration) evaluationBudget() time.Duration {
+	if c.EvaluationBudget > 0 {
+		return time.Duration(c.EvaluationBudget) * time.Millisecond
+	}
+	return defaultEvaluationBudget
+}
+
+// evaluationBudgets are the files whose evaluations take longer than the evaluation_budget setting. A file whose
+// evaluations are over the budget several times in a row is only parsed and linted, so that a pathological file
+// doesn't keep the server busy, until the jsonnet.enableEvaluation command enables it again.
+type evaluationBudgets struct {
+	mu sync.Mutex
+	// strikes are the number of evaluations in a row over the budget, by file
+	strikes  map[string]int
+	disabled map[string]bool
+}
+
+func newEvaluationBudgets() *evaluationBudgets {
+	return &evaluationBudgets{strikes: map[string]int{}, disabled: map[string]bool{}}
+}
+
+// isDisabled tells whether the evaluations of a file were disabled for being over the budget.
+func (b *evaluationBudgets) isDisabled(path string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.disabled[path]
+}
+
+// record counts an evaluation of a file, and returns true if it disabled the file.
+func (b *evaluationBudgets) record(path string, duration, budget time.Duration) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if duration <= budget {
+		delete(b.strikes, path)
+		return false
+	}
+	b.strikes[path]++
+	if b.strikes[path] < evaluationBudgetStrikes || b.disabled[path] {
+		return false
+	}
+	b.disabled[path] = true
+	return true
+}
+
+// enable enables the evaluations of files again, all of them if there is none, and returns the files that were
+// enabled.
+func (b *evaluationBudgets) enable(paths ...string) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(paths) == 0 {
+		for path := range b.disabled {
+			paths = append(paths, path)
+		}
+	}
+	var enabled []string
+	for _, path := range paths {
+		if b.disabled[path] {
+			enabled = append(enabled, path)
+		}
+		delete(b.disabled, path)
+		delete(b.strikes, path)
+	}
+	return enabled
+}
+
+// recordEvaluationDuration counts an automatic evaluation of a file against its budget, and tells the user once when
+// the file isn't evaluated anymore.
+func (s *Server) recordEvaluationDuration(ctx context.Context, path string, duration time.Duration) {
+	budget := s.configurationFor(path).evaluationBudget()
+	if !s.evaluationBudgets.record(path, duration, budget) {
+		return
+	}
+	message := fmt.Sprintf("The evaluation of %s took longer than %s %d times in a row, it is now only parsed and linted. Run the jsonnet.enableEvaluation command to evaluate it again.",
+		filepath.Base(path), budget, evaluationBudgetStrikes)
+	log.WithContext(ctx).Warn(message)
+	if s.client == nil {
+		return
+	}
+	if err := s.client.ShowMessage(ctx, &protocol.ShowMessageParams{Type: protocol.Warning, Message: message}); err != nil {
+		log.WithContext(ctx).Errorf("recordEvaluationDuration: unable to notify the client: %v", err)
+	}
+}
+
+// evaluationDisabledDiagnostic tells why a document has no evaluation diagnostics.
+func evaluationDisabledDiagnostic(budget time.Duration) protocol.Diagnostic {
+	return protocol.Diagnostic{
+		Source:   "jsonnet",
+		Severity: protocol.SeverityInformation,
+		Message:  fmt.Sprintf("This file is not evaluated: its evaluations took longer than the %s of the evaluation_budget setting. Run the jsonnet.enableEvaluation command to evaluate it again", budget),
+	}
+}
+
+// enableEvaluation evaluates again the files that were disabled for being over the evaluation budget. The optional
+// argument is the file's name, all of the files are enabled without it.
+func (s *Server) enableEvaluation(ctx context.Context, params *protocol.ExecuteCommandParams) (interface{}, error) {
+	args := params.Arguments
+	if len(args) > 1 {
+		return nil, fmt.Errorf("expected at most 1 argument, got %d", len(args))
+	}
+	var paths []string
+	if len(args) == 1 {
+		var fileName string
+		if err := json.Unmarshal(args[0], &fileName); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal file name: %v", err)
+		}
+		paths = append(paths, fileName)
+	}
+
+	for _, path := range s.evaluationBudgets.enable(paths...) {
+		log.WithContext(ctx).Infof("Evaluating %s again", path)
+		if doc, err := s.cache.get(protocol.URIFromPath(path)); err == nil {
+			s.queueDiagnostics(doc.item.URI)
+		}
+	}
+	return nil, nil
+}
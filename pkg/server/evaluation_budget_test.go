@@ -0,0 +1,119 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluationBudgets(t *testing.T) {
+	budgets := newEvaluationBudgets()
+	budget := time.Second
+
+	// The evaluations over the budget must be in a row
+	assert.False(t, budgets.record("a.jsonnet", 2*time.Second, budget))
+	assert.False(t, budgets.record("a.jsonnet", 2*time.Second, budget))
+	assert.False(t, budgets.record("a.jsonnet", time.Millisecond, budget))
+	assert.False(t, budgets.record("a.jsonnet", 2*time.Second, budget))
+	assert.False(t, budgets.record("a.jsonnet", 2*time.Second, budget))
+	assert.False(t, budgets.isDisabled("a.jsonnet"))
+	assert.True(t, budgets.record("a.jsonnet", 2*time.Second, budget))
+	assert.True(t, budgets.isDisabled("a.jsonnet"))
+	// The file is disabled once
+	assert.False(t, budgets.record("a.jsonnet", 2*time.Second, budget))
+	assert.False(t, budgets.isDisabled("b.jsonnet"))
+
+	for i := 0; i < evaluationBudgetStrikes; i++ {
+		budgets.record("b.jsonnet", 2*time.Second, budget)
+	}
+	assert.Equal(t, []string{"a.jsonnet"}, budgets.enable("a.jsonnet", "c.jsonnet"))
+	assert.False(t, budgets.isDisabled("a.jsonnet"))
+	assert.Equal(t, []string{"b.jsonnet"}, budgets.enable())
+	assert.False(t, budgets.isDisabled("b.jsonnet"))
+}
+
+func TestEvaluationBudget(t *testing.T) {
+	root := writeProjectFiles(t, map[string]string{"main.jsonnet": "{}"})
+	main := filepath.Join(root, "main.jsonnet")
+	s := renameTestServer(t, root, nil)
+	require.NoError(t, s.DidChangeConfiguration(context.Background(), &protocol.DidChangeConfigurationParams{
+		Settings: map[string]interface{}{"enable_eval_diagnostics": true, "evaluation_budget": 1},
+	}))
+	uri := serverOpenTestFile(t, s, main)
+	evalDiags := func(version int32, text string) []protocol.Diagnostic {
+		require.NoError(t, s.DidChange(context.Background(), &protocol.DidChangeTextDocumentParams{
+			TextDocument:   protocol.VersionedTextDocumentIdentifier{TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: uri}, Version: version},
+			ContentChanges: []protocol.TextDocumentContentChangeEvent{{Text: text}},
+		}))
+		doc, err := s.cache.get(uri)
+		require.NoError(t, err)
+		return s.getEvalDiags(context.Background(), doc)
+	}
+
+	// Concatenating the accumulator is quadratic, the evaluations take more than a millisecond
+	for i := 0; i < evaluationBudgetStrikes; i++ {
+		assert.Empty(t, evalDiags(int32(i+2), fmt.Sprintf("std.foldl(function(acc, x) acc + [x], std.range(1, %d), [])", 3000+i)))
+	}
+	assert.True(t, s.evaluationBudgets.isDisabled(main))
+	client := s.client.(*recordingClient)
+	require.Len(t, client.messages, 1)
+	assert.Equal(t, protocol.Warning, client.messages[0].Type)
+	assert.Equal(t, "The evaluation of main.jsonnet took longer than 1ms 3 times in a row, it is now only parsed and linted. Run the jsonnet.enableEvaluation command to evaluate it again.", client.messages[0].Message)
+
+	// The file isn't evaluated anymore, even if its evaluation would fail
+	assert.Equal(t, []protocol.Diagnostic{evaluationDisabledDiagnostic(time.Millisecond)}, evalDiags(10, "error 'not evaluated'"))
+	inlineValues, err := s.NonstandardRequest(context.Background(), "textDocument/inlineValue", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": string(uri)},
+		"range":        protocol.Range{End: protocol.Position{Line: 1}},
+	})
+	require.NoError(t, err)
+	assert.Empty(t, inlineValues)
+
+	fileArg, _ := json.Marshal(main)
+	_, err = s.ExecuteCommand(context.Background(), &protocol.ExecuteCommandParams{Command: "jsonnet.enableEvaluation", Arguments: []json.RawMessage{fileArg}})
+	require.NoError(t, err)
+	assert.False(t, s.evaluationBudgets.isDisabled(main))
+	diags := evalDiags(11, "error 'evaluated'")
+	require.Len(t, diags, 1)
+	assert.Contains(t, diags[0].Message, "evaluated")
+}
+
+func TestEvaluationBudget_Abandoned(t *testing.T) {
+	root := writeProjectFiles(t, map[string]string{"main.jsonnet": "{}"})
+	main := filepath.Join(root, "main.jsonnet")
+	s := renameTestServer(t, root, nil)
+	require.NoError(t, s.DidChangeConfiguration(context.Background(), &protocol.DidChangeConfigurationParams{
+		Settings: map[string]interface{}{"enable_eval_diagnostics": true, "evaluation_budget": 1},
+	}))
+	uri := serverOpenTestFile(t, s, main)
+	require.NoError(t, s.DidChange(context.Background(), &protocol.DidChangeTextDocumentParams{
+		TextDocument:   protocol.VersionedTextDocumentIdentifier{TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: uri}, Version: 2},
+		ContentChanges: []protocol.TextDocumentContentChangeEvent{{Text: "std.foldl(function(acc, x) acc + [x], std.range(1, 6000), [])"}},
+	}))
+	doc, err := s.cache.get(uri)
+	require.NoError(t, err)
+	strikes := func() int {
+		s.evaluationBudgets.mu.Lock()
+		defer s.evaluationBudgets.mu.Unlock()
+		return s.evaluationBudgets.strikes[main]
+	}
+
+	// An evaluation that is abandoned before the budget isn't counted
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Empty(t, s.getEvalDiags(ctx, doc))
+	assert.Equal(t, 0, strikes())
+
+	// One that is abandoned over the budget is a strike
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Empty(t, s.getEvalDiags(ctx, doc))
+	assert.Equal(t, 1, strikes())
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/grafana/jsonnet-language-server/pkg/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// evaluationContexts maps the files imported by the context entrypoints to the first entrypoint that imports them,
+// directly or not. It is built on first use, and again after the configuration changes or a file is saved.
+type evaluationContexts struct {
+	mu          sync.Mutex
+	built       bool
+	entrypoints map[string]string
+}
+
+func newEvaluationContexts() *evaluationContexts {
+	return &evaluationContexts{}
+}
+
+// reset drops the map, the imports of the entrypoints are followed again on the next lookup.
+func (c *evaluationContexts) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.built, c.entrypoints = false, nil
+}
+
+// evaluationContext returns the file whose evaluation context, its ext vars, TLAs and jpaths, a file is evaluated with:
+// the first context entrypoint that imports it, or the file itself.
+func (s *Server) evaluationContext(path string) string {
+	if len(s.config().ContextEntrypoints) == 0 {
+		return path
+	}
+	s.contexts.mu.Lock()
+	defer s.contexts.mu.Unlock()
+	if !s.contexts.built {
+		s.contexts.entrypoints = s.findEvaluationContexts()
+		s.contexts.built = true
+	}
+	if entrypoint, ok := s.contexts.entrypoints[path]; ok {
+		return entrypoint
+	}
+	return path
+}
+
+// evaluationSettings returns the configuration and the project settings that a file is evaluated with, those of its
+// evaluation context.
+func (s *Server) evaluationSettings(path string) (Configuration, *projectSettings) {
+	contextPath := s.evaluationContext(path)
+	config := s.configurationFor(contextPath)
+	return config, s.projectSettings(config, contextPath)
+}
+
+// findEvaluationContexts follows the imports from the context entrypoints of the workspace, in the order of their
+// paths, without evaluating them. The entrypoints are their own context.
+func (s *Server) findEvaluationContexts() map[string]string {
+	var entrypoints []string
+	globs := s.config().ContextEntrypoints
+	err := filepath.WalkDir(s.workspaceFolder, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if entry.IsDir() {
+			if path != s.workspaceFolder && (strings.HasPrefix(entry.Name(), ".") || entry.Name() == "vendor") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(s.workspaceFolder, path)
+		if err != nil {
+			return nil
+		}
+		for _, glob := range globs {
+			if utils.MatchGlob(glob, filepath.ToSlash(rel)) {
+				entrypoints = append(entrypoints, path)
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Errorf("findEvaluationContexts: failed to list the files of the workspace: %v", err)
+	}
+
+	contexts := map[string]string{}
+	for _, entrypoint := range entrypoints {
+		contexts[entrypoint] = entrypoint
+	}
+	for _, entrypoint := range entrypoints {
+		config := s.configurationFor(entrypoint)
+		importer := s.getImporter(config, entrypoint, s.projectSettings(config, entrypoint))
+		queue := []string{entrypoint}
+		visited := map[string]bool{}
+		for len(queue) > 0 {
+			path := queue[0]
+			queue = queue[1:]
+			if visited[path] {
+				continue
+			}
+			visited[path] = true
+			for _, imported := range s.importsOf(path, importer) {
+				if _, ok := contexts[imported]; !ok {
+					contexts[imported] = entrypoint
+				}
+				queue = append(queue, imported)
+			}
+		}
+	}
+	return contexts
+}
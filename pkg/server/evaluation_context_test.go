@@ -0,0 +1,103 @@
+package server
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluationContext(t *testing.T) {
+	root := writeProjectFiles(t, map[string]string{
+		"environments/dev/main.jsonnet":  `import '../../lib/app.libsonnet'`,
+		"environments/prod/main.jsonnet": `import '../../lib/app.libsonnet'`,
+		"lib/app.libsonnet":              `{ env: std.extVar('env'), region: import 'region.libsonnet', nested: import 'nested.libsonnet' }`,
+		"lib/nested.libsonnet":           `std.extVar('env')`,
+		"lib/standalone.libsonnet":       `std.extVar('env')`,
+		"regions/dev/region.libsonnet":   `'eu'`,
+		"regions/prod/region.libsonnet":  `'us'`,
+	})
+
+	s := testServer(t, nil)
+	s.workspaceFolder = root
+	err := s.DidChangeConfiguration(context.TODO(), &protocol.DidChangeConfigurationParams{
+		Settings: map[string]interface{}{
+			"ext_vars":            map[string]interface{}{"env": "default"},
+			"context_entrypoints": []interface{}{"environments/*/main.jsonnet"},
+			"overrides": []interface{}{
+				map[string]interface{}{
+					"glob": "environments/dev/*",
+					"settings": map[string]interface{}{
+						"jpath":    []interface{}{"${workspaceFolder}/regions/dev"},
+						"ext_vars": map[string]interface{}{"env": "dev"},
+					},
+				},
+				map[string]interface{}{
+					"glob": "environments/prod/*",
+					"settings": map[string]interface{}{
+						"jpath":    []interface{}{"${workspaceFolder}/regions/prod"},
+						"ext_vars": map[string]interface{}{"env": "prod"},
+					},
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name            string
+		file            string
+		expectedContext string
+		expectedOutput  string
+	}{
+		{
+			name:            "entrypoint",
+			file:            "environments/prod/main.jsonnet",
+			expectedContext: "environments/prod/main.jsonnet",
+			expectedOutput:  `{"env": "prod", "region": "us", "nested": "prod"}`,
+		},
+		{
+			name:            "library imported by several entrypoints",
+			file:            "lib/app.libsonnet",
+			expectedContext: "environments/dev/main.jsonnet",
+			expectedOutput:  `{"env": "dev", "region": "eu", "nested": "dev"}`,
+		},
+		{
+			name:            "library imported indirectly",
+			file:            "lib/nested.libsonnet",
+			expectedContext: "environments/dev/main.jsonnet",
+			expectedOutput:  `"dev"`,
+		},
+		{
+			name:            "library not imported by an entrypoint",
+			file:            "lib/standalone.libsonnet",
+			expectedContext: "lib/standalone.libsonnet",
+			expectedOutput:  `"default"`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			file := filepath.Join(root, filepath.FromSlash(tc.file))
+			assert.Equal(t, filepath.Join(root, filepath.FromSlash(tc.expectedContext)), s.evaluationContext(file))
+			output, err := s.getVM(file).EvaluateFile(file)
+			require.NoError(t, err)
+			assert.JSONEq(t, tc.expectedOutput, output)
+		})
+	}
+}
+
+func TestEvaluationContext_NoEntrypoints(t *testing.T) {
+	root := writeProjectFiles(t, map[string]string{
+		"main.jsonnet":  `import 'lib.libsonnet'`,
+		"lib.libsonnet": `std.extVar('env')`,
+	})
+
+	s := testServer(t, nil)
+	s.workspaceFolder = root
+	file := filepath.Join(root, "lib.libsonnet")
+	assert.Equal(t, file, s.evaluationContext(file))
+	assert.Nil(t, s.contexts.entrypoints)
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+)
+
+// fieldProfile is the time that evaluating a top-level field of a file takes.
+type fieldProfile struct {
+	Field        string  `json:"field"`
+	Milliseconds float64 `json:"milliseconds"`
+}
+
+// evaluationProfile is the result of jsonnet.profileFile.
+type evaluationProfile struct {
+	Milliseconds float64 `json:"milliseconds"`
+	// Fields are the visible top-level fields of the output, the slowest first
+	Fields []fieldProfile `json:"fields"`
+	// Report is a Markdown document of the profile, for the clients to show
+	Report string `json:"report"`
+}
+
+// profileCodeActions offers to profile the evaluation of the document, for the expensive constructs it has.
+func profileCodeActions(doc *document, diags []protocol.Diagnostic) []protocol.CodeAction {
+	var reported []protocol.Diagnostic
+	for _, diag := range diags {
+		if diag.Code == expensiveConstructDiagnosticCode {
+			reported = append(reported, diag)
+		}
+	}
+	if len(reported) == 0 {
+		return nil
+	}
+	fileArg, _ := json.Marshal(doc.item.URI.SpanURI().Filename())
+	title := fmt.Sprintf("Profile the evaluation of %s", filepath.Base(doc.item.URI.SpanURI().Filename()))
+	return []protocol.CodeAction{{
+		Title:       title,
+		Kind:        protocol.QuickFix,
+		Diagnostics: reported,
+		Command: &protocol.Command{
+			Title:     title,
+			Command:   "jsonnet.profileFile",
+			Arguments: []json.RawMessage{fileArg},
+		},
+	}}
+}
+
+// profileFile times the evaluation of a file, and of each of the top-level fields of its output, to find what makes it
+// slow. The argument is the file's name.
+func (s *Server) profileFile(ctx context.Context, params *protocol.ExecuteCommandParams) (interface{}, error) {
+	args := params.Arguments
+	if len(args) != 1 {
+		return nil, fmt.Errorf("expected 1 argument, got %d", len(args))
+	}
+	var fileName string
+	if err := json.Unmarshal(args[0], &fileName); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal file name: %v", err)
+	}
+	if err := s.requireTrust(ctx, "profiling"); err != nil {
+		return nil, err
+	}
+
+	evaluate := func(snippet string) (string, time.Duration, error) {
+		// Each evaluation has its own VM, a VM doesn't evaluate the files it already imported again
+		vm := s.getCancellableVM(ctx, fileName)
+		start := time.Now()
+		output, err := s.evaluateInTurn(ctx, "profile", fileName, func() (string, error) {
+			return vm.EvaluateAnonymousSnippet(fileName, snippet)
+		})
+		return output, time.Since(start), err
+	}
+
+	_, duration, err := evaluate(fmt.Sprintf("import %q", fileName))
+	if err != nil {
+		return nil, fmt.Errorf("unable to evaluate %s: %w", fileName, err)
+	}
+	profile := evaluationProfile{Milliseconds: milliseconds(duration), Fields: []fieldProfile{}}
+
+	output, _, err := evaluate(fmt.Sprintf("local main = import %q;\nif std.isObject(main) then std.objectFields(main) else []", fileName))
+	if err != nil {
+		return nil, fmt.Errorf("unable to evaluate the fields of %s: %w", fileName, err)
+	}
+	var fields []string
+	if err := json.Unmarshal([]byte(output), &fields); err != nil {
+		return nil, err
+	}
+	for _, field := range fields {
+		_, duration, err := evaluate(fmt.Sprintf("(import %q)[%q]", fileName, field))
+		if err != nil {
+			return nil, fmt.Errorf("unable to evaluate the field %s of %s: %w", field, fileName, err)
+		}
+		profile.Fields = append(profile.Fields, fieldProfile{Field: field, Milliseconds: milliseconds(duration)})
+	}
+	sort.SliceStable(profile.Fields, func(i, j int) bool {
+		return profile.Fields[i].Milliseconds > profile.Fields[j].Milliseconds
+	})
+
+	profile.Report = profileMarkdown(filepath.Base(fileName), profile)
+	return profile, nil
+}
+
+func profileMarkdown(name string, profile evaluationProfile) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Evaluation profile of %s\n\n", name)
+	fmt.Fprintf(&b, "The evaluation takes %.1fms.\n", profile.Milliseconds)
+	if len(profile.Fields) == 0 {
+		return b.String()
+	}
+	b.WriteString("\n| Field | Time |\n| --- | --- |\n")
+	for _, field := range profile.Fields {
+		fmt.Fprintf(&b, "| `%s` | %.1fms |\n", field.Field, field.Milliseconds)
+	}
+	return b.String()
+}
+
+func milliseconds(duration time.Duration) float64 {
+	return float64(duration) / float64(time.Millisecond)
+}
@@ -13,16 +13,39 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-func (s *Server) ExecuteCommand(_ context.Context, params *protocol.ExecuteCommandParams) (interface{}, error) {
+func (s *Server) ExecuteCommand(ctx context.Context, params *protocol.ExecuteCommandParams) (interface{}, error) {
 	switch params.Command {
 	case "jsonnet.evalItem":
 		// WIP
 		return s.evalItem(params)
 	case "jsonnet.evalFile":
 		params.Arguments = append(params.Arguments, json.RawMessage("\"\""))
-		return s.evalExpression(params)
+		return s.evalExpression(ctx, params)
 	case "jsonnet.evalExpression":
-		return s.evalExpression(params)
+		return s.evalExpression(ctx, params)
+	case "jsonnet.profileFile":
+		return s.profileFile(ctx, params)
+	case "jsonnet.bundle":
+		return s.bundle(ctx, params)
+	case "jsonnet.evalFileProvenance":
+		return s.evalFileProvenance(ctx, params)
+	case "jsonnet.previewDashboard":
+		return s.previewDashboard(ctx, params)
+	case "jsonnet.deadCode":
+		return s.deadCode(ctx, params)
+	case "jsonnet.evalAsImportedBy":
+		return s.evalAsImportedBy(ctx, params)
+	case "jsonnet.renameFile":
+		return s.renameFile(ctx, params)
+	case "jsonnet.createFile":
+		return s.createFile(ctx, params)
+	case "jsonnet.generateDocs":
+		return s.generateDocs(ctx, params)
+	case "jsonnet.enableEvaluation":
+		return s.enableEvaluation(ctx, params)
+	case "jsonnet.restartAnalysis":
+		s.restartAnalysis()
+		return nil, nil
 	}
 
 	return nil, fmt.Errorf("unknown command: %s", params.Command)
@@ -65,7 +88,7 @@ func (s *Server) evalItem(params *protocol.ExecuteCommandParams) (interface{}, e
 	return nil, fmt.Errorf("%v: %+v", reflect.TypeOf(node), node)
 }
 
-func (s *Server) evalExpression(params *protocol.ExecuteCommandParams) (interface{}, error) {
+func (s *Server) evalExpression(ctx context.Context, params *protocol.ExecuteCommandParams) (interface{}, error) {
 	args := params.Arguments
 	if len(args) != 2 {
 		return nil, fmt.Errorf("expected 2 arguments, got %d", len(args))
@@ -80,13 +103,58 @@ func (s *Server) evalExpression(params *protocol.ExecuteCommandParams) (interfac
 		return nil, fmt.Errorf("failed to unmarshal expression: %v", err)
 	}
 
+	output, err := s.evaluateFile(ctx, fileName, expression)
+	if err != nil || expression != "" {
+		return output, err
+	}
+	return s.postRender(ctx, fileName, output)
+}
+
+// evaluateFile evaluates a file, or one of its fields when the expression isn't empty.
+func (s *Server) evaluateFile(ctx context.Context, fileName, expression string) (string, error) {
+	if err := s.requireTrust(ctx, "evaluation"); err != nil {
+		return "", err
+	}
 	// TODO: Replace this stuff with Tanka's `eval` code
-	vm := s.getVM(fileName)
+	vm := s.getCancellableVM(ctx, fileName)
 
 	script := fmt.Sprintf("local main = (import '%s');\nmain", fileName)
 	if expression != "" {
 		script += "." + expression
 	}
 
-	return vm.EvaluateAnonymousSnippet(fileName, script)
+	evaluationDone := s.startEvaluationStatus(protocol.URIFromPath(fileName))
+	result, err := s.evaluateInTurn(ctx, "evalFile", fileName, func() (string, error) {
+		return vm.EvaluateAnonymousSnippet(fileName, script)
+	})
+	evaluationDone(err)
+	return result, err
+}
+
+// restartAnalysis drops everything that was computed from the files on disk and analyses the open documents again.
+// It is a recovery hatch for when the server's state doesn't match the workspace anymore, for example after a large git operation.
+// The diagnostics of the files that were deleted are cleared.
+func (s *Server) restartAnalysis() {
+	log.Info("restartAnalysis: clearing caches")
+	processing.ClearTopLevelObjectsCache()
+	s.evalCache.reset()
+	s.symbolCache.reset()
+	s.docs.reset()
+	// The libraries are indexed again, and so are they when the jpaths change, which restarts the analysis
+	s.warmUp()
+
+	for _, doc := range s.cache.list() {
+		if fileMissing(doc.item.URI) {
+			// The file was deleted, for example by a git operation, its diagnostics are cleared below
+			continue
+		}
+		newDoc := s.newDocument(context.Background(), doc.item)
+		if err := s.cache.put(newDoc); err != nil {
+			// The document was changed in the meantime, it has already been analysed again
+			log.Debugf("restartAnalysis: not replacing %s: %v", doc.item.URI, err)
+			continue
+		}
+		s.queueDiagnostics(doc.item.URI)
+	}
+	s.clearStaleDiagnostics()
 }
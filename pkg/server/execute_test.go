@@ -0,0 +1,73 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/grafana/jsonnet-language-server/pkg/ast/processing"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRestartAnalysis(t *testing.T) {
+	server, uri := testServerWithFile(t, nil, "{ a: 1 }")
+
+	before, err := server.cache.get(uri)
+	require.NoError(t, err)
+	path := uri.SpanURI().Filename()
+	server.evalCache.put(uri, evalSnapshot{text: before.item.Text})
+	server.symbolCache.documentSymbols(uri, before.item.Text, before.ast)
+	server.docs.lookupDocument(path, before.item.Text, 1)
+	server.docs.lookup(path, 1)
+	processing.FindTopLevelObjectsInFile(server.getVM(path), path, "")
+	require.NotZero(t, processing.TopLevelObjectsCacheSize())
+
+	_, err = server.ExecuteCommand(context.Background(), &protocol.ExecuteCommandParams{Command: "jsonnet.restartAnalysis"})
+	require.NoError(t, err)
+
+	after, err := server.cache.get(uri)
+	require.NoError(t, err)
+	assert.NotSame(t, before, after)
+	assert.NotSame(t, before.ast, after.ast)
+	assert.Equal(t, before.item, after.item)
+
+	// Nothing that was computed before is reused
+	_, ok := server.evalCache.get(uri)
+	assert.False(t, ok)
+	assert.Empty(t, server.symbolCache.entries)
+	assert.Empty(t, server.docs.files)
+	assert.Empty(t, server.docs.documents)
+	assert.Zero(t, processing.TopLevelObjectsCacheSize())
+}
+
+func TestEvalFileProvenance(t *testing.T) {
+	server := NewServer("any", "test version", nil, Configuration{JPaths: []string{"testdata"}})
+	filename, err := filepath.Abs("testdata/goto-overrides.jsonnet")
+	require.NoError(t, err)
+	serverOpenTestFile(t, server, filename)
+
+	arg, err := json.Marshal(filename)
+	require.NoError(t, err)
+	result, err := server.ExecuteCommand(context.Background(), &protocol.ExecuteCommandParams{
+		Command:   "jsonnet.evalFileProvenance",
+		Arguments: []json.RawMessage{arg},
+	})
+	require.NoError(t, err)
+
+	provenance, ok := result.(provenanceResult)
+	require.True(t, ok)
+	assert.Contains(t, provenance.Output, `"clobbered_string": "clobbered"`)
+
+	imported, err := filepath.Abs("testdata/goto-overrides-imported.jsonnet")
+	require.NoError(t, err)
+	assert.Equal(t, filename+":25", provenance.Provenance["/a/hello2"])
+	assert.Equal(t, filename+":42", provenance.Provenance["/clobbered_string"])
+	assert.Equal(t, imported+":3", provenance.Provenance["/a/nested1/from_import"])
+}
+
+func TestJSONPointer(t *testing.T) {
+	assert.Equal(t, "/a/b~1c/d~0e", jsonPointer([]string{"a", "b/c", "d~e"}))
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-jsonnet/ast"
+	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+)
+
+// maxExportDepth is how deep the fields of the exported objects are summarized. The libraries nest their constructors
+// in a few levels of objects, like `k.apps.v1.deployment.new`.
+const maxExportDepth = 8
+
+// exportedValue summarizes a value that a file exports, without evaluating it: an object with its fields, a function
+// with its parameters, an import, or another value.
+type exportedValue struct {
+	// Name is the name of a field, empty for the value of the file
+	Name   string `json:"name,omitempty"`
+	Kind   string `json:"kind"`
+	Hidden bool   `json:"hidden,omitempty"`
+	// Params are the parameters of functions
+	Params []string `json:"params,omitempty"`
+	// Import is the path of an imported file
+	Import string `json:"import,omitempty"`
+	// Doc is the documentation of a field, or of the docsonnet package of an object
+	Doc string `json:"doc,omitempty"`
+	// Type is the type of a docsonnet value
+	Type   string          `json:"type,omitempty"`
+	Range  *protocol.Range `json:"range,omitempty"`
+	Fields []exportedValue `json:"fields,omitempty"`
+}
+
+// exportSummaryParams are the parameters of jsonnet/exportSummary.
+type exportSummaryParams struct {
+	TextDocument protocol.TextDocumentIdentifier `json:"textDocument"`
+}
+
+// exportSummary returns the summary of what a parsed file exports: the value that it evaluates to, through its locals.
+// The documentation of the fields is the one extracted from the file.
+func exportSummary(root ast.Node, path string, docs map[int]symbolDoc) *exportedValue {
+	value := exportValue(root, path, docs, 0)
+	return &value
+}
+
+func exportValue(node ast.Node, path string, docs map[int]symbolDoc, depth int) exportedValue {
+	for {
+		switch n := node.(type) {
+		case *ast.Local:
+			node = n.Body
+			continue
+		case *ast.Parens:
+			node = n.Inner
+			continue
+		}
+		break
+	}
+
+	switch node := node.(type) {
+	case *ast.Function:
+		value := exportedValue{Kind: "function"}
+		for _, param := range node.Parameters {
+			value.Params = append(value.Params, string(param.Name))
+		}
+		return value
+	case *ast.Import:
+		return exportedValue{Kind: "import", Import: node.File.Value}
+	case *ast.DesugaredObject:
+		value := exportedValue{Kind: "object", Doc: docsonnetPackageHelp(node)}
+		if depth < maxExportDepth {
+			value.Fields = exportFields(node, path, docs, depth)
+		}
+		return value
+	case *ast.Binary:
+		// The objects merged with `+`, the fields of the right one replace those of the left one
+		left, right := exportValue(node.Left, path, docs, depth), exportValue(node.Right, path, docs, depth)
+		if node.Op != ast.BopPlus || left.Kind != "object" || right.Kind != "object" {
+			return exportedValue{Kind: "value"}
+		}
+		return exportedValue{Kind: "object", Fields: mergeExportedFields(left.Fields, right.Fields)}
+	}
+	return exportedValue{Kind: "value"}
+}
+
+// exportFields summarizes the fields of an object that have a literal name, without the docsonnet fields that
+// document the others.
+func exportFields(object *ast.DesugaredObject, path string, docs map[int]symbolDoc, depth int) []exportedValue {
+	var fields []exportedValue
+	for _, field := range object.Fields {
+		name, ok := field.Name.(*ast.LiteralString)
+		if !ok || strings.HasPrefix(name.Value, "#") || field.LocRange.FileName != path {
+			continue
+		}
+		value := exportValue(field.Body, path, docs, depth+1)
+		value.Name = name.Value
+		value.Hidden = field.Hide == ast.ObjectFieldHidden
+		doc := docs[field.LocRange.Begin.Line]
+		value.Doc, value.Type = doc.help, doc.typ
+		rng := position.RangeASTToProtocol(field.LocRange)
+		value.Range = &rng
+		fields = append(fields, value)
+	}
+	return fields
+}
+
+// docsonnetPackageHelp returns the help of the `'#': d.pkg(name, url, help)` field of an object.
+func docsonnetPackageHelp(object *ast.DesugaredObject) string {
+	for _, field := range object.Fields {
+		if name, ok := field.Name.(*ast.LiteralString); !ok || name.Value != "#" {
+			continue
+		}
+		apply, ok := field.Body.(*ast.Apply)
+		if !ok {
+			return ""
+		}
+		if kind, ok := apply.Target.(*ast.Index); !ok || literalString(kind.Index) != "pkg" {
+			return ""
+		}
+		for i, arg := range apply.Arguments.Positional {
+			if i == 2 {
+				return literalString(arg.Expr)
+			}
+		}
+		for _, arg := range apply.Arguments.Named {
+			if arg.Name == "help" {
+				return literalString(arg.Arg)
+			}
+		}
+	}
+	return ""
+}
+
+func mergeExportedFields(left, right []exportedValue) []exportedValue {
+	replaced := map[string]bool{}
+	for _, field := range right {
+		replaced[field.Name] = true
+	}
+	var fields []exportedValue
+	for _, field := range left {
+		if !replaced[field.Name] {
+			fields = append(fields, field)
+		}
+	}
+	return append(fields, right...)
+}
+
+// exportSummaryOf returns the summary of what a file exports, from the index. The open documents are summarized from
+// their text.
+func (s *Server) exportSummaryOf(path string) (*exportedValue, bool) {
+	if doc, err := s.cache.get(protocol.URIFromPath(path)); err == nil {
+		if doc.skipped != "" {
+			return nil, false
+		}
+		exports := s.docs.indexDocument(path, doc.item.Text).exports
+		return exports, exports != nil
+	}
+	file, ok := s.docs.lookupFile(path)
+	if !ok || file.exports == nil {
+		return nil, false
+	}
+	return file.exports, true
+}
+
+// exportSummaryRequest answers jsonnet/exportSummary, with the summary of what a library exports. It is read from the
+// index, so that the clients can list the API of the libraries without evaluating them.
+func (s *Server) exportSummaryRequest(_ context.Context, rawParams interface{}) (*exportedValue, error) {
+	var params exportSummaryParams
+	if err := decodeParams(rawParams, &params); err != nil {
+		return nil, err
+	}
+	path := params.TextDocument.URI.SpanURI().Filename()
+	exports, ok := s.exportSummaryOf(path)
+	if !ok {
+		return nil, fmt.Errorf("exportSummary: %s can't be indexed", path)
+	}
+	return exports, nil
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// exportedShape is an exported value without its documentation and range.
+type exportedShape struct {
+	name, kind string
+	hidden     bool
+	params     []string
+	fields     []exportedShape
+}
+
+func exportedShapes(values []exportedValue) []exportedShape {
+	var shapes []exportedShape
+	for _, value := range values {
+		shapes = append(shapes, exportedShape{
+			name:   value.Name,
+			kind:   value.Kind,
+			hidden: value.Hidden,
+			params: value.Params,
+			fields: exportedShapes(value.Fields),
+		})
+	}
+	return shapes
+}
+
+func TestExportSummary(t *testing.T) {
+	testCases := []struct {
+		name     string
+		content  string
+		kind     string
+		params   []string
+		expected []exportedShape
+	}{
+		{
+			name:    "docsonnet library",
+			content: docsonnetLibrary,
+			kind:    "object",
+			expected: []exportedShape{
+				{name: "new", kind: "function", params: []string{"name", "replicas"}},
+				{name: "defaults", kind: "object"},
+				{name: "replicas", kind: "value"},
+				{name: "withName", kind: "function", params: []string{"name"}},
+				{name: "withImage", kind: "function", params: []string{"image"}},
+				{name: "undocumented", kind: "value"},
+			},
+		},
+		{
+			name:    "nested objects",
+			content: "local util = import 'util.libsonnet';\n{\n  apps: { v1: { deployment: { new(name):: {} } } },\n  util: util,\n  lib: import 'lib.libsonnet',\n}\n",
+			kind:    "object",
+			expected: []exportedShape{
+				{name: "apps", kind: "object", fields: []exportedShape{
+					{name: "v1", kind: "object", fields: []exportedShape{
+						{name: "deployment", kind: "object", fields: []exportedShape{
+							{name: "new", kind: "function", hidden: true, params: []string{"name"}},
+						}},
+					}},
+				}},
+				{name: "util", kind: "value"},
+				{name: "lib", kind: "import"},
+			},
+		},
+		{
+			name:    "merged objects",
+			content: "{ a: 1, b: 2 } + { b():: 3, c: 4 }\n",
+			kind:    "object",
+			expected: []exportedShape{
+				{name: "a", kind: "value"},
+				{name: "b", kind: "function", hidden: true},
+				{name: "c", kind: "value"},
+			},
+		},
+		{
+			name:    "function",
+			content: "local helper = {};\nfunction(name, replicas=1) helper\n",
+			kind:    "function",
+			params:  []string{"name", "replicas"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, exports := indexContent("lib.libsonnet", tc.content)
+			require.NotNil(t, exports)
+			assert.Equal(t, tc.kind, exports.Kind)
+			assert.Equal(t, tc.params, exports.Params)
+			assert.Equal(t, tc.expected, exportedShapes(exports.Fields))
+		})
+	}
+
+	_, exports := indexContent("invalid.libsonnet", "{")
+	assert.Nil(t, exports)
+}
+
+func TestExportSummaryRequest(t *testing.T) {
+	root := writeProjectFiles(t, map[string]string{
+		"lib/deployment.libsonnet": docsonnetLibrary,
+		"main.jsonnet":             "{\n  // name is the name.\n  name: 'a',\n}\n",
+		"broken.jsonnet":           "{",
+	})
+	s := renameTestServer(t, root, nil)
+
+	request := func(path string) (*exportedValue, error) {
+		// The params are received as generic JSON values
+		result, err := s.NonstandardRequest(context.Background(), "jsonnet/exportSummary", map[string]interface{}{
+			"textDocument": map[string]interface{}{"uri": string(protocol.URIFromPath(filepath.Join(root, path)))},
+		})
+		if err != nil {
+			return nil, err
+		}
+		exports, ok := result.(*exportedValue)
+		require.True(t, ok)
+		return exports, nil
+	}
+
+	// A library that isn't open is read from the index
+	exports, err := request("lib/deployment.libsonnet")
+	require.NoError(t, err)
+	require.Len(t, exports.Fields, 6)
+	assert.Equal(t, "new", exports.Fields[0].Name)
+	assert.Equal(t, "new creates a deployment.", exports.Fields[0].Doc)
+	assert.Equal(t, "number", exports.Fields[2].Type)
+	assert.Equal(t, makeRange(t, "3:2-3:59"), *exports.Fields[0].Range)
+
+	// An open document is summarized from its text
+	uri := serverOpenTestFile(t, s, filepath.Join(root, "main.jsonnet"))
+	require.NoError(t, s.DidChange(context.Background(), &protocol.DidChangeTextDocumentParams{
+		TextDocument: protocol.VersionedTextDocumentIdentifier{
+			TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: uri},
+			Version:                2,
+		},
+		ContentChanges: []protocol.TextDocumentContentChangeEvent{{Text: "{\n  // name is the name.\n  name: 'a',\n  namespace: 'b',\n}\n"}},
+	}))
+	exports, err = request("main.jsonnet")
+	require.NoError(t, err)
+	assert.Equal(t, []exportedShape{{name: "name", kind: "value"}, {name: "namespace", kind: "value"}}, exportedShapes(exports.Fields))
+	assert.Equal(t, "name is the name.", exports.Fields[0].Doc)
+
+	_, err = request("broken.jsonnet")
+	assert.Error(t, err)
+}
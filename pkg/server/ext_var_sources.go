@@ -0,0 +1,210 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// extCodeCommandTimeout limits the time that each command of the ext_code_from_command setting can take.
+const extCodeCommandTimeout = 30 * time.Second
+
+// extVarFiles reads the files of the ext_vars_from_files setting, and caches them until they change.
+type extVarFiles struct {
+	mu    sync.Mutex
+	files map[string]*extVarFile
+}
+
+type extVarFile struct {
+	modified time.Time
+	size     int64
+	vars     map[string]string
+	code     map[string]string
+	err      error
+}
+
+func newExtVarFiles() *extVarFiles {
+	return &extVarFiles{files: map[string]*extVarFile{}}
+}
+
+// load returns the variables of a JSON or YAML file: its string values as variables, and the others as code.
+func (f *extVarFiles) load(path string) (map[string]string, map[string]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if cached, ok := f.files[path]; ok && cached.modified.Equal(info.ModTime()) && cached.size == info.Size() {
+		return cached.vars, cached.code, cached.err
+	}
+	file := &extVarFile{modified: info.ModTime(), size: info.Size()}
+	file.vars, file.code, file.err = readExtVarFile(path)
+	if file.err != nil {
+		// Errors are logged once, until the file changes
+		log.Errorf("Unable to read the external variables of %s: %v", path, file.err)
+	}
+	f.files[path] = file
+	return file.vars, file.code, file.err
+}
+
+func readExtVarFile(path string) (map[string]string, map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var values map[string]interface{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return nil, nil, err
+	}
+
+	vars, code := map[string]string{}, map[string]string{}
+	for name, value := range values {
+		if str, ok := value.(string); ok {
+			vars[name] = str
+			continue
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", name, err)
+		}
+		code[name] = string(encoded)
+	}
+	return vars, code, nil
+}
+
+// extVarsFromFiles returns the variables of the ext_vars_from_files files. The variables of a file override those
+// of the files before it.
+func (s *Server) extVarsFromFiles(config Configuration) (map[string]string, map[string]string) {
+	vars, code := map[string]string{}, map[string]string{}
+	for _, path := range config.ExtVarsFromFiles {
+		fileVars, fileCode, err := s.extVarFiles.load(path)
+		if err != nil {
+			log.Debugf("Unable to read the external variables of %s: %v", path, err)
+			continue
+		}
+		overrideVars(vars, code, fileVars, fileCode)
+	}
+	return vars, code
+}
+
+// refreshCommandExtCode runs the commands of the ext_code_from_command setting in the background, and analyses the
+// open documents again if their outputs changed. The commands may wait for the user to confirm them: the handlers
+// don't wait for them, or every later request would wait for the user's answer.
+func (s *Server) refreshCommandExtCode() {
+	run := s.commandRuns.Add(1)
+	s.runningCommands.Add(1)
+	go func() {
+		defer s.runningCommands.Done()
+		code := s.runExtCodeCommands(s.config().ExtCodeFromCommand)
+
+		s.configMu.Lock()
+		if s.commandRuns.Load() != run {
+			// The settings or the trust changed meanwhile, the commands run again
+			s.configMu.Unlock()
+			return
+		}
+		changed := !reflect.DeepEqual(s.commandExtCode, code)
+		s.commandExtCode = code
+		s.configMu.Unlock()
+		if changed {
+			s.contexts.reset()
+			s.restartAnalysis()
+		}
+	}()
+}
+
+// runExtCodeCommands runs the commands of the ext_code_from_command setting, in the workspace folder, and returns
+// their outputs evaluated as code. The variables of the commands that fail are left unset.
+func (s *Server) runExtCodeCommands(commands map[string][]string) map[string]string {
+	code := map[string]string{}
+	if len(commands) > 0 && !s.trusted() {
+		log.Infof("Not running the commands of ext_code_from_command: %v", errUntrustedWorkspace)
+		return code
+	}
+	vm := s.getVM(".")
+	for name, command := range commands {
+		commandLine, err := s.prepareCommand(context.Background(), "ext_code_from_command", command)
+		if err != nil {
+			log.Errorf("The command of the external variable %s can't run: %v", name, err)
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), extCodeCommandTimeout)
+		cmd := exec.CommandContext(ctx, commandLine[0], commandLine[1:]...)
+		cmd.Dir = s.workspaceFolder
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout, cmd.Stderr = &stdout, &stderr
+		err = cmd.Run()
+		cancel()
+		if err != nil {
+			log.Errorf("The command of the external variable %s failed: %v: %s", name, err, strings.TrimSpace(stderr.String()))
+			continue
+		}
+
+		result, err := evaluateSnippet(vm, "ext-code-from-command", stdout.String())
+		if err != nil {
+			log.Errorf("The output of the command of the external variable %s isn't valid code: %v", name, err)
+			continue
+		}
+		code[name] = result
+	}
+	return code
+}
+
+// parseExtVarsFromFiles parses the ext_vars_from_files setting. Relative paths are relative to the workspace folder.
+func (s *Server) parseExtVarsFromFiles(unparsed interface{}) ([]string, error) {
+	svList, ok := unparsed.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unsupported settings value for ext_vars_from_files. expected array of strings. got: %T", unparsed)
+	}
+	paths := make([]string, len(svList))
+	for i, v := range svList {
+		path, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("unsupported settings value for ext_vars_from_files. expected string. got: %T", v)
+		}
+		path = s.expandPlaceholders(path)
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(s.workspaceFolder, path)
+		}
+		paths[i] = path
+	}
+	return paths, nil
+}
+
+// parseExtCodeFromCommand parses the ext_code_from_command setting, which maps variables to commands.
+func (s *Server) parseExtCodeFromCommand(unparsed interface{}) (map[string][]string, error) {
+	newCommands, ok := unparsed.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unsupported settings value for ext_code_from_command. expected json object. got: %T", unparsed)
+	}
+	commands := make(map[string][]string, len(newCommands))
+	for name, value := range newCommands {
+		args, ok := value.([]interface{})
+		if !ok || len(args) == 0 {
+			return nil, fmt.Errorf("unsupported settings value for ext_code_from_command.%s. expected non-empty array of strings. got: %v", name, value)
+		}
+		command := make([]string, len(args))
+		for i, arg := range args {
+			str, ok := arg.(string)
+			if !ok {
+				return nil, fmt.Errorf("unsupported settings value for ext_code_from_command.%s. expected string. got: %T", name, arg)
+			}
+			command[i] = s.expandPlaceholders(str)
+		}
+		commands[name] = command
+	}
+	return commands, nil
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtVarsFromFiles(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string, modified time.Time) {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		require.NoError(t, os.Chtimes(path, modified, modified))
+	}
+	write("cluster.yaml", "cluster: dev\nreplicas: 2\nlabels:\n  team: platform\n", time.Now().Add(-time.Hour))
+	write("override.json", `{"cluster": "staging", "configured": "file"}`, time.Now().Add(-time.Hour))
+
+	s := testServer(t, nil)
+	s.workspaceFolder = dir
+	err := s.DidChangeConfiguration(context.TODO(), &protocol.DidChangeConfigurationParams{
+		Settings: map[string]interface{}{
+			"ext_vars_from_files": []interface{}{"cluster.yaml", "${workspaceFolder}/override.json", "missing.json"},
+			"ext_vars":            map[string]interface{}{"configured": "setting"},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "cluster.yaml"), filepath.Join(dir, "override.json"), filepath.Join(dir, "missing.json")}, s.configuration.ExtVarsFromFiles)
+
+	evaluate := func() string {
+		output, err := s.getVM("main.jsonnet").EvaluateAnonymousSnippet("main.jsonnet", `{
+			cluster: std.extVar('cluster'),
+			replicas: std.extVar('replicas'),
+			labels: std.extVar('labels'),
+			configured: std.extVar('configured'),
+		}`)
+		require.NoError(t, err)
+		return output
+	}
+	assert.JSONEq(t, `{"cluster": "staging", "replicas": 2, "labels": {"team": "platform"}, "configured": "setting"}`, evaluate())
+
+	// The files are read again when they change
+	write("override.json", `{"configured": "file"}`, time.Now())
+	assert.JSONEq(t, `{"cluster": "dev", "replicas": 2, "labels": {"team": "platform"}, "configured": "setting"}`, evaluate())
+}
+
+func TestExtVarFilesErrors(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "invalid.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("- not\n- an object\n"), 0o600))
+
+	_, _, err := newExtVarFiles().load(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot unmarshal !!seq into map[string]interface {}")
+
+	_, _, err = newExtVarFiles().load(filepath.Join(dir, "missing.yaml"))
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+}
+
+func TestExtCodeFromCommand(t *testing.T) {
+	testCases := []struct {
+		name        string
+		commands    map[string]interface{}
+		expected    map[string]string
+		expectedErr string
+	}{
+		{
+			name: "commands",
+			commands: map[string]interface{}{
+				"cluster": []interface{}{"sh", "-c", `echo '{"name": "'"$(basename "$PWD")"'"}'`},
+				"tag":     []interface{}{"echo", "'${env:JSONNET_LS_TEST_TAG}'"},
+			},
+			expected: map[string]string{
+				"cluster": "{\n   \"name\": \"workspace\"\n}\n",
+				"tag":     "\"v1\"\n",
+			},
+		},
+		{
+			name: "failures leave the variables unset",
+			commands: map[string]interface{}{
+				"failed":  []interface{}{"sh", "-c", "echo unreachable >&2; exit 1"},
+				"invalid": []interface{}{"echo", "{"},
+				"missing": []interface{}{"jsonnet-ls-missing-command"},
+			},
+			expected: map[string]string{},
+		},
+		{
+			name:        "empty command",
+			commands:    map[string]interface{}{"cluster": []interface{}{}},
+			expectedErr: "JSON RPC invalid params: ext_code_from_command parsing failed: unsupported settings value for ext_code_from_command.cluster. expected non-empty array of strings. got: []",
+		},
+		{
+			name:        "not a list",
+			commands:    map[string]interface{}{"cluster": "kubectl config current-context"},
+			expectedErr: "JSON RPC invalid params: ext_code_from_command parsing failed: unsupported settings value for ext_code_from_command.cluster. expected non-empty array of strings. got: kubectl config current-context",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("JSONNET_LS_TEST_TAG", "v1")
+			s := testServer(t, nil)
+			s.workspaceFolder = filepath.Join(t.TempDir(), "workspace")
+			require.NoError(t, os.Mkdir(s.workspaceFolder, 0o755))
+
+			err := s.DidChangeConfiguration(context.TODO(), &protocol.DidChangeConfigurationParams{
+				Settings: map[string]interface{}{"ext_code_from_command": tc.commands, "confirm_commands": false},
+			})
+			if tc.expectedErr != "" {
+				require.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			s.runningCommands.Wait()
+			assert.Equal(t, tc.expected, s.extCodeOfCommands())
+
+			if len(tc.expected) > 0 {
+				output, err := s.getVM("main.jsonnet").EvaluateAnonymousSnippet("main.jsonnet", `std.extVar('tag')`)
+				require.NoError(t, err)
+				assert.Equal(t, "\"v1\"\n", output)
+			}
+		})
+	}
+}
+
+func TestExtCodeFromCommand_PendingConfirmation(t *testing.T) {
+	dir := t.TempDir()
+	main := filepath.Join(dir, "main.jsonnet")
+	require.NoError(t, os.WriteFile(main, []byte("local cluster = std.extVar('cluster');\ncluster\n"), 0o600))
+	client := &waitingClient{
+		ClientCloser: testServer(t, nil).client,
+		waitFor:      "echo",
+		release:      make(chan struct{}),
+	}
+	s := NewServer("any", "test version", client, Configuration{})
+	s.workspaceFolder = dir
+	uri := serverOpenTestFile(t, s, main)
+
+	// The configuration is applied while the user is asked to confirm the command
+	require.NoError(t, s.DidChangeConfiguration(context.Background(), &protocol.DidChangeConfigurationParams{
+		Settings: map[string]interface{}{
+			"ext_code_from_command": map[string]interface{}{"cluster": []interface{}{"echo", "'dev'"}},
+		},
+	}))
+	assert.Eventually(t, func() bool { return len(client.getAsked()) == 1 }, 5*time.Second, time.Millisecond)
+
+	// Meanwhile, the other requests are answered
+	hover, err := s.Hover(context.Background(), &protocol.HoverParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     protocol.Position{Line: 1, Character: 2},
+		},
+	})
+	require.NoError(t, err)
+	assert.NotNil(t, hover)
+	assert.Empty(t, s.extCodeOfCommands())
+
+	// Once the command is confirmed, its output is the code of the variable
+	close(client.release)
+	s.runningCommands.Wait()
+	assert.Equal(t, map[string]string{"cluster": "\"dev\"\n"}, s.extCodeOfCommands())
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	allowCommandAction = "Allow"
+	denyCommandAction  = "Deny"
+)
+
+// commandApprovals are the user's answers to the confirmations of the commands, by command line. The user is asked
+// once per command and per server, that is per workspace.
+type commandApprovals struct {
+	mu      sync.Mutex
+	allowed map[string]bool
+	// pending are the commands the user is being asked about, their channel is closed once the user answers
+	pending map[string]chan struct{}
+}
+
+func newCommandApprovals() *commandApprovals {
+	return &commandApprovals{allowed: map[string]bool{}, pending: map[string]chan struct{}{}}
+}
+
+// parseToolPaths parses the tool_paths setting, which maps the binaries of the commands to the paths they run from.
+func (s *Server) parseToolPaths(unparsed interface{}) (map[string]string, error) {
+	newPaths, ok := unparsed.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unsupported settings value for tool_paths. expected json object. got: %T", unparsed)
+	}
+	paths := make(map[string]string, len(newPaths))
+	for binary, value := range newPaths {
+		path, ok := value.(string)
+		if !ok || path == "" {
+			return nil, fmt.Errorf("unsupported settings value for tool_paths.%s. expected non-empty string. got: %v", binary, value)
+		}
+		paths[binary] = s.expandPlaceholders(path)
+	}
+	return paths, nil
+}
+
+// prepareCommand returns the command line to run for a command of a setting. Its binary is replaced by its path in
+// tool_paths, it must be in allowed_commands when the setting is set, and the user must have allowed it to run.
+func (s *Server) prepareCommand(ctx context.Context, setting string, command []string) ([]string, error) {
+	config := s.config()
+	binary := command[0]
+	if path, ok := config.ToolPaths[binary]; ok {
+		binary = path
+	}
+	if config.AllowedCommands != nil && !contains(config.AllowedCommands, command[0]) && !contains(config.AllowedCommands, binary) {
+		return nil, fmt.Errorf("%s isn't in the allowed_commands setting", command[0])
+	}
+	commandLine := append([]string{binary}, command[1:]...)
+	if !config.SkipCommandConfirmation {
+		if err := s.confirmCommand(ctx, setting, commandLine); err != nil {
+			return nil, err
+		}
+	}
+	return commandLine, nil
+}
+
+// confirmCommand asks the user to allow a command to run, the first time it would run. The answer is remembered, the
+// user isn't asked again, even if the command was denied.
+func (s *Server) confirmCommand(ctx context.Context, setting string, commandLine []string) error {
+	key := fmt.Sprintf("%q", commandLine)
+	allowed, err := s.commandApproval(ctx, key, func() (bool, error) {
+		if s.client == nil {
+			return false, fmt.Errorf("%s can't be confirmed, there is no client to ask", commandLine[0])
+		}
+		picked, err := s.client.ShowMessageRequest(ctx, &protocol.ShowMessageRequestParams{
+			Type:    protocol.Warning,
+			Message: fmt.Sprintf("The %s setting runs `%s`. Allow it to run in this workspace?", setting, strings.Join(commandLine, " ")),
+			Actions: []protocol.MessageActionItem{{Title: allowCommandAction}, {Title: denyCommandAction}},
+		})
+		if err != nil {
+			return false, fmt.Errorf("unable to confirm %s: %w", commandLine[0], err)
+		}
+		allowed := picked != nil && picked.Title == allowCommandAction
+		log.WithContext(ctx).Infof("The command %s of the %s setting was allowed: %t", key, setting, allowed)
+		return allowed, nil
+	})
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return fmt.Errorf("%s was denied, reload the server to be asked again", commandLine[0])
+	}
+	return nil
+}
+
+// commandApproval returns the user's answer for a command, and asks for it if there is none yet. The concurrent
+// diagnostics that run the same command wait for the answer, rather than asking again, while the other commands are
+// confirmed meanwhile. If asking fails, the next of them asks again.
+func (s *Server) commandApproval(ctx context.Context, key string, ask func() (bool, error)) (bool, error) {
+	approvals := s.commandApprovals
+	for {
+		approvals.mu.Lock()
+		if allowed, answered := approvals.allowed[key]; answered {
+			approvals.mu.Unlock()
+			return allowed, nil
+		}
+		pending, ok := approvals.pending[key]
+		if !ok {
+			break
+		}
+		approvals.mu.Unlock()
+		select {
+		case <-pending:
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	}
+	answered := make(chan struct{})
+	approvals.pending[key] = answered
+	approvals.mu.Unlock()
+
+	allowed, err := ask()
+
+	approvals.mu.Lock()
+	defer approvals.mu.Unlock()
+	if err == nil {
+		approvals.allowed[key] = allowed
+	}
+	delete(approvals.pending, key)
+	close(answered)
+	return allowed, err
+}
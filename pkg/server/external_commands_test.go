@@ -0,0 +1,193 @@
+package server
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrepareCommand(t *testing.T) {
+	testCases := []struct {
+		name          string
+		configuration Configuration
+		command       []string
+		expected      []string
+		expectedErr   string
+	}{
+		{
+			name:          "command",
+			configuration: Configuration{SkipCommandConfirmation: true},
+			command:       []string{"conftest", "test", "-"},
+			expected:      []string{"conftest", "test", "-"},
+		},
+		{
+			name:          "tool path",
+			configuration: Configuration{SkipCommandConfirmation: true, ToolPaths: map[string]string{"conftest": "/opt/bin/conftest"}},
+			command:       []string{"conftest", "test", "-"},
+			expected:      []string{"/opt/bin/conftest", "test", "-"},
+		},
+		{
+			name:          "allowed by name",
+			configuration: Configuration{SkipCommandConfirmation: true, ToolPaths: map[string]string{"conftest": "/opt/bin/conftest"}, AllowedCommands: []string{"conftest"}},
+			command:       []string{"conftest", "test", "-"},
+			expected:      []string{"/opt/bin/conftest", "test", "-"},
+		},
+		{
+			name:          "allowed by path",
+			configuration: Configuration{SkipCommandConfirmation: true, ToolPaths: map[string]string{"conftest": "/opt/bin/conftest"}, AllowedCommands: []string{"/opt/bin/conftest"}},
+			command:       []string{"conftest", "test", "-"},
+			expected:      []string{"/opt/bin/conftest", "test", "-"},
+		},
+		{
+			name:          "not allowed",
+			configuration: Configuration{SkipCommandConfirmation: true, AllowedCommands: []string{"conftest"}},
+			command:       []string{"sh", "-c", "curl example.com"},
+			expectedErr:   "sh isn't in the allowed_commands setting",
+		},
+		{
+			name:          "nothing allowed",
+			configuration: Configuration{SkipCommandConfirmation: true, AllowedCommands: []string{}},
+			command:       []string{"conftest"},
+			expectedErr:   "conftest isn't in the allowed_commands setting",
+		},
+		{
+			name:          "no client to confirm",
+			configuration: Configuration{},
+			command:       []string{"conftest"},
+			expectedErr:   "conftest can't be confirmed, there is no client to ask",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewServer("any", "test version", nil, tc.configuration)
+			commandLine, err := s.prepareCommand(context.Background(), "post_renderers", tc.command)
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, commandLine)
+		})
+	}
+}
+
+func TestConfirmCommand(t *testing.T) {
+	client := &pickingClient{pick: allowCommandAction}
+	s := NewServer("any", "test version", client, Configuration{})
+
+	// The user is asked once per command
+	for i := 0; i < 2; i++ {
+		commandLine, err := s.prepareCommand(context.Background(), "post_renderers", []string{"conftest", "test", "-"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"conftest", "test", "-"}, commandLine)
+	}
+	assert.Equal(t, []string{allowCommandAction, denyCommandAction}, client.offered)
+
+	// The denied commands aren't run, nor asked for again
+	client.pick, client.offered = denyCommandAction, nil
+	for i := 0; i < 2; i++ {
+		_, err := s.prepareCommand(context.Background(), "ext_code_from_command", []string{"kubectl", "config", "current-context"})
+		assert.EqualError(t, err, "kubectl was denied, reload the server to be asked again")
+	}
+	assert.Equal(t, []string{allowCommandAction, denyCommandAction}, client.offered)
+
+	// Dismissing the message denies the command
+	client.pick = ""
+	_, err := s.prepareCommand(context.Background(), "post_renderers", []string{"conftest"})
+	assert.EqualError(t, err, "conftest was denied, reload the server to be asked again")
+
+	output, err := s.postRender(context.Background(), filepath.Join(t.TempDir(), "main.jsonnet"), `{"a": 1}`)
+	require.NoError(t, err)
+	assert.Equal(t, `{"a": 1}`, output)
+	setConfiguration(s, func(c *Configuration) {
+		c.PostRenderers = []PostRendererConfiguration{{Command: []string{"kubectl", "config", "current-context"}}}
+	})
+	_, err = s.postRender(context.Background(), filepath.Join(t.TempDir(), "main.jsonnet"), `{"a": 1}`)
+	assert.EqualError(t, err, "post-renderer kubectl failed: kubectl was denied, reload the server to be asked again")
+}
+
+// waitingClient allows the commands, once it is released for the commands that contain waitFor.
+type waitingClient struct {
+	protocol.ClientCloser
+
+	waitFor string
+	release chan struct{}
+
+	mu    sync.Mutex
+	asked []string
+}
+
+func (c *waitingClient) ShowMessageRequest(_ context.Context, params *protocol.ShowMessageRequestParams) (*protocol.MessageActionItem, error) {
+	c.mu.Lock()
+	c.asked = append(c.asked, params.Message)
+	c.mu.Unlock()
+	if strings.Contains(params.Message, c.waitFor) {
+		<-c.release
+	}
+	return &protocol.MessageActionItem{Title: allowCommandAction}, nil
+}
+
+func (c *waitingClient) getAsked() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.asked...)
+}
+
+func TestConfirmCommand_Concurrent(t *testing.T) {
+	client := &waitingClient{waitFor: "conftest", release: make(chan struct{})}
+	s := NewServer("any", "test version", client, Configuration{})
+
+	// The concurrent runs of a command wait for the user's answer
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := s.prepareCommand(context.Background(), "post_renderers", []string{"conftest", "test", "-"})
+			errs <- err
+		}()
+	}
+	assert.Eventually(t, func() bool { return len(client.getAsked()) == 1 }, 5*time.Second, time.Millisecond)
+
+	// Meanwhile, the other commands are confirmed, and the runs that give up stop waiting
+	_, err := s.prepareCommand(context.Background(), "ext_code_from_command", []string{"kubectl", "config", "current-context"})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = s.prepareCommand(ctx, "post_renderers", []string{"conftest", "test", "-"})
+	assert.ErrorIs(t, err, context.Canceled)
+
+	close(client.release)
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, <-errs)
+	}
+	assert.Equal(t, []string{
+		"The post_renderers setting runs `conftest test -`. Allow it to run in this workspace?",
+		"The ext_code_from_command setting runs `kubectl config current-context`. Allow it to run in this workspace?",
+	}, client.getAsked())
+}
+
+func TestToolPathsSetting(t *testing.T) {
+	s := testServer(t, nil)
+	s.workspaceFolder = "/workspace"
+	require.NoError(t, s.DidChangeConfiguration(context.Background(), &protocol.DidChangeConfigurationParams{
+		Settings: map[string]interface{}{
+			"tool_paths":       map[string]interface{}{"conftest": "${workspaceFolder}/bin/conftest"},
+			"allowed_commands": []interface{}{"conftest"},
+			"confirm_commands": false,
+		},
+	}))
+	assert.Equal(t, map[string]string{"conftest": "/workspace/bin/conftest"}, s.configuration.ToolPaths)
+	assert.Equal(t, []string{"conftest"}, s.configuration.AllowedCommands)
+	assert.True(t, s.configuration.SkipCommandConfirmation)
+
+	err := s.DidChangeConfiguration(context.Background(), &protocol.DidChangeConfigurationParams{
+		Settings: map[string]interface{}{"tool_paths": map[string]interface{}{"conftest": ""}},
+	})
+	assert.EqualError(t, err, "JSON RPC invalid params: tool_paths parsing failed: unsupported settings value for tool_paths.conftest. expected non-empty string. got: ")
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/google/go-jsonnet/ast"
+	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+)
+
+// fieldOccurrence is the name of a field where it is defined or overridden, or where it is accessed through `self`,
+// `super` or `$`.
+type fieldOccurrence struct {
+	name  string
+	loc   ast.LocationRange
+	write bool
+}
+
+// fieldHighlights highlights the field under the cursor, by name, in the document: its definitions and overrides are
+// writes, its accesses through `self.x`, `super.x` and `$.x` are reads. The other accesses, through locals, aren't
+// highlighted, their object isn't known without evaluation.
+func fieldHighlights(root ast.Node, text string, pos ast.Location) []protocol.DocumentHighlight {
+	occurrences := fieldOccurrences(root, text)
+	name := ""
+	for _, occurrence := range occurrences {
+		if inIdentifier(pos, occurrence.loc) {
+			name = occurrence.name
+			break
+		}
+	}
+	if name == "" {
+		return nil
+	}
+
+	var highlights []protocol.DocumentHighlight
+	for _, occurrence := range occurrences {
+		if occurrence.name != name {
+			continue
+		}
+		kind := protocol.Read
+		if occurrence.write {
+			kind = protocol.Write
+		}
+		highlights = append(highlights, protocol.DocumentHighlight{Range: position.RangeASTToProtocol(occurrence.loc), Kind: kind})
+	}
+	return highlights
+}
+
+// fieldOccurrences returns the names of the fields with a literal name, and of the accesses to fields through `self`,
+// `super` or `$` with the `.name` syntax, in the order of the document.
+func fieldOccurrences(root ast.Node, text string) []fieldOccurrence {
+	var occurrences []fieldOccurrence
+	walk(root, func(node ast.Node) {
+		switch node := node.(type) {
+		case *ast.DesugaredObject:
+			for _, field := range node.Fields {
+				name, ok := field.Name.(*ast.LiteralString)
+				if !ok {
+					continue
+				}
+				begin := field.LocRange.Begin
+				if offset := locationOffset(text, begin); offset < len(text) && (text[offset] == '\'' || text[offset] == '"') {
+					begin.Column++
+				}
+				if loc, ok := nameAt(text, name.Value, begin); ok {
+					occurrences = append(occurrences, fieldOccurrence{name: name.Value, loc: withFileName(loc, field.LocRange.FileName), write: true})
+				}
+			}
+		case *ast.Index:
+			if _, ok := node.Target.(*ast.Self); !ok && !isDollar(node.Target) {
+				return
+			}
+			if loc, name, ok := accessedFieldName(text, node.Index, node.LocRange); ok {
+				occurrences = append(occurrences, fieldOccurrence{name: name, loc: loc})
+			}
+		case *ast.SuperIndex:
+			// The range of a super access only covers `super`, the name comes after its dot
+			name, ok := node.Index.(*ast.LiteralString)
+			if !ok || !node.LocRange.End.IsSet() {
+				return
+			}
+			offset := locationOffset(text, node.LocRange.End)
+			rest := strings.TrimLeft(text[offset:], " \t")
+			if !strings.HasPrefix(rest, ".") {
+				return
+			}
+			skipped := len(text[offset:]) - len(strings.TrimLeft(rest[1:], " \t"))
+			begin := ast.Location{Line: node.LocRange.End.Line, Column: node.LocRange.End.Column + skipped}
+			if loc, ok := nameAt(text, name.Value, begin); ok {
+				occurrences = append(occurrences, fieldOccurrence{name: name.Value, loc: withFileName(loc, node.LocRange.FileName)})
+			}
+		}
+	})
+	sort.SliceStable(occurrences, func(i, j int) bool {
+		a, b := occurrences[i].loc.Begin, occurrences[j].loc.Begin
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+	return occurrences
+}
+
+func isDollar(node ast.Node) bool {
+	v, ok := node.(*ast.Var)
+	return ok && v.Id == "$"
+}
+
+// accessedFieldName returns the name of the field accessed by `x.name`, the name ends the access.
+func accessedFieldName(text string, index ast.Node, loc ast.LocationRange) (ast.LocationRange, string, bool) {
+	name, ok := index.(*ast.LiteralString)
+	if !ok || !loc.End.IsSet() || loc.End.Column <= len(name.Value) {
+		return ast.LocationRange{}, "", false
+	}
+	begin := ast.Location{Line: loc.End.Line, Column: loc.End.Column - len(name.Value)}
+	nameLoc, ok := nameAt(text, name.Value, begin)
+	return withFileName(nameLoc, loc.FileName), name.Value, ok
+}
+
+// nameAt returns the range of the name at a location, if the text has the name there.
+func nameAt(text, name string, begin ast.Location) (ast.LocationRange, bool) {
+	offset := locationOffset(text, begin)
+	if name == "" || offset+len(name) > len(text) || text[offset:offset+len(name)] != name {
+		return ast.LocationRange{}, false
+	}
+	return ast.LocationRange{Begin: begin, End: ast.Location{Line: begin.Line, Column: begin.Column + len(name)}}, true
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultMaxFileSize is the size, in bytes, of the largest file that is analyzed when max_file_size isn't set.
+const defaultMaxFileSize = 10 << 20
+
+// binarySniffLength is how much of a file is looked at to find whether it is binary, as git does.
+const binarySniffLength = 8000
+
+// maxFileSize returns the size, in bytes, of the largest file that is parsed, evaluated and indexed.
+func (c Configuration) maxFileSize() int {
+	if c.MaxFileSize > 0 {
+		return c.MaxFileSize
+	}
+	return defaultMaxFileSize
+}
+
+// isBinary reports whether the text is the content of a binary file, such as the target of an importbin: one that
+// has a NUL byte near its start.
+func isBinary(text string) bool {
+	if len(text) > binarySniffLength {
+		text = text[:binarySniffLength]
+	}
+	return strings.IndexByte(text, 0) >= 0
+}
+
+// skipReason returns why a document isn't analyzed, or an empty string if it is. Parsing and evaluating a large
+// generated file, or a binary one, would keep the server busy for a long time without anything useful to show.
+func skipReason(text string, maxSize int) string {
+	if len(text) > maxSize {
+		return fmt.Sprintf("This file is not analyzed: its size (%d bytes) is over the limit of %d bytes of the max_file_size setting", len(text), maxSize)
+	}
+	if isBinary(text) {
+		return "This file is not analyzed: it is a binary file"
+	}
+	return ""
+}
+
+// newDocument parses the text of a document that is opened, or analyzed again, unless it is too large or binary.
+func (s *Server) newDocument(ctx context.Context, item protocol.TextDocumentItem) *document {
+	doc := &document{item: item, linesChangedSinceAST: map[int]bool{}}
+	if doc.skipped = skipReason(item.Text, s.configurationFor(item.URI.SpanURI().Filename()).maxFileSize()); doc.skipped != "" {
+		log.Infof("Skipping the analysis of %s: %s", item.URI, doc.skipped)
+		return doc
+	}
+	if item.Text != "" {
+		_, parseSpan := s.startSpan(ctx, "parse")
+		doc.ast, doc.err = parseDocument(item.URI.SpanURI().Filename(), item.Text)
+		parseSpan.end(doc.err)
+		if doc.ast != nil {
+			doc.astText = item.Text
+			doc.astVersion = item.Version
+		}
+	}
+	return doc
+}
+
+// skippedDiagnostic tells why a document has no other diagnostics.
+func skippedDiagnostic(reason string) protocol.Diagnostic {
+	return protocol.Diagnostic{Source: "jsonnet", Severity: protocol.SeverityInformation, Message: reason}
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSkipReason(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		text           string
+		maxSize        int
+		expectedReason string
+	}{
+		{
+			name:    "small file",
+			text:    "{ a: 1 }",
+			maxSize: 100,
+		},
+		{
+			name:    "empty file",
+			text:    "",
+			maxSize: 100,
+		},
+		{
+			name:           "large file",
+			text:           strings.Repeat("1", 101),
+			maxSize:        100,
+			expectedReason: "This file is not analyzed: its size (101 bytes) is over the limit of 100 bytes of the max_file_size setting",
+		},
+		{
+			name:           "binary file",
+			text:           "\x89PNG\r\n\x1a\n\x00\x00",
+			maxSize:        100,
+			expectedReason: "This file is not analyzed: it is a binary file",
+		},
+		{
+			// Only the start of the file is looked at, as git does
+			name:    "NUL byte after the start",
+			text:    strings.Repeat(" ", binarySniffLength) + "\x00",
+			maxSize: defaultMaxFileSize,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedReason, skipReason(tc.text, tc.maxSize))
+		})
+	}
+}
+
+func TestSkippedDocument(t *testing.T) {
+	client := &recordingClient{}
+	s := NewServer("any", "test version", client, Configuration{EnableEvalDiagnostics: true})
+	require.NoError(t, s.DidChangeConfiguration(context.Background(), &protocol.DidChangeConfigurationParams{
+		Settings: map[string]interface{}{"max_file_size": float64(1000)},
+	}))
+	uri := protocol.URIFromPath(filepath.Join(t.TempDir(), "generated.jsonnet"))
+	large := "{\n" + strings.Repeat("  a: 1,\n", 200) + "}\n"
+
+	// The large document isn't parsed, it gets an informational diagnostic instead of being evaluated
+	require.NoError(t, s.DidOpen(context.Background(), &protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{URI: uri, Text: large, Version: 1},
+	}))
+	doc, err := s.cache.get(uri)
+	require.NoError(t, err)
+	assert.Nil(t, doc.ast)
+	assert.Contains(t, doc.skipped, "over the limit of 1000 bytes")
+	s.startQueuedDiagnostics()
+	require.Eventually(t, func() bool {
+		published := client.getPublished()
+		return len(published) == 1 && len(published[0].Diagnostics) == 1 &&
+			published[0].Diagnostics[0].Severity == protocol.SeverityInformation &&
+			strings.Contains(published[0].Diagnostics[0].Message, "max_file_size")
+	}, 2*time.Second, 10*time.Millisecond)
+
+	// Neither is it formatted, nor does it have symbols
+	edits, err := s.Formatting(context.Background(), &protocol.DocumentFormattingParams{TextDocument: protocol.TextDocumentIdentifier{URI: uri}})
+	require.NoError(t, err)
+	assert.Nil(t, edits)
+	symbols, err := s.DocumentSymbol(context.Background(), &protocol.DocumentSymbolParams{TextDocument: protocol.TextDocumentIdentifier{URI: uri}})
+	require.NoError(t, err)
+	assert.Empty(t, symbols)
+
+	// Once it is small enough, it is analyzed again
+	require.NoError(t, s.DidChange(context.Background(), &protocol.DidChangeTextDocumentParams{
+		TextDocument:   protocol.VersionedTextDocumentIdentifier{Version: 2, TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: uri}},
+		ContentChanges: []protocol.TextDocumentContentChangeEvent{{Text: "{ a: 1 }"}},
+	}))
+	doc, err = s.cache.get(uri)
+	require.NoError(t, err)
+	assert.NotNil(t, doc.ast)
+	assert.Empty(t, doc.skipped)
+}
+
+func TestLookupFile_SkipsLargeAndBinaryFiles(t *testing.T) {
+	root := writeProjectFiles(t, map[string]string{
+		"lib.libsonnet":    "{\n  // a is documented.\n  a: 1,\n}",
+		"large.libsonnet":  "{\n  // a is documented.\n  a: '" + strings.Repeat("x", 100) + "',\n}",
+		"binary.libsonnet": "{\x00}",
+	})
+	s := NewServer("any", "test version", nil, Configuration{MaxFileSize: 100})
+
+	_, ok := s.docs.lookupFile(filepath.Join(root, "lib.libsonnet"))
+	assert.True(t, ok)
+	_, ok = s.docs.lookupFile(filepath.Join(root, "large.libsonnet"))
+	assert.False(t, ok)
+	_, ok = s.docs.lookupFile(filepath.Join(root, "binary.libsonnet"))
+	assert.False(t, ok)
+}
@@ -0,0 +1,241 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/mitchellh/mapstructure"
+)
+
+// FileTemplateConfiguration is a template that empty files can be started from. The body is a snippet, with `$1`,
+// `${1:default}` and `${1|first,second|}` tab stops, whose literal `$`, `}` and `\` are escaped with `\`.
+type FileTemplateConfiguration struct {
+	Name        string   `mapstructure:"name"`
+	Description string   `mapstructure:"description"`
+	Body        string   `mapstructure:"body"`
+	FileMatch   []string `mapstructure:"fileMatch"`
+}
+
+func (c FileTemplateConfiguration) matchesFile(filename string) bool {
+	if len(c.FileMatch) == 0 {
+		return true
+	}
+	return matchesFileGlobs(c.FileMatch, filename)
+}
+
+// defaultFileTemplates are the templates offered along with the configured ones, which replace those of the same name.
+var defaultFileTemplates = []FileTemplateConfiguration{
+	{
+		Name:        "Tanka environment",
+		Description: "An inline Tanka environment",
+		FileMatch:   []string{"*.jsonnet"},
+		Body: `{
+  apiVersion: 'tanka.dev/v1alpha1',
+  kind: 'Environment',
+  metadata: {
+    name: '${1:environments/default}',
+  },
+  spec: {
+    apiServer: '${2:https://127.0.0.1:6443}',
+    namespace: '${3:default}',
+  },
+  data: {
+    $0
+  },
+}
+`,
+	},
+	{
+		Name:        "Library",
+		Description: "A library with a docsonnet package header",
+		FileMatch:   []string{"*.libsonnet"},
+		Body: `local d = import 'github.com/jsonnet-libs/docsonnet/doc-util/main.libsonnet';
+
+{
+  '#': d.pkg(
+    name='${1:name}',
+    url='${2:github.com/example/name/main.libsonnet}',
+    help='${3:What the library is for.}',
+  ),
+  $0
+}
+`,
+	},
+	{
+		Name:        "Kubernetes object",
+		Description: "A constructor of a Kubernetes object",
+		Body: `{
+  new(name):: {
+    apiVersion: '${1:v1}',
+    kind: '${2:ConfigMap}',
+    metadata: {
+      name: name,
+    },
+    $0
+  },
+}
+`,
+	},
+}
+
+func parseFileTemplates(unparsed interface{}) ([]FileTemplateConfiguration, error) {
+	if _, ok := unparsed.([]interface{}); !ok {
+		return nil, fmt.Errorf("unsupported settings value for file_templates. expected array of objects. got: %T", unparsed)
+	}
+
+	var templates []FileTemplateConfiguration
+	if err := mapstructure.Decode(unparsed, &templates); err != nil {
+		return nil, fmt.Errorf("map decode failed: %v", err)
+	}
+	for i, template := range templates {
+		if template.Name == "" {
+			return nil, fmt.Errorf("file_templates[%d]: name is required", i)
+		}
+		if template.Body == "" {
+			return nil, fmt.Errorf("file_templates[%d]: body is required", i)
+		}
+	}
+	return templates, nil
+}
+
+// fileTemplates returns the templates that a file can be started from: the default ones that aren't replaced by a
+// configured one of the same name, then the configured ones.
+func (s *Server) fileTemplates(filename string) []FileTemplateConfiguration {
+	configured := s.configurationFor(filename).FileTemplates
+	replaced := map[string]bool{}
+	for _, template := range configured {
+		replaced[template.Name] = true
+	}
+
+	var templates []FileTemplateConfiguration
+	for _, template := range defaultFileTemplates {
+		if !replaced[template.Name] && template.matchesFile(filename) {
+			templates = append(templates, template)
+		}
+	}
+	for _, template := range configured {
+		if template.matchesFile(filename) {
+			templates = append(templates, template)
+		}
+	}
+	return templates
+}
+
+// isEmptyDocument tells whether a document has no content yet, the ones that templates are offered for.
+func isEmptyDocument(doc *document) bool {
+	return strings.TrimSpace(doc.item.Text) == ""
+}
+
+// fileTemplateCompletionItems returns the templates of an empty document, inserted as snippets when the client
+// supports them.
+func (s *Server) fileTemplateCompletionItems(doc *document) []protocol.CompletionItem {
+	var items []protocol.CompletionItem
+	for _, template := range s.fileTemplates(doc.item.URI.SpanURI().Filename()) {
+		item := protocol.CompletionItem{
+			Label:            template.Name,
+			Kind:             protocol.SnippetCompletion,
+			Detail:           template.Description,
+			InsertTextFormat: protocol.SnippetTextFormat,
+			TextEdit:         &protocol.TextEdit{Range: documentRange(doc.item.Text), NewText: template.Body},
+		}
+		if !s.clientSnippets {
+			item.InsertTextFormat = protocol.PlainTextTextFormat
+			item.TextEdit.NewText = expandSnippet(template.Body)
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// fileTemplateCodeActions offers to start an empty document from a template, with the defaults of its tab stops.
+func (s *Server) fileTemplateCodeActions(doc *document) []protocol.CodeAction {
+	if !isEmptyDocument(doc) {
+		return nil
+	}
+
+	var actions []protocol.CodeAction
+	for _, template := range s.fileTemplates(doc.item.URI.SpanURI().Filename()) {
+		actions = append(actions, protocol.CodeAction{
+			Title: fmt.Sprintf("Insert the %s template", template.Name),
+			Kind:  protocol.Source,
+			Edit: protocol.WorkspaceEdit{
+				Changes: map[string][]protocol.TextEdit{
+					string(doc.item.URI): {{Range: documentRange(doc.item.Text), NewText: expandSnippet(template.Body)}},
+				},
+			},
+		})
+	}
+	return actions
+}
+
+// documentRange is the range of the whole text.
+func documentRange(text string) protocol.Range {
+	lines := strings.Split(text, "\n")
+	return protocol.Range{
+		End: protocol.Position{Line: uint32(len(lines) - 1), Character: uint32(len(lines[len(lines)-1]))},
+	}
+}
+
+// expandSnippet returns the text of a snippet with the defaults of its tab stops, the first choice of the choices, and
+// without the trailing whitespace that empty tab stops leave.
+func expandSnippet(snippet string) string {
+	text, _ := expandSnippetUntil(snippet, 0, false)
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// expandSnippetUntil expands the snippet from i, until the end of the enclosing placeholder if nested, and returns
+// where it stopped.
+func expandSnippetUntil(snippet string, i int, nested bool) (string, int) {
+	var b strings.Builder
+	for i < len(snippet) {
+		c := snippet[i]
+		switch {
+		case c == '\\' && i+1 < len(snippet) && strings.ContainsRune(`$}\`, rune(snippet[i+1])):
+			b.WriteByte(snippet[i+1])
+			i += 2
+		case c == '}' && nested:
+			return b.String(), i + 1
+		case c == '$' && i+1 < len(snippet) && isDigit(snippet[i+1]):
+			i++
+			for i < len(snippet) && isDigit(snippet[i]) {
+				i++
+			}
+		case c == '$' && i+2 < len(snippet) && snippet[i+1] == '{' && isDigit(snippet[i+2]):
+			i += 2
+			for i < len(snippet) && isDigit(snippet[i]) {
+				i++
+			}
+			if i >= len(snippet) {
+				return b.String(), i
+			}
+			switch snippet[i] {
+			case ':':
+				var placeholder string
+				placeholder, i = expandSnippetUntil(snippet, i+1, true)
+				b.WriteString(placeholder)
+			case '|':
+				end := strings.Index(snippet[i:], "|}")
+				if end == -1 {
+					return b.String(), len(snippet)
+				}
+				b.WriteString(strings.SplitN(snippet[i+1:i+end], ",", 2)[0])
+				i += end + 2
+			case '}':
+				i++
+			}
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String(), i
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
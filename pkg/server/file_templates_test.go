@@ -0,0 +1,155 @@
+package server
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandSnippet(t *testing.T) {
+	testCases := []struct {
+		name     string
+		snippet  string
+		expected string
+	}{
+		{
+			name:     "tab stops",
+			snippet:  "{\n  $1: $2,\n  $0\n}",
+			expected: "{\n  : ,\n\n}",
+		},
+		{
+			name:     "placeholders",
+			snippet:  "{ name: '${1:default}', ns: '${2}' }",
+			expected: "{ name: 'default', ns: '' }",
+		},
+		{
+			name:     "nested placeholders",
+			snippet:  "${1:a ${2:b} c}",
+			expected: "a b c",
+		},
+		{
+			name:     "choices",
+			snippet:  "kind: '${1|Deployment,StatefulSet|}'",
+			expected: "kind: 'Deployment'",
+		},
+		{
+			name:     "escapes",
+			snippet:  `\$.config + { a: '\}', b: '\\' }`,
+			expected: `$.config + { a: '}', b: '\' }`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, expandSnippet(tc.snippet))
+		})
+	}
+}
+
+func TestFileTemplates(t *testing.T) {
+	root := writeProjectFiles(t, map[string]string{
+		"main.jsonnet":   "",
+		"lib.libsonnet":  "\n",
+		"other.jsonnet":  "{}",
+		"custom.jsonnet": "",
+	})
+	s := NewServer("any", "test version", &recordingClient{}, Configuration{})
+	params := &protocol.ParamInitialize{}
+	params.RootURI = protocol.URIFromPath(root)
+	params.Capabilities.TextDocument.Completion.CompletionItem.SnippetSupport = true
+	_, err := s.Initialize(context.Background(), params)
+	require.NoError(t, err)
+	require.NoError(t, s.DidChangeConfiguration(context.Background(), &protocol.DidChangeConfigurationParams{
+		Settings: map[string]interface{}{
+			"file_templates": []interface{}{
+				map[string]interface{}{"name": "Kubernetes object", "body": "{ kind: '${1:Service}' }\n"},
+				map[string]interface{}{"name": "Dashboard", "body": "{ title: '$1' }\n", "fileMatch": []interface{}{"custom.jsonnet"}},
+			},
+		},
+	}))
+
+	testCases := []struct {
+		file            string
+		expectedLabels  []string
+		expectedActions map[string]string
+	}{
+		{
+			file:           "main.jsonnet",
+			expectedLabels: []string{"Tanka environment", "Kubernetes object"},
+			expectedActions: map[string]string{
+				"Insert the Tanka environment template": "{\n  apiVersion: 'tanka.dev/v1alpha1',\n  kind: 'Environment',\n  metadata: {\n    name: 'environments/default',\n  },\n  spec: {\n    apiServer: 'https://127.0.0.1:6443',\n    namespace: 'default',\n  },\n  data: {\n\n  },\n}\n",
+				"Insert the Kubernetes object template": "{ kind: 'Service' }\n",
+			},
+		},
+		{
+			file:           "lib.libsonnet",
+			expectedLabels: []string{"Library", "Kubernetes object"},
+			expectedActions: map[string]string{
+				"Insert the Library template":           "local d = import 'github.com/jsonnet-libs/docsonnet/doc-util/main.libsonnet';\n\n{\n  '#': d.pkg(\n    name='name',\n    url='github.com/example/name/main.libsonnet',\n    help='What the library is for.',\n  ),\n\n}\n",
+				"Insert the Kubernetes object template": "{ kind: 'Service' }\n",
+			},
+		},
+		{
+			file:           "custom.jsonnet",
+			expectedLabels: []string{"Tanka environment", "Kubernetes object", "Dashboard"},
+			expectedActions: map[string]string{
+				"Insert the Tanka environment template": "",
+				"Insert the Kubernetes object template": "{ kind: 'Service' }\n",
+				"Insert the Dashboard template":         "{ title: '' }\n",
+			},
+		},
+		{
+			file: "other.jsonnet",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.file, func(t *testing.T) {
+			path := filepath.Join(root, tc.file)
+			uri := serverOpenTestFile(t, s, path)
+			doc, err := s.cache.get(uri)
+			require.NoError(t, err)
+
+			if tc.expectedLabels != nil {
+				list, err := s.Completion(context.Background(), &protocol.CompletionParams{
+					TextDocumentPositionParams: protocol.TextDocumentPositionParams{TextDocument: protocol.TextDocumentIdentifier{URI: uri}},
+				})
+				require.NoError(t, err)
+				var labels []string
+				for _, item := range list.Items {
+					labels = append(labels, item.Label)
+					assert.Equal(t, protocol.SnippetTextFormat, item.InsertTextFormat)
+				}
+				assert.Equal(t, tc.expectedLabels, labels)
+			}
+
+			actions, err := s.CodeAction(context.Background(), &protocol.CodeActionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+				Context:      protocol.CodeActionContext{Only: []protocol.CodeActionKind{protocol.Source}},
+			})
+			require.NoError(t, err)
+			templateActions := actions[:0]
+			for _, action := range actions {
+				if action.Kind == protocol.Source {
+					templateActions = append(templateActions, action)
+				}
+			}
+			actions = templateActions
+			if tc.expectedActions == nil {
+				assert.Empty(t, actions)
+				return
+			}
+			require.Len(t, actions, len(tc.expectedActions))
+			for _, action := range actions {
+				expected, ok := tc.expectedActions[action.Title]
+				require.True(t, ok, action.Title)
+				if expected == "" {
+					continue
+				}
+				assert.Equal(t, expected, applyTextEdits(t, doc.item.Text, action.Edit.Changes[string(uri)]))
+			}
+		})
+	}
+}
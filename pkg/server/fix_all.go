@@ -0,0 +1,241 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/go-jsonnet/ast"
+	"github.com/grafana/jsonnet-language-server/pkg/utils"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	fixOrganizeImports   = "organize_imports"
+	fixRemoveUnusedLocal = "remove_unused_locals"
+	fixFormat            = "format"
+)
+
+// defaultFixAll are the fixes of the source.fixAll code action when the fix_all setting isn't set.
+var defaultFixAll = []string{fixOrganizeImports, fixRemoveUnusedLocal, fixFormat}
+
+// unusedFunctionRegexp matches the linter's reports of unused functions, which have no location.
+var unusedFunctionRegexp = regexp.MustCompile(`(?m)^\s*Unused variable: ([A-Za-z_][A-Za-z0-9_]*)$`)
+
+// importLineRegexp matches the lines that are a single import local, with the name of the local and the imported path.
+var importLineRegexp = regexp.MustCompile(`^(\s*)local\s+([A-Za-z_][A-Za-z0-9_]*)\s*=\s*(?:import|importstr|importbin)\s+(?:'([^'\\]*)'|"([^"\\]*)")\s*;\s*$`)
+
+func parseFixAll(sv interface{}) ([]string, error) {
+	svList, ok := sv.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected array of strings. got: %T", sv)
+	}
+	fixes := make([]string, len(svList))
+	for i, v := range svList {
+		fix, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected string. got: %T", v)
+		}
+		switch fix {
+		case fixOrganizeImports, fixRemoveUnusedLocal, fixFormat:
+		default:
+			return nil, fmt.Errorf("unknown fix: %q", fix)
+		}
+		fixes[i] = fix
+	}
+	return fixes, nil
+}
+
+func (s *Server) WillSaveWaitUntil(ctx context.Context, params *protocol.WillSaveTextDocumentParams) ([]protocol.TextEdit, error) {
+	doc, err := s.cache.get(params.TextDocument.URI)
+	if err != nil {
+		return nil, utils.LogErrorf("WillSaveWaitUntil: %s: %w", errorRetrievingDocument, err)
+	}
+	if !s.configurationFor(params.TextDocument.URI.SpanURI().Filename()).FixAllOnSave {
+		return nil, nil
+	}
+	return s.fixAll(ctx, doc), nil
+}
+
+// fixAllCodeActions returns the source.fixAll code action, if the fixes change the document.
+func (s *Server) fixAllCodeActions(ctx context.Context, doc *document) []protocol.CodeAction {
+	edits := s.fixAll(ctx, doc)
+	if len(edits) == 0 {
+		return nil
+	}
+	return []protocol.CodeAction{{
+		Title: "Fix all",
+		Kind:  protocol.SourceFixAll,
+		Edit: protocol.WorkspaceEdit{
+			Changes: map[string][]protocol.TextEdit{string(doc.item.URI): edits},
+		},
+	}}
+}
+
+// fixAll runs the configured fixes on the document, one after the other, and returns their changes as a single edit.
+func (s *Server) fixAll(ctx context.Context, doc *document) []protocol.TextEdit {
+	filename := doc.item.URI.SpanURI().Filename()
+	config := s.configurationFor(filename)
+	fixes := config.FixAll
+	if fixes == nil {
+		fixes = defaultFixAll
+	}
+
+	text := doc.item.Text
+	for _, fix := range fixes {
+		switch fix {
+		case fixOrganizeImports:
+			text = organizeImports(text)
+		case fixRemoveUnusedLocal:
+			text = s.removeUnusedLocals(ctx, doc.item.URI, text)
+		case fixFormat:
+			formatted, err := formatJsonnet(filename, text, config.FormattingOptions)
+			if err != nil {
+				log.WithContext(ctx).Errorf("fixAll: error formatting document: %v", err)
+				continue
+			}
+			text = config.FormattingPasses.apply(formatted, config.FormattingOptions.Indent)
+		}
+	}
+	if text == doc.item.Text {
+		return nil
+	}
+	return getTextEdits(doc.item.Text, text)
+}
+
+// organizeImports sorts the consecutive import locals that have the same indentation by path. The runs that declare
+// a local twice are left alone, sorting them would change which one is shadowed.
+func organizeImports(text string) string {
+	lines := scanLines(text)
+	type importLine struct {
+		text, name, path string
+	}
+	var run []importLine
+	start := 0
+	flush := func() {
+		names := map[string]bool{}
+		for _, imp := range run {
+			if names[imp.name] {
+				run = nil
+				return
+			}
+			names[imp.name] = true
+		}
+		sort.SliceStable(run, func(i, j int) bool {
+			if run[i].path != run[j].path {
+				return run[i].path < run[j].path
+			}
+			return run[i].name < run[j].name
+		})
+		for i, imp := range run {
+			lines[start+i].text = imp.text
+		}
+		run = nil
+	}
+
+	indent := ""
+	for i, line := range lines {
+		match := importLineRegexp.FindStringSubmatch(line.text)
+		if !line.code || match == nil || (len(run) > 0 && match[1] != indent) {
+			flush()
+		}
+		if !line.code || match == nil {
+			continue
+		}
+		if len(run) == 0 {
+			start, indent = i, match[1]
+		}
+		run = append(run, importLine{text: line.text, name: match[2], path: match[3] + match[4]})
+	}
+	flush()
+	return joinScannedLines(lines)
+}
+
+// removeUnusedLocals removes the lines of the unused locals that the linter reports. Only the locals that have
+// their own lines and a single bind are removed.
+func (s *Server) removeUnusedLocals(ctx context.Context, uri protocol.DocumentURI, text string) string {
+	result, err := s.lintWithRecover(ctx, &document{item: protocol.TextDocumentItem{URI: uri, Text: text}})
+	if err != nil {
+		log.WithContext(ctx).Errorf("removeUnusedLocals: %v", err)
+		return text
+	}
+	// The linter reports the unused functions without their locations, they are found by name
+	type unusedVariable struct {
+		name string
+		line int
+	}
+	unused := map[unusedVariable]bool{}
+	for _, match := range errRegexp.FindAllStringSubmatch(result, -1) {
+		message, rng := parseErrRegexpMatch(match)
+		if name, ok := strings.CutPrefix(message, "Unused variable: "); ok {
+			unused[unusedVariable{name: name, line: int(rng.Start.Line)}] = true
+		}
+	}
+	for _, match := range unusedFunctionRegexp.FindAllStringSubmatch(result, -1) {
+		unused[unusedVariable{name: match[1], line: -1}] = true
+	}
+	if len(unused) == 0 {
+		return text
+	}
+
+	root, err := snippetToAST(uri.SpanURI().Filename(), text)
+	if err != nil {
+		return text
+	}
+	var locals []*ast.Local
+	functions := map[string]int{}
+	walk(root, func(node ast.Node) {
+		if local, ok := node.(*ast.Local); ok && local.Body != nil {
+			locals = append(locals, local)
+			for _, bind := range local.Binds {
+				if bind.Fun != nil || bind.LocRange.Begin.Line == 0 {
+					functions[string(bind.Variable)]++
+				}
+			}
+		}
+	})
+
+	lines := strings.Split(text, "\n")
+	removed := map[int]bool{}
+	for _, local := range locals {
+		if len(local.Binds) != 1 || local.Binds[0].Body == nil {
+			continue
+		}
+		bind := local.Binds[0]
+		key := unusedVariable{name: string(bind.Variable), line: bind.LocRange.Begin.Line - 1}
+		if bind.LocRange.Begin.Line == 0 {
+			if functions[key.name] != 1 {
+				continue
+			}
+			key.line = -1
+		}
+		if !unused[key] {
+			continue
+		}
+		begin, end := local.Loc().Begin, bind.Body.Loc().End
+		if begin.Line < 1 || end.Line > len(lines) || local.Body.Loc().Begin.Line <= end.Line {
+			continue
+		}
+		// The local starts its line and its semicolon ends the line of its value
+		if strings.TrimSpace(lines[begin.Line-1][:begin.Column-1]) != "" {
+			continue
+		}
+		if end.Column-1 > len(lines[end.Line-1]) || strings.TrimSpace(lines[end.Line-1][end.Column-1:]) != ";" {
+			continue
+		}
+		for line := begin.Line - 1; line < end.Line; line++ {
+			removed[line] = true
+		}
+	}
+
+	var kept []string
+	for i, line := range lines {
+		if !removed[i] {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
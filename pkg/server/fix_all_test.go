@@ -0,0 +1,144 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFixAll(t *testing.T) {
+	testCases := []struct {
+		name     string
+		settings map[string]interface{}
+		content  string
+		expected string
+	}{
+		{
+			name: "default fixes",
+			content: `local z = import 'z.libsonnet';
+local unused = import 'unused.libsonnet';
+local a = import "a.libsonnet";
+local helper(x) = x * 2;
+{a: a, z: z}
+`,
+			expected: `local a = import 'a.libsonnet';
+local z = import 'z.libsonnet';
+{ a: a, z: z }
+`,
+		},
+		{
+			name:     "organize imports only",
+			settings: map[string]interface{}{"fix_all": []interface{}{"organize_imports"}},
+			content: `local z = import 'z.libsonnet';
+local a = importstr 'a.txt';  // comment
+local c = import 'c.libsonnet';
+local b = import 'b.libsonnet';
+{a: a, b: b, c: c, z: z}
+`,
+			expected: `local z = import 'z.libsonnet';
+local a = importstr 'a.txt';  // comment
+local b = import 'b.libsonnet';
+local c = import 'c.libsonnet';
+{a: a, b: b, c: c, z: z}
+`,
+		},
+		{
+			name:     "shadowed imports are not sorted",
+			settings: map[string]interface{}{"fix_all": []interface{}{"organize_imports"}},
+			content: `local a = import 'z.libsonnet';
+local a = import 'a.libsonnet';
+a
+`,
+			expected: `local a = import 'z.libsonnet';
+local a = import 'a.libsonnet';
+a
+`,
+		},
+		{
+			name:     "remove unused locals only",
+			settings: map[string]interface{}{"fix_all": []interface{}{"remove_unused_locals"}},
+			content: `local unused = {
+  a: 1,
+};
+local used = 1;
+local a = 1, b = 2;
+local inline = 1; {
+  local nested = 2,
+  field: used + a,
+}
+`,
+			expected: `local used = 1;
+local a = 1, b = 2;
+local inline = 1; {
+  local nested = 2,
+  field: used + a,
+}
+`,
+		},
+		{
+			name:     "nothing to fix",
+			content:  "local a = import 'a.libsonnet';\n{ a: a }\n",
+			expected: "local a = import 'a.libsonnet';\n{ a: a }\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s, uri := testServerWithFile(t, nil, tc.content)
+			if tc.settings != nil {
+				require.NoError(t, s.DidChangeConfiguration(context.TODO(), &protocol.DidChangeConfigurationParams{Settings: tc.settings}))
+			}
+
+			actions, err := s.CodeAction(context.TODO(), &protocol.CodeActionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+				Context:      protocol.CodeActionContext{Only: []protocol.CodeActionKind{protocol.SourceFixAll}},
+			})
+			require.NoError(t, err)
+			if tc.content == tc.expected {
+				assert.Empty(t, actions)
+				return
+			}
+			require.Len(t, actions, 1)
+			assert.Equal(t, protocol.SourceFixAll, actions[0].Kind)
+			assert.Equal(t, tc.expected, applyTextEdits(t, tc.content, actions[0].Edit.Changes[string(uri)]))
+		})
+	}
+}
+
+func TestFixAll_OnSave(t *testing.T) {
+	content := "local b = import 'b.libsonnet';\nlocal a = import 'a.libsonnet';\n{a: a, b: b}\n"
+	s, uri := testServerWithFile(t, nil, content)
+	params := &protocol.WillSaveTextDocumentParams{TextDocument: protocol.TextDocumentIdentifier{URI: uri}}
+
+	edits, err := s.WillSaveWaitUntil(context.TODO(), params)
+	require.NoError(t, err)
+	assert.Empty(t, edits)
+
+	require.NoError(t, s.DidChangeConfiguration(context.TODO(), &protocol.DidChangeConfigurationParams{
+		Settings: map[string]interface{}{"fix_all_on_save": true, "fix_all": []interface{}{"organize_imports"}},
+	}))
+	edits, err = s.WillSaveWaitUntil(context.TODO(), params)
+	require.NoError(t, err)
+	assert.Equal(t, "local a = import 'a.libsonnet';\nlocal b = import 'b.libsonnet';\n{a: a, b: b}\n", applyTextEdits(t, content, edits))
+}
+
+func TestFixAll_InvalidSettings(t *testing.T) {
+	s := testServer(t, nil)
+	for _, settings := range []map[string]interface{}{
+		{"fix_all": "format"},
+		{"fix_all": []interface{}{"unknown"}},
+		{"fix_all_on_save": "yes"},
+	} {
+		assert.Error(t, s.DidChangeConfiguration(context.TODO(), &protocol.DidChangeConfigurationParams{Settings: settings}))
+	}
+}
+
+func TestCodeActionKindRequested(t *testing.T) {
+	assert.True(t, codeActionKindRequested(nil, protocol.SourceFixAll))
+	assert.True(t, codeActionKindRequested([]protocol.CodeActionKind{protocol.Source}, protocol.SourceFixAll))
+	assert.True(t, codeActionKindRequested([]protocol.CodeActionKind{protocol.QuickFix, protocol.SourceFixAll}, protocol.SourceFixAll))
+	assert.False(t, codeActionKindRequested([]protocol.CodeActionKind{protocol.QuickFix}, protocol.SourceFixAll))
+	assert.False(t, codeActionKindRequested([]protocol.CodeActionKind{"source.fix"}, protocol.SourceFixAll))
+}
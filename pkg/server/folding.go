@@ -0,0 +1,163 @@
+package server
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/go-jsonnet/ast"
+	"github.com/grafana/jsonnet-language-server/pkg/utils"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// FoldingRange folds the objects, arrays, function calls and text blocks that span several lines. The closing
+// brackets stay visible, the text blocks are folded with their `|||`. The comment blocks, the leading imports and the
+// regions between `// region` and `// endregion` comments are folded with their kind.
+func (s *Server) FoldingRange(ctx context.Context, params *protocol.FoldingRangeParams) ([]protocol.FoldingRange, error) {
+	doc, err := s.cache.get(params.TextDocument.URI)
+	if err != nil {
+		return nil, utils.LogErrorf("FoldingRange: %s: %w", errorRetrievingDocument, err)
+	}
+
+	// The comments and regions are found in the text, they are folded even when it doesn't parse
+	ranges := commentFoldingRanges(doc.item.Text)
+	if doc.ast == nil {
+		log.WithContext(ctx).Errorf("FoldingRange: %s", errorParsingDocument)
+		return sortFoldingRanges(ranges), nil
+	}
+
+	astRanges := append(foldingRanges(doc.ast), importFoldingRanges(doc.ast)...)
+	if doc.stale() {
+		astRanges = staleFoldingRanges(astRanges, newLineMap(doc.astText, doc.item.Text))
+	}
+	return sortFoldingRanges(append(ranges, astRanges...)), nil
+}
+
+func foldingRanges(root ast.Node) []protocol.FoldingRange {
+	// The ranges by start line, only the longest range of a line is kept
+	byLine := map[uint32]protocol.FoldingRange{}
+	walk(root, func(node ast.Node) {
+		loc := node.Loc()
+		if loc == nil || !loc.Begin.IsSet() {
+			return
+		}
+		start, end := loc.Begin.Line-1, loc.End.Line-1
+		switch node.(type) {
+		case *ast.DesugaredObject, *ast.Array, *ast.Apply:
+			end--
+		case *ast.LiteralString:
+			// The text blocks are desugared to strings, whose location is the block's
+		default:
+			return
+		}
+		if end <= start {
+			return
+		}
+		if existing, ok := byLine[uint32(start)]; !ok || existing.EndLine < uint32(end) {
+			byLine[uint32(start)] = protocol.FoldingRange{StartLine: uint32(start), EndLine: uint32(end)}
+		}
+	})
+
+	ranges := make([]protocol.FoldingRange, 0, len(byLine))
+	for _, rng := range byLine {
+		ranges = append(ranges, rng)
+	}
+	return sortFoldingRanges(ranges)
+}
+
+// staleFoldingRanges maps the folding ranges of a stale AST to the current text. The ranges whose first line was
+// edited are left out.
+func staleFoldingRanges(ranges []protocol.FoldingRange, lines lineMap) []protocol.FoldingRange {
+	var mapped []protocol.FoldingRange
+	for _, fold := range ranges {
+		rng, ok := lines.rangeToText(protocol.Range{
+			Start: protocol.Position{Line: fold.StartLine},
+			End:   protocol.Position{Line: fold.EndLine},
+		})
+		if !ok || rng.End.Line <= rng.Start.Line {
+			continue
+		}
+		mapped = append(mapped, protocol.FoldingRange{StartLine: rng.Start.Line, EndLine: rng.End.Line, Kind: fold.Kind})
+	}
+	return mapped
+}
+
+// importFoldingRanges folds the imports that the document starts with, the locals bound to imports.
+func importFoldingRanges(root ast.Node) []protocol.FoldingRange {
+	var start, end int
+	for local, ok := root.(*ast.Local); ok; local, ok = local.Body.(*ast.Local) {
+		for _, bind := range local.Binds {
+			switch bind.Body.(type) {
+			case *ast.Import, *ast.ImportStr, *ast.ImportBin:
+			default:
+				return importFoldingRange(start, end)
+			}
+			if start == 0 {
+				start = local.LocRange.Begin.Line
+			}
+			end = bind.Body.Loc().End.Line
+		}
+	}
+	return importFoldingRange(start, end)
+}
+
+func importFoldingRange(start, end int) []protocol.FoldingRange {
+	if start == 0 || end <= start {
+		return nil
+	}
+	return []protocol.FoldingRange{{StartLine: uint32(start - 1), EndLine: uint32(end - 1), Kind: string(protocol.Imports)}}
+}
+
+// regionMarkerRegexp matches the comments that start and end a region, `// region name` and `// endregion`.
+var regionMarkerRegexp = regexp.MustCompile(`^(?://|#)\s*#?(region|endregion)\b`)
+
+// commentFoldingRanges folds the block comments, the consecutive line comments, and the regions.
+func commentFoldingRanges(text string) []protocol.FoldingRange {
+	lines := scanLines(text)
+	var ranges []protocol.FoldingRange
+	fold := func(start, end int, kind protocol.FoldingRangeKind) {
+		if start >= 0 && end > start {
+			ranges = append(ranges, protocol.FoldingRange{StartLine: uint32(start), EndLine: uint32(end), Kind: string(kind)})
+		}
+	}
+
+	var regions []int
+	commentStart := -1
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		startsInCode := i == 0 || lines[i-1].end == scanCode
+		trimmed := strings.TrimLeft(line.text, " \t")
+		isComment := line.code && line.comment != -1 && strings.TrimSpace(line.text[:line.comment]) == ""
+		marker := regionMarkerRegexp.FindStringSubmatch(trimmed)
+		if !isComment || marker != nil {
+			fold(commentStart, i-1, protocol.Comment)
+			commentStart = -1
+		}
+
+		switch {
+		case isComment && marker != nil && marker[1] == "region":
+			regions = append(regions, i)
+		case isComment && marker != nil && len(regions) > 0:
+			fold(regions[len(regions)-1], i, protocol.Region)
+			regions = regions[:len(regions)-1]
+		case isComment && commentStart == -1:
+			commentStart = i
+		case startsInCode && strings.HasPrefix(trimmed, "/*") && line.end == scanBlockComment:
+			end := i + 1
+			for end < len(lines)-1 && lines[end].end == scanBlockComment {
+				end++
+			}
+			fold(i, end, protocol.Comment)
+			i = end
+		}
+	}
+	fold(commentStart, len(lines)-1, protocol.Comment)
+	return ranges
+}
+
+func sortFoldingRanges(ranges []protocol.FoldingRange) []protocol.FoldingRange {
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].StartLine < ranges[j].StartLine })
+	return ranges
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFoldingRange(t *testing.T) {
+	s, uri := testServerWithFile(t, nil, `{
+  a: {
+    b: 1,
+  },
+  c: [
+    1,
+  ],
+  d: |||
+    text
+  |||,
+  e: std.max(
+    1,
+    2,
+  ),
+  f: { g: 1 },
+}
+`)
+	ranges, err := s.FoldingRange(context.Background(), &protocol.FoldingRangeParams{TextDocument: protocol.TextDocumentIdentifier{URI: uri}})
+	require.NoError(t, err)
+	assert.Equal(t, []protocol.FoldingRange{
+		{StartLine: 0, EndLine: 14},
+		{StartLine: 1, EndLine: 2},
+		{StartLine: 4, EndLine: 5},
+		{StartLine: 7, EndLine: 9},
+		{StartLine: 10, EndLine: 12},
+	}, ranges)
+}
+
+func TestFoldingRange_Kinds(t *testing.T) {
+	s, uri := testServerWithFile(t, nil, `// The first comment
+// of the file
+local a = import 'a.libsonnet';
+local b = importstr 'b.txt';
+local c = 1;
+
+/*
+ * A block comment
+ */
+{
+  // region generated
+  a: a,
+  // region nested
+  b: b,
+  # endregion
+  c: c,
+  // endregion
+  /* one line */
+  d: '// region in a string',
+}
+`)
+	ranges, err := s.FoldingRange(context.Background(), &protocol.FoldingRangeParams{TextDocument: protocol.TextDocumentIdentifier{URI: uri}})
+	require.NoError(t, err)
+	assert.Equal(t, []protocol.FoldingRange{
+		{StartLine: 0, EndLine: 1, Kind: "comment"},
+		{StartLine: 2, EndLine: 3, Kind: "imports"},
+		{StartLine: 6, EndLine: 8, Kind: "comment"},
+		{StartLine: 9, EndLine: 18},
+		{StartLine: 10, EndLine: 16, Kind: "region"},
+		{StartLine: 12, EndLine: 14, Kind: "region"},
+	}, ranges)
+}
+
+func TestFoldingRange_Unparsable(t *testing.T) {
+	s, uri := testServerWithFile(t, nil, "// a\n// b\n{ a: ")
+	ranges, err := s.FoldingRange(context.Background(), &protocol.FoldingRangeParams{TextDocument: protocol.TextDocumentIdentifier{URI: uri}})
+	require.NoError(t, err)
+	assert.Equal(t, []protocol.FoldingRange{{StartLine: 0, EndLine: 1, Kind: "comment"}}, ranges)
+}
@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"strings"
 
 	"github.com/google/go-jsonnet/formatter"
 	"github.com/grafana/jsonnet-language-server/pkg/utils"
@@ -11,17 +12,63 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-func (s *Server) Formatting(_ context.Context, params *protocol.DocumentFormattingParams) ([]protocol.TextEdit, error) {
+// FormattingPasses are the options of the formatting setting that go-jsonnet's formatter doesn't have, the passes
+// that run on its output.
+type FormattingPasses struct {
+	// MaxLineLength is the length above which the argument lists and arrays of a line are split, one element per
+	// line. Zero disables the pass.
+	MaxLineLength int
+	// AlignFieldValues aligns the values of the consecutive one-line fields of objects
+	AlignFieldValues bool
+	// AlignComments aligns the trailing comments of consecutive lines
+	AlignComments bool
+	// TrailingNewline ends the files with a newline, and TrailingCommas ends the elements of multi-line objects and
+	// arrays with commas. go-jsonnet's formatter writes both, the options report the documents that lack them.
+	TrailingNewline bool
+	TrailingCommas  bool
+}
+
+// apply runs the enabled passes on formatted code, which is indented with indent spaces.
+func (p FormattingPasses) apply(text string, indent int) string {
+	if p.MaxLineLength > 0 {
+		text = reflowLongLines(text, p.MaxLineLength, indent)
+	}
+	if p.AlignFieldValues {
+		text = alignFieldValues(text)
+	}
+	if p.AlignComments {
+		text = alignComments(text)
+	}
+	if p.TrailingNewline && text != "" && !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	return text
+}
+
+// formatJsonnet formats a document with go-jsonnet's formatter, which panics on some of the documents it doesn't expect,
+// such as the ones that end with a comment without a newline.
+func formatJsonnet(filename, text string, options formatter.Options) (formatted string, err error) {
+	defer recoverJsonnetPanic("formatting "+filename, &err)
+	return formatter.Format(filename, text, options)
+}
+
+func (s *Server) Formatting(ctx context.Context, params *protocol.DocumentFormattingParams) ([]protocol.TextEdit, error) {
 	doc, err := s.cache.get(params.TextDocument.URI)
 	if err != nil {
 		return nil, utils.LogErrorf("Formatting: %s: %w", errorRetrievingDocument, err)
 	}
+	if doc.skipped != "" {
+		return nil, nil
+	}
 
-	formatted, err := formatter.Format(params.TextDocument.URI.SpanURI().Filename(), doc.item.Text, s.configuration.FormattingOptions)
+	filename := params.TextDocument.URI.SpanURI().Filename()
+	config := s.configurationFor(filename)
+	formatted, err := formatJsonnet(filename, doc.item.Text, config.FormattingOptions)
 	if err != nil {
-		log.Errorf("error formatting document: %v", err)
+		log.WithContext(ctx).Errorf("error formatting document: %v", err)
 		return nil, nil
 	}
+	formatted = config.FormattingPasses.apply(formatted, config.FormattingOptions.Indent)
 
 	return getTextEdits(doc.item.Text, formatted), nil
 }
@@ -0,0 +1,183 @@
+package server
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// fieldLineRegexp matches the lines that are a field, with its name and separator, and the start of its value.
+var fieldLineRegexp = regexp.MustCompile(`^(\s*)((?:[A-Za-z_][A-Za-z0-9_]*|'(?:[^'\\]|\\.)*'|"(?:[^"\\]|\\.)*")\+?:{1,3})[ \t]+(\S.*)$`)
+
+// scannedLine is a line of code, with what the scanner found about it.
+type scannedLine struct {
+	text string
+	// code is true when the line starts and ends outside of strings, text blocks and block comments
+	code bool
+	// comment is the offset of the line comment that ends the line, -1 if there isn't one
+	comment int
+	// end is what the line ends in: code, a string, a text block or a block comment
+	end scanState
+}
+
+type scanState int
+
+const (
+	scanCode scanState = iota
+	scanString
+	scanVerbatimString
+	scanTextBlock
+	scanBlockComment
+)
+
+// scanLines finds the lines whose whitespace can be changed, and their line comments.
+func scanLines(text string) []scannedLine {
+	lines := strings.Split(text, "\n")
+	scanned := make([]scannedLine, len(lines))
+	state := scanCode
+	var quote byte
+	for i, line := range lines {
+		scanned[i] = scannedLine{text: line, comment: -1}
+		startState := state
+		if state == scanTextBlock {
+			// A text block ends with a line that starts with |||
+			if !strings.HasPrefix(strings.TrimLeft(line, " \t"), "|||") {
+				scanned[i].end = state
+				continue
+			}
+			state = scanCode
+			line = strings.Replace(line, "|||", "   ", 1)
+		}
+
+	chars:
+		for j := 0; j < len(line); j++ {
+			c := line[j]
+			switch state {
+			case scanString:
+				if c == '\\' {
+					j++
+				} else if c == quote {
+					state = scanCode
+				}
+			case scanVerbatimString:
+				if c == quote {
+					if j+1 < len(line) && line[j+1] == quote {
+						j++
+					} else {
+						state = scanCode
+					}
+				}
+			case scanBlockComment:
+				if strings.HasPrefix(line[j:], "*/") {
+					state = scanCode
+					j++
+				}
+			case scanCode:
+				switch {
+				case c == '\'' || c == '"':
+					state, quote = scanString, c
+				case c == '@' && j+1 < len(line) && (line[j+1] == '\'' || line[j+1] == '"'):
+					state, quote = scanVerbatimString, line[j+1]
+					j++
+				case strings.HasPrefix(line[j:], "|||"):
+					state = scanTextBlock
+					break chars
+				case strings.HasPrefix(line[j:], "/*"):
+					state = scanBlockComment
+					j++
+				case c == '#' || strings.HasPrefix(line[j:], "//"):
+					scanned[i].comment = j
+					break chars
+				}
+			}
+		}
+		scanned[i].code = startState == scanCode && state == scanCode
+		scanned[i].end = state
+	}
+	return scanned
+}
+
+// alignFieldValues aligns the values of the consecutive one-line fields that have the same indentation.
+func alignFieldValues(text string) string {
+	lines := scanLines(text)
+	type field struct {
+		line                int
+		indent, name, value string
+	}
+	var run []field
+	flush := func() {
+		if len(run) > 1 {
+			width := 0
+			for _, f := range run {
+				width = max(width, utf8.RuneCountInString(f.indent+f.name))
+			}
+			for _, f := range run {
+				padding := strings.Repeat(" ", width-utf8.RuneCountInString(f.indent+f.name)+1)
+				lines[f.line].text = f.indent + f.name + padding + f.value
+			}
+		}
+		run = nil
+	}
+
+	for i, line := range lines {
+		match := fieldLineRegexp.FindStringSubmatch(line.text)
+		if !line.code || match == nil || opensBlock(line) {
+			flush()
+			continue
+		}
+		if len(run) > 0 && run[0].indent != match[1] {
+			flush()
+		}
+		run = append(run, field{line: i, indent: match[1], name: match[2], value: match[3]})
+	}
+	flush()
+	return joinScannedLines(lines)
+}
+
+// opensBlock tells whether the code of a line ends with an object, array or call that continues on the next lines.
+func opensBlock(line scannedLine) bool {
+	code := line.text
+	if line.comment >= 0 {
+		code = code[:line.comment]
+	}
+	code = strings.TrimRight(code, " \t")
+	return strings.HasSuffix(code, "{") || strings.HasSuffix(code, "[") || strings.HasSuffix(code, "(")
+}
+
+// alignComments aligns the line comments that end consecutive lines of code.
+func alignComments(text string) string {
+	lines := scanLines(text)
+	var run []int
+	flush := func() {
+		if len(run) > 1 {
+			width := 0
+			for _, i := range run {
+				width = max(width, utf8.RuneCountInString(strings.TrimRight(lines[i].text[:lines[i].comment], " \t")))
+			}
+			for _, i := range run {
+				code := strings.TrimRight(lines[i].text[:lines[i].comment], " \t")
+				padding := strings.Repeat(" ", width-utf8.RuneCountInString(code)+2)
+				lines[i].text = code + padding + lines[i].text[lines[i].comment:]
+			}
+		}
+		run = nil
+	}
+
+	for i, line := range lines {
+		if !line.code || line.comment <= 0 || strings.TrimSpace(line.text[:line.comment]) == "" {
+			flush()
+			continue
+		}
+		run = append(run, i)
+	}
+	flush()
+	return joinScannedLines(lines)
+}
+
+func joinScannedLines(lines []scannedLine) string {
+	texts := make([]string, len(lines))
+	for i, line := range lines {
+		texts[i] = line.text
+	}
+	return strings.Join(texts, "\n")
+}
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/google/go-jsonnet/formatter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormattingAlignment(t *testing.T) {
+	testCases := []struct {
+		name     string
+		passes   FormattingPasses
+		input    string
+		expected string
+	}{
+		{
+			name:   "disabled",
+			passes: FormattingPasses{},
+			input: `{
+  a: 1,
+  long_name: 2,  // comment
+  b: 3,  // other comment
+}
+`,
+			expected: `{
+  a: 1,
+  long_name: 2,  // comment
+  b: 3,  // other comment
+}
+`,
+		},
+		{
+			name:   "field values",
+			passes: FormattingPasses{AlignFieldValues: true},
+			input: `{
+  a: 1,
+  long_name:: 'two',
+  'quoted: key'+: [3],
+  "é": 4,
+  nested: {
+    x: 1,
+    yy: 2,
+  },
+  after_nested: 5,
+  c: 6,
+
+  d: 7,
+  ee: 8,
+}
+`,
+			expected: `{
+  a:              1,
+  long_name::     'two',
+  'quoted: key'+: [3],
+  "é":            4,
+  nested: {
+    x:  1,
+    yy: 2,
+  },
+  after_nested: 5,
+  c:            6,
+
+  d:  7,
+  ee: 8,
+}
+`,
+		},
+		{
+			name:   "comments",
+			passes: FormattingPasses{AlignComments: true},
+			input: `{
+  a: 1,  // one
+  long_name: 2,  # two
+  // standalone
+  b: 3,  // three
+  c: 'not // a comment',  // four
+}
+`,
+			expected: `{
+  a: 1,          // one
+  long_name: 2,  # two
+  // standalone
+  b: 3,                   // three
+  c: 'not // a comment',  // four
+}
+`,
+		},
+		{
+			name:   "field values and comments",
+			passes: FormattingPasses{AlignFieldValues: true, AlignComments: true},
+			input: `{
+  a: 1,  // one
+  long_name: 2,  // two
+}
+`,
+			expected: `{
+  a:         1,  // one
+  long_name: 2,  // two
+}
+`,
+		},
+		{
+			name:   "strings and text blocks are left alone",
+			passes: FormattingPasses{AlignFieldValues: true, AlignComments: true},
+			input: `{
+  a: 'multi
+b: line',
+  text: |||
+    x: 1,  // kept
+    long: 2,  // as is
+  |||,
+  verbatim: @'it''s
+yy: 1,  // still a string',
+  c: /* comment */ 1,
+  dd: 2,
+}
+`,
+			expected: `{
+  a: 'multi
+b: line',
+  text: |||
+    x: 1,  // kept
+    long: 2,  // as is
+  |||,
+  verbatim: @'it''s
+yy: 1,  // still a string',
+  c:  /* comment */ 1,
+  dd: 2,
+}
+`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.passes.apply(tc.input, 2))
+		})
+	}
+}
+
+func TestFormattingAlignment_FormatterOutput(t *testing.T) {
+	formatted, err := formatter.Format("test.jsonnet", `{a: 1, long_name: {b: 'x', cc: "y"}, d: [1, 2], e: 3, // trailing
+ffff: 4, # other
+g: {h: 5,
+}}`, formatter.DefaultOptions())
+	require.NoError(t, err)
+
+	aligned := FormattingPasses{AlignFieldValues: true, AlignComments: true}.apply(formatted, 2)
+	assert.Equal(t, `{
+  a:         1,
+  long_name: { b: 'x', cc: 'y' },
+  d:         [1, 2],
+  e:         3,  // trailing
+  ffff:      4,  // other
+  g: {
+    h: 5,
+  },
+}
+`, aligned)
+
+	// The aligned code formats back to the formatter's output
+	reformatted, err := formatter.Format("test.jsonnet", aligned, formatter.DefaultOptions())
+	require.NoError(t, err)
+	assert.Equal(t, formatted, reformatted)
+}
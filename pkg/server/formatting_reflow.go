@@ -0,0 +1,146 @@
+package server
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// reflowLongLines splits the argument lists and arrays of the lines that are longer than maxLength, one element per
+// line, until the lines fit or there is nothing left to split.
+func reflowLongLines(text string, maxLength, indent int) string {
+	if indent <= 0 {
+		indent = 2
+	}
+	var reflowed []string
+	for _, line := range scanLines(text) {
+		if !line.code || utf8.RuneCountInString(line.text) <= maxLength {
+			reflowed = append(reflowed, line.text)
+			continue
+		}
+		reflowed = append(reflowed, reflowLine(line.text, line.comment, maxLength, indent)...)
+	}
+	return strings.Join(reflowed, "\n")
+}
+
+// reflowLine splits the first argument list or array of a line, and then the lines that are still too long.
+func reflowLine(line string, comment, maxLength, indent int) []string {
+	code, trailing := line, ""
+	if comment >= 0 {
+		code, trailing = line[:comment], line[comment:]
+	}
+	code = strings.TrimRight(code, " \t")
+	list, ok := findSplittableList(code)
+	if !ok {
+		return []string{line}
+	}
+
+	lineIndent := code[:len(code)-len(strings.TrimLeft(code, " \t"))]
+	elementIndent := lineIndent + strings.Repeat(" ", indent)
+	reflowed := []string{code[:list.open+1]}
+	for _, element := range list.elements {
+		reflowed = append(reflowed, reflowLineIfLong(elementIndent+element+",", -1, maxLength, indent)...)
+	}
+	rest, restComment := lineIndent+code[list.close:], -1
+	if trailing != "" {
+		rest += "  "
+		rest, restComment = rest+trailing, len(rest)
+	}
+	return append(reflowed, reflowLineIfLong(rest, restComment, maxLength, indent)...)
+}
+
+func reflowLineIfLong(line string, comment, maxLength, indent int) []string {
+	if utf8.RuneCountInString(line) <= maxLength {
+		return []string{line}
+	}
+	return reflowLine(line, comment, maxLength, indent)
+}
+
+// splittableList is an argument list or an array, delimited by the offsets of its brackets.
+type splittableList struct {
+	open, close int
+	elements    []string
+}
+
+// findSplittableList returns the leftmost argument list or array of a line of code that has several elements.
+// Indexes, slices and comprehensions can't be split, their brackets don't contain commas or contain a `for`.
+func findSplittableList(code string) (splittableList, bool) {
+	type frame struct {
+		bracket byte
+		open    int
+		commas  []int
+		hasFor  bool
+	}
+	var stack []*frame
+	var found *splittableList
+	for i := 0; i < len(code); i++ {
+		c := code[i]
+		switch {
+		case c == '\'' || c == '"':
+			for i++; i < len(code) && code[i] != c; i++ {
+				if code[i] == '\\' {
+					i++
+				}
+			}
+		case c == '@' && i+1 < len(code) && (code[i+1] == '\'' || code[i+1] == '"'):
+			quote := code[i+1]
+			for i += 2; i < len(code); i++ {
+				if code[i] == quote {
+					if i+1 < len(code) && code[i+1] == quote {
+						i++
+						continue
+					}
+					break
+				}
+			}
+		case strings.HasPrefix(code[i:], "/*"):
+			end := strings.Index(code[i+2:], "*/")
+			if end < 0 {
+				return splittableList{}, false
+			}
+			i += end + 3
+		case c == '(' || c == '[' || c == '{':
+			stack = append(stack, &frame{bracket: c, open: i})
+		case c == ')' || c == ']' || c == '}':
+			if len(stack) == 0 {
+				continue
+			}
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if top.bracket == '{' || len(top.commas) == 0 || top.hasFor || (found != nil && found.open < top.open) {
+				continue
+			}
+			list := splittableList{open: top.open, close: i}
+			start := top.open + 1
+			for _, comma := range append(top.commas, i) {
+				if element := strings.TrimSpace(code[start:comma]); element != "" {
+					list.elements = append(list.elements, element)
+				}
+				start = comma + 1
+			}
+			found = &list
+		case c == ',' && len(stack) > 0:
+			top := stack[len(stack)-1]
+			top.commas = append(top.commas, i)
+		case isIdentifierStart(c):
+			start := i
+			for i+1 < len(code) && isIdentifierChar(code[i+1]) {
+				i++
+			}
+			if code[start:i+1] == "for" && len(stack) > 0 {
+				stack[len(stack)-1].hasFor = true
+			}
+		}
+	}
+	if found == nil {
+		return splittableList{}, false
+	}
+	return *found, true
+}
+
+func isIdentifierStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentifierChar(c byte) bool {
+	return isIdentifierStart(c) || (c >= '0' && c <= '9')
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/google/go-jsonnet/formatter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReflowLongLines(t *testing.T) {
+	testCases := []struct {
+		name      string
+		input     string
+		maxLength int
+		expected  string
+	}{
+		{
+			name:      "short lines are left alone",
+			input:     "local a = f(1, 2);\na\n",
+			maxLength: 20,
+			expected:  "local a = f(1, 2);\na\n",
+		},
+		{
+			name:      "arguments",
+			input:     "local a = std.join(',', ['first', 'second']);\na\n",
+			maxLength: 30,
+			expected: `local a = std.join(
+  ',',
+  ['first', 'second'],
+);
+a
+`,
+		},
+		{
+			name: "nested lists that are still too long",
+			input: `{
+  containers: [container.new('app', image), container.new('sidecar', sidecarImage)],  // comment
+}
+`,
+			maxLength: 40,
+			expected: `{
+  containers: [
+    container.new('app', image),
+    container.new(
+      'sidecar',
+      sidecarImage,
+    ),
+  ],  // comment
+}
+`,
+		},
+		{
+			name:      "the rest of the line",
+			input:     "f(aaaa, bbbb) + g(cccc, dddd)\n",
+			maxLength: 20,
+			expected: `f(
+  aaaa,
+  bbbb,
+) + g(cccc, dddd)
+`,
+		},
+		{
+			name:      "trailing comma",
+			input:     "f(aaaa, bbbb,)\n",
+			maxLength: 10,
+			expected:  "f(\n  aaaa,\n  bbbb,\n)\n",
+		},
+		{
+			name:      "comprehensions, slices and objects are not split",
+			input:     "local a = [x * 2 for x in std.range(1, 10)] + b[1:2] + { a: 1, b: 2 } + 'long, string';\na\n",
+			maxLength: 10,
+			expected:  "local a = [x * 2 for x in std.range(\n  1,\n  10,\n)] + b[1:2] + { a: 1, b: 2 } + 'long, string';\na\n",
+		},
+		{
+			name:      "strings and comments",
+			input:     "f('a, b', 'c\\n, d', @'e'', f', i)  // j, k\n",
+			maxLength: 10,
+			expected:  "f(\n  'a, b',\n  'c\\n, d',\n  @'e'', f',\n  i,\n)  // j, k\n",
+		},
+		{
+			name: "text blocks",
+			input: `{
+  a: |||
+    f(aaaa, bbbb, cccc, dddd, eeee)
+  |||,
+}
+`,
+			maxLength: 10,
+			expected: `{
+  a: |||
+    f(aaaa, bbbb, cccc, dddd, eeee)
+  |||,
+}
+`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			reflowed := FormattingPasses{MaxLineLength: tc.maxLength}.apply(tc.input, 2)
+			assert.Equal(t, tc.expected, reflowed)
+
+			// The formatter leaves the reflowed code as it is
+			formatted, err := formatter.Format("test.jsonnet", reflowed, formatter.DefaultOptions())
+			require.NoError(t, err)
+			assert.Equal(t, reflowed, formatted)
+		})
+	}
+}
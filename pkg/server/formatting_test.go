@@ -110,6 +110,40 @@ func TestFormatting(t *testing.T) {
 				{Range: makeRange(t, "4:0-4:0"), NewText: "}\n"},
 			},
 		},
+		{
+			name: "aligned field values",
+			settings: map[string]interface{}{
+				"formatting": map[string]interface{}{"AlignFieldValues": true},
+			},
+			fileContent: "{\n  a: 1,\n  bb: 2,\n}\n",
+			expected: []protocol.TextEdit{
+				{Range: makeRange(t, "1:0-2:0"), NewText: ""},
+				{Range: makeRange(t, "2:0-2:0"), NewText: "  a:  1,\n"},
+			},
+		},
+		{
+			name: "long lines and blank lines",
+			settings: map[string]interface{}{
+				"formatting": map[string]interface{}{"max_line_length": 15, "max_blank_lines": 1},
+			},
+			fileContent: "local a = 1;\n\n\n\nf(aaaa, bbbb, cccc)\n",
+			expected: []protocol.TextEdit{
+				{Range: makeRange(t, "2:0-3:0"), NewText: ""},
+				{Range: makeRange(t, "3:0-4:0"), NewText: ""},
+				{Range: makeRange(t, "4:0-5:0"), NewText: ""},
+				{Range: makeRange(t, "5:0-5:0"), NewText: "f(\n"},
+				{Range: makeRange(t, "5:0-5:0"), NewText: "  aaaa,\n"},
+				{Range: makeRange(t, "5:0-5:0"), NewText: "  bbbb,\n"},
+				{Range: makeRange(t, "5:0-5:0"), NewText: "  cccc,\n"},
+				{Range: makeRange(t, "5:0-5:0"), NewText: ")\n"},
+			},
+		},
+		{
+			// The formatter panics on it
+			name:        "comment without a newline at the end",
+			fileContent: "l#",
+			expected:    nil,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-jsonnet/formatter"
+	"github.com/grafana/jsonnet-language-server/pkg/stdlib"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+// The fuzz targets feed arbitrary text to the handlers that parse documents and walk their ASTs. Whatever the text,
+// they must not panic. The documents aren't evaluated, as arbitrary code doesn't always terminate.
+//
+//	go test ./pkg/server -run '^$' -fuzz FuzzDefinition -fuzztime 1m
+
+// fuzzServer returns a server whose documents are found in testdata, and the URI of the fuzzed document.
+func fuzzServer(f *testing.F) (*Server, protocol.DocumentURI) {
+	f.Helper()
+	level := log.GetLevel()
+	log.SetLevel(log.PanicLevel)
+	f.Cleanup(func() { log.SetLevel(level) })
+	functions, err := stdlib.Functions()
+	require.NoError(f, err)
+	testdata, err := filepath.Abs("testdata")
+	require.NoError(f, err)
+
+	s := NewServer("any", "test version", nil, Configuration{JPaths: []string{testdata}, FormattingOptions: formatter.DefaultOptions()})
+	s.stdlib = functions
+	return s, protocol.URIFromPath(filepath.Join(testdata, "fuzz.jsonnet"))
+}
+
+// addSeeds adds the Jsonnet files of testdata to the corpus of the fuzz target, along with snippets of the shapes that
+// are easy to get wrong.
+func addSeeds(f *testing.F, add func(text string)) {
+	f.Helper()
+	for _, text := range []string{
+		"",
+		"{",
+		"local a = ; a",
+		"{ a: 1 }.b",
+		"[x for x in [1, 2] if x > 1]",
+		"{ [k]: 1 for k in ['a'] }",
+		"function(a, b=1) a + b",
+		"local f(x) = x; f(1)(2)",
+		"$.a",
+		"self",
+		"super.a",
+		"import 'goto-basic-object.jsonnet'",
+		"(import 'goto-basic-object.jsonnet').foo.bar",
+		"importbin 'missing'",
+		"assert false; {}",
+		"std.map(function(x) x, [1])",
+		"{ a+: { b: 1 } } + { a+: { c: 2 } }",
+		"'%s' % []",
+	} {
+		add(text)
+	}
+	files, err := filepath.Glob(filepath.Join("testdata", "*.*sonnet"))
+	require.NoError(f, err)
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		require.NoError(f, err)
+		add(string(content))
+	}
+}
+
+// fuzzTimeout is how long a handler can take on an input before it is considered stuck.
+const fuzzTimeout = 10 * time.Second
+
+// withinTimeout fails the fuzzed input if the handlers don't return in time, as the fuzzing engine doesn't report hangs.
+func withinTimeout(t *testing.T, handlers func()) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handlers()
+	}()
+	select {
+	case <-done:
+	case <-time.After(fuzzTimeout):
+		t.Fatalf("the handlers didn't return after %s", fuzzTimeout)
+	}
+}
+
+// fuzzVersion is the version of the fuzzed document, the documents of the previous inputs are replaced by newer versions.
+var fuzzVersion atomic.Int32
+
+func fuzzOpen(t *testing.T, s *Server, uri protocol.DocumentURI, text string) {
+	require.NoError(t, s.DidOpen(context.Background(), &protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{URI: uri, Text: text, Version: fuzzVersion.Add(1)},
+	}))
+}
+
+func FuzzDidOpen(f *testing.F) {
+	s, uri := fuzzServer(f)
+	addSeeds(f, func(text string) { f.Add(text) })
+	f.Fuzz(func(t *testing.T, text string) {
+		fuzzOpen(t, s, uri, text)
+		_, _ = s.DocumentSymbol(context.Background(), &protocol.DocumentSymbolParams{TextDocument: protocol.TextDocumentIdentifier{URI: uri}})
+		_, _ = s.FoldingRange(context.Background(), &protocol.FoldingRangeParams{TextDocument: protocol.TextDocumentIdentifier{URI: uri}})
+	})
+}
+
+func FuzzDidChange(f *testing.F) {
+	s, uri := fuzzServer(f)
+	// The edits break a valid document, and fix it
+	addSeeds(f, func(text string) {
+		f.Add(text, strings.Replace(text, "}", "", 1))
+		f.Add(strings.Replace(text, ":", "", 1), text)
+	})
+	f.Fuzz(func(t *testing.T, text, edited string) {
+		fuzzOpen(t, s, uri, text)
+		require.NoError(t, s.DidChange(context.Background(), &protocol.DidChangeTextDocumentParams{
+			TextDocument:   protocol.VersionedTextDocumentIdentifier{Version: fuzzVersion.Add(1), TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: uri}},
+			ContentChanges: []protocol.TextDocumentContentChangeEvent{{Text: edited}},
+		}))
+		_, _ = s.DocumentSymbol(context.Background(), &protocol.DocumentSymbolParams{TextDocument: protocol.TextDocumentIdentifier{URI: uri}})
+	})
+}
+
+func FuzzFormatting(f *testing.F) {
+	s, uri := fuzzServer(f)
+	addSeeds(f, func(text string) { f.Add(text) })
+	f.Fuzz(func(t *testing.T, text string) {
+		fuzzOpen(t, s, uri, text)
+		_, _ = s.Formatting(context.Background(), &protocol.DocumentFormattingParams{TextDocument: protocol.TextDocumentIdentifier{URI: uri}})
+	})
+}
+
+func FuzzDefinition(f *testing.F) {
+	s, uri := fuzzServer(f)
+	// Each seed is looked up at a few positions: the start, a name and past the end
+	addSeeds(f, func(text string) {
+		f.Add(text, uint32(0), uint32(0))
+		f.Add(text, uint32(0), uint32(7))
+		f.Add(text, uint32(1), uint32(3))
+		f.Add(text, uint32(100), uint32(100))
+	})
+	f.Fuzz(func(t *testing.T, text string, line, character uint32) {
+		position := protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     protocol.Position{Line: line, Character: character},
+		}
+		withinTimeout(t, func() {
+			fuzzOpen(t, s, uri, text)
+			_, _ = s.Definition(context.Background(), &protocol.DefinitionParams{TextDocumentPositionParams: position})
+			_, _ = s.Hover(context.Background(), &protocol.HoverParams{TextDocumentPositionParams: position})
+			_, _ = s.SignatureHelp(context.Background(), &protocol.SignatureHelpParams{TextDocumentPositionParams: position})
+		})
+	})
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+)
+
+// generatedDocs is the result of jsonnet.generateDocs: the API reference of a library, and the file that it is written
+// to, if any.
+type generatedDocs struct {
+	Markdown string               `json:"markdown"`
+	URI      protocol.DocumentURI `json:"uri,omitempty"`
+}
+
+// generateDocs renders the API reference of a library, from its export summary and its docsonnet fields. The arguments
+// are the library's file name, and where the reference goes: "markdown" returns it for the client to show in a
+// virtual document, "file" writes it to the docs directory of the workspace, at the library's path.
+func (s *Server) generateDocs(ctx context.Context, params *protocol.ExecuteCommandParams) (interface{}, error) {
+	args := params.Arguments
+	if len(args) < 1 || len(args) > 2 {
+		return nil, fmt.Errorf("expected 1 or 2 arguments, got %d", len(args))
+	}
+	var fileName string
+	if err := json.Unmarshal(args[0], &fileName); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal file name: %v", err)
+	}
+	output := "markdown"
+	if len(args) == 2 {
+		if err := json.Unmarshal(args[1], &output); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal output: %v", err)
+		}
+	}
+	if output != "markdown" && output != "file" {
+		return nil, fmt.Errorf("unknown output %q, expected markdown or file", output)
+	}
+
+	exports, ok := s.exportSummaryOf(fileName)
+	if !ok {
+		return nil, fmt.Errorf("the API of %s can't be read", fileName)
+	}
+	title := strings.TrimSuffix(filepath.Base(fileName), filepath.Ext(fileName))
+	docs := generatedDocs{Markdown: renderAPIReference(title, exports)}
+	if output == "markdown" {
+		return docs, nil
+	}
+
+	if s.workspaceFolder == "" {
+		return nil, fmt.Errorf("the docs of a library can't be written without a workspace folder")
+	}
+	rel, err := filepath.Rel(s.workspaceFolder, fileName)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("%s isn't in the workspace", fileName)
+	}
+	docsName := filepath.Join(s.workspaceFolder, "docs", strings.TrimSuffix(rel, filepath.Ext(rel))+".md")
+	docs.URI = protocol.URIFromPath(docsName)
+
+	// The docs that were generated before are replaced
+	var changes []interface{}
+	replaced := protocol.Range{}
+	if _, err := os.Stat(docsName); err == nil {
+		replaced = documentRange(s.readWorkspaceFile(docsName))
+	} else {
+		changes = append(changes, protocol.CreateFile{Kind: "create", URI: docs.URI})
+	}
+	changes = append(changes, s.textDocumentEdit(docs.URI, []protocol.TextEdit{{Range: replaced, NewText: docs.Markdown}}))
+	if err := s.applyResourceEdit(ctx, fmt.Sprintf("Generate the docs of %s", filepath.Base(fileName)), changes, nil); err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+// renderAPIReference renders the export summary of a library as Markdown: a section for each of its fields, nested
+// fields included, named by their path.
+func renderAPIReference(title string, exports *exportedValue) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n", title)
+	if exports.Doc != "" {
+		fmt.Fprintf(&b, "\n%s\n", exports.Doc)
+	}
+	switch exports.Kind {
+	case "function":
+		fmt.Fprintf(&b, "\n```jsonnet\n%s(%s)\n```\n", title, strings.Join(exports.Params, ", "))
+	case "object":
+		if len(exports.Fields) > 0 {
+			b.WriteString("\n## Fields\n")
+			renderAPIFields(&b, "", exports.Fields)
+		}
+	}
+	return b.String()
+}
+
+func renderAPIFields(b *strings.Builder, prefix string, fields []exportedValue) {
+	for _, field := range fields {
+		path := prefix + field.Name
+		switch field.Kind {
+		case "function":
+			fmt.Fprintf(b, "\n### `%s(%s)`\n", path, strings.Join(field.Params, ", "))
+		default:
+			fmt.Fprintf(b, "\n### `%s`\n", path)
+		}
+		var details []string
+		switch {
+		case field.Type != "":
+			details = append(details, fmt.Sprintf("type: `%s`", field.Type))
+		case field.Kind == "import":
+			details = append(details, fmt.Sprintf("imports `%s`", field.Import))
+		}
+		if field.Doc != "" {
+			details = append(details, field.Doc)
+		}
+		for _, detail := range details {
+			fmt.Fprintf(b, "\n%s\n", detail)
+		}
+		renderAPIFields(b, path+".", field.Fields)
+	}
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const generatedDocsLibrary = `local d = import 'doc-util/main.libsonnet';
+{
+  '#': d.pkg(name='deployment', url='github.com/example/deployment', help='deployment builds deployments.'),
+
+  '#new': d.fn('new creates a deployment.', [d.arg('name', d.T.string)]),
+  new(name):: { name: name },
+
+  '#replicas': d.val(d.T.number, help='replicas is the default number of replicas.'),
+  replicas: 1,
+
+  spec: {
+    // withImage sets the image.
+    withImage(image):: { image: image },
+  },
+
+  util: import 'util.libsonnet',
+}
+`
+
+const generatedDocsMarkdown = "# deployment\n" +
+	"\ndeployment builds deployments.\n" +
+	"\n## Fields\n" +
+	"\n### `new(name)`\n\nnew creates a deployment.\n" +
+	"\n### `replicas`\n\ntype: `number`\n\nreplicas is the default number of replicas.\n" +
+	"\n### `spec`\n" +
+	"\n### `spec.withImage(image)`\n\nwithImage sets the image.\n" +
+	"\n### `util`\n\nimports `util.libsonnet`\n"
+
+func generateDocsCommand(t *testing.T, args ...string) *protocol.ExecuteCommandParams {
+	t.Helper()
+	params := &protocol.ExecuteCommandParams{Command: "jsonnet.generateDocs"}
+	for _, arg := range args {
+		raw, err := json.Marshal(arg)
+		require.NoError(t, err)
+		params.Arguments = append(params.Arguments, raw)
+	}
+	return params
+}
+
+func TestGenerateDocs(t *testing.T) {
+	testCases := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{
+			name:     "docsonnet library",
+			content:  generatedDocsLibrary,
+			expected: generatedDocsMarkdown,
+		},
+		{
+			name:     "function",
+			content:  "function(name, replicas=1) { name: name }\n",
+			expected: "# deployment\n\n```jsonnet\ndeployment(name, replicas)\n```\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			root := writeProjectFiles(t, map[string]string{"lib/deployment.libsonnet": tc.content})
+			s := renameTestServer(t, root, nil)
+
+			result, err := s.ExecuteCommand(context.Background(), generateDocsCommand(t, filepath.Join(root, "lib/deployment.libsonnet")))
+			require.NoError(t, err)
+			assert.Equal(t, generatedDocs{Markdown: tc.expected}, result)
+		})
+	}
+}
+
+func TestGenerateDocs_File(t *testing.T) {
+	root := writeProjectFiles(t, map[string]string{"lib/deployment.libsonnet": generatedDocsLibrary})
+	caller := &applyingCaller{applied: true}
+	s := renameTestServer(t, root, caller)
+	library := filepath.Join(root, "lib/deployment.libsonnet")
+	uri := protocol.URIFromPath(filepath.Join(root, "docs/lib/deployment.md"))
+
+	result, err := s.ExecuteCommand(context.Background(), generateDocsCommand(t, library, "file"))
+	require.NoError(t, err)
+	assert.Equal(t, generatedDocs{Markdown: generatedDocsMarkdown, URI: uri}, result)
+	assert.Equal(t, "workspace/applyEdit", caller.method)
+	var params struct {
+		Edit struct {
+			DocumentChanges []json.RawMessage `json:"documentChanges"`
+		} `json:"edit"`
+	}
+	require.NoError(t, json.Unmarshal(caller.params, &params))
+	require.Len(t, params.Edit.DocumentChanges, 2)
+	var create protocol.CreateFile
+	require.NoError(t, json.Unmarshal(params.Edit.DocumentChanges[0], &create))
+	assert.Equal(t, uri, create.URI)
+	var edit resourceTextDocumentEdit
+	require.NoError(t, json.Unmarshal(params.Edit.DocumentChanges[1], &edit))
+	assert.Equal(t, generatedDocsMarkdown, applyTextEdits(t, "", edit.Edits))
+
+	// Without a client that creates files, the server writes them, and replaces the docs generated before
+	s.resourceOperations = nil
+	for i := 0; i < 2; i++ {
+		_, err = s.ExecuteCommand(context.Background(), generateDocsCommand(t, library, "file"))
+		require.NoError(t, err)
+		content, err := os.ReadFile(filepath.Join(root, "docs/lib/deployment.md"))
+		require.NoError(t, err)
+		assert.Equal(t, generatedDocsMarkdown, string(content))
+	}
+
+	_, err = s.ExecuteCommand(context.Background(), generateDocsCommand(t, library, "html"))
+	assert.EqualError(t, err, `unknown output "html", expected markdown or file`)
+	_, err = s.ExecuteCommand(context.Background(), generateDocsCommand(t, filepath.Join(t.TempDir(), "other.libsonnet"), "file"))
+	assert.Error(t, err)
+}
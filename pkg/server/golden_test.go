@@ -0,0 +1,96 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var updateGolden = flag.Bool("update-golden", false, "write the symbols and diagnostics of testdata/golden to their golden files")
+
+// goldenOutput is what the analysis of a file of the corpus returns, as it is checked in.
+type goldenOutput struct {
+	Symbols     []protocol.DocumentSymbol `json:"symbols"`
+	Diagnostics []protocol.Diagnostic     `json:"diagnostics"`
+}
+
+// TestGolden compares the symbols and diagnostics of the files of testdata/golden, without their vendored libraries,
+// to the golden files next to them. A change of the analysis shows up as a diff of the golden files, once they are
+// updated with -update-golden.
+func TestGolden(t *testing.T) {
+	testdata, err := filepath.Abs("testdata")
+	require.NoError(t, err)
+	root := filepath.Join(testdata, "golden")
+	paths := strings.NewReplacer(string(protocol.URIFromPath(testdata)), sessionRoot, testdata, sessionRootPath)
+
+	var files []string
+	require.NoError(t, filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if entry.IsDir() && entry.Name() == "vendor" {
+			return filepath.SkipDir
+		}
+		if ext := filepath.Ext(path); ext == ".jsonnet" || ext == ".libsonnet" {
+			files = append(files, path)
+		}
+		return err
+	}))
+	require.NotEmpty(t, files)
+
+	for _, file := range files {
+		name, _ := filepath.Rel(root, file)
+		t.Run(name, func(t *testing.T) {
+			s := testServer(t, nil)
+			setConfiguration(s, func(c *Configuration) {
+				c.JPaths = []string{filepath.Join(root, "vendor"), root}
+				c.EnableEvalDiagnostics = true
+				c.EnableLintDiagnostics = true
+			})
+			uri := serverOpenTestFile(t, s, file)
+			doc, err := s.cache.get(uri)
+			require.NoError(t, err)
+
+			symbols, err := s.DocumentSymbol(context.Background(), &protocol.DocumentSymbolParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			})
+			require.NoError(t, err)
+			output := goldenOutput{Symbols: []protocol.DocumentSymbol{}, Diagnostics: []protocol.Diagnostic{}}
+			for _, symbol := range symbols {
+				output.Symbols = append(output.Symbols, symbol.(protocol.DocumentSymbol))
+			}
+			diags := append(s.getEvalDiags(context.Background(), doc), s.getLintDiags(context.Background(), doc)...)
+			output.Diagnostics = append(output.Diagnostics, filterSuppressedDiagnostics(doc.item.Text, diags)...)
+			sort.SliceStable(output.Diagnostics, func(i, j int) bool {
+				a, b := output.Diagnostics[i], output.Diagnostics[j]
+				if a.Range.Start != b.Range.Start {
+					return a.Range.Start.Line < b.Range.Start.Line ||
+						(a.Range.Start.Line == b.Range.Start.Line && a.Range.Start.Character < b.Range.Start.Character)
+				}
+				return a.Message < b.Message
+			})
+
+			var actual bytes.Buffer
+			encoder := json.NewEncoder(&actual)
+			encoder.SetEscapeHTML(false)
+			encoder.SetIndent("", "  ")
+			require.NoError(t, encoder.Encode(output))
+			golden := strings.TrimSuffix(file, filepath.Ext(file)) + ".golden.json"
+			if *updateGolden {
+				require.NoError(t, os.WriteFile(golden, []byte(paths.Replace(actual.String())), 0o600))
+				return
+			}
+			expected, err := os.ReadFile(golden)
+			require.NoError(t, err, "the golden file is written by go test -run TestGolden -update-golden")
+			assert.Equal(t, string(expected), paths.Replace(actual.String()))
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+)
+
+// HeadlessChecker lints and formats files out of the editor, for the lint and fmt subcommands. The files are read
+// through the server's file cache and checked with the server's configuration, like the open documents. Each run only
+// checks the files that changed since the previous one, so that a watch loop re-checks the files as they are saved.
+type HeadlessChecker struct {
+	server *Server
+	// checked are the files at their last check
+	checked map[string]fileStamp
+}
+
+// fileStamp identifies a version of a file, the file cache reads it again when they change.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewHeadlessChecker returns a checker that lints and formats files like the server.
+func NewHeadlessChecker(s *Server) *HeadlessChecker {
+	return &HeadlessChecker{server: s, checked: map[string]fileStamp{}}
+}
+
+// Lint writes the problems of the Jsonnet files of the paths, files or directories, that changed since the previous
+// run. It returns the number of files checked, and the number of errors and warnings found.
+func (c *HeadlessChecker) Lint(ctx context.Context, w io.Writer, paths []string) (checked, problems int, err error) {
+	return c.run(paths, func(path, absPath, text string) (string, int) {
+		doc := c.server.newDocument(ctx, protocol.TextDocumentItem{URI: protocol.URIFromPath(absPath), Text: text, LanguageID: "jsonnet"})
+		if doc.skipped != "" {
+			fmt.Fprintf(w, "%s: skipped: %s\n", path, doc.skipped)
+			return text, 0
+		}
+		diags := c.server.getEvalDiags(ctx, doc)
+		if doc.err == nil {
+			diags = append(diags, c.server.getLintDiags(ctx, doc)...)
+		}
+		diags = filterSuppressedDiagnostics(text, diags)
+		sort.SliceStable(diags, func(i, j int) bool {
+			a, b := diags[i].Range.Start, diags[j].Range.Start
+			return a.Line < b.Line || (a.Line == b.Line && a.Character < b.Character)
+		})
+		problems := 0
+		for _, diag := range diags {
+			fmt.Fprintf(w, "%s:%d:%d: %s: %s\n", path, diag.Range.Start.Line+1, diag.Range.Start.Character+1, severityName(diag.Severity), strings.ReplaceAll(diag.Message, "\n", " "))
+			if diag.Severity == protocol.SeverityError || diag.Severity == protocol.SeverityWarning {
+				problems++
+			}
+		}
+		return text, problems
+	})
+}
+
+// Format formats in place the Jsonnet files of the paths that changed since the previous run, and writes the names of
+// those it changed. It returns the number of files checked, and the number of files that couldn't be formatted.
+func (c *HeadlessChecker) Format(_ context.Context, w io.Writer, paths []string) (checked, problems int, err error) {
+	return c.run(paths, func(path, absPath, text string) (string, int) {
+		config := c.server.configurationFor(absPath)
+		formatted, err := formatJsonnet(absPath, text, config.FormattingOptions)
+		if err != nil {
+			fmt.Fprintf(w, "%s: error: %s\n", path, strings.ReplaceAll(err.Error(), "\n", " "))
+			return text, 1
+		}
+		formatted = config.FormattingPasses.apply(formatted, config.FormattingOptions.Indent)
+		if formatted != text {
+			fmt.Fprintln(w, path)
+		}
+		return formatted, 0
+	})
+}
+
+// run checks the files that changed with check, which returns the new text of a file and its number of problems. The
+// files whose text changes are written. The files are named as they were found in the paths, and they are read by
+// their absolute path, like the imports.
+func (c *HeadlessChecker) run(paths []string, check func(path, absPath, text string) (string, int)) (checked, problems int, err error) {
+	files, err := jsonnetFiles(paths)
+	if err != nil {
+		return 0, 0, err
+	}
+	for path := range c.checked {
+		if _, ok := files[path]; !ok {
+			// The file was removed
+			delete(c.checked, path)
+			if absPath, err := filepath.Abs(path); err == nil {
+				c.server.files.forget(absPath)
+			}
+		}
+	}
+
+	for _, path := range sortedPaths(files) {
+		if stamp, ok := c.checked[path]; ok && stamp == files[path] {
+			continue
+		}
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return checked, problems, err
+		}
+		contents, err := c.server.files.read(absPath)
+		if err != nil {
+			return checked, problems, err
+		}
+		if contents == nil {
+			// The file was removed since it was listed
+			continue
+		}
+		checked++
+		text := contents.String()
+		newText, fileProblems := check(path, absPath, text)
+		problems += fileProblems
+		if newText != text {
+			if err := os.WriteFile(path, []byte(newText), 0o666); err != nil {
+				return checked, problems, err
+			}
+		}
+		// The file is checked again once it changes, the writes of the check included
+		info, err := os.Stat(path)
+		if err != nil {
+			return checked, problems, err
+		}
+		c.checked[path] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+	}
+	return checked, problems, nil
+}
+
+// jsonnetFiles returns the Jsonnet files of paths, files or directories, with their stamps. The vendored and the
+// hidden directories are left out of the directories, the files are always included.
+func jsonnetFiles(paths []string) (map[string]fileStamp, error) {
+	files := map[string]fileStamp{}
+	for _, root := range paths {
+		err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() {
+				if path != root && (entry.Name() == "vendor" || strings.HasPrefix(entry.Name(), ".")) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if ext := filepath.Ext(path); path != root && ext != ".jsonnet" && ext != ".libsonnet" {
+				return nil
+			}
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			files[path] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+func sortedPaths(files map[string]fileStamp) []string {
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func severityName(severity protocol.DiagnosticSeverity) string {
+	switch severity {
+	case protocol.SeverityError:
+		return "error"
+	case protocol.SeverityWarning:
+		return "warning"
+	case protocol.SeverityInformation:
+		return "info"
+	default:
+		return "hint"
+	}
+}
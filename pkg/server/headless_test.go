@@ -0,0 +1,103 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-jsonnet/formatter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeadlessChecker_Lint(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string, modified time.Time) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o700))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		require.NoError(t, os.Chtimes(path, modified, modified))
+		return path
+	}
+	before := time.Now().Add(-time.Hour)
+	main := write("main.jsonnet", "local lib = import 'lib.libsonnet';\nlocal unused = 1;\nlib.a\n", before)
+	lib := write("lib.libsonnet", "{ a: 1 }\n", before)
+	write("vendor/ignored.jsonnet", "local unused = 1;\n{}\n", before)
+	write("README.md", "local\n", before)
+	checker := NewHeadlessChecker(NewServer("any", "test version", nil, Configuration{}))
+	lint := func() (string, int, int) {
+		var output bytes.Buffer
+		checked, problems, err := checker.Lint(context.Background(), &output, []string{dir})
+		require.NoError(t, err)
+		return output.String(), checked, problems
+	}
+
+	// The Jsonnet files are linted, the vendored ones aren't
+	output, checked, problems := lint()
+	assert.Equal(t, main+":2:7: warning: Unused variable: unused\n", output)
+	assert.Equal(t, 2, checked)
+	assert.Equal(t, 1, problems)
+
+	// The files that didn't change aren't linted again
+	output, checked, _ = lint()
+	assert.Empty(t, output)
+	assert.Zero(t, checked)
+
+	// Only the files that changed are
+	write("lib.libsonnet", "{ a: 2 }\n", time.Now())
+	output, checked, problems = lint()
+	assert.Empty(t, output)
+	assert.Equal(t, 1, checked)
+	assert.Zero(t, problems)
+
+	write("main.jsonnet", "local lib = import 'lib.libsonnet';\nlib.a +\n", time.Now())
+	output, checked, problems = lint()
+	assert.Contains(t, output, main+":3:1: error: ")
+	assert.Equal(t, 1, checked)
+	assert.Equal(t, 1, problems)
+
+	// The removed files are forgotten, and checked again if they come back
+	require.NoError(t, os.Remove(lib))
+	_, checked, _ = lint()
+	assert.Zero(t, checked)
+	write("lib.libsonnet", "{ a: 2 }\n", time.Now())
+	_, checked, _ = lint()
+	assert.Equal(t, 1, checked)
+
+	_, _, err := checker.Lint(context.Background(), &bytes.Buffer{}, []string{filepath.Join(dir, "missing")})
+	assert.Error(t, err)
+}
+
+func TestHeadlessChecker_Format(t *testing.T) {
+	dir := t.TempDir()
+	unformatted := filepath.Join(dir, "unformatted.jsonnet")
+	require.NoError(t, os.WriteFile(unformatted, []byte("{a:1,   b: \"two\"}"), 0o600))
+	formatted := filepath.Join(dir, "formatted.libsonnet")
+	require.NoError(t, os.WriteFile(formatted, []byte("{ a: 1 }\n"), 0o600))
+	invalid := filepath.Join(dir, "invalid.jsonnet")
+	require.NoError(t, os.WriteFile(invalid, []byte("{ a: }\n"), 0o600))
+	checker := NewHeadlessChecker(NewServer("any", "test version", nil, Configuration{FormattingOptions: formatter.DefaultOptions()}))
+
+	// The files that aren't formatted are rewritten
+	var output bytes.Buffer
+	checked, problems, err := checker.Format(context.Background(), &output, []string{dir})
+	require.NoError(t, err)
+	assert.Equal(t, 3, checked)
+	assert.Equal(t, 1, problems)
+	assert.Contains(t, output.String(), invalid+": error: ")
+	assert.Contains(t, output.String(), unformatted+"\n")
+	assert.NotContains(t, output.String(), formatted)
+	content, err := os.ReadFile(unformatted)
+	require.NoError(t, err)
+	assert.Equal(t, "{ a: 1, b: 'two' }\n", string(content))
+
+	// Their writes aren't changes to check again
+	output.Reset()
+	checked, _, err = checker.Format(context.Background(), &output, []string{dir})
+	require.NoError(t, err)
+	assert.Zero(t, checked)
+	assert.Empty(t, output.String())
+}
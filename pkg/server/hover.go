@@ -8,20 +8,24 @@ import (
 	"github.com/google/go-jsonnet/ast"
 	"github.com/grafana/jsonnet-language-server/pkg/ast/processing"
 	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
+	"github.com/grafana/jsonnet-language-server/pkg/stdlib"
 	"github.com/grafana/jsonnet-language-server/pkg/utils"
 	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
 	log "github.com/sirupsen/logrus"
 )
 
-func (s *Server) Hover(_ context.Context, params *protocol.HoverParams) (*protocol.Hover, error) {
-	doc, err := s.cache.get(params.TextDocument.URI)
-	if err != nil {
-		return nil, utils.LogErrorf("Hover: %s: %w", errorRetrievingDocument, err)
-	}
+func (s *Server) Hover(ctx context.Context, params *protocol.HoverParams) (*protocol.Hover, error) {
+	return onLatestDocument(s, "Hover", params.TextDocument.URI, func(doc *document) (*protocol.Hover, error) {
+		hover, err := s.hover(ctx, doc, params)
+		return s.renderHover(hover), err
+	})
+}
 
-	if doc.err != nil {
+func (s *Server) hover(ctx context.Context, doc *document, params *protocol.HoverParams) (*protocol.Hover, error) {
+	// A recovered AST is good for the lines that haven't changed
+	if doc.ast == nil || (doc.err != nil && !doc.recovered) || doc.linesChangedSinceAST[int(params.Position.Line)] {
 		// Hover triggers often. Throwing an error on each request is noisy
-		log.Errorf("Hover: %s", errorParsingDocument)
+		log.WithContext(ctx).Errorf("Hover: %s", errorParsingDocument)
 		return nil, nil
 	}
 
@@ -31,12 +35,19 @@ func (s *Server) Hover(_ context.Context, params *protocol.HoverParams) (*protoc
 	}
 
 	if stack.IsEmpty() {
-		log.Debug("Hover: empty stack")
+		log.WithContext(ctx).Debug("Hover: empty stack")
 		return nil, nil
 	}
 
 	node := stack.Peek()
 
+	if importBin, ok := node.(*ast.ImportBin); ok {
+		return s.hoverImportBin(importBin, doc.item.URI.SpanURI().Filename()), nil
+	}
+	if hover := s.hoverNativeFunction(doc.item.URI.SpanURI().Filename(), stack); hover != nil {
+		return hover, nil
+	}
+
 	_, isIndex := node.(*ast.Index)
 	_, isVar := node.(*ast.Var)
 	lineIndex := uint32(node.Loc().Begin.Line) - 1
@@ -48,38 +59,56 @@ func (s *Server) Hover(_ context.Context, params *protocol.HoverParams) (*protoc
 			functionName := utils.FirstWord(line[functionNameIndex:])
 			functionName = strings.TrimSpace(functionName)
 
-			for _, function := range s.stdlib {
-				if function.Name == functionName {
-					return &protocol.Hover{
-						Range: protocol.Range{
-							Start: protocol.Position{Line: lineIndex, Character: startIndex},
-							End:   protocol.Position{Line: lineIndex, Character: functionNameIndex + uint32(len(functionName))}},
-						Contents: protocol.MarkupContent{
-							Kind:  protocol.Markdown,
-							Value: fmt.Sprintf("`%s`\n\n%s", function.Signature(), function.MarkdownDescription),
-						},
-					}, nil
-				}
+			if function, ok := s.stdFunction(functionName); ok {
+				return stdFunctionHover(function, protocol.Range{
+					Start: protocol.Position{Line: lineIndex, Character: startIndex},
+					End:   protocol.Position{Line: lineIndex, Character: functionNameIndex + uint32(len(functionName))},
+				}), nil
 			}
 		}
 	}
+	// A local or a field that is an alias of a std function has its documentation
+	if function, ok := s.stdAliasAt(ctx, doc, stack, position.ProtocolToAST(params.Position)); ok {
+		return stdFunctionHover(function, position.RangeASTToProtocol(*node.Loc())), nil
+	}
+
+	// The inferred type, and the value, are shown even if the definition can't be found
+	verbosity := s.config().hoverVerbosity()
+	contentBuilder := strings.Builder{}
+	if t := s.hoverType(ctx, doc, stack, position.ProtocolToAST(params.Position)); t != nil {
+		contentBuilder.WriteString(typeHoverContent(t))
+	}
+	var valueContent string
+	if verbosity == hoverVerbosityValue {
+		valueContent = s.hoverValue(ctx, doc, stack, position.ProtocolToAST(params.Position))
+	}
+	typeOnlyHover := func() *protocol.Hover {
+		contentBuilder.WriteString(valueContent)
+		if contentBuilder.Len() == 0 {
+			return nil
+		}
+		result := &protocol.Hover{Contents: protocol.MarkupContent{Kind: protocol.Markdown, Value: contentBuilder.String()}}
+		if loc := node.Loc(); loc != nil {
+			result.Range = position.RangeASTToProtocol(*loc)
+		}
+		return result
+	}
 
 	definitionParams := &protocol.DefinitionParams{
 		TextDocumentPositionParams: params.TextDocumentPositionParams,
 	}
-	definitions, err := findDefinition(doc.ast, definitionParams, s.getVM(doc.item.URI.SpanURI().Filename()))
+	definitions, err := findDefinition(doc.ast, definitionParams, s.getCancellableVM(ctx, doc.item.URI.SpanURI().Filename()))
 	if err != nil {
-		log.Debugf("Hover: error finding definition: %s", err)
-		return nil, nil
+		log.WithContext(ctx).Debugf("Hover: error finding definition: %s", err)
+		return typeOnlyHover(), nil
 	}
 
 	if len(definitions) == 0 {
-		return nil, nil
+		return typeOnlyHover(), nil
 	}
 
 	// Show the contents at the target range
 	// If there are multiple definitions, show the filenames+line numbers
-	contentBuilder := strings.Builder{}
 	for _, def := range definitions {
 		if len(definitions) > 1 {
 			header := fmt.Sprintf("%s:%d", def.TargetURI, def.TargetRange.Start.Line+1)
@@ -91,20 +120,32 @@ func (s *Server) Hover(_ context.Context, params *protocol.HoverParams) (*protoc
 
 		targetContent, err := s.cache.getContents(def.TargetURI, def.TargetRange)
 		if err != nil {
-			log.Debugf("Hover: error reading target content: %s", err)
+			log.WithContext(ctx).Debugf("Hover: error reading target content: %s", err)
 			return nil, nil
 		}
-		// Limit the content to 5 lines
-		if strings.Count(targetContent, "\n") > 5 {
-			targetContent = strings.Join(strings.Split(targetContent, "\n")[:5], "\n") + "\n..."
+		// Limit the content to 5 lines, or to the line of the signature
+		if lines := strings.Split(targetContent, "\n"); verbosity == hoverVerbositySignature {
+			targetContent = lines[0]
+		} else if len(lines) > 6 {
+			targetContent = strings.Join(lines[:5], "\n") + "\n..."
 		}
 		contentBuilder.WriteString(fmt.Sprintf("```jsonnet\n%s\n```\n", targetContent))
+		if verbosity == hoverVerbositySignature {
+			continue
+		}
+		if visibility := s.fieldVisibilityHover(def.TargetURI, def.TargetRange.Start); visibility != "" {
+			contentBuilder.WriteString("\n" + visibility + "\n")
+		}
+		if symbol, ok := s.symbolDoc(def.TargetURI.SpanURI().Filename(), int(def.TargetRange.Start.Line)+1); ok {
+			contentBuilder.WriteString("\n" + symbol.markdown() + "\n")
+		}
 
 		if len(definitions) > 1 {
 			contentBuilder.WriteString("\n")
 		}
 	}
 
+	contentBuilder.WriteString(valueContent)
 	result := &protocol.Hover{
 		Contents: protocol.MarkupContent{
 			Kind:  protocol.Markdown,
@@ -117,3 +158,13 @@ func (s *Server) Hover(_ context.Context, params *protocol.HoverParams) (*protoc
 
 	return result, nil
 }
+
+func stdFunctionHover(function stdlib.Function, rng protocol.Range) *protocol.Hover {
+	return &protocol.Hover{
+		Range: rng,
+		Contents: protocol.MarkupContent{
+			Kind:  protocol.Markdown,
+			Value: fmt.Sprintf("`%s`\n\n%s", function.Signature(), function.MarkdownDescription),
+		},
+	}
+}
@@ -0,0 +1,231 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/go-jsonnet/ast"
+	"github.com/grafana/jsonnet-language-server/pkg/ast/processing"
+	"github.com/grafana/jsonnet-language-server/pkg/nodestack"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// The verbosities of the hovers, from the least verbose
+const (
+	// hoverVerbositySignature shows the first line of the definitions, their signature
+	hoverVerbositySignature = "signature"
+	// hoverVerbosityDocs shows the first lines of the definitions, with their documentation
+	hoverVerbosityDocs = "docs"
+	// hoverVerbosityValue also shows the evaluated value of the locals and fields
+	hoverVerbosityValue = "value"
+)
+
+// hoverVerbosity returns the verbosity of the hovers, docs by default.
+func (c Configuration) hoverVerbosity() string {
+	if c.HoverVerbosity == "" {
+		return hoverVerbosityDocs
+	}
+	return c.HoverVerbosity
+}
+
+// markdownFormats tells whether a client renders markdown, from the content formats it lists. The clients that don't
+// list them are assumed to render it.
+func markdownFormats(formats []protocol.MarkupKind) bool {
+	if len(formats) == 0 {
+		return true
+	}
+	for _, format := range formats {
+		if format == protocol.Markdown {
+			return true
+		}
+	}
+	return false
+}
+
+// renderHover cuts the contents of a hover to the maximum length, and turns them into plain text for the clients
+// that don't render markdown.
+func (s *Server) renderHover(hover *protocol.Hover) *protocol.Hover {
+	if hover == nil {
+		return nil
+	}
+	value := hover.Contents.Value
+	if maxLength := s.config().HoverMaxLength; maxLength > 0 && len(value) > maxLength {
+		value = value[:maxLength]
+		for !utf8.ValidString(value) {
+			value = value[:len(value)-1]
+		}
+		// A code block that is cut is still closed
+		if strings.Count(value, "```")%2 == 1 {
+			value += "\n```"
+		}
+		value += "\n…"
+	}
+	hover.Contents = protocol.MarkupContent{Kind: protocol.Markdown, Value: value}
+	if s.hoverPlainText {
+		hover.Contents = protocol.MarkupContent{Kind: protocol.PlainText, Value: markdownToPlainText(value)}
+	}
+	return hover
+}
+
+// markdownEmphasisRegexp matches the inline markup of the hovers: code spans and bold text
+var markdownEmphasisRegexp = regexp.MustCompile("`([^`]*)`|\\*\\*([^*]*)\\*\\*")
+
+// markdownToPlainText removes the markup of the hovers: the fences of the code blocks, the heading markers, the
+// backquotes of code spans and the asterisks of bold text.
+func markdownToPlainText(markdown string) string {
+	lines := strings.Split(markdown, "\n")
+	plain := make([]string, 0, len(lines))
+	inCodeBlock := false
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "```"):
+			inCodeBlock = !inCodeBlock
+			continue
+		case inCodeBlock:
+		case strings.HasPrefix(line, "#"):
+			line = strings.TrimLeft(line, "# ")
+		default:
+			line = markdownEmphasisRegexp.ReplaceAllString(line, "$1$2")
+		}
+		plain = append(plain, line)
+	}
+	return strings.Join(plain, "\n")
+}
+
+// hoverValue evaluates the top-level local, or the field of the top-level object, under the cursor and returns the
+// content that shows its value. The locals and fields of the other scopes can't be evaluated on their own.
+func (s *Server) hoverValue(ctx context.Context, doc *document, stack *nodestack.NodeStack, pos ast.Location) string {
+	filename := doc.item.URI.SpanURI().Filename()
+	if doc.ast == nil || len(doc.linesChangedSinceAST) > 0 || stack.IsEmpty() || !s.trusted() || s.evaluationBudgets.isDisabled(filename) {
+		return ""
+	}
+	evaluate := func(snippet string) (interface{}, bool) {
+		vm := s.getCancellableVM(ctx, filename)
+		output, err := s.evaluateInTurn(ctx, "hover", filename, func() (string, error) {
+			return vm.EvaluateAnonymousSnippet(filename, snippet)
+		})
+		if err != nil {
+			log.Debugf("Hover: unable to evaluate the value: %v", err)
+			return nil, false
+		}
+		var value interface{}
+		if err := json.Unmarshal([]byte(output), &value); err != nil {
+			return nil, false
+		}
+		return value, true
+	}
+
+	var value interface{}
+	var ok bool
+	if local, name := topLevelLocalAt(doc.ast, stack, pos); local != nil {
+		// The local is evaluated with the text that precedes the document's body, it can only use the previous locals
+		value, ok = evaluate(doc.item.Text[:locationOffset(doc.item.Text, local.Body.Loc().Begin)] + "\n" + string(name))
+	} else if path := topLevelFieldAt(doc.ast, pos); path != nil {
+		if value, ok = evaluate(doc.item.Text); ok {
+			for _, name := range path {
+				// Hidden fields are not in the output
+				object, isObject := value.(map[string]interface{})
+				if value, ok = object[name]; !isObject || !ok {
+					return ""
+				}
+			}
+		}
+	}
+	if !ok {
+		return ""
+	}
+	output, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("Value:\n```json\n%s\n```\n", output)
+}
+
+// topLevelLocalAt returns the top-level local whose name, or one of whose uses, is under the cursor, along with the
+// name.
+func topLevelLocalAt(root ast.Node, stack *nodestack.NodeStack, pos ast.Location) (*ast.Local, ast.Identifier) {
+	topLevel := map[*ast.Local]bool{}
+	for node := root; ; {
+		local, ok := node.(*ast.Local)
+		if !ok {
+			break
+		}
+		topLevel[local] = true
+		for _, bind := range local.Binds {
+			if _, isFunction := bind.Body.(*ast.Function); !isFunction && inRange(pos, processing.LocalBindToRange(bind).SelectionRange) {
+				return local, bind.Variable
+			}
+		}
+		node = local.Body
+	}
+
+	variable, ok := stack.Peek().(*ast.Var)
+	if !ok {
+		return nil, ""
+	}
+	// The innermost scope that binds the name is the one of the variable
+	for i := len(stack.Stack) - 1; i >= 0; i-- {
+		switch node := stack.Stack[i].(type) {
+		case *ast.Local:
+			for _, bind := range node.Binds {
+				if bind.Variable != variable.Id {
+					continue
+				}
+				if _, isFunction := bind.Body.(*ast.Function); !topLevel[node] || isFunction {
+					return nil, ""
+				}
+				return node, bind.Variable
+			}
+		case *ast.DesugaredObject:
+			for _, bind := range node.Locals {
+				if bind.Variable == variable.Id {
+					return nil, ""
+				}
+			}
+		case *ast.Function:
+			for _, param := range node.Parameters {
+				if param.Name == variable.Id {
+					return nil, ""
+				}
+			}
+		}
+	}
+	return nil, ""
+}
+
+// topLevelFieldAt returns the path, from the top-level object, of the field whose name is under the cursor. The fields
+// are looked up in the object literals nested in the fields of the top-level object.
+func topLevelFieldAt(root ast.Node, pos ast.Location) []string {
+	node := root
+	for local, ok := node.(*ast.Local); ok; local, ok = node.(*ast.Local) {
+		node = local.Body
+	}
+	var path []string
+	for {
+		object, ok := node.(*ast.DesugaredObject)
+		if !ok {
+			return nil
+		}
+		node = nil
+		for _, field := range object.Fields {
+			name, ok := field.Name.(*ast.LiteralString)
+			if !ok {
+				continue
+			}
+			fieldRange := processing.FieldToRange(field)
+			if inRange(pos, fieldRange.SelectionRange) {
+				return append(path, name.Value)
+			}
+			if inRange(pos, fieldRange.FullRange) {
+				path = append(path, name.Value)
+				node = field.Body
+				break
+			}
+		}
+	}
+}
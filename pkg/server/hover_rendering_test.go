@@ -0,0 +1,116 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHoverRendering(t *testing.T) {
+	testCases := []struct {
+		name      string
+		settings  map[string]interface{}
+		plainText bool
+		position  protocol.Position
+		expected  protocol.MarkupContent
+	}{
+		{
+			name:     "signature",
+			settings: map[string]interface{}{"hover_verbosity": "signature"},
+			position: protocol.Position{Line: 8, Character: 9},
+			expected: protocol.MarkupContent{
+				Kind:  protocol.Markdown,
+				Value: "Type: `{ foo: { bar: string }, bar: string }`\n\n```jsonnet\nobj = {\n```\n",
+			},
+		},
+		{
+			name:     "value of a local",
+			settings: map[string]interface{}{"hover_verbosity": "value"},
+			position: protocol.Position{Line: 8, Character: 9},
+			expected: protocol.MarkupContent{
+				Kind:  protocol.Markdown,
+				Value: "Type: `{ foo: { bar: string }, bar: string }`\n\n```jsonnet\nobj = {\n  foo: {\n    bar: 'innerfoo',\n  },\n  bar: 'foo',\n}\n```\nValue:\n```json\n{\n  \"bar\": \"foo\",\n  \"foo\": {\n    \"bar\": \"innerfoo\"\n  }\n}\n```\n",
+			},
+		},
+		{
+			name:     "value of a field",
+			settings: map[string]interface{}{"hover_verbosity": "value"},
+			position: protocol.Position{Line: 9, Character: 2},
+			expected: protocol.MarkupContent{
+				Kind:  protocol.Markdown,
+				Value: "Type: `string`\n\nValue:\n```json\n\"innerfoo\"\n```\n",
+			},
+		},
+		{
+			name:     "maximum length",
+			settings: map[string]interface{}{"hover_max_length": 60},
+			position: protocol.Position{Line: 8, Character: 9},
+			expected: protocol.MarkupContent{
+				Kind:  protocol.Markdown,
+				Value: "Type: `{ foo: { bar: string }, bar: string }`\n\n```jsonnet\nob\n```\n…",
+			},
+		},
+		{
+			name:      "plain text",
+			plainText: true,
+			position:  protocol.Position{Line: 9, Character: 16},
+			expected: protocol.MarkupContent{
+				Kind:  protocol.PlainText,
+				Value: "Type: string\n\nbar: 'innerfoo',\n\nVisibility: : visible, unless it overrides a hidden field\n",
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := NewServer("any", "test version", nil, Configuration{JPaths: []string{"testdata"}})
+			server.hoverPlainText = tc.plainText
+			require.NoError(t, server.DidChangeConfiguration(context.Background(), &protocol.DidChangeConfigurationParams{Settings: tc.settings}))
+			uri := serverOpenTestFile(t, server, "testdata/goto-indexes.jsonnet")
+
+			hover, err := server.Hover(context.Background(), &protocol.HoverParams{
+				TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+					TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+					Position:     tc.position,
+				},
+			})
+			require.NoError(t, err)
+			require.NotNil(t, hover)
+			assert.Equal(t, tc.expected, hover.Contents)
+		})
+	}
+}
+
+func TestInitialize_HoverContentFormat(t *testing.T) {
+	testCases := []struct {
+		name      string
+		formats   []protocol.MarkupKind
+		plainText bool
+	}{
+		{name: "not listed"},
+		{name: "markdown", formats: []protocol.MarkupKind{protocol.PlainText, protocol.Markdown}},
+		{name: "plain text only", formats: []protocol.MarkupKind{protocol.PlainText}, plainText: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewServer("any", "test version", nil, Configuration{})
+			params := &protocol.ParamInitialize{}
+			params.Capabilities.TextDocument.Hover.ContentFormat = tc.formats
+			_, err := s.Initialize(context.Background(), params)
+			require.NoError(t, err)
+			assert.Equal(t, tc.plainText, s.hoverPlainText)
+		})
+	}
+}
+
+func TestHoverSettings(t *testing.T) {
+	s := NewServer("any", "test version", nil, Configuration{})
+	err := s.DidChangeConfiguration(context.Background(), &protocol.DidChangeConfigurationParams{
+		Settings: map[string]interface{}{"hover_verbosity": "everything", "hover_max_length": -1},
+	})
+	assert.EqualError(t, err, "JSON RPC invalid params: "+
+		"unsupported settings value for hover_max_length. expected a positive number of bytes, or 0 for no limit. got: -1; "+
+		"unsupported settings value for hover_verbosity. expected one of 'signature', 'docs', 'value'. got: everything")
+}
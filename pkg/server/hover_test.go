@@ -259,7 +259,7 @@ func TestHover(t *testing.T) {
 			expectedContent: protocol.Hover{
 				Contents: protocol.MarkupContent{
 					Kind:  protocol.Markdown,
-					Value: "```jsonnet\nbar: 'innerfoo',\n```\n",
+					Value: "Type: `string`\n\n```jsonnet\nbar: 'innerfoo',\n```\n\nVisibility: `:` visible, unless it overrides a hidden field\n",
 				},
 				Range: protocol.Range{
 					Start: protocol.Position{Line: 9, Character: 5},
@@ -274,7 +274,7 @@ func TestHover(t *testing.T) {
 			expectedContent: protocol.Hover{
 				Contents: protocol.MarkupContent{
 					Kind:  protocol.Markdown,
-					Value: "```jsonnet\nobj = {\n  foo: {\n    bar: 'innerfoo',\n  },\n  bar: 'foo',\n}\n```\n",
+					Value: "Type: `{ foo: { bar: string }, bar: string }`\n\n```jsonnet\nobj = {\n  foo: {\n    bar: 'innerfoo',\n  },\n  bar: 'foo',\n}\n```\n",
 				},
 				Range: protocol.Range{
 					Start: protocol.Position{Line: 8, Character: 8},
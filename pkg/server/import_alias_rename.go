@@ -0,0 +1,67 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/google/go-jsonnet/ast"
+	"github.com/grafana/jsonnet-language-server/pkg/ast/processing"
+	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+)
+
+// importAliasRenameCodeActions offers to rename the local under the cursor that aliases an import, when it hides an
+// outer variable that has the same name: the alias that an import added for a name that was already used, for example.
+// The alias gets a free name, and only it and its references are renamed.
+func importAliasRenameCodeActions(doc *document, rng protocol.Range) []protocol.CodeAction {
+	if doc.ast == nil || len(doc.linesChangedSinceAST) > 0 {
+		return nil
+	}
+
+	aliases := map[ast.LocationRange]bool{}
+	walk(doc.ast, func(node ast.Node) {
+		local, ok := node.(*ast.Local)
+		if !ok {
+			return
+		}
+		for _, bind := range local.Binds {
+			if _, ok := stripParens(bind.Body).(*ast.Import); ok {
+				objectRange := processing.LocalBindToRange(bind)
+				aliases[withFileName(objectRange.SelectionRange, objectRange.Filename)] = true
+			}
+		}
+	})
+
+	variables := findVariables(doc.ast)
+	used := map[ast.Identifier]bool{}
+	for _, v := range variables {
+		used[v.name] = true
+	}
+	var actions []protocol.CodeAction
+	for _, v := range variables {
+		if v.hides == nil || !aliases[v.selection] || !inRange(position.ProtocolToAST(rng.Start), v.definition) {
+			continue
+		}
+		newName := freeVariableName(v.name, used)
+		edits, err := renameVariable(doc, v, newName)
+		if err != nil {
+			continue
+		}
+		actions = append(actions, protocol.CodeAction{
+			Title: fmt.Sprintf("Rename the import alias %s to %s, it hides the %s of line %d", v.name, newName, v.name, v.hides.selection.Begin.Line),
+			Kind:  protocol.RefactorRewrite,
+			Edit:  protocol.WorkspaceEdit{Changes: map[string][]protocol.TextEdit{string(doc.item.URI): edits}},
+		})
+	}
+	return actions
+}
+
+// freeVariableName returns the name followed by the first number that makes it unused: k2, k3...
+func freeVariableName(name ast.Identifier, used map[ast.Identifier]bool) string {
+	for i := 2; ; i++ {
+		candidate := string(name) + strconv.Itoa(i)
+		if !used[ast.Identifier(candidate)] {
+			return candidate
+		}
+	}
+}
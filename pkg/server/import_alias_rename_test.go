@@ -0,0 +1,75 @@
+package server
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenameImportAlias(t *testing.T) {
+	root := writeProjectFiles(t, map[string]string{
+		"k.libsonnet":  "local k = { name: 'k' };\nk",
+		"main.jsonnet": "local k = import 'k.libsonnet';\nlocal other = 1;\n{ name: k.name, all: k, other: other }",
+	})
+	s := renameTestServer(t, root, nil)
+	uri := serverOpenTestFile(t, s, filepath.Join(root, "main.jsonnet"))
+	serverOpenTestFile(t, s, filepath.Join(root, "k.libsonnet"))
+	rename := func(newName string) (*protocol.WorkspaceEdit, error) {
+		return s.Rename(context.Background(), &protocol.RenameParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     protocol.Position{Line: 2, Character: 21},
+			NewName:      newName,
+		})
+	}
+
+	// The alias and its references are renamed, not the imported file's local
+	edit, err := rename("kube")
+	require.NoError(t, err)
+	require.Len(t, edit.Changes, 1)
+	assert.Equal(t, "local kube = import 'k.libsonnet';\nlocal other = 1;\n{ name: kube.name, all: kube, other: other }", applyTextEdits(t, "local k = import 'k.libsonnet';\nlocal other = 1;\n{ name: k.name, all: k, other: other }", edit.Changes[string(uri)]))
+
+	// The alias can't take the name of a variable that its references would then refer to
+	_, err = rename("other")
+	assert.EqualError(t, err, "JSON RPC invalid params: renaming k to other would change the variables that some references refer to, other is already used in its scope")
+}
+
+func TestImportAliasRenameCodeActions(t *testing.T) {
+	const document = `local k = { name: 'local' };
+local f(k2) = k2;
+local k = import 'k.libsonnet';
+local lib = import 'lib.libsonnet';
+{ a: k.name, b: f(k), lib: lib }
+`
+	root := writeProjectFiles(t, map[string]string{"main.jsonnet": document, "k.libsonnet": "{ name: 'k' }", "lib.libsonnet": "{}"})
+	s := renameTestServer(t, root, nil)
+	uri := serverOpenTestFile(t, s, filepath.Join(root, "main.jsonnet"))
+	codeActions := func(line uint32) []protocol.CodeAction {
+		actions, err := s.CodeAction(context.Background(), &protocol.CodeActionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Range:        protocol.Range{Start: protocol.Position{Line: line, Character: 8}, End: protocol.Position{Line: line, Character: 8}},
+			Context:      protocol.CodeActionContext{Only: []protocol.CodeActionKind{protocol.RefactorRewrite}},
+		})
+		require.NoError(t, err)
+		return actions
+	}
+
+	// The alias that hides the local k is renamed to a name that isn't used
+	actions := codeActions(2)
+	require.Len(t, actions, 1)
+	assert.Equal(t, "Rename the import alias k to k3, it hides the k of line 1", actions[0].Title)
+	assert.Equal(t, protocol.RefactorRewrite, actions[0].Kind)
+	assert.Equal(t, `local k = { name: 'local' };
+local f(k2) = k2;
+local k3 = import 'k.libsonnet';
+local lib = import 'lib.libsonnet';
+{ a: k3.name, b: f(k3), lib: lib }
+`, applyTextEdits(t, document, actions[0].Edit.Changes[string(uri)]))
+
+	// The aliases that don't hide anything, and the other locals, are left as they are
+	assert.Empty(t, codeActions(3))
+	assert.Empty(t, codeActions(0))
+}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// parseImportAliases parses the import_aliases setting, which maps the prefixes of the imports to the paths that
+// replace them. The relative paths are relative to the workspace folder.
+func (s *Server) parseImportAliases(unparsed interface{}) (map[string]string, error) {
+	newAliases, ok := unparsed.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unsupported settings value for import_aliases. expected json object. got: %T", unparsed)
+	}
+	aliases := make(map[string]string, len(newAliases))
+	for prefix, value := range newAliases {
+		target, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("unsupported settings value for import_aliases.%s. expected string. got: %T", prefix, value)
+		}
+		if prefix == "" {
+			return nil, fmt.Errorf("unsupported settings value for import_aliases. expected non-empty prefixes")
+		}
+		target = s.expandPlaceholders(target)
+		if !filepath.IsAbs(target) && s.workspaceFolder != "" {
+			// The target isn't cleaned, its trailing slash separates it from the rest of the import
+			target = strings.TrimSuffix(s.workspaceFolder, string(filepath.Separator)) + string(filepath.Separator) + target
+		}
+		aliases[prefix] = target
+	}
+	return aliases, nil
+}
+
+// aliasImport rewrites an import that starts with the prefix of an alias, the longest one if several match, to start
+// with the alias' path instead.
+func aliasImport(aliases map[string]string, importedPath string) string {
+	longest := ""
+	for prefix := range aliases {
+		if strings.HasPrefix(importedPath, prefix) && len(prefix) > len(longest) {
+			longest = prefix
+		}
+	}
+	if longest == "" {
+		return importedPath
+	}
+	return aliases[longest] + strings.TrimPrefix(importedPath, longest)
+}
@@ -0,0 +1,299 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/go-jsonnet"
+)
+
+// projectImporter resolves imports from the filesystem, plus the special imports of the projects' tools, like
+// Tanka's `tk`. The imports that start with the prefix of an alias are rewritten first, as some build systems do.
+type projectImporter struct {
+	fileImporter
+	imports map[string]func() (jsonnet.Contents, string, error)
+	aliases map[string]string
+}
+
+func (i *projectImporter) Import(importedFrom, importedPath string) (jsonnet.Contents, string, error) {
+	if importer, ok := i.imports[importedPath]; ok {
+		return importer()
+	}
+	aliased := aliasImport(i.aliases, importedPath)
+	contents, foundAt, err := i.fileImporter.Import(importedFrom, aliased)
+	if err != nil && aliased != importedPath {
+		return jsonnet.Contents{}, "", fmt.Errorf("couldn't open import %#v: its alias %#v doesn't resolve: %w", importedPath, aliased, err)
+	}
+	return contents, foundAt, err
+}
+
+// fileImporter resolves imports like jsonnet.FileImporter, next to the importing file and then in the jpaths from
+// right to left, but reads the files through the cache that all the VMs share. An importer always returns the same
+// contents for a path, the evaluations see the files as they were when they first imported them.
+type fileImporter struct {
+	JPaths []string
+	files  *fileCache
+	// sandbox are the directories that the imported files must be in, any file can be imported if it is nil
+	sandbox []string
+
+	found map[string]*jsonnet.Contents // nil if the file doesn't exist
+}
+
+func (i *fileImporter) Import(importedFrom, importedPath string) (jsonnet.Contents, string, error) {
+	dir, _ := filepath.Split(importedFrom)
+	dirs := make([]string, 0, len(i.JPaths)+1)
+	dirs = append(dirs, dir)
+	for j := len(i.JPaths) - 1; j >= 0; j-- {
+		dirs = append(dirs, i.JPaths[j])
+	}
+
+	outOfSandbox := ""
+	for _, dir := range dirs {
+		path := importedPath
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, importedPath)
+		}
+		// The files out of the sandbox aren't read, as if they didn't exist
+		if i.sandbox != nil && !inSandbox(i.sandbox, path) {
+			if outOfSandbox == "" {
+				outOfSandbox = path
+			}
+			continue
+		}
+		contents, err := i.read(path)
+		if err != nil {
+			return jsonnet.Contents{}, "", err
+		}
+		if contents != nil {
+			return *contents, path, nil
+		}
+	}
+	if outOfSandbox != "" {
+		return jsonnet.Contents{}, "", fmt.Errorf("couldn't open import %#v: %s is out of the sandbox, only the files of the workspace and of the Jsonnet library paths can be imported", importedPath, outOfSandbox)
+	}
+	return jsonnet.Contents{}, "", fmt.Errorf("couldn't open import %#v: no match locally or in the Jsonnet library paths", importedPath)
+}
+
+func (i *fileImporter) read(path string) (*jsonnet.Contents, error) {
+	if contents, ok := i.found[path]; ok {
+		return contents, nil
+	}
+	if i.found == nil {
+		i.found = map[string]*jsonnet.Contents{}
+	}
+	contents, err := i.files.read(path)
+	if err != nil {
+		return nil, err
+	}
+	i.found[path] = contents
+	return contents, nil
+}
+
+// maxFileCacheSize is the size, in bytes, of the contents that the file cache keeps.
+const maxFileCacheSize = 256 << 20
+
+// fileCache keeps the contents of the imported files, so that the vendored libraries aren't read again for each
+// evaluation. The files whose modification time or size changed are read again, and those that can't be read
+// anymore are forgotten. Once the contents are larger than maxSize, the least recently read files are forgotten.
+type fileCache struct {
+	mu    sync.Mutex
+	files map[string]*cachedFile
+	// size is the size of the contents of the files, reads counts the reads to order them by recency
+	size, maxSize int64
+	reads         uint64
+	hits, misses  uint64
+}
+
+type cachedFile struct {
+	modTime  time.Time
+	size     int64
+	contents jsonnet.Contents
+	lastRead uint64
+}
+
+func newFileCache() *fileCache {
+	return &fileCache{files: map[string]*cachedFile{}, maxSize: maxFileCacheSize}
+}
+
+// read returns the contents of a file, or nil if it doesn't exist.
+func (c *fileCache) read(path string) (*jsonnet.Contents, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		c.forget(path)
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	c.mu.Lock()
+	cached, ok := c.files[path]
+	if ok && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+		c.hits++
+		c.reads++
+		cached.lastRead = c.reads
+		c.mu.Unlock()
+		return &cached.contents, nil
+	}
+	c.misses++
+	c.mu.Unlock()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		c.forget(path)
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	contents := jsonnet.MakeContentsRaw(data)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if previous, ok := c.files[path]; ok {
+		c.size -= previous.size
+	}
+	c.reads++
+	c.files[path] = &cachedFile{modTime: info.ModTime(), size: info.Size(), contents: contents, lastRead: c.reads}
+	c.size += info.Size()
+	c.evict(path)
+	return &contents, nil
+}
+
+// forget removes a file from the cache.
+func (c *fileCache) forget(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cached, ok := c.files[path]; ok {
+		c.size -= cached.size
+		delete(c.files, path)
+	}
+}
+
+// evict forgets the least recently read files until the contents fit in the cache, except the file just read. It
+// must be called with the lock held.
+func (c *fileCache) evict(keep string) {
+	for c.size > c.maxSize && len(c.files) > 1 {
+		oldest := ""
+		for path, cached := range c.files {
+			if path != keep && (oldest == "" || cached.lastRead < c.files[oldest].lastRead) {
+				oldest = path
+			}
+		}
+		c.size -= c.files[oldest].size
+		delete(c.files, oldest)
+	}
+}
+
+// usage returns the number of files in the cache, and the size of their contents.
+func (c *fileCache) usage() (int, int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.files), c.size
+}
+
+func (c *fileCache) stats() (hits, misses uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses
+}
+
+// cancellableImporter fails all imports once its context is done.
+// go-jsonnet cannot interrupt an evaluation. Failing its imports makes it fail at its next import, if it has any left,
+// an evaluation that doesn't import anymore runs to completion.
+type cancellableImporter struct {
+	ctx      context.Context
+	importer jsonnet.Importer
+}
+
+func (i *cancellableImporter) Import(importedFrom, importedPath string) (jsonnet.Contents, string, error) {
+	if err := i.ctx.Err(); err != nil {
+		return jsonnet.Contents{}, "", fmt.Errorf("import of %s cancelled: %w", importedPath, err)
+	}
+	return i.importer.Import(importedFrom, importedPath)
+}
+
+// runningEvaluations are the evaluations that run, by feature and file, including those that were abandoned when their
+// context was done: they keep running in the background until they end. A new evaluation of a file for a feature
+// waits for the previous one, so that the evaluations of a slow file that each keystroke abandons don't pile up.
+type runningEvaluations struct {
+	mu      sync.Mutex
+	running map[string]chan struct{}
+}
+
+func newRunningEvaluations() *runningEvaluations {
+	return &runningEvaluations{running: map[string]chan struct{}{}}
+}
+
+// start waits for the previous evaluation of the key to end, and returns the function that ends the new one. It
+// returns the context's error if the context is done first.
+func (e *runningEvaluations) start(ctx context.Context, key string) (func(), error) {
+	for {
+		e.mu.Lock()
+		previous, ok := e.running[key]
+		if !ok {
+			done := make(chan struct{})
+			e.running[key] = done
+			e.mu.Unlock()
+			return func() {
+				e.mu.Lock()
+				delete(e.running, key)
+				e.mu.Unlock()
+				close(done)
+			}, nil
+		}
+		e.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-previous:
+		}
+	}
+}
+
+// evaluateInTurn evaluates a file for a feature with evaluateWithContext, once the previous evaluation of the file for
+// the feature ended, even if it was abandoned.
+func (s *Server) evaluateInTurn(ctx context.Context, feature, path string, evaluate func() (string, error)) (string, error) {
+	end, err := s.evaluations.start(ctx, feature+" "+path)
+	if err != nil {
+		return "", err
+	}
+	return evaluateWithContext(ctx, func() (string, error) {
+		defer end()
+		return evaluate()
+	})
+}
+
+// evaluateWithContext runs an evaluation and returns as soon as the context is done. The evaluation isn't stopped:
+// go-jsonnet can't interrupt it, it runs in the background until it ends, or fails at its next import with a VM from
+// getCancellableVM. A compute-heavy file that doesn't import runs to completion, and keeps a CPU busy meanwhile. The
+// cancellation only guarantees that the caller returns, and, as the evaluations of the files go through
+// evaluateInTurn, that there is at most one of them in the background for a file and a feature.
+func evaluateWithContext(ctx context.Context, evaluate func() (string, error)) (string, error) {
+	type result struct {
+		val string
+		err error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		// The evaluation runs out of the handler, a panic in it would take the server down
+		var r result
+		defer func() { done <- r }()
+		defer recoverJsonnetPanic("evaluating", &r.err)
+		r.val, r.err = evaluate()
+		r.err = jsonnetCrashError("evaluating", r.err)
+	}()
+
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case r := <-done:
+		return r.val, r.err
+	}
+}
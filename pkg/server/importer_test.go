@@ -0,0 +1,269 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-jsonnet"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTankaImporter(t *testing.T) {
+	s := testServer(t, nil)
+	setConfiguration(s, func(c *Configuration) {
+		c.ResolvePathsWithTanka = true
+	})
+
+	vm := s.getVM("testdata/test_basic_lib.libsonnet")
+	result, err := vm.EvaluateAnonymousSnippet("testdata/test.jsonnet", `std.objectHas((import 'tk'), 'env')`)
+	require.NoError(t, err)
+	assert.Equal(t, "true\n", result)
+}
+
+func TestCancellableVM(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "lib.libsonnet"), []byte(`{ a: 1 }`), 0o600))
+	filename := filepath.Join(dir, "main.jsonnet")
+
+	s := testServer(t, nil)
+
+	t.Run("not cancelled", func(t *testing.T) {
+		vm := s.getCancellableVM(context.Background(), filename)
+		result, err := vm.EvaluateAnonymousSnippet(filename, `(import 'lib.libsonnet').a`)
+		require.NoError(t, err)
+		assert.Equal(t, "1\n", result)
+	})
+
+	t.Run("cancelled before an import", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		vm := s.getCancellableVM(ctx, filename)
+		_, err := vm.EvaluateAnonymousSnippet(filename, `(import 'lib.libsonnet').a`)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "import of lib.libsonnet cancelled: context canceled")
+	})
+
+	t.Run("evaluation returns when cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		_, err := evaluateWithContext(ctx, func() (string, error) {
+			time.Sleep(time.Second)
+			return "", nil
+		})
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("cancelled evaluation without imports", func(t *testing.T) {
+		// go-jsonnet can't interrupt an evaluation, the cancellation only fails its imports. An evaluation that doesn't
+		// import runs to completion: the caller returns, and the next evaluation of the file waits for it.
+		const expensive = `std.foldl(function(sum, i) sum + i, std.range(1, 300000), 0)`
+		var ended atomic.Bool
+		evaluate := func(ctx context.Context, afterEnd *bool) (string, error) {
+			return s.evaluateInTurn(ctx, "diagnostics", filename, func() (string, error) {
+				*afterEnd = ended.Load()
+				defer ended.Store(true)
+				return s.getCancellableVM(ctx, filename).EvaluateAnonymousSnippet(filename, expensive)
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		defer cancel()
+		_, err := evaluate(ctx, new(bool))
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.False(t, ended.Load(), "the caller returns before the evaluation ends")
+
+		var second bool
+		result, err := evaluate(context.Background(), &second)
+		require.NoError(t, err)
+		assert.Equal(t, "45000150000\n", result)
+		assert.True(t, second, "the next evaluation starts once the abandoned one ended")
+	})
+
+	t.Run("abandoned evaluations don't pile up", func(t *testing.T) {
+		release := make(chan struct{})
+		var evaluations atomic.Int32
+		evaluate := func(ctx context.Context, path string) error {
+			_, err := s.evaluateInTurn(ctx, "diagnostics", path, func() (string, error) {
+				evaluations.Add(1)
+				<-release
+				return "", nil
+			})
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, evaluate(ctx, filename), context.DeadlineExceeded)
+		// The next evaluation of the file waits for the abandoned one, which is still running
+		ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, evaluate(ctx, filename), context.DeadlineExceeded)
+		assert.Equal(t, int32(1), evaluations.Load())
+
+		// The other files are evaluated meanwhile
+		ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, evaluate(ctx, filepath.Join(dir, "other.jsonnet")), context.DeadlineExceeded)
+		assert.Equal(t, int32(2), evaluations.Load())
+
+		close(release)
+		require.NoError(t, evaluate(context.Background(), filename))
+		assert.Equal(t, int32(3), evaluations.Load())
+	})
+}
+
+func TestFileImporter(t *testing.T) {
+	dir := t.TempDir()
+	vendor := filepath.Join(dir, "vendor")
+	lib := filepath.Join(dir, "lib")
+	for path, content := range map[string]string{
+		filepath.Join(vendor, "a.libsonnet"): `'vendor'`,
+		filepath.Join(vendor, "c.libsonnet"): `'vendor'`,
+		filepath.Join(lib, "a.libsonnet"):    `'lib'`,
+		filepath.Join(lib, "b.libsonnet"):    `import 'c.libsonnet'`,
+		filepath.Join(lib, "c.libsonnet"):    `'next to b'`,
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o700))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	}
+	files := newFileCache()
+	evaluate := func() string {
+		vm := jsonnet.MakeVM()
+		// The files next to the importing one come first, then the jpaths from right to left
+		vm.Importer(&fileImporter{JPaths: []string{lib, vendor}, files: files})
+		result, err := vm.EvaluateAnonymousSnippet("main.jsonnet", `[import 'a.libsonnet', import 'b.libsonnet']`)
+		require.NoError(t, err)
+		return result
+	}
+	stats := func() []uint64 {
+		hits, misses := files.stats()
+		return []uint64{hits, misses}
+	}
+
+	assert.Equal(t, "[\n   \"vendor\",\n   \"next to b\"\n]\n", evaluate())
+	assert.Equal(t, []uint64{0, 3}, stats())
+
+	// The unchanged files are read from the cache
+	assert.Equal(t, "[\n   \"vendor\",\n   \"next to b\"\n]\n", evaluate())
+	assert.Equal(t, []uint64{3, 3}, stats())
+
+	// A file is read again once it changes
+	changed := filepath.Join(vendor, "a.libsonnet")
+	require.NoError(t, os.WriteFile(changed, []byte(`'changed'`), 0o600))
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(changed, later, later))
+	assert.Equal(t, "[\n   \"changed\",\n   \"next to b\"\n]\n", evaluate())
+	assert.Equal(t, []uint64{5, 4}, stats())
+
+	// The removed files aren't found anymore, and are forgotten
+	require.NoError(t, os.Remove(filepath.Join(lib, "c.libsonnet")))
+	assert.Equal(t, "[\n   \"changed\",\n   \"vendor\"\n]\n", evaluate())
+	count, _ := files.usage()
+	assert.Equal(t, 3, count)
+
+	_, _, err := (&fileImporter{files: files}).Import("main.jsonnet", "missing.libsonnet")
+	assert.EqualError(t, err, `couldn't open import "missing.libsonnet": no match locally or in the Jsonnet library paths`)
+}
+
+func TestFileCacheSize(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a", "b", "c"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(strings.Repeat(name, 10)), 0o600))
+	}
+	files := newFileCache()
+	files.maxSize = 25
+	read := func(name string) {
+		contents, err := files.read(filepath.Join(dir, name))
+		require.NoError(t, err)
+		assert.Equal(t, strings.Repeat(name, 10), contents.String())
+	}
+	cached := func() []string {
+		files.mu.Lock()
+		defer files.mu.Unlock()
+		var names []string
+		for path := range files.files {
+			names = append(names, filepath.Base(path))
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	read("a")
+	read("b")
+	read("a")
+	// The least recently read file is forgotten once the contents are too large
+	read("c")
+	assert.Equal(t, []string{"a", "c"}, cached())
+	count, size := files.usage()
+	assert.Equal(t, 2, count)
+	assert.Equal(t, int64(20), size)
+
+	// A file larger than the cache is kept until the next one is read
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b"), []byte(strings.Repeat("b", 30)), 0o600))
+	contents, err := files.read(filepath.Join(dir, "b"))
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat("b", 30), contents.String())
+	assert.Equal(t, []string{"b"}, cached())
+	read("a")
+	assert.Equal(t, []string{"a"}, cached())
+}
+
+func TestImportAliases(t *testing.T) {
+	root := writeProjectFiles(t, map[string]string{
+		"vendor/github.com/grafana/jsonnet-libs/grafana/main.libsonnet": `'vendored'`,
+		"vendor/grafana/main.libsonnet":                                 `'shortest prefix'`,
+		"shared/lib/util.libsonnet":                                     `'shared'`,
+		"main.jsonnet":                                                  `'main'`,
+	})
+	s := testServer(t, nil)
+	s.workspaceFolder = root
+	err := s.DidChangeConfiguration(context.Background(), &protocol.DidChangeConfigurationParams{
+		Settings: map[string]interface{}{
+			"import_aliases": map[string]interface{}{
+				"github.com/":                      "vendor/",
+				"github.com/grafana/jsonnet-libs/": "vendor/github.com/grafana/jsonnet-libs/",
+				"lib/":                             "${workspaceFolder}/shared/lib/",
+			},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"github.com/":                      filepath.Join(root, "vendor") + "/",
+		"github.com/grafana/jsonnet-libs/": filepath.Join(root, "vendor/github.com/grafana/jsonnet-libs") + "/",
+		"lib/":                             filepath.Join(root, "shared/lib") + "/",
+	}, s.configuration.ImportAliases)
+
+	main := filepath.Join(root, "main.jsonnet")
+	vm := s.getVM(main)
+	result, err := vm.EvaluateAnonymousSnippet(main, `[
+		import 'github.com/grafana/jsonnet-libs/grafana/main.libsonnet',
+		import 'lib/util.libsonnet',
+		import 'main.jsonnet',
+	]`)
+	require.NoError(t, err)
+	assert.JSONEq(t, `["vendored", "shared", "main"]`, result)
+
+	// The imported files are found at their aliased paths
+	_, foundAt, err := s.getImporter(s.configuration, main, &projectSettings{}).Import(main, "lib/util.libsonnet")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(root, "shared/lib/util.libsonnet"), foundAt)
+
+	_, _, err = s.getImporter(s.configuration, main, &projectSettings{}).Import(main, "lib/missing.libsonnet")
+	assert.ErrorContains(t, err, fmt.Sprintf(`couldn't open import "lib/missing.libsonnet": its alias %q doesn't resolve`, filepath.Join(root, "shared/lib/missing.libsonnet")))
+
+	err = s.DidChangeConfiguration(context.Background(), &protocol.DidChangeConfigurationParams{
+		Settings: map[string]interface{}{"import_aliases": map[string]interface{}{"lib/": 1}},
+	})
+	assert.EqualError(t, err, "JSON RPC invalid params: import_aliases parsing failed: unsupported settings value for import_aliases.lib/. expected string. got: int")
+}
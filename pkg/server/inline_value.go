@@ -0,0 +1,176 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-jsonnet/ast"
+	"github.com/grafana/jsonnet-language-server/pkg/ast/processing"
+	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxInlineValueLength is the length after which the values shown inline are cut.
+const maxInlineValueLength = 80
+
+// inlineValueParams are the parameters of textDocument/inlineValue.
+// The protocol library predates that request, so it comes as a non-standard request.
+type inlineValueParams struct {
+	TextDocument protocol.TextDocumentIdentifier `json:"textDocument"`
+	Range        protocol.Range                  `json:"range"`
+}
+
+// inlineValueText is an InlineValue whose text is shown as is.
+type inlineValueText struct {
+	Range protocol.Range `json:"range"`
+	Text  string         `json:"text"`
+}
+
+// registerInlineValue registers the textDocument/inlineValue request, which can't be advertised in the server
+// capabilities of the protocol library.
+func (s *Server) registerInlineValue() {
+	if s.client == nil {
+		return
+	}
+	go func() {
+		// The client answers the registration after the initialized notification is handled
+		err := s.client.RegisterCapability(context.Background(), &protocol.RegistrationParams{
+			Registrations: []protocol.Registration{{ID: "jsonnet-inline-value", Method: "textDocument/inlineValue"}},
+		})
+		if err != nil {
+			log.Debugf("registerInlineValue: the client didn't register textDocument/inlineValue: %v", err)
+		}
+	}()
+}
+
+// inlineValue evaluates the document and shows the values of its top-level locals and of the fields of its
+// top-level object at the end of their line.
+func (s *Server) inlineValue(ctx context.Context, rawParams interface{}) ([]inlineValueText, error) {
+	var params inlineValueParams
+	if err := decodeParams(rawParams, &params); err != nil {
+		return nil, err
+	}
+
+	return onLatestDocument(s, "InlineValue", params.TextDocument.URI, func(doc *document) ([]inlineValueText, error) {
+		if doc.ast == nil || len(doc.linesChangedSinceAST) > 0 {
+			// The values can't be placed on an out of date AST
+			return nil, nil
+		}
+		filename := doc.item.URI.SpanURI().Filename()
+		if !s.trusted() || s.evaluationBudgets.isDisabled(filename) {
+			return nil, nil
+		}
+		evaluate := func(snippet string) (string, error) {
+			vm := s.getCancellableVM(ctx, filename)
+			return s.evaluateInTurn(ctx, "inlineValue", filename, func() (string, error) {
+				return vm.EvaluateAnonymousSnippet(filename, snippet)
+			})
+		}
+		inRequestedRange := func(r ast.LocationRange) bool {
+			return inRange(r.Begin, ast.LocationRange{
+				Begin: position.ProtocolToAST(params.Range.Start),
+				End:   position.ProtocolToAST(params.Range.End),
+			})
+		}
+
+		var values []inlineValueText
+		node := doc.ast
+		for {
+			local, ok := node.(*ast.Local)
+			if !ok {
+				break
+			}
+			// The locals are evaluated with the text that precedes the document's body, they can only use the previous locals
+			prefix := doc.item.Text[:locationOffset(doc.item.Text, local.Body.Loc().Begin)]
+			for _, bind := range local.Binds {
+				bindRange := processing.LocalBindToRange(bind)
+				if _, isFunction := bind.Body.(*ast.Function); isFunction || !inRequestedRange(bindRange.FullRange) {
+					continue
+				}
+				output, err := evaluate(prefix + "\n" + string(bind.Variable))
+				if err != nil {
+					log.WithContext(ctx).Debugf("InlineValue: unable to evaluate local %s: %v", bind.Variable, err)
+					continue
+				}
+				values = append(values, inlineValueText{
+					Range: position.RangeASTToProtocol(bindRange.FullRange),
+					Text:  inlineValueFormat(string(bind.Variable), output),
+				})
+			}
+			node = local.Body
+		}
+
+		object, ok := node.(*ast.DesugaredObject)
+		if !ok {
+			return values, nil
+		}
+		output, err := evaluate(doc.item.Text)
+		if err != nil {
+			log.WithContext(ctx).Debugf("InlineValue: unable to evaluate %s: %v", filename, err)
+			return values, nil
+		}
+		var value interface{}
+		if err := json.Unmarshal([]byte(output), &value); err != nil {
+			return values, nil
+		}
+		return append(values, inlineFieldValues(object, value, inRequestedRange)...), nil
+	})
+}
+
+// inlineFieldValues returns the values of the fields of an object literal, found in its output. The values of the
+// nested object literals are not shown, their fields are.
+func inlineFieldValues(object *ast.DesugaredObject, value interface{}, inRequestedRange func(ast.LocationRange) bool) []inlineValueText {
+	outputObject, ok := value.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	var values []inlineValueText
+	for _, field := range object.Fields {
+		name, ok := field.Name.(*ast.LiteralString)
+		if !ok {
+			continue
+		}
+		// Hidden fields are not in the output
+		fieldValue, ok := outputObject[name.Value]
+		if !ok {
+			continue
+		}
+		if nested, ok := field.Body.(*ast.DesugaredObject); ok {
+			values = append(values, inlineFieldValues(nested, fieldValue, inRequestedRange)...)
+			continue
+		}
+
+		fieldRange := processing.FieldToRange(field).FullRange
+		if !inRequestedRange(fieldRange) {
+			continue
+		}
+		output, err := json.Marshal(fieldValue)
+		if err != nil {
+			continue
+		}
+		values = append(values, inlineValueText{
+			Range: position.RangeASTToProtocol(fieldRange),
+			Text:  inlineValueFormat(name.Value, string(output)),
+		})
+	}
+	return values
+}
+
+// inlineValueFormat returns `name = value`, with the value on a single line.
+func inlineValueFormat(name, output string) string {
+	var value interface{}
+	if err := json.Unmarshal([]byte(output), &value); err == nil {
+		if compact, err := json.Marshal(value); err == nil {
+			output = string(compact)
+		}
+	}
+	output = strings.TrimSpace(output)
+	if len(output) > maxInlineValueLength {
+		output = output[:maxInlineValueLength] + "…"
+	}
+	return fmt.Sprintf("%s = %s", name, output)
+}
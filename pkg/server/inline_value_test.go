@@ -0,0 +1,65 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInlineValue(t *testing.T) {
+	const document = `local name = 'app';
+local port = 8000 + 80;
+local f(x) = x;
+{
+  name: name,
+  hidden:: 'hidden',
+  spec: {
+    ports: [port, f(443)],
+  },
+}
+`
+	testCases := []struct {
+		name     string
+		rang     protocol.Range
+		expected []inlineValueText
+	}{
+		{
+			name: "whole document",
+			rang: protocol.Range{End: protocol.Position{Line: 10}},
+			expected: []inlineValueText{
+				{Range: protocol.Range{Start: protocol.Position{Line: 0, Character: 6}, End: protocol.Position{Line: 0, Character: 18}}, Text: `name = "app"`},
+				{Range: protocol.Range{Start: protocol.Position{Line: 1, Character: 6}, End: protocol.Position{Line: 1, Character: 22}}, Text: `port = 8080`},
+				{Range: protocol.Range{Start: protocol.Position{Line: 4, Character: 2}, End: protocol.Position{Line: 4, Character: 12}}, Text: `name = "app"`},
+				{Range: protocol.Range{Start: protocol.Position{Line: 7, Character: 4}, End: protocol.Position{Line: 7, Character: 25}}, Text: `ports = [8080,443]`},
+			},
+		},
+		{
+			name: "only the requested lines",
+			rang: protocol.Range{Start: protocol.Position{Line: 5}, End: protocol.Position{Line: 8}},
+			expected: []inlineValueText{
+				{Range: protocol.Range{Start: protocol.Position{Line: 7, Character: 4}, End: protocol.Position{Line: 7, Character: 25}}, Text: `ports = [8080,443]`},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server, uri := testServerWithFile(t, nil, document)
+
+			result, err := server.NonstandardRequest(context.Background(), "textDocument/inlineValue", map[string]interface{}{
+				"textDocument": map[string]interface{}{"uri": string(uri)},
+				"range":        tc.rang,
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, result)
+		})
+	}
+}
+
+func TestInlineValueFormat(t *testing.T) {
+	assert.Equal(t, `a = {"b":[1,2]}`, inlineValueFormat("a", "{\n  \"b\": [\n    1,\n    2\n  ]\n}\n"))
+	assert.Equal(t, `long = "`+strings.Repeat("a", 79)+"…", inlineValueFormat("long", `"`+strings.Repeat("a", 100)+`"`))
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"strings"
+
+	"github.com/google/go-jsonnet"
+	"github.com/google/go-jsonnet/ast"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// jsonnetPanicError is the error of a call into go-jsonnet that panicked. Some malformed documents are known to panic
+// its parser, evaluator or formatter: the panic is reported on the document rather than taking the server down.
+type jsonnetPanicError struct {
+	operation string
+	value     interface{}
+}
+
+func (e *jsonnetPanicError) Error() string {
+	return fmt.Sprintf("go-jsonnet panicked while %s: %v", e.operation, e.value)
+}
+
+// recoverJsonnetPanic, when deferred by a function that calls into go-jsonnet, turns a panic of the call into the
+// error of the function. The stack is logged, for the issue to be reported upstream.
+func recoverJsonnetPanic(operation string, err *error) {
+	if r := recover(); r != nil {
+		*err = &jsonnetPanicError{operation: operation, value: r}
+		log.Errorf("%v\n%s", *err, debug.Stack())
+	}
+}
+
+// jsonnetCrashPrefix starts the errors of the panics that go-jsonnet's evaluator recovers from, followed by the panic
+// and its stack.
+const jsonnetCrashPrefix = "INTERNAL ERROR: (CRASH) "
+
+// jsonnetCrashError turns the errors of the panics that go-jsonnet's evaluator recovers from into jsonnetPanicErrors,
+// they are reported as the other panics.
+func jsonnetCrashError(operation string, err error) error {
+	if err == nil || !strings.HasPrefix(err.Error(), jsonnetCrashPrefix) {
+		return err
+	}
+	value, stack, _ := strings.Cut(strings.TrimPrefix(err.Error(), jsonnetCrashPrefix), "\n")
+	panicErr := &jsonnetPanicError{operation: operation, value: value}
+	log.Errorf("%v\n%s", panicErr, stack)
+	return panicErr
+}
+
+// snippetToAST parses a snippet with go-jsonnet, the panics of the parser are returned as errors.
+func snippetToAST(filename, text string) (root ast.Node, err error) {
+	defer recoverJsonnetPanic("parsing "+filename, &err)
+	return jsonnet.SnippetToAST(filename, text)
+}
+
+// evaluateSnippet evaluates a snippet with the VM, the panics of the evaluator are returned as errors.
+func evaluateSnippet(vm *jsonnet.VM, filename, snippet string) (val string, err error) {
+	defer recoverJsonnetPanic("evaluating "+filename, &err)
+	val, err = vm.EvaluateAnonymousSnippet(filename, snippet)
+	return val, jsonnetCrashError("evaluating "+filename, err)
+}
+
+// jsonnetPanicDiagnostic reports a panic of go-jsonnet on the document it happened on. There is no location to report
+// it at, it is reported at the start of the document.
+func jsonnetPanicDiagnostic(err error) (protocol.Diagnostic, bool) {
+	var panicErr *jsonnetPanicError
+	if !errors.As(err, &panicErr) {
+		return protocol.Diagnostic{}, false
+	}
+	return protocol.Diagnostic{
+		Source:   "jsonnet",
+		Severity: protocol.SeverityError,
+		Message:  panicErr.Error(),
+	}, true
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/go-jsonnet"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type panickingImporter struct{}
+
+func (panickingImporter) Import(string, string) (jsonnet.Contents, string, error) {
+	panic("importer panic")
+}
+
+func TestJsonnetPanics(t *testing.T) {
+	panickingVM := jsonnet.MakeVM()
+	panickingVM.Importer(panickingImporter{})
+
+	testCases := []struct {
+		name     string
+		call     func() error
+		expected string
+	}{
+		{
+			name: "panic in an evaluation",
+			call: func() error {
+				_, err := evaluateWithContext(context.Background(), func() (string, error) {
+					panic("evaluation panic")
+				})
+				return err
+			},
+			expected: "go-jsonnet panicked while evaluating: evaluation panic",
+		},
+		{
+			name: "panic recovered by the evaluator",
+			call: func() error {
+				_, err := evaluateSnippet(panickingVM, "main.jsonnet", "import 'lib.libsonnet'")
+				return err
+			},
+			expected: "go-jsonnet panicked while evaluating main.jsonnet: importer panic",
+		},
+		{
+			name: "panic recovered by the evaluator, in an evaluation",
+			call: func() error {
+				_, err := evaluateWithContext(context.Background(), func() (string, error) {
+					return panickingVM.EvaluateAnonymousSnippet("main.jsonnet", "import 'lib.libsonnet'")
+				})
+				return err
+			},
+			expected: "go-jsonnet panicked while evaluating: importer panic",
+		},
+		{
+			name: "evaluation error",
+			call: func() error {
+				_, err := evaluateSnippet(jsonnet.MakeVM(), "main.jsonnet", "error 'failed'")
+				return err
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.call()
+			require.Error(t, err)
+			var panicErr *jsonnetPanicError
+			if tc.expected == "" {
+				assert.False(t, errors.As(err, &panicErr))
+				return
+			}
+			require.True(t, errors.As(err, &panicErr))
+			assert.EqualError(t, err, tc.expected)
+		})
+	}
+}
+
+func TestJsonnetPanicDiagnostic(t *testing.T) {
+	s := testServer(t, nil)
+	doc := &document{err: &jsonnetPanicError{operation: "parsing main.jsonnet", value: "index out of range"}}
+
+	assert.Equal(t, []protocol.Diagnostic{{
+		Source:   "jsonnet",
+		Severity: protocol.SeverityError,
+		Message:  "go-jsonnet panicked while parsing main.jsonnet: index out of range",
+	}}, s.evalDiags(context.Background(), doc, Configuration{}, nil))
+}
@@ -0,0 +1,366 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+)
+
+// keywordPosition is what can come next at a position of the code, as far as keywords are concerned.
+type keywordPosition int
+
+const (
+	// keywordNone is where no keyword can come: after `.`, `function` or `import`, and in parameter names
+	keywordNone keywordPosition = iota
+	// keywordExpr is the start of an expression
+	keywordExpr
+	// keywordExprEnd is the end of an expression
+	keywordExprEnd
+	// keywordFieldName is the start of a field, or of a local or assert, of an object
+	keywordFieldName
+	// keywordFieldNameEnd is between the name of a field and its visibility marker
+	keywordFieldNameEnd
+	// keywordBindName is the start of a local's name, keywordBindNameEnd its end
+	keywordBindName
+	keywordBindNameEnd
+	// keywordForVar is the variable of a comprehension's for, keywordForVarEnd its end
+	keywordForVar
+	keywordForVarEnd
+)
+
+// keywordFrame is an open bracket, or the whole document, and where the code is in it.
+type keywordFrame struct {
+	bracket  byte
+	position keywordPosition
+	// closed is the position after the bracket is closed, in the enclosing frame
+	closed keywordPosition
+	// params is set for the parentheses of the parameters of a function
+	params bool
+	// conditionals are the ifs of the frame whose else isn't written yet, true once their then is
+	conditionals []bool
+	// binding is set while the binds of an expression's local are written, their commas separate binds
+	binding bool
+	// commas are the commas of the frame, a comprehension only has one element
+	commas int
+	// computed is set for the object fields whose name is computed, the ones of an object comprehension
+	computed bool
+	// comprehension is set after a comprehension's `for x in`
+	comprehension bool
+}
+
+var (
+	expressionKeywords = []string{
+		"assert", "error", "false", "function", "if", "import", "importbin", "importstr", "local", "null", "true",
+	}
+	objectKeywords = []string{"self", "super"}
+	fieldKeywords  = []string{"assert", "local"}
+	// visibilityMarkers are the separators of an object's fields and their values
+	visibilityMarkers = []struct {
+		marker, detail string
+	}{
+		{":", "visible field"},
+		{"::", "hidden field"},
+		{":::", "forcibly visible field"},
+		{"+:", "visible field, merged with the inherited one"},
+		{"+::", "hidden field, merged with the inherited one"},
+		{"+:::", "forcibly visible field, merged with the inherited one"},
+	}
+)
+
+// completionKeywords returns the keywords, and the visibility markers of object fields, that are valid at the end of
+// the text. The text is scanned like the parser would, keeping track of the brackets, the fields, locals and
+// comprehensions, and of the ifs whose then or else aren't written yet, so it also works when the text doesn't parse.
+func completionKeywords(text string) []protocol.CompletionItem {
+	prefix := trailingIdentifier(text)
+	tokens, ok := keywordTokens(text[:len(text)-len(prefix)])
+	if !ok {
+		return nil
+	}
+
+	frames := []*keywordFrame{{position: keywordExpr}}
+	for i, token := range tokens {
+		frame := frames[len(frames)-1]
+		var previous string
+		if i > 0 {
+			previous = tokens[i-1]
+		}
+		switch token {
+		case "(", "[", "{":
+			frames = append(frames, openKeywordFrame(frame, token[0], previous))
+		case ")", "]", "}":
+			if len(frames) > 1 {
+				frames = frames[:len(frames)-1]
+				frames[len(frames)-1].position = frame.closed
+			}
+		case ",":
+			frame.commas++
+			frame.conditionals = nil
+			switch {
+			case frame.params:
+				frame.position = keywordNone
+			case frame.binding:
+				frame.position = keywordBindName
+			case frame.bracket == '{':
+				frame.position, frame.computed = keywordFieldName, false
+			default:
+				frame.position = keywordExpr
+			}
+		case ";":
+			frame.conditionals, frame.binding = nil, false
+			frame.position = keywordExpr
+		case ".":
+			frame.position = keywordNone
+		default:
+			scanKeywordToken(frame, token)
+		}
+	}
+	return keywordItems(frames, prefix)
+}
+
+// openKeywordFrame returns the frame of a bracket opened in a frame, after the previous token.
+func openKeywordFrame(frame *keywordFrame, bracket byte, previous string) *keywordFrame {
+	opened := &keywordFrame{bracket: bracket, position: keywordExpr, closed: keywordExprEnd}
+	switch {
+	case bracket == '{':
+		opened.position = keywordFieldName
+	case bracket == '(' && (previous == "function" || frame.position == keywordBindNameEnd || frame.position == keywordFieldNameEnd):
+		// The parameters of a function, a local function or a method
+		opened.params, opened.position = true, keywordNone
+		opened.closed = frame.position
+		if previous == "function" {
+			opened.closed = keywordExpr
+		}
+	case bracket == '[' && frame.position == keywordFieldName:
+		// A computed field name
+		opened.closed = keywordFieldNameEnd
+		frame.computed = true
+	}
+	return opened
+}
+
+// scanKeywordToken moves the position of the frame past a token that isn't a bracket or a separator.
+func scanKeywordToken(frame *keywordFrame, token string) {
+	switch {
+	case token == "=":
+		frame.position = keywordExpr
+	case !isIdentifierStart(token[0]):
+		// Operators start an expression, or the value of a field after its visibility marker, and literals end one
+		if isOperator(token[0]) {
+			frame.position = keywordExpr
+		} else if frame.position == keywordFieldName {
+			frame.position = keywordFieldNameEnd
+		} else {
+			frame.position = keywordExprEnd
+		}
+	case frame.position == keywordFieldName:
+		switch token {
+		case "local":
+			frame.position = keywordBindName
+		case "assert":
+			frame.position = keywordExpr
+		default:
+			frame.position = keywordFieldNameEnd
+		}
+	case frame.position == keywordBindName:
+		frame.position = keywordBindNameEnd
+	case frame.position == keywordForVar:
+		frame.position = keywordForVarEnd
+	case frame.position == keywordNone && frame.params:
+		// A parameter's name
+	case token == "local":
+		frame.binding = true
+		frame.position = keywordBindName
+	case token == "if" && frame.position == keywordExprEnd && frame.comprehension:
+		frame.position = keywordExpr
+	case token == "if":
+		frame.conditionals = append(frame.conditionals, false)
+		frame.position = keywordExpr
+	case token == "then":
+		if n := len(frame.conditionals); n > 0 {
+			frame.conditionals[n-1] = true
+		}
+		frame.position = keywordExpr
+	case token == "else":
+		if n := len(frame.conditionals); n > 0 {
+			frame.conditionals = frame.conditionals[:n-1]
+		}
+		frame.position = keywordExpr
+	case token == "for":
+		frame.conditionals = nil
+		frame.position = keywordForVar
+	case token == "in":
+		if frame.position == keywordForVarEnd {
+			frame.comprehension = true
+		}
+		frame.position = keywordExpr
+	case token == "function" || token == "import" || token == "importstr" || token == "importbin":
+		frame.position = keywordNone
+	case token == "assert" || token == "error":
+		frame.position = keywordExpr
+	default:
+		frame.position = keywordExprEnd
+	}
+}
+
+// keywordItems returns the keywords that start with the prefix, at the position of the innermost frame.
+func keywordItems(frames []*keywordFrame, prefix string) []protocol.CompletionItem {
+	frame := frames[len(frames)-1]
+	var keywords []string
+	switch frame.position {
+	case keywordExpr:
+		keywords = append(keywords, expressionKeywords...)
+		for _, enclosing := range frames {
+			if enclosing.bracket == '{' && enclosing.position != keywordFieldName && enclosing.position != keywordFieldNameEnd {
+				keywords = append(keywords, objectKeywords...)
+				break
+			}
+		}
+	case keywordExprEnd:
+		// The condition of an if is only followed by its then
+		if n := len(frame.conditionals); n > 0 {
+			if !frame.conditionals[n-1] {
+				keywords = append(keywords, "then")
+				break
+			}
+			keywords = append(keywords, "else")
+		}
+		switch {
+		case frame.comprehension:
+			keywords = append(keywords, "for", "if")
+		case frame.commas == 0 && (frame.bracket == '[' || frame.bracket == '{' && frame.computed):
+			keywords = append(keywords, "for")
+		}
+	case keywordFieldName:
+		keywords = append(keywords, fieldKeywords...)
+	case keywordForVarEnd:
+		keywords = append(keywords, "in")
+	case keywordFieldNameEnd:
+		if prefix != "" {
+			return nil
+		}
+		items := make([]protocol.CompletionItem, 0, len(visibilityMarkers))
+		for _, marker := range visibilityMarkers {
+			items = append(items, protocol.CompletionItem{Label: marker.marker, Kind: protocol.OperatorCompletion, Detail: marker.detail})
+		}
+		return items
+	}
+
+	var items []protocol.CompletionItem
+	for _, keyword := range keywords {
+		if strings.HasPrefix(keyword, prefix) {
+			items = append(items, protocol.CompletionItem{Label: keyword, Kind: protocol.KeywordCompletion})
+		}
+	}
+	return items
+}
+
+// keywordTokens splits the code into identifiers, literals, brackets, separators and operators. Strings and numbers
+// are returned as their first character, and comments are left out. It returns false when the text ends in a string
+// or a comment.
+func keywordTokens(text string) ([]string, bool) {
+	var tokens []string
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '#' || strings.HasPrefix(text[i:], "//"):
+			end := strings.IndexByte(text[i:], '\n')
+			if end == -1 {
+				return nil, false
+			}
+			i += end
+		case strings.HasPrefix(text[i:], "/*"):
+			end := strings.Index(text[i+2:], "*/")
+			if end == -1 {
+				return nil, false
+			}
+			i += end + 4
+		case strings.HasPrefix(text[i:], "|||"):
+			// A text block ends with a line that starts with |||
+			end := strings.Index(text[i+3:], "\n")
+			for end != -1 && !strings.HasPrefix(strings.TrimLeft(text[i+3+end+1:], " \t"), "|||") {
+				next := strings.Index(text[i+3+end+1:], "\n")
+				if next == -1 {
+					end = -1
+					break
+				}
+				end += next + 1
+			}
+			if end == -1 {
+				return nil, false
+			}
+			i += 3 + end + 1
+			i += strings.Index(text[i:], "|||") + 3
+			tokens = append(tokens, "'")
+		case c == '\'' || c == '"' || c == '@' && i+1 < len(text) && (text[i+1] == '\'' || text[i+1] == '"'):
+			verbatim := c == '@'
+			if verbatim {
+				i++
+			}
+			quote := text[i]
+			j := i + 1
+			for ; j < len(text); j++ {
+				if text[j] == '\\' && !verbatim {
+					j++
+				} else if text[j] == quote {
+					if verbatim && j+1 < len(text) && text[j+1] == quote {
+						j++
+						continue
+					}
+					break
+				}
+			}
+			if j >= len(text) {
+				return nil, false
+			}
+			i = j + 1
+			tokens = append(tokens, "'")
+		case isIdentifierStart(c):
+			j := i + 1
+			for j < len(text) && isIdentifierChar(text[j]) {
+				j++
+			}
+			tokens = append(tokens, text[i:j])
+			i = j
+		case isDigit(c):
+			j := i + 1
+			for j < len(text) && (isIdentifierChar(text[j]) || text[j] == '.' ||
+				(text[j] == '+' || text[j] == '-') && (text[j-1] == 'e' || text[j-1] == 'E')) {
+				j++
+			}
+			tokens = append(tokens, "0")
+			i = j
+		case strings.ContainsRune("()[]{},;.", rune(c)):
+			tokens = append(tokens, string(c))
+			i++
+		case c == '$':
+			tokens = append(tokens, "$")
+			i++
+		default:
+			j := i + 1
+			for j < len(text) && isOperator(text[j]) && !strings.HasPrefix(text[j:], "//") && !strings.HasPrefix(text[j:], "/*") && !strings.HasPrefix(text[j:], "|||") {
+				j++
+			}
+			tokens = append(tokens, text[i:j])
+			i = j
+		}
+	}
+	return tokens, true
+}
+
+// trailingIdentifier returns the identifier, or the start of one, that the text ends with.
+func trailingIdentifier(text string) string {
+	i := len(text)
+	for i > 0 && isIdentifierChar(text[i-1]) {
+		i--
+	}
+	if i < len(text) && !isIdentifierStart(text[i]) {
+		return ""
+	}
+	return text[i:]
+}
+
+func isOperator(c byte) bool {
+	return strings.IndexByte("!:~+-&|^=<>*/%", c) != -1
+}
@@ -0,0 +1,202 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+)
+
+func keywordCompletionItems(labels ...string) []protocol.CompletionItem {
+	items := []protocol.CompletionItem{}
+	for _, label := range labels {
+		items = append(items, protocol.CompletionItem{Label: label, Kind: protocol.KeywordCompletion})
+	}
+	return items
+}
+
+func TestCompletionKeywords(t *testing.T) {
+	expression := append([]string{}, expressionKeywords...)
+	objectExpression := append(append([]string{}, expressionKeywords...), objectKeywords...)
+	testCases := []struct {
+		name     string
+		text     string
+		expected []string
+	}{
+		{
+			name:     "start of the document",
+			text:     "",
+			expected: expression,
+		},
+		{
+			name:     "prefix",
+			text:     "local a = im",
+			expected: []string{"import", "importbin", "importstr"},
+		},
+		{
+			name:     "condition",
+			text:     "if a == 1 ",
+			expected: []string{"then"},
+		},
+		{
+			name:     "condition with a call",
+			text:     "if std.isString(a) t",
+			expected: []string{"then"},
+		},
+		{
+			name:     "then branch",
+			text:     "if a then b + 1 ",
+			expected: []string{"else"},
+		},
+		{
+			name:     "nested conditions",
+			text:     "if a then if b then c else d ",
+			expected: []string{"else"},
+		},
+		{
+			name:     "complete condition",
+			text:     "if a then b else c ",
+			expected: nil,
+		},
+		{
+			name:     "object field name",
+			text:     "{\n  a: 1,\n  ",
+			expected: []string{"assert", "local"},
+		},
+		{
+			name: "object field value",
+			text: "{\n  a: s",
+			// self and super only come in objects
+			expected: []string{"self", "super"},
+		},
+		{
+			name:     "visibility markers after a field name",
+			text:     "{ a ",
+			expected: []string{":", "::", ":::", "+:", "+::", "+:::"},
+		},
+		{
+			name:     "visibility markers after a method",
+			text:     "{ f(x, y=1) ",
+			expected: []string{":", "::", ":::", "+:", "+::", "+:::"},
+		},
+		{
+			name:     "visibility markers after a computed field name",
+			text:     "{ [name] ",
+			expected: []string{":", "::", ":::", "+:", "+::", "+:::"},
+		},
+		{
+			name:     "no visibility markers outside of objects",
+			text:     "local a ",
+			expected: nil,
+		},
+		{
+			name:     "array comprehension",
+			text:     "[x * 2 ",
+			expected: []string{"for"},
+		},
+		{
+			name:     "no comprehension after an element",
+			text:     "[1, 2 ",
+			expected: nil,
+		},
+		{
+			name:     "comprehension variable",
+			text:     "[x for x ",
+			expected: []string{"in"},
+		},
+		{
+			name:     "comprehension list",
+			text:     "[x for x in xs ",
+			expected: []string{"for", "if"},
+		},
+		{
+			name:     "comprehension filter",
+			text:     "[x for x in xs if x > 1 ",
+			expected: []string{"for", "if"},
+		},
+		{
+			name:     "object comprehension",
+			text:     "{ [k]: v ",
+			expected: []string{"for"},
+		},
+		{
+			name:     "no comprehension after a field",
+			text:     "{ a: v ",
+			expected: nil,
+		},
+		{
+			name:     "local bind name",
+			text:     "local a = 1, ",
+			expected: nil,
+		},
+		{
+			name:     "local body",
+			text:     "local a = 1, b = 2;\n",
+			expected: expression,
+		},
+		{
+			name:     "local in an object value",
+			text:     "{ a: local b = 1; ",
+			expected: objectExpression,
+		},
+		{
+			name:     "function parameters",
+			text:     "function(a, ",
+			expected: nil,
+		},
+		{
+			name:     "function body",
+			text:     "function(a, b=2) ",
+			expected: expression,
+		},
+		{
+			name:     "call arguments",
+			text:     "f(1, ",
+			expected: expression,
+		},
+		{
+			name:     "field access",
+			text:     "local a = {}; a.i",
+			expected: nil,
+		},
+		{
+			name:     "import path",
+			text:     "import ",
+			expected: nil,
+		},
+		{
+			name:     "string",
+			text:     "local a = 'if ",
+			expected: nil,
+		},
+		{
+			name:     "strings are skipped",
+			text:     "local a = 'then \\' else'; if \"{\" ",
+			expected: []string{"then"},
+		},
+		{
+			name:     "text block",
+			text:     "local a = |||\n  if (\n|||;\nif a ",
+			expected: []string{"then"},
+		},
+		{
+			name:     "comment",
+			text:     "{ a: 1 } // i",
+			expected: nil,
+		},
+		{
+			name:     "comments are skipped",
+			text:     "/* { */ if a # (\n",
+			expected: []string{"then"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var labels []string
+			for _, item := range completionKeywords(tc.text) {
+				labels = append(labels, item.Label)
+			}
+			assert.Equal(t, tc.expected, labels)
+		})
+	}
+}
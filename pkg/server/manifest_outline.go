@@ -0,0 +1,190 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-jsonnet"
+	"github.com/google/go-jsonnet/ast"
+	"github.com/grafana/jsonnet-language-server/pkg/ast/processing"
+	"github.com/grafana/jsonnet-language-server/pkg/nodestack"
+	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+)
+
+type manifestOutlineParams struct {
+	TextDocument protocol.TextDocumentIdentifier `json:"textDocument"`
+}
+
+// manifestOutlineNode is a Kubernetes object of the output of a file, or a field or array element of the output that
+// Kubernetes objects are nested in. The Tanka environments and the lists are objects whose children are their objects.
+type manifestOutlineNode struct {
+	// Name is the name of the object, or the field name or array index of the others
+	Name       string `json:"name"`
+	Kind       string `json:"kind,omitempty"`
+	APIVersion string `json:"apiVersion,omitempty"`
+	Namespace  string `json:"namespace,omitempty"`
+	// Path is the JSON path of the node in the output, made of field names and array indexes, as jsonnet/outputSource
+	// takes it
+	Path []interface{} `json:"path"`
+	// Location is the expression that sets the node, or the array it is in, if it was found
+	Location *protocol.Location    `json:"location,omitempty"`
+	Children []manifestOutlineNode `json:"children,omitempty"`
+}
+
+// manifestOutline handles the jsonnet/manifestOutline request: it evaluates the document and returns the tree of the
+// Kubernetes objects it outputs, for the clients to show what a file deploys.
+func (s *Server) manifestOutline(ctx context.Context, rawParams interface{}) ([]manifestOutlineNode, error) {
+	var params manifestOutlineParams
+	if err := decodeParams(rawParams, &params); err != nil {
+		return nil, err
+	}
+
+	return onLatestDocument(s, "manifestOutline", params.TextDocument.URI, func(doc *document) ([]manifestOutlineNode, error) {
+		if doc.ast == nil {
+			return nil, fmt.Errorf("manifestOutline: %s", errorParsingDocument)
+		}
+		if err := s.requireTrust(ctx, "the manifest outline"); err != nil {
+			return nil, err
+		}
+
+		filename := doc.item.URI.SpanURI().Filename()
+		vm := s.getCancellableVM(ctx, filename)
+		output, err := s.evaluateInTurn(ctx, "manifestOutline", filename, func() (string, error) {
+			return vm.EvaluateAnonymousSnippet(filename, doc.item.Text)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("manifestOutline: unable to evaluate %s: %w", filename, err)
+		}
+		var value interface{}
+		if err := json.Unmarshal([]byte(output), &value); err != nil {
+			return nil, fmt.Errorf("manifestOutline: failed to parse the output: %w", err)
+		}
+
+		outliner := &manifestOutliner{vm: vm, root: doc.ast, uri: doc.item.URI, locations: map[string]*protocol.Location{}}
+		nodes := outliner.outline(value, nil)
+		if nodes == nil {
+			nodes = []manifestOutlineNode{}
+		}
+		return nodes, nil
+	})
+}
+
+type manifestOutliner struct {
+	vm   *jsonnet.VM
+	root ast.Node
+	uri  protocol.DocumentURI
+	// locations are the locations found, by JSON pointer of the fields
+	locations map[string]*protocol.Location
+}
+
+// outline returns the nodes of the Kubernetes objects of a value of the output, the nodes of the fields and array
+// elements that have none are left out.
+func (o *manifestOutliner) outline(value interface{}, path []interface{}) []manifestOutlineNode {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		if node, ok := o.kubernetesObject(value, path); ok {
+			return []manifestOutlineNode{node}
+		}
+		names := make([]string, 0, len(value))
+		for name := range value {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		var nodes []manifestOutlineNode
+		for _, name := range names {
+			nodes = append(nodes, o.group(name, value[name], appendPath(path, name))...)
+		}
+		return nodes
+	case []interface{}:
+		var nodes []manifestOutlineNode
+		for i, element := range value {
+			nodes = append(nodes, o.group(strconv.Itoa(i), element, appendPath(path, i))...)
+		}
+		return nodes
+	}
+	return nil
+}
+
+// group returns the node of a field or array element, if it has Kubernetes objects.
+func (o *manifestOutliner) group(name string, value interface{}, path []interface{}) []manifestOutlineNode {
+	children := o.outline(value, path)
+	if len(children) == 0 {
+		return nil
+	}
+	// A Kubernetes object is its own node
+	if len(children) == 1 && len(children[0].Path) == len(path) {
+		return children
+	}
+	return []manifestOutlineNode{{Name: name, Path: path, Location: o.location(path), Children: children}}
+}
+
+// kubernetesObject returns the node of an object that has an apiVersion and a kind, like Tanka finds them.
+func (o *manifestOutliner) kubernetesObject(object map[string]interface{}, path []interface{}) (manifestOutlineNode, bool) {
+	apiVersion, ok := object["apiVersion"].(string)
+	if !ok {
+		return manifestOutlineNode{}, false
+	}
+	kind, ok := object["kind"].(string)
+	if !ok {
+		return manifestOutlineNode{}, false
+	}
+	node := manifestOutlineNode{Kind: kind, APIVersion: apiVersion, Path: path, Location: o.location(path)}
+	if metadata, ok := object["metadata"].(map[string]interface{}); ok {
+		node.Name, _ = metadata["name"].(string)
+		node.Namespace, _ = metadata["namespace"].(string)
+	}
+	switch {
+	case kind == "Environment" && strings.HasPrefix(apiVersion, "tanka.dev/"):
+		if spec, ok := object["spec"].(map[string]interface{}); ok {
+			node.Namespace, _ = spec["namespace"].(string)
+		}
+		node.Children = o.outline(object["data"], appendPath(path, "data"))
+	case strings.HasSuffix(kind, "List"):
+		node.Children = o.outline(object["items"], appendPath(path, "items"))
+	}
+	return node, true
+}
+
+// location returns the location of the expression that sets the value at a path of the output. The path stops at
+// the first array index, like for jsonnet/outputSource: the elements of arrays can't be found without evaluating them.
+func (o *manifestOutliner) location(path []interface{}) *protocol.Location {
+	var fields []string
+	for _, element := range path {
+		field, ok := element.(string)
+		if !ok {
+			break
+		}
+		fields = append(fields, field)
+	}
+	if len(fields) == 0 {
+		return &protocol.Location{URI: o.uri, Range: position.RangeASTToProtocol(*o.root.Loc())}
+	}
+
+	pointer := jsonPointer(fields)
+	if location, ok := o.locations[pointer]; ok {
+		return location
+	}
+	var location *protocol.Location
+	ranges, err := processing.FindRangesFromIndexList(nodestack.NewNodeStack(o.root), append([]string{"$"}, fields...), o.vm, false)
+	if err == nil && len(ranges) > 0 {
+		uri := protocol.DocumentURI(ranges[0].Filename)
+		if !strings.HasPrefix(string(uri), "file://") {
+			if abs, err := filepath.Abs(ranges[0].Filename); err == nil {
+				uri = protocol.URIFromPath(abs)
+			}
+		}
+		location = &protocol.Location{URI: uri, Range: position.RangeASTToProtocol(ranges[0].FullRange)}
+	}
+	o.locations[pointer] = location
+	return location
+}
+
+func appendPath(path []interface{}, element interface{}) []interface{} {
+	return append(append([]interface{}{}, path...), element)
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const manifestOutlineFile = `local deployment(name) = {
+  apiVersion: 'apps/v1',
+  kind: 'Deployment',
+  metadata: { name: name, namespace: 'default' },
+};
+{
+  app: {
+    deployment: deployment('app'),
+    service: { apiVersion: 'v1', kind: 'Service', metadata: { name: 'app' } },
+    config: { replicas: 1 },
+  },
+  workers: [deployment('worker-1'), deployment('worker-2')],
+  list: { apiVersion: 'v1', kind: 'List', items: [deployment('listed')] },
+  environment: {
+    apiVersion: 'tanka.dev/v1alpha1',
+    kind: 'Environment',
+    metadata: { name: 'dev' },
+    spec: { namespace: 'dev' },
+    data: { deployment: deployment('dev') },
+  },
+}
+`
+
+func TestManifestOutline(t *testing.T) {
+	root := writeProjectFiles(t, map[string]string{"main.jsonnet": manifestOutlineFile})
+	s := renameTestServer(t, root, nil)
+	uri := serverOpenTestFile(t, s, filepath.Join(root, "main.jsonnet"))
+	at := func(startLine, startChar, endLine, endChar uint32) *protocol.Location {
+		return &protocol.Location{URI: uri, Range: protocol.Range{
+			Start: protocol.Position{Line: startLine, Character: startChar},
+			End:   protocol.Position{Line: endLine, Character: endChar},
+		}}
+	}
+
+	result, err := s.NonstandardRequest(context.Background(), "jsonnet/manifestOutline", map[string]interface{}{"textDocument": map[string]interface{}{"uri": string(uri)}})
+	require.NoError(t, err)
+	assert.Equal(t, []manifestOutlineNode{
+		{
+			Name: "app", Path: []interface{}{"app"}, Location: at(6, 2, 10, 3),
+			Children: []manifestOutlineNode{
+				{Name: "app", Kind: "Deployment", APIVersion: "apps/v1", Namespace: "default", Path: []interface{}{"app", "deployment"}, Location: at(7, 4, 7, 33)},
+				{Name: "app", Kind: "Service", APIVersion: "v1", Path: []interface{}{"app", "service"}, Location: at(8, 4, 8, 77)},
+			},
+		},
+		{
+			Name: "dev", Kind: "Environment", APIVersion: "tanka.dev/v1alpha1", Namespace: "dev", Path: []interface{}{"environment"}, Location: at(13, 2, 19, 3),
+			Children: []manifestOutlineNode{
+				{Name: "dev", Kind: "Deployment", APIVersion: "apps/v1", Namespace: "default", Path: []interface{}{"environment", "data", "deployment"}, Location: at(18, 12, 18, 41)},
+			},
+		},
+		{
+			Name: "", Kind: "List", APIVersion: "v1", Path: []interface{}{"list"}, Location: at(12, 2, 12, 73),
+			Children: []manifestOutlineNode{
+				{Name: "listed", Kind: "Deployment", APIVersion: "apps/v1", Namespace: "default", Path: []interface{}{"list", "items", 0}, Location: at(12, 42, 12, 71)},
+			},
+		},
+		{
+			Name: "workers", Path: []interface{}{"workers"}, Location: at(11, 2, 11, 59),
+			Children: []manifestOutlineNode{
+				{Name: "worker-1", Kind: "Deployment", APIVersion: "apps/v1", Namespace: "default", Path: []interface{}{"workers", 0}, Location: at(11, 2, 11, 59)},
+				{Name: "worker-2", Kind: "Deployment", APIVersion: "apps/v1", Namespace: "default", Path: []interface{}{"workers", 1}, Location: at(11, 2, 11, 59)},
+			},
+		},
+	}, result)
+
+	// A file without Kubernetes objects has an empty outline
+	require.NoError(t, s.DidChange(context.Background(), &protocol.DidChangeTextDocumentParams{
+		TextDocument:   protocol.VersionedTextDocumentIdentifier{TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: uri}, Version: 2},
+		ContentChanges: []protocol.TextDocumentContentChangeEvent{{Text: "{ a: 1 }"}},
+	}))
+	result, err = s.NonstandardRequest(context.Background(), "jsonnet/manifestOutline", map[string]interface{}{"textDocument": map[string]interface{}{"uri": string(uri)}})
+	require.NoError(t, err)
+	assert.Equal(t, []manifestOutlineNode{}, result)
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/pprof"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/grafana/jsonnet-language-server/pkg/ast/processing"
+	"github.com/jdbaldry/go-language-server-protocol/jsonrpc2"
+	log "github.com/sirupsen/logrus"
+)
+
+// metrics are exposed in the Prometheus text format by the debug handler.
+type metrics struct {
+	mu          sync.Mutex
+	requests    map[string]*durationMetric
+	evaluations durationMetric
+}
+
+type durationMetric struct {
+	count, errors uint64
+	totalSeconds  float64
+}
+
+func (m *durationMetric) observe(duration time.Duration, err error) {
+	m.count++
+	m.totalSeconds += duration.Seconds()
+	if err != nil {
+		m.errors++
+	}
+}
+
+func newMetrics() *metrics {
+	return &metrics{requests: make(map[string]*durationMetric)}
+}
+
+func (m *metrics) observeRequest(method string, duration time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	request, ok := m.requests[method]
+	if !ok {
+		request = &durationMetric{}
+		m.requests[method] = request
+	}
+	request.observe(duration, err)
+}
+
+func (m *metrics) observeEvaluation(duration time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.evaluations.observe(duration, err)
+}
+
+func (m *metrics) write(w io.Writer, files *fileCache) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	methods := make([]string, 0, len(m.requests))
+	for method := range m.requests {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+
+	fmt.Fprintln(w, "# HELP jsonnet_ls_requests_total Requests and notifications received, by method.")
+	fmt.Fprintln(w, "# TYPE jsonnet_ls_requests_total counter")
+	for _, method := range methods {
+		fmt.Fprintf(w, "jsonnet_ls_requests_total{method=%q} %d\n", method, m.requests[method].count)
+	}
+	fmt.Fprintln(w, "# HELP jsonnet_ls_request_errors_total Requests that returned an error, by method.")
+	fmt.Fprintln(w, "# TYPE jsonnet_ls_request_errors_total counter")
+	for _, method := range methods {
+		fmt.Fprintf(w, "jsonnet_ls_request_errors_total{method=%q} %d\n", method, m.requests[method].errors)
+	}
+	fmt.Fprintln(w, "# HELP jsonnet_ls_request_duration_seconds Time taken to reply to requests, by method.")
+	fmt.Fprintln(w, "# TYPE jsonnet_ls_request_duration_seconds summary")
+	for _, method := range methods {
+		fmt.Fprintf(w, "jsonnet_ls_request_duration_seconds_sum{method=%q} %g\n", method, m.requests[method].totalSeconds)
+		fmt.Fprintf(w, "jsonnet_ls_request_duration_seconds_count{method=%q} %d\n", method, m.requests[method].count)
+	}
+
+	fmt.Fprintln(w, "# HELP jsonnet_ls_evaluation_duration_seconds Time taken to evaluate files.")
+	fmt.Fprintln(w, "# TYPE jsonnet_ls_evaluation_duration_seconds summary")
+	fmt.Fprintf(w, "jsonnet_ls_evaluation_duration_seconds_sum %g\n", m.evaluations.totalSeconds)
+	fmt.Fprintf(w, "jsonnet_ls_evaluation_duration_seconds_count %d\n", m.evaluations.count)
+	fmt.Fprintln(w, "# HELP jsonnet_ls_evaluation_errors_total Evaluations that failed.")
+	fmt.Fprintln(w, "# TYPE jsonnet_ls_evaluation_errors_total counter")
+	fmt.Fprintf(w, "jsonnet_ls_evaluation_errors_total %d\n", m.evaluations.errors)
+
+	hits, misses := processing.TopLevelObjectsCacheStats()
+	fmt.Fprintln(w, "# HELP jsonnet_ls_cache_lookups_total Cache lookups, by cache and result.")
+	fmt.Fprintln(w, "# TYPE jsonnet_ls_cache_lookups_total counter")
+	fmt.Fprintf(w, "jsonnet_ls_cache_lookups_total{cache=\"top_level_objects\",result=\"hit\"} %d\n", hits)
+	fmt.Fprintf(w, "jsonnet_ls_cache_lookups_total{cache=\"top_level_objects\",result=\"miss\"} %d\n", misses)
+	hits, misses = files.stats()
+	fmt.Fprintf(w, "jsonnet_ls_cache_lookups_total{cache=\"imported_files\",result=\"hit\"} %d\n", hits)
+	fmt.Fprintf(w, "jsonnet_ls_cache_lookups_total{cache=\"imported_files\",result=\"miss\"} %d\n", misses)
+}
+
+// InstrumentHandler records the number of requests received by the handler and the time taken to reply to them, and
+// traces each request with a span when tracing is enabled.
+// It also reports the handler's panics to telemetry, and writes a crash bundle for them, before letting them crash the
+// server.
+func (s *Server) InstrumentHandler(handler jsonrpc2.Handler) jsonrpc2.Handler {
+	return func(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+		defer func() {
+			if r := recover(); r != nil {
+				s.reportCrash(r)
+				s.writeCrashBundle(r, debug.Stack(), requestLocation(req.Method(), req.Params()))
+				panic(r)
+			}
+		}()
+
+		s.recordFeatureUsage(req.Method())
+		start := time.Now()
+		// The logs of the handler, and its error, carry the correlation ID of the request
+		id := newRequestID()
+		ctx = withRequestID(ctx, id)
+		ctx, requestSpan := s.startSpan(ctx, req.Method())
+		requestSpan.setAttribute("request.id", id)
+		requestLog := log.WithContext(ctx).WithField("method", req.Method())
+		requestLog.Debug("request started")
+		return handler(ctx, func(ctx context.Context, result interface{}, err error) error {
+			duration := time.Since(start)
+			s.metrics.observeRequest(req.Method(), duration, err)
+			requestSpan.end(err)
+			switch {
+			case err == nil:
+				requestLog.WithField("duration", duration).Debug("request done")
+			case errors.Is(err, context.Canceled):
+				requestLog.WithField("duration", duration).Debug("request cancelled")
+			default:
+				requestLog.WithField("duration", duration).WithError(err).Warn("request failed")
+			}
+			return reply(ctx, result, requestError(id, err))
+		}, req)
+	}
+}
+
+// DebugHandler serves the pprof profiles under /debug/pprof/ and the server's metrics under /metrics.
+func (s *Server) DebugHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		s.metrics.write(w, s.files)
+	})
+	return mux
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jdbaldry/go-language-server-protocol/jsonrpc2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	server := testServer(t, nil)
+
+	handler := server.InstrumentHandler(func(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+		if req.Method() == "textDocument/hover" {
+			return reply(ctx, nil, errors.New("hover failed"))
+		}
+		return reply(ctx, nil, nil)
+	})
+	noopReply := func(context.Context, interface{}, error) error { return nil }
+	for _, method := range []string{"textDocument/definition", "textDocument/definition", "textDocument/hover"} {
+		call, err := jsonrpc2.NewCall(jsonrpc2.NewIntID(1), method, nil)
+		require.NoError(t, err)
+		require.NoError(t, handler(context.Background(), noopReply, call))
+	}
+	server.metrics.observeEvaluation(2*time.Second, nil)
+
+	recorder := httptest.NewRecorder()
+	server.DebugHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	body := recorder.Body.String()
+	assert.Contains(t, body, `jsonnet_ls_requests_total{method="textDocument/definition"} 2`)
+	assert.Contains(t, body, `jsonnet_ls_requests_total{method="textDocument/hover"} 1`)
+	assert.Contains(t, body, `jsonnet_ls_request_errors_total{method="textDocument/definition"} 0`)
+	assert.Contains(t, body, `jsonnet_ls_request_errors_total{method="textDocument/hover"} 1`)
+	assert.Contains(t, body, "jsonnet_ls_evaluation_duration_seconds_sum 2\n")
+	assert.Contains(t, body, "jsonnet_ls_evaluation_duration_seconds_count 1\n")
+	assert.Contains(t, body, `jsonnet_ls_cache_lookups_total{cache="top_level_objects",result="hit"}`)
+	assert.Contains(t, body, `jsonnet_ls_cache_lookups_total{cache="imported_files",result="miss"} 0`)
+}
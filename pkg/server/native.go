@@ -0,0 +1,103 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-jsonnet"
+	"github.com/google/go-jsonnet/ast"
+	"github.com/grafana/jsonnet-language-server/pkg/nodestack"
+	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+)
+
+// nativeCallRegexp matches the beginning of a std.native call, up to the cursor: std.native('name
+var nativeCallRegexp = regexp.MustCompile(`std\.native\(\s*['"]([\w.-]*)$`)
+
+// nativeFunctionName returns the name of the native function if the node is a std.native('name') call.
+func nativeFunctionName(node ast.Node) (string, bool) {
+	args, ok := stdFunctionCall(node, "native")
+	if !ok || len(args) != 1 {
+		return "", false
+	}
+	name, ok := args[0].(*ast.LiteralString)
+	if !ok {
+		return "", false
+	}
+	return name.Value, true
+}
+
+func nativeFunctionSignature(functions []*jsonnet.NativeFunction, name string) (string, bool) {
+	for _, nf := range functions {
+		if nf.Name == name {
+			params := make([]string, len(nf.Params))
+			for i, param := range nf.Params {
+				params[i] = string(param)
+			}
+			return fmt.Sprintf("std.native('%s')(%s)", name, strings.Join(params, ", ")), true
+		}
+	}
+	return "", false
+}
+
+func (s *Server) completionNativeFunctions(filename, line string) []protocol.CompletionItem {
+	match := nativeCallRegexp.FindStringSubmatch(line)
+	if match == nil {
+		return nil
+	}
+
+	var items []protocol.CompletionItem
+	functions := s.projectSettings(s.configurationFor(filename), filename).nativeFunctions
+	for _, nf := range functions {
+		if !strings.HasPrefix(nf.Name, match[1]) {
+			continue
+		}
+		signature, _ := nativeFunctionSignature(functions, nf.Name)
+		items = append(items, protocol.CompletionItem{
+			Label:  nf.Name,
+			Kind:   protocol.FunctionCompletion,
+			Detail: signature,
+		})
+	}
+	return items
+}
+
+// hoverNativeFunction describes the native function named in a std.native('name') call.
+func (s *Server) hoverNativeFunction(filename string, stack *nodestack.NodeStack) *protocol.Hover {
+	if len(stack.Stack) < 2 {
+		return nil
+	}
+	node := stack.Stack[len(stack.Stack)-1]
+	if _, ok := node.(*ast.LiteralString); !ok {
+		return nil
+	}
+	name, ok := nativeFunctionName(stack.Stack[len(stack.Stack)-2])
+	if !ok {
+		return nil
+	}
+
+	value := fmt.Sprintf("Native function `%s` is not available. Native functions are only configured by project detectors, like Tanka's or Kapitan's.", name)
+	if signature, ok := nativeFunctionSignature(s.projectSettings(s.configurationFor(filename), filename).nativeFunctions, name); ok {
+		value = fmt.Sprintf("`%s`\n\nNative function", signature)
+	}
+	return &protocol.Hover{
+		Range:    position.RangeASTToProtocol(*node.Loc()),
+		Contents: protocol.MarkupContent{Kind: protocol.Markdown, Value: value},
+	}
+}
+
+// hoverImportBin describes the file imported by an importbin expression.
+func (s *Server) hoverImportBin(node *ast.ImportBin, importedFrom string) *protocol.Hover {
+	value := fmt.Sprintf("`importbin '%s'`\n\nFile not found", node.File.Value)
+	if foundAt, err := s.getVM(importedFrom).ResolveImport(importedFrom, node.File.Value); err == nil {
+		if info, err := os.Stat(foundAt); err == nil {
+			value = fmt.Sprintf("`importbin '%s'`\n\n`%s` (%d bytes)", node.File.Value, foundAt, info.Size())
+		}
+	}
+	return &protocol.Hover{
+		Range:    position.RangeASTToProtocol(node.LocRange),
+		Contents: protocol.MarkupContent{Kind: protocol.Markdown, Value: value},
+	}
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNativeFunctionCompletion(t *testing.T) {
+	testCases := []struct {
+		name     string
+		tanka    bool
+		line     string
+		expected []string
+	}{
+		{
+			name:     "prefix",
+			tanka:    true,
+			line:     "local a = std.native('parse",
+			expected: []string{"parseJson", "parseYaml"},
+		},
+		{
+			name:     "double quotes",
+			tanka:    true,
+			line:     `local a = std.native("sha`,
+			expected: []string{"sha256"},
+		},
+		{
+			name:  "no native functions without tanka",
+			tanka: false,
+			line:  "local a = std.native('parse",
+		},
+		{
+			name:  "not a native call",
+			tanka: true,
+			line:  "local a = 'parse",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := testServer(t, nil)
+			setConfiguration(server, func(c *Configuration) {
+				c.ResolvePathsWithTanka = tc.tanka
+			})
+
+			var labels []string
+			for _, item := range server.completionNativeFunctions("main.jsonnet", tc.line) {
+				labels = append(labels, item.Label)
+			}
+			assert.Equal(t, tc.expected, labels)
+		})
+	}
+}
+
+func TestNativeFunctionHover(t *testing.T) {
+	server, uri := testServerWithFile(t, nil, "local a = std.native('parseYaml');\na")
+	setConfiguration(server, func(c *Configuration) {
+		c.ResolvePathsWithTanka = true
+	})
+
+	hover, err := server.Hover(context.Background(), &protocol.HoverParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     protocol.Position{Line: 0, Character: 24},
+		},
+	})
+	require.NoError(t, err)
+	require.NotNil(t, hover)
+	assert.Equal(t, "`std.native('parseYaml')(yaml)`\n\nNative function", hover.Contents.Value)
+}
+
+func TestImportBinHover(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "data.bin"), []byte{1, 2, 3}, 0o600))
+	file := filepath.Join(dir, "main.jsonnet")
+	require.NoError(t, os.WriteFile(file, []byte("local data = importbin 'data.bin';\nlocal missing = importbin 'missing.bin';\n[data, missing]"), 0o600))
+
+	server := testServer(t, nil)
+	uri := serverOpenTestFile(t, server, file)
+
+	testCases := []struct {
+		name     string
+		line     uint32
+		expected string
+	}{
+		{
+			name:     "found",
+			line:     0,
+			expected: "`importbin 'data.bin'`\n\n`" + filepath.Join(dir, "data.bin") + "` (3 bytes)",
+		},
+		{
+			name:     "not found",
+			line:     1,
+			expected: "`importbin 'missing.bin'`\n\nFile not found",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			hover, err := server.Hover(context.Background(), &protocol.HoverParams{
+				TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+					TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+					Position:     protocol.Position{Line: tc.line, Character: 30},
+				},
+			})
+			require.NoError(t, err)
+			require.NotNil(t, hover)
+			assert.Equal(t, tc.expected, hover.Contents.Value)
+		})
+	}
+}
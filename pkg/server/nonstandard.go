@@ -0,0 +1,100 @@
+package server
+
+import (
+	"context"
+	"runtime"
+	"sort"
+
+	"github.com/grafana/jsonnet-language-server/pkg/ast/processing"
+)
+
+func (s *Server) NonstandardRequest(ctx context.Context, method string, params interface{}) (interface{}, error) {
+	switch method {
+	case "jsonnet/serverStatus":
+		return s.serverStatus(), nil
+	case "jsonnet/outputSource":
+		return s.outputSource(ctx, params)
+	case "jsonnet/exportSummary":
+		return s.exportSummaryRequest(ctx, params)
+	case "jsonnet/configurationSchema":
+		return s.configurationSchema(), nil
+	case "jsonnet/manifestOutline":
+		return s.manifestOutline(ctx, params)
+	case "jsonnet/tankaEnvironments":
+		return s.tankaEnvironmentsRequest(ctx, params)
+	case "jsonnet/selectTankaEnvironment":
+		return s.selectTankaEnvironmentRequest(ctx, params)
+	case "jsonnet/didChangeTrust":
+		return s.didChangeTrust(params)
+	case "textDocument/inlineValue":
+		return s.inlineValue(ctx, params)
+	}
+
+	return nil, notImplemented(method)
+}
+
+// serverStatusResult is the response to jsonnet/serverStatus. It is meant to be attached to bug reports.
+type serverStatusResult struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+
+	Cache struct {
+		Documents          int `json:"documents"`
+		TopLevelObjects    int `json:"topLevelObjects"`
+		DiagnosticsQueued  int `json:"diagnosticsQueued"`
+		DiagnosticsRunning int `json:"diagnosticsRunning"`
+	} `json:"cache"`
+
+	LastEvaluations []evaluationStats `json:"lastEvaluations"`
+
+	Memory struct {
+		AllocBytes      uint64 `json:"allocBytes"`
+		TotalAllocBytes uint64 `json:"totalAllocBytes"`
+		SysBytes        uint64 `json:"sysBytes"`
+		HeapObjects     uint64 `json:"heapObjects"`
+		NumGC           uint32 `json:"numGC"`
+	} `json:"memory"`
+	Goroutines int `json:"goroutines"`
+}
+
+func (s *Server) serverStatus() serverStatusResult {
+	result := serverStatusResult{
+		Name:       s.name,
+		Version:    s.version,
+		Goroutines: runtime.NumGoroutine(),
+	}
+
+	s.cache.mu.RLock()
+	result.Cache.Documents = len(s.cache.docs)
+	s.cache.mu.RUnlock()
+
+	s.cache.diagMutex.RLock()
+	result.Cache.DiagnosticsQueued = len(s.cache.diagQueue)
+	s.cache.diagMutex.RUnlock()
+
+	s.cache.diagRunning.Range(func(_, _ any) bool {
+		result.Cache.DiagnosticsRunning++
+		return true
+	})
+	result.Cache.TopLevelObjects = processing.TopLevelObjectsCacheSize()
+
+	s.status.mu.Lock()
+	result.LastEvaluations = make([]evaluationStats, 0, len(s.status.lastEvaluations))
+	for _, stats := range s.status.lastEvaluations {
+		result.LastEvaluations = append(result.LastEvaluations, stats)
+	}
+	s.status.mu.Unlock()
+	sort.Slice(result.LastEvaluations, func(i, j int) bool {
+		return result.LastEvaluations[i].FinishedAt.After(result.LastEvaluations[j].FinishedAt)
+	})
+
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	result.Memory.AllocBytes = memStats.Alloc
+	result.Memory.TotalAllocBytes = memStats.TotalAlloc
+	result.Memory.SysBytes = memStats.Sys
+	result.Memory.HeapObjects = memStats.HeapObjects
+	result.Memory.NumGC = memStats.NumGC
+
+	return result
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerStatus(t *testing.T) {
+	server, uri := testServerWithFile(t, nil, "{}")
+
+	server.startEvaluationStatus(uri)(errors.New("evaluation failed"))
+
+	result, err := server.NonstandardRequest(context.Background(), "jsonnet/serverStatus", nil)
+	require.NoError(t, err)
+
+	status, ok := result.(serverStatusResult)
+	require.True(t, ok)
+	assert.Equal(t, 1, status.Cache.Documents)
+	require.Len(t, status.LastEvaluations, 1)
+	assert.Equal(t, uri, status.LastEvaluations[0].URI)
+	assert.True(t, status.LastEvaluations[0].Failed)
+	assert.Positive(t, status.Goroutines)
+	assert.Positive(t, status.Memory.SysBytes)
+}
+
+func TestNonstandardRequestUnknownMethod(t *testing.T) {
+	server := testServer(t, nil)
+
+	_, err := server.NonstandardRequest(context.Background(), "jsonnet/unknown", nil)
+	assert.Error(t, err)
+}
+
+func TestOutputSource(t *testing.T) {
+	testCases := []struct {
+		name           string
+		path           []interface{}
+		targetFilename string
+		targetRange    protocol.Range
+	}{
+		{
+			name:           "clobbered field",
+			path:           []interface{}{"a", "hello2"},
+			targetFilename: "testdata/goto-overrides.jsonnet",
+			targetRange: protocol.Range{
+				Start: protocol.Position{Line: 24, Character: 4},
+				End:   protocol.Position{Line: 24, Character: 23},
+			},
+		},
+		{
+			name:           "field from an import",
+			path:           []interface{}{"a", "nested1", "from_import"},
+			targetFilename: "testdata/goto-overrides-imported.jsonnet",
+			targetRange: protocol.Range{
+				Start: protocol.Position{Line: 2, Character: 4},
+				End:   protocol.Position{Line: 2, Character: 23},
+			},
+		},
+		{
+			name:           "path stops at array indexes",
+			path:           []interface{}{"clobbered_map", 0.0, "a"},
+			targetFilename: "testdata/goto-overrides.jsonnet",
+			targetRange: protocol.Range{
+				Start: protocol.Position{Line: 43, Character: 2},
+				End:   protocol.Position{Line: 43, Character: 31},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := NewServer("any", "test version", nil, Configuration{JPaths: []string{"testdata"}})
+			uri := serverOpenTestFile(t, server, "testdata/goto-overrides.jsonnet")
+
+			// The params are received as generic JSON values
+			result, err := server.NonstandardRequest(context.Background(), "jsonnet/outputSource", map[string]interface{}{
+				"textDocument": map[string]interface{}{"uri": string(uri)},
+				"path":         tc.path,
+			})
+			require.NoError(t, err)
+			assert.Equal(t, protocol.Definition{{URI: absURI(t, tc.targetFilename), Range: tc.targetRange}}, result)
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/grafana/jsonnet-language-server/pkg/ast/processing"
+	"github.com/grafana/jsonnet-language-server/pkg/nodestack"
+	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+)
+
+// outputSourceParams are the parameters of jsonnet/outputSource.
+// Path is the JSON path of a value in the file's evaluated output, made of field names and array indexes.
+type outputSourceParams struct {
+	TextDocument protocol.TextDocumentIdentifier `json:"textDocument"`
+	Path         []interface{}                   `json:"path"`
+}
+
+// outputSource answers "where did this field come from?" for a value of the evaluated output, for example in
+// the client's evaluation preview. The fields of the path are followed through the file's objects, imports and
+// overrides like Definition does, so the locations are the expressions that set the field's value.
+// The path stops at the first array index: the elements of arrays can't be found without evaluating them.
+func (s *Server) outputSource(ctx context.Context, rawParams interface{}) (protocol.Definition, error) {
+	var params outputSourceParams
+	if err := decodeParams(rawParams, &params); err != nil {
+		return nil, err
+	}
+
+	links, err := onLatestDocument(s, "outputSource", params.TextDocument.URI, func(doc *document) ([]protocol.DefinitionLink, error) {
+		if doc.ast == nil {
+			return nil, fmt.Errorf("outputSource: %s", errorParsingDocument)
+		}
+
+		indexList := []string{"$"}
+		for _, element := range params.Path {
+			field, ok := element.(string)
+			if !ok {
+				break
+			}
+			indexList = append(indexList, field)
+		}
+		if len(indexList) == 1 {
+			// The whole output comes from the file
+			return []protocol.DefinitionLink{{
+				TargetURI:   doc.item.URI,
+				TargetRange: position.RangeASTToProtocol(*doc.ast.Loc()),
+			}}, nil
+		}
+
+		vm := s.getCancellableVM(ctx, doc.item.URI.SpanURI().Filename())
+		objectRanges, err := processing.FindRangesFromIndexList(nodestack.NewNodeStack(doc.ast), indexList, vm, false)
+		if err != nil {
+			return nil, err
+		}
+		var links []protocol.DefinitionLink
+		for _, o := range objectRanges {
+			links = append(links, protocol.DefinitionLink{
+				TargetURI:            protocol.DocumentURI(o.Filename),
+				TargetRange:          position.RangeASTToProtocol(o.FullRange),
+				TargetSelectionRange: position.RangeASTToProtocol(o.SelectionRange),
+			})
+		}
+		return absoluteTargetURIs(links)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var locations protocol.Definition
+	for _, link := range links {
+		locations = append(locations, protocol.Location{URI: link.TargetURI, Range: link.TargetRange})
+	}
+	return locations, nil
+}
+
+// decodeParams decodes the parameters of a non-standard request, which are received as generic JSON values.
+func decodeParams(rawParams interface{}, params interface{}) error {
+	data, err := json.Marshal(rawParams)
+	if err != nil {
+		return fmt.Errorf("invalid params: %w", err)
+	}
+	if err := json.Unmarshal(data, params); err != nil {
+		return fmt.Errorf("invalid params: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/grafana/jsonnet-language-server/pkg/utils"
+	"github.com/jdbaldry/go-language-server-protocol/jsonrpc2"
+)
+
+// ConfigurationOverride is the configuration of the files that match a glob, which overrides the global one.
+type ConfigurationOverride struct {
+	// Glob matches the files, or their directories. Relative globs are relative to the workspace folder.
+	Glob string
+	// Settings are the names of the overridden settings
+	Settings []string
+	// Configuration holds the values of the overridden settings
+	Configuration Configuration
+}
+
+// overridableSettings are the settings that can be overridden, with the functions that copy them.
+var overridableSettings = map[string]func(dst, src *Configuration){
+	"resolve_paths_with_tanka": func(dst, src *Configuration) { dst.ResolvePathsWithTanka = src.ResolvePathsWithTanka },
+	"project_detectors":        func(dst, src *Configuration) { dst.ProjectDetectors = src.ProjectDetectors },
+	"jpath":                    func(dst, src *Configuration) { dst.JPaths = src.JPaths },
+	"ext_vars":                 func(dst, src *Configuration) { dst.ExtVars = src.ExtVars },
+	"ext_code":                 func(dst, src *Configuration) { dst.ExtCode = src.ExtCode },
+	"tla_vars":                 func(dst, src *Configuration) { dst.TLAVars = src.TLAVars },
+	"tla_code":                 func(dst, src *Configuration) { dst.TLACode = src.TLACode },
+	"ext_vars_from_files":      func(dst, src *Configuration) { dst.ExtVarsFromFiles = src.ExtVarsFromFiles },
+	"import_aliases":           func(dst, src *Configuration) { dst.ImportAliases = src.ImportAliases },
+	"formatting": func(dst, src *Configuration) {
+		dst.FormattingOptions, dst.FormattingPasses = src.FormattingOptions, src.FormattingPasses
+	},
+	"enable_eval_diagnostics": func(dst, src *Configuration) { dst.EnableEvalDiagnostics = src.EnableEvalDiagnostics },
+	"enable_lint_diagnostics": func(dst, src *Configuration) { dst.EnableLintDiagnostics = src.EnableLintDiagnostics },
+	"lint_mixin_overrides":    func(dst, src *Configuration) { dst.LintMixinOverrides = src.LintMixinOverrides },
+	"fix_all":                 func(dst, src *Configuration) { dst.FixAll = src.FixAll },
+	"fix_all_on_save":         func(dst, src *Configuration) { dst.FixAllOnSave = src.FixAllOnSave },
+}
+
+// matches tells whether the glob matches the file or one of its directories.
+func (o ConfigurationOverride) matches(workspaceFolder, path string) bool {
+	glob := o.Glob
+	if !filepath.IsAbs(glob) {
+		glob = filepath.Join(workspaceFolder, glob)
+	}
+	glob = filepath.ToSlash(filepath.Clean(glob))
+	for name := filepath.Clean(path); ; name = filepath.Dir(name) {
+		if utils.MatchGlob(glob, filepath.ToSlash(name)) {
+			return true
+		}
+		if parent := filepath.Dir(name); parent == name {
+			return false
+		}
+	}
+}
+
+// configurationFor returns the configuration of a file: the global one, with the settings of the overrides that
+// match the file. The overrides that come last win.
+func (s *Server) configurationFor(path string) Configuration {
+	config := s.config()
+	for i := range config.Overrides {
+		override := &config.Overrides[i]
+		if !override.matches(s.workspaceFolder, path) {
+			continue
+		}
+		for _, setting := range override.Settings {
+			overridableSettings[setting](&config, &override.Configuration)
+		}
+	}
+	return config
+}
+
+// parseOverrides parses the overrides setting, a list of globs with the settings of the files that match them.
+func (s *Server) parseOverrides(unparsed interface{}) ([]ConfigurationOverride, error) {
+	svList, ok := unparsed.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unsupported settings value for overrides. expected array of objects. got: %T", unparsed)
+	}
+
+	overrides := make([]ConfigurationOverride, len(svList))
+	for i, v := range svList {
+		object, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("overrides[%d]: expected json object. got: %T", i, v)
+		}
+		glob, ok := object["glob"].(string)
+		if !ok || glob == "" {
+			return nil, fmt.Errorf("overrides[%d]: glob is required", i)
+		}
+		settings, ok := object["settings"].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("overrides[%d]: unsupported settings value for settings. expected json object. got: %T", i, object["settings"])
+		}
+
+		override := ConfigurationOverride{Glob: s.expandPlaceholders(glob)}
+		for name, value := range settings {
+			if _, ok := overridableSettings[name]; !ok {
+				return nil, fmt.Errorf("overrides[%d]: %q cannot be overridden", i, name)
+			}
+			if err := s.applySetting(&override.Configuration, name, value); err != nil {
+				return nil, fmt.Errorf("overrides[%d]: %s", i, strings.TrimPrefix(err.Error(), jsonrpc2.ErrInvalidParams.Error()+": "))
+			}
+			override.Settings = append(override.Settings, name)
+		}
+		sort.Strings(override.Settings)
+		overrides[i] = override
+	}
+	return overrides, nil
+}
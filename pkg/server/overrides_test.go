@@ -0,0 +1,138 @@
+package server
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigurationOverrides(t *testing.T) {
+	root := writeProjectFiles(t, map[string]string{
+		"lib/global/config.libsonnet":    `'global'`,
+		"lib/prod/config.libsonnet":      `'prod'`,
+		"environments/dev/main.jsonnet":  `[import 'config.libsonnet', std.extVar('env')]`,
+		"environments/prod/main.jsonnet": `[import 'config.libsonnet', std.extVar('env')]`,
+	})
+
+	s := testServer(t, nil)
+	s.workspaceFolder = root
+	err := s.DidChangeConfiguration(context.TODO(), &protocol.DidChangeConfigurationParams{
+		Settings: map[string]interface{}{
+			"jpath":                   []interface{}{"${workspaceFolder}/lib/global"},
+			"ext_vars":                map[string]interface{}{"env": "default"},
+			"enable_lint_diagnostics": true,
+			"overrides": []interface{}{
+				map[string]interface{}{
+					"glob": "environments/*",
+					"settings": map[string]interface{}{
+						"ext_vars":                map[string]interface{}{"env": "environment"},
+						"enable_lint_diagnostics": false,
+					},
+				},
+				map[string]interface{}{
+					"glob": "environments/prod/**/*.jsonnet",
+					"settings": map[string]interface{}{
+						"jpath":      []interface{}{"${workspaceFolder}/lib/prod"},
+						"ext_vars":   map[string]interface{}{"env": "prod"},
+						"formatting": map[string]interface{}{"Indent": 4},
+					},
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name           string
+		file           string
+		expectedOutput string
+		expectedLint   bool
+		expectedIndent int
+	}{
+		{
+			name:           "directory override",
+			file:           "environments/dev/main.jsonnet",
+			expectedOutput: `["global", "environment"]`,
+			expectedIndent: 2,
+		},
+		{
+			name:           "overrides that come last win",
+			file:           "environments/prod/main.jsonnet",
+			expectedOutput: `["prod", "prod"]`,
+			expectedIndent: 4,
+		},
+		{
+			name:           "no override",
+			file:           "main.jsonnet",
+			expectedLint:   true,
+			expectedIndent: 2,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			file := filepath.Join(root, filepath.FromSlash(tc.file))
+			config := s.configurationFor(file)
+			assert.Equal(t, tc.expectedLint, config.EnableLintDiagnostics)
+			assert.Equal(t, tc.expectedIndent, config.FormattingOptions.Indent)
+			if tc.expectedOutput == "" {
+				return
+			}
+			output, err := s.getVM(file).EvaluateFile(file)
+			require.NoError(t, err)
+			assert.JSONEq(t, tc.expectedOutput, output)
+		})
+	}
+}
+
+func TestConfigurationOverridesErrors(t *testing.T) {
+	testCases := []struct {
+		name        string
+		overrides   interface{}
+		expectedErr string
+	}{
+		{
+			name:        "not a list",
+			overrides:   map[string]interface{}{},
+			expectedErr: "JSON RPC invalid params: overrides parsing failed: unsupported settings value for overrides. expected array of objects. got: map[string]interface {}",
+		},
+		{
+			name:        "missing glob",
+			overrides:   []interface{}{map[string]interface{}{"settings": map[string]interface{}{}}},
+			expectedErr: "JSON RPC invalid params: overrides parsing failed: overrides[0]: glob is required",
+		},
+		{
+			name:        "missing settings",
+			overrides:   []interface{}{map[string]interface{}{"glob": "*"}},
+			expectedErr: "JSON RPC invalid params: overrides parsing failed: overrides[0]: unsupported settings value for settings. expected json object. got: <nil>",
+		},
+		{
+			name: "global setting",
+			overrides: []interface{}{map[string]interface{}{
+				"glob":     "*",
+				"settings": map[string]interface{}{"enable_telemetry": true},
+			}},
+			expectedErr: `JSON RPC invalid params: overrides parsing failed: overrides[0]: "enable_telemetry" cannot be overridden`,
+		},
+		{
+			name: "invalid value",
+			overrides: []interface{}{map[string]interface{}{
+				"glob":     "*",
+				"settings": map[string]interface{}{"jpath": "lib"},
+			}},
+			expectedErr: "JSON RPC invalid params: overrides parsing failed: overrides[0]: unsupported settings value for jpath. expected array of strings. got: string",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := testServer(t, nil)
+			err := s.DidChangeConfiguration(context.TODO(), &protocol.DidChangeConfigurationParams{
+				Settings: map[string]interface{}{"overrides": tc.overrides},
+			})
+			assert.EqualError(t, err, tc.expectedErr)
+		})
+	}
+}
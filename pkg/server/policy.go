@@ -0,0 +1,145 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/google/go-jsonnet"
+	"github.com/google/go-jsonnet/ast"
+	"github.com/grafana/jsonnet-language-server/pkg/ast/processing"
+	"github.com/grafana/jsonnet-language-server/pkg/nodestack"
+	"github.com/grafana/jsonnet-language-server/pkg/policy"
+	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// getPolicyDiags checks the document's output against the configured policy bundles. The violations are reported
+// on the fields that produced the offending values, when they can be found in the document.
+func (s *Server) getPolicyDiags(ctx context.Context, doc *document) []protocol.Diagnostic {
+	bundles := s.config().PolicyBundles
+	if len(bundles) == 0 || doc.val == "" || doc.ast == nil || len(doc.linesChangedSinceAST) > 0 {
+		return nil
+	}
+	var output interface{}
+	if err := json.Unmarshal([]byte(doc.val), &output); err != nil {
+		// The post-renderers may output something else than JSON
+		return nil
+	}
+
+	attributor := &violationAttributor{
+		vm:       s.getCancellableVM(ctx, doc.item.URI.SpanURI().Filename()),
+		root:     doc.ast,
+		filename: doc.item.URI.SpanURI().Filename(),
+		used:     map[string]int{},
+	}
+	var diags []protocol.Diagnostic
+	for _, path := range bundles {
+		bundle, err := s.policyLoader.Load(path)
+		if err != nil {
+			log.Errorf("getPolicyDiags: unable to load policy bundle %s: %v", path, err)
+			diags = append(diags, protocol.Diagnostic{
+				Severity: protocol.SeverityError,
+				Source:   "policy",
+				Message:  fmt.Sprintf("unable to load policy bundle %s: %v", path, err),
+			})
+			continue
+		}
+		for _, violation := range bundle.Check(output) {
+			if ctx.Err() != nil {
+				return nil
+			}
+			diag := protocol.Diagnostic{
+				Range:    attributor.violationRange(violation),
+				Severity: protocol.SeverityError,
+				Source:   "policy",
+				Message:  violation.Message(),
+			}
+			if violation.Policy.Name != "" {
+				diag.Code = violation.Policy.Name
+			}
+			diags = append(diags, diag)
+		}
+	}
+	return diags
+}
+
+// violationAttributor finds the locations, in a document, of the values that violate policies.
+type violationAttributor struct {
+	vm       *jsonnet.VM
+	root     ast.Node
+	filename string
+	// used counts the violations attributed to each literal value, so that the violations of identical values
+	// are spread over the fields that set them
+	used map[string]int
+}
+
+func (a *violationAttributor) violationRange(violation policy.Violation) protocol.Range {
+	// The offending value is a literal of the document
+	if field := violation.Policy.Field; field != "" {
+		value := violation.Object[field]
+		if literals := a.fieldLiterals(field, value); len(literals) > 0 {
+			key := fmt.Sprintf("%p/%s/%v", violation.Policy, field, value)
+			literal := literals[a.used[key]%len(literals)]
+			a.used[key]++
+			return position.RangeASTToProtocol(*literal.Loc())
+		}
+	}
+
+	// The fields are followed down to the object, as far as they can be: the elements of arrays can't be found
+	// without evaluating them
+	indexList := []string{"$"}
+	for _, element := range violation.Path {
+		name, ok := element.(string)
+		if !ok {
+			break
+		}
+		indexList = append(indexList, name)
+	}
+	if field := violation.Policy.Field; field != "" && len(indexList) == len(violation.Path)+1 {
+		indexList = append(indexList, field)
+	}
+	for ; len(indexList) > 1; indexList = indexList[:len(indexList)-1] {
+		ranges, err := processing.FindRangesFromIndexList(nodestack.NewNodeStack(a.root), indexList, a.vm, false)
+		if err != nil || len(ranges) == 0 {
+			continue
+		}
+		if ranges[0].Filename == a.filename {
+			return position.RangeASTToProtocol(ranges[0].SelectionRange)
+		}
+	}
+	return protocol.Range{}
+}
+
+// fieldLiterals returns the literal values of the document's fields that have the name and the value.
+func (a *violationAttributor) fieldLiterals(name string, value interface{}) []ast.Node {
+	var literals []ast.Node
+	walk(a.root, func(node ast.Node) {
+		object, ok := node.(*ast.DesugaredObject)
+		if !ok {
+			return
+		}
+		for _, field := range object.Fields {
+			if fieldName, ok := field.Name.(*ast.LiteralString); ok && fieldName.Value == name && literalEquals(field.Body, value) {
+				literals = append(literals, field.Body)
+			}
+		}
+	})
+	return literals
+}
+
+// literalEquals tells whether a node is a literal with the JSON value.
+func literalEquals(node ast.Node, value interface{}) bool {
+	switch node := node.(type) {
+	case *ast.LiteralString:
+		return node.Value == value
+	case *ast.LiteralNumber:
+		number, err := strconv.ParseFloat(node.OriginalString, 64)
+		return err == nil && number == value
+	case *ast.LiteralBoolean:
+		return node.Value == value
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetPolicyDiags(t *testing.T) {
+	bundle := filepath.Join(t.TempDir(), "bundle.json")
+	require.NoError(t, os.WriteFile(bundle, []byte(`{
+		"policies": [
+			{
+				"name": "no-latest-images",
+				"match": "has(object.image)",
+				"validate": "!object.image.endsWith(':latest')",
+				"field": "image",
+				"message": "images must be pinned"
+			},
+			{
+				"name": "resources-required",
+				"match": "has(object.image)",
+				"validate": "has(object.resources)",
+				"message": "containers must set resources"
+			},
+			{
+				"name": "replicas",
+				"match": "has(object.kind) && object.kind == 'Deployment'",
+				"validate": "object.spec.replicas >= 2",
+				"field": "spec",
+				"message": "deployments must have 2 replicas"
+			}
+		]
+	}`), 0o600))
+
+	s, fileURI := testServerWithFile(t, nil, `local container(image) = { image: image, resources: {} };
+{
+  deployment: {
+    kind: 'Deployment',
+    spec: { replicas: 1 },
+    containers: [
+      container('api:latest'),
+      { image: 'sidecar:latest' },
+    ],
+  },
+}`)
+	setConfiguration(s, func(c *Configuration) {
+		c.EnableEvalDiagnostics = true
+		c.PolicyBundles = []string{bundle}
+	})
+	doc, err := s.cache.get(fileURI)
+	require.NoError(t, err)
+
+	assert.Equal(t, []protocol.Diagnostic{
+		{
+			// The object's fields are followed down to the field
+			Range:    protocol.Range{Start: protocol.Position{Line: 4, Character: 4}, End: protocol.Position{Line: 4, Character: 8}},
+			Severity: protocol.SeverityError,
+			Code:     "replicas",
+			Source:   "policy",
+			Message:  "replicas: deployments must have 2 replicas",
+		},
+		{
+			// The value doesn't come from a literal of a field, the path stops at the array
+			Range:    protocol.Range{Start: protocol.Position{Line: 5, Character: 4}, End: protocol.Position{Line: 5, Character: 14}},
+			Severity: protocol.SeverityError,
+			Code:     "no-latest-images",
+			Source:   "policy",
+			Message:  "no-latest-images: images must be pinned",
+		},
+		{
+			Range:    protocol.Range{Start: protocol.Position{Line: 7, Character: 15}, End: protocol.Position{Line: 7, Character: 31}},
+			Severity: protocol.SeverityError,
+			Code:     "no-latest-images",
+			Source:   "policy",
+			Message:  "no-latest-images: images must be pinned",
+		},
+		{
+			Range:    protocol.Range{Start: protocol.Position{Line: 5, Character: 4}, End: protocol.Position{Line: 5, Character: 14}},
+			Severity: protocol.SeverityError,
+			Code:     "resources-required",
+			Source:   "policy",
+			Message:  "resources-required: containers must set resources",
+		},
+	}, s.getEvalDiags(context.Background(), doc))
+}
+
+func TestGetPolicyDiagsInvalidBundle(t *testing.T) {
+	s, fileURI := testServerWithFile(t, nil, `{}`)
+	setConfiguration(s, func(c *Configuration) {
+		c.EnableEvalDiagnostics = true
+		c.PolicyBundles = []string{filepath.Join(t.TempDir(), "missing.json")}
+	})
+	doc, err := s.cache.get(fileURI)
+	require.NoError(t, err)
+
+	diags := s.getEvalDiags(context.Background(), doc)
+	require.Len(t, diags, 1)
+	assert.Equal(t, "policy", diags[0].Source)
+	assert.Contains(t, diags[0].Message, "unable to load policy bundle")
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+)
+
+// postRenderTimeout limits the time that each post-renderer can take.
+const postRenderTimeout = 30 * time.Second
+
+// PostRendererConfiguration is a command that transforms the evaluated output of the files, like the post-renderers
+// of Helm and of the Jsonnet plugins of CD tools. It reads the output on its standard input and writes the new one
+// on its standard output. It applies to all files, unless FileMatch restricts it to the files matching its globs.
+type PostRendererConfiguration struct {
+	Command   []string `mapstructure:"command"`
+	FileMatch []string `mapstructure:"fileMatch"`
+}
+
+func (c PostRendererConfiguration) matchesFile(filename string) bool {
+	if len(c.FileMatch) == 0 {
+		return true
+	}
+	return matchesFileGlobs(c.FileMatch, filename)
+}
+
+// postRenderError is the failure of a post-renderer, with what it printed.
+type postRenderError struct {
+	command string
+	output  string
+	err     error
+}
+
+func (e *postRenderError) Error() string {
+	if e.output == "" {
+		return fmt.Sprintf("post-renderer %s failed: %v", e.command, e.err)
+	}
+	return fmt.Sprintf("post-renderer %s failed: %v\n%s", e.command, e.err, e.output)
+}
+
+// postRender pipes the evaluated output of a file through the post-renderers that apply to it, in order.
+// The commands run in the file's directory, with its path in the JSONNET_FILE environment variable.
+func (s *Server) postRender(ctx context.Context, filename, output string) (string, error) {
+	for _, renderer := range s.config().PostRenderers {
+		if !renderer.matchesFile(filename) {
+			continue
+		}
+		if err := s.requireTrust(ctx, "post-rendering"); err != nil {
+			return "", err
+		}
+
+		commandLine, err := s.prepareCommand(ctx, "post_renderers", renderer.Command)
+		if err != nil {
+			return "", &postRenderError{command: renderer.Command[0], err: err}
+		}
+
+		commandCtx, cancel := context.WithTimeout(ctx, postRenderTimeout)
+		cmd := exec.CommandContext(commandCtx, commandLine[0], commandLine[1:]...)
+		cmd.Dir = filepath.Dir(filename)
+		cmd.Env = append(os.Environ(), "JSONNET_FILE="+filename)
+		cmd.Stdin = strings.NewReader(output)
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout, cmd.Stderr = &stdout, &stderr
+
+		err = cmd.Run()
+		cancel()
+		if err != nil {
+			// Policy checkers like conftest report their failures on the standard output
+			printed := strings.TrimSpace(stderr.String() + "\n" + stdout.String())
+			return "", &postRenderError{command: renderer.Command[0], output: printed, err: err}
+		}
+		output = stdout.String()
+	}
+	return output, nil
+}
+
+// postRenderDiagnostic reports the failure of a post-renderer at the start of the document, it isn't tied to a
+// location in the file.
+func postRenderDiagnostic(err error) protocol.Diagnostic {
+	return protocol.Diagnostic{
+		Severity: protocol.SeverityError,
+		Source:   "post-render",
+		Message:  err.Error(),
+	}
+}
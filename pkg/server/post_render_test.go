@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostRender(t *testing.T) {
+	testCases := []struct {
+		name        string
+		renderers   []PostRendererConfiguration
+		expected    string
+		expectedErr string
+	}{
+		{
+			name:     "no post-renderers",
+			expected: `{"a": 1}`,
+		},
+		{
+			name: "pipeline",
+			renderers: []PostRendererConfiguration{
+				{Command: []string{"sed", "s/1/2/"}},
+				{Command: []string{"sh", "-c", `echo "# $(basename "$JSONNET_FILE")"; cat`}},
+			},
+			expected: "# main.jsonnet\n{\"a\": 2}",
+		},
+		{
+			name: "other files",
+			renderers: []PostRendererConfiguration{
+				{Command: []string{"sed", "s/1/2/"}, FileMatch: []string{"*.libsonnet"}},
+			},
+			expected: `{"a": 1}`,
+		},
+		{
+			name: "failure",
+			renderers: []PostRendererConfiguration{
+				{Command: []string{"sh", "-c", "echo 'FAIL - deny: a must be 2'; exit 1"}},
+			},
+			expectedErr: "post-renderer sh failed: exit status 1\nFAIL - deny: a must be 2",
+		},
+		{
+			name: "missing command",
+			renderers: []PostRendererConfiguration{
+				{Command: []string{"jsonnet-ls-missing-command"}},
+			},
+			expectedErr: `post-renderer jsonnet-ls-missing-command failed: exec: "jsonnet-ls-missing-command": executable file not found in $PATH`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := NewServer("any", "test version", nil, Configuration{PostRenderers: tc.renderers, SkipCommandConfirmation: true})
+			output, err := server.postRender(context.Background(), filepath.Join(t.TempDir(), "main.jsonnet"), `{"a": 1}`)
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, output)
+		})
+	}
+}
+
+func TestPostRenderDiagnostics(t *testing.T) {
+	s, fileURI := testServerWithFile(t, nil, `{ replicas: 1 }`)
+	setConfiguration(s, func(c *Configuration) {
+		c.EnableEvalDiagnostics = true
+		c.SkipCommandConfirmation = true
+		c.PostRenderers = []PostRendererConfiguration{
+			{Command: []string{"sh", "-c", "echo 'replicas must be at least 2' >&2; exit 1"}},
+		}
+	})
+	doc, err := s.cache.get(fileURI)
+	require.NoError(t, err)
+
+	assert.Equal(t, []protocol.Diagnostic{{
+		Severity: protocol.SeverityError,
+		Source:   "post-render",
+		Message:  "post-renderer sh failed: exit status 1\nreplicas must be at least 2",
+	}}, s.getEvalDiags(context.Background(), doc))
+}
+
+func TestEvalFilePostRender(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "main.jsonnet")
+	require.NoError(t, os.WriteFile(filename, []byte(`{ a: 1 }`), 0o600))
+	server := NewServer("any", "test version", nil, Configuration{
+		PostRenderers:           []PostRendererConfiguration{{Command: []string{"tr", "a", "b"}}},
+		SkipCommandConfirmation: true,
+	})
+
+	arg, err := json.Marshal(filename)
+	require.NoError(t, err)
+	result, err := server.ExecuteCommand(context.Background(), &protocol.ExecuteCommandParams{
+		Command:   "jsonnet.evalFile",
+		Arguments: []json.RawMessage{arg},
+	})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"b": 1}`, result.(string))
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"github.com/google/go-jsonnet"
+	"github.com/grafana/jsonnet-language-server/pkg/bazel"
+	"github.com/grafana/jsonnet-language-server/pkg/kapitan"
+)
+
+// projectDetector finds the projects of a tool, Tanka or Kapitan for example, and returns the settings that the
+// tool evaluates their files with.
+type projectDetector interface {
+	// detect returns the settings of the project that the file is part of, or nil if it isn't part of one.
+	detect(path string) *projectSettings
+}
+
+// projectSettings are what a project contributes to the evaluation of its files.
+type projectSettings struct {
+	// jpaths are added to the configured ones, the paths on the right win
+	jpaths  []string
+	extVars map[string]string
+	extCode map[string]string
+	tlaVars map[string]string
+	tlaCode map[string]string
+	// nativeFunctions are the functions available through std.native
+	nativeFunctions []*jsonnet.NativeFunction
+	// imports are the special imports of the tool, like Tanka's `tk`, which are resolved before files
+	imports map[string]func() (jsonnet.Contents, string, error)
+}
+
+// defaultProjectDetectors are the detectors that are enabled when the project_detectors setting isn't set.
+var defaultProjectDetectors = []string{"jb", "bazel", "qbec", "kapitan"}
+
+// newProjectDetectors returns the detectors that can be enabled, by name.
+func newProjectDetectors() map[string]projectDetector {
+	return map[string]projectDetector{
+		"tanka":   tankaDetector{},
+		"jb":      jbDetector{},
+		"bazel":   &bazelDetector{resolver: bazel.NewResolver()},
+		"qbec":    qbecDetector{},
+		"kapitan": &kapitanDetector{loader: kapitan.NewLoader()},
+	}
+}
+
+// enabledProjectDetectors returns the names of the detectors to run, in order. Tanka's comes first when paths are
+// resolved with Tanka.
+func (c Configuration) enabledProjectDetectors() []string {
+	names := c.ProjectDetectors
+	if names == nil {
+		names = defaultProjectDetectors
+	}
+	if c.ResolvePathsWithTanka && !contains(names, "tanka") {
+		names = append([]string{"tanka"}, names...)
+	}
+	return names
+}
+
+// projectSettings returns the settings that the enabled detectors contribute to the evaluation of a file. The
+// settings of a detector override those of the detectors before it.
+func (s *Server) projectSettings(config Configuration, path string) *projectSettings {
+	merged := &projectSettings{
+		extVars: map[string]string{},
+		extCode: map[string]string{},
+		tlaVars: map[string]string{},
+		tlaCode: map[string]string{},
+		imports: map[string]func() (jsonnet.Contents, string, error){},
+	}
+	for _, name := range config.enabledProjectDetectors() {
+		detector, ok := s.projectDetectors[name]
+		if !ok {
+			continue
+		}
+		settings := detector.detect(path)
+		if settings == nil {
+			continue
+		}
+		merged.jpaths = append(merged.jpaths, settings.jpaths...)
+		overrideVars(merged.extVars, merged.extCode, settings.extVars, settings.extCode)
+		overrideVars(merged.tlaVars, merged.tlaCode, settings.tlaVars, settings.tlaCode)
+		merged.nativeFunctions = append(merged.nativeFunctions, settings.nativeFunctions...)
+		for name, importer := range settings.imports {
+			merged.imports[name] = importer
+		}
+	}
+	return merged
+}
+
+// overrideVars sets the overriding variables, whether they are strings or code, in place of the existing ones.
+func overrideVars(vars, code, overridingVars, overridingCode map[string]string) {
+	for name, value := range overridingVars {
+		delete(code, name)
+		vars[name] = value
+	}
+	for name, value := range overridingCode {
+		delete(vars, name)
+		code[name] = value
+	}
+}
+
+func contains(list []string, value string) bool {
+	for _, element := range list {
+		if element == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,23 @@
+package server
+
+import (
+	"github.com/grafana/jsonnet-language-server/pkg/bazel"
+	log "github.com/sirupsen/logrus"
+)
+
+// bazelDetector finds Bazel workspaces and imports from the paths that rules_jsonnet gives jsonnet.
+type bazelDetector struct {
+	resolver *bazel.Resolver
+}
+
+func (d *bazelDetector) detect(path string) *projectSettings {
+	root, ok := bazel.FindWorkspace(path)
+	if !ok {
+		return nil
+	}
+	paths, err := d.resolver.ImportPaths(root, path)
+	if err != nil {
+		log.Warnf("Unable to read the jsonnet rules of the Bazel workspace %s: %v", root, err)
+	}
+	return &projectSettings{jpaths: paths}
+}
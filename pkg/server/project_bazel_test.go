@@ -0,0 +1,28 @@
+package server
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBazelImports(t *testing.T) {
+	root := writeProjectFiles(t, map[string]string{
+		"WORKSPACE": "",
+		"app/BUILD": `jsonnet_to_json(name = "main", src = "main.jsonnet", outs = ["main.json"], deps = ["//third_party/k8s"])`,
+		// Imported from the workspace's root and from the dependency's import path
+		"app/main.jsonnet":                       `(import 'common/name.libsonnet') + (import 'k8s.libsonnet')`,
+		"common/name.libsonnet":                  `{ name: 'app' }`,
+		"third_party/k8s/BUILD":                  `jsonnet_library(name = "k8s", srcs = glob(["vendor/*.libsonnet"]), imports = ["vendor"])`,
+		"third_party/k8s/vendor/k8s.libsonnet":   `{ kind: 'Deployment' }`,
+		"third_party/k8s/vendor/other.libsonnet": `{}`,
+	})
+
+	server := NewServer("any", "test version", nil, Configuration{})
+	file := filepath.Join(root, "app", "main.jsonnet")
+	output, err := server.getVM(file).EvaluateFile(file)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"kind": "Deployment", "name": "app"}`, output)
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// jbDetector finds the projects of jsonnet-bundler, by their `jsonnetfile.json`, and imports from their `vendor`
+// directory, where jb installs the dependencies.
+type jbDetector struct{}
+
+func (jbDetector) detect(path string) *projectSettings {
+	root, ok := findParentWith(path, "jsonnetfile.json")
+	if !ok {
+		return nil
+	}
+	return &projectSettings{jpaths: []string{filepath.Join(root, "vendor")}}
+}
+
+// findParentWith returns the closest directory, from the path up, that has the file.
+func findParentWith(path, file string) (string, bool) {
+	dir, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		dir = filepath.Dir(dir)
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, file)); err == nil {
+			return dir, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
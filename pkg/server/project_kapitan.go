@@ -0,0 +1,90 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	"github.com/google/go-jsonnet"
+	"github.com/google/go-jsonnet/ast"
+	"github.com/grafana/jsonnet-language-server/pkg/kapitan"
+	log "github.com/sirupsen/logrus"
+)
+
+// kapitanDetector finds Kapitan projects and evaluates their files like `kapitan compile` does: with the project's
+// search paths, the variables of the target that compiles them and Kapitan's `inventory` native function.
+type kapitanDetector struct {
+	loader *kapitan.Loader
+}
+
+func (d *kapitanDetector) detect(path string) *projectSettings {
+	root, ok := kapitan.FindRoot(path)
+	if !ok {
+		return nil
+	}
+	project, err := d.loader.Load(root)
+	if err != nil {
+		log.Warnf("Unable to load the Kapitan inventory of %s: %v", root, err)
+		return nil
+	}
+
+	settings := &projectSettings{nativeFunctions: kapitanNativeFunctions(project)}
+	// The paths on the right win, Kapitan tries its search paths in order
+	for i := len(project.SearchPaths) - 1; i >= 0; i-- {
+		settings.jpaths = append(settings.jpaths, project.SearchPaths[i])
+	}
+
+	target := project.TargetFor(path)
+	if target == nil {
+		log.Debugf("No Kapitan target compiles %s", path)
+		return settings
+	}
+	settings.extVars, settings.extCode = map[string]string{}, map[string]string{}
+	for name, value := range target.Vars() {
+		if str, ok := value.(string); ok {
+			settings.extVars[name] = str
+			continue
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			log.Warnf("Unable to set the Kapitan variable %s of target %s: %v", name, target.Name, err)
+			continue
+		}
+		settings.extCode[name] = string(data)
+	}
+	return settings
+}
+
+// kapitanNativeFunctions returns the native functions that the jsonnet files of a Kapitan project use to read its
+// inventory.
+func kapitanNativeFunctions(project *kapitan.Project) []*jsonnet.NativeFunction {
+	return []*jsonnet.NativeFunction{
+		{
+			Name:   "inventory",
+			Params: ast.Identifiers{"target", "inv_path"},
+			Func: func(args []interface{}) (interface{}, error) {
+				name, ok := args[0].(string)
+				if !ok {
+					return nil, fmt.Errorf("inventory: target must be a string, got %T", args[0])
+				}
+				targets := project.Targets
+				if invPath, ok := args[1].(string); ok && invPath != "" {
+					if !filepath.IsAbs(invPath) {
+						invPath = filepath.Join(project.Root, invPath)
+					}
+					if filepath.Clean(invPath) != project.InventoryPath {
+						var err error
+						if targets, err = kapitan.LoadTargets(invPath); err != nil {
+							return nil, fmt.Errorf("inventory: %w", err)
+						}
+					}
+				}
+				target, ok := targets[name]
+				if !ok {
+					return nil, fmt.Errorf("inventory: target %q not found", name)
+				}
+				return target.Inventory(), nil
+			},
+		},
+	}
+}
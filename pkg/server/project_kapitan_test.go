@@ -0,0 +1,105 @@
+package server
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeKapitanProject writes a Kapitan project with a `dev` and a `prod` target that compile `components/main.jsonnet`.
+func writeKapitanProject(t *testing.T) string {
+	t.Helper()
+	return writeProjectFiles(t, map[string]string{
+		"inventory/classes/common.yml": `
+parameters:
+  image: app:${version}
+  kapitan:
+    compile:
+      - input_type: jsonnet
+        input_paths:
+          - components/main.jsonnet
+`,
+		"inventory/targets/dev.yml": `
+classes:
+  - common
+parameters:
+  version: "1.1"
+  kapitan:
+    vars:
+      replicas: 1
+`,
+		"inventory/targets/prod.yml": `
+classes:
+  - common
+parameters:
+  version: "1.0"
+`,
+		"lib/kapitan.libjsonnet": `{
+  inventory(target=std.extVar('target'), inv_path='inventory/'):: std.native('inventory')(target, inv_path),
+}`,
+		"lib/utils.libsonnet": `{ name: 'app' }`,
+		"components/main.jsonnet": `
+local kap = import 'lib/kapitan.libjsonnet';
+local utils = import 'utils.libsonnet';
+{
+  target: std.extVar('target'),
+  replicas: std.extVar('replicas'),
+  name: utils.name,
+  image: kap.inventory().parameters.image,
+  prod: kap.inventory('prod').parameters.image,
+}`,
+	})
+}
+
+func TestKapitanEvaluation(t *testing.T) {
+	testCases := []struct {
+		name          string
+		configuration Configuration
+		expected      string
+		expectedErr   string
+	}{
+		{
+			name:     "inventory",
+			expected: `{"image": "app:1.1", "name": "app", "prod": "app:1.0", "replicas": 1, "target": "dev"}`,
+		},
+		{
+			name:          "configured external variables win",
+			configuration: Configuration{ExtVars: map[string]string{"target": "prod"}, ExtCode: map[string]string{"replicas": "3"}},
+			expected:      `{"image": "app:1.0", "name": "app", "prod": "app:1.0", "replicas": 3, "target": "prod"}`,
+		},
+		{
+			name:          "detector disabled",
+			configuration: Configuration{ProjectDetectors: []string{"jb"}},
+			expectedErr:   "couldn't open import \"lib/kapitan.libjsonnet\"",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			root := writeKapitanProject(t)
+			server := NewServer("any", "test version", nil, tc.configuration)
+
+			output, err := server.getVM(filepath.Join(root, "components", "main.jsonnet")).EvaluateFile(filepath.Join(root, "components", "main.jsonnet"))
+			if tc.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.JSONEq(t, tc.expected, output)
+		})
+	}
+}
+
+func TestKapitanNativeFunctionErrors(t *testing.T) {
+	root := writeKapitanProject(t)
+	server := NewServer("any", "test version", nil, Configuration{})
+
+	_, err := server.getVM(filepath.Join(root, "components", "main.jsonnet")).EvaluateAnonymousSnippet(
+		filepath.Join(root, "components", "other.jsonnet"),
+		"std.native('inventory')('staging', 'inventory/')",
+	)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `inventory: target "staging" not found`)
+}
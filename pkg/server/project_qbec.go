@@ -0,0 +1,112 @@
+package server
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// qbecDetector finds qbec applications, by their `qbec.yaml`, and evaluates their files like qbec does for the
+// first of their environments, by name: with their library paths, and qbec's and the application's external
+// variables.
+type qbecDetector struct{}
+
+// qbecApp is the part of a `qbec.yaml` file that the evaluation depends on.
+type qbecApp struct {
+	Spec struct {
+		LibPaths       []string                   `yaml:"libPaths"`
+		BaseProperties map[string]interface{}     `yaml:"baseProperties"`
+		Environments   map[string]qbecEnvironment `yaml:"environments"`
+		Vars           struct {
+			External []struct {
+				Name    string      `yaml:"name"`
+				Default interface{} `yaml:"default"`
+			} `yaml:"external"`
+		} `yaml:"vars"`
+	} `yaml:"spec"`
+}
+
+type qbecEnvironment struct {
+	DefaultNamespace string                 `yaml:"defaultNamespace"`
+	Properties       map[string]interface{} `yaml:"properties"`
+}
+
+func (qbecDetector) detect(path string) *projectSettings {
+	root, ok := findParentWith(path, "qbec.yaml")
+	if !ok {
+		return nil
+	}
+	data, err := os.ReadFile(filepath.Join(root, "qbec.yaml"))
+	if err != nil {
+		log.Warnf("Unable to read the qbec application of %s: %v", root, err)
+		return nil
+	}
+	var app qbecApp
+	if err := yaml.Unmarshal(data, &app); err != nil {
+		log.Warnf("Unable to read the qbec application of %s: %v", root, err)
+		return nil
+	}
+
+	settings := &projectSettings{extVars: map[string]string{}, extCode: map[string]string{}}
+	for _, libPath := range app.Spec.LibPaths {
+		if !filepath.IsAbs(libPath) {
+			libPath = filepath.Join(root, libPath)
+		}
+		settings.jpaths = append(settings.jpaths, libPath)
+	}
+	for _, variable := range app.Spec.Vars.External {
+		setQbecVar(settings, variable.Name, variable.Default)
+	}
+
+	names := make([]string, 0, len(app.Spec.Environments))
+	for name := range app.Spec.Environments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		return settings
+	}
+	environment := app.Spec.Environments[names[0]]
+	properties := mergeProperties(mergeProperties(map[string]interface{}{}, app.Spec.BaseProperties), environment.Properties)
+	settings.extVars["qbec.io/env"] = names[0]
+	settings.extVars["qbec.io/tag"] = ""
+	settings.extVars["qbec.io/defaultNs"] = environment.DefaultNamespace
+	settings.extVars["qbec.io/cleanMode"] = "off"
+	setQbecVar(settings, "qbec.io/envProperties", properties)
+	return settings
+}
+
+// setQbecVar sets an external variable, as a string if it is one and as code otherwise.
+func setQbecVar(settings *projectSettings, name string, value interface{}) {
+	if value == nil {
+		return
+	}
+	if str, ok := value.(string); ok {
+		settings.extVars[name] = str
+		return
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		log.Warnf("Unable to set the qbec variable %s: %v", name, err)
+		return
+	}
+	settings.extCode[name] = string(data)
+}
+
+// mergeProperties merges the properties of an environment into the base ones, objects are merged recursively.
+func mergeProperties(base, overlay map[string]interface{}) map[string]interface{} {
+	for key, value := range overlay {
+		overlayObject, ok := value.(map[string]interface{})
+		baseObject, baseOK := base[key].(map[string]interface{})
+		if ok && baseOK {
+			base[key] = mergeProperties(baseObject, overlayObject)
+			continue
+		}
+		base[key] = value
+	}
+	return base
+}
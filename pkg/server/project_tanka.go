@@ -0,0 +1,46 @@
+package server
+
+import (
+	"sync"
+
+	"github.com/google/go-jsonnet"
+	tankaJsonnet "github.com/grafana/tanka/pkg/jsonnet/implementations/goimpl"
+	"github.com/grafana/tanka/pkg/jsonnet/jpath"
+	"github.com/grafana/tanka/pkg/jsonnet/native"
+	log "github.com/sirupsen/logrus"
+)
+
+// tankaDetector evaluates files like Tanka does: with the import paths of their environment, when they are part of
+// one, and with Tanka's native functions and `tk` import. As it applies to all files, it is only enabled when paths
+// are resolved with Tanka.
+type tankaDetector struct{}
+
+// tkLibsonnet holds the contents of Tanka's `tk` import. Tanka's importer isn't exported, so it is read once through a Tanka VM.
+var tkLibsonnet = sync.OnceValues(func() (tkContents, error) {
+	data, foundAt, err := tankaJsonnet.MakeRawVM(nil, nil, nil, 0).ImportData("", "tk")
+	return tkContents{contents: jsonnet.MakeContents(data), foundAt: foundAt}, err
+})
+
+type tkContents struct {
+	contents jsonnet.Contents
+	foundAt  string
+}
+
+func importTk() (jsonnet.Contents, string, error) {
+	tk, err := tkLibsonnet()
+	return tk.contents, tk.foundAt, err
+}
+
+func (tankaDetector) detect(path string) *projectSettings {
+	settings := &projectSettings{
+		nativeFunctions: native.Funcs(),
+		imports:         map[string]func() (jsonnet.Contents, string, error){"tk": importTk},
+	}
+	jpaths, _, _, err := jpath.Resolve(path, false)
+	if err != nil {
+		log.Debugf("Unable to resolve jpath for %s: %s", path, err)
+		return settings
+	}
+	settings.jpaths = jpaths
+	return settings
+}
@@ -0,0 +1,192 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-jsonnet"
+	"github.com/google/go-jsonnet/ast"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDetector contributes the same settings to all files.
+type fakeDetector struct {
+	settings projectSettings
+}
+
+func (d fakeDetector) detect(string) *projectSettings {
+	settings := d.settings
+	return &settings
+}
+
+func writeProjectFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	}
+	return root
+}
+
+func TestProjectSettings(t *testing.T) {
+	root := writeProjectFiles(t, map[string]string{
+		"first/lib.libsonnet":  `'first'`,
+		"second/lib.libsonnet": `'second'`,
+		"main.jsonnet": `function(tla, code) {
+  lib: import 'lib.libsonnet',
+  tla: tla,
+  code: code,
+  ext: std.extVar('ext'),
+  overridden: std.extVar('overridden'),
+  native: std.native('answer')(),
+  special: import 'special',
+}`,
+	})
+
+	server := NewServer("any", "test version", nil, Configuration{
+		ProjectDetectors: []string{"first", "second"},
+		ExtCode:          map[string]string{"overridden": "'configured'"},
+	})
+	server.projectDetectors["first"] = fakeDetector{projectSettings{
+		jpaths:  []string{filepath.Join(root, "first")},
+		extVars: map[string]string{"ext": "first", "overridden": "first"},
+		tlaVars: map[string]string{"tla": "first"},
+		nativeFunctions: []*jsonnet.NativeFunction{{
+			Name: "answer",
+			Func: func([]interface{}) (interface{}, error) { return float64(41), nil },
+		}},
+	}}
+	server.projectDetectors["second"] = fakeDetector{projectSettings{
+		jpaths:  []string{filepath.Join(root, "second")},
+		extCode: map[string]string{"ext": "'second'"},
+		tlaCode: map[string]string{"tla": "{ second: true }", "code": "1 + 1"},
+		nativeFunctions: []*jsonnet.NativeFunction{{
+			Name:   "answer",
+			Params: ast.Identifiers{},
+			Func:   func([]interface{}) (interface{}, error) { return float64(42), nil },
+		}},
+		imports: map[string]func() (jsonnet.Contents, string, error){
+			"special": func() (jsonnet.Contents, string, error) {
+				return jsonnet.MakeContents("'special'"), "<special>", nil
+			},
+		},
+	}}
+
+	file := filepath.Join(root, "main.jsonnet")
+	output, err := server.getVM(file).EvaluateFile(file)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"lib": "second",
+		"tla": {"second": true},
+		"code": 2,
+		"ext": "second",
+		"overridden": "configured",
+		"native": 42,
+		"special": "special"
+	}`, output)
+}
+
+func TestEnabledProjectDetectors(t *testing.T) {
+	testCases := []struct {
+		name          string
+		configuration Configuration
+		expected      []string
+	}{
+		{
+			name:     "default",
+			expected: defaultProjectDetectors,
+		},
+		{
+			name:          "tanka",
+			configuration: Configuration{ResolvePathsWithTanka: true},
+			expected:      append([]string{"tanka"}, defaultProjectDetectors...),
+		},
+		{
+			name:          "configured",
+			configuration: Configuration{ProjectDetectors: []string{"kapitan", "tanka"}, ResolvePathsWithTanka: true},
+			expected:      []string{"kapitan", "tanka"},
+		},
+		{
+			name:          "none",
+			configuration: Configuration{ProjectDetectors: []string{}},
+			expected:      []string{},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.configuration.enabledProjectDetectors())
+		})
+	}
+}
+
+func TestJbDetector(t *testing.T) {
+	root := writeProjectFiles(t, map[string]string{
+		"jsonnetfile.json":                         `{}`,
+		"vendor/github.com/org/lib/main.libsonnet": `{ name: 'lib' }`,
+		"environments/default/main.jsonnet":        `(import 'github.com/org/lib/main.libsonnet').name`,
+	})
+
+	server := NewServer("any", "test version", nil, Configuration{})
+	file := filepath.Join(root, "environments", "default", "main.jsonnet")
+	output, err := server.getVM(file).EvaluateFile(file)
+	require.NoError(t, err)
+	assert.Equal(t, "\"lib\"\n", output)
+	assert.Nil(t, jbDetector{}.detect(t.TempDir()))
+}
+
+func TestQbecDetector(t *testing.T) {
+	root := writeProjectFiles(t, map[string]string{
+		"qbec.yaml": `
+apiVersion: qbec.io/v1alpha1
+kind: App
+metadata:
+  name: demo
+spec:
+  libPaths:
+    - lib
+  baseProperties:
+    replicas: 1
+    resources: {cpu: 100m, memory: 128Mi}
+  environments:
+    prod:
+      defaultNamespace: demo-prod
+    dev:
+      defaultNamespace: demo-dev
+      properties:
+        resources: {memory: 256Mi}
+  vars:
+    external:
+      - name: image_tag
+        default: latest
+      - name: replicas
+        default: 2
+      - name: required
+`,
+		"lib/utils.libsonnet": `{ name: 'demo' }`,
+		"components/app.jsonnet": `{
+  name: (import 'utils.libsonnet').name,
+  env: std.extVar('qbec.io/env'),
+  namespace: std.extVar('qbec.io/defaultNs'),
+  properties: std.extVar('qbec.io/envProperties'),
+  tag: std.extVar('image_tag'),
+  replicas: std.extVar('replicas'),
+}`,
+	})
+
+	server := NewServer("any", "test version", nil, Configuration{})
+	file := filepath.Join(root, "components", "app.jsonnet")
+	output, err := server.getVM(file).EvaluateFile(file)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"name": "demo",
+		"env": "dev",
+		"namespace": "demo-dev",
+		"properties": {"replicas": 1, "resources": {"cpu": "100m", "memory": "256Mi"}},
+		"tag": "latest",
+		"replicas": 2
+	}`, output)
+}
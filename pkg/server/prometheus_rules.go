@@ -0,0 +1,170 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/go-jsonnet/ast"
+	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
+	"github.com/grafana/jsonnet-language-server/pkg/promql"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// formatVerbRegexp matches the verbs of Jsonnet format strings, `%s` and `%(name)s` for example.
+var formatVerbRegexp = regexp.MustCompile(`%(?:\([^)]*\))?[-#0 +]*(?:\*|[0-9]+)?(?:\.(?:\*|[0-9]+))?[a-zA-Z%]`)
+
+// invalidRule is a rule of a Prometheus rule group whose expression isn't valid PromQL.
+type invalidRule struct {
+	name string
+	expr string
+	err  error
+}
+
+// getPrometheusRuleDiags validates the expressions of the Prometheus rule groups found in the document's output.
+// The errors are reported on the strings of the document that the expressions come from.
+func getPrometheusRuleDiags(doc *document) []protocol.Diagnostic {
+	if doc.val == "" || doc.ast == nil || len(doc.linesChangedSinceAST) > 0 {
+		return nil
+	}
+	var output interface{}
+	if err := json.Unmarshal([]byte(doc.val), &output); err != nil {
+		return nil
+	}
+	rules := findInvalidRules(output, nil)
+	if len(rules) == 0 {
+		return nil
+	}
+
+	var literals []*ast.LiteralString
+	walk(doc.ast, func(node ast.Node) {
+		if literal, ok := node.(*ast.LiteralString); ok && literal.LocRange.Begin.Line != 0 {
+			literals = append(literals, literal)
+		}
+	})
+
+	var diags []protocol.Diagnostic
+	for _, rule := range rules {
+		found := false
+		for _, literal := range literals {
+			if !literalGenerates(literal.Value, rule.expr) {
+				continue
+			}
+			found = true
+			diags = append(diags, protocol.Diagnostic{
+				Range:    position.RangeASTToProtocol(literal.LocRange),
+				Severity: protocol.SeverityError,
+				Source:   "promql",
+				Message:  fmt.Sprintf("invalid PromQL in %s: %v", rule.name, rule.err),
+			})
+		}
+		if !found {
+			log.Debugf("getPrometheusRuleDiags: the expression of %s doesn't come from a string of %s", rule.name, doc.item.URI)
+		}
+	}
+	return diags
+}
+
+// findInvalidRules finds the rule groups, `{ groups: [{ name: ..., rules: [...] }] }`, in the value and returns
+// their rules that have an invalid expression.
+func findInvalidRules(value interface{}, rules []invalidRule) []invalidRule {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		if groups, ok := ruleGroups(value); ok {
+			for _, group := range groups {
+				for _, rule := range group["rules"].([]interface{}) {
+					rules = appendInvalidRule(rules, rule)
+				}
+			}
+			return rules
+		}
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			rules = findInvalidRules(value[key], rules)
+		}
+	case []interface{}:
+		for _, element := range value {
+			rules = findInvalidRules(element, rules)
+		}
+	}
+	return rules
+}
+
+// ruleGroups returns the groups of an object that has the structure of a Prometheus rules file.
+func ruleGroups(object map[string]interface{}) ([]map[string]interface{}, bool) {
+	list, ok := object["groups"].([]interface{})
+	if !ok || len(list) == 0 {
+		return nil, false
+	}
+	groups := make([]map[string]interface{}, 0, len(list))
+	for _, item := range list {
+		group, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if _, ok := group["name"].(string); !ok {
+			return nil, false
+		}
+		if _, ok := group["rules"].([]interface{}); !ok {
+			return nil, false
+		}
+		groups = append(groups, group)
+	}
+	return groups, true
+}
+
+func appendInvalidRule(rules []invalidRule, value interface{}) []invalidRule {
+	rule, ok := value.(map[string]interface{})
+	if !ok {
+		return rules
+	}
+	expr, ok := rule["expr"].(string)
+	if !ok {
+		return rules
+	}
+	if _, err := promql.Check(expr); err != nil {
+		name := "rule"
+		if alert, ok := rule["alert"].(string); ok {
+			name = "alert " + alert
+		} else if record, ok := rule["record"].(string); ok {
+			name = "recording rule " + record
+		}
+		rules = append(rules, invalidRule{name: name, expr: expr, err: err})
+	}
+	return rules
+}
+
+// literalGenerates tells whether a string of the document is the expression, or the format string that it was
+// formatted from.
+func literalGenerates(literal, expr string) bool {
+	if strings.TrimSpace(literal) == strings.TrimSpace(expr) {
+		return true
+	}
+	verbs := formatVerbRegexp.FindAllStringIndex(literal, -1)
+	// A format string that is only verbs, '%s' for example, would match any expression
+	if len(verbs) == 0 || strings.TrimSpace(formatVerbRegexp.ReplaceAllString(literal, "")) == "" {
+		return false
+	}
+
+	pattern := "^\\s*"
+	last := 0
+	for _, verb := range verbs {
+		pattern += regexp.QuoteMeta(literal[last:verb[0]])
+		if literal[verb[0]:verb[1]] == "%%" {
+			pattern += "%"
+		} else {
+			pattern += "(?s:.*?)"
+		}
+		last = verb[1]
+	}
+	pattern += regexp.QuoteMeta(literal[last:]) + "\\s*$"
+	re, err := regexp.Compile(pattern)
+	return err == nil && re.MatchString(expr)
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetPrometheusRuleDiags(t *testing.T) {
+	testCases := []struct {
+		name        string
+		fileContent string
+		expected    []protocol.Diagnostic
+	}{
+		{
+			name: "valid rules",
+			fileContent: `{
+  groups: [{ name: 'api', rules: [{ alert: 'Down', expr: 'up == 0' }] }],
+}`,
+		},
+		{
+			name:        "not a rules file",
+			fileContent: `{ groups: ['a'], expr: 'rate(' }`,
+		},
+		{
+			name: "invalid expression",
+			fileContent: `{
+  groups: [{
+    name: 'api',
+    rules: [
+      { record: 'job:requests:rate5m', expr: 'sum by (job) (rate(requests_total))' },
+    ],
+  }],
+}`,
+			expected: []protocol.Diagnostic{{
+				Range: protocol.Range{
+					Start: protocol.Position{Line: 4, Character: 45},
+					End:   protocol.Position{Line: 4, Character: 82},
+				},
+				Severity: protocol.SeverityError,
+				Source:   "promql",
+				Message:  `invalid PromQL in recording rule job:requests:rate5m: parse error at char 15: expected type range vector in call to function "rate", got instant vector`,
+			}},
+		},
+		{
+			name: "formatted expression in a mixin",
+			fileContent: `local selector = 'job="api"';
+{
+  alerts: {
+    groups: [{
+      name: 'api',
+      rules: [{
+        alert: 'HighErrorRate',
+        expr: |||
+          sum(rate(errors_total{%s}[5m])) / sum(rate(requests_total{%s}[5m]) > 0.1
+        ||| % [selector, selector],
+      }],
+    }],
+  },
+}`,
+			expected: []protocol.Diagnostic{{
+				Range: protocol.Range{
+					Start: protocol.Position{Line: 7, Character: 14},
+					End:   protocol.Position{Line: 9, Character: 11},
+				},
+				Severity: protocol.SeverityError,
+				Source:   "promql",
+				Message:  `invalid PromQL in alert HighErrorRate: parse error at char 88: unexpected end of input in aggregation, expected "," or ")"`,
+			}},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s, fileURI := testServerWithFile(t, nil, tc.fileContent)
+			setConfiguration(s, func(c *Configuration) {
+				c.EnableEvalDiagnostics = true
+			})
+			doc, err := s.cache.get(fileURI)
+			require.NoError(t, err)
+
+			diags := s.getEvalDiags(context.Background(), doc)
+			assert.Equal(t, tc.expected, diags)
+		})
+	}
+}
+
+func TestLiteralGenerates(t *testing.T) {
+	assert.True(t, literalGenerates("up == 0\n", "up == 0"))
+	assert.True(t, literalGenerates("rate(x{%(selector)s}[%(interval)s])", `rate(x{job="a"}[5m])`))
+	assert.True(t, literalGenerates("x %% 2 > %d", "x % 2 > 1"))
+	assert.False(t, literalGenerates("rate(y{%s}[5m])", `rate(x{job="a"}[5m])`))
+	assert.False(t, literalGenerates("%s", "up"))
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/go-jsonnet"
+	"github.com/google/go-jsonnet/ast"
+	"github.com/grafana/jsonnet-language-server/pkg/ast/processing"
+	"github.com/grafana/jsonnet-language-server/pkg/nodestack"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+)
+
+// maxProvenanceFields limits the number of fields whose source is looked for, each of them is resolved separately.
+const maxProvenanceFields = 2000
+
+// provenanceResult is the result of jsonnet.evalFileProvenance.
+// Provenance maps the JSON pointers (RFC 6901) of the output's fields to the file:line that last set them.
+type provenanceResult struct {
+	Output     string            `json:"output"`
+	Provenance map[string]string `json:"provenance"`
+}
+
+// evalFileProvenance evaluates a file, like jsonnet.evalFile, and finds where each field of the output was last set.
+// It is meant for the evaluation preview, to tell which of the mixins sets a field.
+func (s *Server) evalFileProvenance(ctx context.Context, params *protocol.ExecuteCommandParams) (interface{}, error) {
+	args := params.Arguments
+	if len(args) != 1 {
+		return nil, fmt.Errorf("expected 1 argument, got %d", len(args))
+	}
+
+	var fileName string
+	if err := json.Unmarshal(args[0], &fileName); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal file name: %v", err)
+	}
+
+	output, err := s.evaluateFile(ctx, fileName, "")
+	if err != nil {
+		return nil, err
+	}
+
+	text, err := s.documentText(protocol.URIFromPath(fileName))
+	if err != nil {
+		return nil, err
+	}
+	root, err := snippetToAST(fileName, text)
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	if err := json.Unmarshal([]byte(output), &value); err != nil {
+		return nil, fmt.Errorf("failed to parse the output: %w", err)
+	}
+
+	result := provenanceResult{Output: output, Provenance: map[string]string{}}
+	p := &provenance{
+		vm:     s.getCancellableVM(ctx, fileName),
+		root:   root,
+		result: result.Provenance,
+	}
+	p.annotate(value, nil)
+	return result, nil
+}
+
+type provenance struct {
+	vm     *jsonnet.VM
+	root   ast.Node
+	result map[string]string
+	fields int
+}
+
+// annotate finds the sources of the fields of an output object. The arrays' elements are left out, they can't be
+// found without evaluating them.
+func (p *provenance) annotate(value interface{}, path []string) {
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if p.fields >= maxProvenanceFields {
+			return
+		}
+		p.fields++
+
+		fieldPath := append(append([]string{}, path...), name)
+		ranges, err := processing.FindRangesFromIndexList(nodestack.NewNodeStack(p.root), append([]string{"$"}, fieldPath...), p.vm, false)
+		if err != nil || len(ranges) == 0 {
+			// The fields of a field that can't be found can't be found either
+			continue
+		}
+		// The first range is the nearest definition, the one that last set the field
+		p.result[jsonPointer(fieldPath)] = fmt.Sprintf("%s:%d", ranges[0].Filename, ranges[0].FullRange.Begin.Line)
+		p.annotate(object[name], fieldPath)
+	}
+}
+
+// jsonPointer returns the JSON pointer of a path of fields.
+func jsonPointer(path []string) string {
+	escaper := strings.NewReplacer("~", "~0", "/", "~1")
+	pointer := ""
+	for _, name := range path {
+		pointer += "/" + escaper.Replace(name)
+	}
+	return pointer
+}
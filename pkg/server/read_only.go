@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/grafana/jsonnet-language-server/pkg/utils"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// readOnlyFile tells whether a file is only analysed, not evaluated nor edited: the vendored libraries, in a vendor
+// directory of the workspace, and the files that match the generated_files globs, relative to the workspace folder.
+func (s *Server) readOnlyFile(path string) bool {
+	if s.workspaceFolder == "" {
+		return false
+	}
+	rel, err := filepath.Rel(s.workspaceFolder, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	for _, dir := range strings.Split(filepath.ToSlash(filepath.Dir(rel)), "/") {
+		if dir == "vendor" {
+			return true
+		}
+	}
+	for _, glob := range s.config().GeneratedFiles {
+		if utils.MatchGlob(glob, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutReadOnlyEdits returns the edits, by document, without those of the read-only files, unless the
+// edit_read_only_files setting is set.
+func (s *Server) withoutReadOnlyEdits(edits map[string][]protocol.TextEdit) map[string][]protocol.TextEdit {
+	if s.config().EditReadOnlyFiles {
+		return edits
+	}
+	for uri := range edits {
+		if path := protocol.DocumentURI(uri).SpanURI().Filename(); s.readOnlyFile(path) {
+			log.Infof("Leaving the read-only file %s out of the edit", path)
+			delete(edits, uri)
+		}
+	}
+	return edits
+}
+
+// warnReadOnlyEdits warns the user when a workspace edit touches read-only files, the next `jb install` or code
+// generation would undo it.
+func (s *Server) warnReadOnlyEdits(uris []protocol.DocumentURI) {
+	var paths []string
+	for _, uri := range uris {
+		if path := uri.SpanURI().Filename(); s.readOnlyFile(path) {
+			paths = append(paths, path)
+		}
+	}
+	if len(paths) == 0 {
+		return
+	}
+	sort.Strings(paths)
+	message := fmt.Sprintf("The edit changes read-only files, which are vendored or generated:\n- %s", strings.Join(paths, "\n- "))
+	log.Warn(message)
+	if s.client == nil {
+		return
+	}
+	if err := s.client.ShowMessage(context.Background(), &protocol.ShowMessageParams{Type: protocol.Warning, Message: message}); err != nil {
+		log.Errorf("warnReadOnlyEdits: unable to show the message: %v", err)
+	}
+}
+
+// changedDocuments returns the documents that the document changes of a workspace edit edit, create or rename.
+func changedDocuments(changes []interface{}) []protocol.DocumentURI {
+	var uris []protocol.DocumentURI
+	for _, change := range changes {
+		switch change := change.(type) {
+		case resourceTextDocumentEdit:
+			uris = append(uris, change.TextDocument.URI)
+		case protocol.CreateFile:
+			uris = append(uris, change.URI)
+		case protocol.RenameFile:
+			uris = append(uris, change.OldURI, change.NewURI)
+		}
+	}
+	return uris
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadOnlyFile(t *testing.T) {
+	s := testServer(t, nil)
+	s.workspaceFolder = "/workspace"
+	setConfiguration(s, func(c *Configuration) {
+		c.GeneratedFiles = []string{"gen/**", "**/*.generated.libsonnet"}
+	})
+
+	testCases := []struct {
+		path     string
+		readOnly bool
+	}{
+		{path: "/workspace/main.jsonnet"},
+		{path: "/workspace/vendor/k.libsonnet", readOnly: true},
+		{path: "/workspace/env/vendor/github.com/lib/main.libsonnet", readOnly: true},
+		{path: "/workspace/vendored.libsonnet"},
+		{path: "/workspace/gen/crds/main.libsonnet", readOnly: true},
+		{path: "/workspace/lib/crds.generated.libsonnet", readOnly: true},
+		{path: "/workspace/lib/generated.libsonnet"},
+		// The files out of the workspace aren't the workspace's to edit, but they are analysed as usual
+		{path: "/vendor/k.libsonnet"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			assert.Equal(t, tc.readOnly, s.readOnlyFile(tc.path))
+		})
+	}
+}
+
+func TestReadOnlyFile_EvalDiagnostics(t *testing.T) {
+	root := writeProjectFiles(t, map[string]string{
+		"vendor/lib.libsonnet": "error 'vendored'",
+		"gen/out.jsonnet":      "error 'generated'",
+		"main.jsonnet":         "error 'main'",
+	})
+	s := renameTestServer(t, root, nil)
+	require.NoError(t, s.DidChangeConfiguration(context.Background(), &protocol.DidChangeConfigurationParams{
+		Settings: map[string]interface{}{"enable_eval_diagnostics": true, "generated_files": []interface{}{"gen/**"}},
+	}))
+
+	for path, evaluated := range map[string]bool{"vendor/lib.libsonnet": false, "gen/out.jsonnet": false, "main.jsonnet": true} {
+		doc, err := s.cache.get(serverOpenTestFile(t, s, filepath.Join(root, path)))
+		require.NoError(t, err)
+		assert.Equal(t, evaluated, len(s.getEvalDiags(context.Background(), doc)) > 0, path)
+	}
+}
+
+func TestReadOnlyFile_Rename(t *testing.T) {
+	root := writeProjectFiles(t, map[string]string{"vendor/lib.libsonnet": "local x = 1;\nx\n"})
+	client := &recordingClient{}
+	s := renameTestServer(t, root, nil)
+	s.client = client
+	uri := serverOpenTestFile(t, s, filepath.Join(root, "vendor/lib.libsonnet"))
+	params := &protocol.RenameParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+		Position:     protocol.Position{Line: 1, Character: 0},
+		NewName:      "y",
+	}
+
+	_, err := s.Rename(context.Background(), params)
+	assert.EqualError(t, err, filepath.Join(root, "vendor/lib.libsonnet")+" is vendored or generated, set edit_read_only_files to rename in it")
+
+	// The read-only files can be edited on demand, with a warning
+	setConfiguration(s, func(c *Configuration) {
+		c.EditReadOnlyFiles = true
+	})
+	edit, err := s.Rename(context.Background(), params)
+	require.NoError(t, err)
+	assert.Equal(t, "local y = 1;\ny\n", applyTextEdits(t, "local x = 1;\nx\n", edit.Changes[string(uri)]))
+	messages := client.getMessages()
+	require.Len(t, messages, 1)
+	assert.Equal(t, protocol.Warning, messages[0].Type)
+	assert.Contains(t, messages[0].Message, filepath.Join(root, "vendor/lib.libsonnet"))
+}
+
+func TestReadOnlyFile_RenameFile(t *testing.T) {
+	root := writeProjectFiles(t, map[string]string{
+		"lib/util.libsonnet":   "{}",
+		"main.jsonnet":         "import 'lib/util.libsonnet'\n",
+		"gen/output.jsonnet":   "import '../lib/util.libsonnet'\n",
+		"gen/helper.jsonnet":   "{}",
+		"gen/importer.jsonnet": "import 'helper.jsonnet'\n",
+	})
+	caller := &applyingCaller{applied: true}
+	s := renameTestServer(t, root, caller)
+	client := s.client.(*recordingClient)
+	require.NoError(t, s.DidChangeConfiguration(context.Background(), &protocol.DidChangeConfigurationParams{
+		Settings: map[string]interface{}{"generated_files": []interface{}{"gen/**"}},
+	}))
+	rename := func(oldName, newName string) []string {
+		_, err := s.ExecuteCommand(context.Background(), &protocol.ExecuteCommandParams{
+			Command:   "jsonnet.renameFile",
+			Arguments: []json.RawMessage{json.RawMessage(`"` + filepath.Join(root, oldName) + `"`), json.RawMessage(`"` + filepath.Join(root, newName) + `"`)},
+		})
+		require.NoError(t, err)
+		var params struct {
+			Edit struct {
+				DocumentChanges []struct {
+					TextDocument struct {
+						URI protocol.DocumentURI `json:"uri"`
+					} `json:"textDocument"`
+				} `json:"documentChanges"`
+			} `json:"edit"`
+		}
+		require.NoError(t, json.Unmarshal(caller.params, &params))
+		var edited []string
+		for _, change := range params.Edit.DocumentChanges {
+			if change.TextDocument.URI != "" {
+				rel, err := filepath.Rel(root, change.TextDocument.URI.SpanURI().Filename())
+				require.NoError(t, err)
+				edited = append(edited, filepath.ToSlash(rel))
+			}
+		}
+		return edited
+	}
+
+	// The generated files that import the renamed file are left out
+	assert.Equal(t, []string{"main.jsonnet"}, rename("lib/util.libsonnet", "lib/utils.libsonnet"))
+	assert.Empty(t, client.getMessages())
+
+	// Renaming a generated file is a warned edit
+	assert.Empty(t, rename("gen/helper.jsonnet", "gen/helpers.jsonnet"))
+	messages := client.getMessages()
+	require.Len(t, messages, 1)
+	assert.Equal(t, protocol.Warning, messages[0].Type)
+	assert.Contains(t, messages[0].Message, filepath.Join(root, "gen/helper.jsonnet"))
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/google/go-jsonnet/ast"
+	"github.com/hexops/gotextdiff"
+	"github.com/hexops/gotextdiff/myers"
+	"github.com/hexops/gotextdiff/span"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+)
+
+// recoverAST parses a document that has a syntax error by leaving out the lines that changed since the text of its
+// last AST. The lines are blanked rather than removed, the others keep their positions. The features that work on
+// the unchanged lines (completion, symbols, navigation) keep working while the document is being edited.
+// It returns a nil AST if the document doesn't parse even without the changed lines.
+func recoverAST(filename, astText, text string) (ast.Node, string, map[int]bool) {
+	// Without a previous AST, there is nothing to tell the changed lines from
+	if astText == "" {
+		return nil, "", nil
+	}
+	// The changed lines are the lines of the text that the diff from the text of the AST inserts
+	lines := strings.Split(text, "\n")
+	toAST := newLineMap(astText, text).toAST
+	changed := map[int]bool{}
+	for line := range lines {
+		if _, ok := toAST[line]; !ok {
+			changed[line] = true
+		}
+	}
+	if len(changed) == 0 {
+		return nil, "", nil
+	}
+
+	for line := range changed {
+		lines[line] = ""
+	}
+	recoveredText := strings.Join(lines, "\n")
+	root, err := parseDocument(filename, recoveredText)
+	if err != nil {
+		return nil, "", nil
+	}
+	return root, recoveredText, changed
+}
+
+// lineMap maps the lines of the text of an AST to the lines of the current text, and back, from the diff between them.
+type lineMap struct {
+	// toText has all the lines of the text of the AST. The deleted lines are mapped to the line where they were.
+	toText  map[int]int
+	deleted map[int]bool
+	// toAST has the lines of the current text that are also in the text of the AST.
+	toAST map[int]int
+}
+
+func newLineMap(astText, text string) lineMap {
+	m := lineMap{toText: map[int]int{}, deleted: map[int]bool{}, toAST: map[int]int{}}
+	astLine, line := 0, 0
+	same := func() {
+		m.toText[astLine] = line
+		m.toAST[line] = astLine
+		astLine++
+		line++
+	}
+
+	unified := gotextdiff.ToUnified("ast", "text", astText, myers.ComputeEdits(span.URI("any"), astText, text))
+	for _, hunk := range unified.Hunks {
+		for astLine < hunk.FromLine-1 {
+			same()
+		}
+		for _, diffLine := range hunk.Lines {
+			switch diffLine.Kind {
+			case gotextdiff.Equal:
+				same()
+			case gotextdiff.Delete:
+				m.toText[astLine] = line
+				m.deleted[astLine] = true
+				astLine++
+			case gotextdiff.Insert:
+				line++
+			}
+		}
+	}
+	for astLines := strings.Count(astText, "\n") + 1; astLine < astLines; {
+		same()
+	}
+	return m
+}
+
+// rangeToText maps a range of the text of the AST to the current text. The ranges that start on a deleted line are
+// dropped, the ends on deleted lines move to where the lines were.
+func (m lineMap) rangeToText(rng protocol.Range) (protocol.Range, bool) {
+	start, end := int(rng.Start.Line), int(rng.End.Line)
+	if m.deleted[start] {
+		return protocol.Range{}, false
+	}
+	rng.Start.Line = uint32(m.toText[start])
+	if m.deleted[end] {
+		rng.End = protocol.Position{Line: uint32(m.toText[end])}
+	} else {
+		rng.End.Line = uint32(m.toText[end])
+	}
+	return rng, true
+}
+
+// astPosition returns the position in the AST of a position of the current text. When the AST is stale, it also
+// returns the lineMap that maps the results back to the current text. ok is false when the line has changed since the
+// AST was parsed.
+func (d *document) astPosition(pos protocol.Position) (astPos protocol.Position, lines *lineMap, ok bool) {
+	if !d.stale() {
+		return pos, nil, !d.linesChangedSinceAST[int(pos.Line)]
+	}
+	m := newLineMap(d.astText, d.item.Text)
+	line, ok := m.toAST[int(pos.Line)]
+	pos.Line = uint32(line)
+	return pos, &m, ok
+}
+
+// linksToText maps the targets of definition links that are in the document of a stale AST to the current text.
+func (m lineMap) linksToText(links []protocol.DefinitionLink, uri protocol.DocumentURI) []protocol.DefinitionLink {
+	var mapped []protocol.DefinitionLink
+	for _, link := range links {
+		if link.TargetURI == uri {
+			selection, ok := m.rangeToText(link.TargetSelectionRange)
+			if !ok {
+				continue
+			}
+			if link.TargetRange, ok = m.rangeToText(link.TargetRange); !ok {
+				link.TargetRange = selection
+			}
+			link.TargetSelectionRange = selection
+		}
+		mapped = append(mapped, link)
+	}
+	return mapped
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecoverAST(t *testing.T) {
+	testCases := []struct {
+		name          string
+		astText       string
+		text          string
+		expectedText  string
+		expectedLines []int
+	}{
+		{
+			name:          "index being typed",
+			astText:       "local obj = { a: 1 };\n{\n  b: 1,\n}",
+			text:          "local obj = { a: 1 };\n{\n  b: obj.\n}",
+			expectedText:  "local obj = { a: 1 };\n{\n\n}",
+			expectedLines: []int{2},
+		},
+		{
+			name:          "lines inserted",
+			astText:       "local a = 1;\n{\n  b: a,\n}",
+			text:          "local a = 1;\nlocal c = [\n  1,\n{\n  b: a,\n}",
+			expectedText:  "local a = 1;\n\n\n{\n  b: a,\n}",
+			expectedLines: []int{1, 2},
+		},
+		{
+			name:    "unrecoverable",
+			astText: "{\n  a: 1,\n}",
+			text:    "{\n  a: 1,\n",
+		},
+		{
+			name: "no previous AST",
+			text: "{\n  a: \n}",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			root, text, changed := recoverAST("test.jsonnet", tc.astText, tc.text)
+			if tc.expectedText == "" {
+				assert.Nil(t, root)
+				return
+			}
+			require.NotNil(t, root)
+			assert.Equal(t, tc.expectedText, text)
+			var lines []int
+			for line := 0; line < len(tc.text); line++ {
+				if changed[line] {
+					lines = append(lines, line)
+				}
+			}
+			assert.Equal(t, tc.expectedLines, lines)
+		})
+	}
+}
+
+func TestDidChange_SyntaxError(t *testing.T) {
+	s, uri := testServerWithFile(t, nil, "local obj = { a: 1 };\n{\n  b: obj,\n}")
+	broken := "local obj = { a: 1 };\n// A new comment\n{\n  c: obj.\n  b: obj,\n}"
+	require.NoError(t, s.DidChange(context.Background(), &protocol.DidChangeTextDocumentParams{
+		TextDocument:   protocol.VersionedTextDocumentIdentifier{TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: uri}, Version: 2},
+		ContentChanges: []protocol.TextDocumentContentChangeEvent{{Text: broken}},
+	}))
+
+	doc, err := s.cache.get(uri)
+	require.NoError(t, err)
+	require.Error(t, doc.err)
+	assert.Equal(t, map[int]bool{1: true, 3: true}, doc.linesChangedSinceAST)
+
+	// The lines after the change have moved, navigation follows them
+	definition, err := s.Definition(context.Background(), &protocol.DefinitionParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     protocol.Position{Line: 4, Character: 6},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, definition, 1)
+	assert.Equal(t, makeRange(t, "0:6-0:20"), definition[0].Range)
+
+	hover, err := s.Hover(context.Background(), &protocol.HoverParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     protocol.Position{Line: 4, Character: 6},
+		},
+	})
+	require.NoError(t, err)
+	require.NotNil(t, hover)
+	assert.Contains(t, hover.Contents.Value, "obj = { a: 1 }")
+
+	symbols, err := s.DocumentSymbol(context.Background(), &protocol.DocumentSymbolParams{TextDocument: protocol.TextDocumentIdentifier{URI: uri}})
+	require.NoError(t, err)
+	require.Len(t, symbols, 2)
+	field := symbols[1].(protocol.DocumentSymbol)
+	assert.Equal(t, "b", field.Name)
+	assert.Equal(t, makeRange(t, "4:2-4:3"), field.SelectionRange)
+
+	completion, err := s.Completion(context.Background(), &protocol.CompletionParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     protocol.Position{Line: 3, Character: 9},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, completion.Items, 1)
+	assert.Equal(t, "a", completion.Items[0].Label)
+}
+
+func TestDidChange_StaleAST(t *testing.T) {
+	s, uri := testServerWithFile(t, nil, "local obj = { a: 1 };\n{\n  b: obj,\n  c: {\n    d: 1,\n  },\n}")
+	// The closing brace of c is deleted, leaving out the inserted line doesn't help
+	broken := "// header\nlocal obj = { a: 1 };\n{\n  b: obj,\n  c: {\n    d: 1,\n}"
+	require.NoError(t, s.DidChange(context.Background(), &protocol.DidChangeTextDocumentParams{
+		TextDocument:   protocol.VersionedTextDocumentIdentifier{TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: uri}, Version: 2},
+		ContentChanges: []protocol.TextDocumentContentChangeEvent{{Text: broken}},
+	}))
+	doc, err := s.cache.get(uri)
+	require.NoError(t, err)
+	require.True(t, doc.stale())
+
+	definition, err := s.Definition(context.Background(), &protocol.DefinitionParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     protocol.Position{Line: 3, Character: 6},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, definition, 1)
+	assert.Equal(t, makeRange(t, "1:6-1:20"), definition[0].Range)
+
+	symbols, err := s.DocumentSymbol(context.Background(), &protocol.DocumentSymbolParams{TextDocument: protocol.TextDocumentIdentifier{URI: uri}})
+	require.NoError(t, err)
+	var found []string
+	for _, symbol := range symbols {
+		symbol := symbol.(protocol.DocumentSymbol)
+		found = append(found, symbol.Name+" "+formatRange(symbol.SelectionRange)+" "+symbol.Detail)
+	}
+	assert.Equal(t, []string{
+		"obj 1:6-1:9 Object, stale, from version 1",
+		"b 3:2-3:3 Var, stale, from version 1",
+		"c 4:2-4:3 Object, stale, from version 1",
+	}, found)
+
+	folding, err := s.FoldingRange(context.Background(), &protocol.FoldingRangeParams{TextDocument: protocol.TextDocumentIdentifier{URI: uri}})
+	require.NoError(t, err)
+	assert.Equal(t, []protocol.FoldingRange{{StartLine: 2, EndLine: 6}, {StartLine: 4, EndLine: 5}}, folding)
+}
@@ -0,0 +1,199 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/google/go-jsonnet/ast"
+	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
+	"github.com/grafana/jsonnet-language-server/pkg/utils"
+	"github.com/jdbaldry/go-language-server-protocol/jsonrpc2"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// keywords can't be the names of variables.
+var keywords = map[string]bool{
+	"assert": true, "else": true, "error": true, "false": true, "for": true, "function": true, "if": true,
+	"import": true, "importstr": true, "importbin": true, "in": true, "local": true, "null": true,
+	"tailstrict": true, "then": true, "self": true, "super": true, "true": true,
+}
+
+// References finds the references to the variable under the cursor, in its document. Like Symbol, the references are
+// sent as a partial result when the client gives a token for them, and the response is then empty.
+func (s *Server) References(ctx context.Context, params *protocol.ReferenceParams) ([]protocol.Location, error) {
+	progress := s.startProgress(ctx, params.WorkDoneToken, "Finding the references")
+	defer progress.end("")
+
+	v, err := s.variableAtPosition("References", params.TextDocument.URI, params.Position)
+	if v == nil {
+		return nil, err
+	}
+
+	var locations []protocol.Location
+	if params.Context.IncludeDeclaration {
+		locations = append(locations, protocol.Location{URI: params.TextDocument.URI, Range: position.RangeASTToProtocol(v.selection)})
+	}
+	for _, ref := range v.references {
+		locations = append(locations, protocol.Location{URI: params.TextDocument.URI, Range: position.RangeASTToProtocol(ref)})
+	}
+	if params.PartialResultToken != nil {
+		s.sendPartialResult(ctx, params.PartialResultToken, locations)
+		return []protocol.Location{}, nil
+	}
+	return locations, nil
+}
+
+// DocumentHighlight highlights the variable under the cursor: where it is bound, and where it is read. Or the field
+// under the cursor: where it is defined or overridden, and where it is read through `self`, `super` or `$`.
+func (s *Server) DocumentHighlight(_ context.Context, params *protocol.DocumentHighlightParams) ([]protocol.DocumentHighlight, error) {
+	v, err := s.variableAtPosition("DocumentHighlight", params.TextDocument.URI, params.Position)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return s.fieldHighlightsAtPosition(params.TextDocument.URI, params.Position)
+	}
+
+	highlights := []protocol.DocumentHighlight{{Range: position.RangeASTToProtocol(v.selection), Kind: protocol.Write}}
+	for _, ref := range v.references {
+		highlights = append(highlights, protocol.DocumentHighlight{Range: position.RangeASTToProtocol(ref), Kind: protocol.Read})
+	}
+	return highlights, nil
+}
+
+// fieldHighlightsAtPosition highlights the field under the cursor. Like Definition, the errors finding it are only
+// logged.
+func (s *Server) fieldHighlightsAtPosition(uri protocol.DocumentURI, pos protocol.Position) ([]protocol.DocumentHighlight, error) {
+	highlights, err := onLatestDocument(s, "DocumentHighlight", uri, func(doc *document) ([]protocol.DocumentHighlight, error) {
+		if doc.ast == nil || doc.linesChangedSinceAST[int(pos.Line)] {
+			return nil, nil
+		}
+		return fieldHighlights(doc.ast, doc.astText, position.ProtocolToAST(pos)), nil
+	})
+	if errors.Is(err, errContentModified) {
+		return nil, err
+	}
+	if err != nil {
+		log.WithError(err).Errorf("DocumentHighlight: error finding field")
+	}
+	return highlights, nil
+}
+
+// PrepareRename returns the range of the variable under the cursor, only variables can be renamed.
+func (s *Server) PrepareRename(_ context.Context, params *protocol.PrepareRenameParams) (*protocol.Range, error) {
+	v, err := s.variableAtPosition("PrepareRename", params.TextDocument.URI, params.Position)
+	if v == nil {
+		return nil, err
+	}
+
+	pos := position.ProtocolToAST(params.Position)
+	for _, loc := range append([]ast.LocationRange{v.selection}, v.references...) {
+		if inIdentifier(pos, loc) {
+			rng := position.RangeASTToProtocol(loc)
+			return &rng, nil
+		}
+	}
+	return nil, nil
+}
+
+// Rename renames the variable under the cursor, and the references to it.
+func (s *Server) Rename(_ context.Context, params *protocol.RenameParams) (*protocol.WorkspaceEdit, error) {
+	if !identifierRegexp.MatchString(params.NewName) || keywords[params.NewName] {
+		return nil, fmt.Errorf("%w: %q is not a valid variable name", jsonrpc2.ErrInvalidParams, params.NewName)
+	}
+	if path := params.TextDocument.URI.SpanURI().Filename(); s.readOnlyFile(path) {
+		if !s.config().EditReadOnlyFiles {
+			return nil, fmt.Errorf("%s is vendored or generated, set edit_read_only_files to rename in it", path)
+		}
+		s.warnReadOnlyEdits([]protocol.DocumentURI{params.TextDocument.URI})
+	}
+	v, err := s.variableAtPosition("Rename", params.TextDocument.URI, params.Position)
+	if v == nil {
+		return nil, err
+	}
+	doc, err := s.cache.get(params.TextDocument.URI)
+	if err != nil {
+		return nil, utils.LogErrorf("Rename: %s: %w", errorRetrievingDocument, err)
+	}
+
+	// Only the document is edited: renaming a local that aliases an import doesn't rename anything in the imported file
+	edits, err := renameVariable(doc, v, params.NewName)
+	if err != nil {
+		return nil, err
+	}
+	return &protocol.WorkspaceEdit{Changes: map[string][]protocol.TextEdit{string(params.TextDocument.URI): edits}}, nil
+}
+
+// renameVariable returns the edits that rename a variable and its references, unless the new name would make some of
+// them refer to another variable, or some references to another variable refer to the renamed one.
+func renameVariable(doc *document, v *variable, newName string) ([]protocol.TextEdit, error) {
+	locations := append([]ast.LocationRange{v.selection}, v.references...)
+	edits := make([]protocol.TextEdit, 0, len(locations))
+	for _, loc := range locations {
+		edits = append(edits, protocol.TextEdit{Range: position.RangeASTToProtocol(loc), NewText: newName})
+	}
+	if newName == string(v.name) {
+		return edits, nil
+	}
+
+	// The renamed document must have the same variables, the locations shift on the lines of the renamed identifiers
+	renamed, err := parseDocument(doc.item.URI.SpanURI().Filename(), applyRename(doc.astText, locations, newName))
+	if err != nil {
+		return nil, fmt.Errorf("renaming %s to %s breaks the document: %w", v.name, newName, err)
+	}
+	shift := func(loc ast.Location) ast.Location {
+		shifted := loc
+		for _, renamedLoc := range locations {
+			if renamedLoc.Begin.Line == loc.Line && renamedLoc.Begin.Column < loc.Column {
+				shifted.Column += len(newName) - len(v.name)
+			}
+		}
+		return shifted
+	}
+	after := variableAt(renamed, shift(v.selection.Begin))
+	conflict := after == nil || len(after.references) != len(v.references)
+	for i := 0; !conflict && i < len(v.references); i++ {
+		conflict = after.references[i].Begin != shift(v.references[i].Begin)
+	}
+	if conflict {
+		return nil, fmt.Errorf("%w: renaming %s to %s would change the variables that some references refer to, %s is already used in its scope", jsonrpc2.ErrInvalidParams, v.name, newName, newName)
+	}
+	return edits, nil
+}
+
+// applyRename replaces the identifiers at the locations of the text with a new name.
+func applyRename(text string, locations []ast.LocationRange, newName string) string {
+	sorted := append([]ast.LocationRange{}, locations...)
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i].Begin, sorted[j].Begin
+		return a.Line > b.Line || (a.Line == b.Line && a.Column > b.Column)
+	})
+	for _, loc := range sorted {
+		start, end := locationOffset(text, loc.Begin), locationOffset(text, loc.End)
+		text = text[:start] + newName + text[end:]
+	}
+	return text
+}
+
+// variableAtPosition returns the variable under the cursor. Like Definition, the errors finding it are only logged.
+func (s *Server) variableAtPosition(method string, uri protocol.DocumentURI, pos protocol.Position) (*variable, error) {
+	v, err := onLatestDocument(s, method, uri, func(doc *document) (*variable, error) {
+		if doc.ast == nil {
+			return nil, utils.LogErrorf("%s: document was never successfully parsed, can't find variables", method)
+		}
+		if doc.linesChangedSinceAST[int(pos.Line)] {
+			return nil, utils.LogErrorf("%s: document line %d was changed since last successful parse, can't find variables", method, pos.Line)
+		}
+		return variableAt(doc.ast, position.ProtocolToAST(pos)), nil
+	})
+	if errors.Is(err, errContentModified) {
+		return nil, err
+	}
+	if err != nil {
+		log.WithError(err).Errorf("%s: error finding variable", method)
+	}
+	return v, nil
+}
@@ -0,0 +1,238 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const referencesTestDocument = `local x = 1;
+local arr = [x, 2];
+[x + y for x in arr if x > 0 for y in [x, x]] + {
+  [k]: x for k in std.objectFields({ a: 1 })
+}.a + (function(y=x) y)()`
+
+func TestReferences(t *testing.T) {
+	testCases := []struct {
+		name     string
+		position protocol.Position
+		expected []string
+	}{
+		{
+			name:     "local",
+			position: protocol.Position{Line: 0, Character: 6},
+			expected: []string{"0:6-0:7", "1:13-1:14", "3:7-3:8", "4:18-4:19"},
+		},
+		{
+			name:     "comprehension variable from its for",
+			position: protocol.Position{Line: 2, Character: 11},
+			expected: []string{"2:11-2:12", "2:1-2:2", "2:23-2:24", "2:39-2:40", "2:42-2:43"},
+		},
+		{
+			name:     "comprehension variable from its if guard",
+			position: protocol.Position{Line: 2, Character: 24},
+			expected: []string{"2:11-2:12", "2:1-2:2", "2:23-2:24", "2:39-2:40", "2:42-2:43"},
+		},
+		{
+			name:     "nested comprehension variable",
+			position: protocol.Position{Line: 2, Character: 5},
+			expected: []string{"2:33-2:34", "2:5-2:6"},
+		},
+		{
+			name:     "object comprehension variable",
+			position: protocol.Position{Line: 3, Character: 3},
+			expected: []string{"3:13-3:14", "3:3-3:4"},
+		},
+		{
+			name:     "parameter with a default value",
+			position: protocol.Position{Line: 4, Character: 21},
+			expected: []string{"4:16-4:17", "4:21-4:22"},
+		},
+		{
+			name:     "not a variable",
+			position: protocol.Position{Line: 1, Character: 17},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s, uri := testServerWithFile(t, nil, referencesTestDocument)
+			locations, err := s.References(context.Background(), &protocol.ReferenceParams{
+				TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+					TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+					Position:     tc.position,
+				},
+				Context: protocol.ReferenceContext{IncludeDeclaration: true},
+			})
+			require.NoError(t, err)
+
+			var found []string
+			for _, location := range locations {
+				assert.Equal(t, uri, location.URI)
+				found = append(found, formatRange(location.Range))
+			}
+			assert.Equal(t, tc.expected, found)
+		})
+	}
+}
+
+func TestDefinition_ComprehensionVariable(t *testing.T) {
+	s, uri := testServerWithFile(t, nil, referencesTestDocument)
+	locations, err := s.Definition(context.Background(), &protocol.DefinitionParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     protocol.Position{Line: 2, Character: 23},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, locations, 1)
+	assert.Equal(t, "2:11-2:12", formatRange(locations[0].Range))
+}
+
+func TestDocumentHighlight(t *testing.T) {
+	s, uri := testServerWithFile(t, nil, referencesTestDocument)
+	highlights, err := s.DocumentHighlight(context.Background(), &protocol.DocumentHighlightParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     protocol.Position{Line: 3, Character: 4},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []protocol.DocumentHighlight{
+		{Range: makeRange(t, "3:13-3:14"), Kind: protocol.Write},
+		{Range: makeRange(t, "3:3-3:4"), Kind: protocol.Read},
+	}, highlights)
+}
+
+func TestDocumentHighlight_Fields(t *testing.T) {
+	document := `local base = {
+  replicas: 1,
+  name: 'a',
+};
+base + {
+  replicas+: 1,
+  'name': super.name + $.replicas,
+  total: self.replicas * 2 + self['replicas'],
+}
+`
+	testCases := []struct {
+		name     string
+		position protocol.Position
+		expected []protocol.DocumentHighlight
+	}{
+		{
+			name:     "definition",
+			position: protocol.Position{Line: 1, Character: 3},
+			expected: []protocol.DocumentHighlight{
+				{Range: makeRange(t, "1:2-1:10"), Kind: protocol.Write},
+				{Range: makeRange(t, "5:2-5:10"), Kind: protocol.Write},
+				{Range: makeRange(t, "6:25-6:33"), Kind: protocol.Read},
+				{Range: makeRange(t, "7:14-7:22"), Kind: protocol.Read},
+			},
+		},
+		{
+			name:     "self access",
+			position: protocol.Position{Line: 7, Character: 20},
+			expected: []protocol.DocumentHighlight{
+				{Range: makeRange(t, "1:2-1:10"), Kind: protocol.Write},
+				{Range: makeRange(t, "5:2-5:10"), Kind: protocol.Write},
+				{Range: makeRange(t, "6:25-6:33"), Kind: protocol.Read},
+				{Range: makeRange(t, "7:14-7:22"), Kind: protocol.Read},
+			},
+		},
+		{
+			name:     "quoted name and super access",
+			position: protocol.Position{Line: 6, Character: 17},
+			expected: []protocol.DocumentHighlight{
+				{Range: makeRange(t, "2:2-2:6"), Kind: protocol.Write},
+				{Range: makeRange(t, "6:3-6:7"), Kind: protocol.Write},
+				{Range: makeRange(t, "6:16-6:20"), Kind: protocol.Read},
+			},
+		},
+		{
+			name:     "variable",
+			position: protocol.Position{Line: 4, Character: 1},
+			expected: []protocol.DocumentHighlight{
+				{Range: makeRange(t, "0:6-0:10"), Kind: protocol.Write},
+				{Range: makeRange(t, "4:0-4:4"), Kind: protocol.Read},
+			},
+		},
+		{
+			name:     "operator",
+			position: protocol.Position{Line: 7, Character: 24},
+		},
+	}
+	s, uri := testServerWithFile(t, nil, document)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			highlights, err := s.DocumentHighlight(context.Background(), &protocol.DocumentHighlightParams{
+				TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+					TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+					Position:     tc.position,
+				},
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, highlights)
+		})
+	}
+}
+
+func TestRename(t *testing.T) {
+	s, uri := testServerWithFile(t, nil, referencesTestDocument)
+	at := protocol.TextDocumentPositionParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+		Position:     protocol.Position{Line: 2, Character: 42},
+	}
+
+	rng, err := s.PrepareRename(context.Background(), &protocol.PrepareRenameParams{TextDocumentPositionParams: at})
+	require.NoError(t, err)
+	assert.Equal(t, makeRange(t, "2:42-2:43"), *rng)
+
+	edit, err := s.Rename(context.Background(), &protocol.RenameParams{TextDocument: at.TextDocument, Position: at.Position, NewName: "item"})
+	require.NoError(t, err)
+	assert.Equal(t, `local x = 1;
+local arr = [x, 2];
+[item + y for item in arr if item > 0 for y in [item, item]] + {
+  [k]: x for k in std.objectFields({ a: 1 })
+}.a + (function(y=x) y)()`, applyTextEdits(t, referencesTestDocument, edit.Changes[string(uri)]))
+
+	for _, name := range []string{"local", "1x", "a-b"} {
+		_, err = s.Rename(context.Background(), &protocol.RenameParams{TextDocument: at.TextDocument, Position: at.Position, NewName: name})
+		assert.EqualError(t, err, fmt.Sprintf("JSON RPC invalid params: %q is not a valid variable name", name))
+	}
+}
+
+func formatRange(rng protocol.Range) string {
+	return fmt.Sprintf("%d:%d-%d:%d", rng.Start.Line, rng.Start.Character, rng.End.Line, rng.End.Character)
+}
+
+func TestLocateComprehensionVariables(t *testing.T) {
+	testCases := []struct {
+		name     string
+		document string
+		expected string
+	}{
+		{name: "same line", document: "[x for x in [1]]", expected: "0:7-0:8"},
+		{name: "parenthesized expression", document: "[x for x in ( [1] )]", expected: "0:7-0:8"},
+		{name: "over several lines", document: "[\n  x\n  for\n    x\n  in\n    [1]\n]", expected: "3:4-3:5"},
+		{name: "comment before in", document: "[x for x /* the element */ in [1]]"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			root, err := parseDocument("test.jsonnet", tc.document)
+			require.NoError(t, err)
+
+			found := ""
+			for _, v := range findVariables(root) {
+				if v.name == "x" {
+					found = formatRange(position.RangeASTToProtocol(v.selection))
+				}
+			}
+			assert.Equal(t, tc.expected, found)
+		})
+	}
+}
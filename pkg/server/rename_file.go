@@ -0,0 +1,214 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/go-jsonnet/ast"
+	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// renameFile renames a file and rewrites the imports of the file, and of the files of the workspace that import it,
+// in a single workspace edit that the client applies, or with the fallback edit for the clients that can't. The
+// arguments are the file's current and new names.
+func (s *Server) renameFile(ctx context.Context, params *protocol.ExecuteCommandParams) (interface{}, error) {
+	args := params.Arguments
+	if len(args) != 2 {
+		return nil, fmt.Errorf("expected 2 arguments, got %d", len(args))
+	}
+
+	var oldName, newName string
+	if err := json.Unmarshal(args[0], &oldName); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal file name: %v", err)
+	}
+	if err := json.Unmarshal(args[1], &newName); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal new file name: %v", err)
+	}
+	if _, err := os.Stat(newName); err == nil {
+		return nil, fmt.Errorf("%s already exists", newName)
+	}
+
+	edits, err := s.importRewrites(ctx, oldName, newName)
+	if err != nil {
+		return nil, err
+	}
+	uris := make([]string, 0, len(edits))
+	for uri := range edits {
+		uris = append(uris, uri)
+	}
+	sort.Strings(uris)
+
+	// The text edits apply to the files before they are renamed
+	var changes []interface{}
+	for _, uri := range uris {
+		changes = append(changes, s.textDocumentEdit(protocol.DocumentURI(uri), edits[uri]))
+	}
+	changes = append(changes, protocol.RenameFile{
+		Kind:   "rename",
+		OldURI: protocol.URIFromPath(oldName),
+		NewURI: protocol.URIFromPath(newName),
+	})
+	label := fmt.Sprintf("Rename %s to %s", filepath.Base(oldName), filepath.Base(newName))
+	// The imports of the whole workspace are rewritten, they are reviewed before they are applied
+	description := fmt.Sprintf("Rewrites the imports of %d files", len(uris))
+	if len(uris) == 1 {
+		description = "Rewrites the imports of 1 file"
+	}
+	annotation := &protocol.ChangeAnnotation{Label: label, Description: description, NeedsConfirmation: true}
+	return nil, s.applyResourceEdit(ctx, label, changes, annotation)
+}
+
+// WillRenameFiles rewrites the imports of the files that are renamed, and of the files of the workspace that import
+// them.
+func (s *Server) WillRenameFiles(ctx context.Context, params *protocol.RenameFilesParams) (*protocol.WorkspaceEdit, error) {
+	edit := &protocol.WorkspaceEdit{Changes: map[string][]protocol.TextEdit{}}
+	for _, file := range params.Files {
+		edits, err := s.importRewrites(ctx, protocol.DocumentURI(file.OldURI).SpanURI().Filename(), protocol.DocumentURI(file.NewURI).SpanURI().Filename())
+		if err != nil {
+			return nil, err
+		}
+		for uri, fileEdits := range edits {
+			edit.Changes[uri] = append(edit.Changes[uri], fileEdits...)
+		}
+	}
+	return edit, nil
+}
+
+// importRewrites returns the edits, by document, that keep the imports pointing to a file once it is renamed: those
+// of the files of the workspace that import it, and the relative imports of the file itself.
+func (s *Server) importRewrites(ctx context.Context, oldName, newName string) (map[string][]protocol.TextEdit, error) {
+	if !filepath.IsAbs(oldName) || !filepath.IsAbs(newName) {
+		return nil, fmt.Errorf("expected absolute file names, got %s and %s", oldName, newName)
+	}
+
+	edits := map[string][]protocol.TextEdit{}
+	// The imports of the file relative to its directory are relative to its new directory
+	for _, imported := range s.fileImports(oldName) {
+		target := filepath.Join(filepath.Dir(oldName), filepath.FromSlash(imported.literal.Value))
+		if imported.foundAt != target || target == oldName {
+			continue
+		}
+		if rel, err := filepath.Rel(filepath.Dir(newName), target); err == nil {
+			uri := string(protocol.URIFromPath(oldName))
+			edits[uri] = append(edits[uri], importEdit(imported, filepath.ToSlash(rel)))
+		}
+	}
+
+	if s.workspaceFolder == "" {
+		return edits, nil
+	}
+	err := filepath.WalkDir(s.workspaceFolder, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if entry.IsDir() {
+			if path != s.workspaceFolder && (strings.HasPrefix(entry.Name(), ".") || entry.Name() == "vendor") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if ext := filepath.Ext(path); (ext != ".jsonnet" && ext != ".libsonnet") || path == oldName {
+			return nil
+		}
+		for _, imported := range s.fileImports(path) {
+			if imported.foundAt != oldName {
+				continue
+			}
+			uri := string(protocol.URIFromPath(path))
+			edits[uri] = append(edits[uri], importEdit(imported, newImportPath(path, imported.literal.Value, oldName, newName)))
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, ctx.Err()) {
+		return nil, fmt.Errorf("failed to list the files of the workspace: %w", err)
+	}
+	return s.withoutReadOnlyEdits(edits), ctx.Err()
+}
+
+// resolvedImport is an import, importstr or importbin of a file, and the absolute path of the file it imports.
+type resolvedImport struct {
+	literal *ast.LiteralString
+	// quote is the quote that the path is written with, the parser doesn't keep it
+	quote   byte
+	foundAt string
+}
+
+// fileImports returns the imports of a file that resolve, with the file's importer.
+func (s *Server) fileImports(path string) []resolvedImport {
+	text := s.readWorkspaceFile(path)
+	root, err := snippetToAST(path, text)
+	if err != nil {
+		log.Debugf("fileImports: unable to parse %s: %v", path, err)
+		return nil
+	}
+	config := s.configurationFor(path)
+	importer := s.getImporter(config, path, s.projectSettings(config, path))
+
+	var imports []resolvedImport
+	walk(root, func(node ast.Node) {
+		var literal *ast.LiteralString
+		switch node := node.(type) {
+		case *ast.Import:
+			literal = node.File
+		case *ast.ImportStr:
+			literal = node.File
+		case *ast.ImportBin:
+			literal = node.File
+		default:
+			return
+		}
+		_, foundAt, err := importer.Import(path, literal.Value)
+		if err != nil {
+			return
+		}
+		quote := byte('\'')
+		if offset := locationOffset(text, literal.LocRange.Begin); offset < len(text) {
+			quote = text[offset]
+		}
+		if abs, err := filepath.Abs(foundAt); err == nil {
+			imports = append(imports, resolvedImport{literal: literal, quote: quote, foundAt: abs})
+		}
+	})
+	return imports
+}
+
+// newImportPath returns the path that a file imports a renamed file with. An import relative to the file's directory
+// stays relative to it, one relative to a library path stays relative to the library path while the new name is in
+// it.
+func newImportPath(path, importPath, oldName, newName string) string {
+	root := filepath.Dir(path)
+	if filepath.Join(root, filepath.FromSlash(importPath)) != oldName {
+		// The import was resolved in a library path, the one that the old name ends with the import path in
+		root = strings.TrimSuffix(oldName, string(filepath.Separator)+filepath.Clean(filepath.FromSlash(importPath)))
+		if rel, err := filepath.Rel(root, newName); err == nil && !strings.HasPrefix(rel, "..") {
+			return filepath.ToSlash(rel)
+		}
+		root = filepath.Dir(path)
+	}
+	rel, err := filepath.Rel(root, newName)
+	if err != nil {
+		return filepath.ToSlash(newName)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// importEdit replaces the path of an import, with the quotes of the original path.
+func importEdit(imported resolvedImport, importPath string) protocol.TextEdit {
+	quoted := "'" + strings.ReplaceAll(importPath, "'", "\\'") + "'"
+	if imported.quote == '"' {
+		quoted = "\"" + strings.ReplaceAll(importPath, "\"", "\\\"") + "\""
+	}
+	return protocol.TextEdit{Range: position.RangeASTToProtocol(imported.literal.LocRange), NewText: quoted}
+}
@@ -0,0 +1,339 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/jsonrpc2"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// applyingCaller records the workspace edits that the server asks to apply, and answers whether they are applied.
+type applyingCaller struct {
+	applied bool
+	method  string
+	params  json.RawMessage
+}
+
+func (c *applyingCaller) Call(_ context.Context, method string, params, result interface{}) (jsonrpc2.ID, error) {
+	c.method = method
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return jsonrpc2.ID{}, err
+	}
+	c.params = raw
+	result.(*protocol.ApplyWorkspaceEditResult).Applied = c.applied
+	if !c.applied {
+		result.(*protocol.ApplyWorkspaceEditResult).FailureReason = "the file is read-only"
+	}
+	return jsonrpc2.ID{}, nil
+}
+
+// confirmingClient answers the messages that ask to confirm an edit with the action it picks.
+type confirmingClient struct {
+	*recordingClient
+
+	pick  string
+	asked []string
+}
+
+func (c *confirmingClient) ShowMessageRequest(_ context.Context, params *protocol.ShowMessageRequestParams) (*protocol.MessageActionItem, error) {
+	c.asked = append(c.asked, params.Message)
+	if c.pick == "" {
+		return nil, nil
+	}
+	return &protocol.MessageActionItem{Title: c.pick}, nil
+}
+
+func renameTestServer(t *testing.T, root string, caller Caller) *Server {
+	t.Helper()
+	s := NewServer("any", "test version", &recordingClient{}, Configuration{})
+	params := &protocol.ParamInitialize{}
+	params.RootURI = protocol.URIFromPath(root)
+	params.Capabilities.Workspace.ApplyEdit = true
+	params.Capabilities.Workspace.WorkspaceEdit = &protocol.WorkspaceEditClientCapabilities{
+		DocumentChanges:    true,
+		ResourceOperations: []protocol.ResourceOperationKind{"create", "rename"},
+	}
+	_, err := s.Initialize(context.Background(), params)
+	require.NoError(t, err)
+	s.SetCaller(caller)
+	require.NoError(t, s.DidChangeConfiguration(context.Background(), &protocol.DidChangeConfigurationParams{
+		Settings: map[string]interface{}{"jpath": []interface{}{"${workspaceFolder}/lib"}},
+	}))
+	return s
+}
+
+func TestRenameFile(t *testing.T) {
+	files := map[string]string{
+		"lib/app.libsonnet":  "{\n  util: import 'util.libsonnet',\n  data: importstr \"data.txt\",\n}\n",
+		"lib/util.libsonnet": "{}",
+		"lib/data.txt":       "data",
+		"main.jsonnet":       "local app = import 'lib/app.libsonnet';\napp\n",
+		"env/main.jsonnet":   "import \"app.libsonnet\"\n",
+		"other.jsonnet":      "import 'lib/util.libsonnet'\n",
+	}
+	root := writeProjectFiles(t, files)
+	caller := &applyingCaller{applied: true}
+	s := renameTestServer(t, root, caller)
+
+	oldName, newName := filepath.Join(root, "lib/app.libsonnet"), filepath.Join(root, "lib/apps/app.libsonnet")
+	args := []json.RawMessage{}
+	for _, name := range []string{oldName, newName} {
+		raw, err := json.Marshal(name)
+		require.NoError(t, err)
+		args = append(args, raw)
+	}
+	_, err := s.ExecuteCommand(context.Background(), &protocol.ExecuteCommandParams{Command: "jsonnet.renameFile", Arguments: args})
+	require.NoError(t, err)
+	assert.Equal(t, "workspace/applyEdit", caller.method)
+
+	var params struct {
+		Label string `json:"label"`
+		Edit  struct {
+			DocumentChanges []json.RawMessage `json:"documentChanges"`
+		} `json:"edit"`
+	}
+	require.NoError(t, json.Unmarshal(caller.params, &params))
+	assert.Equal(t, "Rename app.libsonnet to app.libsonnet", params.Label)
+	changes := params.Edit.DocumentChanges
+	require.Len(t, changes, 4)
+
+	// The text edits come first, in the order of the files, then the rename
+	rewritten := map[string]string{}
+	for _, change := range changes[:3] {
+		var edit resourceTextDocumentEdit
+		require.NoError(t, json.Unmarshal(change, &edit))
+		assert.Nil(t, edit.TextDocument.Version)
+		rel, err := filepath.Rel(root, edit.TextDocument.URI.SpanURI().Filename())
+		require.NoError(t, err)
+		rewritten[filepath.ToSlash(rel)] = applyTextEdits(t, files[filepath.ToSlash(rel)], edit.Edits)
+	}
+	assert.Equal(t, map[string]string{
+		"lib/app.libsonnet": "{\n  util: import '../util.libsonnet',\n  data: importstr \"../data.txt\",\n}\n",
+		"main.jsonnet":      "local app = import 'lib/apps/app.libsonnet';\napp\n",
+		"env/main.jsonnet":  "import \"apps/app.libsonnet\"\n",
+	}, rewritten)
+	var rename protocol.RenameFile
+	require.NoError(t, json.Unmarshal(changes[3], &rename))
+	assert.Equal(t, protocol.RenameFile{Kind: "rename", OldURI: protocol.URIFromPath(oldName), NewURI: protocol.URIFromPath(newName)}, rename)
+
+	// The clients that rename the files themselves get the same import rewrites
+	edit, err := s.WillRenameFiles(context.Background(), &protocol.RenameFilesParams{
+		Files: []protocol.FileRename{{OldURI: string(protocol.URIFromPath(oldName)), NewURI: string(protocol.URIFromPath(newName))}},
+	})
+	require.NoError(t, err)
+	assert.Len(t, edit.Changes, 3)
+	assert.Len(t, edit.Changes[string(protocol.URIFromPath(oldName))], 2)
+}
+
+func TestRenameFile_ChangeAnnotations(t *testing.T) {
+	root := writeProjectFiles(t, map[string]string{
+		"lib/app.libsonnet": "{}",
+		"main.jsonnet":      "import 'lib/app.libsonnet'\n",
+	})
+	caller := &applyingCaller{applied: true}
+	s := renameTestServer(t, root, caller)
+	s.clientChangeAnnotations = true
+
+	args := []json.RawMessage{}
+	for _, name := range []string{"lib/app.libsonnet", "app.libsonnet"} {
+		raw, err := json.Marshal(filepath.Join(root, name))
+		require.NoError(t, err)
+		args = append(args, raw)
+	}
+	_, err := s.ExecuteCommand(context.Background(), &protocol.ExecuteCommandParams{Command: "jsonnet.renameFile", Arguments: args})
+	require.NoError(t, err)
+
+	var params struct {
+		Edit struct {
+			DocumentChanges   []map[string]json.RawMessage         `json:"documentChanges"`
+			ChangeAnnotations map[string]protocol.ChangeAnnotation `json:"changeAnnotations"`
+		} `json:"edit"`
+	}
+	require.NoError(t, json.Unmarshal(caller.params, &params))
+	assert.Equal(t, map[string]protocol.ChangeAnnotation{
+		changeAnnotationID: {Label: "Rename app.libsonnet to app.libsonnet", Description: "Rewrites the imports of 1 file", NeedsConfirmation: true},
+	}, params.Edit.ChangeAnnotations)
+
+	// The edits and the rename refer to the annotation
+	require.Len(t, params.Edit.DocumentChanges, 2)
+	var edits []annotatedTextEdit
+	require.NoError(t, json.Unmarshal(params.Edit.DocumentChanges[0]["edits"], &edits))
+	require.Len(t, edits, 1)
+	assert.Equal(t, changeAnnotationID, edits[0].AnnotationID)
+	assert.JSONEq(t, `"rename"`, string(params.Edit.DocumentChanges[1]["kind"]))
+	assert.JSONEq(t, `"`+changeAnnotationID+`"`, string(params.Edit.DocumentChanges[1]["annotationId"]))
+}
+
+func TestRenameFile_Errors(t *testing.T) {
+	root := writeProjectFiles(t, map[string]string{
+		"a.libsonnet": "{}",
+		"b.libsonnet": "{}",
+	})
+	testCases := []struct {
+		name        string
+		caller      Caller
+		newName     string
+		expectedErr string
+	}{
+		{
+			name:        "existing file",
+			caller:      &applyingCaller{applied: true},
+			newName:     "b.libsonnet",
+			expectedErr: filepath.Join(root, "b.libsonnet") + " already exists",
+		},
+		{
+			name:        "edit not applied",
+			caller:      &applyingCaller{},
+			newName:     "c.libsonnet",
+			expectedErr: "the client didn't apply the edit: the file is read-only",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := renameTestServer(t, root, tc.caller)
+			args := []json.RawMessage{}
+			for _, name := range []string{"a.libsonnet", tc.newName} {
+				raw, err := json.Marshal(filepath.Join(root, name))
+				require.NoError(t, err)
+				args = append(args, raw)
+			}
+			_, err := s.ExecuteCommand(context.Background(), &protocol.ExecuteCommandParams{Command: "jsonnet.renameFile", Arguments: args})
+			assert.EqualError(t, err, tc.expectedErr)
+			_, err = os.Stat(filepath.Join(root, "a.libsonnet"))
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestRenameFile_Fallback(t *testing.T) {
+	files := map[string]string{
+		"lib/app.libsonnet": "{}",
+		"main.jsonnet":      "local app = import 'lib/app.libsonnet';\napp\n",
+		"other.jsonnet":     "import 'lib/app.libsonnet'\n",
+	}
+	root := writeProjectFiles(t, files)
+	caller := &applyingCaller{applied: true}
+	s := renameTestServer(t, root, caller)
+	client := &confirmingClient{recordingClient: &recordingClient{}, pick: applyEditAction}
+	s.client = client
+	// The client applies text edits, but doesn't rename files
+	s.resourceOperations = nil
+	s.clientDocumentChanges = false
+	uri := serverOpenTestFile(t, s, filepath.Join(root, "main.jsonnet"))
+
+	rename := func(oldName, newName string) error {
+		args := []json.RawMessage{}
+		for _, name := range []string{oldName, newName} {
+			raw, err := json.Marshal(filepath.Join(root, name))
+			require.NoError(t, err)
+			args = append(args, raw)
+		}
+		_, err := s.ExecuteCommand(context.Background(), &protocol.ExecuteCommandParams{Command: "jsonnet.renameFile", Arguments: args})
+		return err
+	}
+	require.NoError(t, rename("lib/app.libsonnet", "lib/apps/app.libsonnet"))
+
+	// The client doesn't preview the changes on disk, the user confirms them first
+	assert.Equal(t, []string{"Rename app.libsonnet to app.libsonnet: Rewrites the imports of 2 files. The files on disk are changed without a preview. Apply the changes?"}, client.asked)
+
+	// The server renames the file, and rewrites the files that aren't open
+	_, err := os.Stat(filepath.Join(root, "lib/app.libsonnet"))
+	assert.True(t, os.IsNotExist(err))
+	content, err := os.ReadFile(filepath.Join(root, "lib/apps/app.libsonnet"))
+	require.NoError(t, err)
+	assert.Equal(t, "{}", string(content))
+	content, err = os.ReadFile(filepath.Join(root, "other.jsonnet"))
+	require.NoError(t, err)
+	assert.Equal(t, "import 'lib/apps/app.libsonnet'\n", string(content))
+
+	// The client edits the open documents, with a workspace edit of text edits
+	assert.Equal(t, "workspace/applyEdit", caller.method)
+	var params protocol.ApplyWorkspaceEditParams
+	require.NoError(t, json.Unmarshal(caller.params, &params))
+	assert.Equal(t, "Rename app.libsonnet to app.libsonnet", params.Label)
+	assert.Nil(t, params.Edit.DocumentChanges)
+	require.Len(t, params.Edit.Changes, 1)
+	assert.Equal(t, "local app = import 'lib/apps/app.libsonnet';\napp\n", applyTextEdits(t, files["main.jsonnet"], params.Edit.Changes[string(uri)]))
+
+	// An open file can't be renamed on disk, the client would keep it under its old name
+	assert.EqualError(t, rename("main.jsonnet", "app.jsonnet"),
+		"the client doesn't support renaming files with workspace edits, and "+filepath.Join(root, "main.jsonnet")+" is open")
+}
+
+func TestRenameFile_FallbackUndone(t *testing.T) {
+	files := map[string]string{
+		"lib/app.libsonnet": "{}",
+		"main.jsonnet":      "local app = import 'lib/app.libsonnet';\napp\n",
+		"other.jsonnet":     "import 'lib/app.libsonnet'\n",
+	}
+	testCases := []struct {
+		name        string
+		caller      Caller
+		applyEdit   bool
+		pick        string
+		expectedErr string
+	}{
+		{
+			name:        "edit not applied",
+			caller:      &applyingCaller{},
+			applyEdit:   true,
+			pick:        applyEditAction,
+			expectedErr: "the client didn't apply the edit: the file is read-only",
+		},
+		{
+			name:        "no workspace edits",
+			caller:      &applyingCaller{applied: true},
+			pick:        applyEditAction,
+			expectedErr: "the client doesn't support workspace edits",
+		},
+		{
+			name:        "cancelled",
+			caller:      &applyingCaller{applied: true},
+			applyEdit:   true,
+			pick:        cancelEditAction,
+			expectedErr: "Rename app.libsonnet to app.libsonnet was cancelled",
+		},
+		{
+			name:        "dismissed",
+			caller:      &applyingCaller{applied: true},
+			applyEdit:   true,
+			expectedErr: "Rename app.libsonnet to app.libsonnet was cancelled",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			root := writeProjectFiles(t, files)
+			s := renameTestServer(t, root, tc.caller)
+			s.client = &confirmingClient{recordingClient: &recordingClient{}, pick: tc.pick}
+			s.resourceOperations = nil
+			s.clientDocumentChanges = false
+			s.clientApplyEdit = tc.applyEdit
+			serverOpenTestFile(t, s, filepath.Join(root, "main.jsonnet"))
+
+			args := []json.RawMessage{}
+			for _, name := range []string{"lib/app.libsonnet", "lib/apps/app.libsonnet"} {
+				raw, err := json.Marshal(filepath.Join(root, name))
+				require.NoError(t, err)
+				args = append(args, raw)
+			}
+			_, err := s.ExecuteCommand(context.Background(), &protocol.ExecuteCommandParams{Command: "jsonnet.renameFile", Arguments: args})
+			assert.EqualError(t, err, tc.expectedErr)
+
+			// The workspace is as it was
+			for name, expected := range files {
+				content, err := os.ReadFile(filepath.Join(root, name))
+				require.NoError(t, err)
+				assert.Equal(t, expected, string(content))
+			}
+			_, err = os.Stat(filepath.Join(root, "lib/apps"))
+			assert.True(t, os.IsNotExist(err))
+		})
+	}
+}
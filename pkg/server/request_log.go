@@ -0,0 +1,58 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type requestIDContextKey struct{}
+
+// requestCounter numbers the requests, for their correlation IDs.
+var requestCounter atomic.Uint64
+
+// newRequestID returns the correlation ID of a request. The IDs are unique for the lifetime of the process, and short
+// enough to be searched for in the logs that users attach to their reports.
+func newRequestID() string {
+	return fmt.Sprintf("r%d", requestCounter.Add(1))
+}
+
+// withRequestID returns a context that carries the correlation ID of a request, for the logs of its handler.
+func withRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, id)
+}
+
+// requestID returns the correlation ID of the request that a context belongs to, or an empty string.
+func requestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// RequestIDHook adds the correlation ID of the request to the log entries that are logged with its context, with
+// `log.WithContext(ctx)`, as the request_id field.
+type RequestIDHook struct{}
+
+func (RequestIDHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+func (RequestIDHook) Fire(entry *log.Entry) error {
+	if id := requestID(entry.Context); id != "" {
+		entry.Data["request_id"] = id
+	}
+	return nil
+}
+
+// requestError adds the correlation ID of a request to its error, so that the error that a user sees can be found in
+// the logs. The code of the JSON RPC errors is kept.
+func requestError(id string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("%w (request %s)", err, id)
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/jsonrpc2"
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestIDs(t *testing.T) {
+	logger := log.StandardLogger()
+	previousHooks, previousLevel := logger.ReplaceHooks(log.LevelHooks{}), logger.GetLevel()
+	t.Cleanup(func() {
+		logger.ReplaceHooks(previousHooks)
+		logger.SetLevel(previousLevel)
+	})
+	logger.SetLevel(log.DebugLevel)
+	logger.AddHook(RequestIDHook{})
+	entries := test.NewLocal(logger)
+
+	s := testServer(t, nil)
+	var handlerIDs []string
+	handler := s.InstrumentHandler(func(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+		handlerIDs = append(handlerIDs, requestID(ctx))
+		log.WithContext(ctx).Info("handling")
+		if req.Method() == "textDocument/hover" {
+			return reply(ctx, nil, fmt.Errorf("%w: hover failed", jsonrpc2.ErrInvalidParams))
+		}
+		return reply(ctx, nil, nil)
+	})
+
+	var replies []error
+	reply := func(_ context.Context, _ interface{}, err error) error {
+		replies = append(replies, err)
+		return nil
+	}
+	for _, method := range []string{"textDocument/definition", "textDocument/hover"} {
+		call, err := jsonrpc2.NewCall(jsonrpc2.NewIntID(1), method, nil)
+		require.NoError(t, err)
+		require.NoError(t, handler(context.Background(), reply, call))
+	}
+
+	// Each request has its own ID, which its error ends with, and the code of the error is kept
+	require.Len(t, handlerIDs, 2)
+	assert.NotEqual(t, handlerIDs[0], handlerIDs[1])
+	require.Len(t, replies, 2)
+	assert.NoError(t, replies[0])
+	assert.EqualError(t, replies[1], fmt.Sprintf("JSON RPC invalid params: hover failed (request %s)", handlerIDs[1]))
+	assert.True(t, errors.Is(replies[1], jsonrpc2.ErrInvalidParams))
+
+	// All the log lines of a request carry its ID, the others are those of the server's startup
+	var logged []string
+	for _, entry := range entries.AllEntries() {
+		if _, ok := entry.Data["request_id"]; !ok {
+			continue
+		}
+		logged = append(logged, fmt.Sprintf("%s %s %v", entry.Data["request_id"], entry.Message, entry.Data["method"]))
+	}
+	assert.Equal(t, []string{
+		handlerIDs[0] + " request started textDocument/definition",
+		handlerIDs[0] + " handling <nil>",
+		handlerIDs[0] + " request done textDocument/definition",
+		handlerIDs[1] + " request started textDocument/hover",
+		handlerIDs[1] + " handling <nil>",
+		handlerIDs[1] + " request failed textDocument/hover",
+	}, logged)
+	assert.Equal(t, log.WarnLevel, entries.LastEntry().Level)
+	assert.Equal(t, "JSON RPC invalid params: hover failed", entries.LastEntry().Data[log.ErrorKey].(error).Error())
+
+	// The entries logged without the context of a request have no ID
+	log.Info("background")
+	assert.NotContains(t, entries.LastEntry().Data, "request_id")
+}
@@ -0,0 +1,440 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jdbaldry/go-language-server-protocol/jsonrpc2"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+)
+
+const (
+	applyEditAction  = "Apply"
+	cancelEditAction = "Cancel"
+)
+
+// Caller sends the requests that the protocol's types can't express, such as the workspace edits that create or rename
+// files. A jsonrpc2.Conn is a Caller.
+type Caller interface {
+	Call(ctx context.Context, method string, params, result interface{}) (jsonrpc2.ID, error)
+}
+
+// SetCaller sets where the requests that the protocol's types can't express are sent.
+func (s *Server) SetCaller(caller Caller) {
+	s.caller = caller
+}
+
+// resourceWorkspaceEdit is a workspace edit with resource operations. The document changes of protocol.WorkspaceEdit
+// can only be text document edits.
+type resourceWorkspaceEdit struct {
+	DocumentChanges   []interface{}                        `json:"documentChanges"`
+	ChangeAnnotations map[string]protocol.ChangeAnnotation `json:"changeAnnotations,omitempty"`
+}
+
+type applyResourceEditParams struct {
+	Label string                `json:"label,omitempty"`
+	Edit  resourceWorkspaceEdit `json:"edit"`
+}
+
+// resourceTextDocumentEdit is a text document edit whose version is null for the documents that aren't open, their
+// content on disk is the one edited.
+type resourceTextDocumentEdit struct {
+	TextDocument struct {
+		URI     protocol.DocumentURI `json:"uri"`
+		Version *int32               `json:"version"`
+	} `json:"textDocument"`
+	Edits []protocol.TextEdit `json:"edits"`
+}
+
+// clientResourceOperations returns the resource operations, such as create and rename, of the workspace edits that a
+// client applies.
+func clientResourceOperations(capabilities protocol.Workspace2Gn) map[protocol.ResourceOperationKind]bool {
+	operations := map[protocol.ResourceOperationKind]bool{}
+	if !capabilities.ApplyEdit || capabilities.WorkspaceEdit == nil || !capabilities.WorkspaceEdit.DocumentChanges {
+		return operations
+	}
+	for _, operation := range capabilities.WorkspaceEdit.ResourceOperations {
+		operations[operation] = true
+	}
+	return operations
+}
+
+// changeAnnotationID identifies the annotation of the changes of a workspace edit, they all have the same.
+const changeAnnotationID = "jsonnet"
+
+// annotatedTextDocumentEdit, annotatedCreateFile and annotatedRenameFile are the document changes with a change
+// annotation, the protocol's types don't have one.
+type annotatedTextDocumentEdit struct {
+	TextDocument struct {
+		URI     protocol.DocumentURI `json:"uri"`
+		Version *int32               `json:"version"`
+	} `json:"textDocument"`
+	Edits []annotatedTextEdit `json:"edits"`
+}
+
+type annotatedTextEdit struct {
+	protocol.TextEdit
+	AnnotationID string `json:"annotationId"`
+}
+
+type annotatedCreateFile struct {
+	protocol.CreateFile
+	AnnotationID string `json:"annotationId"`
+}
+
+type annotatedRenameFile struct {
+	protocol.RenameFile
+	AnnotationID string `json:"annotationId"`
+}
+
+// clientChangeAnnotations tells whether the client shows the change annotations of workspace edits. The presence of
+// the changeAnnotationSupport capability is lost when it is unmarshalled, the clients that have it set its
+// groupsOnLabel, or honor the annotations of renames.
+func clientChangeAnnotations(capabilities protocol.ClientCapabilities) bool {
+	workspaceEdit := capabilities.Workspace.WorkspaceEdit
+	return workspaceEdit != nil && workspaceEdit.DocumentChanges &&
+		(workspaceEdit.ChangeAnnotationSupport.GroupsOnLabel || capabilities.TextDocument.Rename.HonorsChangeAnnotations)
+}
+
+// annotateChanges returns the document changes with the change annotation.
+func annotateChanges(changes []interface{}) []interface{} {
+	annotated := make([]interface{}, 0, len(changes))
+	for _, change := range changes {
+		switch change := change.(type) {
+		case resourceTextDocumentEdit:
+			edit := annotatedTextDocumentEdit{TextDocument: change.TextDocument}
+			for _, textEdit := range change.Edits {
+				edit.Edits = append(edit.Edits, annotatedTextEdit{TextEdit: textEdit, AnnotationID: changeAnnotationID})
+			}
+			annotated = append(annotated, edit)
+		case protocol.CreateFile:
+			annotated = append(annotated, annotatedCreateFile{CreateFile: change, AnnotationID: changeAnnotationID})
+		case protocol.RenameFile:
+			annotated = append(annotated, annotatedRenameFile{RenameFile: change, AnnotationID: changeAnnotationID})
+		default:
+			annotated = append(annotated, change)
+		}
+	}
+	return annotated
+}
+
+// textDocumentEdit returns the edits of a document, for the version of the document that is open.
+func (s *Server) textDocumentEdit(uri protocol.DocumentURI, edits []protocol.TextEdit) resourceTextDocumentEdit {
+	edit := resourceTextDocumentEdit{Edits: edits}
+	edit.TextDocument.URI = uri
+	if doc, err := s.cache.get(uri); err == nil {
+		version := doc.item.Version
+		edit.TextDocument.Version = &version
+	}
+	return edit
+}
+
+// applyResourceEdit asks the client to apply the document changes, text document edits and resource operations, in a
+// single workspace edit. The changes of the risky edits have an annotation, that the clients which support them show
+// in their preview, and ask to confirm when it needs confirmation. The clients that can't apply the changes get the
+// fallback edit.
+func (s *Server) applyResourceEdit(ctx context.Context, label string, changes []interface{}, annotation *protocol.ChangeAnnotation) error {
+	s.warnReadOnlyEdits(changedDocuments(changes))
+	if !s.clientAppliesChanges(changes) {
+		return s.applyFallbackEdit(ctx, label, changes, annotation)
+	}
+
+	edit := resourceWorkspaceEdit{DocumentChanges: changes}
+	if annotation != nil && s.clientChangeAnnotations {
+		edit.DocumentChanges = annotateChanges(changes)
+		edit.ChangeAnnotations = map[string]protocol.ChangeAnnotation{changeAnnotationID: *annotation}
+	}
+	var result protocol.ApplyWorkspaceEditResult
+	_, err := s.caller.Call(ctx, "workspace/applyEdit", applyResourceEditParams{Label: label, Edit: edit}, &result)
+	if err != nil {
+		return err
+	}
+	if !result.Applied {
+		return fmt.Errorf("the client didn't apply the edit: %s", result.FailureReason)
+	}
+	return nil
+}
+
+// clientAppliesChanges tells whether the client applies the document changes: their text document edits, and their
+// resource operations.
+func (s *Server) clientAppliesChanges(changes []interface{}) bool {
+	if s.caller == nil || !s.clientDocumentChanges {
+		return false
+	}
+	for _, change := range changes {
+		switch change.(type) {
+		case protocol.CreateFile:
+			if !s.resourceOperations["create"] {
+				return false
+			}
+		case protocol.RenameFile:
+			if !s.resourceOperations["rename"] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// applyFallbackEdit applies the document changes for the clients that can't: the server creates and renames the files
+// on disk, and edits the files that aren't open, then asks the client to apply the edits of the open documents with a
+// workspace edit that only has text edits. The files that are created or renamed mustn't be open, the client would
+// keep editing them under their old name. Everything is checked before the disk is changed, and the changes on disk
+// are undone if the client doesn't apply its edit, so that the workspace isn't left half-edited. The client doesn't
+// preview the changes on disk, the edits that need confirmation are confirmed with a message before the disk is changed.
+func (s *Server) applyFallbackEdit(ctx context.Context, label string, changes []interface{}, annotation *protocol.ChangeAnnotation) error {
+	var uris []protocol.DocumentURI
+	edits := map[protocol.DocumentURI][]protocol.TextEdit{}
+	// sources are the files that the edits of the files that are created or renamed apply to, empty for the created
+	sources := map[protocol.DocumentURI]string{}
+	// steps are the changes on disk, each returns the function that undoes it
+	var steps []func() (func() error, error)
+	for _, change := range changes {
+		switch change := change.(type) {
+		case resourceTextDocumentEdit:
+			if _, ok := edits[change.TextDocument.URI]; !ok {
+				uris = append(uris, change.TextDocument.URI)
+			}
+			edits[change.TextDocument.URI] = append(edits[change.TextDocument.URI], change.Edits...)
+		case protocol.CreateFile:
+			fileName := change.URI.SpanURI().Filename()
+			if _, err := os.Stat(fileName); err == nil {
+				return fmt.Errorf("failed to create %s: it already exists", fileName)
+			}
+			sources[change.URI] = ""
+			steps = append(steps, func() (func() error, error) { return createEmptyFile(fileName) })
+		case protocol.RenameFile:
+			if _, err := s.cache.get(change.OldURI); err == nil {
+				return fmt.Errorf("the client doesn't support renaming files with workspace edits, and %s is open", change.OldURI.SpanURI().Filename())
+			}
+			oldName, newName := change.OldURI.SpanURI().Filename(), change.NewURI.SpanURI().Filename()
+			if _, err := os.Stat(oldName); err != nil {
+				return fmt.Errorf("failed to rename %s: %w", oldName, err)
+			}
+			if _, err := os.Stat(newName); err == nil {
+				return fmt.Errorf("failed to rename %s: %s already exists", oldName, newName)
+			}
+			source, ok := sources[change.OldURI]
+			if !ok {
+				source = oldName
+			}
+			sources[change.NewURI] = source
+			steps = append(steps, func() (func() error, error) { return moveFile(oldName, newName) })
+			// The edits of the file before it is renamed apply to its new name
+			if fileEdits, ok := edits[change.OldURI]; ok {
+				delete(edits, change.OldURI)
+				edits[change.NewURI] = append(edits[change.NewURI], fileEdits...)
+				for i, uri := range uris {
+					if uri == change.OldURI {
+						uris[i] = change.NewURI
+					}
+				}
+			}
+		default:
+			return fmt.Errorf("unsupported document change %T", change)
+		}
+	}
+
+	clientEdits := map[string][]protocol.TextEdit{}
+	for _, uri := range uris {
+		if _, err := s.cache.get(uri); err == nil {
+			clientEdits[string(uri)] = edits[uri]
+			continue
+		}
+		fileName := uri.SpanURI().Filename()
+		source, ok := sources[uri]
+		if !ok {
+			source = fileName
+		}
+		// The edited content is computed now, an edit that doesn't apply fails before the disk is changed
+		edited, err := editedContent(source, edits[uri])
+		if err != nil {
+			return fmt.Errorf("failed to edit %s: %w", fileName, err)
+		}
+		steps = append(steps, func() (func() error, error) { return overwriteFile(fileName, edited) })
+	}
+	if len(clientEdits) > 0 && (s.caller == nil || !s.clientApplyEdit) {
+		return fmt.Errorf("the client doesn't support workspace edits")
+	}
+	if annotation != nil && annotation.NeedsConfirmation {
+		if err := s.confirmFallbackEdit(ctx, annotation); err != nil {
+			return err
+		}
+	}
+
+	var undos []func() error
+	undo := func(err error) error {
+		for i := len(undos) - 1; i >= 0; i-- {
+			if undoErr := undos[i](); undoErr != nil {
+				err = fmt.Errorf("%w, and undoing the changes on disk failed: %v", err, undoErr)
+			}
+		}
+		return err
+	}
+	for _, step := range steps {
+		stepUndo, err := step()
+		if err != nil {
+			return undo(err)
+		}
+		undos = append(undos, stepUndo)
+	}
+	if len(clientEdits) == 0 {
+		return nil
+	}
+
+	var result protocol.ApplyWorkspaceEditResult
+	_, err := s.caller.Call(ctx, "workspace/applyEdit", protocol.ApplyWorkspaceEditParams{
+		Label: label,
+		Edit:  protocol.WorkspaceEdit{Changes: clientEdits},
+	}, &result)
+	if err != nil {
+		return undo(err)
+	}
+	if !result.Applied {
+		return undo(fmt.Errorf("the client didn't apply the edit: %s", result.FailureReason))
+	}
+	return nil
+}
+
+// confirmFallbackEdit asks the user to confirm the changes of an annotation, that the fallback edit applies on disk.
+func (s *Server) confirmFallbackEdit(ctx context.Context, annotation *protocol.ChangeAnnotation) error {
+	if s.client == nil {
+		return fmt.Errorf("%s can't be confirmed, there is no client to ask", annotation.Label)
+	}
+	message := annotation.Label
+	if annotation.Description != "" {
+		message = fmt.Sprintf("%s: %s", message, annotation.Description)
+	}
+	picked, err := s.client.ShowMessageRequest(ctx, &protocol.ShowMessageRequestParams{
+		Type:    protocol.Warning,
+		Message: message + ". The files on disk are changed without a preview. Apply the changes?",
+		Actions: []protocol.MessageActionItem{{Title: applyEditAction}, {Title: cancelEditAction}},
+	})
+	if err != nil {
+		return fmt.Errorf("unable to confirm the edit: %w", err)
+	}
+	if picked == nil || picked.Title != applyEditAction {
+		return fmt.Errorf("%s was cancelled", annotation.Label)
+	}
+	return nil
+}
+
+// createEmptyFile creates an empty file, and the directories it is in.
+func createEmptyFile(fileName string) (func() error, error) {
+	removeDirs, err := makeDirs(filepath.Dir(fileName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", fileName, err)
+	}
+	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to create %s: %w", fileName, err), removeDirs())
+	}
+	file.Close()
+	return func() error {
+		return errors.Join(os.Remove(fileName), removeDirs())
+	}, nil
+}
+
+// moveFile renames a file, and creates the directories of its new name.
+func moveFile(oldName, newName string) (func() error, error) {
+	removeDirs, err := makeDirs(filepath.Dir(newName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to rename %s: %w", oldName, err)
+	}
+	if err := os.Rename(oldName, newName); err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to rename %s: %w", oldName, err), removeDirs())
+	}
+	return func() error {
+		return errors.Join(os.Rename(newName, oldName), removeDirs())
+	}, nil
+}
+
+// overwriteFile writes the content of a file, that exists.
+func overwriteFile(fileName, content string) (func() error, error) {
+	previous, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to edit %s: %w", fileName, err)
+	}
+	if err := os.WriteFile(fileName, []byte(content), 0o644); err != nil {
+		return nil, fmt.Errorf("failed to edit %s: %w", fileName, err)
+	}
+	return func() error {
+		return os.WriteFile(fileName, previous, 0o644)
+	}, nil
+}
+
+// makeDirs creates a directory and its missing parents. It returns the function that removes those it created.
+func makeDirs(dir string) (func() error, error) {
+	// The topmost directory that is missing, everything in it was created afterwards
+	missing := ""
+	for current := dir; ; current = filepath.Dir(current) {
+		if _, err := os.Stat(current); err == nil {
+			break
+		}
+		missing = current
+		if filepath.Dir(current) == current {
+			break
+		}
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return func() error {
+		if missing == "" {
+			return nil
+		}
+		return os.RemoveAll(missing)
+	}, nil
+}
+
+// editedContent returns the content of a file once edited, the edits of a file that doesn't exist apply to an empty
+// content.
+func editedContent(fileName string, edits []protocol.TextEdit) (string, error) {
+	content := ""
+	if fileName != "" {
+		data, err := os.ReadFile(fileName)
+		if err != nil {
+			return "", err
+		}
+		content = string(data)
+	}
+	return applyEdits(content, edits)
+}
+
+// applyEdits applies non-overlapping text edits to a text, whose positions are byte offsets in their line.
+func applyEdits(text string, edits []protocol.TextEdit) (string, error) {
+	lines := strings.SplitAfter(text, "\n")
+	offset := func(pos protocol.Position) (int, error) {
+		if int(pos.Line) >= len(lines) {
+			return 0, fmt.Errorf("line %d is after the end of the text", pos.Line+1)
+		}
+		o := 0
+		for _, line := range lines[:pos.Line] {
+			o += len(line)
+		}
+		return o + min(int(pos.Character), len(lines[pos.Line])), nil
+	}
+
+	sorted := append([]protocol.TextEdit{}, edits...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i].Range.Start, sorted[j].Range.Start
+		return a.Line > b.Line || a.Line == b.Line && a.Character > b.Character
+	})
+	for _, edit := range sorted {
+		start, err := offset(edit.Range.Start)
+		if err != nil {
+			return "", err
+		}
+		end, err := offset(edit.Range.End)
+		if err != nil {
+			return "", err
+		}
+		text = text[:start] + edit.NewText + text[end:]
+	}
+	return text, nil
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// sandboxRoots returns the directories that the imports are restricted to when the sandbox setting is set: the
+// workspace folder and the configured jpaths. The jpaths of the file's project aren't roots, they come from the files
+// of the repository, which could set them to any directory. The roots are absolute, with their symbolic links
+// resolved. It returns nil, no restriction, when the setting isn't set.
+func (s *Server) sandboxRoots(config Configuration) []string {
+	if !config.Sandbox {
+		return nil
+	}
+	dirs := append([]string{}, config.JPaths...)
+	if s.workspaceFolder != "" {
+		dirs = append(dirs, s.workspaceFolder)
+	}
+	// Not nil, even without any root: nothing can be imported then
+	roots := make([]string, 0, len(dirs))
+	for _, dir := range dirs {
+		roots = append(roots, resolvePath(dir))
+	}
+	return roots
+}
+
+// sandboxedJPaths returns the jpaths of a project that are in the sandbox, all of them if there is no sandbox.
+func sandboxedJPaths(roots, jpaths []string) []string {
+	if roots == nil {
+		return jpaths
+	}
+	var sandboxed []string
+	for _, jpath := range jpaths {
+		if inSandbox(roots, jpath) {
+			sandboxed = append(sandboxed, jpath)
+		}
+	}
+	return sandboxed
+}
+
+// inSandbox tells whether a path is in one of the sandbox's roots. Its symbolic links are resolved, a link in the
+// workspace can't point out of it, and so are the `..` that would traverse out of the roots.
+func inSandbox(roots []string, path string) bool {
+	path = resolvePath(path)
+	for _, root := range roots {
+		if rel, err := filepath.Rel(root, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolvePath returns the absolute path of a file, with its symbolic links resolved if it exists.
+func resolvePath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	return path
+}
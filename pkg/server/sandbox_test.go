@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSandbox(t *testing.T) {
+	outside := writeProjectFiles(t, map[string]string{"secret.libsonnet": `'secret'`})
+	jpath := writeProjectFiles(t, map[string]string{"lib.libsonnet": `'jpath'`})
+	root := writeProjectFiles(t, map[string]string{
+		"main.jsonnet":            `'main'`,
+		"lib/util.libsonnet":      `'util'`,
+		"vendor/k/main.libsonnet": `'vendored'`,
+	})
+	require.NoError(t, os.Symlink(outside, filepath.Join(root, "link")))
+	relativeOutside, err := filepath.Rel(root, filepath.Join(outside, "secret.libsonnet"))
+	require.NoError(t, err)
+
+	s := testServer(t, nil)
+	s.workspaceFolder = root
+	main := filepath.Join(root, "main.jsonnet")
+	importFile := func(importedPath string) (string, error) {
+		contents, _, err := s.getImporter(s.configuration, main, &projectSettings{}).Import(main, importedPath)
+		if err != nil {
+			return "", err
+		}
+		return contents.String(), nil
+	}
+
+	// Without the sandbox, any file can be imported
+	contents, err := importFile(filepath.Join(outside, "secret.libsonnet"))
+	require.NoError(t, err)
+	assert.Equal(t, `'secret'`, contents)
+
+	require.NoError(t, s.DidChangeConfiguration(context.Background(), &protocol.DidChangeConfigurationParams{
+		Settings: map[string]interface{}{"sandbox": true, "jpath": []interface{}{jpath}},
+	}))
+	testCases := []struct {
+		name         string
+		importedPath string
+		expected     string
+		outOfSandbox string
+	}{
+		{name: "next to the file", importedPath: "lib/util.libsonnet", expected: `'util'`},
+		{name: "vendored", importedPath: "vendor/k/main.libsonnet", expected: `'vendored'`},
+		{name: "jpath", importedPath: "lib.libsonnet", expected: `'jpath'`},
+		{name: "absolute in the workspace", importedPath: main, expected: `'main'`},
+		{name: "absolute", importedPath: filepath.Join(outside, "secret.libsonnet"), outOfSandbox: filepath.Join(outside, "secret.libsonnet")},
+		{name: "traversal", importedPath: relativeOutside, outOfSandbox: filepath.Join(outside, "secret.libsonnet")},
+		{name: "symbolic link", importedPath: "link/secret.libsonnet", outOfSandbox: filepath.Join(root, "link/secret.libsonnet")},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			contents, err := importFile(tc.importedPath)
+			if tc.outOfSandbox != "" {
+				assert.EqualError(t, err, "couldn't open import \""+tc.importedPath+"\": "+tc.outOfSandbox+
+					" is out of the sandbox, only the files of the workspace and of the Jsonnet library paths can be imported")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, contents)
+		})
+	}
+}
+
+func TestSandboxProjectJPaths(t *testing.T) {
+	outside := writeProjectFiles(t, map[string]string{"secret.libsonnet": `'secret'`})
+	root := writeProjectFiles(t, map[string]string{
+		"main.jsonnet":     `'main'`,
+		"lib/in.libsonnet": `'in'`,
+		// A repository can point the library paths of its projects out of the workspace
+		"qbec.yaml": "apiVersion: qbec.io/v1alpha1\nkind: App\nspec:\n  libPaths: ['" + outside + "', lib]\n",
+	})
+	s := testServer(t, nil)
+	s.workspaceFolder = root
+	main := filepath.Join(root, "main.jsonnet")
+	importFile := func(importedPath string) (string, error) {
+		config := s.configurationFor(main)
+		contents, _, err := s.getImporter(config, main, s.projectSettings(config, main)).Import(main, importedPath)
+		if err != nil {
+			return "", err
+		}
+		return contents.String(), nil
+	}
+
+	// The qbec application's library paths are searched
+	contents, err := importFile("secret.libsonnet")
+	require.NoError(t, err)
+	assert.Equal(t, `'secret'`, contents)
+
+	// With the sandbox, only those in the workspace are
+	require.NoError(t, s.DidChangeConfiguration(context.Background(), &protocol.DidChangeConfigurationParams{
+		Settings: map[string]interface{}{"sandbox": true},
+	}))
+	_, err = importFile("secret.libsonnet")
+	assert.EqualError(t, err, "couldn't open import \"secret.libsonnet\": no match locally or in the Jsonnet library paths")
+	_, err = importFile(filepath.Join(outside, "secret.libsonnet"))
+	assert.ErrorContains(t, err, "is out of the sandbox")
+	contents, err = importFile("in.libsonnet")
+	require.NoError(t, err)
+	assert.Equal(t, `'in'`, contents)
+}
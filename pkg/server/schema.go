@@ -0,0 +1,287 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/go-jsonnet/ast"
+	"github.com/google/go-jsonnet/toolutils"
+	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
+	"github.com/grafana/jsonnet-language-server/pkg/schema"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// SchemaConfiguration associates a JSON Schema with the objects it describes: the objects whose apiVersion and kind
+// fields match (Kubernetes style), or the top-level object of the files that match one of the FileMatch globs.
+type SchemaConfiguration struct {
+	Path       string   `mapstructure:"path"`
+	APIVersion string   `mapstructure:"apiVersion"`
+	Kind       string   `mapstructure:"kind"`
+	FileMatch  []string `mapstructure:"fileMatch"`
+}
+
+func (c SchemaConfiguration) matchesObject(object *ast.DesugaredObject) bool {
+	if c.APIVersion == "" && c.Kind == "" {
+		return false
+	}
+	fields := map[string]string{}
+	for _, field := range object.Fields {
+		name, ok := field.Name.(*ast.LiteralString)
+		if !ok {
+			continue
+		}
+		if value, ok := field.Body.(*ast.LiteralString); ok {
+			fields[name.Value] = value.Value
+		}
+	}
+	return (c.APIVersion == "" || fields["apiVersion"] == c.APIVersion) && (c.Kind == "" || fields["kind"] == c.Kind)
+}
+
+func (c SchemaConfiguration) matchesFile(filename string) bool {
+	return matchesFileGlobs(c.FileMatch, filename)
+}
+
+// matchesFileGlobs tells whether the globs match the file's path or its name.
+func matchesFileGlobs(patterns []string, filename string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := filepath.Match(pattern, filename); matched {
+			return true
+		}
+		if matched, _ := filepath.Match(pattern, filepath.Base(filename)); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// objectStep is an object literal on the way from a document's root to a position.
+type objectStep struct {
+	object *ast.DesugaredObject
+	// field is the name of the field, of the previous object, whose value contains the object
+	field string
+	// inArray is true when the object is an element of an array that is the value of the field
+	inArray bool
+	// known is false when the object isn't directly in a field of the previous object, in a function argument for example
+	known bool
+	// topLevel is true when the object is the value of the document
+	topLevel bool
+	// merged is true when the object is merged with another one, which may have the fields it lacks
+	merged bool
+}
+
+// walkObjects calls visit with the path to each object literal of the tree, from the outermost object to that object.
+// The nodes for which enter returns false are skipped, along with their children.
+func walkObjects(root ast.Node, enter func(ast.Node) bool, visit func(path []objectStep)) {
+	var path []objectStep
+	var descend func(node ast.Node, step objectStep)
+	descend = func(node ast.Node, step objectStep) {
+		if node == nil || !enter(node) {
+			return
+		}
+		switch node := node.(type) {
+		case *ast.Local:
+			for _, bind := range node.Binds {
+				descend(bind.Body, objectStep{})
+			}
+			descend(node.Body, step)
+		case *ast.Binary:
+			// Objects that are merged are described by the same schema
+			step.merged = step.merged || node.Op == ast.BopPlus
+			descend(node.Left, step)
+			descend(node.Right, step)
+		case *ast.Array:
+			for _, element := range node.Elements {
+				descend(element.Expr, objectStep{field: step.field, inArray: true, known: step.known && !step.inArray})
+			}
+		case *ast.DesugaredObject:
+			step.object = node
+			path = append(path, step)
+			visit(path)
+			for _, bind := range node.Locals {
+				descend(bind.Body, objectStep{})
+			}
+			for _, field := range node.Fields {
+				name, ok := field.Name.(*ast.LiteralString)
+				if !ok {
+					descend(field.Body, objectStep{})
+					continue
+				}
+				descend(field.Body, objectStep{field: name.Value, known: true, merged: field.PlusSuper})
+			}
+			path = path[:len(path)-1]
+		default:
+			for _, child := range toolutils.Children(node) {
+				descend(child, objectStep{})
+			}
+		}
+	}
+	descend(root, objectStep{known: true, topLevel: true})
+}
+
+// objectsAt returns the object literals that contain the position, from the outermost to the innermost.
+func objectsAt(root ast.Node, pos ast.Location) []objectStep {
+	var steps []objectStep
+	walkObjects(root, func(node ast.Node) bool {
+		// Some desugared nodes have no location, their children do
+		loc := node.Loc()
+		return loc.Begin.Line == 0 || inRange(pos, *loc)
+	}, func(path []objectStep) {
+		// The objects are visited before the objects they contain
+		steps = append([]objectStep(nil), path...)
+	})
+	return steps
+}
+
+// schemaAt returns the schema of the innermost object that contains the position, and that object.
+func (s *Server) schemaAt(root ast.Node, filename string, pos ast.Location) (*schema.Schema, *ast.DesugaredObject) {
+	steps := objectsAt(root, pos)
+	if len(steps) == 0 {
+		return nil, nil
+	}
+	objectSchema := s.pathSchema(steps, filename)
+	if objectSchema == nil {
+		return nil, nil
+	}
+	return objectSchema, steps[len(steps)-1].object
+}
+
+// pathSchema returns the schema of the last object of the path. It is found from the innermost object that matches
+// a schema, by following the fields down to the object.
+func (s *Server) pathSchema(path []objectStep, filename string) *schema.Schema {
+	schemas := s.config().Schemas
+	if len(schemas) == 0 {
+		return nil
+	}
+	for i := len(path) - 1; i >= 0; i-- {
+		for _, config := range schemas {
+			if !config.matchesObject(path[i].object) && !(path[i].topLevel && config.matchesFile(filename)) {
+				continue
+			}
+			current, err := s.schemaLoader.Load(config.Path)
+			if err != nil {
+				log.Errorf("pathSchema: unable to load schema %s: %v", config.Path, err)
+				continue
+			}
+			for _, step := range path[i+1:] {
+				if !step.known {
+					return nil
+				}
+				current = current.Property(step.field)
+				if step.inArray {
+					current = current.Items()
+				}
+			}
+			return current
+		}
+	}
+	return nil
+}
+
+// schemaPropertyDocumentation describes a property in markdown.
+func schemaPropertyDocumentation(property *schema.Schema, required bool) string {
+	doc := ""
+	if t := property.Type(); t != "" {
+		doc += fmt.Sprintf("`%s`", t)
+	}
+	if required {
+		if doc != "" {
+			doc += " "
+		}
+		doc += "**(required)**"
+	}
+	if description := property.Description(); description != "" {
+		if doc != "" {
+			doc += "\n\n"
+		}
+		doc += description
+	}
+	return doc
+}
+
+var (
+	// schemaKeyRegexp matches a line that ends with a key being typed
+	schemaKeyRegexp = regexp.MustCompile(`(?:^|[{,])\s*['"]?([\w-]*)$`)
+	// schemaValueRegexp matches a line that ends with a value being typed, after its key
+	schemaValueRegexp = regexp.MustCompile(`(?:^|[{,])\s*['"]?([\w-]+)['"]?\s*:{1,3}\s*(['"]?)[\w./-]*$`)
+	// identifierRegexp matches the field names that don't have to be quoted
+	identifierRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// completionSchema completes the keys of the objects described by a schema, and the values of their enum properties.
+func (s *Server) completionSchema(doc *document, line string, pos protocol.Position) []protocol.CompletionItem {
+	objectSchema, object := s.schemaAt(doc.ast, doc.item.URI.SpanURI().Filename(), position.ProtocolToAST(pos))
+	if objectSchema == nil {
+		return nil
+	}
+
+	if match := schemaValueRegexp.FindStringSubmatch(line); match != nil {
+		var items []protocol.CompletionItem
+		for _, value := range objectSchema.Property(match[1]).Enum() {
+			output, err := json.Marshal(value)
+			if err != nil {
+				continue
+			}
+			label := string(output)
+			insertText := label
+			if text, ok := value.(string); ok {
+				label = text
+				insertText = fmt.Sprintf("'%s'", text)
+				if match[2] != "" {
+					// The quote is already typed
+					insertText = text
+				}
+			}
+			items = append(items, protocol.CompletionItem{
+				Label:      label,
+				Kind:       protocol.EnumMemberCompletion,
+				InsertText: insertText,
+			})
+		}
+		return items
+	}
+
+	match := schemaKeyRegexp.FindStringSubmatch(line)
+	if match == nil {
+		return nil
+	}
+	existing := map[string]bool{}
+	for _, field := range object.Fields {
+		if name, ok := field.Name.(*ast.LiteralString); ok {
+			existing[name.Value] = true
+		}
+	}
+	required := map[string]bool{}
+	for _, name := range objectSchema.Required() {
+		required[name] = true
+	}
+
+	var items []protocol.CompletionItem
+	for name, property := range objectSchema.Properties() {
+		if existing[name] || !strings.HasPrefix(name, match[1]) {
+			continue
+		}
+		insertText := schemaFieldName(name) + ": "
+		sortText := "1" + name
+		if required[name] {
+			// Required fields come first
+			sortText = "0" + name
+		}
+		items = append(items, protocol.CompletionItem{
+			Label:         name,
+			Kind:          protocol.FieldCompletion,
+			Detail:        property.Type(),
+			Documentation: schemaPropertyDocumentation(property, required[name]),
+			InsertText:    insertText,
+			SortText:      sortText,
+		})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].SortText < items[j].SortText
+	})
+	return items
+}
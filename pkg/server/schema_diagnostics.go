@@ -0,0 +1,213 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-jsonnet/ast"
+	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
+	"github.com/grafana/jsonnet-language-server/pkg/schema"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	schemaRequiredDiagnosticCode = "schema-required"
+	schemaEnumDiagnosticCode     = "schema-enum"
+)
+
+// missingSchemaFields are the required fields that an object described by a schema lacks.
+type missingSchemaFields struct {
+	diagnostic protocol.Diagnostic
+	object     *ast.DesugaredObject
+	schema     *schema.Schema
+	fields     []string
+}
+
+// findSchemaProblems checks the objects described by a schema: their required fields must be there, and the
+// literal values of their enum properties must be allowed.
+func (s *Server) findSchemaProblems(doc *document) ([]missingSchemaFields, []protocol.Diagnostic) {
+	if len(s.config().Schemas) == 0 || doc.ast == nil || len(doc.linesChangedSinceAST) > 0 {
+		return nil, nil
+	}
+
+	filename := doc.item.URI.SpanURI().Filename()
+	var missing []missingSchemaFields
+	var enumDiags []protocol.Diagnostic
+	walkObjects(doc.ast, func(ast.Node) bool { return true }, func(path []objectStep) {
+		objectSchema := s.pathSchema(path, filename)
+		if objectSchema == nil {
+			return
+		}
+		step := path[len(path)-1]
+
+		present := map[string]bool{}
+		// The fields of an object with computed names are not all known
+		allKnown := true
+		for _, field := range step.object.Fields {
+			name, ok := field.Name.(*ast.LiteralString)
+			if !ok {
+				allKnown = false
+				continue
+			}
+			if field.Hide != ast.ObjectFieldHidden {
+				present[name.Value] = true
+			}
+			if diag, ok := invalidEnumValue(name.Value, field.Body, objectSchema.Property(name.Value)); ok {
+				enumDiags = append(enumDiags, diag)
+			}
+		}
+
+		if !allKnown || step.merged {
+			return
+		}
+		var fields []string
+		for _, name := range objectSchema.Required() {
+			if !present[name] {
+				fields = append(fields, name)
+			}
+		}
+		if len(fields) == 0 {
+			return
+		}
+		message := fmt.Sprintf("missing required fields: %s", strings.Join(fields, ", "))
+		if len(fields) == 1 {
+			message = fmt.Sprintf("missing required field: %s", fields[0])
+		}
+		// The diagnostic is on the opening brace, the whole object would hide the diagnostics it contains
+		braceRange := step.object.LocRange
+		braceRange.End = ast.Location{Line: braceRange.Begin.Line, Column: braceRange.Begin.Column + 1}
+		missing = append(missing, missingSchemaFields{
+			diagnostic: protocol.Diagnostic{
+				Range:    position.RangeASTToProtocol(braceRange),
+				Severity: protocol.SeverityWarning,
+				Code:     schemaRequiredDiagnosticCode,
+				Source:   "lint",
+				Message:  message,
+			},
+			object: step.object,
+			schema: objectSchema,
+			fields: fields,
+		})
+	})
+	return missing, enumDiags
+}
+
+// invalidEnumValue reports the literal value of a field that isn't one of the values its schema allows.
+func invalidEnumValue(name string, body ast.Node, property *schema.Schema) (protocol.Diagnostic, bool) {
+	enum := property.Enum()
+	if len(enum) == 0 {
+		return protocol.Diagnostic{}, false
+	}
+	var value interface{}
+	switch body := body.(type) {
+	case *ast.LiteralString:
+		value = body.Value
+	case *ast.LiteralNumber:
+		number, err := strconv.ParseFloat(body.OriginalString, 64)
+		if err != nil {
+			return protocol.Diagnostic{}, false
+		}
+		value = number
+	case *ast.LiteralBoolean:
+		value = body.Value
+	case *ast.LiteralNull:
+		value = nil
+	default:
+		// Only literals are checked, the other values would have to be evaluated
+		return protocol.Diagnostic{}, false
+	}
+
+	var allowed []string
+	for _, item := range enum {
+		if item == value {
+			return protocol.Diagnostic{}, false
+		}
+		if output, err := json.Marshal(item); err == nil {
+			allowed = append(allowed, string(output))
+		}
+	}
+	return protocol.Diagnostic{
+		Range:    position.RangeASTToProtocol(*body.Loc()),
+		Severity: protocol.SeverityWarning,
+		Code:     schemaEnumDiagnosticCode,
+		Source:   "lint",
+		Message:  fmt.Sprintf("invalid value for %s, expected one of: %s", name, strings.Join(allowed, ", ")),
+	}, true
+}
+
+// schemaCodeActions offers to add the required fields reported as missing, with placeholder values.
+func (s *Server) schemaCodeActions(doc *document, diags []protocol.Diagnostic) []protocol.CodeAction {
+	var actions []protocol.CodeAction
+	var missing []missingSchemaFields
+	for _, diag := range diags {
+		if diag.Code != schemaRequiredDiagnosticCode {
+			continue
+		}
+		if missing == nil {
+			missing, _ = s.findSchemaProblems(doc)
+		}
+		for _, object := range missing {
+			if object.diagnostic.Range != diag.Range || object.diagnostic.Message != diag.Message {
+				continue
+			}
+			var fields []string
+			for _, name := range object.fields {
+				fields = append(fields, schemaFieldName(name)+": "+schemaPlaceholder(object.schema.Property(name)))
+			}
+			edit, err := s.appendFieldsEdit(object.object, fields)
+			if err != nil {
+				log.Errorf("CodeAction: unable to add required fields %v: %v", object.fields, err)
+				continue
+			}
+			title := "Add missing required fields"
+			if len(object.fields) == 1 {
+				title = fmt.Sprintf("Add required field %s", object.fields[0])
+			}
+			actions = append(actions, protocol.CodeAction{
+				Title:       title,
+				Kind:        protocol.QuickFix,
+				Diagnostics: []protocol.Diagnostic{diag},
+				Edit:        edit,
+			})
+		}
+	}
+	return actions
+}
+
+// schemaFieldName returns the name of a field as it is written in an object, quoted if it isn't an identifier.
+func schemaFieldName(name string) string {
+	if identifierRegexp.MatchString(name) {
+		return name
+	}
+	return fmt.Sprintf("'%s'", name)
+}
+
+// schemaPlaceholder returns a value of the property's type, its first allowed value if it has an enum.
+func schemaPlaceholder(property *schema.Schema) string {
+	if enum := property.Enum(); len(enum) > 0 {
+		if text, ok := enum[0].(string); ok {
+			return fmt.Sprintf("'%s'", text)
+		}
+		if output, err := json.Marshal(enum[0]); err == nil {
+			return string(output)
+		}
+	}
+	firstType, _, _ := strings.Cut(property.Type(), "|")
+	switch firstType {
+	case "object":
+		return "{}"
+	case "array":
+		return "[]"
+	case "string":
+		return "''"
+	case "number", "integer":
+		return "0"
+	case "boolean":
+		return "false"
+	default:
+		return "null"
+	}
+}
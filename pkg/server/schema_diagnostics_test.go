@@ -0,0 +1,143 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindSchemaProblems(t *testing.T) {
+	testCases := []struct {
+		name     string
+		document string
+		expected []string
+	}{
+		{
+			name:     "required fields are there",
+			document: "{ kind: 'Deployment', spec: { selector: {} } }",
+		},
+		{
+			name:     "missing required field",
+			document: "{ kind: 'Deployment' }",
+			expected: []string{"missing required field: spec"},
+		},
+		{
+			name:     "missing nested required field",
+			document: "{ kind: 'Deployment', spec: { replicas: 1 } }",
+			expected: []string{"missing required field: selector"},
+		},
+		{
+			name:     "hidden fields are not in the output",
+			document: "{ kind: 'Deployment', spec:: { selector: {} } }",
+			expected: []string{"missing required field: spec"},
+		},
+		{
+			name:     "merged objects may have the missing fields",
+			document: "local base = { spec: { selector: {} } };\nbase + { kind: 'Deployment', spec+: { replicas: 1 } }",
+		},
+		{
+			name:     "computed field names",
+			document: "local name = 'spec';\n{ kind: 'Deployment', [name]: {} }",
+		},
+		{
+			name:     "invalid enum value",
+			document: "{ kind: 'Deployment', spec: { selector: {}, containers: [{ imagePullPolicy: 'Sometimes' }, { imagePullPolicy: 'Always' }] } }",
+			expected: []string{`invalid value for imagePullPolicy, expected one of: "Always", "IfNotPresent"`},
+		},
+		{
+			name:     "values that are not literals are not checked",
+			document: "local policy = 'Sometimes';\n{ kind: 'Deployment', spec: { selector: {}, containers: [{ imagePullPolicy: policy }] } }",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			schemaPath := filepath.Join(t.TempDir(), "deployment.json")
+			require.NoError(t, os.WriteFile(schemaPath, []byte(testDeploymentSchema), 0o600))
+
+			server, uri := testServerWithFile(t, nil, tc.document)
+			setConfiguration(server, func(c *Configuration) {
+				c.Schemas = []SchemaConfiguration{{Path: schemaPath, Kind: "Deployment"}}
+			})
+			doc, err := server.cache.get(uri)
+			require.NoError(t, err)
+
+			var messages []string
+			missing, enumDiags := server.findSchemaProblems(doc)
+			for _, object := range missing {
+				assert.Equal(t, schemaRequiredDiagnosticCode, object.diagnostic.Code)
+				messages = append(messages, object.diagnostic.Message)
+			}
+			for _, diag := range enumDiags {
+				assert.Equal(t, schemaEnumDiagnosticCode, diag.Code)
+				messages = append(messages, diag.Message)
+			}
+			assert.Equal(t, tc.expected, messages)
+		})
+	}
+}
+
+func TestSchemaCodeAction(t *testing.T) {
+	testCases := []struct {
+		name          string
+		document      string
+		expectedRange protocol.Range
+		expectedTitle string
+		expected      string
+	}{
+		{
+			name:          "single line",
+			document:      "{ kind: 'Deployment', spec: {} }",
+			expectedRange: protocol.Range{Start: protocol.Position{Character: 28}, End: protocol.Position{Character: 29}},
+			expectedTitle: "Add required field selector",
+			expected:      "{ kind: 'Deployment', spec: { selector: {} } }",
+		},
+		{
+			name:          "multiple lines",
+			document:      "{\n  metadata: {},\n}",
+			expectedRange: protocol.Range{End: protocol.Position{Character: 1}},
+			expectedTitle: "Add missing required fields",
+			expected:      "{\n  metadata: {},\n  kind: 'Deployment',\n  spec: {},\n}",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			schemaPath := filepath.Join(dir, "deployment.json")
+			require.NoError(t, os.WriteFile(schemaPath, []byte(`{
+				"required": ["kind", "spec"],
+				"properties": {
+					"kind": {"enum": ["Deployment"]},
+					"spec": {"type": "object", "required": ["selector"], "properties": {"selector": {"type": "object"}}}
+				}
+			}`), 0o600))
+
+			server, uri := testServerWithFile(t, nil, tc.document)
+			setConfiguration(server, func(c *Configuration) {
+				c.Schemas = []SchemaConfiguration{{Path: schemaPath, FileMatch: []string{"*"}}}
+			})
+			doc, err := server.cache.get(uri)
+			require.NoError(t, err)
+
+			missing, _ := server.findSchemaProblems(doc)
+			require.Len(t, missing, 1)
+			assert.Equal(t, tc.expectedRange, missing[0].diagnostic.Range)
+
+			actions, err := server.CodeAction(context.Background(), &protocol.CodeActionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+				Context:      protocol.CodeActionContext{Diagnostics: []protocol.Diagnostic{missing[0].diagnostic}},
+			})
+			require.NoError(t, err)
+			require.NotEmpty(t, actions)
+			assert.Equal(t, tc.expectedTitle, actions[0].Title)
+
+			edits := actions[0].Edit.Changes[string(uri)]
+			require.Len(t, edits, 1)
+			assert.Equal(t, tc.expected, applyTextEdits(t, tc.document, edits))
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testDeploymentSchema = `{
+	"type": "object",
+	"required": ["spec"],
+	"properties": {
+		"apiVersion": {"type": "string"},
+		"kind": {"type": "string"},
+		"metadata": {"type": "object", "properties": {"name": {"type": "string"}, "app.kubernetes.io/name": {"type": "string"}}},
+		"spec": {"$ref": "#/definitions/spec"}
+	},
+	"definitions": {
+		"spec": {
+			"type": "object",
+			"required": ["selector"],
+			"properties": {
+				"replicas": {"type": "integer", "description": "Number of pods"},
+				"selector": {"type": "object"},
+				"containers": {"type": "array", "items": {"$ref": "#/definitions/container"}}
+			}
+		},
+		"container": {
+			"type": "object",
+			"properties": {
+				"imagePullPolicy": {"type": "string", "enum": ["Always", "IfNotPresent"]}
+			}
+		}
+	}
+}`
+
+func TestSchemaCompletion(t *testing.T) {
+	schemaPath := filepath.Join(t.TempDir(), "deployment.json")
+	require.NoError(t, os.WriteFile(schemaPath, []byte(testDeploymentSchema), 0o600))
+
+	testCases := []struct {
+		name     string
+		schema   SchemaConfiguration
+		content  string
+		cursor   string
+		expected []string
+	}{
+		{
+			name:   "keys of a nested object, required first",
+			schema: SchemaConfiguration{Path: schemaPath, APIVersion: "apps/v1", Kind: "Deployment"},
+			content: `{
+  apiVersion: 'apps/v1',
+  kind: 'Deployment',
+  spec: {
+    replicas: 1,
+    CURSOR
+  },
+}`,
+			cursor:   "CURSOR",
+			expected: []string{"selector", "containers"},
+		},
+		{
+			name:   "keys of the top-level object of a matching file",
+			schema: SchemaConfiguration{Path: schemaPath, FileMatch: []string{"*"}},
+			content: `{
+  metadata: {},
+  CURSOR
+}`,
+			cursor:   "CURSOR",
+			expected: []string{"spec", "apiVersion", "kind"},
+		},
+		{
+			name:   "enum values of an array element's field",
+			schema: SchemaConfiguration{Path: schemaPath, Kind: "Deployment"},
+			content: `{
+  kind: 'Deployment',
+  spec: {
+    containers: [{ imagePullPolicy: 'CURSOR' }],
+  },
+}`,
+			cursor:   "CURSOR",
+			expected: []string{"Always", "IfNotPresent"},
+		},
+		{
+			name:   "object that doesn't match",
+			schema: SchemaConfiguration{Path: schemaPath, Kind: "Service"},
+			content: `{
+  kind: 'Deployment',
+  CURSOR
+}`,
+			cursor: "CURSOR",
+			// Only the keywords of an object's fields are offered
+			expected: []string{"assert", "local"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var position protocol.Position
+			for i, line := range strings.Split(tc.content, "\n") {
+				if index := strings.Index(line, tc.cursor); index != -1 {
+					position = protocol.Position{Line: uint32(i), Character: uint32(index)}
+				}
+			}
+			server, fileURI := testServerWithFile(t, completionTestStdlib, strings.ReplaceAll(tc.content, tc.cursor, ""))
+			setConfiguration(server, func(c *Configuration) {
+				c.Schemas = []SchemaConfiguration{tc.schema}
+			})
+
+			result, err := server.Completion(context.Background(), &protocol.CompletionParams{
+				TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+					TextDocument: protocol.TextDocumentIdentifier{URI: fileURI},
+					Position:     position,
+				},
+			})
+			require.NoError(t, err)
+
+			var labels []string
+			for _, item := range result.Items {
+				labels = append(labels, item.Label)
+			}
+			assert.Equal(t, tc.expected, labels)
+		})
+	}
+}
+
+func TestSchemaCompletionItem(t *testing.T) {
+	schemaPath := filepath.Join(t.TempDir(), "deployment.json")
+	require.NoError(t, os.WriteFile(schemaPath, []byte(testDeploymentSchema), 0o600))
+
+	content := "{\n  kind: 'Deployment',\n  spec: {},\n  metadata: {\n    \n  },\n}"
+	server, fileURI := testServerWithFile(t, completionTestStdlib, content)
+	setConfiguration(server, func(c *Configuration) {
+		c.Schemas = []SchemaConfiguration{{Path: schemaPath, Kind: "Deployment"}}
+	})
+
+	doc, err := server.cache.get(fileURI)
+	require.NoError(t, err)
+
+	items := server.completionSchema(doc, "    ", protocol.Position{Line: 4, Character: 4})
+	assert.Equal(t, []protocol.CompletionItem{
+		{
+			Label:         "app.kubernetes.io/name",
+			Kind:          protocol.FieldCompletion,
+			Detail:        "string",
+			Documentation: "`string`",
+			InsertText:    "'app.kubernetes.io/name': ",
+			SortText:      "1app.kubernetes.io/name",
+		},
+		{
+			Label:         "name",
+			Kind:          protocol.FieldCompletion,
+			Detail:        "string",
+			Documentation: "`string`",
+			InsertText:    "name: ",
+			SortText:      "1name",
+		},
+	}, items)
+}
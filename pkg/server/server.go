@@ -4,13 +4,15 @@ import (
 	"context"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/google/go-jsonnet"
 	"github.com/google/go-jsonnet/ast"
+	"github.com/grafana/jsonnet-language-server/pkg/policy"
+	"github.com/grafana/jsonnet-language-server/pkg/schema"
 	"github.com/grafana/jsonnet-language-server/pkg/stdlib"
 	"github.com/grafana/jsonnet-language-server/pkg/utils"
-	tankaJsonnet "github.com/grafana/tanka/pkg/jsonnet/implementations/goimpl"
-	"github.com/grafana/tanka/pkg/jsonnet/jpath"
 	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
 	log "github.com/sirupsen/logrus"
 )
@@ -22,13 +24,36 @@ const (
 
 // New returns a new language server.
 func NewServer(name, version string, client protocol.ClientCloser, configuration Configuration) *Server {
+	files := newFileCache()
 	server := &Server{
-		name:          name,
-		version:       version,
-		cache:         newCache(),
-		client:        client,
-		configuration: configuration,
+		name:             name,
+		version:          version,
+		cache:            newCache(),
+		files:            files,
+		client:           client,
+		status:           newStatusTracker(),
+		metrics:          newMetrics(),
+		telemetry:        newTelemetry(),
+		tracer:           newTracer(),
+		schemaLoader:     schema.NewLoader(),
+		policyLoader:     policy.NewLoader(),
+		projectDetectors: newProjectDetectors(),
+		extVarFiles:      newExtVarFiles(),
+		dashboardPreview: newDashboardPreview(),
+		docs:             newDocsIndex(files),
+		deadCodeDiags:    newDeadCodeDiagnostics(),
+		evalCache:        newEvalCache(),
+		symbolCache:      newSymbolCache(),
+		contexts:         newEvaluationContexts(),
+		commandApprovals: newCommandApprovals(),
+		configuration:    configuration,
+
+		tankaEnvironments: newTankaEnvironmentSelections(),
+		evaluationBudgets: newEvaluationBudgets(),
+		evaluations:       newRunningEvaluations(),
 	}
+	server.diagPublisher = newDiagnosticsPublisher(client, diagnosticsPublishWindow, server.documentVersion)
+	server.docs.maxFileSize.Store(int64(configuration.maxFileSize()))
 
 	return server
 }
@@ -37,57 +62,175 @@ func NewServer(name, version string, client protocol.ClientCloser, configuration
 type Server struct {
 	name, version string
 
-	stdlib []stdlib.Function
-	cache  *cache
-	client protocol.ClientCloser
+	stdlib        []stdlib.Function
+	cache         *cache
+	files         *fileCache
+	client        protocol.ClientCloser
+	notifier      Notifier
+	caller        Caller
+	status        *statusTracker
+	metrics       *metrics
+	telemetry     *telemetry
+	tracer        *tracer
+	diagPublisher *diagnosticsPublisher
+	schemaLoader  *schema.Loader
+	policyLoader  *policy.Loader
 
-	configuration Configuration
+	dashboardPreview *dashboardPreview
+	projectDetectors map[string]projectDetector
+	extVarFiles      *extVarFiles
+	docs             *docsIndex
+	deadCodeDiags    *deadCodeDiagnostics
+	evalCache        *evalCache
+	symbolCache      *symbolCache
+	contexts         *evaluationContexts
+	commandApprovals *commandApprovals
+	// tankaEnvironments are the Tanka inline environments that the diagnostics evaluate
+	tankaEnvironments *tankaEnvironmentSelections
+	// evaluationBudgets are the files that are over their evaluation budget
+	evaluationBudgets *evaluationBudgets
+	// evaluations are the evaluations that run, by feature and file
+	evaluations *runningEvaluations
+	// configMu guards the configuration and the code of the commands, which the handlers and the goroutines they
+	// start read while DidChangeConfiguration and the trust changes replace them. They are read with config and
+	// extCodeOfCommands.
+	configMu sync.RWMutex
+	// commandExtCode is the code of the ext_code_from_command variables, from the last time they were configured
+	commandExtCode map[string]string
+	configuration  Configuration
+	// commandRuns counts the runs of the ext_code_from_command commands, the outputs of a run that another one
+	// followed are dropped. runningCommands are the runs that haven't ended.
+	commandRuns     atomic.Int64
+	runningCommands sync.WaitGroup
+	// workspaceFolder is the path of the workspace, set on initialization
+	workspaceFolder string
+	// untrusted is set, by the initialization options or the jsonnet/didChangeTrust notification, when the workspace
+	// isn't trusted
+	untrusted atomic.Bool
+	// hoverPlainText is set on initialization for the clients that don't render markdown hovers
+	hoverPlainText bool
+	// clientSnippets is set on initialization for the clients that insert completion items as snippets
+	clientSnippets bool
+	// resourceOperations are set on initialization, they are the resource operations of the workspace edits that the
+	// client applies
+	resourceOperations map[protocol.ResourceOperationKind]bool
+	// clientApplyEdit and clientDocumentChanges are set on initialization for the clients that apply workspace edits,
+	// and the document changes of workspace edits
+	clientApplyEdit       bool
+	clientDocumentChanges bool
+	// clientChangeAnnotations is set on initialization for the clients that show the change annotations of workspace
+	// edits
+	clientChangeAnnotations bool
 }
 
 func (s *Server) getVM(path string) *jsonnet.VM {
-	var vm *jsonnet.VM
-	if s.configuration.ResolvePathsWithTanka {
-		jpath, _, _, err := jpath.Resolve(path, false)
-		if err != nil {
-			log.Debugf("Unable to resolve jpath for %s: %s", path, err)
-			// nolint: gocritic
-			jpath = append(s.configuration.JPaths, filepath.Dir(path))
-		}
-		vm = tankaJsonnet.MakeRawVM(jpath, nil, nil, 0)
-	} else {
-		// nolint: gocritic
-		jpath := append(s.configuration.JPaths, filepath.Dir(path))
-		vm = jsonnet.MakeVM()
-		importer := &jsonnet.FileImporter{JPaths: jpath}
-		vm.Importer(importer)
+	config, settings := s.evaluationSettings(path)
+	return s.makeVM(config, settings, s.getImporter(config, path, settings))
+}
+
+// getCancellableVM returns a VM whose imports fail once the context is done.
+func (s *Server) getCancellableVM(ctx context.Context, path string) *jsonnet.VM {
+	config, settings := s.evaluationSettings(path)
+	return s.makeVM(config, settings, &cancellableImporter{ctx: ctx, importer: s.getImporter(config, path, settings)})
+}
+
+func (s *Server) makeVM(config Configuration, settings *projectSettings, importer jsonnet.Importer) *jsonnet.VM {
+	vm := jsonnet.MakeVM()
+	for _, nf := range settings.nativeFunctions {
+		vm.NativeFunction(nf)
 	}
+	vm.Importer(importer)
+	vm.SetTraceOut(&traceWriter{client: s.client})
 
-	resetExtVars(vm, s.configuration.ExtVars, s.configuration.ExtCode)
+	// The configured variables override the projects' ones, and those of files and commands
+	fileVars, fileCode := s.extVarsFromFiles(config)
+	overrideVars(settings.extVars, settings.extCode, fileVars, fileCode)
+	overrideVars(settings.extVars, settings.extCode, nil, s.extCodeOfCommands())
+	overrideVars(settings.extVars, settings.extCode, config.ExtVars, config.ExtCode)
+	overrideVars(settings.tlaVars, settings.tlaCode, config.TLAVars, config.TLACode)
+	resetExtVars(vm, settings.extVars, settings.extCode)
+	for name, value := range settings.tlaVars {
+		vm.TLAVar(name, value)
+	}
+	for name, value := range settings.tlaCode {
+		vm.TLACode(name, value)
+	}
 	return vm
 }
 
-func (s *Server) DidChange(_ context.Context, params *protocol.DidChangeTextDocumentParams) error {
+func (s *Server) getImporter(config Configuration, path string, settings *projectSettings) jsonnet.Importer {
+	sandbox := s.sandboxRoots(config)
+	jpath := append([]string{}, config.JPaths...)
+	// The project's jpaths that lead out of the sandbox aren't searched
+	jpath = append(jpath, sandboxedJPaths(sandbox, settings.jpaths)...)
+	jpath = append(jpath, filepath.Dir(path))
+	return &projectImporter{
+		fileImporter: fileImporter{JPaths: jpath, files: s.files, sandbox: sandbox},
+		imports:      settings.imports,
+		aliases:      config.ImportAliases,
+	}
+}
+
+// documentVersion returns the version of the document currently in the cache.
+func (s *Server) documentVersion(uri protocol.DocumentURI) (int32, bool) {
+	doc, err := s.cache.get(uri)
+	if err != nil {
+		return 0, false
+	}
+	return doc.item.Version, true
+}
+
+func (s *Server) DidChange(ctx context.Context, params *protocol.DidChangeTextDocumentParams) error {
 	defer s.queueDiagnostics(params.TextDocument.URI)
 
-	doc, err := s.cache.get(params.TextDocument.URI)
+	oldDoc, err := s.cache.get(params.TextDocument.URI)
 	if err != nil {
 		return utils.LogErrorf("DidChange: %s: %w", errorRetrievingDocument, err)
 	}
 
-	if params.TextDocument.Version > doc.item.Version && len(params.ContentChanges) != 0 {
-		oldText := doc.item.Text
-		doc.item.Text = params.ContentChanges[len(params.ContentChanges)-1].Text
+	if params.TextDocument.Version > oldDoc.item.Version && len(params.ContentChanges) != 0 {
+		item := oldDoc.item
+		item.Version = params.TextDocument.Version
+		item.Text = params.ContentChanges[len(params.ContentChanges)-1].Text
+		// The documents that aren't analyzed anymore, or that weren't, are parsed from scratch
+		if oldDoc.skipped != "" || skipReason(item.Text, s.configurationFor(item.URI.SpanURI().Filename()).maxFileSize()) != "" {
+			return s.cache.put(s.newDocument(ctx, item))
+		}
+
+		// Documents are snapshots, requests that are still running against the old version keep seeing it
+		doc := &document{
+			item:                 oldDoc.item,
+			ast:                  oldDoc.ast,
+			astText:              oldDoc.astText,
+			astVersion:           oldDoc.astVersion,
+			linesChangedSinceAST: make(map[int]bool, len(oldDoc.linesChangedSinceAST)),
+		}
+		for line, changed := range oldDoc.linesChangedSinceAST {
+			doc.linesChangedSinceAST[line] = changed
+		}
+		doc.item = item
 
 		var ast ast.Node
-		ast, doc.err = jsonnet.SnippetToAST(doc.item.URI.SpanURI().Filename(), doc.item.Text)
+		_, parseSpan := s.startSpan(ctx, "parse")
+		ast, doc.err = parseDocument(doc.item.URI.SpanURI().Filename(), doc.item.Text)
+		parseSpan.end(doc.err)
 
 		// If the AST parsed correctly, set it on the document
-		// Otherwise, keep the old AST, and find all the lines that have changed since last AST
+		// Otherwise, parse the document without the lines that have changed since last AST
+		// If that fails too, keep the old AST, and find all the lines that have changed since last AST
 		if ast != nil {
 			doc.ast = ast
+			doc.astText = doc.item.Text
+			doc.astVersion = doc.item.Version
 			doc.linesChangedSinceAST = map[int]bool{}
+		} else if recovered, recoveredText, changed := recoverAST(doc.item.URI.SpanURI().Filename(), oldDoc.astText, doc.item.Text); recovered != nil {
+			doc.ast = recovered
+			doc.astText = recoveredText
+			doc.recovered = true
+			doc.astVersion = doc.item.Version
+			doc.linesChangedSinceAST = changed
 		} else {
-			splitOldText := strings.Split(oldText, "\n")
+			splitOldText := strings.Split(oldDoc.item.Text, "\n")
 			splitNewText := strings.Split(doc.item.Text, "\n")
 			for index, oldLine := range splitOldText {
 				if index >= len(splitNewText) || oldLine != splitNewText[index] {
@@ -95,24 +238,55 @@ func (s *Server) DidChange(_ context.Context, params *protocol.DidChangeTextDocu
 				}
 			}
 		}
+
+		return s.cache.put(doc)
 	}
 	return nil
 }
 
-func (s *Server) DidOpen(_ context.Context, params *protocol.DidOpenTextDocumentParams) (err error) {
+func (s *Server) DidOpen(ctx context.Context, params *protocol.DidOpenTextDocumentParams) (err error) {
 	defer s.queueDiagnostics(params.TextDocument.URI)
+	go s.docs.loadShard(params.TextDocument.URI.SpanURI().Filename())
 
-	doc := &document{item: params.TextDocument, linesChangedSinceAST: map[int]bool{}}
-	if params.TextDocument.Text != "" {
-		doc.ast, doc.err = jsonnet.SnippetToAST(params.TextDocument.URI.SpanURI().Filename(), params.TextDocument.Text)
-	}
-	return s.cache.put(doc)
+	return s.cache.put(s.newDocument(ctx, params.TextDocument))
 }
 
-func (s *Server) Initialize(_ context.Context, _ *protocol.ParamInitialize) (*protocol.InitializeResult, error) {
+// DidSave follows the imports of the context entrypoints again on the next evaluation, those of the saved file may
+// have changed.
+func (s *Server) DidSave(context.Context, *protocol.DidSaveTextDocumentParams) error {
+	s.contexts.reset()
+	return nil
+}
+
+func (s *Server) Initialize(_ context.Context, params *protocol.ParamInitialize) (*protocol.InitializeResult, error) {
 	log.Infof("Initializing %s version %s", s.name, s.version)
 
+	// The first workspace folder is the one of the ${workspaceFolder} placeholder
+	switch {
+	case len(params.WorkspaceFolders) > 0:
+		s.workspaceFolder = protocol.DocumentURI(params.WorkspaceFolders[0].URI).SpanURI().Filename()
+	case params.RootURI != "":
+		s.workspaceFolder = params.RootURI.SpanURI().Filename()
+	default:
+		s.workspaceFolder = params.RootPath
+	}
+
+	if !initializationTrust(params.InitializationOptions) {
+		log.Info("The workspace isn't trusted: its files aren't evaluated and the commands of the settings don't run")
+		s.untrusted.Store(true)
+	}
+
+	s.hoverPlainText = !markdownFormats(params.Capabilities.TextDocument.Hover.ContentFormat)
+	s.resourceOperations = clientResourceOperations(params.Capabilities.Workspace)
+	s.clientApplyEdit = params.Capabilities.Workspace.ApplyEdit
+	s.clientDocumentChanges = s.clientApplyEdit && params.Capabilities.Workspace.WorkspaceEdit != nil && params.Capabilities.Workspace.WorkspaceEdit.DocumentChanges
+	s.clientChangeAnnotations = clientChangeAnnotations(params.Capabilities)
+	s.clientSnippets = params.Capabilities.TextDocument.Completion.CompletionItem.SnippetSupport
+
 	s.diagnosticsLoop()
+	s.telemetryLoop()
+	s.tracingLoop()
+	s.warmUp()
 
 	var err error
 
@@ -125,15 +299,37 @@ func (s *Server) Initialize(_ context.Context, _ *protocol.ParamInitialize) (*pr
 
 	return &protocol.InitializeResult{
 		Capabilities: protocol.ServerCapabilities{
+			CallHierarchyProvider:      true,
+			CodeLensProvider:           protocol.CodeLensOptions{},
+			CodeActionProvider:         protocol.CodeActionOptions{CodeActionKinds: []protocol.CodeActionKind{protocol.QuickFix, protocol.RefactorRewrite, protocol.Source, protocol.SourceFixAll}},
 			CompletionProvider:         protocol.CompletionOptions{TriggerCharacters: []string{"."}},
 			HoverProvider:              true,
+			DeclarationProvider:        true,
 			DefinitionProvider:         true,
 			DocumentFormattingProvider: true,
 			DocumentSymbolProvider:     true,
+			DocumentHighlightProvider:  true,
+			FoldingRangeProvider:       true,
+			ReferencesProvider:         true,
+			RenameProvider:             protocol.RenameOptions{PrepareProvider: true},
+			SignatureHelpProvider:      protocol.SignatureHelpOptions{TriggerCharacters: []string{"(", ","}},
 			ExecuteCommandProvider:     protocol.ExecuteCommandOptions{Commands: []string{}},
+			TypeDefinitionProvider:     true,
+			WorkspaceSymbolProvider:    true,
+			Workspace: protocol.Workspace5Gn{
+				FileOperations: &protocol.FileOperationOptions{
+					DidDelete: protocol.FileOperationRegistrationOptions{
+						Filters: []protocol.FileOperationFilter{{Scheme: "file", Pattern: protocol.FileOperationPattern{Glob: "**"}}},
+					},
+					WillRename: protocol.FileOperationRegistrationOptions{
+						Filters: []protocol.FileOperationFilter{{Scheme: "file", Pattern: protocol.FileOperationPattern{Glob: "**/*.{jsonnet,libsonnet}"}}},
+					},
+				},
+			},
 			TextDocumentSync: &protocol.TextDocumentSyncOptions{
-				Change:    protocol.Full,
-				OpenClose: true,
+				Change:            protocol.Full,
+				OpenClose:         true,
+				WillSaveWaitUntil: true,
 				Save: protocol.SaveOptions{
 					IncludeText: false,
 				},
@@ -148,3 +344,8 @@ func (s *Server) Initialize(_ context.Context, _ *protocol.ParamInitialize) (*pr
 		},
 	}, nil
 }
+
+func (s *Server) Initialized(context.Context, *protocol.InitializedParams) error {
+	s.registerInlineValue()
+	return nil
+}
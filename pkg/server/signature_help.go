@@ -0,0 +1,265 @@
+package server
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-jsonnet/ast"
+	"github.com/grafana/jsonnet-language-server/pkg/ast/processing"
+	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
+	"github.com/grafana/jsonnet-language-server/pkg/stdlib"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// calleeRegexp matches the function, a name or an index chain, at the end of the text before an opening parenthesis
+	calleeRegexp = regexp.MustCompile(`((?:\$|[A-Za-z_]\w*)(?:\s*\.\s*[A-Za-z_]\w*)*)\s*$`)
+	// namedArgumentRegexp matches an argument that starts with a name, `name=value`
+	namedArgumentRegexp = regexp.MustCompile(`^\s*([A-Za-z_]\w*)\s*=(?:[^=]|$)`)
+	// localFunctionRegexp matches the text before the name of a function defined by a local, `local f(x) = ...`
+	localFunctionRegexp = regexp.MustCompile(`(?:^|\W)local\s+$`)
+)
+
+// signatureKeywords are the keywords that come before parentheses that aren't calls.
+var signatureKeywords = map[string]bool{
+	"assert": true, "else": true, "error": true, "for": true, "function": true, "if": true, "in": true,
+	"local": true, "then": true, "tailstrict": true,
+}
+
+// openBracket is a parenthesis, bracket or brace that isn't closed before the position of a request.
+type openBracket struct {
+	char   byte
+	offset int
+	// argument is the index of the element the position is in, between the commas, and argumentStart its offset
+	argument      int
+	argumentStart int
+}
+
+// openBrackets returns the brackets that are open at the end of the text, from the outermost to the innermost.
+// The brackets and commas of strings and comments are left out.
+func openBrackets(text string) []openBracket {
+	var brackets []openBracket
+	state := scanCode
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch state {
+		case scanString:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				state = scanCode
+			}
+		case scanVerbatimString:
+			if c == quote {
+				if i+1 < len(text) && text[i+1] == quote {
+					i++
+				} else {
+					state = scanCode
+				}
+			}
+		case scanTextBlock:
+			// A text block ends with a line that starts with |||
+			if c == '\n' && strings.HasPrefix(strings.TrimLeft(text[i+1:], " \t"), "|||") {
+				state = scanCode
+				i = strings.Index(text[i:], "|||") + i + 2
+			}
+		case scanBlockComment:
+			if strings.HasPrefix(text[i:], "*/") {
+				state = scanCode
+				i++
+			}
+		case scanCode:
+			switch {
+			case c == '\'' || c == '"':
+				state, quote = scanString, c
+			case c == '@' && i+1 < len(text) && (text[i+1] == '\'' || text[i+1] == '"'):
+				state, quote = scanVerbatimString, text[i+1]
+				i++
+			case strings.HasPrefix(text[i:], "|||"):
+				state = scanTextBlock
+				i += 2
+			case strings.HasPrefix(text[i:], "/*"):
+				state = scanBlockComment
+				i++
+			case c == '#' || strings.HasPrefix(text[i:], "//"):
+				if end := strings.IndexByte(text[i:], '\n'); end != -1 {
+					i += end
+				} else {
+					i = len(text)
+				}
+			case c == '(' || c == '[' || c == '{':
+				brackets = append(brackets, openBracket{char: c, offset: i, argumentStart: i + 1})
+			case c == ')' || c == ']' || c == '}':
+				if len(brackets) > 0 {
+					brackets = brackets[:len(brackets)-1]
+				}
+			case c == ',' && len(brackets) > 0:
+				brackets[len(brackets)-1].argument++
+				brackets[len(brackets)-1].argumentStart = i + 1
+			}
+		}
+	}
+	return brackets
+}
+
+// signatureCall is the call whose arguments contain the position of a request.
+type signatureCall struct {
+	// callee is the function, `f` or `lib.f`, and calleeOffset the offset of its last name
+	callee       string
+	calleeOffset int
+	// argument is the index of the argument the position is in, and name its name if it is a named argument
+	argument int
+	name     string
+}
+
+// findSignatureCall finds the innermost call that the end of the text is in the arguments of. The parentheses that
+// group expressions, or list the parameters of a function, are skipped.
+func findSignatureCall(text string) (signatureCall, bool) {
+	brackets := openBrackets(text)
+	for i := len(brackets) - 1; i >= 0; i-- {
+		bracket := brackets[i]
+		if bracket.char != '(' {
+			continue
+		}
+		match := calleeRegexp.FindStringSubmatchIndex(text[:bracket.offset])
+		if match == nil {
+			continue
+		}
+		callee := strings.Join(strings.Fields(text[match[2]:match[3]]), "")
+		if signatureKeywords[callee] || localFunctionRegexp.MatchString(text[:match[2]]) {
+			continue
+		}
+		call := signatureCall{
+			callee:       callee,
+			calleeOffset: match[2] + strings.LastIndexAny(text[match[2]:match[3]], ".$") + 1,
+			argument:     bracket.argument,
+		}
+		if named := namedArgumentRegexp.FindStringSubmatch(text[bracket.argumentStart:]); named != nil {
+			call.name = named[1]
+		}
+		return call, true
+	}
+	return signatureCall{}, false
+}
+
+func (s *Server) SignatureHelp(ctx context.Context, params *protocol.SignatureHelpParams) (*protocol.SignatureHelp, error) {
+	return onLatestDocument(s, "SignatureHelp", params.TextDocument.URI, func(doc *document) (*protocol.SignatureHelp, error) {
+		return s.signatureHelp(ctx, doc, params.Position), nil
+	})
+}
+
+// signatureHelp shows the signature of the innermost call around the position, with the parameter of the argument
+// the position is in: its index, or its name for named arguments.
+func (s *Server) signatureHelp(ctx context.Context, doc *document, pos protocol.Position) *protocol.SignatureHelp {
+	text := doc.item.Text
+	call, ok := findSignatureCall(text[:locationOffset(text, position.ProtocolToAST(pos))])
+	if !ok {
+		return nil
+	}
+
+	var signature protocol.SignatureInformation
+	var parameters []string
+	var function stdlib.Function
+	isStd := false
+	if name, ok := strings.CutPrefix(call.callee, "std."); ok {
+		if function, isStd = s.stdFunction(name); !isStd {
+			return nil
+		}
+	} else {
+		// A local or a field that is an alias of a std function has its signature
+		function, isStd = s.calledStdAlias(ctx, doc, call)
+	}
+	if isStd {
+		signature = protocol.SignatureInformation{Label: function.Signature(), Documentation: function.MarkdownDescription}
+		parameters = function.Params
+	} else {
+		if doc.ast == nil {
+			return nil
+		}
+		function, label, documentation := s.findCalledFunction(ctx, doc, call)
+		if function == nil {
+			return nil
+		}
+		for _, param := range function.Parameters {
+			parameters = append(parameters, string(param.Name))
+		}
+		signature = protocol.SignatureInformation{
+			Label:         label + "(" + strings.Join(parameters, ", ") + ")",
+			Documentation: documentation,
+		}
+	}
+
+	for _, param := range parameters {
+		signature.Parameters = append(signature.Parameters, protocol.ParameterInformation{Label: param})
+	}
+	active := call.argument
+	if call.name != "" {
+		// A name that isn't a parameter's highlights none of them
+		active = len(parameters)
+		for i, param := range parameters {
+			if param == call.name {
+				active = i
+				break
+			}
+		}
+	}
+	return &protocol.SignatureHelp{
+		Signatures:      []protocol.SignatureInformation{signature},
+		ActiveParameter: uint32(active),
+	}
+}
+
+// findCalledFunction finds the function of a call, defined by a local or by a field, along with its name and its
+// documentation.
+func (s *Server) findCalledFunction(ctx context.Context, doc *document, call signatureCall) (*ast.Function, string, string) {
+	calleeLocation := offsetLocation(doc.item.Text, call.calleeOffset)
+	stack, err := processing.FindNodeByPosition(doc.ast, calleeLocation)
+	if err != nil {
+		log.WithContext(ctx).Debugf("SignatureHelp: error computing node: %v", err)
+		return nil, "", ""
+	}
+	documentation := func(filename string, line int) string {
+		if symbol, ok := s.symbolDoc(filename, line); ok {
+			return symbol.help
+		}
+		return ""
+	}
+
+	indexes := strings.Split(call.callee, ".")
+	if len(indexes) == 1 {
+		bind := processing.FindBindByIDViaStack(stack, ast.Identifier(call.callee))
+		if bind == nil {
+			return nil, "", ""
+		}
+		function := bind.Fun
+		if function == nil {
+			function, _ = bind.Body.(*ast.Function)
+		}
+		declaration := processing.LocalBindToRange(*bind)
+		return function, call.callee, documentation(declaration.Filename, declaration.FullRange.Begin.Line)
+	}
+
+	ranges, err := processing.FindRangesFromIndexList(stack, indexes, s.getCancellableVM(ctx, doc.item.URI.SpanURI().Filename()), false)
+	if err != nil {
+		log.WithContext(ctx).Debugf("SignatureHelp: error finding the function %s: %v", call.callee, err)
+		return nil, "", ""
+	}
+	for _, found := range ranges {
+		if function, ok := found.Node.(*ast.Function); ok {
+			return function, found.FieldName, documentation(found.Filename, found.FullRange.Begin.Line)
+		}
+	}
+	return nil, "", ""
+}
+
+// offsetLocation returns the location of a byte offset of the text.
+func offsetLocation(text string, offset int) ast.Location {
+	before := text[:offset]
+	return ast.Location{
+		Line:   strings.Count(before, "\n") + 1,
+		Column: offset - strings.LastIndex(before, "\n"),
+	}
+}
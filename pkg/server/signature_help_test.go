@@ -0,0 +1,188 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindSignatureCall(t *testing.T) {
+	testCases := []struct {
+		name     string
+		text     string
+		expected *signatureCall
+	}{
+		{
+			name:     "first argument",
+			text:     "f(",
+			expected: &signatureCall{callee: "f", calleeOffset: 0},
+		},
+		{
+			name:     "nested call",
+			text:     "f(g(x, ",
+			expected: &signatureCall{callee: "g", calleeOffset: 2, argument: 1},
+		},
+		{
+			name:     "after a nested call",
+			text:     "f(g(x, y), ",
+			expected: &signatureCall{callee: "f", calleeOffset: 0, argument: 1},
+		},
+		{
+			name:     "in an array argument",
+			text:     "f(1, [a, b, ",
+			expected: &signatureCall{callee: "f", calleeOffset: 0, argument: 1},
+		},
+		{
+			name:     "index chain",
+			text:     "local x = lib.util .fn(1, ",
+			expected: &signatureCall{callee: "lib.util.fn", calleeOffset: 20, argument: 1},
+		},
+		{
+			name:     "named argument",
+			text:     "f(1, name = ",
+			expected: &signatureCall{callee: "f", calleeOffset: 0, argument: 1, name: "name"},
+		},
+		{
+			name:     "comparison isn't a named argument",
+			text:     "f(a == ",
+			expected: &signatureCall{callee: "f", calleeOffset: 0},
+		},
+		{
+			name:     "commas and parentheses of strings and comments",
+			text:     "f('a, (b', \"c)\", /* d, ( */ // e, (\n",
+			expected: &signatureCall{callee: "f", calleeOffset: 0, argument: 2},
+		},
+		{
+			name:     "text block",
+			text:     "f(|||\n  a, (b\n|||, ",
+			expected: &signatureCall{callee: "f", calleeOffset: 0, argument: 1},
+		},
+		{
+			name:     "grouping parentheses",
+			text:     "f(1, (2 * ",
+			expected: &signatureCall{callee: "f", calleeOffset: 0, argument: 1},
+		},
+		{
+			name:     "after a keyword",
+			text:     "if f(",
+			expected: &signatureCall{callee: "f", calleeOffset: 3},
+		},
+		{
+			name: "parameters of a function",
+			text: "function(a, ",
+		},
+		{
+			name: "parameters of a local function",
+			text: "local f(a, ",
+		},
+		{
+			name: "closed call",
+			text: "f(a, b) ",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			call, ok := findSignatureCall(tc.text)
+			if tc.expected == nil {
+				assert.False(t, ok, "found %+v", call)
+				return
+			}
+			require.True(t, ok)
+			assert.Equal(t, *tc.expected, call)
+		})
+	}
+}
+
+func TestSignatureHelp(t *testing.T) {
+	testCases := []struct {
+		name     string
+		content  string
+		expected *protocol.SignatureHelp
+	}{
+		{
+			name:    "nested local functions",
+			content: "local f(a, b) = a;\nlocal g(x, y) = x;\nf(g(1, CURSOR), 2)",
+			expected: &protocol.SignatureHelp{
+				Signatures: []protocol.SignatureInformation{{
+					Label:      "g(x, y)",
+					Parameters: []protocol.ParameterInformation{{Label: "x"}, {Label: "y"}},
+				}},
+				ActiveParameter: 1,
+			},
+		},
+		{
+			name:    "outer call after the nested one",
+			content: "local f(a, b) = a;\nlocal g(x, y) = x;\nf(g(1, 2), CURSOR)",
+			expected: &protocol.SignatureHelp{
+				Signatures: []protocol.SignatureInformation{{
+					Label:      "f(a, b)",
+					Parameters: []protocol.ParameterInformation{{Label: "a"}, {Label: "b"}},
+				}},
+				ActiveParameter: 1,
+			},
+		},
+		{
+			name:    "named argument",
+			content: "local f(a, b, c) = a;\nf(1, c=CURSOR0)",
+			expected: &protocol.SignatureHelp{
+				Signatures: []protocol.SignatureInformation{{
+					Label:      "f(a, b, c)",
+					Parameters: []protocol.ParameterInformation{{Label: "a"}, {Label: "b"}, {Label: "c"}},
+				}},
+				ActiveParameter: 2,
+			},
+		},
+		{
+			name:    "field function, documented",
+			content: "local lib = {\n  // new creates a thing.\n  new(name, replicas=1):: {},\n};\nlib.new('a', CURSOR)",
+			expected: &protocol.SignatureHelp{
+				Signatures: []protocol.SignatureInformation{{
+					Label:         "new(name, replicas)",
+					Documentation: "new creates a thing.",
+					Parameters:    []protocol.ParameterInformation{{Label: "name"}, {Label: "replicas"}},
+				}},
+				ActiveParameter: 1,
+			},
+		},
+		{
+			name:    "standard library in a local function call",
+			content: "local f(a) = a;\nf(std.max(1, CURSOR))",
+			expected: &protocol.SignatureHelp{
+				Signatures: []protocol.SignatureInformation{{
+					Label:         "std.max(a, b)",
+					Documentation: "max gets the max",
+					Parameters:    []protocol.ParameterInformation{{Label: "a"}, {Label: "b"}},
+				}},
+				ActiveParameter: 1,
+			},
+		},
+		{
+			name:    "not a function",
+			content: "local f = 1;\n[f, CURSOR]",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var position protocol.Position
+			for i, line := range strings.Split(tc.content, "\n") {
+				if index := strings.Index(line, "CURSOR"); index != -1 {
+					position = protocol.Position{Line: uint32(i), Character: uint32(index)}
+				}
+			}
+			server, fileURI := testServerWithFile(t, completionTestStdlib, strings.ReplaceAll(tc.content, "CURSOR", ""))
+
+			result, err := server.SignatureHelp(context.Background(), &protocol.SignatureHelpParams{
+				TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+					TextDocument: protocol.TextDocumentIdentifier{URI: fileURI},
+					Position:     position,
+				},
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, result)
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// DidDeleteFiles clears the diagnostics of the deleted files, and of the files of the deleted directories.
+func (s *Server) DidDeleteFiles(context.Context, *protocol.DeleteFilesParams) error {
+	s.clearStaleDiagnostics()
+	return nil
+}
+
+// DidChangeWatchedFiles clears the diagnostics of the files that were deleted, for example by switching branches,
+// outside of the client.
+func (s *Server) DidChangeWatchedFiles(_ context.Context, params *protocol.DidChangeWatchedFilesParams) error {
+	for _, change := range params.Changes {
+		if change.Type == protocol.Deleted {
+			s.clearStaleDiagnostics()
+			break
+		}
+	}
+	return nil
+}
+
+// clearStaleDiagnostics clears the diagnostics that were published for files that don't exist anymore. The clients
+// keep showing them otherwise.
+func (s *Server) clearStaleDiagnostics() {
+	if cleared := s.diagPublisher.clearStale(fileMissing); len(cleared) > 0 {
+		log.Infof("Cleared the diagnostics of %d files that don't exist anymore", len(cleared))
+	}
+}
+
+// fileMissing tells whether the file of a document doesn't exist on disk. The documents that aren't files, like the
+// unsaved ones, are never missing.
+func fileMissing(uri protocol.DocumentURI) bool {
+	if !uri.SpanURI().IsFile() {
+		return false
+	}
+	_, err := os.Stat(uri.SpanURI().Filename())
+	return errors.Is(err, fs.ErrNotExist)
+}
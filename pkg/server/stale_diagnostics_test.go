@@ -0,0 +1,87 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClearStaleDiagnostics(t *testing.T) {
+	root := writeProjectFiles(t, map[string]string{
+		"deleted.jsonnet": "{}",
+		"kept.jsonnet":    "{}",
+	})
+	deleted := protocol.URIFromPath(filepath.Join(root, "deleted.jsonnet"))
+	kept := protocol.URIFromPath(filepath.Join(root, "kept.jsonnet"))
+	unsaved := protocol.DocumentURI("untitled:Untitled-1")
+	diag := protocol.Diagnostic{Source: "lint", Message: "lint"}
+
+	client := &recordingClient{}
+	s := NewServer("any", "test version", client, Configuration{})
+	s.diagPublisher = newDiagnosticsPublisher(client, 10*time.Millisecond, func(protocol.DocumentURI) (int32, bool) { return 0, false })
+	for _, uri := range []protocol.DocumentURI{deleted, kept, unsaved} {
+		s.diagPublisher.publish(uri, 0, []protocol.Diagnostic{diag})
+	}
+	require.Eventually(t, func() bool { return len(client.getPublished()) == 3 }, time.Second, 10*time.Millisecond)
+	require.NoError(t, os.Remove(filepath.Join(root, "deleted.jsonnet")))
+
+	// The diagnostics are only cleared when files are deleted
+	require.NoError(t, s.DidChangeWatchedFiles(context.Background(), &protocol.DidChangeWatchedFilesParams{
+		Changes: []protocol.FileEvent{{URI: kept, Type: protocol.Changed}},
+	}))
+	assert.Len(t, client.getPublished(), 3)
+
+	require.NoError(t, s.DidChangeWatchedFiles(context.Background(), &protocol.DidChangeWatchedFilesParams{
+		Changes: []protocol.FileEvent{{URI: deleted, Type: protocol.Deleted}},
+	}))
+	published := client.getPublished()
+	require.Len(t, published, 4)
+	assert.Equal(t, protocol.PublishDiagnosticsParams{URI: deleted, Diagnostics: []protocol.Diagnostic{}}, published[3])
+
+	// The diagnostics that were cleared aren't cleared again
+	require.NoError(t, s.DidDeleteFiles(context.Background(), &protocol.DeleteFilesParams{
+		Files: []protocol.FileDelete{{URI: string(deleted)}},
+	}))
+	assert.Len(t, client.getPublished(), 4)
+}
+
+func TestClearStaleDiagnostics_Pending(t *testing.T) {
+	client := &recordingClient{}
+	p := newDiagnosticsPublisher(client, 10*time.Millisecond, func(protocol.DocumentURI) (int32, bool) { return 0, false })
+	missing := protocol.DocumentURI("file:///missing.jsonnet")
+	p.publish(missing, 0, []protocol.Diagnostic{{Message: "queued"}})
+
+	// The diagnostics queued for a deleted file are never published
+	assert.Empty(t, p.clearStale(fileMissing))
+	assert.Never(t, func() bool { return len(client.getPublished()) > 0 }, 100*time.Millisecond, 10*time.Millisecond)
+}
+
+func TestRestartAnalysis_DeletedFile(t *testing.T) {
+	root := writeProjectFiles(t, map[string]string{"deleted.jsonnet": "{}"})
+	path := filepath.Join(root, "deleted.jsonnet")
+
+	client := &recordingClient{}
+	s := NewServer("any", "test version", client, Configuration{})
+	s.diagPublisher = newDiagnosticsPublisher(client, 10*time.Millisecond, s.documentVersion)
+	uri := serverOpenTestFile(t, s, path)
+	before, err := s.cache.get(uri)
+	require.NoError(t, err)
+	s.diagPublisher.publish(uri, before.item.Version, []protocol.Diagnostic{{Message: "lint"}})
+	require.Eventually(t, func() bool { return len(client.getPublished()) == 1 }, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, os.Remove(path))
+	s.restartAnalysis()
+	after, err := s.cache.get(uri)
+	require.NoError(t, err)
+	assert.Same(t, before, after)
+	assert.Equal(t, []protocol.PublishDiagnosticsParams{
+		{URI: uri, Version: before.item.Version, Diagnostics: []protocol.Diagnostic{{Message: "lint"}}},
+		{URI: uri, Diagnostics: []protocol.Diagnostic{}},
+	}, client.getPublished())
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+const statusNotification = "jsonnet/status"
+
+type statusKind string
+
+const (
+	statusIdle       statusKind = "idle"
+	statusEvaluating statusKind = "evaluating"
+	statusError      statusKind = "error"
+)
+
+// statusParams are sent with the jsonnet/status notification, for clients to render in their status bar.
+type statusParams struct {
+	Kind    statusKind           `json:"kind"`
+	URI     protocol.DocumentURI `json:"uri,omitempty"`
+	Message string               `json:"message,omitempty"`
+}
+
+// Notifier sends notifications that are not part of the LSP specification. A jsonrpc2.Conn is a Notifier.
+type Notifier interface {
+	Notify(ctx context.Context, method string, params interface{}) error
+}
+
+// SetNotifier sets where the notifications that are not part of the LSP specification (such as jsonnet/status) are sent.
+func (s *Server) SetNotifier(notifier Notifier) {
+	s.notifier = notifier
+}
+
+// statusTracker keeps track of the evaluations in progress, to know when the server is idle,
+// and of how long the last evaluation of each file took.
+type statusTracker struct {
+	mu              sync.Mutex
+	evaluating      map[protocol.DocumentURI]int
+	lastEvaluations map[protocol.DocumentURI]evaluationStats
+}
+
+type evaluationStats struct {
+	URI        protocol.DocumentURI `json:"uri"`
+	FinishedAt time.Time            `json:"finishedAt"`
+	DurationMs int64                `json:"durationMs"`
+	Failed     bool                 `json:"failed"`
+}
+
+func newStatusTracker() *statusTracker {
+	return &statusTracker{
+		evaluating:      make(map[protocol.DocumentURI]int),
+		lastEvaluations: make(map[protocol.DocumentURI]evaluationStats),
+	}
+}
+
+// startEvaluationStatus reports that a file is being evaluated.
+// The returned function must be called with the result of the evaluation once it's done.
+func (s *Server) startEvaluationStatus(uri protocol.DocumentURI) func(err error) {
+	start := time.Now()
+
+	s.status.mu.Lock()
+	s.status.evaluating[uri]++
+	s.status.mu.Unlock()
+
+	s.sendStatus(statusParams{
+		Kind:    statusEvaluating,
+		URI:     uri,
+		Message: filepath.Base(uri.SpanURI().Filename()),
+	})
+
+	return func(err error) {
+		s.status.mu.Lock()
+		s.status.evaluating[uri]--
+		if s.status.evaluating[uri] <= 0 {
+			delete(s.status.evaluating, uri)
+		}
+		remaining := len(s.status.evaluating)
+		duration := time.Since(start)
+		s.status.lastEvaluations[uri] = evaluationStats{
+			URI:        uri,
+			FinishedAt: time.Now(),
+			DurationMs: duration.Milliseconds(),
+			Failed:     err != nil,
+		}
+		s.status.mu.Unlock()
+		s.metrics.observeEvaluation(duration, err)
+		s.recordEvaluationTelemetry(duration)
+
+		switch {
+		case err != nil:
+			s.sendStatus(statusParams{
+				Kind:    statusError,
+				URI:     uri,
+				Message: strings.SplitN(err.Error(), "\n", 2)[0],
+			})
+		case remaining == 0:
+			s.sendStatus(statusParams{Kind: statusIdle})
+		}
+	}
+}
+
+func (s *Server) sendStatus(params statusParams) {
+	if !s.config().EnableStatusNotifications || s.notifier == nil {
+		return
+	}
+	if err := s.notifier.Notify(context.Background(), statusNotification, params); err != nil {
+		log.Errorf("sendStatus: unable to send status notification: %v", err)
+	}
+}
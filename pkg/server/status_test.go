@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+)
+
+type notification struct {
+	method string
+	params interface{}
+}
+
+// recordingNotifier records the custom notifications sent to the client.
+type recordingNotifier struct {
+	mu            sync.Mutex
+	notifications []notification
+}
+
+func (n *recordingNotifier) Notify(_ context.Context, method string, params interface{}) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.notifications = append(n.notifications, notification{method, params})
+	return nil
+}
+
+func (n *recordingNotifier) getNotifications() []notification {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]notification(nil), n.notifications...)
+}
+
+func TestStatusNotifications(t *testing.T) {
+	first := protocol.URIFromPath("/test/first.jsonnet")
+	second := protocol.URIFromPath("/test/second.jsonnet")
+
+	testCases := []struct {
+		name     string
+		enabled  bool
+		run      func(s *Server)
+		expected []notification
+	}{
+		{
+			name: "disabled",
+			run: func(s *Server) {
+				s.startEvaluationStatus(first)(nil)
+			},
+		},
+		{
+			name:    "successful evaluation",
+			enabled: true,
+			run: func(s *Server) {
+				s.startEvaluationStatus(first)(nil)
+			},
+			expected: []notification{
+				{statusNotification, statusParams{Kind: statusEvaluating, URI: first, Message: "first.jsonnet"}},
+				{statusNotification, statusParams{Kind: statusIdle}},
+			},
+		},
+		{
+			name:    "failed evaluation",
+			enabled: true,
+			run: func(s *Server) {
+				s.startEvaluationStatus(first)(errors.New("RUNTIME ERROR: boom\n\tfirst.jsonnet:1:1-5"))
+			},
+			expected: []notification{
+				{statusNotification, statusParams{Kind: statusEvaluating, URI: first, Message: "first.jsonnet"}},
+				{statusNotification, statusParams{Kind: statusError, URI: first, Message: "RUNTIME ERROR: boom"}},
+			},
+		},
+		{
+			name:    "idle once all evaluations are done",
+			enabled: true,
+			run: func(s *Server) {
+				firstDone := s.startEvaluationStatus(first)
+				secondDone := s.startEvaluationStatus(second)
+				firstDone(nil)
+				secondDone(nil)
+			},
+			expected: []notification{
+				{statusNotification, statusParams{Kind: statusEvaluating, URI: first, Message: "first.jsonnet"}},
+				{statusNotification, statusParams{Kind: statusEvaluating, URI: second, Message: "second.jsonnet"}},
+				{statusNotification, statusParams{Kind: statusIdle}},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := testServer(t, nil)
+			setConfiguration(s, func(c *Configuration) {
+				c.EnableStatusNotifications = tc.enabled
+			})
+			notifier := &recordingNotifier{}
+			s.SetNotifier(notifier)
+
+			tc.run(s)
+
+			assert.Equal(t, tc.expected, notifier.getNotifications())
+		})
+	}
+}
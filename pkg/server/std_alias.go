@@ -0,0 +1,149 @@
+package server
+
+import (
+	"context"
+
+	"github.com/google/go-jsonnet/ast"
+	"github.com/grafana/jsonnet-language-server/pkg/ast/processing"
+	"github.com/grafana/jsonnet-language-server/pkg/nodestack"
+	"github.com/grafana/jsonnet-language-server/pkg/stdlib"
+)
+
+// stdFunction returns the std function with the name.
+func (s *Server) stdFunction(name string) (stdlib.Function, bool) {
+	for _, function := range s.stdlib {
+		if function.Name == name {
+			return function, true
+		}
+	}
+	return stdlib.Function{}, false
+}
+
+// stdAliasAt returns the std function that the variable or index at the top of the stack is an alias of, like `map`
+// after `local map = std.map;`.
+func (s *Server) stdAliasAt(ctx context.Context, doc *document, stack *nodestack.NodeStack, pos ast.Location) (stdlib.Function, bool) {
+	if doc.ast == nil || stack.IsEmpty() {
+		return stdlib.Function{}, false
+	}
+	switch stack.Peek().(type) {
+	case *ast.Var, *ast.Index:
+	default:
+		return stdlib.Function{}, false
+	}
+	node, scope := valueAtPosition(doc.ast, stack, pos)
+	if node == nil {
+		return stdlib.Function{}, false
+	}
+
+	filename := doc.item.URI.SpanURI().Filename()
+	checker := &typeChecker{server: s, vm: s.getCancellableVM(ctx, filename), filename: filename}
+	name := checker.stdAlias(node, scope, 0)
+	if name == "" {
+		return stdlib.Function{}, false
+	}
+	return s.stdFunction(name)
+}
+
+// stdAlias returns the name of the std function that a node refers to: `std.map`, or a local or a field whose value
+// is one, through the chains of locals, and of fields of objects and imports, like `local map = lib.map;`.
+func (c *typeChecker) stdAlias(node ast.Node, scope varScope, depth int) string {
+	for ; node != nil && depth <= maxInferenceDepth; depth++ {
+		switch n := node.(type) {
+		case *ast.Parens:
+			node = n.Inner
+		case *ast.Var:
+			node = scope[n.Id]
+		case *ast.Index:
+			name, ok := n.Index.(*ast.LiteralString)
+			if !ok {
+				return ""
+			}
+			if target, ok := n.Target.(*ast.Var); ok && (target.Id == "std" || target.Id == "$std") {
+				if _, shadowed := scope[target.Id]; !shadowed {
+					return name.Value
+				}
+			}
+			object, objectScope := c.aliasedObject(n.Target, scope, depth+1)
+			node, scope = objectField(object, objectScope, name.Value)
+		default:
+			return ""
+		}
+	}
+	return ""
+}
+
+// objectField returns the body of an object's field, with the variables in its scope. The fields that are merged with
+// the inherited ones aren't followed.
+func objectField(object *ast.DesugaredObject, scope varScope, name string) (ast.Node, varScope) {
+	if object == nil {
+		return nil, nil
+	}
+	var body ast.Node
+	var bodyScope varScope
+	for _, field := range object.Fields {
+		if fieldName, ok := field.Name.(*ast.LiteralString); ok && fieldName.Value == name && !field.PlusSuper {
+			binds := map[ast.Identifier]ast.Node{"self": object}
+			for _, bind := range object.Locals {
+				binds[bind.Variable] = bind.Body
+			}
+			body, bodyScope = field.Body, scope.with(binds)
+		}
+	}
+	return body, bodyScope
+}
+
+// aliasedObject returns the object literal that a node refers to, through locals, parentheses, imports and the fields
+// of objects, with the variables in its scope.
+func (c *typeChecker) aliasedObject(node ast.Node, scope varScope, depth int) (*ast.DesugaredObject, varScope) {
+	for ; node != nil && depth <= maxInferenceDepth; depth++ {
+		switch n := node.(type) {
+		case *ast.Parens:
+			node = n.Inner
+		case *ast.Var:
+			node = scope[n.Id]
+		case *ast.Self:
+			node = scope["self"]
+		case *ast.Local:
+			binds := map[ast.Identifier]ast.Node{}
+			for _, bind := range n.Binds {
+				binds[bind.Variable] = bind.Body
+			}
+			node, scope = n.Body, scope.with(binds)
+		case *ast.Import:
+			importedFrom := n.LocRange.FileName
+			if importedFrom == "" {
+				importedFrom = c.filename
+			}
+			root, _, err := c.vm.ImportAST(importedFrom, n.File.Value)
+			if err != nil {
+				return nil, nil
+			}
+			node, scope = root, varScope{}
+		case *ast.Index:
+			name, ok := n.Index.(*ast.LiteralString)
+			if !ok {
+				return nil, nil
+			}
+			object, objectScope := c.aliasedObject(n.Target, scope, depth+1)
+			node, scope = objectField(object, objectScope, name.Value)
+		case *ast.DesugaredObject:
+			return n, scope
+		default:
+			return nil, nil
+		}
+	}
+	return nil, nil
+}
+
+// calledStdAlias returns the std function that the callee of a call is an alias of.
+func (s *Server) calledStdAlias(ctx context.Context, doc *document, call signatureCall) (stdlib.Function, bool) {
+	if doc.ast == nil {
+		return stdlib.Function{}, false
+	}
+	calleeLocation := offsetLocation(doc.item.Text, call.calleeOffset)
+	stack, err := processing.FindNodeByPosition(doc.ast, calleeLocation)
+	if err != nil {
+		return stdlib.Function{}, false
+	}
+	return s.stdAliasAt(ctx, doc, stack, calleeLocation)
+}
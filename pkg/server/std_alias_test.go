@@ -0,0 +1,108 @@
+package server
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStdAliases(t *testing.T) {
+	maxSignature := &protocol.SignatureHelp{
+		Signatures: []protocol.SignatureInformation{{
+			Label:         "std.max(a, b)",
+			Documentation: "max gets the max",
+			Parameters:    []protocol.ParameterInformation{{Label: "a"}, {Label: "b"}},
+		}},
+		ActiveParameter: 1,
+	}
+	testCases := []struct {
+		name              string
+		content           string
+		expectedHover     string
+		expectedSignature *protocol.SignatureHelp
+	}{
+		{
+			name:              "local alias",
+			content:           "local max = std.max;\nmax(1, CURSOR)",
+			expectedHover:     "`std.max(a, b)`\n\nmax gets the max",
+			expectedSignature: maxSignature,
+		},
+		{
+			name:              "chain of locals",
+			content:           "local m = std.max;\nlocal max = (m);\nmax(1, CURSOR)",
+			expectedHover:     "`std.max(a, b)`\n\nmax gets the max",
+			expectedSignature: maxSignature,
+		},
+		{
+			name:              "field of an object",
+			content:           "local lib = { max: std.max };\nlib.max(1, CURSOR)",
+			expectedHover:     "`std.max(a, b)`\n\nmax gets the max",
+			expectedSignature: maxSignature,
+		},
+		{
+			name:          "field of an import",
+			content:       "local lib = import 'lib.libsonnet';\nlocal min = lib.min;\nmin(1, CURSOR)",
+			expectedHover: "`std.min(a, b)`\n\nmin gets the min",
+			expectedSignature: &protocol.SignatureHelp{
+				Signatures: []protocol.SignatureInformation{{
+					Label:         "std.min(a, b)",
+					Documentation: "min gets the min",
+					Parameters:    []protocol.ParameterInformation{{Label: "a"}, {Label: "b"}},
+				}},
+				ActiveParameter: 1,
+			},
+		},
+		{
+			name:    "shadowed std",
+			content: "local std = { max(a): a };\nlocal max = std.max;\nmax(1, CURSOR)",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var pos protocol.Position
+			for i, line := range strings.Split(tc.content, "\n") {
+				if index := strings.Index(line, "CURSOR"); index != -1 {
+					pos = protocol.Position{Line: uint32(i), Character: uint32(index)}
+				}
+			}
+			root := writeProjectFiles(t, map[string]string{
+				"main.jsonnet":  strings.ReplaceAll(tc.content, "CURSOR", ""),
+				"lib.libsonnet": "local min = std.min;\n{ min:: min }",
+			})
+			s := testServer(t, completionTestStdlib)
+			uri := serverOpenTestFile(t, s, filepath.Join(root, "main.jsonnet"))
+
+			signature, err := s.SignatureHelp(context.Background(), &protocol.SignatureHelpParams{
+				TextDocumentPositionParams: protocol.TextDocumentPositionParams{TextDocument: protocol.TextDocumentIdentifier{URI: uri}, Position: pos},
+			})
+			require.NoError(t, err)
+			if tc.expectedSignature != nil {
+				assert.Equal(t, tc.expectedSignature, signature)
+			} else if signature != nil {
+				assert.False(t, strings.HasPrefix(signature.Signatures[0].Label, "std."), signature.Signatures[0].Label)
+			}
+
+			// Hover on the callee, whose name ends before `(1, `
+			hover, err := s.Hover(context.Background(), &protocol.HoverParams{
+				TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+					TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+					Position:     protocol.Position{Line: pos.Line, Character: pos.Character - 5},
+				},
+			})
+			require.NoError(t, err)
+			if tc.expectedHover == "" {
+				if hover != nil {
+					assert.False(t, strings.HasPrefix(hover.Contents.Value, "`std."), hover.Contents.Value)
+				}
+				return
+			}
+			require.NotNil(t, hover)
+			assert.Equal(t, tc.expectedHover, hover.Contents.Value)
+		})
+	}
+}
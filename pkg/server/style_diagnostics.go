@@ -0,0 +1,126 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/google/go-jsonnet/ast"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+)
+
+const (
+	trailingNewlineDiagnosticCode = "trailing-newline"
+	trailingCommaDiagnosticCode   = "trailing-comma"
+)
+
+// findStyleProblems reports what the TrailingNewline and TrailingCommas formatting options enforce and the document
+// doesn't follow: a missing newline at the end of the document, and missing commas after the last element of
+// multi-line objects and arrays.
+func (s *Server) findStyleProblems(doc *document) []protocol.Diagnostic {
+	passes := s.configurationFor(doc.item.URI.SpanURI().Filename()).FormattingPasses
+	var diags []protocol.Diagnostic
+
+	lines := strings.Split(doc.item.Text, "\n")
+	if passes.TrailingNewline && doc.item.Text != "" && !strings.HasSuffix(doc.item.Text, "\n") {
+		end := protocol.Position{Line: uint32(len(lines) - 1), Character: uint32(len(lines[len(lines)-1]))}
+		diags = append(diags, protocol.Diagnostic{
+			Range:    protocol.Range{Start: end, End: end},
+			Severity: protocol.SeverityWarning,
+			Code:     trailingNewlineDiagnosticCode,
+			Source:   "lint",
+			Message:  "missing newline at the end of the file",
+		})
+	}
+
+	// The AST is out of date if the document doesn't parse, the positions would be wrong
+	if !passes.TrailingCommas || doc.ast == nil || len(doc.linesChangedSinceAST) > 0 {
+		return diags
+	}
+	scanned := scanLines(doc.item.Text)
+	walk(doc.ast, func(node ast.Node) {
+		var kind string
+		switch node := node.(type) {
+		case *ast.Array:
+			if len(node.Elements) == 0 {
+				return
+			}
+			kind = "array"
+		case *ast.DesugaredObject:
+			if len(node.Fields) == 0 && len(node.Asserts) == 0 && len(node.Locals) == 0 {
+				return
+			}
+			kind = "object"
+		default:
+			return
+		}
+		loc := node.Loc()
+		if loc.FileName != doc.item.URI.SpanURI().Filename() || loc.Begin.Line == loc.End.Line || loc.End.Line > len(scanned) {
+			return
+		}
+		if end, ok := missingTrailingComma(scanned, loc.End.Line-1, loc.End.Column-2); ok {
+			diags = append(diags, protocol.Diagnostic{
+				Range:    protocol.Range{Start: end, End: end},
+				Severity: protocol.SeverityWarning,
+				Code:     trailingCommaDiagnosticCode,
+				Source:   "lint",
+				Message:  "missing trailing comma after the last element of the multi-line " + kind,
+			})
+		}
+	})
+	return diags
+}
+
+// missingTrailingComma looks back from the closing bracket of a multi-line object or array, at the given line and
+// byte column, for the end of its last element. It returns the position after the last element if it isn't
+// followed by a comma.
+func missingTrailingComma(lines []scannedLine, line, column int) (protocol.Position, bool) {
+	for i := line; i >= 0; i-- {
+		code := lines[i].text
+		if i == line {
+			if column < 0 || column > len(code) {
+				return protocol.Position{}, false
+			}
+			code = code[:column]
+		} else if lines[i].comment >= 0 {
+			code = code[:lines[i].comment]
+		}
+		code = strings.TrimRight(code, " \t")
+		switch {
+		case code == "":
+			continue
+		case strings.HasSuffix(code, ","), strings.HasSuffix(code, "{"), strings.HasSuffix(code, "["):
+			return protocol.Position{}, false
+		case strings.HasSuffix(code, "*/"):
+			// Block comments aren't looked into
+			return protocol.Position{}, false
+		}
+		return protocol.Position{Line: uint32(i), Character: uint32(len(code))}, true
+	}
+	return protocol.Position{}, false
+}
+
+// styleCodeActions returns the quickfixes that insert the missing trailing newlines and commas.
+func (s *Server) styleCodeActions(doc *document, diags []protocol.Diagnostic) []protocol.CodeAction {
+	var actions []protocol.CodeAction
+	for _, diag := range diags {
+		var title, text string
+		switch diag.Code {
+		case trailingNewlineDiagnosticCode:
+			title, text = "Add a newline at the end of the file", "\n"
+		case trailingCommaDiagnosticCode:
+			title, text = "Add a trailing comma", ","
+		default:
+			continue
+		}
+		actions = append(actions, protocol.CodeAction{
+			Title:       title,
+			Kind:        protocol.QuickFix,
+			Diagnostics: []protocol.Diagnostic{diag},
+			Edit: protocol.WorkspaceEdit{
+				Changes: map[string][]protocol.TextEdit{
+					string(doc.item.URI): {{Range: protocol.Range{Start: diag.Range.Start, End: diag.Range.Start}, NewText: text}},
+				},
+			},
+		})
+	}
+	return actions
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStyleDiagnostics(t *testing.T) {
+	testCases := []struct {
+		name       string
+		formatting map[string]interface{}
+		content    string
+		expected   []string
+		fixed      string
+	}{
+		{
+			name:       "disabled",
+			formatting: map[string]interface{}{},
+			content:    "{\n  a: [\n    1\n  ]\n}",
+		},
+		{
+			name:       "trailing newline",
+			formatting: map[string]interface{}{"TrailingNewline": true},
+			content:    "{\n  a: 1\n}",
+			expected:   []string{"2:1-2:1 trailing-newline: missing newline at the end of the file"},
+			fixed:      "{\n  a: 1\n}\n",
+		},
+		{
+			name:       "trailing commas",
+			formatting: map[string]interface{}{"trailing_commas": true},
+			content: `{
+  a: [
+    1,
+    2  // two
+  ],
+  b: { c: 1 },
+  d: [1, 2],
+  e: {
+    f: |||
+      text
+    |||
+  },
+  g: [
+  ],
+  h: [x for x in [1, 2]],
+  i: {
+    j: 1,
+    /* end */
+  },
+  k: ['a', 'b'
+  ]
+}
+`,
+			expected: []string{
+				"20:3-20:3 trailing-comma: missing trailing comma after the last element of the multi-line object",
+				"3:5-3:5 trailing-comma: missing trailing comma after the last element of the multi-line array",
+				"10:7-10:7 trailing-comma: missing trailing comma after the last element of the multi-line object",
+				"19:14-19:14 trailing-comma: missing trailing comma after the last element of the multi-line array",
+			},
+			fixed: `{
+  a: [
+    1,
+    2,  // two
+  ],
+  b: { c: 1 },
+  d: [1, 2],
+  e: {
+    f: |||
+      text
+    |||,
+  },
+  g: [
+  ],
+  h: [x for x in [1, 2]],
+  i: {
+    j: 1,
+    /* end */
+  },
+  k: ['a', 'b',
+  ],
+}
+`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s, uri := testServerWithFile(t, nil, tc.content)
+			require.NoError(t, s.DidChangeConfiguration(context.TODO(), &protocol.DidChangeConfigurationParams{
+				Settings: map[string]interface{}{"formatting": tc.formatting},
+			}))
+			doc, err := s.cache.get(uri)
+			require.NoError(t, err)
+
+			diags := s.findStyleProblems(doc)
+			var found []string
+			for _, diag := range diags {
+				found = append(found, fmt.Sprintf("%d:%d-%d:%d %s: %s", diag.Range.Start.Line, diag.Range.Start.Character, diag.Range.End.Line, diag.Range.End.Character, diag.Code, diag.Message))
+			}
+			assert.Equal(t, tc.expected, found)
+			if len(diags) == 0 {
+				return
+			}
+
+			actions, err := s.CodeAction(context.TODO(), &protocol.CodeActionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+				Context:      protocol.CodeActionContext{Diagnostics: diags, Only: []protocol.CodeActionKind{protocol.QuickFix}},
+			})
+			require.NoError(t, err)
+			var edits []protocol.TextEdit
+			for _, action := range actions {
+				if !strings.HasPrefix(action.Title, "Suppress") {
+					edits = append(edits, action.Edit.Changes[string(uri)]...)
+				}
+			}
+			assert.Equal(t, tc.fixed, applyTextEdits(t, tc.content, edits))
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-jsonnet/formatter"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+)
+
+const (
+	suppressionDirective         = "jsonnet-ls:ignore"
+	suppressionNextLineDirective = "jsonnet-ls:ignore-next-line"
+)
+
+var (
+	// suppressionRegexp matches suppression comments. Examples:
+	// 1. // jsonnet-ls:ignore
+	// 2. # jsonnet-ls:ignore[lint]
+	// 3. /* jsonnet-ls:ignore-next-line[lint, jsonnet-evaluation] */
+	suppressionRegexp = regexp.MustCompile(`(?://|#|/\*)\s*jsonnet-ls:(?P<directive>ignore-next-line|ignore)(?:\[(?P<rules>[^\]]*)\])?`)
+)
+
+// suppressions maps a zero-indexed line to the rules that are suppressed on it.
+// A nil rule list suppresses every rule on the line.
+type suppressions map[int][]string
+
+// findSuppressions scans the text for suppression comments.
+// `jsonnet-ls:ignore` applies to the line it is on, `jsonnet-ls:ignore-next-line` to the one after it.
+func findSuppressions(text string) suppressions {
+	result := suppressions{}
+	for i, line := range strings.Split(text, "\n") {
+		for _, match := range suppressionRegexp.FindAllStringSubmatch(line, -1) {
+			target := i
+			if match[suppressionRegexp.SubexpIndex("directive")] == "ignore-next-line" {
+				target = i + 1
+			}
+
+			if _, ok := result[target]; ok && result[target] == nil {
+				// The whole line is already suppressed
+				continue
+			}
+
+			rulesStr := strings.TrimSpace(match[suppressionRegexp.SubexpIndex("rules")])
+			if rulesStr == "" {
+				result[target] = nil
+				continue
+			}
+			for _, rule := range strings.Split(rulesStr, ",") {
+				if rule = strings.TrimSpace(rule); rule != "" {
+					result[target] = append(result[target], rule)
+				}
+			}
+		}
+	}
+	return result
+}
+
+// suppressed returns true if the diagnostic is silenced by a suppression comment.
+func (s suppressions) suppressed(diag protocol.Diagnostic) bool {
+	rules, ok := s[int(diag.Range.Start.Line)]
+	if !ok {
+		return false
+	}
+	if rules == nil {
+		return true
+	}
+
+	diagRule := diagnosticRule(diag)
+	for _, rule := range rules {
+		if strings.EqualFold(rule, diagRule) {
+			return true
+		}
+	}
+	return false
+}
+
+// diagnosticRule returns the name used to refer to a diagnostic in suppression comments.
+// It is the diagnostic's code if it has one, otherwise its source (with spaces replaced by dashes).
+func diagnosticRule(diag protocol.Diagnostic) string {
+	if code, ok := diag.Code.(string); ok && code != "" {
+		return code
+	}
+	return strings.ReplaceAll(diag.Source, " ", "-")
+}
+
+// filterSuppressedDiagnostics removes the diagnostics that are silenced by suppression comments in the text.
+func filterSuppressedDiagnostics(text string, diags []protocol.Diagnostic) []protocol.Diagnostic {
+	if !strings.Contains(text, suppressionDirective) {
+		return diags
+	}
+
+	supp := findSuppressions(text)
+	filtered := make([]protocol.Diagnostic, 0, len(diags))
+	for _, diag := range diags {
+		if !supp.suppressed(diag) {
+			filtered = append(filtered, diag)
+		}
+	}
+	return filtered
+}
+
+// suppressionCodeActions returns a quickfix per diagnostic that inserts a `jsonnet-ls:ignore-next-line` comment above it.
+func (s *Server) suppressionCodeActions(doc *document, diags []protocol.Diagnostic) []protocol.CodeAction {
+	var actions []protocol.CodeAction
+
+	lines := strings.Split(doc.item.Text, "\n")
+	commentPrefix := "//"
+	if s.configurationFor(doc.item.URI.SpanURI().Filename()).FormattingOptions.CommentStyle == formatter.CommentStyleHash {
+		commentPrefix = "#"
+	}
+
+	for _, diag := range diags {
+		rule := diagnosticRule(diag)
+		if rule == "" {
+			continue
+		}
+
+		line := int(diag.Range.Start.Line)
+		if line >= len(lines) {
+			continue
+		}
+		indent := lines[line][:len(lines[line])-len(strings.TrimLeft(lines[line], " \t"))]
+
+		actions = append(actions, protocol.CodeAction{
+			Title:       fmt.Sprintf("Suppress %s on this line", rule),
+			Kind:        protocol.QuickFix,
+			Diagnostics: []protocol.Diagnostic{diag},
+			Edit: protocol.WorkspaceEdit{
+				Changes: map[string][]protocol.TextEdit{
+					string(doc.item.URI): {
+						{
+							Range: protocol.Range{
+								Start: protocol.Position{Line: uint32(line)},
+								End:   protocol.Position{Line: uint32(line)},
+							},
+							NewText: fmt.Sprintf("%s%s %s[%s]\n", indent, commentPrefix, suppressionNextLineDirective, rule),
+						},
+					},
+				},
+			},
+		})
+	}
+
+	return actions
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilterSuppressedDiagnostics(t *testing.T) {
+	lintDiag := func(line uint32) protocol.Diagnostic {
+		return protocol.Diagnostic{
+			Range:    protocol.Range{Start: protocol.Position{Line: line}, End: protocol.Position{Line: line}},
+			Source:   "lint",
+			Severity: protocol.SeverityWarning,
+			Message:  "Unused variable: unused",
+		}
+	}
+	evalDiag := func(line uint32) protocol.Diagnostic {
+		return protocol.Diagnostic{
+			Range:    protocol.Range{Start: protocol.Position{Line: line}, End: protocol.Position{Line: line}},
+			Source:   "jsonnet evaluation",
+			Severity: protocol.SeverityError,
+			Message:  "error",
+		}
+	}
+
+	testCases := []struct {
+		name        string
+		fileContent string
+		diags       []protocol.Diagnostic
+		expected    []protocol.Diagnostic
+	}{
+		{
+			name:        "no suppression",
+			fileContent: "local unused = 'test';\n{}",
+			diags:       []protocol.Diagnostic{lintDiag(0)},
+			expected:    []protocol.Diagnostic{lintDiag(0)},
+		},
+		{
+			name:        "same line, matching rule",
+			fileContent: "local unused = 'test';  // jsonnet-ls:ignore[lint]\n{}",
+			diags:       []protocol.Diagnostic{lintDiag(0)},
+			expected:    []protocol.Diagnostic{},
+		},
+		{
+			name:        "same line, other rule",
+			fileContent: "local unused = 'test';  // jsonnet-ls:ignore[jsonnet-evaluation]\n{}",
+			diags:       []protocol.Diagnostic{lintDiag(0), evalDiag(0)},
+			expected:    []protocol.Diagnostic{lintDiag(0)},
+		},
+		{
+			name:        "same line, all rules",
+			fileContent: "local unused = 'test';  # jsonnet-ls:ignore\n{}",
+			diags:       []protocol.Diagnostic{lintDiag(0), evalDiag(0)},
+			expected:    []protocol.Diagnostic{},
+		},
+		{
+			name:        "next line, multiple rules",
+			fileContent: "/* jsonnet-ls:ignore-next-line[LINT, jsonnet-evaluation] */\nlocal unused = 'test';\n{}",
+			diags:       []protocol.Diagnostic{lintDiag(1), evalDiag(1), lintDiag(2)},
+			expected:    []protocol.Diagnostic{lintDiag(2)},
+		},
+		{
+			name:        "next line does not apply to the comment line",
+			fileContent: "local unused = 'test'; // jsonnet-ls:ignore-next-line[lint]\n{}",
+			diags:       []protocol.Diagnostic{lintDiag(0)},
+			expected:    []protocol.Diagnostic{lintDiag(0)},
+		},
+		{
+			name:        "diagnostic code takes precedence over source",
+			fileContent: "local unused = 'test'; // jsonnet-ls:ignore[unused-variable]\n{}",
+			diags: []protocol.Diagnostic{func() protocol.Diagnostic {
+				d := lintDiag(0)
+				d.Code = "unused-variable"
+				return d
+			}()},
+			expected: []protocol.Diagnostic{},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, filterSuppressedDiagnostics(tc.fileContent, tc.diags))
+		})
+	}
+}
+
+func TestSuppressionCodeAction(t *testing.T) {
+	s, fileURI := testServerWithFile(t, nil, "{\n  local unused = 'test',\n  a: 1,\n}\n")
+
+	diag := protocol.Diagnostic{
+		Range: protocol.Range{
+			Start: protocol.Position{Line: 1, Character: 8},
+			End:   protocol.Position{Line: 1, Character: 23},
+		},
+		Severity: protocol.SeverityWarning,
+		Source:   "lint",
+		Message:  "Unused variable: unused",
+	}
+
+	actions, err := s.CodeAction(context.Background(), &protocol.CodeActionParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: fileURI},
+		Range:        diag.Range,
+		Context:      protocol.CodeActionContext{Diagnostics: []protocol.Diagnostic{diag}},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []protocol.CodeAction{
+		{
+			Title:       "Suppress lint on this line",
+			Kind:        protocol.QuickFix,
+			Diagnostics: []protocol.Diagnostic{diag},
+			Edit: protocol.WorkspaceEdit{
+				Changes: map[string][]protocol.TextEdit{
+					string(fileURI): {
+						{
+							Range: protocol.Range{
+								Start: protocol.Position{Line: 1},
+								End:   protocol.Position{Line: 1},
+							},
+							NewText: "  // jsonnet-ls:ignore-next-line[lint]\n",
+						},
+					},
+				},
+			},
+		},
+	}, actions)
+
+	// Filtering on another kind returns nothing
+	actions, err = s.CodeAction(context.Background(), &protocol.CodeActionParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: fileURI},
+		Range:        diag.Range,
+		Context: protocol.CodeActionContext{
+			Diagnostics: []protocol.Diagnostic{diag},
+			Only:        []protocol.CodeActionKind{protocol.Refactor},
+		},
+	})
+	require.NoError(t, err)
+	assert.Empty(t, actions)
+}
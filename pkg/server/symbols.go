@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"reflect"
 	"strings"
+	"sync"
 
 	"github.com/google/go-jsonnet/ast"
 	"github.com/grafana/jsonnet-language-server/pkg/ast/processing"
@@ -14,20 +15,24 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-func (s *Server) DocumentSymbol(_ context.Context, params *protocol.DocumentSymbolParams) ([]interface{}, error) {
+func (s *Server) DocumentSymbol(ctx context.Context, params *protocol.DocumentSymbolParams) ([]interface{}, error) {
 	doc, err := s.cache.get(params.TextDocument.URI)
 	if err != nil {
 		return nil, utils.LogErrorf("DocumentSymbol: %s: %w", errorRetrievingDocument, err)
 	}
 
-	if doc.err != nil {
+	if doc.ast == nil {
 		// Returning an error too often can lead to the client killing the language server
 		// Logging the errors is sufficient
-		log.Errorf("DocumentSymbol: %s", errorParsingDocument)
+		log.WithContext(ctx).Errorf("DocumentSymbol: %s", errorParsingDocument)
 		return nil, nil
 	}
 
-	symbols := buildDocumentSymbols(doc.ast)
+	symbols := s.symbolCache.documentSymbols(doc.item.URI, doc.astText, doc.ast)
+	if doc.stale() {
+		// The symbols of the last version that parsed are moved to the current lines, the edited ones are left out
+		symbols = staleDocumentSymbols(symbols, newLineMap(doc.astText, doc.item.Text), doc.astVersion)
+	}
 
 	result := make([]interface{}, len(symbols))
 	for i, symbol := range symbols {
@@ -38,53 +43,296 @@ func (s *Server) DocumentSymbol(_ context.Context, params *protocol.DocumentSymb
 }
 
 func buildDocumentSymbols(node ast.Node) []protocol.DocumentSymbol {
-	var symbols []protocol.DocumentSymbol
+	return topLevelSymbols(node, nil)
+}
 
-	switch node := node.(type) {
-	case *ast.Binary:
-		symbols = append(symbols, buildDocumentSymbols(node.Left)...)
-		symbols = append(symbols, buildDocumentSymbols(node.Right)...)
-	case *ast.Local:
-		for _, bind := range node.Binds {
-			objectRange := processing.LocalBindToRange(bind)
-			symbols = append(symbols, protocol.DocumentSymbol{
-				Name:           string(bind.Variable),
-				Kind:           protocol.Variable,
-				Range:          position.RangeASTToProtocol(objectRange.FullRange),
-				SelectionRange: position.RangeASTToProtocol(objectRange.SelectionRange),
-				Detail:         symbolDetails(bind.Body),
-			})
-		}
-		symbols = append(symbols, buildDocumentSymbols(node.Body)...)
-	case *ast.DesugaredObject:
-		for _, field := range node.Fields {
-			kind := protocol.Field
-			if field.Hide == ast.ObjectFieldHidden {
-				kind = protocol.Property
+// symbolReuse gives the symbols of the top-level binds and fields that can be reused, by their range, and is given
+// the ones that are built.
+type symbolReuse interface {
+	reuse(rng ast.LocationRange) (protocol.DocumentSymbol, bool)
+	built(rng ast.LocationRange, symbol protocol.DocumentSymbol)
+}
+
+// topLevelSymbols returns the symbols of the top-level binds and fields of the node. The locals' bodies and the
+// operands of the binary operators are walked with a stack rather than by recursion, the objects built by `+` can
+// have thousands of operands.
+func topLevelSymbols(node ast.Node, reuse symbolReuse) []protocol.DocumentSymbol {
+	count := countTopLevelSymbols(node)
+	if count == 0 {
+		return nil
+	}
+	symbols := make([]protocol.DocumentSymbol, 0, count)
+
+	stack := []ast.Node{node}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		switch node := node.(type) {
+		case *ast.Binary:
+			stack = append(stack, node.Right, node.Left)
+		case *ast.Local:
+			for i := range node.Binds {
+				bind := &node.Binds[i]
+				rng := bindRange(bind)
+				symbol, ok := reuseSymbol(reuse, rng)
+				if !ok {
+					symbol = bindSymbol(bind)
+					keepSymbol(reuse, rng, symbol)
+				}
+				symbols = append(symbols, symbol)
+			}
+			stack = append(stack, node.Body)
+		case *ast.DesugaredObject:
+			for i := range node.Fields {
+				field := &node.Fields[i]
+				symbol, ok := reuseSymbol(reuse, field.LocRange)
+				if !ok {
+					symbol = fieldSymbol(field)
+					keepSymbol(reuse, field.LocRange, symbol)
+				}
+				symbols = append(symbols, symbol)
 			}
-			fieldRange := processing.FieldToRange(field)
-			symbols = append(symbols, protocol.DocumentSymbol{
-				Name:           processing.FieldNameToString(field.Name),
-				Kind:           kind,
-				Range:          position.RangeASTToProtocol(fieldRange.FullRange),
-				SelectionRange: position.RangeASTToProtocol(fieldRange.SelectionRange),
-				Detail:         symbolDetails(field.Body),
-				Children:       buildDocumentSymbols(field.Body),
-			})
 		}
 	}
 
 	return symbols
 }
 
+func reuseSymbol(reuse symbolReuse, rng ast.LocationRange) (protocol.DocumentSymbol, bool) {
+	if reuse == nil {
+		return protocol.DocumentSymbol{}, false
+	}
+	return reuse.reuse(rng)
+}
+
+func keepSymbol(reuse symbolReuse, rng ast.LocationRange, symbol protocol.DocumentSymbol) {
+	if reuse != nil {
+		reuse.built(rng, symbol)
+	}
+}
+
+// countTopLevelSymbols counts the top-level binds and fields of the node, to allocate their symbols at once.
+func countTopLevelSymbols(node ast.Node) int {
+	count := 0
+	stack := []ast.Node{node}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		switch node := node.(type) {
+		case *ast.Binary:
+			stack = append(stack, node.Right, node.Left)
+		case *ast.Local:
+			count += len(node.Binds)
+			stack = append(stack, node.Body)
+		case *ast.DesugaredObject:
+			count += len(node.Fields)
+		}
+	}
+	return count
+}
+
+// bindRange is the range of a bind, the function binds have none and get their body's.
+func bindRange(bind *ast.LocalBind) ast.LocationRange {
+	if !bind.LocRange.Begin.IsSet() {
+		return *bind.Body.Loc()
+	}
+	return bind.LocRange
+}
+
+func bindSymbol(bind *ast.LocalBind) protocol.DocumentSymbol {
+	rng, selection := symbolRanges(bindRange(bind), len(bind.Variable))
+	return protocol.DocumentSymbol{
+		Name:           string(bind.Variable),
+		Kind:           protocol.Variable,
+		Range:          rng,
+		SelectionRange: selection,
+		Detail:         symbolDetails(bind.Body),
+	}
+}
+
+func fieldSymbol(field *ast.DesugaredObjectField) protocol.DocumentSymbol {
+	kind := protocol.Field
+	if field.Hide == ast.ObjectFieldHidden {
+		kind = protocol.Property
+	}
+	detail := symbolDetails(field.Body)
+	if visibility := visibilitySymbolDetail(field.Hide); visibility != "" && detail != "" {
+		detail += ", " + visibility
+	} else if visibility != "" {
+		detail = visibility
+	}
+	name := processing.FieldNameToString(field.Name)
+	rng, selection := symbolRanges(field.LocRange, len(name))
+	return protocol.DocumentSymbol{
+		Name:           name,
+		Kind:           kind,
+		Range:          rng,
+		SelectionRange: selection,
+		Detail:         detail,
+		Children:       buildDocumentSymbols(field.Body),
+	}
+}
+
+// symbolRanges converts the range of a bind or field to the range of its symbol, and to the range of its name, which
+// it starts with.
+func symbolRanges(rng ast.LocationRange, nameLength int) (protocol.Range, protocol.Range) {
+	full := position.RangeASTToProtocol(rng)
+	selection := protocol.Range{Start: full.Start, End: full.Start}
+	selection.End.Character += uint32(nameLength)
+	return full, selection
+}
+
+// symbolCache keeps the symbols of the top-level binds and fields of each document, by their text. An edit only
+// rebuilds the symbols of the binds and fields it changes, the others are moved to their new lines.
+type symbolCache struct {
+	mu      sync.Mutex
+	entries map[protocol.DocumentURI]map[symbolKey]cachedSymbol
+}
+
+// symbolKey is the text of the lines of a top-level bind or field, and the columns it starts and ends at.
+type symbolKey struct {
+	text       string
+	begin, end int
+}
+
+type cachedSymbol struct {
+	line   int
+	symbol protocol.DocumentSymbol
+}
+
+func newSymbolCache() *symbolCache {
+	return &symbolCache{entries: map[protocol.DocumentURI]map[symbolKey]cachedSymbol{}}
+}
+
+// reset forgets the symbols of all the documents.
+func (c *symbolCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = map[protocol.DocumentURI]map[symbolKey]cachedSymbol{}
+}
+
+// documentSymbols returns the symbols of the AST, parsed from the text, reusing those of the binds and fields that
+// are unchanged since the last call for the document.
+func (c *symbolCache) documentSymbols(uri protocol.DocumentURI, text string, root ast.Node) []protocol.DocumentSymbol {
+	c.mu.Lock()
+	previous := c.entries[uri]
+	c.mu.Unlock()
+
+	// The offsets of the lines' starts, plus the end of the text
+	offsets := make([]int, 1, strings.Count(text, "\n")+2)
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			offsets = append(offsets, i+1)
+		}
+	}
+	offsets = append(offsets, len(text)+1)
+
+	reuse := &symbolTextReuse{text: text, offsets: offsets, previous: previous, entries: make(map[symbolKey]cachedSymbol, len(previous))}
+	symbols := topLevelSymbols(root, reuse)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[uri] = reuse.entries
+	return symbols
+}
+
+// symbolTextReuse reuses the symbols of the previous version of a document whose text is unchanged.
+type symbolTextReuse struct {
+	text     string
+	offsets  []int
+	previous map[symbolKey]cachedSymbol
+	entries  map[symbolKey]cachedSymbol
+}
+
+func (r *symbolTextReuse) key(rng ast.LocationRange) (symbolKey, bool) {
+	// The symbols of single lines are cheaper to build again than to look up
+	begin, end := rng.Begin.Line-1, rng.End.Line
+	if !rng.Begin.IsSet() || begin < 0 || end >= len(r.offsets) || end-begin < 2 {
+		return symbolKey{}, false
+	}
+	return symbolKey{text: r.text[r.offsets[begin] : r.offsets[end]-1], begin: rng.Begin.Column, end: rng.End.Column}, true
+}
+
+func (r *symbolTextReuse) reuse(rng ast.LocationRange) (protocol.DocumentSymbol, bool) {
+	key, ok := r.key(rng)
+	if !ok {
+		return protocol.DocumentSymbol{}, false
+	}
+	cached, ok := r.previous[key]
+	if !ok {
+		return protocol.DocumentSymbol{}, false
+	}
+	symbol := shiftSymbol(cached.symbol, rng.Begin.Line-1-cached.line)
+	r.entries[key] = cachedSymbol{line: rng.Begin.Line - 1, symbol: symbol}
+	return symbol, true
+}
+
+func (r *symbolTextReuse) built(rng ast.LocationRange, symbol protocol.DocumentSymbol) {
+	if key, ok := r.key(rng); ok {
+		r.entries[key] = cachedSymbol{line: rng.Begin.Line - 1, symbol: symbol}
+	}
+}
+
+// shiftSymbol returns a copy of the symbol, and its children, moved down by the given number of lines.
+func shiftSymbol(symbol protocol.DocumentSymbol, lines int) protocol.DocumentSymbol {
+	if lines == 0 {
+		return symbol
+	}
+	shift := func(rng protocol.Range) protocol.Range {
+		rng.Start.Line = uint32(int(rng.Start.Line) + lines)
+		rng.End.Line = uint32(int(rng.End.Line) + lines)
+		return rng
+	}
+	symbol.Range, symbol.SelectionRange = shift(symbol.Range), shift(symbol.SelectionRange)
+	if symbol.Children != nil {
+		children := make([]protocol.DocumentSymbol, len(symbol.Children))
+		for i, child := range symbol.Children {
+			children[i] = shiftSymbol(child, lines)
+		}
+		symbol.Children = children
+	}
+	return symbol
+}
+
+// staleDocumentSymbols maps the symbols of a stale AST to the current text, and marks them as stale in their details.
+func staleDocumentSymbols(symbols []protocol.DocumentSymbol, lines lineMap, version int32) []protocol.DocumentSymbol {
+	var mapped []protocol.DocumentSymbol
+	for _, symbol := range symbols {
+		selection, ok := lines.rangeToText(symbol.SelectionRange)
+		if !ok {
+			continue
+		}
+		rng, ok := lines.rangeToText(symbol.Range)
+		if !ok {
+			rng = selection
+		}
+		symbol.SelectionRange, symbol.Range = selection, rng
+		stale := fmt.Sprintf("stale, from version %d", version)
+		if symbol.Detail == "" {
+			symbol.Detail = stale
+		} else {
+			symbol.Detail += ", " + stale
+		}
+		symbol.Children = staleDocumentSymbols(symbol.Children, lines, version)
+		mapped = append(mapped, symbol)
+	}
+	return mapped
+}
+
 func symbolDetails(node ast.Node) string {
 	switch node := node.(type) {
 	case *ast.Function:
-		var args []string
-		for _, param := range node.Parameters {
-			args = append(args, string(param.Name))
+		var b strings.Builder
+		b.Grow(len("Function()") + 8*len(node.Parameters))
+		b.WriteString("Function(")
+		for i, param := range node.Parameters {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(string(param.Name))
 		}
-		return fmt.Sprintf("Function(%s)", strings.Join(args, ", "))
+		b.WriteByte(')')
+		return b.String()
 	case *ast.DesugaredObject:
 		return "Object"
 	case *ast.LiteralString:
@@ -97,6 +345,12 @@ func symbolDetails(node ast.Node) string {
 		return "Import " + node.File.Value
 	case *ast.ImportStr:
 		return "Import " + node.File.Value
+	case *ast.ImportBin:
+		return "Import " + node.File.Value
+	case *ast.Apply:
+		if name, ok := nativeFunctionName(node); ok {
+			return "Native function " + name
+		}
 	case *ast.Index:
 		return ""
 	}
@@ -2,8 +2,11 @@ package server
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"testing"
 
+	"github.com/google/go-jsonnet/ast"
 	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -285,3 +288,150 @@ func TestSymbols(t *testing.T) {
 		})
 	}
 }
+
+func TestSymbolCache(t *testing.T) {
+	const uri = protocol.DocumentURI("file:///test.jsonnet")
+	text := largeDocument(20)
+	for _, tc := range []struct {
+		name   string
+		edited string
+		// rebuilt is the number of top-level symbols that aren't reused
+		rebuilt int
+	}{
+		{
+			name:    "unchanged",
+			edited:  text,
+			rebuilt: 0,
+		},
+		{
+			name:    "lines inserted above",
+			edited:  strings.Replace(text, "{\n", "{\n  // a comment\n\n", 1),
+			rebuilt: 0,
+		},
+		{
+			name:    "field edited",
+			edited:  strings.Replace(text, "name: 'field7'", "name: 'seven'", 1),
+			rebuilt: 1,
+		},
+		{
+			name:    "field added",
+			edited:  strings.Replace(text, "  field3: base {", "  added: {\n    a: 1,\n  },\n  field3: base {", 1),
+			rebuilt: 1,
+		},
+		{
+			name:    "field indented",
+			edited:  strings.Replace(text, "  field3: base {", "   field3: base {", 1),
+			rebuilt: 1,
+		},
+		{
+			// The single lines aren't cached
+			name:    "local edited",
+			edited:  strings.Replace(text, "replicas: 1", "replicas: 2", 1),
+			rebuilt: 0,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cache := newSymbolCache()
+			root, err := parseDocument("test.jsonnet", text)
+			require.NoError(t, err)
+			cache.documentSymbols(uri, text, root)
+			previous := cache.entries[uri]
+
+			edited, err := parseDocument("test.jsonnet", tc.edited)
+			require.NoError(t, err)
+			symbols := cache.documentSymbols(uri, tc.edited, edited)
+
+			assert.Equal(t, buildDocumentSymbols(edited), symbols)
+			rebuilt := 0
+			for key := range cache.entries[uri] {
+				if _, ok := previous[key]; !ok {
+					rebuilt++
+				}
+			}
+			assert.Equal(t, tc.rebuilt, rebuilt)
+		})
+	}
+}
+
+func TestBuildDocumentSymbols_Order(t *testing.T) {
+	// The operands of `+` are walked from left to right, and the locals before their bodies
+	root, err := parseDocument("test.jsonnet", "local a = 1; { b: 1 } + { c: { d: 2 } } + (local e = 3; { f: 4 }) + { g: 5 }")
+	require.NoError(t, err)
+
+	var names []string
+	for _, symbol := range buildDocumentSymbols(root) {
+		names = append(names, symbol.Name)
+		for _, child := range symbol.Children {
+			names = append(names, symbol.Name+"."+child.Name)
+		}
+	}
+	assert.Equal(t, []string{"a", "b", "c", "c.d", "e", "f", "g"}, names)
+}
+
+func TestBuildDocumentSymbols_LongMixinChain(t *testing.T) {
+	var b strings.Builder
+	for i := 0; i < 10000; i++ {
+		fmt.Fprintf(&b, "{ field%d: %d } +\n", i, i)
+	}
+	b.WriteString("{}")
+	root, err := parseDocument("test.jsonnet", b.String())
+	require.NoError(t, err)
+
+	symbols := buildDocumentSymbols(root)
+	require.Len(t, symbols, 10000)
+	assert.Equal(t, "field9999", symbols[9999].Name)
+	assert.Equal(t, uint32(9999), symbols[9999].Range.Start.Line)
+}
+
+// symbolBenchmarkDocuments are generated libraries of about 5000 lines, of the shapes that symbols are built for.
+func symbolBenchmarkDocuments() map[string]string {
+	var locals, mixins, nested strings.Builder
+	for i := 0; i < 5000; i++ {
+		fmt.Fprintf(&locals, "local f%d(a, b=%d) = a + b;\n", i, i)
+		fmt.Fprintf(&mixins, "{ field%d+: { value: %d } } +\n", i, i)
+	}
+	locals.WriteString("{}\n")
+	mixins.WriteString("{}\n")
+	nested.WriteString("{\n")
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&nested, "  field%d: {\n    a: {\n      b: { c: %d, d:: 'd' },\n    },\n  },\n", i, i)
+	}
+	nested.WriteString("}\n")
+
+	return map[string]string{
+		"fields": largeDocument(1000),
+		"locals": locals.String(),
+		"mixins": mixins.String(),
+		"nested": nested.String(),
+	}
+}
+
+func BenchmarkDocumentSymbols(b *testing.B) {
+	const uri = protocol.DocumentURI("file:///large.jsonnet")
+	for name, text := range symbolBenchmarkDocuments() {
+		// The edits add a line in the middle of the document, the symbols of the lines below it are moved
+		lines := strings.Split(text, "\n")
+		edited := strings.Join(append(lines[:len(lines)/2:len(lines)/2], append([]string{""}, lines[len(lines)/2:]...)...), "\n")
+		texts := []string{text, edited}
+		var roots [2]ast.Node
+		for i, t := range texts {
+			var err error
+			roots[i], err = parseDocument("large.jsonnet", t)
+			require.NoError(b, err)
+		}
+
+		b.Run(name+"/full", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				buildDocumentSymbols(roots[i%2])
+			}
+		})
+		b.Run(name+"/incremental", func(b *testing.B) {
+			b.ReportAllocs()
+			cache := newSymbolCache()
+			for i := 0; i < b.N; i++ {
+				cache.documentSymbols(uri, texts[i%2], roots[i%2])
+			}
+		})
+	}
+}
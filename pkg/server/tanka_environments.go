@@ -0,0 +1,185 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/google/go-jsonnet"
+	"github.com/jdbaldry/go-language-server-protocol/jsonrpc2"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// tankaEnvironmentsFunction finds the Tanka environments in the output of a file, wherever they are nested, like
+// `tk env list` finds the inline environments.
+const tankaEnvironmentsFunction = `local environments(object) =
+  if std.isObject(object) then
+    if std.objectHas(object, 'apiVersion') && std.objectHas(object, 'kind') then
+      if object.kind == 'Environment' then [object] else []
+    else
+      std.flattenArrays([environments(object[key]) for key in std.objectFields(object)])
+  else if std.isArray(object) then
+    std.flattenArrays(std.map(environments, object))
+  else [];
+`
+
+// tankaEnvironmentsSnippet returns the snippet that lists the inline environments of a file. Their data isn't
+// evaluated.
+func tankaEnvironmentsSnippet(path string) string {
+	return tankaEnvironmentsFunction + fmt.Sprintf(`[
+  {
+    name: environment.metadata.name,
+    namespace: std.get(std.get(environment, 'spec', {}), 'namespace', ''),
+    apiServer: std.get(std.get(environment, 'spec', {}), 'apiServer', ''),
+  }
+  for environment in environments(import %q)
+]
+`, path)
+}
+
+// tankaEnvironmentSnippet returns the snippet that evaluates to the inline environment of a file that has a name,
+// like `tk show --name` only evaluates the data of that environment.
+func tankaEnvironmentSnippet(path, name string) string {
+	return tankaEnvironmentsFunction + fmt.Sprintf(`local found = [environment for environment in environments(import %q) if environment.metadata.name == %q];
+if std.length(found) == 0 then error %q else found[0]
+`, path, name, fmt.Sprintf("The Tanka environment %s is not in %s", name, path))
+}
+
+// tankaEnvironment is an inline environment of a file, as it is listed to the clients.
+type tankaEnvironment struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+	APIServer string `json:"apiServer,omitempty"`
+}
+
+// tankaEnvironmentSelections are the inline environments that the diagnostics of the files evaluate, by file. The
+// diagnostics of the other files evaluate their whole output.
+type tankaEnvironmentSelections struct {
+	mu    sync.Mutex
+	names map[string]string
+}
+
+func newTankaEnvironmentSelections() *tankaEnvironmentSelections {
+	return &tankaEnvironmentSelections{names: map[string]string{}}
+}
+
+func (t *tankaEnvironmentSelections) selected(path string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.names[path]
+}
+
+func (t *tankaEnvironmentSelections) selectEnvironment(path, name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if name == "" {
+		delete(t.names, path)
+		return
+	}
+	t.names[path] = name
+}
+
+// withDocumentImport makes the file of a document import the text of the document, rather than the file on disk, for
+// the snippets that import it.
+func withDocumentImport(settings *projectSettings, path, text string) {
+	settings.imports[path] = func() (jsonnet.Contents, string, error) {
+		return jsonnet.MakeContents(text), path, nil
+	}
+}
+
+// listTankaEnvironments evaluates the inline environments of a file, the open document if it is open.
+func (s *Server) listTankaEnvironments(ctx context.Context, uri protocol.DocumentURI) ([]tankaEnvironment, error) {
+	if err := s.requireTrust(ctx, "listing the Tanka environments"); err != nil {
+		return nil, err
+	}
+	path := uri.SpanURI().Filename()
+	config, settings := s.evaluationSettings(path)
+	if doc, err := s.cache.get(uri); err == nil {
+		withDocumentImport(settings, path, doc.item.Text)
+	}
+	vm := s.makeVM(config, settings, &cancellableImporter{ctx: ctx, importer: s.getImporter(config, path, settings)})
+	output, err := s.evaluateInTurn(ctx, "tankaEnvironments", path, func() (string, error) {
+		return vm.EvaluateAnonymousSnippet(path, tankaEnvironmentsSnippet(path))
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list the Tanka environments of %s: %w", path, err)
+	}
+	environments := []tankaEnvironment{}
+	if err := json.Unmarshal([]byte(output), &environments); err != nil {
+		return nil, err
+	}
+	return environments, nil
+}
+
+type tankaEnvironmentsParams struct {
+	TextDocument protocol.TextDocumentIdentifier `json:"textDocument"`
+}
+
+type tankaEnvironmentsResult struct {
+	Environments []tankaEnvironment `json:"environments"`
+	// Selected is the environment that the diagnostics evaluate, the whole output is evaluated if it is empty
+	Selected string `json:"selected"`
+}
+
+// tankaEnvironmentsRequest handles the jsonnet/tankaEnvironments request, which lists the inline environments of a file
+// for the clients to show a picker.
+func (s *Server) tankaEnvironmentsRequest(ctx context.Context, rawParams interface{}) (*tankaEnvironmentsResult, error) {
+	var params tankaEnvironmentsParams
+	if err := decodeParams(rawParams, &params); err != nil {
+		return nil, err
+	}
+	environments, err := s.listTankaEnvironments(ctx, params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	return &tankaEnvironmentsResult{
+		Environments: environments,
+		Selected:     s.tankaEnvironments.selected(params.TextDocument.URI.SpanURI().Filename()),
+	}, nil
+}
+
+type selectTankaEnvironmentParams struct {
+	TextDocument protocol.TextDocumentIdentifier `json:"textDocument"`
+	// Name is the environment to evaluate, the whole output is evaluated again if it is empty
+	Name string `json:"name"`
+}
+
+// selectTankaEnvironmentRequest handles the jsonnet/selectTankaEnvironment request, which picks the inline environment that
+// the diagnostics of a file evaluate.
+func (s *Server) selectTankaEnvironmentRequest(ctx context.Context, rawParams interface{}) (interface{}, error) {
+	var params selectTankaEnvironmentParams
+	if err := decodeParams(rawParams, &params); err != nil {
+		return nil, err
+	}
+	path := params.TextDocument.URI.SpanURI().Filename()
+	if params.Name != "" {
+		environments, err := s.listTankaEnvironments(ctx, params.TextDocument.URI)
+		if err != nil {
+			return nil, err
+		}
+		if !containsTankaEnvironment(environments, params.Name) {
+			return nil, fmt.Errorf("%w: %s has no Tanka environment named %q", jsonrpc2.ErrInvalidParams, path, params.Name)
+		}
+	}
+	log.WithContext(ctx).Infof("Evaluating the Tanka environment %q of %s", params.Name, path)
+	s.tankaEnvironments.selectEnvironment(path, params.Name)
+	// The document is analysed again, its evaluation was of the previous environment
+	if doc, err := s.cache.get(params.TextDocument.URI); err == nil {
+		if err := s.cache.put(s.newDocument(ctx, doc.item)); err != nil {
+			log.WithContext(ctx).Debugf("selectTankaEnvironment: not replacing %s: %v", doc.item.URI, err)
+		}
+		s.queueDiagnostics(doc.item.URI)
+	}
+	return nil, nil
+}
+
+func containsTankaEnvironment(environments []tankaEnvironment, name string) bool {
+	for _, environment := range environments {
+		if environment.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const inlineEnvironments = `local environment(name, data) = {
+  apiVersion: 'tanka.dev/v1alpha1',
+  kind: 'Environment',
+  metadata: { name: name },
+  spec: { namespace: name, apiServer: 'https://' + name + '.example.com' },
+  data: data,
+};
+{
+  environments: [
+    environment('dev', { replicas: 1 }),
+    environment('prod', { replicas: error 'the prod replicas are required' }),
+  ],
+}
+`
+
+func TestTankaEnvironments(t *testing.T) {
+	root := writeProjectFiles(t, map[string]string{"main.jsonnet": "{}"})
+	main := filepath.Join(root, "main.jsonnet")
+	s := renameTestServer(t, root, nil)
+	require.NoError(t, s.DidChangeConfiguration(context.Background(), &protocol.DidChangeConfigurationParams{
+		Settings: map[string]interface{}{"enable_eval_diagnostics": true},
+	}))
+	uri := serverOpenTestFile(t, s, main)
+	// The environments are those of the open document, not of the file on disk
+	require.NoError(t, s.DidChange(context.Background(), &protocol.DidChangeTextDocumentParams{
+		TextDocument:   protocol.VersionedTextDocumentIdentifier{TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: uri}, Version: 2},
+		ContentChanges: []protocol.TextDocumentContentChangeEvent{{Text: inlineEnvironments}},
+	}))
+	textDocument := map[string]interface{}{"uri": string(uri)}
+	evalDiags := func() []protocol.Diagnostic {
+		doc, err := s.cache.get(uri)
+		require.NoError(t, err)
+		return s.getEvalDiags(context.Background(), doc)
+	}
+	selectEnvironment := func(name string) error {
+		_, err := s.NonstandardRequest(context.Background(), "jsonnet/selectTankaEnvironment", map[string]interface{}{"textDocument": textDocument, "name": name})
+		return err
+	}
+
+	// Listing the environments doesn't evaluate their data
+	result, err := s.NonstandardRequest(context.Background(), "jsonnet/tankaEnvironments", map[string]interface{}{"textDocument": textDocument})
+	require.NoError(t, err)
+	assert.Equal(t, &tankaEnvironmentsResult{Environments: []tankaEnvironment{
+		{Name: "dev", Namespace: "dev", APIServer: "https://dev.example.com"},
+		{Name: "prod", Namespace: "prod", APIServer: "https://prod.example.com"},
+	}}, result)
+
+	// The whole output is evaluated until an environment is selected
+	diags := evalDiags()
+	require.Len(t, diags, 1)
+	assert.Contains(t, diags[0].Message, "the prod replicas are required")
+
+	require.NoError(t, selectEnvironment("dev"))
+	assert.Empty(t, evalDiags())
+	doc, err := s.cache.get(uri)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"apiVersion": "tanka.dev/v1alpha1",
+		"kind": "Environment",
+		"metadata": {"name": "dev"},
+		"spec": {"namespace": "dev", "apiServer": "https://dev.example.com"},
+		"data": {"replicas": 1}
+	}`, doc.val)
+	result, err = s.NonstandardRequest(context.Background(), "jsonnet/tankaEnvironments", map[string]interface{}{"textDocument": textDocument})
+	require.NoError(t, err)
+	assert.Equal(t, "dev", result.(*tankaEnvironmentsResult).Selected)
+
+	// The errors of the selected environment are reported in the file
+	require.NoError(t, selectEnvironment("prod"))
+	diags = evalDiags()
+	require.Len(t, diags, 1)
+	assert.Contains(t, diags[0].Message, "the prod replicas are required")
+	assert.Equal(t, uint32(10), diags[0].Range.Start.Line)
+
+	assert.EqualError(t, selectEnvironment("staging"), "JSON RPC invalid params: "+main+` has no Tanka environment named "staging"`)
+
+	// Without a selection, the whole output is evaluated again
+	require.NoError(t, selectEnvironment(""))
+	diags = evalDiags()
+	require.Len(t, diags, 1)
+	assert.Contains(t, diags[0].Message, "the prod replicas are required")
+}
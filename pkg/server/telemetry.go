@@ -0,0 +1,143 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// telemetryInterval is how often the usage counts are sent to the client.
+const telemetryInterval = 15 * time.Minute
+
+// evaluationDurationBuckets are the upper bounds of the evaluation durations reported by telemetry.
+var evaluationDurationBuckets = []time.Duration{100 * time.Millisecond, time.Second, 5 * time.Second, 30 * time.Second}
+
+type telemetryEventType string
+
+const (
+	telemetryUsage telemetryEventType = "usage"
+	telemetryCrash telemetryEventType = "crash"
+)
+
+// telemetryEvent is sent with the telemetry/event notification. It must never contain file names or file contents.
+type telemetryEvent struct {
+	Type telemetryEventType `json:"type"`
+	// Features counts the requests received, by method
+	Features map[string]int `json:"features,omitempty"`
+	// EvaluationDurations counts the evaluations, by duration bucket
+	EvaluationDurations map[string]int `json:"evaluationDurations,omitempty"`
+	// CrashSignature identifies the code path of a panic
+	CrashSignature string `json:"crashSignature,omitempty"`
+}
+
+// telemetry aggregates the usage counts between two telemetry/event notifications.
+type telemetry struct {
+	mu                  sync.Mutex
+	features            map[string]int
+	evaluationDurations map[string]int
+}
+
+func newTelemetry() *telemetry {
+	return &telemetry{
+		features:            make(map[string]int),
+		evaluationDurations: make(map[string]int),
+	}
+}
+
+func evaluationDurationBucket(duration time.Duration) string {
+	for _, bucket := range evaluationDurationBuckets {
+		if duration < bucket {
+			return "<" + bucket.String()
+		}
+	}
+	return ">=" + evaluationDurationBuckets[len(evaluationDurationBuckets)-1].String()
+}
+
+func (s *Server) recordFeatureUsage(method string) {
+	if !s.config().EnableTelemetry {
+		return
+	}
+	s.telemetry.mu.Lock()
+	defer s.telemetry.mu.Unlock()
+	s.telemetry.features[method]++
+}
+
+func (s *Server) recordEvaluationTelemetry(duration time.Duration) {
+	if !s.config().EnableTelemetry {
+		return
+	}
+	s.telemetry.mu.Lock()
+	defer s.telemetry.mu.Unlock()
+	s.telemetry.evaluationDurations[evaluationDurationBucket(duration)]++
+}
+
+// flushTelemetry sends the usage counts aggregated since the last flush, if there are any.
+func (s *Server) flushTelemetry() {
+	s.telemetry.mu.Lock()
+	event := telemetryEvent{
+		Type:                telemetryUsage,
+		Features:            s.telemetry.features,
+		EvaluationDurations: s.telemetry.evaluationDurations,
+	}
+	s.telemetry.features = make(map[string]int)
+	s.telemetry.evaluationDurations = make(map[string]int)
+	s.telemetry.mu.Unlock()
+
+	if len(event.Features) == 0 && len(event.EvaluationDurations) == 0 {
+		return
+	}
+	s.sendTelemetry(event)
+}
+
+func (s *Server) telemetryLoop() {
+	go func() {
+		for range time.Tick(telemetryInterval) {
+			s.flushTelemetry()
+		}
+	}()
+}
+
+// reportCrash sends the signature of a recovered panic. It must be called from the deferred function that recovered it.
+func (s *Server) reportCrash(recovered interface{}) {
+	if !s.config().EnableTelemetry {
+		return
+	}
+	s.sendTelemetry(telemetryEvent{Type: telemetryCrash, CrashSignature: crashSignature(recovered)})
+}
+
+// crashSignature hashes the type of the panic value and the functions on the stack of the panic.
+// The panic message and the file paths are left out, as they may contain user data.
+func crashSignature(recovered interface{}) string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	signature := []string{fmt.Sprintf("%T", recovered)}
+	for {
+		frame, more := frames.Next()
+		signature = append(signature, frame.Function)
+		if !more {
+			break
+		}
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join(signature, "\n")))
+	return hex.EncodeToString(sum[:8])
+}
+
+func (s *Server) sendTelemetry(event telemetryEvent) {
+	if !s.config().EnableTelemetry {
+		return
+	}
+	var params interface{} = event
+	if err := s.client.Event(context.Background(), &params); err != nil {
+		log.Errorf("sendTelemetry: unable to send telemetry event: %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jdbaldry/go-language-server-protocol/jsonrpc2"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTelemetry(t *testing.T) {
+	uri := protocol.URIFromPath("/test/file.jsonnet")
+
+	testCases := []struct {
+		name     string
+		enabled  bool
+		expected []interface{}
+	}{
+		{
+			name: "disabled",
+		},
+		{
+			name:    "enabled",
+			enabled: true,
+			expected: []interface{}{
+				telemetryEvent{
+					Type:                telemetryUsage,
+					Features:            map[string]int{"textDocument/hover": 2},
+					EvaluationDurations: map[string]int{"<100ms": 1},
+				},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &recordingClient{}
+			server := NewServer("jsonnet-language-server", "dev", client, Configuration{EnableTelemetry: tc.enabled})
+
+			handler := server.InstrumentHandler(func(ctx context.Context, reply jsonrpc2.Replier, _ jsonrpc2.Request) error {
+				return reply(ctx, nil, nil)
+			})
+			for i := 0; i < 2; i++ {
+				call, err := jsonrpc2.NewCall(jsonrpc2.NewIntID(int64(i)), "textDocument/hover", nil)
+				require.NoError(t, err)
+				require.NoError(t, handler(context.Background(), func(context.Context, interface{}, error) error { return nil }, call))
+			}
+			server.startEvaluationStatus(uri)(nil)
+
+			server.flushTelemetry()
+			// Nothing happened since the last flush
+			server.flushTelemetry()
+
+			assert.Equal(t, tc.expected, client.getEvents())
+		})
+	}
+}
+
+func TestTelemetryCrash(t *testing.T) {
+	// The crash bundle is written to the temporary directory
+	t.Setenv("TMPDIR", t.TempDir())
+	client := &recordingClient{}
+	server := NewServer("jsonnet-language-server", "dev", client, Configuration{EnableTelemetry: true})
+
+	handler := server.InstrumentHandler(func(context.Context, jsonrpc2.Replier, jsonrpc2.Request) error {
+		panic("crash in /home/user/secret.jsonnet")
+	})
+	call, err := jsonrpc2.NewCall(jsonrpc2.NewIntID(1), "textDocument/hover", nil)
+	require.NoError(t, err)
+	assert.Panics(t, func() {
+		_ = handler(context.Background(), nil, call)
+	})
+
+	events := client.getEvents()
+	require.Len(t, events, 1)
+	event, ok := events[0].(telemetryEvent)
+	require.True(t, ok)
+	assert.Equal(t, telemetryCrash, event.Type)
+	assert.Len(t, event.CrashSignature, 16)
+	assert.NotContains(t, event.CrashSignature, "secret")
+}
+
+func TestEvaluationDurationBucket(t *testing.T) {
+	assert.Equal(t, "<100ms", evaluationDurationBucket(10*time.Millisecond))
+	assert.Equal(t, "<5s", evaluationDurationBucket(time.Second))
+	assert.Equal(t, ">=30s", evaluationDurationBucket(time.Minute))
+}
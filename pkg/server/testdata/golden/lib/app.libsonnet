@@ -0,0 +1,28 @@
+local k = import 'k8s/k.libsonnet';
+local container = k.core.v1.container;
+local deployment = k.apps.v1.deployment;
+local service = k.core.v1.service;
+
+{
+  _config:: {
+    name: error 'name is required',
+    replicas: 1,
+    image: error 'image is required',
+    port: 8080,
+  },
+
+  local labels = { app: $._config.name },
+
+  // The API server, and its service
+  deployment: deployment.new(
+    $._config.name,
+    replicas=$._config.replicas,
+    containers=[
+      container.new($._config.name, $._config.image)
+      + container.withPorts([k.core.v1.containerPort.new('http', $._config.port)]),
+    ],
+    podLabels=labels,
+  ),
+
+  service: service.new($._config.name, labels, [k.core.v1.servicePort.new(80, $._config.port)]),
+}
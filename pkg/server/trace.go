@@ -0,0 +1,32 @@
+package server
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// traceWriter forwards the std.trace messages of evaluations to the client, instead of the server's stderr.
+// go-jsonnet writes each message at once, with its location: `TRACE: file.jsonnet:12 message`.
+type traceWriter struct {
+	client protocol.Client
+}
+
+func (w *traceWriter) Write(p []byte) (int, error) {
+	message := strings.TrimSuffix(string(p), "\n")
+	log.Debug(message)
+	if w.client == nil {
+		return len(p), nil
+	}
+
+	if err := w.client.LogMessage(context.Background(), &protocol.LogMessageParams{
+		Type:    protocol.Log,
+		Message: message,
+	}); err != nil {
+		log.Errorf("traceWriter: unable to send trace to the client: %v", err)
+	}
+	// Failing to forward a trace must not fail the evaluation
+	return len(p), nil
+}
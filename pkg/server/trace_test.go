@@ -0,0 +1,29 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTraceForwardedToClient(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "main.jsonnet")
+	require.NoError(t, os.WriteFile(file, []byte("{\n  a: std.trace('hello\\nworld', 1),\n}"), 0o600))
+
+	client := &recordingClient{}
+	server := NewServer("jsonnet-language-server", "dev", client, Configuration{})
+
+	output, err := server.evaluateFile(context.Background(), file, "")
+	require.NoError(t, err)
+	assert.Contains(t, output, `"a": 1`)
+
+	assert.Equal(t, []protocol.LogMessageParams{{
+		Type:    protocol.Log,
+		Message: "TRACE: " + file + ":2 hello\nworld",
+	}}, client.getLogs())
+}
@@ -0,0 +1,262 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// spansInterval is how often the finished spans are exported.
+const spansInterval = 5 * time.Second
+
+// maxBufferedSpans is the number of finished spans kept until the next export, the spans over it are dropped.
+const maxBufferedSpans = 10000
+
+type spanContextKey struct{}
+
+// traceSpan times a request, or a phase of a request: parsing, evaluation, linting or indexing. The spans are exported in
+// the OpenTelemetry (OTLP) JSON format. All the methods of a nil span do nothing, it is the span of a disabled tracer.
+type traceSpan struct {
+	tracer   *tracer
+	traceID  string
+	spanID   string
+	parentID string
+	name     string
+	start    time.Time
+
+	mu         sync.Mutex
+	attributes map[string]string
+}
+
+// tracer buffers the finished spans until they are exported.
+type tracer struct {
+	mu    sync.Mutex
+	spans []otlpSpan
+}
+
+func newTracer() *tracer {
+	return &tracer{}
+}
+
+func (c Configuration) tracingEnabled() bool {
+	return c.OTLPEndpoint != "" || c.TraceFile != ""
+}
+
+// startSpan starts a span, as a child of the span of the context if there is one. The returned context carries the new
+// span, for the phases it is made of.
+func (s *Server) startSpan(ctx context.Context, name string) (context.Context, *traceSpan) {
+	if !s.config().tracingEnabled() {
+		return ctx, nil
+	}
+	sp := &traceSpan{tracer: s.tracer, spanID: randomID(8), name: name, start: time.Now()}
+	if parent, ok := ctx.Value(spanContextKey{}).(*traceSpan); ok {
+		sp.traceID, sp.parentID = parent.traceID, parent.spanID
+	} else {
+		sp.traceID = randomID(16)
+	}
+	return context.WithValue(ctx, spanContextKey{}, sp), sp
+}
+
+// setAttribute describes the span, for example with the document it is about.
+func (sp *traceSpan) setAttribute(key, value string) {
+	if sp == nil {
+		return
+	}
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	if sp.attributes == nil {
+		sp.attributes = map[string]string{}
+	}
+	sp.attributes[key] = value
+}
+
+// end finishes the span, with the error of the phase if it failed.
+func (sp *traceSpan) end(err error) {
+	if sp == nil {
+		return
+	}
+	end := time.Now()
+
+	sp.mu.Lock()
+	exported := otlpSpan{
+		TraceID:           sp.traceID,
+		SpanID:            sp.spanID,
+		ParentSpanID:      sp.parentID,
+		Name:              sp.name,
+		Kind:              otlpSpanKindInternal,
+		StartTimeUnixNano: strconv.FormatInt(sp.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(end.UnixNano(), 10),
+	}
+	for key, value := range sp.attributes {
+		exported.Attributes = append(exported.Attributes, otlpAttribute{Key: key, Value: otlpValue{StringValue: value}})
+	}
+	sp.mu.Unlock()
+	if sp.parentID == "" {
+		exported.Kind = otlpSpanKindServer
+	}
+	if err != nil {
+		exported.Status = &otlpStatus{Code: otlpStatusCodeError, Message: err.Error()}
+	}
+
+	sp.tracer.mu.Lock()
+	defer sp.tracer.mu.Unlock()
+	if len(sp.tracer.spans) < maxBufferedSpans {
+		sp.tracer.spans = append(sp.tracer.spans, exported)
+	}
+}
+
+func (t *tracer) take() []otlpSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	spans := t.spans
+	t.spans = nil
+	return spans
+}
+
+func randomID(size int) string {
+	id := make([]byte, size)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// The OTLP JSON encoding of the spans, see https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding
+const (
+	otlpSpanKindInternal = 1
+	otlpSpanKindServer   = 2
+	otlpStatusCodeError  = 2
+)
+
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            *otlpStatus     `json:"status,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// exportSpans sends the spans finished since the last export to the OTLP endpoint, and appends them to the trace
+// file, as a line of OTLP JSON.
+func (s *Server) exportSpans() error {
+	spans := s.tracer.take()
+	if len(spans) == 0 {
+		return nil
+	}
+	body, err := json.Marshal(otlpTraces{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpAttribute{
+			{Key: "service.name", Value: otlpValue{StringValue: s.name}},
+			{Key: "service.version", Value: otlpValue{StringValue: s.version}},
+		}},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: s.name, Version: s.version}, Spans: spans}},
+	}}})
+	if err != nil {
+		return err
+	}
+
+	config := s.config()
+	if config.TraceFile != "" {
+		if err := appendLine(config.TraceFile, body); err != nil {
+			return fmt.Errorf("writing the trace file: %w", err)
+		}
+	}
+	if config.OTLPEndpoint != "" {
+		if err := postSpans(config.OTLPEndpoint, body); err != nil {
+			return fmt.Errorf("sending the spans to %s: %w", config.OTLPEndpoint, err)
+		}
+	}
+	return nil
+}
+
+func appendLine(path string, line []byte) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// postSpans sends the spans to an OTLP/HTTP traces endpoint, such as http://localhost:4318/v1/traces.
+func postSpans(endpoint string, body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// tracingLoop exports the spans periodically. It runs even when tracing is disabled, as it can be enabled by the
+// settings.
+func (s *Server) tracingLoop() {
+	go func() {
+		for range time.Tick(spansInterval) {
+			if err := s.exportSpans(); err != nil {
+				log.Errorf("Unable to export the spans: %v", err)
+			}
+		}
+	}()
+}
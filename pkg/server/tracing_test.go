@@ -0,0 +1,108 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartSpan_Disabled(t *testing.T) {
+	s := NewServer("any", "test version", nil, Configuration{})
+	ctx, sp := s.startSpan(context.Background(), "textDocument/hover")
+	assert.Nil(t, sp)
+	assert.Equal(t, context.Background(), ctx)
+
+	// The methods of the span of a disabled tracer do nothing
+	sp.setAttribute("uri", "file:///test.jsonnet")
+	sp.end(errors.New("failed"))
+	require.NoError(t, s.exportSpans())
+}
+
+func TestExportSpans(t *testing.T) {
+	var received []otlpTraces
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		var traces otlpTraces
+		require.NoError(t, json.Unmarshal(body, &traces))
+		received = append(received, traces)
+	}))
+	defer endpoint.Close()
+
+	traceFile := filepath.Join(t.TempDir(), "traces.jsonl")
+	s := NewServer("jsonnet-language-server", "test version", nil, Configuration{
+		OTLPEndpoint: endpoint.URL + "/v1/traces",
+		TraceFile:    traceFile,
+	})
+
+	// A request, made of the parsing of a document
+	ctx, request := s.startSpan(context.Background(), "textDocument/didOpen")
+	uri := protocol.URIFromPath(filepath.Join(t.TempDir(), "test.jsonnet"))
+	require.NoError(t, s.DidOpen(ctx, &protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{URI: uri, Text: "{ a: ", Version: 1},
+	}))
+	request.setAttribute("uri", string(uri))
+	request.end(nil)
+	require.NoError(t, s.exportSpans())
+
+	// Nothing is exported until more spans end
+	require.NoError(t, s.exportSpans())
+
+	require.Len(t, received, 1)
+	resourceSpans := received[0].ResourceSpans
+	require.Len(t, resourceSpans, 1)
+	assert.Contains(t, resourceSpans[0].Resource.Attributes, otlpAttribute{Key: "service.name", Value: otlpValue{StringValue: "jsonnet-language-server"}})
+	spans := resourceSpans[0].ScopeSpans[0].Spans
+	require.Len(t, spans, 2)
+
+	parse, didOpen := spans[0], spans[1]
+	assert.Equal(t, "parse", parse.Name)
+	assert.Equal(t, otlpSpanKindInternal, parse.Kind)
+	assert.Equal(t, didOpen.TraceID, parse.TraceID)
+	assert.Equal(t, didOpen.SpanID, parse.ParentSpanID)
+	require.NotNil(t, parse.Status)
+	assert.Equal(t, otlpStatusCodeError, parse.Status.Code)
+
+	assert.Equal(t, "textDocument/didOpen", didOpen.Name)
+	assert.Equal(t, otlpSpanKindServer, didOpen.Kind)
+	assert.Empty(t, didOpen.ParentSpanID)
+	assert.Len(t, didOpen.TraceID, 32)
+	assert.Len(t, didOpen.SpanID, 16)
+	assert.Nil(t, didOpen.Status)
+	assert.Equal(t, []otlpAttribute{{Key: "uri", Value: otlpValue{StringValue: string(uri)}}}, didOpen.Attributes)
+	assert.LessOrEqual(t, didOpen.StartTimeUnixNano, parse.StartTimeUnixNano)
+
+	// The trace file has the same spans, one export per line
+	contents, err := os.ReadFile(traceFile)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(contents), "\n"), "\n")
+	require.Len(t, lines, 1)
+	var traces otlpTraces
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &traces))
+	assert.Equal(t, received[0], traces)
+}
+
+func TestExportSpans_EndpointError(t *testing.T) {
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer endpoint.Close()
+
+	s := NewServer("any", "test version", nil, Configuration{OTLPEndpoint: endpoint.URL})
+	_, sp := s.startSpan(context.Background(), "initialize")
+	sp.end(nil)
+	assert.ErrorContains(t, s.exportSpans(), "unexpected status 400")
+}
@@ -0,0 +1,180 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+
+	"github.com/google/go-jsonnet/ast"
+	"github.com/grafana/jsonnet-language-server/pkg/ast/processing"
+	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
+	"github.com/grafana/jsonnet-language-server/pkg/utils"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// TypeDefinition goes to the object literals that define the shape of the value under the cursor.
+// For `local d = deployment.new('x')`, it is the object returned by `deployment.new`, where Definition goes to the local.
+func (s *Server) TypeDefinition(ctx context.Context, params *protocol.TypeDefinitionParams) (protocol.Definition, error) {
+	locations, err := onLatestDocument(s, "TypeDefinition", params.TextDocument.URI, func(doc *document) (protocol.Definition, error) {
+		return s.typeDefinition(ctx, doc, params.Position)
+	})
+	if errors.Is(err, errContentModified) {
+		return nil, err
+	}
+	if err != nil {
+		// Like Definition, the errors are only logged
+		log.WithContext(ctx).WithError(err).Error("TypeDefinition: error finding type definition")
+		return nil, nil
+	}
+	return locations, nil
+}
+
+func (s *Server) typeDefinition(ctx context.Context, doc *document, pos protocol.Position) (protocol.Definition, error) {
+	if doc.ast == nil {
+		return nil, utils.LogErrorf("TypeDefinition: document was never successfully parsed, can't find type definitions")
+	}
+	if doc.linesChangedSinceAST[int(pos.Line)] {
+		return nil, utils.LogErrorf("TypeDefinition: document line %d was changed since last successful parse, can't find type definitions", pos.Line)
+	}
+
+	stack, err := processing.FindNodeByPosition(doc.ast, position.ProtocolToAST(pos))
+	if err != nil {
+		return nil, err
+	}
+	if stack.IsEmpty() {
+		return nil, nil
+	}
+	node, scope := valueAtPosition(doc.ast, stack, position.ProtocolToAST(pos))
+	if node == nil {
+		return nil, nil
+	}
+
+	filename := doc.item.URI.SpanURI().Filename()
+	checker := &typeChecker{
+		server:   s,
+		vm:       s.getCancellableVM(ctx, filename),
+		filename: filename,
+		lines:    map[string][]string{},
+	}
+
+	var locations protocol.Definition
+	for _, object := range checker.valueShapes(node, scope, 0) {
+		objectFile := object.LocRange.FileName
+		if objectFile == "" {
+			continue
+		}
+		if !filepath.IsAbs(objectFile) {
+			if objectFile, err = filepath.Abs(objectFile); err != nil {
+				return nil, err
+			}
+		}
+		locations = append(locations, protocol.Location{
+			URI:   protocol.URIFromPath(objectFile),
+			Range: position.RangeASTToProtocol(object.LocRange),
+		})
+	}
+	return locations, nil
+}
+
+// valueShapes returns the object literals that the value of a node is made of.
+// There are more than one when objects are merged, or when the value is conditional.
+func (c *typeChecker) valueShapes(node ast.Node, scope varScope, depth int) []*ast.DesugaredObject {
+	node, scope = c.resolveValue(node, scope, depth)
+	if node == nil {
+		return nil
+	}
+
+	switch node := node.(type) {
+	case *ast.DesugaredObject:
+		return []*ast.DesugaredObject{node}
+	case *ast.Binary:
+		if node.Op == ast.BopPlus {
+			return append(c.valueShapes(node.Left, scope, depth+1), c.valueShapes(node.Right, scope, depth+1)...)
+		}
+	case *ast.Conditional:
+		return append(c.valueShapes(node.BranchTrue, scope, depth+1), c.valueShapes(node.BranchFalse, scope, depth+1)...)
+	}
+	return nil
+}
+
+// resolveValue follows the variables, imports, field accesses and function calls until it finds the node that
+// creates the value, along with the variables in scope at that node.
+func (c *typeChecker) resolveValue(node ast.Node, scope varScope, depth int) (ast.Node, varScope) {
+	for ; depth <= maxInferenceDepth; depth++ {
+		c.inferenceSteps++
+		if node == nil || c.inferenceSteps > maxInferenceSteps {
+			return nil, nil
+		}
+
+		switch n := node.(type) {
+		case *ast.Var:
+			node = scope[n.Id]
+		case *ast.Self:
+			node = scope["self"]
+		case *ast.Local:
+			binds := map[ast.Identifier]ast.Node{}
+			for _, bind := range n.Binds {
+				binds[bind.Variable] = bind.Body
+			}
+			node, scope = n.Body, scope.with(binds)
+		case *ast.Import:
+			importedFrom := n.LocRange.FileName
+			if importedFrom == "" {
+				importedFrom = c.filename
+			}
+			root, _, err := c.vm.ImportAST(importedFrom, n.File.Value)
+			if err != nil {
+				return nil, nil
+			}
+			node, scope = root, varScope{}
+		case *ast.Index:
+			name, ok := n.Index.(*ast.LiteralString)
+			if !ok {
+				return nil, nil
+			}
+			node, scope = c.fieldValue(n.Target, scope, name.Value, depth+1)
+		case *ast.Apply:
+			fn, fnScope := c.resolveValue(n.Target, scope, depth+1)
+			function, ok := fn.(*ast.Function)
+			if !ok {
+				return nil, nil
+			}
+			params := map[ast.Identifier]ast.Node{}
+			for _, param := range function.Parameters {
+				params[param.Name] = nil
+			}
+			node, scope = function.Body, fnScope.with(params)
+		default:
+			return node, scope
+		}
+	}
+	return nil, nil
+}
+
+// fieldValue returns the body of a field of the object that the node evaluates to. In merged objects, the field
+// of the right-most object wins.
+func (c *typeChecker) fieldValue(node ast.Node, scope varScope, name string, depth int) (ast.Node, varScope) {
+	node, scope = c.resolveValue(node, scope, depth)
+	switch node := node.(type) {
+	case *ast.DesugaredObject:
+		for _, field := range node.Fields {
+			if fieldName, ok := field.Name.(*ast.LiteralString); ok && fieldName.Value == name {
+				binds := map[ast.Identifier]ast.Node{"self": node}
+				for _, bind := range node.Locals {
+					binds[bind.Variable] = bind.Body
+				}
+				return field.Body, scope.with(binds)
+			}
+		}
+	case *ast.Binary:
+		if node.Op != ast.BopPlus {
+			return nil, nil
+		}
+		if value, valueScope := c.fieldValue(node.Right, scope, name, depth+1); value != nil {
+			return value, valueScope
+		}
+		return c.fieldValue(node.Left, scope, name, depth+1)
+	}
+	return nil, nil
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTypeDefinition(t *testing.T) {
+	const lib = `{
+  new(name):: {
+    kind: 'Deployment',
+    metadata: { name: name },
+  },
+  withReplicas(replicas):: { spec+: { replicas: replicas } },
+}
+`
+	testCases := []struct {
+		name     string
+		document string
+		position protocol.Position
+		// expected are the ranges of the object literals, in lib.libsonnet when inLib is set
+		inLib    bool
+		expected []protocol.Range
+	}{
+		{
+			name:     "variable bound to a constructor call",
+			document: "local deployment = import 'lib.libsonnet';\nlocal d = deployment.new('x');\nd",
+			position: protocol.Position{Line: 2, Character: 0},
+			inLib:    true,
+			expected: []protocol.Range{{Start: protocol.Position{Line: 1, Character: 14}, End: protocol.Position{Line: 4, Character: 3}}},
+		},
+		{
+			name:     "local name",
+			document: "local deployment = import 'lib.libsonnet';\nlocal d = deployment.new('x');\nd",
+			position: protocol.Position{Line: 1, Character: 6},
+			inLib:    true,
+			expected: []protocol.Range{{Start: protocol.Position{Line: 1, Character: 14}, End: protocol.Position{Line: 4, Character: 3}}},
+		},
+		{
+			name:     "merged constructors",
+			document: "local deployment = import 'lib.libsonnet';\nlocal d = deployment.new('x') + deployment.withReplicas(2);\nd",
+			position: protocol.Position{Line: 2, Character: 0},
+			inLib:    true,
+			expected: []protocol.Range{
+				{Start: protocol.Position{Line: 1, Character: 14}, End: protocol.Position{Line: 4, Character: 3}},
+				{Start: protocol.Position{Line: 5, Character: 27}, End: protocol.Position{Line: 5, Character: 60}},
+			},
+		},
+		{
+			name:     "field of a local object",
+			document: "local obj = {\n  nested: { a: 1 },\n};\nobj.nested",
+			position: protocol.Position{Line: 3, Character: 5},
+			expected: []protocol.Range{{Start: protocol.Position{Line: 1, Character: 10}, End: protocol.Position{Line: 1, Character: 18}}},
+		},
+		{
+			name:     "conditional",
+			document: "local f(x) = if x then { a: 1 } else { b: 2 };\nlocal v = f(true);\nv",
+			position: protocol.Position{Line: 2, Character: 0},
+			expected: []protocol.Range{
+				{Start: protocol.Position{Line: 0, Character: 23}, End: protocol.Position{Line: 0, Character: 31}},
+				{Start: protocol.Position{Line: 0, Character: 37}, End: protocol.Position{Line: 0, Character: 45}},
+			},
+		},
+		{
+			name:     "value that isn't an object",
+			document: "local n = 1;\nn",
+			position: protocol.Position{Line: 1, Character: 0},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			libFile := filepath.Join(dir, "lib.libsonnet")
+			require.NoError(t, os.WriteFile(libFile, []byte(lib), 0o600))
+			file := filepath.Join(dir, "main.jsonnet")
+			require.NoError(t, os.WriteFile(file, []byte(tc.document), 0o600))
+
+			server := testServer(t, nil)
+			uri := serverOpenTestFile(t, server, file)
+
+			result, err := server.TypeDefinition(context.Background(), &protocol.TypeDefinitionParams{
+				TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+					TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+					Position:     tc.position,
+				},
+			})
+			require.NoError(t, err)
+
+			var expected protocol.Definition
+			for _, r := range tc.expected {
+				expectedURI := uri
+				if tc.inLib {
+					expectedURI = protocol.URIFromPath(libFile)
+				}
+				expected = append(expected, protocol.Location{URI: expectedURI, Range: r})
+			}
+			assert.Equal(t, expected, result)
+		})
+	}
+}
@@ -0,0 +1,447 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/go-jsonnet/ast"
+	"github.com/grafana/jsonnet-language-server/pkg/ast/processing"
+	"github.com/grafana/jsonnet-language-server/pkg/nodestack"
+)
+
+const (
+	// maxInferenceDepth limits how deep the inference follows locals, imports and nested values.
+	maxInferenceDepth = 10
+	// maxInferenceSteps limits the number of nodes whose type is inferred, for large libraries.
+	maxInferenceSteps = 10000
+)
+
+// inferredType is the type of a value, inferred from the AST without evaluating it.
+// An empty kind means that the type is unknown.
+type inferredType struct {
+	kind string
+
+	// fields are the fields of an object, nil if they can't be known
+	fields []inferredField
+	// elements is the type of the elements of an array
+	elements *inferredType
+	// params and result describe a function
+	params []string
+	result *inferredType
+	// union is the list of the possible types, when there are more than one
+	union []*inferredType
+}
+
+type inferredField struct {
+	name   string
+	hidden bool
+	typ    *inferredType
+}
+
+var unknownType = &inferredType{}
+
+func (t *inferredType) known() bool {
+	return t.kind != "" || len(t.union) > 0
+}
+
+func (t *inferredType) String() string {
+	return t.format(0)
+}
+
+func (t *inferredType) format(depth int) string {
+	switch {
+	case len(t.union) > 0:
+		types := make([]string, len(t.union))
+		for i, u := range t.union {
+			types[i] = u.format(depth)
+		}
+		return strings.Join(types, " | ")
+	case t.kind == "":
+		return "any"
+	case t.kind == "object" && t.fields != nil && depth < 2:
+		if len(t.fields) == 0 {
+			return "{}"
+		}
+		fields := make([]string, 0, len(t.fields))
+		for i, field := range t.fields {
+			if i == 10 {
+				fields = append(fields, "...")
+				break
+			}
+			separator := ":"
+			if field.hidden {
+				separator = "::"
+			}
+			fields = append(fields, fmt.Sprintf("%s%s %s", field.name, separator, field.typ.format(depth+1)))
+		}
+		return "{ " + strings.Join(fields, ", ") + " }"
+	case t.kind == "array" && t.elements != nil:
+		return "array<" + t.elements.format(depth+1) + ">"
+	case t.kind == "function" && t.params != nil:
+		signature := "function(" + strings.Join(t.params, ", ") + ")"
+		if t.result != nil && t.result.known() {
+			signature += ": " + t.result.format(depth+1)
+		}
+		return signature
+	}
+	return t.kind
+}
+
+// unionType returns the type that can be any of the types. It is unknown if one of them is unknown.
+func unionType(types ...*inferredType) *inferredType {
+	var union []*inferredType
+	seen := map[string]bool{}
+	for _, t := range types {
+		members := t.union
+		if len(members) == 0 {
+			members = []*inferredType{t}
+		}
+		for _, member := range members {
+			if member.kind == "" {
+				return unknownType
+			}
+			if key := member.String(); !seen[key] {
+				seen[key] = true
+				union = append(union, member)
+			}
+		}
+	}
+	switch len(union) {
+	case 0:
+		return unknownType
+	case 1:
+		return union[0]
+	}
+	sort.SliceStable(union, func(i, j int) bool { return union[i].kind < union[j].kind })
+	return &inferredType{union: union}
+}
+
+// stdResultTypes are the types returned by the most common std functions.
+var stdResultTypes = map[string]*inferredType{
+	"abs": {kind: "number"}, "ceil": {kind: "number"}, "floor": {kind: "number"}, "length": {kind: "number"},
+	"parseInt": {kind: "number"}, "pow": {kind: "number"}, "codepoint": {kind: "number"},
+	"asciiLower": {kind: "string"}, "asciiUpper": {kind: "string"}, "format": {kind: "string"},
+	"manifestJson": {kind: "string"}, "manifestJsonEx": {kind: "string"}, "manifestYamlDoc": {kind: "string"},
+	"md5": {kind: "string"}, "strReplace": {kind: "string"}, "substr": {kind: "string"}, "toString": {kind: "string"},
+	"endsWith": {kind: "boolean"}, "equals": {kind: "boolean"}, "isArray": {kind: "boolean"}, "isBoolean": {kind: "boolean"},
+	"isFunction": {kind: "boolean"}, "isNumber": {kind: "boolean"}, "isObject": {kind: "boolean"}, "isString": {kind: "boolean"},
+	"member": {kind: "boolean"}, "objectHas": {kind: "boolean"}, "objectHasAll": {kind: "boolean"}, "startsWith": {kind: "boolean"},
+	"objectFields": {kind: "array", elements: &inferredType{kind: "string"}}, "objectFieldsAll": {kind: "array", elements: &inferredType{kind: "string"}},
+	"split": {kind: "array", elements: &inferredType{kind: "string"}}, "range": {kind: "array", elements: &inferredType{kind: "number"}},
+	"filter": {kind: "array"}, "flatMap": {kind: "array"}, "map": {kind: "array"}, "reverse": {kind: "array"}, "sort": {kind: "array"}, "uniq": {kind: "array"},
+	"mergePatch": {kind: "object"},
+}
+
+// inferType infers the type of a node, with the variables in scope at that node.
+func (c *typeChecker) inferType(node ast.Node, scope varScope, depth int) *inferredType {
+	c.inferenceSteps++
+	if node == nil || depth > maxInferenceDepth || c.inferenceSteps > maxInferenceSteps {
+		return unknownType
+	}
+
+	switch node := node.(type) {
+	case *ast.LiteralString, *ast.ImportStr:
+		return &inferredType{kind: "string"}
+	case *ast.LiteralNumber:
+		return &inferredType{kind: "number"}
+	case *ast.LiteralBoolean:
+		return &inferredType{kind: "boolean"}
+	case *ast.LiteralNull:
+		return &inferredType{kind: "null"}
+	case *ast.ImportBin:
+		return &inferredType{kind: "array", elements: &inferredType{kind: "number"}}
+	case *ast.Array:
+		t := &inferredType{kind: "array"}
+		if len(node.Elements) > 0 {
+			elements := make([]*inferredType, len(node.Elements))
+			for i, element := range node.Elements {
+				elements[i] = c.inferType(element.Expr, scope, depth+1)
+			}
+			if elementsType := unionType(elements...); elementsType.known() {
+				t.elements = elementsType
+			}
+		}
+		return t
+	case *ast.DesugaredObject:
+		return c.inferObjectType(node, scope, depth)
+	case *ast.Function:
+		params := map[ast.Identifier]ast.Node{}
+		t := &inferredType{kind: "function", params: []string{}}
+		for _, param := range node.Parameters {
+			params[param.Name] = nil
+			t.params = append(t.params, string(param.Name))
+		}
+		t.result = c.inferType(node.Body, scope.with(params), depth+1)
+		return t
+	case *ast.Local:
+		binds := map[ast.Identifier]ast.Node{}
+		for _, bind := range node.Binds {
+			binds[bind.Variable] = bind.Body
+		}
+		return c.inferType(node.Body, scope.with(binds), depth+1)
+	case *ast.Var:
+		return c.inferType(scope[node.Id], scope, depth+1)
+	case *ast.Self:
+		return c.inferType(scope["self"], scope, depth+1)
+	case *ast.Conditional:
+		return unionType(c.inferType(node.BranchTrue, scope, depth+1), c.inferType(node.BranchFalse, scope, depth+1))
+	case *ast.Unary:
+		if node.Op == ast.UopNot {
+			return &inferredType{kind: "boolean"}
+		}
+		return &inferredType{kind: "number"}
+	case *ast.Binary:
+		return c.inferBinaryType(node, scope, depth)
+	case *ast.Index:
+		return c.inferIndexType(node, scope, depth)
+	case *ast.Apply:
+		return c.inferApplyType(node, scope, depth)
+	case *ast.Import:
+		importedFrom := node.LocRange.FileName
+		if importedFrom == "" {
+			importedFrom = c.filename
+		}
+		root, _, err := c.vm.ImportAST(importedFrom, node.File.Value)
+		if err != nil {
+			return unknownType
+		}
+		return c.inferType(root, varScope{}, depth+1)
+	}
+	return unknownType
+}
+
+func (c *typeChecker) inferObjectType(node *ast.DesugaredObject, scope varScope, depth int) *inferredType {
+	binds := map[ast.Identifier]ast.Node{"self": node}
+	for _, bind := range node.Locals {
+		binds[bind.Variable] = bind.Body
+	}
+	scope = scope.with(binds)
+
+	t := &inferredType{kind: "object", fields: []inferredField{}}
+	for _, field := range node.Fields {
+		name, ok := field.Name.(*ast.LiteralString)
+		if !ok {
+			// The fields can't be known without evaluating the object
+			return &inferredType{kind: "object"}
+		}
+		fieldType := unknownType
+		if !field.PlusSuper {
+			fieldType = c.inferType(field.Body, scope, depth+1)
+		}
+		t.fields = append(t.fields, inferredField{name: name.Value, hidden: field.Hide == ast.ObjectFieldHidden, typ: fieldType})
+	}
+	return t
+}
+
+func (c *typeChecker) inferBinaryType(node *ast.Binary, scope varScope, depth int) *inferredType {
+	switch node.Op {
+	case ast.BopAnd, ast.BopOr, ast.BopGreater, ast.BopGreaterEq, ast.BopLess, ast.BopLessEq:
+		return &inferredType{kind: "boolean"}
+	case ast.BopMult, ast.BopDiv, ast.BopMinus, ast.BopShiftL, ast.BopShiftR, ast.BopBitwiseAnd, ast.BopBitwiseOr, ast.BopBitwiseXor:
+		return &inferredType{kind: "number"}
+	case ast.BopPlus:
+		left, right := c.inferType(node.Left, scope, depth+1), c.inferType(node.Right, scope, depth+1)
+		switch {
+		case left.kind == "string" || right.kind == "string":
+			return &inferredType{kind: "string"}
+		case left.kind == "number" && right.kind == "number":
+			return left
+		case left.kind == "array" && right.kind == "array":
+			t := &inferredType{kind: "array"}
+			if left.elements != nil && right.elements != nil {
+				t.elements = unionType(left.elements, right.elements)
+			}
+			return t
+		case left.kind == "object" && right.kind == "object":
+			return mergeObjectTypes(left, right)
+		}
+	}
+	return unknownType
+}
+
+// mergeObjectTypes returns the type of `left + right`, where the fields of right override the fields of left.
+func mergeObjectTypes(left, right *inferredType) *inferredType {
+	if left.fields == nil || right.fields == nil {
+		return &inferredType{kind: "object"}
+	}
+	t := &inferredType{kind: "object", fields: []inferredField{}}
+	overridden := map[string]inferredField{}
+	for _, field := range right.fields {
+		overridden[field.name] = field
+	}
+	for _, field := range left.fields {
+		if override, ok := overridden[field.name]; ok {
+			if !override.typ.known() {
+				// `field+:` extends the inherited field
+				override.typ = field.typ
+			}
+			field = override
+			delete(overridden, field.name)
+		}
+		t.fields = append(t.fields, field)
+	}
+	for _, field := range right.fields {
+		if _, ok := overridden[field.name]; ok {
+			t.fields = append(t.fields, field)
+		}
+	}
+	return t
+}
+
+func (c *typeChecker) inferIndexType(node *ast.Index, scope varScope, depth int) *inferredType {
+	// Only infer the type of the indexed field when the object is known, fields often refer to each other through self
+	if object, objectScope := objectNode(node.Target, scope); object != nil {
+		if name, ok := node.Index.(*ast.LiteralString); ok {
+			for _, field := range object.Fields {
+				if fieldName, ok := field.Name.(*ast.LiteralString); ok && fieldName.Value == name.Value && !field.PlusSuper {
+					binds := map[ast.Identifier]ast.Node{"self": object}
+					for _, bind := range object.Locals {
+						binds[bind.Variable] = bind.Body
+					}
+					return c.inferType(field.Body, objectScope.with(binds), depth+1)
+				}
+			}
+		}
+	}
+
+	target := c.inferType(node.Target, scope, depth+1)
+	switch target.kind {
+	case "object":
+		name, ok := node.Index.(*ast.LiteralString)
+		if !ok {
+			return unknownType
+		}
+		for _, field := range target.fields {
+			if field.name == name.Value {
+				return field.typ
+			}
+		}
+	case "array":
+		if target.elements != nil {
+			return target.elements
+		}
+	case "string":
+		return target
+	}
+	return unknownType
+}
+
+func (c *typeChecker) inferApplyType(node *ast.Apply, scope varScope, depth int) *inferredType {
+	if name, args, ok := stdCall(node); ok {
+		if t, ok := stdResultTypes[name]; ok {
+			return t
+		}
+		if name == "mod" && len(args) == 2 {
+			// `a % b` formats a string, or is the modulo of two numbers
+			if c.inferType(args[0], scope, depth+1).kind == "string" {
+				return &inferredType{kind: "string"}
+			}
+			return &inferredType{kind: "number"}
+		}
+		return unknownType
+	}
+
+	if _, _, annotations := c.annotatedFunction(node.Target, scope); annotations != nil && annotationTypes[annotations.returns] && annotations.returns != "any" {
+		return &inferredType{kind: annotations.returns}
+	}
+	if fn := c.inferType(node.Target, scope, depth+1); fn.kind == "function" && fn.result != nil {
+		return fn.result
+	}
+	return unknownType
+}
+
+// objectNode returns the object literal that a variable or self refers to.
+func objectNode(node ast.Node, scope varScope) (*ast.DesugaredObject, varScope) {
+	for i := 0; i < maxInferenceDepth; i++ {
+		switch n := node.(type) {
+		case *ast.Var:
+			node = scope[n.Id]
+		case *ast.Self:
+			node = scope["self"]
+		case *ast.DesugaredObject:
+			return n, scope
+		default:
+			return nil, nil
+		}
+	}
+	return nil, nil
+}
+
+// hoverType returns the inferred type of the symbol under the cursor: a variable, an index, or the name of a local or a field.
+func (s *Server) hoverType(ctx context.Context, doc *document, stack *nodestack.NodeStack, pos ast.Location) *inferredType {
+	if doc.ast == nil || len(doc.linesChangedSinceAST) > 0 || stack.IsEmpty() {
+		return nil
+	}
+
+	filename := doc.item.URI.SpanURI().Filename()
+	checker := &typeChecker{
+		server:   s,
+		vm:       s.getCancellableVM(ctx, filename),
+		filename: filename,
+		lines:    map[string][]string{},
+	}
+
+	node, scope := valueAtPosition(doc.ast, stack, pos)
+	if node == nil {
+		return nil
+	}
+
+	if t := checker.inferType(node, scope, 0); t.known() {
+		return t
+	}
+	return nil
+}
+
+// valueAtPosition returns the node of the value under the cursor, with the variables in its scope:
+// a variable, an index, self, or the body of the local or field whose name is under the cursor.
+func valueAtPosition(root ast.Node, stack *nodestack.NodeStack, pos ast.Location) (ast.Node, varScope) {
+	node := stack.Peek()
+	var scope varScope
+	walkWithScope(root, varScope{}, func(n ast.Node, nodeScope varScope) {
+		if n == node {
+			scope = nodeScope
+		}
+	})
+	if scope == nil {
+		return nil, nil
+	}
+
+	switch node := node.(type) {
+	case *ast.Var, *ast.Index, *ast.Self:
+		return node, scope
+	case *ast.Local:
+		binds := map[ast.Identifier]ast.Node{}
+		for _, bind := range node.Binds {
+			binds[bind.Variable] = bind.Body
+		}
+		for _, bind := range node.Binds {
+			if inRange(pos, processing.LocalBindToRange(bind).SelectionRange) {
+				return bind.Body, scope.with(binds)
+			}
+		}
+	case *ast.DesugaredObject:
+		binds := map[ast.Identifier]ast.Node{"self": node}
+		for _, bind := range node.Locals {
+			binds[bind.Variable] = bind.Body
+		}
+		for _, field := range node.Fields {
+			if inRange(pos, processing.FieldToRange(field).SelectionRange) {
+				return field.Body, scope.with(binds)
+			}
+		}
+	}
+	return nil, nil
+}
+
+func inRange(pos ast.Location, r ast.LocationRange) bool {
+	afterBegin := pos.Line > r.Begin.Line || (pos.Line == r.Begin.Line && pos.Column >= r.Begin.Column)
+	beforeEnd := pos.Line < r.End.Line || (pos.Line == r.End.Line && pos.Column <= r.End.Column)
+	return afterBegin && beforeEnd
+}
+
+// typeHoverContent is shown at the top of the hover.
+func typeHoverContent(t *inferredType) string {
+	return fmt.Sprintf("Type: `%s`\n\n", t)
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHoverInferredType(t *testing.T) {
+	testCases := []struct {
+		name     string
+		document string
+		position protocol.Position
+		expected string
+	}{
+		{
+			name:     "local name",
+			document: "local replicas = 3;\nreplicas",
+			position: protocol.Position{Line: 0, Character: 8},
+			expected: "number",
+		},
+		{
+			name:     "variable",
+			document: "local obj = { a: 'a', b:: [1, 2], c: null };\nobj",
+			position: protocol.Position{Line: 1, Character: 1},
+			expected: "{ a: string, b:: array<number>, c: null }",
+		},
+		{
+			name:     "field name",
+			document: "{\n  names: ['a', 1, true],\n}",
+			position: protocol.Position{Line: 1, Character: 3},
+			expected: "array<boolean | number | string>",
+		},
+		{
+			name:     "function",
+			document: "local f(a, b) = { sum: a + b, count: std.length(a) };\nf",
+			position: protocol.Position{Line: 1, Character: 0},
+			expected: "function(a, b): { sum: any, count: number }",
+		},
+		{
+			name:     "union",
+			document: "local f(a) = if a then 'yes' else null;\nf(true)",
+			position: protocol.Position{Line: 1, Character: 0},
+			expected: "function(a): null | string",
+		},
+		{
+			name:     "self",
+			document: "{\n  a: 1,\n  b: self.a + 1,\n  c: self.b > 1,\n}",
+			position: protocol.Position{Line: 3, Character: 3},
+			expected: "boolean",
+		},
+		{
+			name:     "merged objects",
+			document: "local base = { a: 1, b: 'b' };\nlocal obj = base + { b: 2, c: true };\nobj",
+			position: protocol.Position{Line: 2, Character: 1},
+			expected: "{ a: number, b: number, c: boolean }",
+		},
+		{
+			name:     "import",
+			document: "local lib = import 'lib.libsonnet';\nlib.new",
+			position: protocol.Position{Line: 1, Character: 6},
+			expected: "function(name): { name: any }",
+		},
+		{
+			name:     "format string",
+			document: "local s = '%s' % ['a'];\ns",
+			position: protocol.Position{Line: 1, Character: 0},
+			expected: "string",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "lib.libsonnet"), []byte("{ new(name):: { name: name } }"), 0o600))
+			file := filepath.Join(dir, "main.jsonnet")
+			require.NoError(t, os.WriteFile(file, []byte(tc.document), 0o600))
+
+			server := testServer(t, nil)
+			uri := serverOpenTestFile(t, server, file)
+
+			hover, err := server.Hover(context.Background(), &protocol.HoverParams{
+				TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+					TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+					Position:     tc.position,
+				},
+			})
+			require.NoError(t, err)
+			require.NotNil(t, hover)
+			assert.Contains(t, hover.Contents.Value, "Type: `"+tc.expected+"`\n\n")
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-jsonnet/ast"
+	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+)
+
+// unresolvedImportMessage starts the linter's warnings on the imports that don't resolve.
+const unresolvedImportMessage = "couldn't open import "
+
+// unresolvedImportCodeActions offers to create the files of the imports that the linter reports as unresolved, next
+// to the importing file. An imported Jsonnet file is created with an empty object, or with a function stub that takes
+// the arguments that the import is called with.
+func (s *Server) unresolvedImportCodeActions(doc *document, diags []protocol.Diagnostic) []protocol.CodeAction {
+	if doc.ast == nil || len(doc.linesChangedSinceAST) > 0 {
+		return nil
+	}
+
+	var actions []protocol.CodeAction
+	for _, diag := range diags {
+		if diag.Source != "lint" || !strings.HasPrefix(diag.Message, unresolvedImportMessage) {
+			continue
+		}
+		walk(doc.ast, func(node ast.Node) {
+			var literal *ast.LiteralString
+			switch node := node.(type) {
+			case *ast.Import:
+				literal = node.File
+			case *ast.ImportStr:
+				literal = node.File
+			case *ast.ImportBin:
+				literal = node.File
+			default:
+				return
+			}
+			if position.RangeASTToProtocol(*node.Loc()) != diag.Range || literal.Value == "" || filepath.IsAbs(literal.Value) {
+				return
+			}
+			path := filepath.Join(filepath.Dir(doc.item.URI.SpanURI().Filename()), filepath.FromSlash(literal.Value))
+			if _, err := os.Stat(path); err == nil {
+				return
+			}
+			if _, ok := node.(*ast.Import); !ok {
+				actions = append(actions, createFileCodeAction(diag, fmt.Sprintf("Create %s", literal.Value), path, ""))
+				return
+			}
+			object := createFileCodeAction(diag, fmt.Sprintf("Create %s with an empty object", literal.Value), path, "{}\n")
+			params, called := importCallParams(doc.ast, node)
+			function := createFileCodeAction(diag, fmt.Sprintf("Create %s with a function", literal.Value), path,
+				fmt.Sprintf("function(%s) {}\n", strings.Join(params, ", ")))
+			if called {
+				function.IsPreferred = true
+				actions = append(actions, function, object)
+			} else {
+				actions = append(actions, object, function)
+			}
+		})
+	}
+	return actions
+}
+
+// importCallParams returns the parameters of a function that the import is called with, named after the named
+// arguments, and whether the import is called.
+func importCallParams(root, imported ast.Node) ([]string, bool) {
+	var params []string
+	called := false
+	walk(root, func(node ast.Node) {
+		apply, ok := node.(*ast.Apply)
+		if !ok || called || stripParens(apply.Target) != imported {
+			return
+		}
+		called = true
+		for i := range apply.Arguments.Positional {
+			params = append(params, fmt.Sprintf("arg%d", i+1))
+		}
+		for _, arg := range apply.Arguments.Named {
+			params = append(params, string(arg.Name))
+		}
+	})
+	return params, called
+}
+
+// stripParens returns the expression in parentheses.
+func stripParens(node ast.Node) ast.Node {
+	for {
+		parens, ok := node.(*ast.Parens)
+		if !ok {
+			return node
+		}
+		node = parens.Inner
+	}
+}
+
+func createFileCodeAction(diag protocol.Diagnostic, title, path, content string) protocol.CodeAction {
+	pathArg, _ := json.Marshal(path)
+	contentArg, _ := json.Marshal(content)
+	return protocol.CodeAction{
+		Title:       title,
+		Kind:        protocol.QuickFix,
+		Diagnostics: []protocol.Diagnostic{diag},
+		// The protocol's workspace edits can't create files, the command asks the client to apply one that does
+		Command: &protocol.Command{
+			Title:     title,
+			Command:   "jsonnet.createFile",
+			Arguments: []json.RawMessage{pathArg, contentArg},
+		},
+	}
+}
+
+// createFile creates a file with its content, in a single workspace edit that the client applies, or with the
+// fallback edit for the clients that can't. The arguments are the file's name and content.
+func (s *Server) createFile(ctx context.Context, params *protocol.ExecuteCommandParams) (interface{}, error) {
+	args := params.Arguments
+	if len(args) != 2 {
+		return nil, fmt.Errorf("expected 2 arguments, got %d", len(args))
+	}
+
+	var fileName, content string
+	if err := json.Unmarshal(args[0], &fileName); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal file name: %v", err)
+	}
+	if err := json.Unmarshal(args[1], &content); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal content: %v", err)
+	}
+	if !filepath.IsAbs(fileName) {
+		return nil, fmt.Errorf("expected an absolute file name, got %s", fileName)
+	}
+	if _, err := os.Stat(fileName); err == nil {
+		return nil, fmt.Errorf("%s already exists", fileName)
+	}
+
+	uri := protocol.URIFromPath(fileName)
+	changes := []interface{}{protocol.CreateFile{Kind: "create", URI: uri}}
+	if content != "" {
+		changes = append(changes, s.textDocumentEdit(uri, []protocol.TextEdit{{NewText: content}}))
+	}
+	return nil, s.applyResourceEdit(ctx, fmt.Sprintf("Create %s", filepath.Base(fileName)), changes, nil)
+}
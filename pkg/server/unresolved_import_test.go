@@ -0,0 +1,134 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnresolvedImportCodeActions(t *testing.T) {
+	testCases := []struct {
+		name     string
+		document string
+		expected map[string]string
+	}{
+		{
+			name:     "import",
+			document: "local lib = import 'lib/missing.libsonnet';\nlib\n",
+			expected: map[string]string{
+				"Create lib/missing.libsonnet with an empty object": "{}\n",
+				"Create lib/missing.libsonnet with a function":      "function() {}\n",
+			},
+		},
+		{
+			name:     "called import",
+			document: "(import 'missing.libsonnet')('a', replicas=3)\n",
+			expected: map[string]string{
+				"Create missing.libsonnet with a function":      "function(arg1, replicas) {}\n",
+				"Create missing.libsonnet with an empty object": "{}\n",
+			},
+		},
+		{
+			name:     "importstr",
+			document: "importstr 'data.txt'\n",
+			expected: map[string]string{
+				"Create data.txt": "",
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			root := writeProjectFiles(t, map[string]string{"main.jsonnet": tc.document})
+			s := renameTestServer(t, root, &applyingCaller{applied: true})
+			uri := serverOpenTestFile(t, s, filepath.Join(root, "main.jsonnet"))
+			doc, err := s.cache.get(uri)
+			require.NoError(t, err)
+
+			var diags []protocol.Diagnostic
+			for _, diag := range s.getLintDiags(context.Background(), doc) {
+				if strings.HasPrefix(diag.Message, unresolvedImportMessage) {
+					diags = append(diags, diag)
+				}
+			}
+			require.Len(t, diags, 1)
+
+			actions, err := s.CodeAction(context.Background(), &protocol.CodeActionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+				Context:      protocol.CodeActionContext{Diagnostics: diags},
+			})
+			require.NoError(t, err)
+			created := map[string]string{}
+			var createActions []protocol.CodeAction
+			for _, action := range actions {
+				if action.Command != nil && action.Command.Command == "jsonnet.createFile" {
+					createActions = append(createActions, action)
+				}
+			}
+			for i, action := range createActions {
+				require.Len(t, action.Command.Arguments, 2)
+				var content string
+				require.NoError(t, json.Unmarshal(action.Command.Arguments[1], &content))
+				created[action.Title] = content
+				// The preferred action comes first
+				assert.Equal(t, action.IsPreferred, i == 0 && tc.name == "called import")
+			}
+			assert.Equal(t, tc.expected, created)
+		})
+	}
+}
+
+func TestCreateFile(t *testing.T) {
+	root := writeProjectFiles(t, map[string]string{"existing.libsonnet": "{}"})
+	caller := &applyingCaller{applied: true}
+	s := renameTestServer(t, root, caller)
+
+	command := func(name, content string) *protocol.ExecuteCommandParams {
+		pathArg, err := json.Marshal(filepath.Join(root, name))
+		require.NoError(t, err)
+		contentArg, err := json.Marshal(content)
+		require.NoError(t, err)
+		return &protocol.ExecuteCommandParams{Command: "jsonnet.createFile", Arguments: []json.RawMessage{pathArg, contentArg}}
+	}
+
+	_, err := s.ExecuteCommand(context.Background(), command("lib/new.libsonnet", "{}\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "workspace/applyEdit", caller.method)
+	var params struct {
+		Label string `json:"label"`
+		Edit  struct {
+			DocumentChanges []json.RawMessage `json:"documentChanges"`
+		} `json:"edit"`
+	}
+	require.NoError(t, json.Unmarshal(caller.params, &params))
+	assert.Equal(t, "Create new.libsonnet", params.Label)
+	require.Len(t, params.Edit.DocumentChanges, 2)
+	var create protocol.CreateFile
+	require.NoError(t, json.Unmarshal(params.Edit.DocumentChanges[0], &create))
+	uri := protocol.URIFromPath(filepath.Join(root, "lib/new.libsonnet"))
+	assert.Equal(t, protocol.CreateFile{Kind: "create", URI: uri}, create)
+	var edit resourceTextDocumentEdit
+	require.NoError(t, json.Unmarshal(params.Edit.DocumentChanges[1], &edit))
+	assert.Equal(t, uri, edit.TextDocument.URI)
+	assert.Nil(t, edit.TextDocument.Version)
+	assert.Equal(t, "{}\n", applyTextEdits(t, "", edit.Edits))
+
+	_, err = s.ExecuteCommand(context.Background(), command("existing.libsonnet", "{}\n"))
+	assert.EqualError(t, err, filepath.Join(root, "existing.libsonnet")+" already exists")
+
+	// Without a client that creates files, the server creates it
+	s.resourceOperations = nil
+	caller.method = ""
+	_, err = s.ExecuteCommand(context.Background(), command("lib/other.libsonnet", "function() {}\n"))
+	require.NoError(t, err)
+	assert.Empty(t, caller.method)
+	content, err := os.ReadFile(filepath.Join(root, "lib/other.libsonnet"))
+	require.NoError(t, err)
+	assert.Equal(t, "function() {}\n", string(content))
+}
@@ -5,6 +5,8 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
 
 	"github.com/google/go-jsonnet/formatter"
@@ -52,6 +54,14 @@ func testServer(t *testing.T, stdlib []stdlib.Function) (server *Server) {
 	return server
 }
 
+// setConfiguration changes the configuration of a server, for the tests that set it directly rather than with
+// DidChangeConfiguration. The goroutines of the server may be reading it.
+func setConfiguration(s *Server, change func(*Configuration)) {
+	s.configMu.Lock()
+	defer s.configMu.Unlock()
+	change(&s.configuration)
+}
+
 func serverOpenTestFile(t require.TestingT, server *Server, filename string) protocol.DocumentURI {
 	fileContent, err := os.ReadFile(filename)
 	require.NoError(t, err)
@@ -83,3 +93,28 @@ func testServerWithFile(t *testing.T, stdlib []stdlib.Function, fileContent stri
 
 	return server, serverOpenTestFile(t, server, tmpFile.Name())
 }
+
+// applyTextEdits applies non-overlapping edits to a text. The positions are byte offsets in their line.
+func applyTextEdits(t *testing.T, text string, edits []protocol.TextEdit) string {
+	t.Helper()
+
+	offset := func(pos protocol.Position) int {
+		lines := strings.SplitAfter(text, "\n")
+		require.Less(t, int(pos.Line), len(lines))
+		o := 0
+		for _, line := range lines[:pos.Line] {
+			o += len(line)
+		}
+		return o + int(pos.Character)
+	}
+
+	sorted := append([]protocol.TextEdit(nil), edits...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return offset(sorted[i].Range.Start) > offset(sorted[j].Range.Start)
+	})
+	for _, edit := range sorted {
+		start, end := offset(edit.Range.Start), offset(edit.Range.End)
+		text = text[:start] + edit.NewText + text[end:]
+	}
+	return text
+}
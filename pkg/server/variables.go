@@ -0,0 +1,218 @@
+package server
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/google/go-jsonnet/ast"
+	"github.com/google/go-jsonnet/toolutils"
+	"github.com/grafana/jsonnet-language-server/pkg/ast/processing"
+)
+
+// variable is a variable of a document, bound by a local, a function parameter or the for of a comprehension, along
+// with the places that refer to it.
+type variable struct {
+	name ast.Identifier
+	// definition is the whole binding, selection is the name of the variable in it
+	definition ast.LocationRange
+	selection  ast.LocationRange
+	references []ast.LocationRange
+	// hides is the outer variable that has the same name, if there is one
+	hides *variable
+}
+
+// parseDocument parses a document, and locates the variables of its comprehensions.
+func parseDocument(filename, text string) (ast.Node, error) {
+	root, err := snippetToAST(filename, text)
+	if root != nil {
+		locateComprehensionVariables(root, text)
+	}
+	return root, err
+}
+
+// locateComprehensionVariables sets the locations of the variables of the comprehensions, the desugarer leaves them
+// out. Each `for x in arr` is desugared to `std.flatMap(function(x) ..., arr)`, and its `if` guards to a conditional in
+// the body of the function. The name of the variable is found in the text, before the `in` that precedes `arr`.
+func locateComprehensionVariables(root ast.Node, text string) {
+	lines := strings.Split(text, "\n")
+	walk(root, func(node ast.Node) {
+		name, args, ok := stdCall(node)
+		if !ok || name != "flatMap" || len(args) != 2 {
+			return
+		}
+		function, ok := args[0].(*ast.Function)
+		if !ok || len(function.Parameters) != 1 || function.Parameters[0].LocRange.Begin.IsSet() {
+			return
+		}
+		param := &function.Parameters[0]
+		if loc, ok := forVariableLoc(lines, *args[1].Loc(), string(param.Name)); ok {
+			param.LocRange = loc
+		}
+	})
+}
+
+// forVariableLoc finds the variable of `for <name> in <expr>`, going back from the start of the expression.
+func forVariableLoc(lines []string, expr ast.LocationRange, name string) (ast.LocationRange, bool) {
+	if !expr.Begin.IsSet() {
+		return ast.LocationRange{}, false
+	}
+	line, column := expr.Begin.Line-1, expr.Begin.Column-1
+	if line >= len(lines) || column > len(lines[line]) {
+		return ast.LocationRange{}, false
+	}
+
+	// back moves before the blanks (and the parentheses around the expression) and returns the text that precedes
+	back := func(skip string) string {
+		for {
+			for column > 0 && strings.ContainsRune(skip, rune(lines[line][column-1])) {
+				column--
+			}
+			if column > 0 || line == 0 {
+				return lines[line][:column]
+			}
+			line--
+			column = len(lines[line])
+		}
+	}
+
+	before := back(" \t\r(")
+	if !strings.HasSuffix(before, "in") || (len(before) > 2 && isIdentifierByte(before[len(before)-3])) {
+		return ast.LocationRange{}, false
+	}
+	column -= len("in")
+	before = back(" \t\r")
+	if !strings.HasSuffix(before, name) || (len(before) > len(name) && isIdentifierByte(before[len(before)-len(name)-1])) {
+		return ast.LocationRange{}, false
+	}
+	return ast.LocationRange{
+		FileName: expr.FileName,
+		Begin:    ast.Location{Line: line + 1, Column: column - len(name) + 1},
+		End:      ast.Location{Line: line + 1, Column: column + 1},
+	}, true
+}
+
+func isIdentifierByte(b byte) bool {
+	return b == '_' || ('a' <= b && b <= 'z') || ('A' <= b && b <= 'Z') || ('0' <= b && b <= '9')
+}
+
+// findVariables returns the variables of a document that have a location, with the variables that refer to them. The
+// scopes are resolved the way the evaluator does, the innermost binding of a name hides the others.
+func findVariables(root ast.Node) []*variable {
+	var variables []*variable
+	// bind adds the variable to the scope. The bindings without a location, such as `$`, hide the outer variables
+	// that have the same name, but can't be referred to.
+	bind := func(scope map[ast.Identifier]*variable, name ast.Identifier, definition, selection ast.LocationRange) {
+		if !selection.Begin.IsSet() {
+			scope[name] = nil
+			return
+		}
+		v := &variable{name: name, definition: definition, selection: selection, hides: scope[name]}
+		variables = append(variables, v)
+		scope[name] = v
+	}
+	bindLocals := func(scope map[ast.Identifier]*variable, binds ast.LocalBinds) map[ast.Identifier]*variable {
+		inner := copyVariableScope(scope)
+		for _, b := range binds {
+			objectRange := processing.LocalBindToRange(b)
+			bind(inner, b.Variable, objectRange.FullRange, withFileName(objectRange.SelectionRange, objectRange.Filename))
+		}
+		return inner
+	}
+
+	var visit func(node ast.Node, scope map[ast.Identifier]*variable)
+	visit = func(node ast.Node, scope map[ast.Identifier]*variable) {
+		if node == nil {
+			return
+		}
+		switch node := node.(type) {
+		case *ast.Var:
+			v := scope[node.Id]
+			if v == nil || !node.Loc().Begin.IsSet() {
+				return
+			}
+			// Desugaring can copy a node, such as the locals of an object comprehension
+			for _, ref := range v.references {
+				if ref == *node.Loc() {
+					return
+				}
+			}
+			v.references = append(v.references, *node.Loc())
+		case *ast.Local:
+			inner := bindLocals(scope, node.Binds)
+			for _, b := range node.Binds {
+				visit(b.Body, inner)
+			}
+			visit(node.Body, inner)
+		case *ast.Function:
+			inner := copyVariableScope(scope)
+			for _, param := range node.Parameters {
+				// The location of a parameter includes its default value
+				selection := param.LocRange
+				selection.End = ast.Location{Line: selection.Begin.Line, Column: selection.Begin.Column + len(param.Name)}
+				bind(inner, param.Name, param.LocRange, selection)
+			}
+			for _, param := range node.Parameters {
+				visit(param.DefaultArg, inner)
+			}
+			visit(node.Body, inner)
+		case *ast.DesugaredObject:
+			inner := bindLocals(scope, node.Locals)
+			for _, b := range node.Locals {
+				visit(b.Body, inner)
+			}
+			for _, field := range node.Fields {
+				// The names of the fields are evaluated outside of the object
+				visit(field.Name, scope)
+				visit(field.Body, inner)
+			}
+			for _, assert := range node.Asserts {
+				visit(assert, inner)
+			}
+		default:
+			for _, child := range toolutils.Children(node) {
+				visit(child, scope)
+			}
+		}
+	}
+	visit(root, map[ast.Identifier]*variable{})
+	for _, v := range variables {
+		sort.Slice(v.references, func(i, j int) bool {
+			a, b := v.references[i].Begin, v.references[j].Begin
+			return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+		})
+	}
+	return variables
+}
+
+func copyVariableScope(scope map[ast.Identifier]*variable) map[ast.Identifier]*variable {
+	inner := make(map[ast.Identifier]*variable, len(scope))
+	for name, v := range scope {
+		inner[name] = v
+	}
+	return inner
+}
+
+func withFileName(loc ast.LocationRange, filename string) ast.LocationRange {
+	loc.FileName = filename
+	return loc
+}
+
+// variableAt returns the variable whose name, or one of the references to it, is at the position.
+func variableAt(root ast.Node, pos ast.Location) *variable {
+	for _, v := range findVariables(root) {
+		if inIdentifier(pos, v.selection) {
+			return v
+		}
+		for _, ref := range v.references {
+			if inIdentifier(pos, ref) {
+				return v
+			}
+		}
+	}
+	return nil
+}
+
+// inIdentifier is processing.InRange, except that the position right after the identifier is in it too.
+func inIdentifier(pos ast.Location, loc ast.LocationRange) bool {
+	return processing.InRange(pos, loc) || (pos.Line == loc.End.Line && pos.Column == loc.End.Column)
+}
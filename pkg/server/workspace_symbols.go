@@ -0,0 +1,245 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/jdbaldry/go-language-server-protocol/jsonrpc2"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// Symbol finds the top-level binds and fields of the Jsonnet files of the workspace whose names match the query. The
+// files are searched one by one: with a partial result token, each file's symbols are streamed to the client as they
+// are found and the response is empty, and with a work done token, the search reports how many files are searched.
+func (s *Server) Symbol(ctx context.Context, params *protocol.WorkspaceSymbolParams) ([]protocol.SymbolInformation, error) {
+	if s.workspaceFolder == "" {
+		return []protocol.SymbolInformation{}, nil
+	}
+	query, err := parseSymbolQuery(params.Query)
+	if err != nil {
+		return nil, err
+	}
+
+	workspaceFiles, err := s.workspaceJsonnetFiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, path := range workspaceFiles {
+		if rel, err := filepath.Rel(s.workspaceFolder, path); err == nil && query.matchesPath(filepath.ToSlash(rel)) {
+			files = append(files, path)
+		}
+	}
+
+	progress := s.startProgress(ctx, params.WorkDoneToken, "Searching the workspace symbols")
+	symbols := []protocol.SymbolInformation{}
+	for i, path := range files {
+		if ctx.Err() != nil {
+			progress.end("Cancelled")
+			return nil, ctx.Err()
+		}
+		found := s.fileSymbols(path, query)
+		if params.PartialResultToken != nil {
+			if len(found) > 0 {
+				s.sendPartialResult(ctx, params.PartialResultToken, found)
+			}
+		} else {
+			symbols = append(symbols, found...)
+		}
+		progress.report(fmt.Sprintf("%d/%d files", i+1, len(files)), uint32((i+1)*100/len(files)))
+	}
+	progress.end("")
+	return symbols, nil
+}
+
+// workspaceJsonnetFiles lists the Jsonnet files of the workspace, without the hidden and vendored ones.
+func (s *Server) workspaceJsonnetFiles(ctx context.Context) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(s.workspaceFolder, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if entry.IsDir() {
+			if path != s.workspaceFolder && (strings.HasPrefix(entry.Name(), ".") || entry.Name() == "vendor") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if ext := filepath.Ext(path); ext == ".jsonnet" || ext == ".libsonnet" {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, ctx.Err()) {
+		return nil, fmt.Errorf("failed to list the files of the workspace: %w", err)
+	}
+	return files, ctx.Err()
+}
+
+// fileSymbols returns the symbols of a file that match the query, with the open document's text if it is open. The
+// nested symbols give the name of the symbol that contains them.
+func (s *Server) fileSymbols(path string, query symbolQuery) []protocol.SymbolInformation {
+	root, err := parseDocument(path, s.readWorkspaceFile(path))
+	if root == nil {
+		log.Debugf("Symbol: failed to parse %s: %v", path, err)
+		return nil
+	}
+
+	uri := protocol.URIFromPath(path)
+	var symbols []protocol.SymbolInformation
+	var add func(symbol protocol.DocumentSymbol, container string)
+	add = func(symbol protocol.DocumentSymbol, container string) {
+		if query.matches(symbol) {
+			symbols = append(symbols, protocol.SymbolInformation{
+				Name:          symbol.Name,
+				Kind:          symbol.Kind,
+				Location:      protocol.Location{URI: uri, Range: symbol.SelectionRange},
+				ContainerName: container,
+			})
+		}
+		for _, child := range symbol.Children {
+			add(child, symbol.Name)
+		}
+	}
+	for _, symbol := range buildDocumentSymbols(root) {
+		add(symbol, "")
+	}
+	return symbols
+}
+
+// symbolQuery is a workspace symbols query: the words of the names to search for, and the filters of the symbols. The
+// `kind:` filters keep the symbols of the given kinds, `function`, `field` or `local`, separated by commas, and the
+// `path:` filters keep the files whose paths, relative to the workspace folder, start with one of the prefixes. For
+// example, `kind:function path:lib/ new` searches the functions named like new in the files of the lib directory.
+type symbolQuery struct {
+	name  string
+	kinds map[string]bool
+	paths []string
+}
+
+// symbolKinds are the kinds of the kind: filter.
+var symbolKinds = []string{"function", "field", "local"}
+
+func parseSymbolQuery(query string) (symbolQuery, error) {
+	var parsed symbolQuery
+	var words []string
+	for _, word := range strings.Fields(query) {
+		switch {
+		case strings.HasPrefix(word, "kind:"):
+			if parsed.kinds == nil {
+				parsed.kinds = map[string]bool{}
+			}
+			for _, kind := range strings.Split(strings.TrimPrefix(word, "kind:"), ",") {
+				if !contains(symbolKinds, kind) {
+					return symbolQuery{}, fmt.Errorf("%w: unknown symbol kind %q, expected one of %s", jsonrpc2.ErrInvalidParams, kind, strings.Join(symbolKinds, ", "))
+				}
+				parsed.kinds[kind] = true
+			}
+		case strings.HasPrefix(word, "path:"):
+			parsed.paths = append(parsed.paths, strings.TrimPrefix(strings.TrimPrefix(word, "path:"), "./"))
+		default:
+			words = append(words, word)
+		}
+	}
+	parsed.name = strings.Join(words, "")
+	return parsed, nil
+}
+
+// matchesPath tells whether a file, by its slash separated path relative to the workspace folder, is searched.
+func (q symbolQuery) matchesPath(rel string) bool {
+	if len(q.paths) == 0 {
+		return true
+	}
+	for _, prefix := range q.paths {
+		if strings.HasPrefix(rel, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches tells whether a symbol has one of the kinds of the query, and a name that matches it.
+func (q symbolQuery) matches(symbol protocol.DocumentSymbol) bool {
+	if q.kinds != nil && !q.kinds[symbolKind(symbol)] {
+		return false
+	}
+	return matchesSymbolQuery(symbol.Name, q.name)
+}
+
+// symbolKind returns the kind of a document symbol for the kind: filter: the locals and fields whose values are
+// functions are functions.
+func symbolKind(symbol protocol.DocumentSymbol) string {
+	switch {
+	case strings.HasPrefix(symbol.Detail, "Function("):
+		return "function"
+	case symbol.Kind == protocol.Variable:
+		return "local"
+	default:
+		return "field"
+	}
+}
+
+// matchesSymbolQuery tells whether the query's characters come in the name in order, ignoring their case. Clients
+// filter the symbols further, the empty query matches them all.
+func matchesSymbolQuery(name, query string) bool {
+	queried := []rune(query)
+	for _, r := range name {
+		if len(queried) == 0 {
+			break
+		}
+		if unicode.ToLower(r) == unicode.ToLower(queried[0]) {
+			queried = queried[1:]
+		}
+	}
+	return len(queried) == 0
+}
+
+// sendPartialResult sends a part of a request's result to the client, with the request's partial result token.
+func (s *Server) sendPartialResult(ctx context.Context, token protocol.ProgressToken, value interface{}) {
+	if s.client == nil {
+		return
+	}
+	if err := s.client.Progress(ctx, &protocol.ProgressParams{Token: token, Value: value}); err != nil {
+		log.WithContext(ctx).Errorf("failed to send a partial result: %v", err)
+	}
+}
+
+// workDoneProgress reports the progress of a request to the client, with the request's work done token. Without a
+// token, nothing is reported.
+type workDoneProgress struct {
+	ctx    context.Context
+	client protocol.Client
+	token  protocol.ProgressToken
+}
+
+func (s *Server) startProgress(ctx context.Context, token protocol.ProgressToken, title string) *workDoneProgress {
+	progress := &workDoneProgress{ctx: ctx, client: s.client, token: token}
+	progress.send(&protocol.WorkDoneProgressBegin{Kind: "begin", Title: title, Percentage: 0})
+	return progress
+}
+
+func (p *workDoneProgress) report(message string, percentage uint32) {
+	p.send(&protocol.WorkDoneProgressReport{Kind: "report", Message: message, Percentage: percentage})
+}
+
+func (p *workDoneProgress) end(message string) {
+	p.send(&protocol.WorkDoneProgressEnd{Kind: "end", Message: message})
+}
+
+func (p *workDoneProgress) send(value interface{}) {
+	if p.token == nil || p.client == nil {
+		return
+	}
+	if err := p.client.Progress(p.ctx, &protocol.ProgressParams{Token: p.token, Value: value}); err != nil {
+		log.WithContext(p.ctx).Errorf("failed to report the progress: %v", err)
+	}
+}
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var workspaceSymbolFiles = map[string]string{
+	"main.jsonnet":          "local helper = 1;\n{\n  deployment: {\n    replicas: helper,\n  },\n}\n",
+	"lib/util.libsonnet":    "{\n  deploy(name):: name,\n  service: {},\n}\n",
+	"vendor/dep.libsonnet":  "{ deployment: {} }\n",
+	".cache/dep.libsonnet":  "{ deployment: {} }\n",
+	"broken.jsonnet":        "{ deployment: ",
+	"lib/data.txt":          "deployment",
+	"lib/empty.libsonnet":   "{}\n",
+	"lib/nested.libsonnet":  "local d = { deployment: 1 };\nd\n",
+	"lib/unmatched.jsonnet": "{ other: 1 }\n",
+}
+
+type workspaceSymbol struct {
+	name, container, file string
+}
+
+func workspaceSymbols(t *testing.T, root string, symbols []protocol.SymbolInformation) []workspaceSymbol {
+	t.Helper()
+	var found []workspaceSymbol
+	for _, symbol := range symbols {
+		rel, err := filepath.Rel(root, symbol.Location.URI.SpanURI().Filename())
+		require.NoError(t, err)
+		found = append(found, workspaceSymbol{name: symbol.Name, container: symbol.ContainerName, file: filepath.ToSlash(rel)})
+	}
+	return found
+}
+
+func TestSymbol(t *testing.T) {
+	testCases := []struct {
+		name     string
+		query    string
+		expected []workspaceSymbol
+	}{
+		{
+			name:  "prefix",
+			query: "deploy",
+			expected: []workspaceSymbol{
+				{name: "deploy", file: "lib/util.libsonnet"},
+				{name: "deployment", file: "main.jsonnet"},
+			},
+		},
+		{
+			name:  "case and gaps are ignored",
+			query: "RPL",
+			expected: []workspaceSymbol{
+				{name: "replicas", container: "deployment", file: "main.jsonnet"},
+			},
+		},
+		{
+			name:     "no match",
+			query:    "missing",
+			expected: nil,
+		},
+		{
+			name:  "functions",
+			query: "kind:function",
+			expected: []workspaceSymbol{
+				{name: "deploy", file: "lib/util.libsonnet"},
+			},
+		},
+		{
+			name:  "locals",
+			query: "kind:local",
+			expected: []workspaceSymbol{
+				{name: "d", file: "lib/nested.libsonnet"},
+				{name: "helper", file: "main.jsonnet"},
+			},
+		},
+		{
+			name:  "kinds and path prefix",
+			query: "kind:field,function path:lib/",
+			expected: []workspaceSymbol{
+				{name: "other", file: "lib/unmatched.jsonnet"},
+				{name: "deploy", file: "lib/util.libsonnet"},
+				{name: "service", file: "lib/util.libsonnet"},
+			},
+		},
+		{
+			name:  "name and several path prefixes",
+			query: "path:./main path:lib/u dep",
+			expected: []workspaceSymbol{
+				{name: "deploy", file: "lib/util.libsonnet"},
+				{name: "deployment", file: "main.jsonnet"},
+			},
+		},
+	}
+	root := writeProjectFiles(t, workspaceSymbolFiles)
+	s := renameTestServer(t, root, nil)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			symbols, err := s.Symbol(context.Background(), &protocol.WorkspaceSymbolParams{Query: tc.query})
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, workspaceSymbols(t, root, symbols))
+		})
+	}
+
+	_, err := s.Symbol(context.Background(), &protocol.WorkspaceSymbolParams{Query: "kind:method"})
+	assert.EqualError(t, err, `JSON RPC invalid params: unknown symbol kind "method", expected one of function, field, local`)
+}
+
+func TestSymbol_Progress(t *testing.T) {
+	root := writeProjectFiles(t, workspaceSymbolFiles)
+	s := renameTestServer(t, root, nil)
+	client := s.client.(*recordingClient)
+
+	params := &protocol.WorkspaceSymbolParams{Query: "deploy"}
+	params.WorkDoneToken = "work"
+	params.PartialResultToken = "partial"
+	symbols, err := s.Symbol(context.Background(), params)
+	require.NoError(t, err)
+	assert.Empty(t, symbols)
+
+	var partial []protocol.SymbolInformation
+	var kinds []string
+	for _, progress := range client.getProgress() {
+		switch progress.Token {
+		case "partial":
+			batch, ok := progress.Value.([]protocol.SymbolInformation)
+			require.True(t, ok)
+			// Each file's symbols are sent on their own
+			require.Len(t, batch, 1)
+			partial = append(partial, batch...)
+		case "work":
+			switch value := progress.Value.(type) {
+			case *protocol.WorkDoneProgressBegin:
+				kinds = append(kinds, value.Kind)
+			case *protocol.WorkDoneProgressReport:
+				kinds = append(kinds, value.Kind)
+			case *protocol.WorkDoneProgressEnd:
+				kinds = append(kinds, value.Kind)
+			}
+		}
+	}
+	assert.Equal(t, []workspaceSymbol{
+		{name: "deploy", file: "lib/util.libsonnet"},
+		{name: "deployment", file: "main.jsonnet"},
+	}, workspaceSymbols(t, root, partial))
+	// A report for each of the 6 Jsonnet files that aren't hidden or vendored, between the begin and the end
+	require.Len(t, kinds, 8)
+	assert.Equal(t, "begin", kinds[0])
+	assert.Equal(t, "end", kinds[len(kinds)-1])
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = s.Symbol(ctx, params)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestReferences_PartialResult(t *testing.T) {
+	root := writeProjectFiles(t, map[string]string{"main.jsonnet": "local a = 1;\n[a, a]\n"})
+	s := renameTestServer(t, root, nil)
+	client := s.client.(*recordingClient)
+	uri := serverOpenTestFile(t, s, filepath.Join(root, "main.jsonnet"))
+
+	params := &protocol.ReferenceParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     protocol.Position{Line: 1, Character: 1},
+		},
+	}
+	params.PartialResultToken = 1
+	locations, err := s.References(context.Background(), params)
+	require.NoError(t, err)
+	assert.Empty(t, locations)
+
+	progress := client.getProgress()
+	require.Len(t, progress, 1)
+	assert.Equal(t, 1, progress[0].Token)
+	assert.Equal(t, []protocol.Location{
+		{URI: uri, Range: makeRange(t, "1:1-1:2")},
+		{URI: uri, Range: makeRange(t, "1:4-1:5")},
+	}, progress[0].Value)
+}
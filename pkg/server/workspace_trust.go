@@ -0,0 +1,72 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jdbaldry/go-language-server-protocol/jsonrpc2"
+	log "github.com/sirupsen/logrus"
+)
+
+// errUntrustedWorkspace is the error of the features that are disabled in an untrusted workspace: the evaluations, and
+// the commands of the settings.
+var errUntrustedWorkspace = errors.New("the workspace isn't trusted")
+
+// trusted tells whether the files of the workspace can be evaluated, and the commands of the settings run. The
+// workspaces are trusted unless the client says otherwise.
+func (s *Server) trusted() bool {
+	return !s.untrusted.Load()
+}
+
+// initializationTrust tells whether the initialization options trust the workspace. Only `"trusted": false` doesn't.
+func initializationTrust(options interface{}) bool {
+	optionsMap, ok := options.(map[string]interface{})
+	if !ok {
+		return true
+	}
+	trusted, ok := optionsMap["trusted"].(bool)
+	return !ok || trusted
+}
+
+type didChangeTrustParams struct {
+	Trusted *bool `json:"trusted"`
+}
+
+// didChangeTrust handles the jsonnet/didChangeTrust notification, which the clients send when the user trusts the
+// workspace, or stops trusting it.
+func (s *Server) didChangeTrust(rawParams interface{}) (interface{}, error) {
+	var params didChangeTrustParams
+	if err := decodeParams(rawParams, &params); err != nil {
+		return nil, err
+	}
+	if params.Trusted == nil {
+		return nil, fmt.Errorf("%w: expected a trusted boolean", jsonrpc2.ErrInvalidParams)
+	}
+	s.setTrusted(*params.Trusted)
+	return nil, nil
+}
+
+// setTrusted changes the trust of the workspace. The open documents are analysed again, the evaluation diagnostics
+// appear or disappear.
+func (s *Server) setTrusted(trusted bool) {
+	if s.untrusted.Swap(!trusted) == !trusted {
+		return
+	}
+	if trusted {
+		log.Info("The workspace is trusted: its files are evaluated")
+	} else {
+		log.Info("The workspace isn't trusted: its files aren't evaluated and the commands of the settings don't run")
+	}
+	s.refreshCommandExtCode()
+	s.restartAnalysis()
+}
+
+// requireTrust returns an error that names the feature if the workspace isn't trusted.
+func (s *Server) requireTrust(ctx context.Context, feature string) error {
+	if s.trusted() {
+		return nil
+	}
+	log.WithContext(ctx).Debugf("%s is disabled: %v", feature, errUntrustedWorkspace)
+	return fmt.Errorf("%w: %s is disabled", errUntrustedWorkspace, feature)
+}
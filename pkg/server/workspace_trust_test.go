@@ -0,0 +1,86 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInitializationTrust(t *testing.T) {
+	testCases := []struct {
+		name    string
+		options interface{}
+		trusted bool
+	}{
+		{name: "no options", trusted: true},
+		{name: "no trusted option", options: map[string]interface{}{"other": false}, trusted: true},
+		{name: "trusted", options: map[string]interface{}{"trusted": true}, trusted: true},
+		{name: "untrusted", options: map[string]interface{}{"trusted": false}, trusted: false},
+		{name: "not a boolean", options: map[string]interface{}{"trusted": "false"}, trusted: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.trusted, initializationTrust(tc.options))
+		})
+	}
+}
+
+func TestWorkspaceTrust(t *testing.T) {
+	root := writeProjectFiles(t, map[string]string{"main.jsonnet": "{ a: error 'failed' }\n"})
+	main := filepath.Join(root, "main.jsonnet")
+	s := renameTestServer(t, root, nil)
+	require.NoError(t, s.DidChangeConfiguration(context.Background(), &protocol.DidChangeConfigurationParams{
+		Settings: map[string]interface{}{"enable_eval_diagnostics": true},
+	}))
+	uri := serverOpenTestFile(t, s, main)
+	changeTrust := func(trusted bool) {
+		_, err := s.NonstandardRequest(context.Background(), "jsonnet/didChangeTrust", map[string]interface{}{"trusted": trusted})
+		require.NoError(t, err)
+	}
+
+	changeTrust(false)
+	require.NoError(t, s.DidChangeConfiguration(context.Background(), &protocol.DidChangeConfigurationParams{
+		Settings: map[string]interface{}{
+			"ext_code_from_command": map[string]interface{}{"cluster": []interface{}{"echo", "'dev'"}},
+			"confirm_commands":      false,
+		},
+	}))
+
+	// Nothing is evaluated, and the commands don't run. The diagnostics of a copy of the document are computed, the
+	// server's goroutines compute those of the document meanwhile.
+	doc, err := s.cache.get(uri)
+	require.NoError(t, err)
+	copied := *doc
+	assert.Empty(t, s.getEvalDiags(context.Background(), &copied))
+	_, err = s.evaluateFile(context.Background(), main, "")
+	assert.True(t, errors.Is(err, errUntrustedWorkspace))
+	assert.EqualError(t, err, "the workspace isn't trusted: evaluation is disabled")
+	s.runningCommands.Wait()
+	assert.Empty(t, s.extCodeOfCommands())
+
+	// The syntactic features are available
+	symbols, err := s.DocumentSymbol(context.Background(), &protocol.DocumentSymbolParams{TextDocument: protocol.TextDocumentIdentifier{URI: uri}})
+	require.NoError(t, err)
+	assert.Len(t, symbols, 1)
+	_, err = s.Formatting(context.Background(), &protocol.DocumentFormattingParams{TextDocument: protocol.TextDocumentIdentifier{URI: uri}})
+	require.NoError(t, err)
+
+	// Once trusted, the workspace is evaluated
+	changeTrust(true)
+	s.runningCommands.Wait()
+	doc, err = s.cache.get(uri)
+	require.NoError(t, err)
+	copied = *doc
+	diags := s.getEvalDiags(context.Background(), &copied)
+	require.Len(t, diags, 1)
+	assert.Contains(t, diags[0].Message, "failed")
+	assert.Equal(t, map[string]string{"cluster": "\"dev\"\n"}, s.extCodeOfCommands())
+
+	_, err = s.NonstandardRequest(context.Background(), "jsonnet/didChangeTrust", map[string]interface{}{})
+	assert.EqualError(t, err, "JSON RPC invalid params: expected a trusted boolean")
+}
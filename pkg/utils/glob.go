@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"path"
+	"strings"
+)
+
+// MatchGlob matches a slash separated path against a glob pattern, in which `**` matches any number of directories.
+func MatchGlob(pattern, name string) bool {
+	patternParts := strings.Split(pattern, "/")
+	nameParts := strings.Split(name, "/")
+	var match func(p, n int) bool
+	match = func(p, n int) bool {
+		if p == len(patternParts) {
+			return n == len(nameParts)
+		}
+		if patternParts[p] == "**" {
+			for i := n; i <= len(nameParts); i++ {
+				if match(p+1, i) {
+					return true
+				}
+			}
+			return false
+		}
+		if n == len(nameParts) {
+			return false
+		}
+		if matched, _ := path.Match(patternParts[p], nameParts[n]); !matched {
+			return false
+		}
+		return match(p+1, n+1)
+	}
+	return match(0, 0)
+}